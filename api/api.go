@@ -0,0 +1,91 @@
+// Package api is a client for the Sourcegraph GraphQL API, for Go programs
+// that talk to Sourcegraph the same way src does.
+//
+// Unlike the packages in internal/, the identifiers in this package are
+// covered by the compatibility promise of src releases: they are only
+// removed or changed incompatibly in a major release.
+package api
+
+import (
+	"flag"
+	"io/ioutil"
+
+	impl "github.com/sourcegraph/src-cli/internal/api"
+)
+
+type (
+	// Client creates requests to the GraphQL API.
+	Client = impl.Client
+
+	// Request is a GraphQL request created by a Client.
+	Request = impl.Request
+
+	// ClientOpts are the options given to NewClient.
+	ClientOpts = impl.ClientOpts
+
+	// Flags are the flags of src commands that make GraphQL requests, e.g.
+	// -get-curl. See NewFlags.
+	Flags = impl.Flags
+
+	// RequestEvent describes a request, see ClientOpts.Observe.
+	RequestEvent = impl.RequestEvent
+)
+
+// The errors returned by requests. Use errors.As to check for them.
+type (
+	// HTTPError is returned when the API responds with a status other than
+	// 200 OK.
+	HTTPError = impl.HTTPError
+
+	// NetworkError is returned when the API can't be reached.
+	NetworkError = impl.NetworkError
+
+	// GraphQLErrors are returned when the response contains GraphQL errors.
+	GraphQLErrors = impl.GraphQLErrors
+
+	// GraphQLError is a single GraphQL error.
+	GraphQLError = impl.GraphQLError
+
+	// GraphQLErrorKind classifies GraphQL errors, see GraphQLError.Kind.
+	GraphQLErrorKind = impl.GraphQLErrorKind
+)
+
+// The kinds of GraphQL errors.
+const (
+	GraphQLErrorUnknown         = impl.GraphQLErrorUnknown
+	GraphQLErrorUnauthorized    = impl.GraphQLErrorUnauthorized
+	GraphQLErrorNotFound        = impl.GraphQLErrorNotFound
+	GraphQLErrorRateLimited     = impl.GraphQLErrorRateLimited
+	GraphQLErrorLicenseRequired = impl.GraphQLErrorLicenseRequired
+)
+
+// NewClient returns a client for the API at opts.Endpoint. Unlike the client
+// used by src, diagnostics are discarded if opts.Out is nil.
+func NewClient(opts ClientOpts) Client {
+	if opts.Out == nil {
+		opts.Out = ioutil.Discard
+	}
+	return impl.NewClient(opts)
+}
+
+// NewFlags registers the flags of src commands that make GraphQL requests,
+// e.g. -get-curl, on flagSet. Programs that don't need them can leave
+// ClientOpts.Flags nil.
+func NewFlags(flagSet *flag.FlagSet) *Flags {
+	return impl.NewFlags(flagSet)
+}
+
+// SetDefaultUserAgent sets the User-Agent sent with requests to Sourcegraph
+// by clients without ClientOpts.UserAgent, and when downloading repository
+// archives. Programs embedding src should identify themselves with it, e.g.
+// with FormatUserAgent.
+func SetDefaultUserAgent(userAgent string) {
+	impl.UserAgent = userAgent
+}
+
+// FormatUserAgent returns a User-Agent in the format src uses, e.g.
+// "src-cli/3.17.0 (actions exec; source=nightly-upgrades)". command and
+// source may be empty.
+func FormatUserAgent(version, command, source string) string {
+	return impl.FormatUserAgent(version, command, source)
+}
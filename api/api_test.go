@@ -0,0 +1,33 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/sourcegraph/src-cli/internal/apicompat"
+)
+
+func TestAPICompatibility(t *testing.T) {
+	apicompat.Check(t, map[string]interface{}{
+		"Client":        (*Client)(nil),
+		"Request":       (*Request)(nil),
+		"ClientOpts":    (*ClientOpts)(nil),
+		"Flags":         (*Flags)(nil),
+		"RequestEvent":  (*RequestEvent)(nil),
+		"HTTPError":     (*HTTPError)(nil),
+		"NetworkError":  (*NetworkError)(nil),
+		"GraphQLErrors": (*GraphQLErrors)(nil),
+		"GraphQLError":  (*GraphQLError)(nil),
+
+		"GraphQLErrorKind":            (*GraphQLErrorKind)(nil),
+		"GraphQLErrorUnknown":         GraphQLErrorUnknown,
+		"GraphQLErrorUnauthorized":    GraphQLErrorUnauthorized,
+		"GraphQLErrorNotFound":        GraphQLErrorNotFound,
+		"GraphQLErrorRateLimited":     GraphQLErrorRateLimited,
+		"GraphQLErrorLicenseRequired": GraphQLErrorLicenseRequired,
+
+		"NewClient":           NewClient,
+		"NewFlags":            NewFlags,
+		"SetDefaultUserAgent": SetDefaultUserAgent,
+		"FormatUserAgent":     FormatUserAgent,
+	})
+}
@@ -0,0 +1,201 @@
+// Package campaigns executes actions to produce the patches of campaigns, for
+// Go programs that embed campaign execution instead of running src as a
+// subprocess.
+//
+// A program parses an action definition, resolves the repositories to run it
+// in, executes it and creates a patch set from the resulting patches:
+//
+//	svc := campaigns.NewService(campaigns.ServiceOpts{
+//		Endpoint:    "https://sourcegraph.example.com",
+//		AccessToken: token,
+//	})
+//	action, err := campaigns.ParseAction("action.yml", def)
+//	...
+//	repo, err := svc.ResolveRepository(ctx, "github.com/example/repo")
+//	...
+//	patches, err := svc.Execute(ctx, action, []campaigns.ActionRepo{repo}, campaigns.ExecuteOpts{})
+//	...
+//	patchSet, err := svc.CreatePatchSet(ctx, patches)
+//
+// Steps are run with Docker and git, which must be available, just like for
+// 'src actions exec'.
+//
+// Unlike the packages in internal/, the identifiers in this package are
+// covered by the compatibility promise of src releases: they are only
+// removed or changed incompatibly in a major release.
+package campaigns
+
+import (
+	"context"
+
+	impl "github.com/sourcegraph/src-cli/internal/campaigns"
+)
+
+// The specs of actions and their results.
+type (
+	// Action is an action definition, see ParseAction.
+	Action = impl.Action
+
+	// ActionStep is a single step of an action.
+	ActionStep = impl.ActionStep
+
+	// ActionRepo is a repository, at a revision, that an action is executed
+	// in. See Service.ResolveRepository.
+	ActionRepo = impl.ActionRepo
+
+	// PatchInput is the patch produced by executing an action in a
+	// repository.
+	PatchInput = impl.PatchInput
+
+	// MatrixEntry is a combination of the values in the matrix of an
+	// action, see Action.MatrixEntries and Action.WithMatrix.
+	MatrixEntry = impl.MatrixEntry
+
+	// Secrets maps the names of secrets that steps refer to with
+	// ${{ secrets.NAME }} to their values.
+	Secrets = impl.Secrets
+
+	// Vars maps the names of variables that action definitions refer to
+	// with ${{ vars.NAME }} to their values, see ParseActionWithVars.
+	Vars = impl.Vars
+)
+
+// The execution of actions.
+type (
+	// Executor executes an action in the repositories enqueued with
+	// EnqueueRepo. Create it with Service.NewExecutor.
+	Executor = impl.Executor
+
+	// ExecutorOpts are the options of an Executor. The connection options
+	// are set by the Service.
+	ExecutorOpts = impl.ExecutorOpts
+
+	// ActionLogger reports the progress of executions on standard error and
+	// keeps the logs of the steps in each repository.
+	ActionLogger = impl.ActionLogger
+
+	// ExecutionCache caches the patches produced in repositories, see
+	// ExecutionDiskCache.
+	ExecutionCache = impl.ExecutionCache
+
+	// ExecutionCacheKey identifies a cached execution.
+	ExecutionCacheKey = impl.ExecutionCacheKey
+
+	// ExecutionDiskCache caches patches in a directory, like
+	// 'src actions exec -cache'.
+	ExecutionDiskCache = impl.ExecutionDiskCache
+
+	// Metrics collects counters and timings about executions.
+	Metrics = impl.Metrics
+
+	// MetricsSummary are the totals of Metrics, see Metrics.Summary.
+	MetricsSummary = impl.MetricsSummary
+
+	// DownloadLimiter limits the combined rate at which executors download
+	// repository archives.
+	DownloadLimiter = impl.DownloadLimiter
+
+	// ExecutionStats describes how effective the cache was in an execution,
+	// see Executor.Stats.
+	ExecutionStats = impl.ExecutionStats
+
+	// RepoDuration is the duration of the execution in a repository.
+	RepoDuration = impl.RepoDuration
+
+	// TimedExecutionCache is an ExecutionCache that also records the
+	// durations of the executions, to estimate the time saved by cache hits.
+	TimedExecutionCache = impl.TimedExecutionCache
+
+	// Hooks are executables that are run before and after the steps in each
+	// repository, see ExecutorOpts.Hooks.
+	Hooks = impl.Hooks
+
+	// HookInput is given to hooks as JSON on their standard input.
+	HookInput = impl.HookInput
+
+	// HookOutput can be printed by hooks as JSON on their standard output.
+	HookOutput = impl.HookOutput
+)
+
+// The formats of the timestamps in the log files of repositories, see
+// ActionLogger.SetLogTimestamps.
+const (
+	LogTimestampsAbsolute = impl.LogTimestampsAbsolute
+	LogTimestampsRelative = impl.LogTimestampsRelative
+	LogTimestampsNone     = impl.LogTimestampsNone
+)
+
+// The points of the execution at which hooks are run, see HookInput.Hook.
+const (
+	HookPreTask  = impl.HookPreTask
+	HookPostStep = impl.HookPostStep
+	HookPostTask = impl.HookPostTask
+)
+
+// The modes for handling steps that stall, see ExecutorOpts.OnStall.
+const (
+	OnStallWarn    = impl.OnStallWarn
+	OnStallKill    = impl.OnStallKill
+	OnStallRestart = impl.OnStallRestart
+)
+
+// ParseAction parses and validates the YAML or JSON action definition def,
+// which was read from path. path is used to resolve the definitions def
+// extends and may be empty if there are none.
+func ParseAction(path string, def []byte) (Action, error) {
+	return impl.ParseAction(path, def)
+}
+
+// ParseActionWithVars is like ParseAction, but also replaces the
+// ${{ vars.NAME }} placeholders in the definition with the values in vars.
+func ParseActionWithVars(path string, def []byte, vars Vars) (Action, error) {
+	return impl.ParseActionWithVars(path, def, vars)
+}
+
+// ReadVarsFile reads the variables in the YAML or JSON file at path for
+// ParseActionWithVars.
+func ReadVarsFile(path string) (Vars, error) {
+	return impl.ReadVarsFile(path)
+}
+
+// PrepareAction pulls and builds the Docker images of the steps of action.
+// Executors require the action to be prepared.
+func PrepareAction(ctx context.Context, action Action, logger *ActionLogger) error {
+	return impl.PrepareAction(ctx, action, logger)
+}
+
+// NewActionLogger returns a logger that prints progress to standard error,
+// unless quiet is set, and the output of steps if verbose is set. The logs
+// of the steps are removed when a repository is done unless keepLogs is set.
+func NewActionLogger(verbose, keepLogs, quiet bool) *ActionLogger {
+	return impl.NewActionLogger(verbose, keepLogs, quiet)
+}
+
+// NewMetrics returns an empty set of metrics for ExecutorOpts.Metrics.
+func NewMetrics() *Metrics {
+	return impl.NewMetrics()
+}
+
+// NewDownloadLimiter returns a limiter for ExecutorOpts.DownloadLimiter that
+// limits downloads to bytesPerSecond, or nil if it isn't positive.
+func NewDownloadLimiter(bytesPerSecond int64) *DownloadLimiter {
+	return impl.NewDownloadLimiter(bytesPerSecond)
+}
+
+// ReadSecretsFile reads secrets from a YAML or JSON file with an object that
+// maps their names to their values.
+func ReadSecretsFile(path string) (Secrets, error) {
+	return impl.ReadSecretsFile(path)
+}
+
+// CheckSecrets returns an error if action refers to secrets that are missing
+// in secrets.
+func CheckSecrets(action Action, secrets Secrets) error {
+	return impl.CheckSecrets(action, secrets)
+}
+
+// RunActionLocally runs the steps of action on a copy of dir and returns the
+// resulting diff, without connecting to Sourcegraph.
+func RunActionLocally(ctx context.Context, dir string, action Action, secrets Secrets, logger *ActionLogger) ([]byte, error) {
+	return impl.RunActionLocally(ctx, dir, action, secrets, false, false, logger)
+}
@@ -0,0 +1,62 @@
+package campaigns
+
+import (
+	"testing"
+
+	"github.com/sourcegraph/src-cli/internal/apicompat"
+)
+
+func TestAPICompatibility(t *testing.T) {
+	apicompat.Check(t, map[string]interface{}{
+		"Action":      (*Action)(nil),
+		"ActionStep":  (*ActionStep)(nil),
+		"ActionRepo":  (*ActionRepo)(nil),
+		"PatchInput":  (*PatchInput)(nil),
+		"MatrixEntry": (*MatrixEntry)(nil),
+		"Secrets":     (*Secrets)(nil),
+		"Vars":        (*Vars)(nil),
+
+		"Executor":            (*Executor)(nil),
+		"ExecutorOpts":        (*ExecutorOpts)(nil),
+		"ActionLogger":        (*ActionLogger)(nil),
+		"ExecutionCache":      (*ExecutionCache)(nil),
+		"ExecutionCacheKey":   (*ExecutionCacheKey)(nil),
+		"ExecutionDiskCache":  (*ExecutionDiskCache)(nil),
+		"Metrics":             (*Metrics)(nil),
+		"MetricsSummary":      (*MetricsSummary)(nil),
+		"DownloadLimiter":     (*DownloadLimiter)(nil),
+		"ExecutionStats":      (*ExecutionStats)(nil),
+		"RepoDuration":        (*RepoDuration)(nil),
+		"TimedExecutionCache": (*TimedExecutionCache)(nil),
+		"Hooks":               (*Hooks)(nil),
+		"HookInput":           (*HookInput)(nil),
+		"HookOutput":          (*HookOutput)(nil),
+
+		"LogTimestampsAbsolute": LogTimestampsAbsolute,
+		"LogTimestampsRelative": LogTimestampsRelative,
+		"LogTimestampsNone":     LogTimestampsNone,
+		"HookPreTask":           HookPreTask,
+		"HookPostStep":          HookPostStep,
+		"HookPostTask":          HookPostTask,
+		"OnStallWarn":           OnStallWarn,
+		"OnStallKill":           OnStallKill,
+		"OnStallRestart":        OnStallRestart,
+
+		"ParseAction":         ParseAction,
+		"ParseActionWithVars": ParseActionWithVars,
+		"ReadVarsFile":        ReadVarsFile,
+		"PrepareAction":       PrepareAction,
+		"NewActionLogger":     NewActionLogger,
+		"NewMetrics":          NewMetrics,
+		"NewDownloadLimiter":  NewDownloadLimiter,
+		"ReadSecretsFile":     ReadSecretsFile,
+		"CheckSecrets":        CheckSecrets,
+		"RunActionLocally":    RunActionLocally,
+
+		"ServiceOpts": (*ServiceOpts)(nil),
+		"Service":     (*Service)(nil),
+		"NewService":  NewService,
+		"ExecuteOpts": (*ExecuteOpts)(nil),
+		"PatchSet":    (*PatchSet)(nil),
+	})
+}
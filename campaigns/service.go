@@ -0,0 +1,183 @@
+package campaigns
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/src-cli/api"
+	impl "github.com/sourcegraph/src-cli/internal/campaigns"
+)
+
+// ServiceOpts are the options given to NewService.
+type ServiceOpts struct {
+	Endpoint          string
+	AccessToken       string
+	AdditionalHeaders map[string]string
+
+	// UserAgent is sent with the GraphQL requests of the service. See
+	// api.SetDefaultUserAgent for the other requests.
+	UserAgent string
+}
+
+// Service executes actions in the repositories of a Sourcegraph instance and
+// creates patch sets from their results.
+type Service struct {
+	opts   ServiceOpts
+	client api.Client
+}
+
+// NewService returns a service for the instance at opts.Endpoint.
+func NewService(opts ServiceOpts) *Service {
+	return &Service{
+		opts: opts,
+		client: api.NewClient(api.ClientOpts{
+			Endpoint:          opts.Endpoint,
+			AccessToken:       opts.AccessToken,
+			AdditionalHeaders: opts.AdditionalHeaders,
+			UserAgent:         opts.UserAgent,
+		}),
+	}
+}
+
+// Client returns the GraphQL API client of the service.
+func (s *Service) Client() api.Client {
+	return s.client
+}
+
+const resolveRepositoryQuery = `
+query ResolveRepository($name: String!) {
+	repository(name: $name) {
+		id
+		name
+		externalRepository {
+			serviceType
+		}
+		defaultBranch {
+			name
+			target {
+				oid
+			}
+		}
+	}
+}
+`
+
+// ResolveRepository returns the repository with the given name at the current
+// commit of its default branch.
+func (s *Service) ResolveRepository(ctx context.Context, name string) (ActionRepo, error) {
+	var result struct {
+		Repository *struct {
+			ID, Name           string
+			ExternalRepository struct {
+				ServiceType string
+			}
+			DefaultBranch *struct {
+				Name   string
+				Target struct{ OID string }
+			}
+		}
+	}
+	if _, err := s.client.NewRequest(resolveRepositoryQuery, map[string]interface{}{"name": name}).Do(ctx, &result); err != nil {
+		return ActionRepo{}, err
+	}
+	repo := result.Repository
+	if repo == nil {
+		return ActionRepo{}, fmt.Errorf("repository %q not found", name)
+	}
+	if repo.DefaultBranch == nil || repo.DefaultBranch.Name == "" || repo.DefaultBranch.Target.OID == "" {
+		return ActionRepo{}, fmt.Errorf("the default branch of repository %q could not be determined", name)
+	}
+	return ActionRepo{
+		ID:      repo.ID,
+		Name:    repo.Name,
+		Rev:     repo.DefaultBranch.Target.OID,
+		BaseRef: repo.DefaultBranch.Name,
+
+		ExternalServiceType: repo.ExternalRepository.ServiceType,
+	}, nil
+}
+
+// NewExecutor returns an executor for action that downloads the repository
+// archives from the instance of the service. The action must be prepared with
+// PrepareAction.
+func (s *Service) NewExecutor(action Action, parallelism int, logger *ActionLogger, opts ExecutorOpts) *Executor {
+	opts.Endpoint = s.opts.Endpoint
+	opts.AccessToken = s.opts.AccessToken
+	opts.AdditionalHeaders = s.opts.AdditionalHeaders
+	return impl.NewExecutor(action, parallelism, logger, opts)
+}
+
+// ExecuteOpts are the options of Service.Execute.
+type ExecuteOpts struct {
+	ExecutorOpts
+
+	// Parallelism is the number of repositories the action is executed in
+	// concurrently. Defaults to the number of CPUs.
+	Parallelism int
+
+	// Logger reports the progress of the execution. Defaults to a logger
+	// that doesn't print anything.
+	Logger *ActionLogger
+}
+
+// Execute prepares action and executes it in repos. It returns the patches
+// produced in all repositories in which the execution succeeded, even if it
+// failed in others. Actions with a matrix must be expanded with
+// Action.WithMatrix first.
+func (s *Service) Execute(ctx context.Context, action Action, repos []ActionRepo, opts ExecuteOpts) ([]PatchInput, error) {
+	if len(action.Matrix) > 0 {
+		return nil, errors.New("the action has a matrix: execute it once for each of Action.MatrixEntries with Action.WithMatrix")
+	}
+	if opts.Parallelism <= 0 {
+		opts.Parallelism = runtime.GOMAXPROCS(0)
+	}
+	if opts.Logger == nil {
+		opts.Logger = NewActionLogger(false, false, true)
+	}
+
+	if err := PrepareAction(ctx, action, opts.Logger); err != nil {
+		return nil, errors.Wrap(err, "preparing action")
+	}
+
+	opts.Logger.Start(len(repos) * len(action.Steps))
+	executor := s.NewExecutor(action, opts.Parallelism, opts.Logger, opts.ExecutorOpts)
+	for _, repo := range repos {
+		executor.EnqueueRepo(repo)
+	}
+	go executor.Start(ctx)
+	err := executor.Wait()
+	return executor.AllPatches(), err
+}
+
+// PatchSet is a set of patches on a Sourcegraph instance, from which a
+// campaign can be created.
+type PatchSet struct {
+	ID string `json:"id"`
+
+	// PreviewURL is the URL of the page that shows the patches and on which a
+	// campaign can be created from them.
+	PreviewURL string `json:"previewURL"`
+}
+
+const createPatchSetMutation = `
+mutation CreatePatchSetFromPatches($patches: [PatchInput!]!) {
+	createPatchSetFromPatches(patches: $patches) {
+		id
+		previewURL
+	}
+}
+`
+
+// CreatePatchSet creates a patch set from patches. It requires Sourcegraph
+// 3.14 or later.
+func (s *Service) CreatePatchSet(ctx context.Context, patches []PatchInput) (*PatchSet, error) {
+	var result struct {
+		CreatePatchSetFromPatches PatchSet
+	}
+	if _, err := s.client.NewRequest(createPatchSetMutation, map[string]interface{}{"patches": patches}).Do(ctx, &result); err != nil {
+		return nil, err
+	}
+	return &result.CreatePatchSetFromPatches, nil
+}
@@ -0,0 +1,79 @@
+package campaigns
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestService(t *testing.T) {
+	var requests []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Query     string
+			Variables map[string]interface{}
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatal(err)
+		}
+		requests = append(requests, r.Header.Get("User-Agent")+" "+r.Header.Get("Authorization"))
+
+		switch {
+		case strings.Contains(req.Query, "ResolveRepository") && req.Variables["name"] == "github.com/example/repo":
+			w.Write([]byte(`{"data": {"repository": {"id": "UmVwbzox", "name": "github.com/example/repo", "defaultBranch": {"name": "refs/heads/main", "target": {"oid": "deadbeef"}}}}}`))
+		case strings.Contains(req.Query, "ResolveRepository") && req.Variables["name"] == "github.com/example/empty":
+			w.Write([]byte(`{"data": {"repository": {"id": "UmVwbzoy", "name": "github.com/example/empty", "defaultBranch": null}}}`))
+		case strings.Contains(req.Query, "ResolveRepository"):
+			w.Write([]byte(`{"data": {"repository": null}}`))
+		case strings.Contains(req.Query, "CreatePatchSetFromPatches"):
+			w.Write([]byte(`{"data": {"createPatchSetFromPatches": {"id": "UGF0Y2hTZXQ6MQ==", "previewURL": "https://sourcegraph.example.com/campaigns/new?patchSet=UGF0Y2hTZXQ6MQ=="}}}`))
+		default:
+			t.Errorf("unexpected query %q", req.Query)
+		}
+	}))
+	defer ts.Close()
+
+	ctx := context.Background()
+	svc := NewService(ServiceOpts{Endpoint: ts.URL, AccessToken: "abc", UserAgent: "embedder/1.0"})
+
+	repo, err := svc.ResolveRepository(ctx, "github.com/example/repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ActionRepo{ID: "UmVwbzox", Name: "github.com/example/repo", Rev: "deadbeef", BaseRef: "refs/heads/main"}
+	if diff := cmp.Diff(want, repo); diff != "" {
+		t.Errorf("unexpected repository (-want +have):\n%s", diff)
+	}
+
+	for name, wantErr := range map[string]string{
+		"github.com/example/empty":   "default branch",
+		"github.com/example/missing": "not found",
+	} {
+		if _, err := svc.ResolveRepository(ctx, name); err == nil || !strings.Contains(err.Error(), wantErr) {
+			t.Errorf("ResolveRepository(%q): unexpected error %v, want %q", name, err, wantErr)
+		}
+	}
+
+	patchSet, err := svc.CreatePatchSet(ctx, []PatchInput{{Repository: repo.ID, BaseRevision: repo.Rev, BaseRef: repo.BaseRef, Patch: "diff"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if patchSet.ID != "UGF0Y2hTZXQ6MQ==" || !strings.HasSuffix(patchSet.PreviewURL, "patchSet=UGF0Y2hTZXQ6MQ==") {
+		t.Errorf("unexpected patch set %+v", patchSet)
+	}
+
+	for _, r := range requests {
+		if r != "embedder/1.0 token abc" {
+			t.Errorf("unexpected User-Agent and Authorization %q", r)
+		}
+	}
+
+	if _, err := svc.Execute(ctx, Action{Matrix: map[string][]string{"go": {"1.14"}}}, []ActionRepo{repo}, ExecuteOpts{}); err == nil {
+		t.Error("expected error for action with matrix")
+	}
+}
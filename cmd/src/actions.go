@@ -19,7 +19,13 @@ Usage:
 The commands are:
 
 	exec              executes an action to produce patches
+	inspect           shows what executing an action would do, without executing it
+	diff              compares the patches of the last two executions of an action
 	scope-query       list the repositories matched by "scopeQuery" in action
+	validate          validates an action definition without connecting to Sourcegraph
+	lint              reports suspicious patterns in an action definition
+	generate          generates an action definition for a common type of campaign
+	test-step         runs the steps of an action on a local directory and prints the diff
 
 Use "src actions [command] -h" for more information about a command.
 `
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/fatih/color"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	usage := `
+Compare the last two executions of an action file with 'src actions exec': list the repositories the action is newly or no longer executed in, those that newly got a patch, those that no longer got one and those whose patch differs, with the files whose changes differ. This shows the effect of editing the scopeQuery or the steps of an action.
+
+'src actions exec' records the repositories and patches of every execution of an action file, which is not read from standard input, in the -cache directory. Repositories in which the execution failed are listed as failed, unless it also failed in the previous execution, and their patches are not compared.
+
+Examples:
+
+  Compare the last two executions of action.yml:
+
+		$ src actions exec -f action.yml
+		$ vim action.yml
+		$ src actions exec -f action.yml
+		$ src actions diff -f action.yml
+
+`
+
+	flagSet := flag.NewFlagSet("diff", flag.ExitOnError)
+	usageFunc := func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'src actions %s':\n", flagSet.Name())
+		flagSet.PrintDefaults()
+		fmt.Println(usage)
+	}
+
+	cacheDir, displayUserCacheDir := defaultActionCacheDir()
+
+	var (
+		fileFlag     = flagSet.String("f", "", "The action file. (Required)")
+		cacheDirFlag = flagSet.String("cache", displayUserCacheDir, "Directory for cached results, in which 'src actions exec' recorded the executions.")
+	)
+
+	handler := func(args []string) error {
+		if err := flagSet.Parse(args); err != nil {
+			return err
+		}
+		if flagSet.NArg() != 0 {
+			return &usageError{errors.New("unexpected arguments")}
+		}
+		if *fileFlag == "" || *fileFlag == "-" {
+			return &usageError{errors.New("an action file must be given with -f")}
+		}
+		if *cacheDirFlag == displayUserCacheDir {
+			*cacheDirFlag = cacheDir
+		}
+
+		dir, err := actionRunsDir(*cacheDirFlag, *fileFlag)
+		if err != nil {
+			return err
+		}
+		latest, err := readActionRun(dir, latestRunFile)
+		if err != nil {
+			return err
+		}
+		previous, err := readActionRun(dir, previousRunFile)
+		if err != nil {
+			return err
+		}
+		if latest == nil || previous == nil {
+			return fmt.Errorf("%s must have been executed at least twice with 'src actions exec -cache %s' to compare the executions", *fileFlag, *cacheDirFlag)
+		}
+
+		fmt.Printf("Comparing the patches of the executions at %s and %s:\n\n", describeActionRun(previous), describeActionRun(latest))
+		changes := diffActionRuns(*previous, *latest)
+		if len(changes) == 0 {
+			fmt.Println("The repositories and patches are the same.")
+			return nil
+		}
+		for _, c := range changes {
+			name := c.Repository
+			if c.Matrix != "" {
+				name += " [" + c.Matrix + "]"
+			}
+			switch c.Repo {
+			case runRepoAdded:
+				switch c.Kind {
+				case runPatchAdded:
+					color.New(color.FgGreen).Printf("+ %s: newly executed, new patch\n", name)
+				case runExecutionFailed:
+					color.New(color.FgRed).Printf("+ %s: newly executed, execution failed\n", name)
+				default:
+					color.New(color.FgGreen).Printf("+ %s: newly executed, no changes\n", name)
+				}
+				continue
+			case runRepoRemoved:
+				if c.Kind == runPatchRemoved {
+					color.New(color.FgRed).Printf("- %s: no longer executed, had a patch\n", name)
+				} else {
+					color.New(color.FgRed).Printf("- %s: no longer executed\n", name)
+				}
+				continue
+			}
+			switch c.Kind {
+			case runExecutionFailed:
+				color.New(color.FgRed).Printf("! %s: execution failed\n", name)
+			case runPatchAdded:
+				color.New(color.FgGreen).Printf("+ %s: new patch\n", name)
+			case runPatchRemoved:
+				color.New(color.FgRed).Printf("- %s: no patch anymore\n", name)
+			case runPatchChanged:
+				switch len(c.Files) {
+				case 0:
+					color.New(color.FgYellow).Printf("~ %s: patch is based on another branch\n", name)
+				case 1:
+					color.New(color.FgYellow).Printf("~ %s: patch differs in 1 file\n", name)
+				default:
+					color.New(color.FgYellow).Printf("~ %s: patch differs in %d files\n", name, len(c.Files))
+				}
+				for _, f := range c.Files {
+					fmt.Printf("    %s\n", f)
+				}
+			}
+		}
+		return nil
+	}
+
+	// Register the command.
+	actionsCommands = append(actionsCommands, &command{
+		flagSet:   flagSet,
+		handler:   handler,
+		usageFunc: usageFunc,
+	})
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"bufio"
 	"context"
+	"crypto/ed25519"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -14,15 +15,21 @@ import (
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"sort"
 	"strings"
+	"text/template"
 	"time"
 
+	humanize "github.com/dustin/go-humanize"
 	"github.com/fatih/color"
 	"github.com/ghodss/yaml"
 	"github.com/mattn/go-isatty"
+	"github.com/neelance/parallel"
 	"github.com/pkg/errors"
 	"github.com/sourcegraph/src-cli/internal/api"
 	"github.com/sourcegraph/src-cli/internal/campaigns"
+	"github.com/sourcegraph/src-cli/internal/output"
+	"github.com/sourcegraph/src-cli/internal/tracing"
 )
 
 const defaultTimeout = 60 * time.Minute
@@ -57,12 +64,48 @@ Examples:
 
 	$ cat ~/my-action.json | src actions exec -f -
 
+  Execute an action and write signed provenance metadata for the produced patches next to them:
+
+	$ src actions exec -f ~/run-gofmt.json -provenance-file provenance.json -provenance-key ~/signing-key.pem
+
+  Execute an action for a campaign on the branch 'run-gofmt', skipping repositories in which a campaign already has an open changeset on that branch:
+
+	$ src actions exec -f ~/run-gofmt.json -branch run-gofmt -on-open-changeset skip
+
+  Execute an action and write the patch produced in each repository to a separate file in the directory 'patches':
+
+	$ src actions exec -f ~/run-gofmt.json -patch-dir patches
+
+  Execute an action and write Prometheus metrics about the execution to a file:
+
+	$ src actions exec -f ~/run-gofmt.json -metrics-file /var/lib/node_exporter/src-actions.prom
+
+  Execute an action whose steps refer to secrets, e.g. ${{ secrets.NPM_TOKEN }}, with their values in secrets.yml:
+
+	$ src actions exec -f ~/publish.json -secrets-file secrets.yml
+
+  Execute an action whose scopeQuery refers to variables, e.g. "repo:^github.com/${{ vars.org }}/", with their values in team-a.yml, overriding one of them:
+
+	$ src actions exec -f ~/run-gofmt.yml -var-file team-a.yml -var org=team-a-forks
+
+  Execute an action and restart the execution in repositories in which a step produces no output for 10 minutes:
+
+	$ src actions exec -f ~/run-gofmt.json -stall-timeout 10m -on-stall restart
+
+  Execute an action and follow the output of its steps in a single repository while it's executed:
+
+	$ src actions exec -f ~/run-gofmt.json -follow-logs github.com/my-org/my-repo
+
+  Execute an action and fail the execution in repositories in which the patch would change the CODEOWNERS file:
+
+	$ src actions exec -f ~/run-gofmt.json -post-task-hook ./ban-codeowners-changes.sh
+
 
 Format of the action JSON files:
 
 	An action JSON needs to specify:
 
-	- "scopeQuery" - a Sourcegraph search query to generate a list of repositories over which to run the action. Use 'src actions scope-query' to see which repositories are matched by the query
+	- "scopeQuery" - a Sourcegraph search query to generate a list of repositories over which to run the action. Use 'src actions scope-query' to see which repositories are matched by the query. By default, the action is executed on the default branch of each repository. With a "rev:" filter, e.g. "rev:release-1.0", it is executed on the commit that was searched and the resulting patches are based on that branch. With several revisions, e.g. "rev:release-1.0:release-2.0", it is executed on each, like on the entries of a matrix with the key "rev", and the patches for each end up in a separate patch set
 	- "steps" - a list of action steps to execute in each repository
 
 	A single "step" can either be a of type "command", which means the step is executed on the machine on which 'src actions exec' is executed, or it can be of type "docker" which then (optionally builds) and runs a container in which the repository is mounted.
@@ -92,6 +135,125 @@ Format of the action JSON files:
 		  ]
 		}
 
+	Instead of an "image" from a registry, a "docker" step can use an image that is built from a directory with a Dockerfile before the action is executed. The path in "build" is relative to the action file. Changes to the directory invalidate cached results:
+
+		{
+		  "scopeQuery": "repo:github",
+		  "steps": [
+		    {
+		      "type": "docker",
+		      "build": "./my-step-image",
+		      "args": ["/run.sh"]
+		    }
+		  ]
+		}
+
+	Containers of "docker" steps can be hardened to run untrusted code more safely, with "network", "readOnly", "capDrop", "securityOpt" and "user". "network" can be "none" for hermetic steps that must not download anything, "host", or "default" for Docker's default bridge network:
+
+		{
+		  "scopeQuery": "repo:github",
+		  "steps": [
+		    {
+		      "type": "docker",
+		      "image": "alpine:3",
+		      "args": ["sh", "-c", "find /work -iname '*.txt' -type f | xargs -n 1 sed -i s/this/that/g"],
+		      "network": "none",
+		      "readOnly": true,
+		      "capDrop": ["ALL"],
+		      "securityOpt": ["no-new-privileges"],
+		      "user": "1000:1000"
+		    }
+		  ]
+		}
+
+	If the scopeQuery matches file contents, the paths of the files it matched in the repository are listed, one per line, in the file named by the environment variable SRC_SEARCH_RESULT_PATHS_FILE of the steps, so that they don't have to search for them again. With "requireFileMatches", repositories in which the scopeQuery matched no files, e.g. those matched by their name only, are skipped:
+
+		{
+		  "scopeQuery": "lang:go fmt.Errorf",
+		  "requireFileMatches": true,
+		  "steps": [
+		    {
+		      "type": "docker",
+		      "image": "golang:1.14",
+		      "args": ["sh", "-c", "xargs gofmt -r 'fmt.Errorf(a) -> errors.New(a)' -w < $SRC_SEARCH_RESULT_PATHS_FILE"]
+		    }
+		  ]
+		}
+
+	Images of "docker" steps are pulled and run for the platform of the Docker daemon, e.g. linux/arm64 on Apple Silicon, if they are available for it. A step whose image is only available for another platform is run emulated, with a warning, unless its "platform" is set to run it for that platform explicitly:
+
+		{
+		  "scopeQuery": "repo:github",
+		  "steps": [
+		    {
+		      "type": "docker",
+		      "image": "my-org/amd64-only-tool:1.0",
+		      "platform": "linux/amd64"
+		    }
+		  ]
+		}
+
+	An action can run its steps several times in each repository, once for each combination of values in its "matrix". The values are available as ${{ matrix.KEY }} in the string fields of steps, e.g. "image", "args" and "cacheDirs". The patches for each combination are written to a separate file, named after the -o file and the combination (e.g. patches-go-1.14.json), so that they can be turned into separate patch sets:
+
+		{
+		  "scopeQuery": "repohasfile:go.mod",
+		  "matrix": {
+		    "go": ["1.13", "1.14"]
+		  },
+		  "steps": [
+		    {
+		      "type": "docker",
+		      "image": "golang:${{ matrix.go }}",
+		      "args": ["sh", "-c", "cd /work && go mod tidy"]
+		    }
+		  ]
+		}
+
+	Steps can keep files they produce, e.g. test reports or logs, with "artifacts", a list of glob patterns relative to the repository root. Matching files are copied into the directory given with -artifacts-dir after the step, so that they can be inspected even if the step makes no change, and left out of the patch unless they are part of the repository:
+
+		{
+		  "scopeQuery": "repohasfile:go.mod",
+		  "steps": [
+		    {
+		      "type": "docker",
+		      "image": "golang:1.14",
+		      "args": ["sh", "-c", "cd /work && go test -json ./... > test-report.json"],
+		      "artifacts": ["test-report.json"]
+		    }
+		  ]
+		}
+
+	An action can reuse steps from other action files with "extends", which takes a path or a list of paths relative to the action file. The steps of the extended actions are executed first, followed by the action's own steps. All other properties, such as "scopeQuery", are overridden by the extending action:
+
+		{
+		  "extends": ["../shared/setup-go.json"],
+		  "scopeQuery": "repo:go-",
+		  "steps": [
+		    {
+		      "type": "command",
+		      "args": ["gofmt", "-w", "."]
+		    }
+		  ]
+		}
+
+Hooks:
+
+	Hooks are executables that enforce organization-specific policies or send notifications without changing the action definitions. They are run in the workspace of each repository with -pre-task-hook before the first step, -post-step-hook after every step and -post-task-hook after the last step, and given a JSON object on standard input:
+
+		{
+		  "hook": "post-task",
+		  "repository": "github.com/sourcegraph/src-cli",
+		  "revision": "cbbf3b1c9a9c2cf3c67a6f1a5a1b1d7f0e8d4c1a",
+		  "workspace": "/tmp/action-sourcegraph-src-cli123",
+		  "step": 0,
+		  "stepType": "docker",
+		  "diff": "diff --git README.md README.md..."
+		}
+
+	"step" and "stepType" are only set for post-step hooks and "diff" only for post-task hooks. If a hook exits with a non-zero status, the execution in the repository fails with the standard error of the hook as the reason. Otherwise, a hook can print a JSON object on standard output: a pre-task hook can skip the repository with {"skip": true, "reason": "..."} and a post-task hook can replace the diff with {"diff": "..."}, where an empty diff produces no patch. Post-step hooks can change the files in the workspace.
+
+	Results are cached separately for every combination of hook paths, but changing a hook without changing its path requires -clear-cache.
+
 `
 
 	flagSet := flag.NewFlagSet("exec", flag.ExitOnError)
@@ -101,28 +263,65 @@ Format of the action JSON files:
 		fmt.Println(usage)
 	}
 
-	cacheDir, _ := campaigns.UserCacheDir()
-	if cacheDir != "" {
-		cacheDir = filepath.Join(cacheDir, "action-exec")
-	}
-
-	displayUserCacheDir := strings.Replace(cacheDir, os.Getenv("HOME"), "$HOME", 1)
+	cacheDir, displayUserCacheDir := defaultActionCacheDir()
 
 	var (
-		fileFlag        = flagSet.String("f", "-", "The action file. If not given or '-' standard input is used. (Required)")
-		outputFlag      = flagSet.String("o", "patches.json", "The output file. Will be used as the destination for patches unless the command is being piped in which case patches are piped to stdout")
-		parallelismFlag = flagSet.Int("j", runtime.GOMAXPROCS(0), "The number of parallel jobs.")
-
-		cacheDirFlag   = flagSet.String("cache", displayUserCacheDir, "Directory for caching results.")
-		clearCacheFlag = flagSet.Bool("clear-cache", false, "Remove possibly cached results for an action before executing it.")
-
-		keepLogsFlag = flagSet.Bool("keep-logs", false, "Do not remove execution log files when done.")
-		timeoutFlag  = flagSet.Duration("timeout", defaultTimeout, "The maximum duration a single action run can take.")
+		fileFlag                = flagSet.String("f", "-", "The action file. If not given or '-' standard input is used. (Required)")
+		varsFlags               = newActionVarsFlags(flagSet)
+		outputFlag              = flagSet.String("o", "patches.json", "The output file. Will be used as the destination for patches unless the command is being piped in which case patches are piped to stdout")
+		parallelismFlag         = flagSet.Int("j", runtime.GOMAXPROCS(0), "The number of parallel jobs.")
+		downloadParallelismFlag = flagSet.Int("download-j", 0, "The number of repository archives downloaded in parallel, independently of -j. Defaults to the value of -j.")
+		downloadRateLimitFlag   = flagSet.String("download-rate-limit", "", "The maximum combined rate per second at which repository archives are downloaded, e.g. 5MiB, so that the execution doesn't saturate the network. By default, the rate isn't limited.")
+
+		cacheDirFlag     = flagSet.String("cache", displayUserCacheDir, "Directory for caching results.")
+		cacheMaxSizeFlag = flagSet.Int64("cache-max-size", 0, "The maximum size in MiB of the cached results. When it's exceeded, the least recently used results are removed. 0 means no limit.")
+		clearCacheFlag   = flagSet.Bool("clear-cache", false, "Remove possibly cached results for an action before executing it.")
+
+		reposCacheTTLFlag = flagSet.Duration("repos-cache-ttl", 0, "How long the repositories matched by the scopeQuery are cached in the -cache directory, e.g. 10m, so that they are not searched again on every invocation. Cached repositories are used at the revisions they were resolved to. Incomplete search results, e.g. when repositories are cloning or the search hit a limit, are not cached. By default, nothing is cached.")
+		refreshReposFlag  = flagSet.Bool("refresh-repos", false, "Search the repositories matched by the scopeQuery again instead of using cached ones.")
+
+		keepLogsFlag      = flagSet.Bool("keep-logs", false, "Do not remove execution log files when done.")
+		logTimestampsFlag = flagSet.String("log-timestamps", campaigns.LogTimestampsAbsolute, `How lines in the execution log files are timestamped: "absolute" (RFC 3339), "relative" to the start of the execution in the repository, which shows how long steps take, or "none".`)
+		followLogsFlag    = flagSet.String("follow-logs", "", `If set, only the output of steps in repositories matching this glob pattern, e.g. "github.com/my-org/*", is printed, even with -q. It is still written to the execution log files of all repositories.`)
+		auditFlag         = flagSet.Bool("audit", false, "Record the exact commands, image digests and files changed by each step in an audit file next to the execution log of each repository. Audit files are kept even without -keep-logs.")
+		timeoutFlag       = flagSet.Duration("timeout", defaultTimeout, "The maximum duration a single action run can take.")
+
+		singleContainerFlag = flagSet.Bool("single-container", false, "Execute all docker steps in a repository in a single container with 'docker exec' instead of starting a container per step, so that tools installed by a step are available in the following ones. All docker steps must use the same image, which must contain sh, and the same cacheDirs and hardening options.")
+		skipSymlinksFlag    = flagSet.Bool("skip-symlinks", false, "Skip symbolic links contained in repositories instead of recreating them in the workspace the action is run in.")
+		gitLFSFlag          = flagSet.Bool("git-lfs", false, "Create the workspaces by cloning the repositories at their revision from -clone-url and fetch their Git LFS objects. Workspaces are otherwise created from archives, which contain LFS pointer files instead.")
+		submodulesFlag      = flagSet.Bool("submodules", false, "Create the workspaces by cloning the repositories at their revision from -clone-url and initialize their submodules. Workspaces are otherwise created from archives, in which submodule directories are empty. Changes inside of submodules are not part of the patches.")
+		cloneURLFlag        = flagSet.String("clone-url", "https://{{.Name}}.git", "The URL repositories are cloned from with -git-lfs or -submodules, using the syntax of Go package text/template with the fields Name, Rev and BaseRef of the repository. Credentials are taken from the Git configuration, e.g. a credential helper.")
+		secretsFileFlag     = flagSet.String("secrets-file", "", "A YAML or JSON file with an object mapping the names of secrets to their values. Steps refer to them with ${{ secrets.NAME }} in their args, which is replaced with ${NAME} and must be expanded by a shell, e.g. sh -c. The values are passed to steps as environment variables.")
+		stallTimeoutFlag    = flagSet.Duration("stall-timeout", 0, "If a step produces no output for this duration, e.g. 10m, it is considered stalled and handled according to -on-stall. 0 disables the detection.")
+		onStallFlag         = flagSet.String("on-stall", campaigns.OnStallWarn, `What to do with stalled steps: "warn" about them, including the ID of their container, "kill" them, which fails the execution in the repository, or "restart" the execution in the repository once.`)
+		maxDiffSizeFlag     = flagSet.Int64("max-diff-size", 100, "The maximum size in MiB of the diff produced in a single repository. Executions producing a larger diff fail. 0 means no limit.")
+		maxRepoSizeFlag     = flagSet.String("max-repo-size", "", "Skip repositories that are larger than this size on Sourcegraph, including their history, e.g. 2GiB, and show the total size of the others. Repositories whose size is unknown are not skipped. By default, no repositories are skipped and their sizes aren't fetched.")
+
+		preTaskHookFlag  = flagSet.String("pre-task-hook", "", "An executable that is run in each repository before the first step. It can fail or skip the execution in the repository. See 'Hooks' below.")
+		postStepHookFlag = flagSet.String("post-step-hook", "", "An executable that is run in each repository after every step. It can fail the execution in the repository or change the files in the workspace. See 'Hooks' below.")
+		postTaskHookFlag = flagSet.String("post-task-hook", "", "An executable that is run in each repository after the last step. It can fail the execution in the repository or replace the diff. See 'Hooks' below.")
 
 		createPatchSetFlag      = flagSet.Bool("create-patchset", false, "Create a patch set from the produced set of patches. When the execution of the action fails in a single repository a prompt will ask to confirm or reject the patch set creation.")
 		forceCreatePatchSetFlag = flagSet.Bool("force-create-patchset", false, "Force creation of patch set from the produced set of patches, without asking for confirmation even when the execution of the action failed for a subset of repositories.")
+		validateFirstFlag       = flagSet.Bool("validate-first", false, "With -create-patchset, create a patch set from a sample patch for the first repository before the action is executed, so that errors of the Sourcegraph instance, e.g. a license that doesn't include campaigns, are reported before the execution instead of after it. This leaves an additional patch set, which is not attached to any campaign, on the instance.")
+
+		allowUnsupportedFlag   = flagSet.String("allow-unsupported", "", `What to do with repositories on code hosts not supported by campaigns: "skip" them, fail with an "error" or "include" them to generate patches that can only be imported. Overrides "allowUnsupported" in the action definition (default "skip").`)
+		includeUnsupportedFlag = flagSet.Bool("include-unsupported", false, "Deprecated: use -allow-unsupported include.")
+		failFastFlag           = flagSet.Bool("fail-fast", false, "Stop the execution as soon as it fails in a repository: the executions in progress are cancelled, their containers are removed and no further repositories or matrix entries are executed. The repositories in which the execution was cancelled are listed separately from those in which it failed.")
+		failOnPartialFlag      = flagSet.Bool("fail-on-partial", false, "Fail if the results of the scopeQuery are incomplete, e.g. because the search timed out or repositories are still cloning, instead of only warning about it.")
+		allowTruncatedFlag     = flagSet.Bool("allow-truncated", false, "Only warn instead of failing if the search for the scopeQuery hit the result limit of the Sourcegraph instance, so that not all matching repositories were returned.")
+
+		branchFlag          = flagSet.String("branch", "", "The branch the campaign created from the patches will use. If set, repositories in which a campaign already has an open changeset on this branch are handled according to -on-open-changeset.")
+		onOpenChangesetFlag = flagSet.String("on-open-changeset", openChangesetSkip, `What to do in repositories with an open changeset on -branch: "skip" the repository, "rebase" by executing the action on top of the changeset's head, or "overwrite" the changeset.`)
+
+		patchDirFlag = flagSet.String("patch-dir", "", "If set, the patch produced in each repository is also written to a file at the path of the repository in this directory, e.g. github.com/my-org/my-repo.patch, so that it can be applied with 'git apply' or reviewed outside of Sourcegraph, and imported again with 'src campaigns patchset create-from-patches -patch-dir'. With a matrix, the patches of each matrix entry are written to a directory named after it, e.g. go-1.14/github.com/my-org/my-repo.patch.")
 
-		includeUnsupportedFlag = flagSet.Bool("include-unsupported", false, "When specified, also repos from unsupported codehosts are processed. Those can be created once the integration is done.")
+		artifactsDirFlag = flagSet.String("artifacts-dir", "", "Directory into which the files matching the \"artifacts\" of the steps, e.g. test reports or logs, are copied, under the name of the repository and the number of the step. Defaults to a new directory in the cache directory for each execution. Artifacts are only copied when the steps are executed, so use -clear-cache to get them for cached results.")
+
+		metricsFileFlag = flagSet.String("metrics-file", "", "If set, metrics about the execution are written to this file in the Prometheus text format when the command exits.")
+
+		provenanceFileFlag = flagSet.String("provenance-file", "", "If set, provenance metadata (src version, action hash, host, image digests and patch hashes) is written to this file.")
+		provenanceKeyFlag  = flagSet.String("provenance-key", "", "Path to a PEM-encoded ed25519 private key. If set, the provenance file is signed and the signature is written to a file with the same name and a .sig suffix.")
 
 		apiFlags = api.NewFlags(flagSet)
 	)
@@ -147,6 +346,57 @@ Format of the action JSON files:
 			return errors.New("cache is not a valid path")
 		}
 
+		switch *onOpenChangesetFlag {
+		case openChangesetSkip, openChangesetRebase, openChangesetOverwrite:
+		default:
+			return &usageError{fmt.Errorf("invalid -on-open-changeset %q, must be one of skip, rebase or overwrite", *onOpenChangesetFlag)}
+		}
+
+		switch *onStallFlag {
+		case campaigns.OnStallWarn, campaigns.OnStallKill, campaigns.OnStallRestart:
+		default:
+			return &usageError{fmt.Errorf("invalid -on-stall %q, must be one of warn, kill or restart", *onStallFlag)}
+		}
+		if *stallTimeoutFlag < 0 {
+			return &usageError{errors.New("-stall-timeout must not be negative")}
+		}
+
+		if *cacheMaxSizeFlag < 0 {
+			return &usageError{errors.New("-cache-max-size must not be negative")}
+		}
+		var downloadRateLimit uint64
+		if *downloadRateLimitFlag != "" {
+			if downloadRateLimit, err = humanize.ParseBytes(*downloadRateLimitFlag); err != nil || downloadRateLimit == 0 {
+				return &usageError{fmt.Errorf("invalid -download-rate-limit %q, must be a positive size like 5MiB", *downloadRateLimitFlag)}
+			}
+		}
+		var maxRepoSize uint64
+		if *maxRepoSizeFlag != "" {
+			if maxRepoSize, err = humanize.ParseBytes(*maxRepoSizeFlag); err != nil {
+				return &usageError{fmt.Errorf("invalid -max-repo-size %q: %s", *maxRepoSizeFlag, err)}
+			}
+		}
+		if *maxDiffSizeFlag < 0 {
+			return &usageError{errors.New("-max-diff-size must not be negative")}
+		}
+
+		if *provenanceKeyFlag != "" && *provenanceFileFlag == "" {
+			return &usageError{errors.New("-provenance-key requires -provenance-file to be set")}
+		}
+		cloneURLTmpl, err := template.New("clone-url").Parse(*cloneURLFlag)
+		if err != nil {
+			return &usageError{errors.Wrap(err, "invalid -clone-url")}
+		}
+		if *validateFirstFlag && !*createPatchSetFlag && !*forceCreatePatchSetFlag {
+			return &usageError{errors.New("-validate-first requires -create-patchset or -force-create-patchset to be set")}
+		}
+		var provenanceKey ed25519.PrivateKey
+		if *provenanceKeyFlag != "" {
+			if provenanceKey, err = campaigns.ReadSigningKey(*provenanceKeyFlag); err != nil {
+				return errors.Wrap(err, "reading provenance signing key")
+			}
+		}
+
 		// Read action file content.
 		var actionFile []byte
 		if *fileFlag == "-" {
@@ -158,8 +408,56 @@ Format of the action JSON files:
 			return err
 		}
 
+		// Convert action file to JSON.
+		jsonActionFile, err := yaml.YAMLToJSONStrict(actionFile)
+		if err != nil {
+			return errors.Wrap(err, "unable to parse action file")
+		}
+
+		jsonActionFile, sources, err := campaigns.ComposeActionDefinition(*fileFlag, jsonActionFile)
+		if err != nil {
+			return &exitCodeError{error: errors.Wrap(err, "resolving extends"), exitCode: exitCodeValidation}
+		}
+
+		vars, err := varsFlags.vars()
+		if err != nil {
+			return err
+		}
+		if jsonActionFile, err = campaigns.ExpandVars(jsonActionFile, vars); err != nil {
+			return &exitCodeError{error: err, exitCode: exitCodeValidation}
+		}
+
+		err = campaigns.ValidateActionDefinition(jsonActionFile)
+		if err != nil {
+			if len(sources) > 1 {
+				err = errors.Wrapf(err, "action definition composed from %s", strings.Join(sources, ", "))
+			}
+			return &exitCodeError{error: err, exitCode: exitCodeValidation}
+		}
+
+		var action campaigns.Action
+		if err := jsonxUnmarshal(string(jsonActionFile), &action); err != nil {
+			return errors.Wrap(err, "invalid JSON action file")
+		}
+
+		unsupported, err := unsupportedMode(*allowUnsupportedFlag, *includeUnsupportedFlag, action)
+		if err != nil {
+			return err
+		}
+
+		secrets, err := readActionSecrets(*secretsFileFlag, action)
+		if err != nil {
+			return err
+		}
+
+		hooks, err := actionHooks(*preTaskHookFlag, *postStepHookFlag, *postTaskHookFlag)
+		if err != nil {
+			return err
+		}
+
 		var outputWriter io.Writer
-		if !*createPatchSetFlag && !*forceCreatePatchSetFlag {
+		// With a matrix, patches are written to one file per matrix entry.
+		if !*createPatchSetFlag && !*forceCreatePatchSetFlag && len(action.Matrix) == 0 {
 			// If stdout is a pipe, write to pipe, otherwise
 			// write to output file
 			fi, err := os.Stdout.Stat()
@@ -180,22 +478,6 @@ Format of the action JSON files:
 			}
 		}
 
-		// Convert action file to JSON.
-		jsonActionFile, err := yaml.YAMLToJSONStrict(actionFile)
-		if err != nil {
-			return errors.Wrap(err, "unable to parse action file")
-		}
-
-		err = campaigns.ValidateActionDefinition(jsonActionFile)
-		if err != nil {
-			return err
-		}
-
-		var action campaigns.Action
-		if err := jsonxUnmarshal(string(jsonActionFile), &action); err != nil {
-			return errors.Wrap(err, "invalid JSON action file")
-		}
-
 		ctx, cancel := context.WithCancel(context.Background())
 		c := make(chan os.Signal, 1)
 		signal.Notify(c, os.Interrupt)
@@ -213,73 +495,333 @@ Format of the action JSON files:
 			os.Exit(2)
 		}()
 
+		var metrics *campaigns.Metrics
+		if *metricsFileFlag != "" {
+			metrics = campaigns.NewMetrics()
+			apiRequestObservers = append(apiRequestObservers, func(e api.RequestEvent) {
+				metrics.ObserveAPIRequest(e.Duration, e.Err)
+			})
+			// We exit explicitly in some cases below, so we write the
+			// metrics file on exit rather than when returning.
+			atExit(func(int) {
+				if err := metrics.WriteFile(*metricsFileFlag); err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to write metrics to %s: %s\n", *metricsFileFlag, err)
+				}
+			})
+		}
+		metrics = stats.metricsForExecution(metrics)
+
+		span, ctx := tracing.StartSpan(ctx, "src actions exec")
+
+		// The run ID correlates the log files, the recorded execution and
+		// the requests to the Sourcegraph instance.
+		runID := campaigns.NewRunID()
+		headers := map[string]string{campaigns.RunIDHeader: runID}
+		for k, v := range cfg.AdditionalHeaders {
+			headers[k] = v
+		}
+		cfg.AdditionalHeaders = headers
+		span.SetAttribute("runID", runID)
+
 		client := cfg.apiClient(apiFlags, flagSet.Output())
-		logger := campaigns.NewActionLogger(*verbose, *keepLogsFlag)
+		logger := campaigns.NewActionLogger(*verbose, *keepLogsFlag, *quiet)
+		logger.SetRunID(runID)
+		logger.Infof("Run ID: %s\n", runID)
+		if err := logger.SetLogTimestamps(*logTimestampsFlag); err != nil {
+			return &usageError{err}
+		}
+		if *followLogsFlag != "" {
+			if err := logger.SetFollowLogs(*followLogsFlag); err != nil {
+				return &usageError{err}
+			}
+		}
+
+		// Expand the matrix, if any, into one action per combination.
+		entries := action.MatrixEntries()
+		actions := make([]campaigns.Action, len(entries))
+		for i, entry := range entries {
+			if actions[i], err = action.WithMatrix(entry); err != nil {
+				return &exitCodeError{error: err, exitCode: exitCodeValidation}
+			}
+		}
+		hasMatrix := len(action.Matrix) > 0
 
 		// Fetch Docker images etc.
-		err = campaigns.PrepareAction(ctx, action, logger)
+		for _, a := range actions {
+			err = campaigns.PrepareAction(ctx, a, logger)
+			if err != nil {
+				return errors.Wrap(err, "Failed to prepare action")
+			}
+			if *singleContainerFlag {
+				if err := campaigns.ValidateSingleContainer(a); err != nil {
+					return &exitCodeError{error: err, exitCode: exitCodeValidation}
+				}
+			}
+		}
+
+		accessToken, err := cfg.accessToken()
 		if err != nil {
-			return errors.Wrap(err, "Failed to prepare action")
+			return err
 		}
+		// The patches are kept on disk until they are written out or sent to
+		// Sourcegraph, so that the patches of many repositories don't have to
+		// fit into memory.
+		patchDir, err := ioutil.TempDir("", "src-action-patches")
+		if err != nil {
+			return errors.Wrap(err, "creating patch directory")
+		}
+		defer os.RemoveAll(patchDir)
 
 		opts := campaigns.ExecutorOpts{
-			Endpoint:          cfg.Endpoint,
-			AccessToken:       cfg.AccessToken,
-			AdditionalHeaders: cfg.AdditionalHeaders,
-			Timeout:           *timeoutFlag,
-			KeepLogs:          *keepLogsFlag,
-			ClearCache:        *clearCacheFlag,
-			Cache:             campaigns.ExecutionDiskCache{Dir: *cacheDirFlag},
+			Endpoint:            cfg.Endpoint,
+			AccessToken:         accessToken,
+			AdditionalHeaders:   cfg.AdditionalHeaders,
+			ImpersonateUser:     cfg.ImpersonateUser,
+			RunID:               runID,
+			Timeout:             *timeoutFlag,
+			MaxDiffSize:         *maxDiffSizeFlag * 1024 * 1024,
+			PatchDir:            patchDir,
+			DownloadParallelism: *downloadParallelismFlag,
+			DownloadLimiter:     campaigns.NewDownloadLimiter(int64(downloadRateLimit)),
+			SkipSymlinks:        *skipSymlinksFlag,
+			GitLFS:              *gitLFSFlag,
+			Submodules:          *submodulesFlag,
+			CloneURL:            cloneURLFunc(cloneURLTmpl),
+			SingleContainer:     *singleContainerFlag,
+			Secrets:             secrets,
+			Hooks:               hooks,
+			StallTimeout:        *stallTimeoutFlag,
+			OnStall:             *onStallFlag,
+			KeepLogs:            *keepLogsFlag,
+			Audit:               *auditFlag,
+			FailFast:            *failFastFlag,
+			ClearCache:          *clearCacheFlag,
+			Cache:               campaigns.ExecutionDiskCache{Dir: *cacheDirFlag, MaxSize: *cacheMaxSizeFlag * 1024 * 1024},
+			Metrics:             metrics,
+		}
+
+		var artifactsDir string
+		if actionHasArtifacts(action) {
+			artifactsDir = *artifactsDirFlag
+			if artifactsDir == "" {
+				artifactsDir = filepath.Join(*cacheDirFlag, "artifacts", time.Now().Format("20060102-150405"))
+			}
+			opts.ArtifactsDir = artifactsDir
 		}
 
 		// Query repos over which to run action
 		logger.Infof("Querying %s for repositories matching '%s'...\n", cfg.Endpoint, action.ScopeQuery)
-		repos, err := actionRepos(ctx, client, action.ScopeQuery, *includeUnsupportedFlag, logger)
+		resolveSpan, resolveCtx := tracing.StartSpan(ctx, "Resolve repositories")
+		reposCache := &reposCache{Dir: *cacheDirFlag, TTL: *reposCacheTTLFlag, Refresh: *refreshReposFlag}
+		reposByRev, _, err := actionReposByRevision(resolveCtx, client, action.ScopeQuery, unsupported, *failOnPartialFlag, *allowTruncatedFlag, reposCache, logger)
+		if err == nil && action.RequireFileMatches {
+			var excluded []excludedRepo
+			reposByRev, excluded = requireFileMatches(reposByRev)
+			for _, e := range excluded {
+				logger.Infof("Skipping repository %s because %s.\n", e.Name, e.Reason)
+			}
+		}
+		resolveSpan.SetAttribute("repositories", len(allRevisionRepos(reposByRev)))
+		resolveSpan.Finish(err)
 		if err != nil {
 			return err
 		}
 		logger.Infof("Use 'src actions scope-query' for help with scoping.\n\n")
 
-		totalSteps := len(repos) * len(action.Steps)
-		logger.Start(totalSteps)
+		if *branchFlag != "" {
+			for i := range reposByRev {
+				if reposByRev[i].Repos, err = handleOpenChangesets(ctx, client, *branchFlag, *onOpenChangesetFlag, reposByRev[i].Repos, logger); err != nil {
+					return err
+				}
+			}
+		}
+
+		// The sizes take a request per 100 repositories, so they are only
+		// fetched to skip the repositories that are too large.
+		if maxRepoSize > 0 {
+			sizes, err := fetchRepoSizes(ctx, client, allRevisionRepos(reposByRev))
+			if err != nil {
+				yellow.Fprintf(os.Stderr, "WARNING: -max-repo-size has no effect, since the sizes of the repositories could not be determined: %s\n", err)
+			}
+			var tooLarge []string
+			for i := range reposByRev {
+				var revTooLarge []string
+				reposByRev[i].Repos, revTooLarge = skipLargeRepos(reposByRev[i].Repos, sizes, maxRepoSize)
+				tooLarge = append(tooLarge, revTooLarge...)
+			}
+			remaining := allRevisionRepos(reposByRev)
+			totalSize, unknownSizes := totalRepoSize(remaining, sizes)
+			logger.RepoSizes(totalSize, len(remaining)-unknownSizes, unknownSizes, tooLarge)
+		}
+		repos := allRevisionRepos(reposByRev)
+
+		// Report errors of the instance creating patch sets now instead of
+		// after the execution.
+		if *validateFirstFlag && len(repos) > 0 {
+			if err := validatePatchSetCreation(ctx, client, repos[0]); err != nil {
+				return err
+			}
+		}
+
+		// With several revisions, the action is executed on each like on
+		// another matrix entry, so that the patches for each revision end
+		// up in a separate patch set.
+		reposByEntry := make([][]campaigns.ActionRepo, len(actions))
+		for i := range actions {
+			reposByEntry[i] = repos
+		}
+		if len(reposByRev) > 1 {
+			if entries, actions, reposByEntry, err = expandRevisions(entries, actions, reposByRev); err != nil {
+				return err
+			}
+			hasMatrix = true
+		}
 
-		executor := campaigns.NewExecutor(action, *parallelismFlag, logger, opts)
-		for _, repo := range repos {
-			executor.EnqueueRepo(repo)
+		totalSteps := 0
+		for _, r := range reposByEntry {
+			totalSteps += len(r) * len(action.Steps)
 		}
+		logger.Start(totalSteps)
+
+		// Each matrix entry gets its own executor, since the patches for
+		// every entry end up in a separate patch set.
+		var (
+			errs           parallel.Errors
+			patches        []campaigns.PatchInput
+			patchesByEntry = make([][]campaigns.PatchInput, len(actions))
+			// executedByEntry and failedByEntry are the repositories in
+			// which the action was executed, i.e. not cancelled, and in
+			// which the execution failed, for 'src actions diff'.
+			executedByEntry = make([][]campaigns.ActionRepo, len(actions))
+			failedByEntry   = make([][]campaigns.ActionRepo, len(actions))
+			stats           campaigns.ExecutionStats
+			cancelled       []campaigns.ActionRepo
+		)
+		for i, a := range actions {
+			if *failFastFlag && len(errs) > 0 {
+				yellow.Fprintf(os.Stderr, "WARNING: skipping the remaining matrix entries, because the execution failed.\n")
+				break
+			}
+			if hasMatrix {
+				logger.Infof("Executing action with matrix entry %s\n", entries[i])
+			}
+
+			entryOpts := opts
+			if artifactsDir != "" && hasMatrix {
+				entryOpts.ArtifactsDir = filepath.Join(artifactsDir, matrixSlug(entries[i]))
+			}
+			executor := campaigns.NewExecutor(a, *parallelismFlag, logger, entryOpts)
+			for _, repo := range reposByEntry[i] {
+				executor.EnqueueRepo(repo)
+			}
 
-		go executor.Start(ctx)
-		err = executor.Wait()
+			go executor.Start(ctx)
+			if err := executor.Wait(); err != nil {
+				if perr, ok := err.(parallel.Errors); ok {
+					errs = append(errs, perr...)
+				} else {
+					errs = append(errs, err)
+				}
+			}
+
+			patchesByEntry[i] = executor.AllPatches()
+			patches = append(patches, patchesByEntry[i]...)
+			stats = stats.Add(executor.Stats())
+			entryCancelled := executor.Cancelled()
+			cancelled = append(cancelled, entryCancelled...)
+			executedByEntry[i] = withoutRepos(reposByEntry[i], entryCancelled)
+			failedByEntry[i] = executor.Failed()
+		}
+		logger.ExecutionStats(stats)
+		logger.ExecutionCancelled(cancelled)
+		if artifactsDir != "" {
+			logger.Infof("Artifacts of the steps were copied to %s\n", artifactsDir)
+		}
+		if *patchDirFlag != "" {
+			if err := writePatchDir(*patchDirFlag, repos, entries, patchesByEntry); err != nil {
+				return err
+			}
+		}
+		if *fileFlag != "-" {
+			if err := recordExecution(*cacheDirFlag, *fileFlag, runID, entries, executedByEntry, failedByEntry, patchesByEntry); err != nil {
+				yellow.Fprintf(os.Stderr, "WARNING: the execution could not be recorded for 'src actions diff': %s\n", err)
+			}
+		}
+		err = nil
+		if len(errs) > 0 {
+			err = errs
+		}
+		span.Finish(err)
 
-		patches := executor.AllPatches()
 		if len(patches) == 0 {
-			// We call os.Exit because we don't want to return the error
-			// and have it printed.
+			// We don't return the error itself because ActionFailed
+			// already printed it.
 			logger.ActionFailed(err, patches)
-			os.Exit(1)
+			return &exitCodeError{exitCode: exitCodeFailure}
+		}
+
+		if *provenanceFileFlag != "" {
+			provenance, err := campaigns.NewProvenance(buildTag, jsonActionFile, action, patches)
+			if err != nil {
+				return errors.Wrap(err, "writing provenance")
+			}
+			provenance.RunID = runID
+			if err := provenance.WriteFile(*provenanceFileFlag, provenanceKey); err != nil {
+				return errors.Wrap(err, "writing provenance")
+			}
 		}
 
 		if !*createPatchSetFlag && !*forceCreatePatchSetFlag {
 			if err != nil {
+				// Some patches were produced, but not for all repositories.
 				logger.ActionFailed(err, patches)
-				os.Exit(1)
+				return &exitCodeError{exitCode: exitCodePartialFailure}
 			}
 
-			err = json.NewEncoder(outputWriter).Encode(patches)
+			if hasMatrix {
+				// Patches for different matrix entries can't go into the
+				// same patch set, so we write one file per entry.
+				var outputFiles []string
+				for i, entry := range entries {
+					if len(patchesByEntry[i]) == 0 {
+						continue
+					}
+					path := matrixOutputPath(*outputFlag, entry)
+					if err := writePatchesFile(path, patchesByEntry[i]); err != nil {
+						return err
+					}
+					outputFiles = append(outputFiles, path)
+				}
+
+				logger.ActionSuccess(patches)
+				if *quiet {
+					return nil
+				}
+
+				fmt.Fprintf(os.Stderr, "\n\nPatches for each matrix entry saved to separate files, to create a patch set for each on your Sourcegraph instance please do the following:\n\n")
+				for _, path := range outputFiles {
+					fmt.Fprintln(os.Stderr, " ", color.HiCyanString(output.Emoji(output.EmojiArrow)), fmt.Sprintf("src campaign patchset create-from-patches < %s", path))
+				}
+				fmt.Fprintln(os.Stderr)
+
+				return nil
+			}
+
+			err = writePatchesJSON(outputWriter, patches)
 			if err != nil {
 				return errors.Wrap(err, "writing patches")
 			}
 
 			logger.ActionSuccess(patches)
 
-			if out, ok := outputWriter.(*os.File); ok && out == os.Stdout {
-				// Don't print instructions when piping
+			if out, ok := outputWriter.(*os.File); (ok && out == os.Stdout) || *quiet {
+				// Don't print instructions when piping or asked to be quiet
 				return nil
 			}
 
 			// Print instructions when we've written patches to a file, even when not in verbose mode
 			fmt.Fprintf(os.Stderr, "\n\nPatches saved to %s, to create a patch set on your Sourcegraph instance please do the following:\n", *outputFlag)
-			fmt.Fprintln(os.Stderr, "\n ", color.HiCyanString("▶"), fmt.Sprintf("src campaign patchset create-from-patches < %s", *outputFlag))
+			fmt.Fprintln(os.Stderr, "\n ", color.HiCyanString(output.Emoji(output.EmojiArrow)), fmt.Sprintf("src campaign patchset create-from-patches < %s", *outputFlag))
 			fmt.Fprintln(os.Stderr)
 
 			return nil
@@ -289,18 +831,18 @@ Format of the action JSON files:
 			logger.ActionFailed(err, patches)
 
 			if len(patches) == 0 {
-				os.Exit(1)
+				exit(1)
 			}
 
 			if !*forceCreatePatchSetFlag {
 				canInput := isatty.IsTerminal(os.Stdin.Fd()) || isatty.IsCygwinTerminal(os.Stdin.Fd())
 				if !canInput {
-					return err
+					return &exitCodeError{exitCode: exitCodePartialFailure}
 				}
 
 				c, _ := askForConfirmation("Create a patch set for the produced patches anyway?")
 				if !c {
-					return err
+					return &exitCodeError{exitCode: exitCodePartialFailure}
 				}
 			}
 		} else {
@@ -312,7 +854,18 @@ Format of the action JSON files:
 			return err
 		}
 
-		return createPatchSetFromPatches(ctx, client, patches, tmpl, 100)
+		for i, entry := range entries {
+			if len(patchesByEntry[i]) == 0 {
+				continue
+			}
+			if hasMatrix {
+				fmt.Printf("\nPatch set for matrix entry %s:\n", entry)
+			}
+			if err := createPatchSetFromPatches(ctx, client, patchesByEntry[i], tmpl, 100); err != nil {
+				return err
+			}
+		}
+		return nil
 	}
 
 	// Register the command.
@@ -323,18 +876,451 @@ Format of the action JSON files:
 	})
 }
 
-func actionRepos(ctx context.Context, client api.Client, scopeQuery string, includeUnsupported bool, logger *campaigns.ActionLogger) ([]campaigns.ActionRepo, error) {
-	hasCount, err := regexp.MatchString(`count:\d+`, scopeQuery)
+// defaultActionCacheDir returns the default directory for cached action
+// execution results, and the same path with $HOME abbreviated for display in
+// usage messages.
+func defaultActionCacheDir() (dir, display string) {
+	dir, _ = campaigns.UserCacheDir()
+	if dir != "" {
+		dir = filepath.Join(dir, "action-exec")
+	}
+	return dir, strings.Replace(dir, os.Getenv("HOME"), "$HOME", 1)
+}
+
+// matrixOutputPath returns the path of the file that the patches for the given
+// matrix entry are written to, based on the path given with -o.
+func matrixOutputPath(path string, entry campaigns.MatrixEntry) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "-" + matrixSlug(entry) + ext
+}
+
+// matrixSlug returns the matrix entry in a form that can be used in file
+// names.
+func matrixSlug(entry campaigns.MatrixEntry) string {
+	return matrixSlugRegexp.ReplaceAllString(strings.NewReplacer("=", "-", ",", "_").Replace(entry.String()), "_")
+}
+
+var matrixSlugRegexp = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// actionHasArtifacts returns whether any step of the action has artifacts.
+func actionHasArtifacts(action campaigns.Action) bool {
+	for _, step := range action.Steps {
+		if len(step.Artifacts) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// readActionSecrets reads the secrets in path, if set, and checks that it
+// defines all secrets the action refers to.
+func readActionSecrets(path string, action campaigns.Action) (campaigns.Secrets, error) {
+	var secrets campaigns.Secrets
+	if path != "" {
+		var err error
+		if secrets, err = campaigns.ReadSecretsFile(path); err != nil {
+			return nil, err
+		}
+	}
+	if err := campaigns.CheckSecrets(action, secrets); err != nil {
+		if path == "" {
+			err = errors.Wrap(err, "pass their values with -secrets-file")
+		}
+		return nil, &exitCodeError{error: err, exitCode: exitCodeValidation}
+	}
+	return secrets, nil
+}
+
+// cloneURLFunc returns the ExecutorOpts.CloneURL that executes tmpl, the
+// -clone-url, on a repository.
+func cloneURLFunc(tmpl *template.Template) func(campaigns.ActionRepo) (string, error) {
+	return func(repo campaigns.ActionRepo) (string, error) {
+		var b strings.Builder
+		if err := tmpl.Execute(&b, repo); err != nil {
+			return "", err
+		}
+		return b.String(), nil
+	}
+}
+
+// actionCacheKeyFlags are the flags of commands that look up the results
+// cached by 'src actions exec', which depend on the hooks it was run with and
+// on whether it was run with -single-container, -git-lfs or -submodules.
+type actionCacheKeyFlags struct {
+	preTask, postStep, postTask         *string
+	singleContainer, gitLFS, submodules *bool
+}
+
+// newActionCacheKeyFlags adds the flags of an actionCacheKeyFlags to flagSet.
+func newActionCacheKeyFlags(flagSet *flag.FlagSet) *actionCacheKeyFlags {
+	return &actionCacheKeyFlags{
+		preTask:         flagSet.String("pre-task-hook", "", "The -pre-task-hook of 'src actions exec', which is part of the key of cached results."),
+		postStep:        flagSet.String("post-step-hook", "", "The -post-step-hook of 'src actions exec', which is part of the key of cached results."),
+		postTask:        flagSet.String("post-task-hook", "", "The -post-task-hook of 'src actions exec', which is part of the key of cached results."),
+		singleContainer: flagSet.Bool("single-container", false, "The -single-container of 'src actions exec', which is part of the key of cached results."),
+		gitLFS:          flagSet.Bool("git-lfs", false, "The -git-lfs of 'src actions exec', which is part of the key of cached results."),
+		submodules:      flagSet.Bool("submodules", false, "The -submodules of 'src actions exec', which is part of the key of cached results."),
+	}
+}
+
+// cacheKey returns the key under which 'src actions exec' with the flags
+// caches the result of executing action in repo with hooks.
+func (f *actionCacheKeyFlags) cacheKey(repo campaigns.ActionRepo, action campaigns.Action, hooks *campaigns.Hooks) campaigns.ExecutionCacheKey {
+	key := campaigns.NewExecutionCacheKey(repo, action, hooks, *f.singleContainer)
+	key.GitLFS, key.Submodules = *f.gitLFS, *f.submodules
+	return key
+}
+
+// hooks returns the hooks given with the flags, like actionHooks.
+func (f *actionCacheKeyFlags) hooks() (*campaigns.Hooks, error) {
+	return actionHooks(*f.preTask, *f.postStep, *f.postTask)
+}
+
+// actionHooks returns the hooks given with the -*-hook flags, or nil if none
+// are set. Hooks run in the workspace of each repository, so relative paths
+// are made absolute.
+func actionHooks(preTask, postStep, postTask string) (*campaigns.Hooks, error) {
+	if preTask == "" && postStep == "" && postTask == "" {
+		return nil, nil
+	}
+	var hooks campaigns.Hooks
+	for _, h := range []struct {
+		flag, path string
+		dst        *string
+	}{
+		{"pre-task-hook", preTask, &hooks.PreTask},
+		{"post-step-hook", postStep, &hooks.PostStep},
+		{"post-task-hook", postTask, &hooks.PostTask},
+	} {
+		if h.path == "" {
+			continue
+		}
+		path, err := exec.LookPath(h.path)
+		if err != nil {
+			return nil, &usageError{fmt.Errorf("invalid -%s: %s", h.flag, err)}
+		}
+		if *h.dst, err = filepath.Abs(path); err != nil {
+			return nil, err
+		}
+	}
+	return &hooks, nil
+}
+
+func writePatchesFile(path string, patches []campaigns.PatchInput) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return errors.Wrap(err, "creating output file")
+	}
+	defer f.Close()
+
+	if err := writePatchesJSON(f, patches); err != nil {
+		return errors.Wrap(err, "writing patches")
+	}
+	return f.Close()
+}
+
+// writePatchesJSON writes patches to w as a JSON array, like a json.Encoder
+// would, but encodes one patch at a time, so that only one of the patches
+// kept on disk is read into memory at once.
+func writePatchesJSON(w io.Writer, patches []campaigns.PatchInput) error {
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+	for i, p := range patches {
+		if i > 0 {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		data, err := json.Marshal(p)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, "]\n")
+	return err
+}
+
+// writePatchDir writes each patch to a file at the path of its repository in
+// dir, e.g. dir/github.com/my-org/my-repo.patch, in a directory named after
+// its matrix entry if there is one. The patches are annotated so that they can
+// be imported with 'src campaigns patchset create-from-patches -patch-dir'.
+// It returns an error instead of overwriting a patch if the names of two
+// matrix entries map to the same directory.
+func writePatchDir(dir string, repos []campaigns.ActionRepo, entries []campaigns.MatrixEntry, patchesByEntry [][]campaigns.PatchInput) error {
+	names := repoNames(repos)
+	written := map[string]bool{}
+	for i, patches := range patchesByEntry {
+		entryDir := dir
+		if entry := entries[i].String(); entry != "" {
+			entryDir = filepath.Join(dir, matrixSlugRegexp.ReplaceAllString(strings.NewReplacer("=", "-", ",", "_").Replace(entry), "_"))
+		}
+		for _, p := range patches {
+			path := filepath.Join(entryDir, filepath.FromSlash(names[p.Repository])+".patch")
+			if written[path] {
+				return fmt.Errorf("writing patch file: more than one patch would be written to %s", path)
+			}
+			written[path] = true
+
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return errors.Wrap(err, "creating patch directory")
+			}
+			if err := writeAnnotatedPatch(path, patchAnnotations(names[p.Repository], p), p); err != nil {
+				return errors.Wrap(err, "writing patch file")
+			}
+		}
+	}
+	return nil
+}
+
+// writeAnnotatedPatch writes the annotations followed by the patch p to the
+// file at path.
+func writeAnnotatedPatch(path, annotations string, p campaigns.PatchInput) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := io.WriteString(f, annotations); err != nil {
+		return err
+	}
+	if err := p.WritePatch(f); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// withoutRepos returns the repositories in repos that are not in exclude.
+func withoutRepos(repos, exclude []campaigns.ActionRepo) []campaigns.ActionRepo {
+	excluded := make(map[campaigns.ActionRepo]bool, len(exclude))
+	for _, repo := range exclude {
+		excluded[repo] = true
+	}
+	var result []campaigns.ActionRepo
+	for _, repo := range repos {
+		if !excluded[repo] {
+			result = append(result, repo)
+		}
+	}
+	return result
+}
+
+// repoNames maps the IDs of the repositories to their names.
+func repoNames(repos []campaigns.ActionRepo) map[string]string {
+	names := make(map[string]string, len(repos))
+	for _, repo := range repos {
+		names[repo.ID] = repo.Name
+	}
+	return names
+}
+
+// excludedRepo is a repository matched by a scope query that actions are not
+// executed in.
+type excludedRepo struct {
+	Name   string
+	Reason string
+}
+
+var (
+	countRegexp     = regexp.MustCompile(`(?:^|\s)count:(\d+|all)(?:\s|$)`)
+	revRegexp       = regexp.MustCompile(`(?:^|\s)rev(?:ision)?:(\S*)`)
+	commitOIDRegexp = regexp.MustCompile(`^[0-9a-f]{40}$`)
+)
+
+// scopeQueryRevision returns the revision given with a rev: filter in
+// scopeQuery, or an empty string if there is none. Only a single revision is
+// supported.
+func scopeQueryRevision(scopeQuery string) (string, error) {
+	matches := revRegexp.FindAllStringSubmatch(scopeQuery, -1)
+	if len(matches) == 0 {
+		return "", nil
+	}
+	rev := matches[0][1]
+	if len(matches) > 1 || rev == "" || strings.ContainsAny(rev, ":*^") {
+		return "", &exitCodeError{
+			error:    fmt.Errorf("scopeQuery %q: actions can only be executed on a single revision given with rev:", scopeQuery),
+			exitCode: exitCodeValidation,
+		}
+	}
+	return rev, nil
+}
+
+// scopeQueryRevisions returns the revisions given with a rev: filter in
+// scopeQuery, which can list several revisions separated by colons, e.g.
+// "rev:release-1.0:release-2.0". It returns nil if there is none.
+func scopeQueryRevisions(scopeQuery string) ([]string, error) {
+	matches := revRegexp.FindAllStringSubmatch(scopeQuery, -1)
+	if len(matches) == 0 {
+		return nil, nil
+	}
+	revs := strings.Split(matches[0][1], ":")
+	for _, rev := range revs {
+		if len(matches) > 1 || rev == "" || strings.ContainsAny(rev, "*^") {
+			return nil, &exitCodeError{
+				error:    fmt.Errorf("scopeQuery %q: actions can only be executed on revisions given with a single rev: filter, e.g. rev:release-1.0:release-2.0", scopeQuery),
+				exitCode: exitCodeValidation,
+			}
+		}
+	}
+	return revs, nil
+}
+
+// scopeQueryWithRevision returns scopeQuery with the revisions of its rev:
+// filter replaced with rev.
+func scopeQueryWithRevision(scopeQuery, rev string) string {
+	loc := revRegexp.FindStringSubmatchIndex(scopeQuery)
+	if loc == nil {
+		return scopeQuery
+	}
+	return scopeQuery[:loc[2]] + rev + scopeQuery[loc[3]:]
+}
+
+// revisionMatrixKey is the key of the revision in the matrix entries that
+// expandRevisions returns.
+const revisionMatrixKey = "rev"
+
+// expandRevisions returns the matrix entries, actions and repositories for
+// executing the actions of the matrix entries on the repositories at each
+// revision, which is added to the entries with the key revisionMatrixKey.
+func expandRevisions(entries []campaigns.MatrixEntry, actions []campaigns.Action, byRev []revisionRepos) ([]campaigns.MatrixEntry, []campaigns.Action, [][]campaigns.ActionRepo, error) {
+	var (
+		revEntries []campaigns.MatrixEntry
+		revActions []campaigns.Action
+		revRepos   [][]campaigns.ActionRepo
+	)
+	for i, entry := range entries {
+		if _, ok := entry[revisionMatrixKey]; ok {
+			return nil, nil, nil, &exitCodeError{
+				error:    fmt.Errorf("the matrix key %q can't be used with several revisions in the scopeQuery", revisionMatrixKey),
+				exitCode: exitCodeValidation,
+			}
+		}
+		for _, r := range byRev {
+			revEntry := campaigns.MatrixEntry{revisionMatrixKey: r.Rev}
+			for k, v := range entry {
+				revEntry[k] = v
+			}
+			revEntries = append(revEntries, revEntry)
+			revActions = append(revActions, actions[i])
+			revRepos = append(revRepos, r.Repos)
+		}
+	}
+	return revEntries, revActions, revRepos, nil
+}
+
+// revisionRepos are the repositories matched by a scopeQuery at one of the
+// revisions given with its rev: filter, or at their default branch if Rev is
+// empty.
+type revisionRepos struct {
+	Rev   string
+	Repos []campaigns.ActionRepo
+}
+
+// actionReposByRevision returns the repositories matched by scopeQuery for
+// each of the revisions given with its rev: filter, like actionRepos.
+func actionReposByRevision(ctx context.Context, client api.Client, scopeQuery, unsupportedMode string, failOnPartial, allowTruncated bool, cache *reposCache, logger *campaigns.ActionLogger) ([]revisionRepos, []excludedRepo, error) {
+	revs, err := scopeQueryRevisions(scopeQuery)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(revs) <= 1 {
+		repos, excluded, err := actionRepos(ctx, client, scopeQuery, unsupportedMode, failOnPartial, allowTruncated, cache, logger)
+		if err != nil {
+			return nil, nil, err
+		}
+		return []revisionRepos{{Rev: strings.Join(revs, ""), Repos: repos}}, excluded, nil
+	}
+
+	var (
+		byRev    []revisionRepos
+		excluded []excludedRepo
+	)
+	for _, rev := range revs {
+		logger.Infof("Resolving repositories at revision %s...\n", rev)
+		repos, revExcluded, err := actionRepos(ctx, client, scopeQueryWithRevision(scopeQuery, rev), unsupportedMode, failOnPartial, allowTruncated, cache, logger)
+		if err != nil {
+			return nil, nil, err
+		}
+		byRev = append(byRev, revisionRepos{Rev: rev, Repos: repos})
+		for _, e := range revExcluded {
+			excluded = append(excluded, excludedRepo{Name: e.Name, Reason: fmt.Sprintf("%s (at revision %s)", e.Reason, rev)})
+		}
+	}
+	return byRev, excluded, nil
+}
+
+// allRevisionRepos returns the repositories of all revisions.
+func allRevisionRepos(byRev []revisionRepos) []campaigns.ActionRepo {
+	var repos []campaigns.ActionRepo
+	for _, r := range byRev {
+		repos = append(repos, r.Repos...)
+	}
+	return repos
+}
+
+// revisionRef returns the ref of the branch rev, which may already be a full
+// ref.
+func revisionRef(rev string) string {
+	if strings.HasPrefix(rev, "refs/") {
+		return rev
+	}
+	return "refs/heads/" + rev
+}
+
+// actionSearchQuery returns the search query run to resolve the repositories
+// matched by scopeQuery. Unless scopeQuery sets a count, all results are
+// requested: with count:all if countAll is set, i.e. the Sourcegraph instance
+// supports it, otherwise with a count that's high enough in practice.
+func actionSearchQuery(scopeQuery string, countAll bool) string {
+	if countRegexp.MatchString(scopeQuery) {
+		return scopeQuery
+	}
+	if countAll {
+		return scopeQuery + " count:all"
+	}
+	return scopeQuery + " count:999999"
+}
+
+// scopeQueryLimited returns whether scopeQuery limits the number of search
+// results with a count: other than count:all, in which case hitting the limit
+// is intended.
+func scopeQueryLimited(scopeQuery string) bool {
+	m := countRegexp.FindStringSubmatch(scopeQuery)
+	return m != nil && m[1] != "all"
+}
+
+// supportsCountAll returns whether the Sourcegraph instance supports count:all
+// in search queries.
+func supportsCountAll(ctx context.Context, client api.Client) (bool, error) {
+	version, err := getSourcegraphVersion(ctx, client)
 	if err != nil {
-		return nil, err
+		return false, errors.Wrap(err, "getting Sourcegraph version")
 	}
+	return sourcegraphVersionCheck(version, ">= 3.29.0", "2021-06-01")
+}
 
-	if !hasCount {
-		scopeQuery = scopeQuery + " count:999999"
+// actionRepos returns the repositories matched by scopeQuery that actions can
+// be executed in, along with those that were matched but excluded. If
+// scopeQuery contains a rev: filter, actions are executed on that revision
+// instead of the default branch. Alerts
+// returned by the search and the reasons why its results are incomplete are
+// printed. If failOnPartial is true, incomplete results are an error.
+// Results that were truncated by the search result limit are an error unless
+// allowTruncated is true or scopeQuery sets the limit itself.
+// Repositories on code hosts not supported by campaigns are handled according
+// to unsupportedMode.
+func actionRepos(ctx context.Context, client api.Client, scopeQuery, unsupportedMode string, failOnPartial, allowTruncated bool, cache *reposCache, logger *campaigns.ActionLogger) ([]campaigns.ActionRepo, []excludedRepo, error) {
+	rev, err := scopeQueryRevision(scopeQuery)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	query := `
-query ActionRepos($query: String!) {
+query ActionRepos($query: String!, $rev: String!, $hasRev: Boolean!) {
 	search(query: $query, version: V2) {
 		results {
 			results {
@@ -346,8 +1332,21 @@ query ActionRepos($query: String!) {
 					repository {
 						...repositoryFields
 					}
+					file {
+						path
+						commit {
+							oid
+						}
+					}
 				}
 			}
+			limitHit
+			cloning {
+				name
+			}
+			timedout {
+				name
+			}
 			...SearchResultsAlertFields
 		}
 	}
@@ -365,6 +1364,9 @@ fragment repositoryFields on Repository {
 			oid
 		}
 	}
+	revCommit: commit(rev: $rev) @include(if: $hasRev) {
+		oid
+	}
 }
 ` + searchResultsAlertFragment
 
@@ -377,6 +1379,7 @@ fragment repositoryFields on Repository {
 			Name   string
 			Target struct{ OID string }
 		}
+		RevCommit *struct{ OID string }
 	}
 	var result struct {
 		Data struct {
@@ -392,9 +1395,16 @@ fragment repositoryFields on Repository {
 							Name   string
 							Target struct{ OID string }
 						}
+						RevCommit  *struct{ OID string }
 						Repository Repository `json:"repository"`
+						File       struct {
+							Path   string
+							Commit struct{ OID string }
+						}
 					}
-					Alert searchResultsAlert
+					LimitHit          bool
+					Cloning, Timedout []struct{ Name string }
+					Alert             searchResultsAlert
 				}
 			}
 		} `json:"data,omitempty"`
@@ -405,18 +1415,52 @@ fragment repositoryFields on Repository {
 		} `json:"errors,omitempty"`
 	}
 
-	ok, err := client.NewRequest(query, map[string]interface{}{
-		"query": scopeQuery,
-	}).DoRaw(ctx, &result)
+	countAll, err := supportsCountAll(ctx, client)
 	if err != nil {
-		return nil, err
-	} else if !ok {
-		return nil, nil
+		return nil, nil, err
+	}
+	searchQuery := actionSearchQuery(scopeQuery, countAll)
+	accessToken, err := cfg.accessToken()
+	if err != nil {
+		return nil, nil, err
+	}
+	cacheKey := reposCacheKey(cfg.Endpoint, accessToken, searchQuery, rev)
+	if data, cachedAt, ok := cache.get(cacheKey); ok && json.Unmarshal(data, &result) == nil {
+		logger.Infof("Using the repositories resolved %s ago. Use -refresh-repos to run the search again.\n", time.Since(cachedAt).Round(time.Second))
+	} else {
+		var raw json.RawMessage
+		ok, err := client.NewRequest(query, map[string]interface{}{
+			"query":  searchQuery,
+			"rev":    rev,
+			"hasRev": rev != "",
+		}).DoRaw(ctx, &raw)
+		if err != nil {
+			return nil, nil, err
+		} else if !ok {
+			return nil, nil, nil
+		}
+		if err := json.Unmarshal(raw, &result); err != nil {
+			return nil, nil, err
+		}
+		if completeSearchResult(raw) {
+			cache.set(cacheKey, raw)
+		}
 	}
 
 	skipped := []string{}
 	unsupported := []string{}
+	unsupportedNames := map[string]bool{}
+	var excluded []excludedRepo
+	excludedNames := map[string]bool{}
+	exclude := func(name, reason string) {
+		// A repository shows up once for every file match in it.
+		if !excludedNames[name] {
+			excludedNames[name] = true
+			excluded = append(excluded, excludedRepo{Name: name, Reason: reason})
+		}
+	}
 	reposByID := map[string]campaigns.ActionRepo{}
+	pathsByID := map[string][]string{}
 	for _, searchResult := range result.Data.Search.Results.Results {
 
 		var repo Repository
@@ -428,46 +1472,80 @@ fragment repositoryFields on Repository {
 				Name:               searchResult.Name,
 				ExternalRepository: searchResult.ExternalRepository,
 				DefaultBranch:      searchResult.DefaultBranch,
+				RevCommit:          searchResult.RevCommit,
 			}
 		}
 
-		// Skip repos from unsupported code hosts but don't report them explicitly.
-		if !includeUnsupported {
-			ok, err := isCodeHostSupportedForCampaigns(ctx, client, repo.ExternalRepository.ServiceType)
-			if err != nil {
-				return nil, errors.Wrap(err, "failed code host check")
+		supported, err := isCodeHostSupportedForCampaigns(ctx, client, repo.ExternalRepository.ServiceType)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "failed code host check")
+		}
+		serviceType := repo.ExternalRepository.ServiceType
+		if !supported {
+			// A repository shows up once for every file match in it.
+			if !unsupportedNames[repo.Name] {
+				unsupportedNames[repo.Name] = true
+				unsupported = append(unsupported, fmt.Sprintf("%s (code host type %q)", repo.Name, serviceType))
 			}
-			if !ok {
-				unsupported = append(unsupported, repo.Name)
+			if unsupportedMode != unsupportedInclude {
+				exclude(repo.Name, fmt.Sprintf("code host type %q not supported by campaigns", serviceType))
 				continue
 			}
 		}
 
-		if repo.DefaultBranch == nil || repo.DefaultBranch.Name == "" {
+		if repo.DefaultBranch == nil || repo.DefaultBranch.Name == "" || repo.DefaultBranch.Target.OID == "" {
 			skipped = append(skipped, repo.Name)
+			exclude(repo.Name, "default branch could not be determined")
 			continue
 		}
 
-		if repo.DefaultBranch.Target.OID == "" {
-			skipped = append(skipped, repo.Name)
-			continue
+		actionRepo := campaigns.ActionRepo{
+			ID:      repo.ID,
+			Name:    repo.Name,
+			Rev:     repo.DefaultBranch.Target.OID,
+			BaseRef: repo.DefaultBranch.Name,
+
+			ExternalServiceType: serviceType,
+		}
+		if rev != "" {
+			// File matches are on the exact commit that was searched,
+			// repository matches are resolved separately.
+			switch {
+			case searchResult.File.Commit.OID != "":
+				actionRepo.Rev = searchResult.File.Commit.OID
+			case repo.RevCommit != nil && repo.RevCommit.OID != "":
+				actionRepo.Rev = repo.RevCommit.OID
+			default:
+				exclude(repo.Name, fmt.Sprintf("revision %q not found", rev))
+				continue
+			}
+			// Changesets for a commit are opened against the default branch.
+			if !commitOIDRegexp.MatchString(rev) {
+				actionRepo.BaseRef = revisionRef(rev)
+			}
 		}
 
 		if _, ok := reposByID[repo.ID]; !ok {
-			reposByID[repo.ID] = campaigns.ActionRepo{
-				ID:      repo.ID,
-				Name:    repo.Name,
-				Rev:     repo.DefaultBranch.Target.OID,
-				BaseRef: repo.DefaultBranch.Name,
-			}
+			reposByID[repo.ID] = actionRepo
+		}
+		if path := searchResult.File.Path; path != "" {
+			pathsByID[repo.ID] = append(pathsByID[repo.ID], path)
 		}
 	}
 
 	repos := make([]campaigns.ActionRepo, 0, len(reposByID))
-	for _, repo := range reposByID {
+	for id, repo := range reposByID {
+		repo.SearchResultPaths = searchResultPaths(pathsByID[id])
 		repos = append(repos, repo)
 	}
-	logger.RepoMatches(len(repos), skipped, unsupported)
+	sort.Strings(unsupported)
+	if unsupportedMode == unsupportedError && len(unsupported) > 0 {
+		return nil, nil, &exitCodeError{
+			error:    fmt.Errorf("%d repositories matched by the scopeQuery are on code hosts not supported by campaigns (use -allow-unsupported skip or include to proceed):\n%s", len(unsupported), strings.Join(unsupported, "\n")),
+			exitCode: exitCodeValidation,
+		}
+	}
+	logger.RepoMatches(len(repos), skipped, unsupported, unsupportedMode == unsupportedInclude)
 
 	if content, err := result.Data.Search.Results.Alert.Render(); err != nil {
 		yellow.Fprint(os.Stderr, err)
@@ -475,7 +1553,102 @@ fragment repositoryFields on Repository {
 		os.Stderr.WriteString(content)
 	}
 
-	return repos, nil
+	names := func(repos []struct{ Name string }) []string {
+		n := make([]string, 0, len(repos))
+		for _, r := range repos {
+			n = append(n, r.Name)
+		}
+		return n
+	}
+	results := result.Data.Search.Results
+	limited := scopeQueryLimited(scopeQuery)
+	if results.LimitHit && !limited {
+		err := fmt.Errorf("the search for the scopeQuery hit the result limit of the Sourcegraph instance, so only %d of the matching repositories were returned", len(repos))
+		if !allowTruncated {
+			return nil, nil, &exitCodeError{
+				error:    errors.Wrap(err, "narrow down the scopeQuery or use -allow-truncated to proceed"),
+				exitCode: exitCodeValidation,
+			}
+		}
+		yellow.Fprintf(os.Stderr, "WARNING: %s.\n", err)
+	}
+	if partial := searchPartialResults(results.LimitHit && limited, names(results.Cloning), names(results.Timedout)); len(partial) > 0 {
+		err := fmt.Errorf("the scopeQuery returned incomplete results: %s", strings.Join(partial, "; "))
+		if failOnPartial {
+			return nil, nil, err
+		}
+		yellow.Fprintf(os.Stderr, "WARNING: %s. Use -fail-on-partial to fail instead.\n", err)
+	}
+
+	return repos, excluded, nil
+}
+
+// searchResultPaths returns the sorted, unique paths of the files matched in
+// a repository in the form of campaigns.ActionRepo.SearchResultPaths.
+func searchResultPaths(paths []string) string {
+	sort.Strings(paths)
+	unique := paths[:0]
+	for i, p := range paths {
+		if i == 0 || p != paths[i-1] {
+			unique = append(unique, p)
+		}
+	}
+	return strings.Join(unique, "\n")
+}
+
+// requireFileMatches removes the repositories in which the scopeQuery matched
+// no files, for actions with "requireFileMatches", and returns them as
+// excluded.
+func requireFileMatches(byRev []revisionRepos) ([]revisionRepos, []excludedRepo) {
+	var excluded []excludedRepo
+	for i := range byRev {
+		var repos []campaigns.ActionRepo
+		for _, repo := range byRev[i].Repos {
+			if repo.SearchResultPaths == "" {
+				reason := "the scopeQuery matched no files in it"
+				if len(byRev) > 1 {
+					reason += fmt.Sprintf(" (at revision %s)", byRev[i].Rev)
+				}
+				excluded = append(excluded, excludedRepo{Name: repo.Name, Reason: reason})
+				continue
+			}
+			repos = append(repos, repo)
+		}
+		byRev[i].Repos = repos
+	}
+	return byRev, excluded
+}
+
+// The modes for handling repositories on code hosts that campaigns can't
+// publish changesets to.
+const (
+	unsupportedSkip    = "skip"
+	unsupportedError   = "error"
+	unsupportedInclude = "include"
+)
+
+// unsupportedMode returns how repositories on unsupported code hosts are
+// handled. The -allow-unsupported flag takes precedence over
+// "allowUnsupported" in the action definition; -include-unsupported is a
+// shorthand for "-allow-unsupported include".
+func unsupportedMode(allowFlag string, includeFlag bool, action campaigns.Action) (string, error) {
+	if includeFlag {
+		if allowFlag != "" && allowFlag != unsupportedInclude {
+			return "", &usageError{errors.New("-include-unsupported conflicts with -allow-unsupported")}
+		}
+		return unsupportedInclude, nil
+	}
+	switch allowFlag {
+	case unsupportedSkip, unsupportedError, unsupportedInclude:
+		return allowFlag, nil
+	case "":
+	default:
+		return "", &usageError{fmt.Errorf("invalid -allow-unsupported %q, must be one of skip, error or include", allowFlag)}
+	}
+	if action.AllowUnsupported != "" {
+		return action.AllowUnsupported, nil
+	}
+	return unsupportedSkip, nil
 }
 
 var yellow = color.New(color.FgYellow)
@@ -1,9 +1,16 @@
 package main
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"testing"
 
+	"github.com/google/go-cmp/cmp"
 	"github.com/pkg/errors"
+	"github.com/sourcegraph/src-cli/internal/campaigns"
 )
 
 func TestCodeHostSupported(t *testing.T) {
@@ -81,3 +88,261 @@ func TestCodeHostSupported(t *testing.T) {
 		}
 	})
 }
+
+func TestScopeQueryRevision(t *testing.T) {
+	for name, tc := range map[string]struct {
+		scopeQuery string
+		want       string
+		wantErr    bool
+	}{
+		"no revision":      {scopeQuery: "repo:github.com/sourcegraph/ lang:go", want: ""},
+		"revision":         {scopeQuery: "repo:github.com/sourcegraph/ rev:release-1.0 lang:go", want: "release-1.0"},
+		"long form":        {scopeQuery: "revision:refs/heads/main repo:src-cli", want: "refs/heads/main"},
+		"not a filter":     {scopeQuery: "repo:github.com/sourcegraph/ prev:foo", want: ""},
+		"multiple filters": {scopeQuery: "rev:a rev:b", wantErr: true},
+		"multiple revs":    {scopeQuery: "rev:a:b", wantErr: true},
+		"glob":             {scopeQuery: "rev:*refs/heads/release-*", wantErr: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			have, err := scopeQueryRevision(tc.scopeQuery)
+			if tc.wantErr != (err != nil) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if have != tc.want {
+				t.Errorf("unexpected revision: have %q; want %q", have, tc.want)
+			}
+		})
+	}
+}
+
+func TestScopeQueryRevisions(t *testing.T) {
+	for name, tc := range map[string]struct {
+		scopeQuery string
+		want       []string
+		wantQuery  string
+		wantErr    bool
+	}{
+		"no revision":      {scopeQuery: "repo:src-cli", want: nil, wantQuery: "repo:src-cli"},
+		"revision":         {scopeQuery: "repo:src-cli rev:main", want: []string{"main"}, wantQuery: "repo:src-cli rev:x"},
+		"revisions":        {scopeQuery: "repo:src-cli rev:release-1.0:release-2.0 lang:go", want: []string{"release-1.0", "release-2.0"}, wantQuery: "repo:src-cli rev:x lang:go"},
+		"empty revision":   {scopeQuery: "rev:a::b", wantErr: true},
+		"multiple filters": {scopeQuery: "rev:a rev:b", wantErr: true},
+		"glob":             {scopeQuery: "rev:a:*refs/heads/release-*", wantErr: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			have, err := scopeQueryRevisions(tc.scopeQuery)
+			if tc.wantErr != (err != nil) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, have); diff != "" {
+				t.Errorf("unexpected revisions (-want +have):\n%s", diff)
+			}
+			if tc.wantErr {
+				return
+			}
+			if have := scopeQueryWithRevision(tc.scopeQuery, "x"); have != tc.wantQuery {
+				t.Errorf("unexpected scopeQuery: have %q; want %q", have, tc.wantQuery)
+			}
+		})
+	}
+}
+
+func TestActionSearchQuery(t *testing.T) {
+	for name, tc := range map[string]struct {
+		scopeQuery  string
+		countAll    bool
+		want        string
+		wantLimited bool
+	}{
+		"count:all supported":   {scopeQuery: "lang:go", countAll: true, want: "lang:go count:all"},
+		"count:all unsupported": {scopeQuery: "lang:go", want: "lang:go count:999999"},
+		"explicit count":        {scopeQuery: "count:50 lang:go", countAll: true, want: "count:50 lang:go", wantLimited: true},
+		"explicit count:all":    {scopeQuery: "lang:go count:all", want: "lang:go count:all"},
+		"not a count filter":    {scopeQuery: "repo:account:1", countAll: true, want: "repo:account:1 count:all"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if have := actionSearchQuery(tc.scopeQuery, tc.countAll); have != tc.want {
+				t.Errorf("unexpected search query: have %q; want %q", have, tc.want)
+			}
+			if have := scopeQueryLimited(tc.scopeQuery); have != tc.wantLimited {
+				t.Errorf("unexpected limited: have %t; want %t", have, tc.wantLimited)
+			}
+		})
+	}
+}
+
+func TestExpandRevisions(t *testing.T) {
+	a, b := campaigns.ActionRepo{Name: "github.com/a"}, campaigns.ActionRepo{Name: "github.com/b"}
+	byRev := []revisionRepos{
+		{Rev: "release-1.0", Repos: []campaigns.ActionRepo{a}},
+		{Rev: "release-2.0", Repos: []campaigns.ActionRepo{a, b}},
+	}
+	entries := []campaigns.MatrixEntry{{"go": "1.14"}, {"go": "1.15"}}
+	actions := []campaigns.Action{{ScopeQuery: "1.14"}, {ScopeQuery: "1.15"}}
+
+	haveEntries, haveActions, haveRepos, err := expandRevisions(entries, actions, byRev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantEntries := []campaigns.MatrixEntry{
+		{"go": "1.14", "rev": "release-1.0"},
+		{"go": "1.14", "rev": "release-2.0"},
+		{"go": "1.15", "rev": "release-1.0"},
+		{"go": "1.15", "rev": "release-2.0"},
+	}
+	if diff := cmp.Diff(wantEntries, haveEntries); diff != "" {
+		t.Errorf("unexpected entries (-want +have):\n%s", diff)
+	}
+	wantActions := []campaigns.Action{actions[0], actions[0], actions[1], actions[1]}
+	if diff := cmp.Diff(wantActions, haveActions); diff != "" {
+		t.Errorf("unexpected actions (-want +have):\n%s", diff)
+	}
+	wantRepos := [][]campaigns.ActionRepo{{a}, {a, b}, {a}, {a, b}}
+	if diff := cmp.Diff(wantRepos, haveRepos); diff != "" {
+		t.Errorf("unexpected repositories (-want +have):\n%s", diff)
+	}
+
+	if _, _, _, err := expandRevisions([]campaigns.MatrixEntry{{"rev": "x"}}, actions[:1], byRev); err == nil {
+		t.Error("expected an error for a matrix with a rev key")
+	}
+}
+
+func TestUnsupportedMode(t *testing.T) {
+	for name, tc := range map[string]struct {
+		allowFlag   string
+		includeFlag bool
+		spec        string
+		want        string
+		wantErr     bool
+	}{
+		"default":             {want: unsupportedSkip},
+		"spec":                {spec: "error", want: unsupportedError},
+		"flag overrides spec": {allowFlag: "include", spec: "error", want: unsupportedInclude},
+		"include-unsupported": {includeFlag: true, spec: "skip", want: unsupportedInclude},
+		"conflicting flags":   {allowFlag: "error", includeFlag: true, wantErr: true},
+		"invalid flag":        {allowFlag: "import", wantErr: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			have, err := unsupportedMode(tc.allowFlag, tc.includeFlag, campaigns.Action{AllowUnsupported: tc.spec})
+			if tc.wantErr != (err != nil) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if have != tc.want {
+				t.Errorf("unexpected mode: have %q; want %q", have, tc.want)
+			}
+		})
+	}
+}
+
+func TestWritePatchDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "patch-dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	repos := []campaigns.ActionRepo{{ID: "r1", Name: "github.com/my-org/a"}, {ID: "r2", Name: "github.com/my-org/b"}}
+	entries := []campaigns.MatrixEntry{{"go": "1.14"}, {"go": "1.15"}}
+	patchesByEntry := [][]campaigns.PatchInput{
+		{{Repository: "r1", BaseRef: "refs/heads/master", BaseRevision: "c1", Patch: "a 1.14\n"}, {Repository: "r2", BaseRef: "refs/heads/master", BaseRevision: "c2", Patch: "b 1.14\n"}},
+		{{Repository: "r1", BaseRef: "refs/heads/master", BaseRevision: "c1", Patch: "a 1.15\n"}},
+	}
+	if err := writePatchDir(filepath.Join(dir, "patches"), repos, entries, patchesByEntry); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]string{
+		"go-1.14/github.com/my-org/a.patch": "a 1.14\n",
+		"go-1.14/github.com/my-org/b.patch": "b 1.14\n",
+		"go-1.15/github.com/my-org/a.patch": "a 1.15\n",
+	} {
+		have, err := ioutil.ReadFile(filepath.Join(dir, "patches", filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasSuffix(string(have), "\n"+want) {
+			t.Errorf("%s: have %q, want it to end with %q", name, have, want)
+		}
+	}
+
+	// The files can be imported again.
+	imported, err := readPatchDir(filepath.Join(dir, "patches"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Slice(imported, func(i, j int) bool { return imported[i].Patch < imported[j].Patch })
+	want := []importedPatch{
+		{Repository: "github.com/my-org/a", BaseRef: "refs/heads/master", BaseRevision: "c1", Patch: "a 1.14\n"},
+		{Repository: "github.com/my-org/a", BaseRef: "refs/heads/master", BaseRevision: "c1", Patch: "a 1.15\n"},
+		{Repository: "github.com/my-org/b", BaseRef: "refs/heads/master", BaseRevision: "c2", Patch: "b 1.14\n"},
+	}
+	if diff := cmp.Diff(want, imported); diff != "" {
+		t.Errorf("unexpected imported patches (-want +have):\n%s", diff)
+	}
+
+	// Repositories whose names only differ in slashes and dashes don't
+	// collide, unlike matrix entries that map to the same directory.
+	repos = []campaigns.ActionRepo{{ID: "r1", Name: "github.com/my-org/a-b"}, {ID: "r2", Name: "github.com/my-org/a/b"}}
+	if err := writePatchDir(filepath.Join(dir, "names"), repos, []campaigns.MatrixEntry{nil}, [][]campaigns.PatchInput{{{Repository: "r1", Patch: "1\n"}, {Repository: "r2", Patch: "2\n"}}}); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"github.com/my-org/a-b.patch", "github.com/my-org/a/b.patch"} {
+		if _, err := os.Stat(filepath.Join(dir, "names", filepath.FromSlash(name))); err != nil {
+			t.Error(err)
+		}
+	}
+	entries = []campaigns.MatrixEntry{{"go": "1 14"}, {"go": "1_14"}}
+	patchesByEntry = [][]campaigns.PatchInput{{{Repository: "r1", Patch: "1\n"}}, {{Repository: "r1", Patch: "2\n"}}}
+	if err := writePatchDir(filepath.Join(dir, "collision"), repos, entries, patchesByEntry); err == nil {
+		t.Error("no error for matrix entries that map to the same directory")
+	}
+}
+
+func TestSkipLargeRepos(t *testing.T) {
+	repos := []campaigns.ActionRepo{{ID: "r1", Name: "github.com/a"}, {ID: "r2", Name: "github.com/b"}, {ID: "r3", Name: "github.com/c"}}
+	sizes := map[string]uint64{"r1": 1024, "r2": 3 * 1024 * 1024}
+
+	kept, skipped := skipLargeRepos(repos, sizes, 1024*1024)
+	if diff := cmp.Diff([]campaigns.ActionRepo{repos[0], repos[2]}, kept); diff != "" {
+		t.Errorf("unexpected kept repositories (-want +have):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"github.com/b (3.0 MiB)"}, skipped); diff != "" {
+		t.Errorf("unexpected skipped repositories (-want +have):\n%s", diff)
+	}
+
+	total, unknown := totalRepoSize(kept, sizes)
+	if total != 1024 || unknown != 1 {
+		t.Errorf("have total %d and %d unknown, want 1024 and 1", total, unknown)
+	}
+}
+
+func TestRequireFileMatches(t *testing.T) {
+	byRev := []revisionRepos{
+		{Rev: "a", Repos: []campaigns.ActionRepo{
+			{ID: "r1", Name: "github.com/a", SearchResultPaths: searchResultPaths([]string{"b.go", "a.go", "b.go"})},
+			{ID: "r2", Name: "github.com/b"},
+		}},
+		{Rev: "b", Repos: []campaigns.ActionRepo{
+			{ID: "r2", Name: "github.com/b"},
+		}},
+	}
+
+	have, excluded := requireFileMatches(byRev)
+	want := []revisionRepos{
+		{Rev: "a", Repos: []campaigns.ActionRepo{{ID: "r1", Name: "github.com/a", SearchResultPaths: "a.go\nb.go"}}},
+		{Rev: "b"},
+	}
+	if diff := cmp.Diff(want, have); diff != "" {
+		t.Errorf("unexpected repositories (-want +have):\n%s", diff)
+	}
+	wantExcluded := []excludedRepo{
+		{Name: "github.com/b", Reason: "the scopeQuery matched no files in it (at revision a)"},
+		{Name: "github.com/b", Reason: "the scopeQuery matched no files in it (at revision b)"},
+	}
+	if diff := cmp.Diff(wantExcluded, excluded); diff != "" {
+		t.Errorf("unexpected excluded repositories (-want +have):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"a.go", "b.go"}, have[0].Repos[0].SearchResultPathList()); diff != "" {
+		t.Errorf("unexpected paths (-want +have):\n%s", diff)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/src-cli/internal/campaigns"
+)
+
+func init() {
+	usage := fmt.Sprintf(`
+Generate an action definition for a common type of campaign. The action definition is printed and can be saved to a file and adjusted before executing it with 'src actions exec'.
+
+Usage:
+
+	src actions generate <type> [options]
+
+Types:
+
+	dependency-upgrade    upgrades a dependency to a version in all repositories that depend on it.
+	                      Requires -ecosystem (one of %s), -package and -version.
+
+The steps use pinned Docker images that are known to work.
+
+Examples:
+
+  Generate an action that upgrades lodash to 4.17.21 and save it to upgrade-lodash.action.yml:
+
+		$ src actions generate dependency-upgrade -ecosystem npm -package lodash -version 4.17.21 > upgrade-lodash.action.yml
+
+  Upgrade a Go module:
+
+		$ src actions generate dependency-upgrade -ecosystem go -package golang.org/x/text -version v0.3.3 > upgrade-x-text.action.yml
+
+`, strings.Join(campaigns.DependencyUpgradeEcosystems(), ", "))
+
+	flagSet := flag.NewFlagSet("generate", flag.ExitOnError)
+	usageFunc := func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'src actions %s':\n", flagSet.Name())
+		flagSet.PrintDefaults()
+		fmt.Println(usage)
+	}
+
+	var (
+		ecosystemFlag = flagSet.String("ecosystem", "", "The package ecosystem of the dependency (dependency-upgrade).")
+		packageFlag   = flagSet.String("package", "", "The name of the package to upgrade (dependency-upgrade).")
+		versionFlag   = flagSet.String("version", "", "The version to upgrade the package to (dependency-upgrade).")
+		formatFlag    = flagSet.String("format", "yaml", `The format of the action definition: "yaml" or "json".`)
+	)
+
+	handler := func(args []string) error {
+		if err := flagSet.Parse(args); err != nil {
+			return err
+		}
+		if flagSet.NArg() == 0 {
+			return &usageError{errors.New("expected the type of action to generate")}
+		}
+		// The flags follow the type.
+		kind := flagSet.Arg(0)
+		if err := flagSet.Parse(flagSet.Args()[1:]); err != nil {
+			return err
+		}
+		if flagSet.NArg() != 0 {
+			return &usageError{fmt.Errorf("unexpected arguments: %s", strings.Join(flagSet.Args(), " "))}
+		}
+		if *formatFlag != "yaml" && *formatFlag != "json" {
+			return &usageError{fmt.Errorf("invalid format %q", *formatFlag)}
+		}
+
+		var action *campaigns.Action
+		switch kind {
+		case "dependency-upgrade":
+			if *ecosystemFlag == "" || *packageFlag == "" || *versionFlag == "" {
+				return &usageError{errors.New("dependency-upgrade requires -ecosystem, -package and -version")}
+			}
+			var err error
+			if action, err = campaigns.GenerateDependencyUpgrade(*ecosystemFlag, *packageFlag, *versionFlag); err != nil {
+				return &usageError{err}
+			}
+		default:
+			return &usageError{fmt.Errorf("unknown type %q", kind)}
+		}
+
+		data, err := campaigns.MarshalActionDefinition(action)
+		if err != nil {
+			return err
+		}
+		// Generated action definitions must be valid, like those written by
+		// hand.
+		if err := campaigns.ValidateActionDefinition(data); err != nil {
+			return errors.Wrap(err, "generated action definition is invalid")
+		}
+		if *formatFlag == "yaml" {
+			if data, err = yaml.JSONToYAML(data); err != nil {
+				return err
+			}
+		} else {
+			data = append(data, '\n')
+		}
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+
+	// Register the command.
+	actionsCommands = append(actionsCommands, &command{
+		flagSet:   flagSet,
+		handler:   handler,
+		usageFunc: usageFunc,
+	})
+}
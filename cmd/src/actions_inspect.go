@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/src-cli/internal/api"
+	"github.com/sourcegraph/src-cli/internal/campaigns"
+)
+
+func init() {
+	usage := `
+Show what 'src actions exec' would do for an action definition, without executing it: for every repository matched by the "scopeQuery" and every matrix entry, the steps that would run, with matrix placeholders replaced and the digests of their images, the cache key and whether a cached result exists, and the fields of the patch that would be produced.
+
+The Docker images used by the action are pulled or built, since their digests are part of the cache key.
+
+Examples:
+
+  Inspect the action definition in ~/run-gofmt-in-dockerfile.json:
+
+		$ src actions inspect -f ~/run-gofmt-in-dockerfile.json
+
+  List the repositories that don't have a cached result yet:
+
+		$ src actions inspect -f ~/run-gofmt-in-dockerfile.json -format '{{if not .Cached}}{{.Name}}{{end}}'
+
+  Print the execution plan as JSON:
+
+		$ src actions inspect -f ~/run-gofmt-in-dockerfile.json -format '{{. | json}}'
+
+  The template given with -format or -template-file is executed once per repository and matrix entry, with the following fields:
+
+		ID, Name       The ID and name of the repository.
+		BaseRef, Rev   The branch and revision the action would be executed on.
+		Matrix         The matrix entry, as a comma-separated list of key=value pairs. Empty if the action has no matrix.
+		Steps          The steps, each with the fields Type, Image, ImageDigest, Build and Args.
+		CacheKey       The key of the cached result.
+		Cached         Whether a cached result exists.
+		Patch          The fields of the patch that would be produced: Repository, BaseRevision and BaseRef.
+
+`
+
+	flagSet := flag.NewFlagSet("inspect", flag.ExitOnError)
+	usageFunc := func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'src actions %s':\n", flagSet.Name())
+		flagSet.PrintDefaults()
+		fmt.Println(usage)
+	}
+
+	cacheDir, displayUserCacheDir := defaultActionCacheDir()
+
+	var (
+		fileFlag               = flagSet.String("f", "-", "The action file. If not given or '-' standard input is used. (Required)")
+		varsFlags              = newActionVarsFlags(flagSet)
+		allowUnsupportedFlag   = flagSet.String("allow-unsupported", "", `What to do with repositories on code hosts not supported by campaigns: "skip" them, fail with an "error" or "include" them to generate patches that can only be imported. Overrides "allowUnsupported" in the action definition (default "skip").`)
+		includeUnsupportedFlag = flagSet.Bool("include-unsupported", false, "Deprecated: use -allow-unsupported include.")
+		cacheDirFlag           = flagSet.String("cache", displayUserCacheDir, "Directory for cached results.")
+		formatFlag             = flagSet.String("format", inspectFormat, "Format for each repository and matrix entry, using the syntax of Go package text/template.")
+		templateFileFlag       = flagSet.String("template-file", "", templateFileFlagUsage)
+		cacheKeyFlags          = newActionCacheKeyFlags(flagSet)
+		apiFlags               = api.NewFlags(flagSet)
+	)
+
+	handler := func(args []string) error {
+		if err := flagSet.Parse(args); err != nil {
+			return err
+		}
+
+		vars, err := varsFlags.vars()
+		if err != nil {
+			return err
+		}
+		action, err := readActionOffline(*fileFlag, vars)
+		if err != nil {
+			return err
+		}
+		unsupported, err := unsupportedMode(*allowUnsupportedFlag, *includeUnsupportedFlag, *action)
+		if err != nil {
+			return err
+		}
+
+		tmpl, err := parseTemplateOrFile(*formatFlag, *templateFileFlag)
+		if err != nil {
+			return err
+		}
+		hooks, err := cacheKeyFlags.hooks()
+		if err != nil {
+			return err
+		}
+
+		if *cacheDirFlag == displayUserCacheDir {
+			*cacheDirFlag = cacheDir
+		}
+		cache := campaigns.ExecutionDiskCache{Dir: *cacheDirFlag}
+
+		ctx := context.Background()
+		client := cfg.apiClient(apiFlags, flagSet.Output())
+		logger := campaigns.NewActionLogger(*verbose, false, *quiet)
+
+		var actions []campaigns.Action
+		for _, entry := range action.MatrixEntries() {
+			a, err := action.WithMatrix(entry)
+			if err != nil {
+				return &exitCodeError{error: err, exitCode: exitCodeValidation}
+			}
+			if err := campaigns.PrepareAction(ctx, a, logger); err != nil {
+				return errors.Wrap(err, "Failed to prepare action")
+			}
+			actions = append(actions, a)
+		}
+
+		reposByRev, _, err := actionReposByRevision(ctx, client, action.ScopeQuery, unsupported, false, true, nil, logger)
+		if err != nil {
+			return err
+		}
+		if action.RequireFileMatches {
+			reposByRev, _ = requireFileMatches(reposByRev)
+		}
+		repos := allRevisionRepos(reposByRev)
+
+		entries := action.MatrixEntries()
+		for _, repo := range repos {
+			for i, a := range actions {
+				plan, err := inspectAction(ctx, cache, repo, entries[i], a, cacheKeyFlags.cacheKey(repo, a, hooks))
+				if err != nil {
+					return err
+				}
+				if err := execTemplate(tmpl, plan); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	// Register the command.
+	actionsCommands = append(actionsCommands, &command{
+		flagSet:   flagSet,
+		handler:   handler,
+		usageFunc: usageFunc,
+	})
+}
+
+const inspectFormat = `{{.Name}}@{{.Rev}} ({{.BaseRef}}){{with .Matrix}} [{{.}}]{{end}}
+  cache key: {{.CacheKey}}{{if .Cached}} (cached){{end}}
+{{- range $i, $step := .Steps}}
+  step {{$i}}: {{.Type}}
+    {{- with .Image}} {{.}}{{end}}
+    {{- with .ImageDigest}} ({{.}}){{end}}
+    {{- with .Build}} built from {{.}}{{end}}
+    {{- range .Args}} {{.}}{{end}}
+{{- end}}
+  patch: repository={{.Patch.Repository}} baseRef={{.Patch.BaseRef}} baseRevision={{.Patch.BaseRevision}}`
+
+// inspectedAction is the data passed to the template of 'src actions inspect'
+// for each repository and matrix entry.
+type inspectedAction struct {
+	ID, Name     string
+	BaseRef, Rev string
+	Matrix       string
+	Steps        []inspectedStep
+	CacheKey     string
+	Cached       bool
+	Patch        inspectedPatch
+}
+
+// inspectedPatch contains the fields of a patch that are known before the
+// action is executed.
+type inspectedPatch struct {
+	Repository   string
+	BaseRevision string
+	BaseRef      string
+}
+
+type inspectedStep struct {
+	Type        string
+	Image       string
+	ImageDigest string
+	Build       string
+	Args        []string
+}
+
+// inspectAction describes how action, which PrepareAction has been called on,
+// would be executed in repo, looking up its result in cache under key.
+func inspectAction(ctx context.Context, cache campaigns.ExecutionCache, repo campaigns.ActionRepo, entry campaigns.MatrixEntry, action campaigns.Action, key campaigns.ExecutionCacheKey) (*inspectedAction, error) {
+	hash, err := key.Hash()
+	if err != nil {
+		return nil, err
+	}
+	_, cached, err := cache.Get(ctx, key)
+	if err != nil {
+		return nil, errors.Wrapf(err, "checking cache for %s", repo.Name)
+	}
+
+	plan := &inspectedAction{
+		ID:       repo.ID,
+		Name:     repo.Name,
+		BaseRef:  repo.BaseRef,
+		Rev:      repo.Rev,
+		Matrix:   entry.String(),
+		CacheKey: hash,
+		Cached:   cached,
+		Patch: inspectedPatch{
+			Repository:   repo.ID,
+			BaseRevision: repo.Rev,
+			BaseRef:      repo.BaseRef,
+		},
+	}
+	for _, step := range action.Steps {
+		plan.Steps = append(plan.Steps, inspectedStep{
+			Type:        step.Type,
+			Image:       step.Image,
+			ImageDigest: step.ImageContentDigest,
+			Build:       step.Build,
+			Args:        step.Args,
+		})
+	}
+	return plan, nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/sourcegraph/src-cli/internal/campaigns"
+)
+
+func TestInspectActionCacheKey(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "inspect-cache-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	cache := campaigns.ExecutionDiskCache{Dir: dir}
+	repo := campaigns.ActionRepo{ID: "UmVwb3NpdG9yeTox", Name: "github.com/sourcegraph/src-cli", Rev: "deadbeef", BaseRef: "refs/heads/master"}
+	action := campaigns.Action{Steps: []*campaigns.ActionStep{{Type: "docker", Image: "alpine:3", ImageContentDigest: "sha256:1234"}}}
+	hooks := &campaigns.Hooks{PostTask: "/usr/local/bin/check-license"}
+
+	// The executor caches the result under a key that includes its hooks and
+	// whether it ran the steps in a single container.
+	if err := cache.Set(ctx, campaigns.NewExecutionCacheKey(repo, action, hooks, false), campaigns.PatchInput{Repository: repo.ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, tc := range map[string]struct {
+		hooks           *campaigns.Hooks
+		singleContainer bool
+		gitLFS          bool
+		wantCached      bool
+	}{
+		"same hooks":       {hooks: hooks, wantCached: true},
+		"without hooks":    {hooks: nil, wantCached: false},
+		"other hooks":      {hooks: &campaigns.Hooks{PreTask: "/usr/local/bin/notify"}, wantCached: false},
+		"single container": {hooks: hooks, singleContainer: true, wantCached: false},
+		"git lfs":          {hooks: hooks, gitLFS: true, wantCached: false},
+	} {
+		t.Run(name, func(t *testing.T) {
+			key := campaigns.NewExecutionCacheKey(repo, action, tc.hooks, tc.singleContainer)
+			key.GitLFS = tc.gitLFS
+			plan, err := inspectAction(ctx, cache, repo, nil, action, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if plan.Cached != tc.wantCached {
+				t.Errorf("unexpected Cached %v, want %v", plan.Cached, tc.wantCached)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/fatih/color"
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/src-cli/internal/campaigns"
+	"github.com/sourcegraph/src-cli/internal/output"
+)
+
+func init() {
+	usage := `
+Lint an action definition: validate it like 'src actions validate' and report patterns that are valid, but likely not intended. Like 'src actions validate', it doesn't connect to a Sourcegraph instance or use Docker.
+
+The following rules are checked:
+
+	unpinned-image      (warning) the image of a "docker" step has no tag, or the tag "latest"
+	scope-count         (warning) the scopeQuery contains a count: that limits the matched repositories
+	unused-matrix-key   (warning) no step refers to a matrix key, so all of its entries produce the same patches
+	hardcoded-secret    (warning) an argument or image looks like a credential
+	needs-shell         (warning) an argument uses shell syntax, like | or $VAR, but the step doesn't run a shell
+	host-command        (info)    a "command" step runs on the machine executing the action
+
+If there are warnings, 'src actions lint' exits with exit code 3.
+
+Examples:
+
+  Lint the action definition in action.yml:
+
+		$ src actions lint -f action.yml
+
+  Print the findings as JSON:
+
+		$ src actions lint -f action.yml -format json
+
+`
+
+	flagSet := flag.NewFlagSet("lint", flag.ExitOnError)
+	usageFunc := func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'src actions %s':\n", flagSet.Name())
+		flagSet.PrintDefaults()
+		fmt.Println(usage)
+	}
+
+	var (
+		fileFlag   = flagSet.String("f", "-", "The action file. If not given or '-' standard input is used. (Required)")
+		varsFlags  = newActionVarsFlags(flagSet)
+		formatFlag = flagSet.String("format", "text", `The output format: "text" or "json".`)
+	)
+
+	handler := func(args []string) error {
+		if err := flagSet.Parse(args); err != nil {
+			return err
+		}
+		if *formatFlag != "text" && *formatFlag != "json" {
+			return &usageError{fmt.Errorf("invalid output format %q", *formatFlag)}
+		}
+
+		vars, err := varsFlags.vars()
+		if err != nil {
+			return err
+		}
+		action, err := readActionOffline(*fileFlag, vars)
+		if err != nil {
+			return err
+		}
+
+		findings := campaigns.LintAction(*action)
+		if *formatFlag == "json" {
+			if findings == nil {
+				findings = []campaigns.LintFinding{}
+			}
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(findings); err != nil {
+				return err
+			}
+		}
+
+		warnings := 0
+		for _, f := range findings {
+			if f.Severity == campaigns.LintWarning {
+				warnings++
+			}
+			if *formatFlag != "text" {
+				continue
+			}
+			c, emoji := color.New(color.FgYellow), output.EmojiAlert
+			if f.Severity == campaigns.LintInfo {
+				c, emoji = color.New(color.FgCyan), output.EmojiArrow
+			}
+			c.Printf("%s  %s: %s [%s]\n", output.Emoji(emoji), f.Path, f.Message, f.Rule)
+		}
+
+		if warnings > 0 {
+			return &exitCodeError{error: errors.Errorf("%s has %d warnings", *fileFlag, warnings), exitCode: exitCodeValidation}
+		}
+		if *formatFlag == "text" && !*quiet {
+			fmt.Printf("%s  %s has no warnings\n", output.Emoji(output.EmojiSuccess), *fileFlag)
+		}
+		return nil
+	}
+
+	// Register the command.
+	actionsCommands = append(actionsCommands, &command{
+		flagSet:   flagSet,
+		handler:   handler,
+		usageFunc: usageFunc,
+	})
+}
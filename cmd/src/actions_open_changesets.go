@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/src-cli/internal/api"
+	"github.com/sourcegraph/src-cli/internal/campaigns"
+)
+
+// The modes for handling repositories in which a campaign already has an open
+// changeset on the branch the patches are meant for.
+const (
+	openChangesetSkip      = "skip"
+	openChangesetRebase    = "rebase"
+	openChangesetOverwrite = "overwrite"
+)
+
+// openChangeset is an open changeset that a campaign created on a branch.
+type openChangeset struct {
+	Campaign string
+	URL      string
+	// HeadRef and HeadOID are the branch of the changeset and the commit it
+	// points to, if known.
+	HeadRef string
+	HeadOID string
+}
+
+// openChangesetsQuery returns the changesets of a campaign. The fields marked
+// with "# since" are left out for older instances, see versionedQuery.
+const openChangesetsQuery = `
+query OpenChangesets($campaign: ID!, $first: Int!, $after: String) {
+	node(id: $campaign) {
+		... on Campaign {
+			changesets(first: $first, after: $after) {
+				nodes {
+					state
+					repository {
+						id
+					}
+					externalURL {
+						url
+					}
+					head { # since 3.15.0 2020-04-01
+						name
+						target {
+							oid
+						}
+					}
+				}
+				pageInfo {
+					endCursor
+					hasNextPage
+				}
+			}
+		}
+	}
+}
+`
+
+// openChangesetsOnBranch returns the open changesets that campaigns created on
+// the given branch, keyed by repository ID.
+func openChangesetsOnBranch(ctx context.Context, client api.Client, branch string) (map[string]openChangeset, error) {
+	campaigns, ok, err := listCampaigns(ctx, client)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	query, err := versionedQuery(ctx, client, openChangesetsQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	open := map[string]openChangeset{}
+	for _, c := range campaigns {
+		if c.Branch != branch {
+			continue
+		}
+		err := fetchPages(func(after *string) (*pageInfo, error) {
+			var result struct {
+				Node struct {
+					Changesets struct {
+						Nodes []struct {
+							State       string
+							Repository  struct{ ID string }
+							ExternalURL struct {
+								URL string
+							}
+							Head struct {
+								Name   string
+								Target struct{ OID string }
+							}
+						}
+						PageInfo pageInfo
+					}
+				}
+			}
+			if ok, err := client.NewRequest(query, map[string]interface{}{
+				"campaign": c.ID,
+				"first":    campaignsPageSize,
+				"after":    after,
+			}).Do(ctx, &result); err != nil || !ok {
+				return nil, err
+			}
+			for _, cs := range result.Node.Changesets.Nodes {
+				if cs.State != "OPEN" {
+					continue
+				}
+				open[cs.Repository.ID] = openChangeset{
+					Campaign: c.Name,
+					URL:      cs.ExternalURL.URL,
+					HeadRef:  cs.Head.Name,
+					HeadOID:  cs.Head.Target.OID,
+				}
+			}
+			return &result.Node.Changesets.PageInfo, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return open, nil
+}
+
+// handleOpenChangesets applies the given mode to the repositories that already
+// have an open changeset on branch and reports the decision for each of them.
+// It returns the repositories in which the action should be executed.
+func handleOpenChangesets(ctx context.Context, client api.Client, branch, mode string, repos []campaigns.ActionRepo, logger *campaigns.ActionLogger) ([]campaigns.ActionRepo, error) {
+	open, err := openChangesetsOnBranch(ctx, client, branch)
+	if err != nil {
+		return nil, errors.Wrap(err, "querying open changesets")
+	}
+
+	filtered := repos[:0]
+	for _, repo := range repos {
+		cs, ok := open[repo.ID]
+		if !ok {
+			filtered = append(filtered, repo)
+			continue
+		}
+
+		desc := fmt.Sprintf("Campaign %q has an open changeset on branch %q (%s)", cs.Campaign, branch, cs.URL)
+		switch mode {
+		case openChangesetSkip:
+			logger.RepoWarning(repo.Name, "%s. Skipping repository.\n", desc)
+			continue
+
+		case openChangesetRebase:
+			if cs.HeadOID == "" {
+				logger.RepoWarning(repo.Name, "%s, but its head could not be determined. Skipping repository.\n", desc)
+				continue
+			}
+			logger.RepoWarning(repo.Name, "%s. Executing action on top of its head %s.\n", desc, cs.HeadOID)
+			// The patch is based on the branch of the changeset, and Rev
+			// is the commit that branch points to.
+			repo.Rev = cs.HeadOID
+			repo.BaseRef = cs.HeadRef
+			if repo.BaseRef == "" {
+				repo.BaseRef = "refs/heads/" + branch
+			}
+
+		case openChangesetOverwrite:
+			logger.RepoWarning(repo.Name, "%s. It will be overwritten.\n", desc)
+		}
+		filtered = append(filtered, repo)
+	}
+	return filtered, nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	humanize "github.com/dustin/go-humanize"
+	"github.com/sourcegraph/src-cli/internal/api"
+	"github.com/sourcegraph/src-cli/internal/campaigns"
+)
+
+// repoSizesBatchSize is the number of repositories whose size is queried in a
+// single request.
+const repoSizesBatchSize = 100
+
+// repoSize is the size in bytes of a repository on the Sourcegraph instance,
+// which is returned as a string or a number depending on the version.
+type repoSize uint64
+
+func (s *repoSize) UnmarshalJSON(data []byte) error {
+	n, err := strconv.ParseUint(strings.Trim(string(data), `"`), 10, 64)
+	if err != nil {
+		return err
+	}
+	*s = repoSize(n)
+	return nil
+}
+
+// fetchRepoSizes returns the sizes of the repositories on the Sourcegraph
+// instance, including their history, keyed by ID. Since their archives
+// contain a single revision, they are an upper bound of the download sizes.
+// Instances that don't report sizes return an error, which callers should
+// treat as the sizes being unknown.
+func fetchRepoSizes(ctx context.Context, client api.Client, repos []campaigns.ActionRepo) (map[string]uint64, error) {
+	sizes := make(map[string]uint64, len(repos))
+	for start := 0; start < len(repos); start += repoSizesBatchSize {
+		end := start + repoSizesBatchSize
+		if end > len(repos) {
+			end = len(repos)
+		}
+		batch := repos[start:end]
+
+		var query strings.Builder
+		query.WriteString("query RepositorySizes(")
+		vars := map[string]interface{}{}
+		for i := range batch {
+			if i > 0 {
+				query.WriteString(", ")
+			}
+			fmt.Fprintf(&query, "$id%d: ID!", i)
+			vars[fmt.Sprintf("id%d", i)] = batch[i].ID
+		}
+		query.WriteString(") {\n")
+		for i := range batch {
+			fmt.Fprintf(&query, "  repo%d: node(id: $id%d) { ... on Repository { mirrorInfo { byteSize } } }\n", i, i)
+		}
+		query.WriteString("}")
+
+		var result map[string]*struct {
+			MirrorInfo struct {
+				ByteSize *repoSize
+			}
+		}
+		if ok, err := client.NewRequest(query.String(), vars).Do(ctx, &result); err != nil {
+			return nil, err
+		} else if !ok {
+			return nil, nil
+		}
+		for i, repo := range batch {
+			if r := result[fmt.Sprintf("repo%d", i)]; r != nil && r.MirrorInfo.ByteSize != nil {
+				sizes[repo.ID] = uint64(*r.MirrorInfo.ByteSize)
+			}
+		}
+	}
+	return sizes, nil
+}
+
+// skipLargeRepos returns the repositories whose size is unknown or at most
+// maxSize, and the names of the others with their size.
+func skipLargeRepos(repos []campaigns.ActionRepo, sizes map[string]uint64, maxSize uint64) (kept []campaigns.ActionRepo, skipped []string) {
+	for _, repo := range repos {
+		if size, ok := sizes[repo.ID]; ok && size > maxSize {
+			skipped = append(skipped, fmt.Sprintf("%s (%s)", repo.Name, humanize.IBytes(size)))
+			continue
+		}
+		kept = append(kept, repo)
+	}
+	sort.Strings(skipped)
+	return kept, skipped
+}
+
+// totalRepoSize returns the total size of the repositories whose size is
+// known, and the number of those whose size is unknown.
+func totalRepoSize(repos []campaigns.ActionRepo, sizes map[string]uint64) (total uint64, unknown int) {
+	for _, repo := range repos {
+		if size, ok := sizes[repo.ID]; ok {
+			total += size
+		} else {
+			unknown++
+		}
+	}
+	return total, unknown
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// reposCache caches the search results that the repositories of an action are
+// resolved from, so that iterating on an action doesn't run the same,
+// possibly expensive, search on every invocation. The cached results include
+// the revisions the repositories were resolved to, so the cache is only used
+// when a TTL is set explicitly.
+type reposCache struct {
+	// Dir is the directory the results are cached in.
+	Dir string
+	// TTL is how long results are used. 0, the default, disables the cache.
+	TTL time.Duration
+	// Refresh ignores cached results, but still caches new ones.
+	Refresh bool
+}
+
+// reposCacheKey returns the cache key of a search. The access token is part of
+// it, since users don't necessarily see the same repositories.
+func reposCacheKey(endpoint, accessToken, query, rev string) string {
+	data, _ := json.Marshal([]string{endpoint, accessToken, query, rev})
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+func (c *reposCache) path(key string) string {
+	return filepath.Join(c.Dir, "repos", key+".json")
+}
+
+// get returns the cached result for key and when it was cached, if it is not
+// older than the TTL.
+func (c *reposCache) get(key string) ([]byte, time.Time, bool) {
+	if c == nil || c.TTL <= 0 || c.Refresh {
+		return nil, time.Time{}, false
+	}
+	path := c.path(key)
+	info, err := os.Stat(path)
+	if err != nil || time.Since(info.ModTime()) > c.TTL {
+		return nil, time.Time{}, false
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, time.Time{}, false
+	}
+	return data, info.ModTime(), true
+}
+
+// set caches the result for key. Since the cache is only an optimization,
+// errors writing it are ignored.
+func (c *reposCache) set(key string, data []byte) {
+	if c == nil || c.TTL <= 0 {
+		return
+	}
+	path := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+	}
+}
+
+// completeSearchResult reports whether the raw response of a search holds all
+// of its results. Responses of searches that returned errors or an alert, hit
+// a limit, timed out or ran into repositories that are still cloning would
+// stay incomplete for as long as they are cached, so they are not cached.
+func completeSearchResult(raw []byte) bool {
+	var result struct {
+		Data struct {
+			Search struct {
+				Results struct {
+					LimitHit          bool
+					Cloning, Timedout []json.RawMessage
+					Alert             *json.RawMessage
+				}
+			}
+		}
+		Errors []json.RawMessage
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return false
+	}
+	results := result.Data.Search.Results
+	return len(result.Errors) == 0 && !results.LimitHit && len(results.Cloning) == 0 && len(results.Timedout) == 0 && results.Alert == nil
+}
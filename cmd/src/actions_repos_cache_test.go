@@ -0,0 +1,68 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestReposCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "repos-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	key := reposCacheKey("https://sourcegraph.example.com", "token", "repo:foo", "")
+	if other := reposCacheKey("https://sourcegraph.example.com", "other-token", "repo:foo", ""); other == key {
+		t.Fatal("access token is not part of the cache key")
+	}
+
+	cache := &reposCache{Dir: dir, TTL: time.Minute}
+	if _, _, ok := cache.get(key); ok {
+		t.Fatal("unexpected cached result in empty cache")
+	}
+	cache.set(key, []byte(`{"data":{}}`))
+	if data, _, ok := cache.get(key); !ok || string(data) != `{"data":{}}` {
+		t.Fatalf("have %q, %v, want cached result", data, ok)
+	}
+
+	for name, c := range map[string]*reposCache{
+		"refresh":  {Dir: dir, TTL: time.Minute, Refresh: true},
+		"disabled": {Dir: dir},
+		"nil":      nil,
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, _, ok := c.get(key); ok {
+				t.Error("unexpected cached result")
+			}
+		})
+	}
+
+	t.Run("expired", func(t *testing.T) {
+		old := time.Now().Add(-2 * time.Minute)
+		if err := os.Chtimes(cache.path(key), old, old); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, ok := cache.get(key); ok {
+			t.Error("unexpected expired result")
+		}
+	})
+}
+
+func TestCompleteSearchResult(t *testing.T) {
+	for raw, want := range map[string]bool{
+		`{"data": {"search": {"results": {"results": [], "limitHit": false, "cloning": [], "timedout": [], "alert": null}}}}`: true,
+		`{"data": {"search": {"results": {"limitHit": true}}}}`:                                                               false,
+		`{"data": {"search": {"results": {"cloning": [{"name": "github.com/sourcegraph/src-cli"}]}}}}`:                        false,
+		`{"data": {"search": {"results": {"timedout": [{"name": "github.com/sourcegraph/src-cli"}]}}}}`:                       false,
+		`{"data": {"search": {"results": {"alert": {"title": "No repositories found"}}}}}`:                                    false,
+		`{"errors": [{"message": "search failed"}]}`:                                                                          false,
+		`not json`: false,
+	} {
+		if have := completeSearchResult([]byte(raw)); have != want {
+			t.Errorf("completeSearchResult(%s) = %v, want %v", raw, have, want)
+		}
+	}
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/src-cli/internal/campaigns"
+)
+
+// actionRun records the repositories an action file was executed in and the
+// patches produced by the execution, so that 'src actions diff' can compare
+// them with the next execution.
+type actionRun struct {
+	RunID string    `json:"runID,omitempty"`
+	Time  time.Time `json:"time"`
+	// Patches contains an entry for every repository and matrix entry the
+	// action was executed for, including those without changes.
+	Patches []actionRunPatch `json:"patches"`
+}
+
+type actionRunPatch struct {
+	Repository string `json:"repository"`
+	// Matrix is the matrix entry the patch was produced for, as returned by
+	// MatrixEntry.String.
+	Matrix  string `json:"matrix,omitempty"`
+	BaseRef string `json:"baseRef"`
+	// Files maps the paths of the files changed by the patch to the SHA-256
+	// hash of their part of the patch, see hashPatchFiles. It is empty if the
+	// execution produced no changes or failed. Only the hashes are recorded,
+	// so that patches kept on disk don't have to be read into memory.
+	Files map[string]string `json:"files,omitempty"`
+	// Patch is the whole patch, which was recorded instead of Files by
+	// earlier versions. readActionRun converts it to Files.
+	Patch  string `json:"patch,omitempty"`
+	Failed bool   `json:"failed,omitempty"`
+}
+
+const (
+	latestRunFile   = "latest.json"
+	previousRunFile = "previous.json"
+)
+
+// actionRunsDir returns the directory in cacheDir in which the runs of the
+// action file are recorded.
+func actionRunsDir(cacheDir, actionFile string) (string, error) {
+	path, err := filepath.Abs(actionFile)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256([]byte(path))
+	return filepath.Join(cacheDir, "runs", hex.EncodeToString(hash[:8])), nil
+}
+
+// recordActionRun records run as the latest run in dir. The run that was the
+// latest one before becomes the previous one.
+func recordActionRun(dir string, run actionRun) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+	latest := filepath.Join(dir, latestRunFile)
+	if err := os.Rename(latest, filepath.Join(dir, previousRunFile)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return ioutil.WriteFile(latest, data, 0600)
+}
+
+// recordExecution records the repositories the action was executed in for
+// each matrix entry, whether the execution failed in them and the patches it
+// produced, as the latest run of the action file.
+func recordExecution(cacheDir, actionFile, runID string, entries []campaigns.MatrixEntry, executedByEntry, failedByEntry [][]campaigns.ActionRepo, patchesByEntry [][]campaigns.PatchInput) error {
+	dir, err := actionRunsDir(cacheDir, actionFile)
+	if err != nil {
+		return err
+	}
+	run := actionRun{RunID: runID, Time: time.Now()}
+	for i, executed := range executedByEntry {
+		patches := make(map[string]campaigns.PatchInput, len(patchesByEntry[i]))
+		for _, p := range patchesByEntry[i] {
+			patches[p.Repository] = p
+		}
+		failed := make(map[campaigns.ActionRepo]bool, len(failedByEntry[i]))
+		for _, repo := range failedByEntry[i] {
+			failed[repo] = true
+		}
+
+		for _, repo := range executed {
+			p, ok := patches[repo.ID]
+			if !ok {
+				p.BaseRef = repo.BaseRef
+			}
+			files, err := patchFileHashes(p)
+			if err != nil {
+				return errors.Wrapf(err, "hashing patch for %s", repo.Name)
+			}
+			run.Patches = append(run.Patches, actionRunPatch{
+				Repository: repo.Name,
+				Matrix:     entries[i].String(),
+				BaseRef:    p.BaseRef,
+				Files:      files,
+				Failed:     failed[repo],
+			})
+		}
+	}
+	return recordActionRun(dir, run)
+}
+
+// describeActionRun returns the time of run and its run ID, if it was
+// recorded.
+func describeActionRun(run *actionRun) string {
+	s := run.Time.Format("2006-01-02 15:04:05")
+	if run.RunID != "" {
+		s += " (run " + run.RunID + ")"
+	}
+	return s
+}
+
+// readActionRun reads the run recorded in the given file of dir. It returns
+// nil if there is none.
+func readActionRun(dir, name string) (*actionRun, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, name))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var run actionRun
+	if err := json.Unmarshal(data, &run); err != nil {
+		return nil, errors.Wrapf(err, "invalid run record %s", filepath.Join(dir, name))
+	}
+	for i, p := range run.Patches {
+		if p.Patch == "" {
+			continue
+		}
+		if run.Patches[i].Files, err = hashPatchFiles(strings.NewReader(p.Patch)); err != nil {
+			return nil, err
+		}
+		run.Patches[i].Patch = ""
+	}
+	return &run, nil
+}
+
+// The kinds of differences between the patches of two runs.
+const (
+	runPatchAdded   = "added"
+	runPatchRemoved = "removed"
+	runPatchChanged = "changed"
+	// runExecutionFailed is the kind of changes of repositories in which the
+	// execution failed in the latest run, but not in the previous one.
+	runExecutionFailed = "failed"
+)
+
+// The changes in the repositories two runs executed the action in.
+const (
+	runRepoAdded   = "added"
+	runRepoRemoved = "removed"
+)
+
+// actionRunChange is a difference between two runs in a repository and matrix
+// entry.
+type actionRunChange struct {
+	Repository string
+	Matrix     string
+	// Repo is runRepoAdded or runRepoRemoved if the action was only executed
+	// in the repository in one of the runs.
+	Repo string
+	// Kind is the kind of the difference between the patches, if any.
+	Kind string
+	// Files are the files whose changes differ, for runPatchChanged.
+	Files []string
+}
+
+// diffActionRuns returns the differences between the patches of the runs,
+// sorted by repository and matrix entry.
+func diffActionRuns(previous, latest actionRun) []actionRunChange {
+	type key struct{ repo, matrix string }
+	index := func(run actionRun) map[key]actionRunPatch {
+		patches := make(map[key]actionRunPatch, len(run.Patches))
+		for _, p := range run.Patches {
+			patches[key{p.Repository, p.Matrix}] = p
+		}
+		return patches
+	}
+	before, after := index(previous), index(latest)
+
+	var changes []actionRunChange
+	for k, p := range after {
+		change := actionRunChange{Repository: k.repo, Matrix: k.matrix}
+		old, ok := before[k]
+		if !ok {
+			change.Repo = runRepoAdded
+		}
+		oldFailed := old.Failed
+		if oldFailed {
+			// Nothing is known about the patch of the previous run.
+			old = actionRunPatch{}
+		}
+		switch {
+		case p.Failed && !oldFailed:
+			change.Kind = runExecutionFailed
+		case p.Failed:
+		case len(old.Files) == 0 && len(p.Files) > 0:
+			change.Kind = runPatchAdded
+		case len(old.Files) > 0 && len(p.Files) == 0:
+			change.Kind = runPatchRemoved
+		case len(p.Files) > 0:
+			if files := changedPatchFiles(old.Files, p.Files); len(files) > 0 || old.BaseRef != p.BaseRef {
+				change.Kind = runPatchChanged
+				change.Files = files
+			}
+		}
+		if change.Repo != "" || change.Kind != "" {
+			changes = append(changes, change)
+		}
+	}
+	for k, old := range before {
+		if _, ok := after[k]; !ok {
+			change := actionRunChange{Repository: k.repo, Matrix: k.matrix, Repo: runRepoRemoved}
+			if len(old.Files) > 0 && !old.Failed {
+				change.Kind = runPatchRemoved
+			}
+			changes = append(changes, change)
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Repository != changes[j].Repository {
+			return changes[i].Repository < changes[j].Repository
+		}
+		return changes[i].Matrix < changes[j].Matrix
+	})
+	return changes
+}
+
+// changedPatchFiles returns the sorted paths of the files whose changes
+// differ between two patches, given the hashes of the files' parts of the
+// patches.
+func changedPatchFiles(before, after map[string]string) []string {
+	var files []string
+	for path, hash := range after {
+		if before[path] != hash {
+			files = append(files, path)
+		}
+	}
+	for path := range before {
+		if _, ok := after[path]; !ok {
+			files = append(files, path)
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+// patchFileHashes returns the hashes of the parts of the patch p, see
+// hashPatchFiles, streaming patches kept on disk.
+func patchFileHashes(p campaigns.PatchInput) (map[string]string, error) {
+	pr, pw := io.Pipe()
+	go func() { pw.CloseWithError(p.WritePatch(pw)) }()
+	return hashPatchFiles(pr)
+}
+
+// hashPatchFiles maps the paths of the files changed by a patch in the git
+// diff format to the SHA-256 hash of their part of the patch. Anything before
+// the first file is hashed under an empty path, so that only empty patches
+// result in no hashes.
+func hashPatchFiles(r io.Reader) (map[string]string, error) {
+	files := map[string]string{}
+	var path string
+	h := sha256.New()
+	var written bool
+	flush := func() {
+		if written {
+			files[path] = hex.EncodeToString(h.Sum(nil))
+		}
+		h.Reset()
+		written = false
+	}
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadString('\n')
+		if strings.HasPrefix(line, "diff --git ") {
+			flush()
+			path = strings.TrimSpace(line[len("diff --git "):])
+			if i := strings.Index(path, " b/"); i >= 0 {
+				path = path[i+len(" b/"):]
+			}
+		}
+		if line != "" {
+			io.WriteString(h, line)
+			written = true
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	flush()
+	if len(files) == 0 {
+		return nil, nil
+	}
+	return files, nil
+}
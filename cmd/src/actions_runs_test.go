@@ -0,0 +1,179 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/sourcegraph/src-cli/internal/campaigns"
+)
+
+func TestDiffActionRuns(t *testing.T) {
+	const (
+		readme = "diff --git a/README.md b/README.md\n--- a/README.md\n+++ b/README.md\n@@ -1 +1 @@\n-old\n+new\n"
+		main   = "diff --git a/main.go b/main.go\n--- a/main.go\n+++ b/main.go\n@@ -1 +1 @@\n-package foo\n+package bar\n"
+		main2  = "diff --git a/main.go b/main.go\n--- a/main.go\n+++ b/main.go\n@@ -1 +1 @@\n-package foo\n+package baz\n"
+	)
+
+	files := func(patch string) map[string]string {
+		files, err := hashPatchFiles(strings.NewReader(patch))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return files
+	}
+
+	previous := actionRun{Patches: []actionRunPatch{
+		{Repository: "github.com/a", BaseRef: "refs/heads/master", Files: files(readme)},
+		{Repository: "github.com/b", BaseRef: "refs/heads/master", Files: files(readme + main)},
+		{Repository: "github.com/c", BaseRef: "refs/heads/master", Files: files(readme)},
+		{Repository: "github.com/d", Matrix: "go=1.14", BaseRef: "refs/heads/master", Files: files(main)},
+		{Repository: "github.com/e", BaseRef: "refs/heads/master", Files: files(main)},
+		{Repository: "github.com/g", BaseRef: "refs/heads/master", Files: files(main)},
+		{Repository: "github.com/h", BaseRef: "refs/heads/master"},
+		{Repository: "github.com/i", BaseRef: "refs/heads/master", Files: files(main)},
+		{Repository: "github.com/j", BaseRef: "refs/heads/master", Failed: true},
+		{Repository: "github.com/k", BaseRef: "refs/heads/master", Failed: true},
+		{Repository: "github.com/l", BaseRef: "refs/heads/master"},
+		{Repository: "github.com/n", BaseRef: "refs/heads/master"},
+	}}
+	latest := actionRun{Patches: []actionRunPatch{
+		{Repository: "github.com/a", BaseRef: "refs/heads/master", Files: files(readme)},
+		{Repository: "github.com/b", BaseRef: "refs/heads/master", Files: files(readme + main2)},
+		{Repository: "github.com/d", Matrix: "go=1.15", BaseRef: "refs/heads/master", Files: files(main)},
+		{Repository: "github.com/e", BaseRef: "refs/heads/main", Files: files(main)},
+		{Repository: "github.com/f", BaseRef: "refs/heads/master", Files: files(readme)},
+		{Repository: "github.com/g", BaseRef: "refs/heads/master"},
+		{Repository: "github.com/h", BaseRef: "refs/heads/master", Files: files(main)},
+		{Repository: "github.com/i", BaseRef: "refs/heads/master", Failed: true},
+		{Repository: "github.com/j", BaseRef: "refs/heads/master", Failed: true},
+		{Repository: "github.com/k", BaseRef: "refs/heads/master", Files: files(main)},
+		{Repository: "github.com/l", BaseRef: "refs/heads/main"},
+		{Repository: "github.com/m", BaseRef: "refs/heads/master"},
+	}}
+
+	want := []actionRunChange{
+		{Repository: "github.com/b", Kind: runPatchChanged, Files: []string{"main.go"}},
+		{Repository: "github.com/c", Repo: runRepoRemoved, Kind: runPatchRemoved},
+		{Repository: "github.com/d", Matrix: "go=1.14", Repo: runRepoRemoved, Kind: runPatchRemoved},
+		{Repository: "github.com/d", Matrix: "go=1.15", Repo: runRepoAdded, Kind: runPatchAdded},
+		{Repository: "github.com/e", Kind: runPatchChanged},
+		{Repository: "github.com/f", Repo: runRepoAdded, Kind: runPatchAdded},
+		{Repository: "github.com/g", Kind: runPatchRemoved},
+		{Repository: "github.com/h", Kind: runPatchAdded},
+		{Repository: "github.com/i", Kind: runExecutionFailed},
+		{Repository: "github.com/k", Kind: runPatchAdded},
+		{Repository: "github.com/m", Repo: runRepoAdded},
+		{Repository: "github.com/n", Repo: runRepoRemoved},
+	}
+	if diff := cmp.Diff(want, diffActionRuns(previous, latest)); diff != "" {
+		t.Errorf("unexpected changes (-want +have):\n%s", diff)
+	}
+}
+
+func TestRecordActionRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "action-runs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	first := actionRun{Time: time.Date(2020, 7, 1, 12, 0, 0, 0, time.UTC), Patches: []actionRunPatch{{Repository: "github.com/a"}}}
+	second := actionRun{Time: time.Date(2020, 7, 1, 13, 0, 0, 0, time.UTC), Patches: []actionRunPatch{{Repository: "github.com/b"}}}
+	for _, run := range []actionRun{first, second} {
+		if err := recordActionRun(dir, run); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for name, want := range map[string]actionRun{latestRunFile: second, previousRunFile: first} {
+		have, err := readActionRun(dir, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have == nil {
+			t.Fatalf("no run recorded in %s", name)
+		}
+		if diff := cmp.Diff(want, *have); diff != "" {
+			t.Errorf("unexpected run in %s (-want +have):\n%s", name, diff)
+		}
+	}
+}
+
+func TestRecordExecution(t *testing.T) {
+	cacheDir, err := ioutil.TempDir("", "action-runs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(cacheDir) })
+
+	var (
+		a = campaigns.ActionRepo{ID: "UmVwbzox", Name: "github.com/a", BaseRef: "refs/heads/master"}
+		b = campaigns.ActionRepo{ID: "UmVwbzoy", Name: "github.com/b", BaseRef: "refs/heads/main"}
+		c = campaigns.ActionRepo{ID: "UmVwbzoz", Name: "github.com/c", BaseRef: "refs/heads/master"}
+	)
+	entries := []campaigns.MatrixEntry{{}}
+	executed := [][]campaigns.ActionRepo{{a, b, c}}
+	failed := [][]campaigns.ActionRepo{{c}}
+	const patch = "diff --git a/README.md b/README.md\n+new\n"
+	patches := [][]campaigns.PatchInput{{{Repository: a.ID, BaseRef: a.BaseRef, Patch: patch}}}
+	if err := recordExecution(cacheDir, "action.yml", "run", entries, executed, failed, patches); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := actionRunsDir(cacheDir, "action.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	run, err := readActionRun(dir, latestRunFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run == nil {
+		t.Fatal("no run recorded")
+	}
+	want := []actionRunPatch{
+		{Repository: "github.com/a", BaseRef: "refs/heads/master", Files: map[string]string{"README.md": hashString(patch)}},
+		{Repository: "github.com/b", BaseRef: "refs/heads/main"},
+		{Repository: "github.com/c", BaseRef: "refs/heads/master", Failed: true},
+	}
+	if diff := cmp.Diff(want, run.Patches); diff != "" {
+		t.Errorf("unexpected patches (-want +have):\n%s", diff)
+	}
+}
+
+func TestReadActionRunConvertsPatches(t *testing.T) {
+	dir, err := ioutil.TempDir("", "action-runs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	// Earlier versions recorded the whole patches.
+	const record = `{"time":"2020-07-01T12:00:00Z","patches":[{"repository":"github.com/a","baseRef":"refs/heads/master","patch":"diff --git a/README.md b/README.md\n+new\n"}]}`
+	if err := ioutil.WriteFile(filepath.Join(dir, latestRunFile), []byte(record), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	run, err := readActionRun(dir, latestRunFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []actionRunPatch{
+		{Repository: "github.com/a", BaseRef: "refs/heads/master", Files: map[string]string{"README.md": hashString("diff --git a/README.md b/README.md\n+new\n")}},
+	}
+	if diff := cmp.Diff(want, run.Patches); diff != "" {
+		t.Errorf("unexpected patches (-want +have):\n%s", diff)
+	}
+}
+
+func hashString(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
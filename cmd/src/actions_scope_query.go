@@ -4,9 +4,13 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
 
 	"github.com/ghodss/yaml"
 	"github.com/pkg/errors"
@@ -24,6 +28,38 @@ Examples:
 
 		$ src actions scope-query -f ~/run-gofmt-in-dockerfile.json
 
+  Also list the repositories that are matched but excluded, and why:
+
+		$ src actions scope-query -f ~/run-gofmt-in-dockerfile.json -show-excluded
+
+  Show the base branch of every repository and whether 'src actions exec' has a cached result for it:
+
+		$ src actions scope-query -f ~/run-gofmt-in-dockerfile.json -check-cache -format '{{.Name}} {{.BaseRef}}{{if .Cached}} (cached){{end}}'
+
+  List the repositories matched by all action files in a directory, each only once, followed by the number of repositories per file on standard error:
+
+		$ src actions scope-query -f 'campaigns/*.yaml'
+
+  Show which of the action files match each repository:
+
+		$ src actions scope-query -f 'campaigns/*.yaml' -format '{{.Name}}: {{join .Files ", "}}'
+
+  Validate the action definition and print the search query that would be run, without connecting to Sourcegraph:
+
+		$ src actions scope-query -f ~/run-gofmt-in-dockerfile.json -offline
+
+  The template given with -format or -template-file is executed once per repository, with the following fields:
+
+		ID, Name       The ID and name of the repository.
+		BaseRef, Rev   The branch and revision the action would be executed on.
+		ServiceType    The type of the code host of the repository, e.g. "github". Not set for excluded repositories.
+		Excluded       Whether the repository is excluded. Only true with -show-excluded.
+		ExcludeReason  Why the repository is excluded.
+		Cached         Whether a cached result exists (for all matrix entries, if the action has a matrix). Only set with -check-cache.
+		Files          The action files whose scopeQuery matches the repository.
+		SearchResultPaths
+		               The paths of the files in the repository matched by the scopeQuery, if any.
+
 `
 
 	flagSet := flag.NewFlagSet("scope-query", flag.ExitOnError)
@@ -33,11 +69,27 @@ Examples:
 		fmt.Println(usage)
 	}
 
+	cacheDir, displayUserCacheDir := defaultActionCacheDir()
+
 	var (
-		fileFlag               = flagSet.String("f", "-", "The action file. If not given or '-' standard input is used. (Required)")
-		includeUnsupportedFlag = flagSet.Bool("include-unsupported", false, "When specified, also repos from unsupported codehosts are processed. Those can be created once the integration is done.")
+		fileFlags              actionFilesFlag
+		varsFlags              = newActionVarsFlags(flagSet)
+		allowUnsupportedFlag   = flagSet.String("allow-unsupported", "", `What to do with repositories on code hosts not supported by campaigns: "skip" them, fail with an "error" or "include" them to generate patches that can only be imported. Overrides "allowUnsupported" in the action definition (default "skip").`)
+		includeUnsupportedFlag = flagSet.Bool("include-unsupported", false, "Deprecated: use -allow-unsupported include.")
+		failOnPartialFlag      = flagSet.Bool("fail-on-partial", false, "Fail if the results of the scopeQuery are incomplete, e.g. because the search timed out or repositories are still cloning, instead of only warning about it.")
+		allowTruncatedFlag     = flagSet.Bool("allow-truncated", false, "Only warn instead of failing if the search for the scopeQuery hit the result limit of the Sourcegraph instance, so that not all matching repositories were returned.")
+		showExcludedFlag       = flagSet.Bool("show-excluded", false, "Also list repositories that are matched by the scopeQuery but excluded, e.g. because they are on an unsupported codehost.")
+		checkCacheFlag         = flagSet.Bool("check-cache", false, "Check whether 'src actions exec' has a cached result for each repository. This requires Docker images used by the action to be pulled.")
+		cacheDirFlag           = flagSet.String("cache", displayUserCacheDir, "Directory for cached results, used by -check-cache, and cached repositories.")
+		reposCacheTTLFlag      = flagSet.Duration("repos-cache-ttl", 0, "How long the repositories matched by the scopeQuery are cached in the -cache directory, like 'src actions exec -repos-cache-ttl'. By default, nothing is cached.")
+		refreshReposFlag       = flagSet.Bool("refresh-repos", false, "Search the repositories matched by the scopeQuery again instead of using cached ones.")
+		formatFlag             = flagSet.String("format", "{{.Name}}{{if .Excluded}} (excluded: {{.ExcludeReason}}){{end}}", "Format for each repository, using the syntax of Go package text/template.")
+		templateFileFlag       = flagSet.String("template-file", "", templateFileFlagUsage)
+		cacheKeyFlags          = newActionCacheKeyFlags(flagSet)
+		offlineFlag            = flagSet.Bool("offline", false, "Do not connect to Sourcegraph: validate the action definition like 'src actions validate' and print the search query that would be run to resolve the repositories instead of running it.")
 		apiFlags               = api.NewFlags(flagSet)
 	)
+	flagSet.Var(&fileFlags, "f", "The action file. If not given or '-' standard input is used. Can be repeated and can be a glob pattern, e.g. 'campaigns/*.yaml', to list the repositories matched by several action files.")
 
 	handler := func(args []string) error {
 		err := flagSet.Parse(args)
@@ -45,51 +97,176 @@ Examples:
 			return err
 		}
 
-		// Read action file content.
-		var actionFile []byte
-		if *fileFlag == "-" {
-			actionFile, err = ioutil.ReadAll(os.Stdin)
-		} else {
-			actionFile, err = ioutil.ReadFile(*fileFlag)
+		files, err := expandActionFiles(fileFlags)
+		if err != nil {
+			return err
 		}
+		vars, err := varsFlags.vars()
 		if err != nil {
 			return err
 		}
 
-		// Convert action file to JSON, if it was yaml.
-		jsonActionFile, err := yaml.YAMLToJSONStrict(actionFile)
-		if err != nil {
-			return errors.Wrap(err, "unable to parse action file")
+		if *offlineFlag {
+			if *checkCacheFlag || *showExcludedFlag {
+				return &usageError{errors.New("-check-cache and -show-excluded can't be used with -offline")}
+			}
+			for _, file := range files {
+				action, err := readActionOffline(file, vars)
+				if err != nil {
+					return err
+				}
+				// The version of the Sourcegraph instance is unknown offline.
+				query := actionSearchQuery(action.ScopeQuery, false)
+				if len(files) > 1 {
+					query = file + ": " + query
+				}
+				fmt.Println(query)
+			}
+			return nil
 		}
 
-		err = campaigns.ValidateActionDefinition(jsonActionFile)
+		tmpl, err := parseTemplateOrFile(*formatFlag, *templateFileFlag)
+		if err != nil {
+			return err
+		}
+		hooks, err := cacheKeyFlags.hooks()
 		if err != nil {
 			return err
 		}
 
-		var action campaigns.Action
-		if err := jsonxUnmarshal(string(jsonActionFile), &action); err != nil {
-			return errors.Wrap(err, "invalid JSON action file")
+		if *cacheDirFlag == displayUserCacheDir {
+			*cacheDirFlag = cacheDir
 		}
 
 		ctx := context.Background()
 		client := cfg.apiClient(apiFlags, flagSet.Output())
+		logger := campaigns.NewActionLogger(*verbose, false, *quiet)
+		reposCache := &reposCache{Dir: *cacheDirFlag, TTL: *reposCacheTTLFlag, Refresh: *refreshReposFlag}
+
+		// The repositories matched by several action files are listed once.
+		var (
+			matched       []*scopeQueryRepo
+			matchedByKey  = map[campaigns.ActionRepo]*scopeQueryRepo{}
+			excluded      []*scopeQueryRepo
+			excludedByKey = map[excludedRepo]*scopeQueryRepo{}
+			counts        = make([]int, len(files))
+		)
+		for i, file := range files {
+			action, err := readScopeQueryAction(file, vars)
+			if err != nil {
+				return err
+			}
+
+			unsupported, err := unsupportedMode(*allowUnsupportedFlag, *includeUnsupportedFlag, action)
+			if err != nil {
+				return err
+			}
+
+			if *verbose {
+				log.Printf("# scopeQuery in action definition %s: %s\n", file, action.ScopeQuery)
+
+				if unsupported == unsupportedInclude {
+					log.Printf("# Including repositories on unsupported codehost.\n")
+				}
+			}
+
+			reposByRev, fileExcluded, err := actionReposByRevision(ctx, client, action.ScopeQuery, unsupported, *failOnPartialFlag, *allowTruncatedFlag, reposCache, logger)
+			if err != nil {
+				if len(files) > 1 {
+					log.Printf("# Resolving the repositories of %s failed.\n", file)
+				}
+				return err
+			}
+			if action.RequireFileMatches {
+				var noMatches []excludedRepo
+				reposByRev, noMatches = requireFileMatches(reposByRev)
+				fileExcluded = append(fileExcluded, noMatches...)
+			}
+			repos := allRevisionRepos(reposByRev)
+			counts[i] = len(repos)
+
+			var cache campaigns.ExecutionCache = campaigns.ExecutionNoOpCache{}
+			var actions []campaigns.Action
+			if *checkCacheFlag {
+				for _, entry := range action.MatrixEntries() {
+					a, err := action.WithMatrix(entry)
+					if err != nil {
+						return &exitCodeError{error: err, exitCode: exitCodeValidation}
+					}
+					// The cache key includes the Docker image digests.
+					if err := campaigns.PrepareAction(ctx, a, logger); err != nil {
+						return errors.Wrap(err, "Failed to prepare action")
+					}
+					actions = append(actions, a)
+				}
+				cache = campaigns.ExecutionDiskCache{Dir: *cacheDirFlag}
+			}
 
-		if *verbose {
-			log.Printf("# scopeQuery in action definition: %s\n", action.ScopeQuery)
+			for _, repo := range repos {
+				// With a matrix, a repository only counts as cached if the
+				// results for all matrix entries are cached.
+				cached := len(actions) > 0
+				for _, a := range actions {
+					_, ok, err := cache.Get(ctx, cacheKeyFlags.cacheKey(repo, a, hooks))
+					if err != nil {
+						return errors.Wrapf(err, "checking cache for %s", repo.Name)
+					}
+					cached = cached && ok
+				}
+				// The files matched by the scopeQueries of several action
+				// files are merged.
+				key := repo
+				key.SearchResultPaths = ""
+				m, ok := matchedByKey[key]
+				if !ok {
+					m = &scopeQueryRepo{
+						ID:      repo.ID,
+						Name:    repo.Name,
+						BaseRef: repo.BaseRef,
+						Rev:     repo.Rev,
+						Cached:  true,
+
+						ServiceType: repo.ExternalServiceType,
+					}
+					matchedByKey[key] = m
+					matched = append(matched, m)
+				}
+				if paths := repo.SearchResultPathList(); len(paths) > 0 {
+					m.SearchResultPaths = strings.Split(searchResultPaths(append(m.SearchResultPaths, paths...)), "\n")
+				}
+				// With several action files, a repository only counts as
+				// cached if the results for all of them are cached.
+				m.Cached = m.Cached && cached
+				m.Files = append(m.Files, file)
+			}
 
-			if *includeUnsupportedFlag {
-				log.Printf("# Including repositories on unsupported codehost.\n")
+			for _, repo := range fileExcluded {
+				e, ok := excludedByKey[repo]
+				if !ok {
+					e = &scopeQueryRepo{Name: repo.Name, Excluded: true, ExcludeReason: repo.Reason}
+					excludedByKey[repo] = e
+					excluded = append(excluded, e)
+				}
+				e.Files = append(e.Files, file)
 			}
 		}
 
-		logger := campaigns.NewActionLogger(*verbose, false)
-		repos, err := actionRepos(ctx, client, action.ScopeQuery, *includeUnsupportedFlag, logger)
-		if err != nil {
-			return err
+		for _, repo := range matched {
+			if err := execTemplate(tmpl, repo); err != nil {
+				return err
+			}
 		}
-		for _, repo := range repos {
-			fmt.Println(repo.Name)
+
+		if *showExcludedFlag {
+			for _, repo := range excluded {
+				if err := execTemplate(tmpl, repo); err != nil {
+					return err
+				}
+			}
+		}
+
+		if len(files) > 1 && !*quiet {
+			writeScopeQueryBreakdown(os.Stderr, files, counts, len(matched))
 		}
 
 		return nil
@@ -102,3 +279,120 @@ Examples:
 		usageFunc: usageFunc,
 	})
 }
+
+// scopeQueryRepo is the data passed to the template of 'src actions
+// scope-query' for each repository.
+type scopeQueryRepo struct {
+	ID, Name      string
+	BaseRef, Rev  string
+	ServiceType   string
+	Excluded      bool
+	ExcludeReason string
+	Cached        bool
+	Files         []string
+
+	SearchResultPaths []string
+}
+
+// readScopeQueryAction reads and validates the action definition in path, or
+// standard input if path is "-", after replacing its variables with the
+// values in vars.
+func readScopeQueryAction(path string, vars campaigns.Vars) (campaigns.Action, error) {
+	var (
+		actionFile []byte
+		err        error
+	)
+	if path == "-" {
+		actionFile, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		actionFile, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return campaigns.Action{}, err
+	}
+
+	// Convert action file to JSON, if it was yaml.
+	jsonActionFile, err := yaml.YAMLToJSONStrict(actionFile)
+	if err != nil {
+		return campaigns.Action{}, errors.Wrapf(err, "unable to parse action file %s", path)
+	}
+
+	jsonActionFile, sources, err := campaigns.ComposeActionDefinition(path, jsonActionFile)
+	if err != nil {
+		return campaigns.Action{}, &exitCodeError{error: errors.Wrap(err, "resolving extends"), exitCode: exitCodeValidation}
+	}
+
+	if jsonActionFile, err = campaigns.ExpandVars(jsonActionFile, vars); err != nil {
+		return campaigns.Action{}, &exitCodeError{error: err, exitCode: exitCodeValidation}
+	}
+
+	err = campaigns.ValidateActionDefinition(jsonActionFile)
+	if err != nil {
+		if len(sources) > 1 {
+			err = errors.Wrapf(err, "action definition composed from %s", strings.Join(sources, ", "))
+		}
+		return campaigns.Action{}, &exitCodeError{error: err, exitCode: exitCodeValidation}
+	}
+
+	var action campaigns.Action
+	if err := jsonxUnmarshal(string(jsonActionFile), &action); err != nil {
+		return campaigns.Action{}, errors.Wrapf(err, "invalid JSON action file %s", path)
+	}
+	return action, nil
+}
+
+// actionFilesFlag collects the values of repeated -f flags.
+type actionFilesFlag []string
+
+func (f *actionFilesFlag) String() string { return strings.Join(*f, ", ") }
+
+func (f *actionFilesFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// expandActionFiles returns the action files given with -f, with glob patterns
+// replaced by the files they match, in order and without duplicates. It
+// returns standard input, "-", if none are given.
+func expandActionFiles(patterns []string) ([]string, error) {
+	if len(patterns) == 0 {
+		return []string{"-"}, nil
+	}
+	var files []string
+	seen := map[string]bool{}
+	for _, pattern := range patterns {
+		matches := []string{pattern}
+		if pattern != "-" && strings.ContainsAny(pattern, "*?[") {
+			var err error
+			if matches, err = filepath.Glob(pattern); err != nil {
+				return nil, &usageError{fmt.Errorf("invalid -f pattern %q: %s", pattern, err)}
+			}
+			if len(matches) == 0 {
+				return nil, &usageError{fmt.Errorf("-f pattern %q matches no files", pattern)}
+			}
+		}
+		for _, file := range matches {
+			if !seen[file] {
+				seen[file] = true
+				files = append(files, file)
+			}
+		}
+	}
+	if seen["-"] && len(files) > 1 {
+		return nil, &usageError{errors.New("standard input, -f -, can't be combined with other action files")}
+	}
+	return files, nil
+}
+
+// writeScopeQueryBreakdown writes the number of repositories matched by each
+// of the action files and the number of distinct repositories matched by all
+// of them.
+func writeScopeQueryBreakdown(w io.Writer, files []string, counts []int, total int) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw)
+	for i, file := range files {
+		fmt.Fprintf(tw, "%s\t%d repositories\n", file, counts[i])
+	}
+	fmt.Fprintf(tw, "Total\t%d distinct repositories\n", total)
+	tw.Flush()
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestExpandActionFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scope-query-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	for _, name := range []string{"a.yaml", "b.yaml", "c.json"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	for name, tc := range map[string]struct {
+		patterns []string
+		want     []string
+		wantErr  bool
+	}{
+		"none":                    {patterns: nil, want: []string{"-"}},
+		"standard input":          {patterns: []string{"-"}, want: []string{"-"}},
+		"file":                    {patterns: []string{path("c.json")}, want: []string{path("c.json")}},
+		"glob":                    {patterns: []string{path("*.yaml")}, want: []string{path("a.yaml"), path("b.yaml")}},
+		"duplicates":              {patterns: []string{path("b.yaml"), path("*.yaml")}, want: []string{path("b.yaml"), path("a.yaml")}},
+		"no match":                {patterns: []string{path("*.yml")}, wantErr: true},
+		"invalid pattern":         {patterns: []string{path("[")}, wantErr: true},
+		"standard input and file": {patterns: []string{"-", path("c.json")}, wantErr: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			have, err := expandActionFiles(tc.patterns)
+			if tc.wantErr != (err != nil) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, have); diff != "" {
+				t.Errorf("unexpected files (-want +have):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/fatih/color"
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/src-cli/internal/campaigns"
+	"github.com/sourcegraph/src-cli/internal/output"
+)
+
+func init() {
+	usage := `
+Run the steps of an action on a local directory, e.g. a checked-out repository, and print the resulting diff. Nothing is fetched from or sent to a Sourcegraph instance and the scopeQuery is ignored, so this is a quick way to iterate on the steps of an action before executing it with 'src actions exec'.
+
+The steps are run on a copy of the directory, which is not modified. The .git directory is not copied, but uncommitted changes are.
+
+If the action has a matrix, the steps are run once for each combination of its values.
+
+Examples:
+
+  Test the steps of action.yml on the current directory:
+
+		$ src actions test-step -f action.yml
+
+  Test them on another checkout and show the output of the steps:
+
+		$ src -v actions test-step -f action.yml -dir ~/src/my-repo
+
+  Apply the resulting diff to the checkout to inspect it:
+
+		$ src actions test-step -f action.yml | git apply
+
+`
+
+	flagSet := flag.NewFlagSet("test-step", flag.ExitOnError)
+	usageFunc := func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'src actions %s':\n", flagSet.Name())
+		flagSet.PrintDefaults()
+		fmt.Println(usage)
+	}
+
+	var (
+		fileFlag            = flagSet.String("f", "-", "The action file. If not given or '-' standard input is used. (Required)")
+		varsFlags           = newActionVarsFlags(flagSet)
+		dirFlag             = flagSet.String("dir", ".", "The directory to run the steps on.")
+		timeoutFlag         = flagSet.Duration("timeout", defaultTimeout, "The maximum duration running the steps can take.")
+		keepLogsFlag        = flagSet.Bool("keep-logs", false, "Do not remove the execution log file when done.")
+		logTimestampsFlag   = flagSet.String("log-timestamps", campaigns.LogTimestampsAbsolute, `How lines in the execution log file are timestamped: "absolute", "relative" to the start of the execution or "none", like 'src actions exec -log-timestamps'.`)
+		singleContainerFlag = flagSet.Bool("single-container", false, "Execute all docker steps in a single container, like 'src actions exec -single-container'.")
+		skipSymlinksFlag    = flagSet.Bool("skip-symlinks", false, "Skip symbolic links contained in the directory instead of copying them.")
+		secretsFileFlag     = flagSet.String("secrets-file", "", "A YAML or JSON file with the values of the secrets the steps refer to, like 'src actions exec -secrets-file'.")
+	)
+
+	handler := func(args []string) error {
+		if err := flagSet.Parse(args); err != nil {
+			return err
+		}
+		if flagSet.NArg() != 0 {
+			return &usageError{errors.New("unexpected arguments")}
+		}
+
+		if info, err := os.Stat(*dirFlag); err != nil {
+			return err
+		} else if !info.IsDir() {
+			return &usageError{fmt.Errorf("%s is not a directory", *dirFlag)}
+		}
+
+		vars, err := varsFlags.vars()
+		if err != nil {
+			return err
+		}
+		action, err := readActionOffline(*fileFlag, vars)
+		if err != nil {
+			return err
+		}
+		secrets, err := readActionSecrets(*secretsFileFlag, *action)
+		if err != nil {
+			return err
+		}
+
+		entries := action.MatrixEntries()
+		actions := make([]campaigns.Action, len(entries))
+		for i, entry := range entries {
+			if actions[i], err = action.WithMatrix(entry); err != nil {
+				return &exitCodeError{error: err, exitCode: exitCodeValidation}
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), *timeoutFlag)
+		defer cancel()
+
+		logger := campaigns.NewActionLogger(*verbose, *keepLogsFlag, *quiet)
+		if err := logger.SetLogTimestamps(*logTimestampsFlag); err != nil {
+			return &usageError{err}
+		}
+		for _, a := range actions {
+			if err := campaigns.PrepareAction(ctx, a, logger); err != nil {
+				return errors.Wrap(err, "Failed to prepare action")
+			}
+			if *singleContainerFlag {
+				if err := campaigns.ValidateSingleContainer(a); err != nil {
+					return &exitCodeError{error: err, exitCode: exitCodeValidation}
+				}
+			}
+		}
+
+		for i, a := range actions {
+			if len(action.Matrix) > 0 {
+				color.New(color.FgYellow).Fprintf(os.Stderr, "%s  Matrix entry %s\n", output.Emoji(output.EmojiArrow), entries[i])
+			}
+
+			diff, err := campaigns.RunActionLocally(ctx, *dirFlag, a, secrets, *skipSymlinksFlag, *singleContainerFlag, logger)
+			if err != nil {
+				if ctx.Err() == context.DeadlineExceeded {
+					return errors.Wrapf(err, "the timeout of %s was exceeded", *timeoutFlag)
+				}
+				return err
+			}
+			if len(diff) == 0 {
+				color.New(color.FgHiBlack).Fprintln(os.Stderr, "The steps did not change any files.")
+				continue
+			}
+			if _, err := os.Stdout.Write(diff); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// Register the command.
+	actionsCommands = append(actionsCommands, &command{
+		flagSet:   flagSet,
+		handler:   handler,
+		usageFunc: usageFunc,
+	})
+}
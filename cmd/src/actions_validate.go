@@ -0,0 +1,136 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/sourcegraph/src-cli/internal/campaigns"
+	"github.com/sourcegraph/src-cli/internal/output"
+)
+
+func init() {
+	usage := `
+Validate an action definition without connecting to a Sourcegraph instance or using Docker. This makes it possible to lint action definitions, e.g. in a pre-commit hook, where no access token is available.
+
+The following is validated:
+
+	- that the action definition is valid YAML or JSON and matches the schema, after composing it with the definitions it extends
+	- that every ${{ vars.NAME }} placeholder refers to a variable given with -var-file or -var
+	- that every ${{ matrix.KEY }} placeholder refers to a key in the matrix
+	- that the images of "docker" steps are valid image references, for every matrix entry
+	- that the build contexts of "docker" steps contain a Dockerfile
+
+The images are not pulled and the scopeQuery is not run. Use 'src actions scope-query' to list the repositories the scopeQuery matches.
+
+Examples:
+
+  Validate the action definition in ~/run-gofmt-in-dockerfile.json:
+
+		$ src actions validate -f ~/run-gofmt-in-dockerfile.json
+
+  Validate all action definitions in the current directory:
+
+		$ for f in *.action.yml; do src actions validate -f "$f" || exit 1; done
+
+`
+
+	flagSet := flag.NewFlagSet("validate", flag.ExitOnError)
+	usageFunc := func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'src actions %s':\n", flagSet.Name())
+		flagSet.PrintDefaults()
+		fmt.Println(usage)
+	}
+
+	var (
+		fileFlag  = flagSet.String("f", "-", "The action file. If not given or '-' standard input is used. (Required)")
+		varsFlags = newActionVarsFlags(flagSet)
+	)
+
+	handler := func(args []string) error {
+		if err := flagSet.Parse(args); err != nil {
+			return err
+		}
+
+		vars, err := varsFlags.vars()
+		if err != nil {
+			return err
+		}
+		if _, err := readActionOffline(*fileFlag, vars); err != nil {
+			return err
+		}
+
+		if !*quiet {
+			fmt.Printf("%s  %s is valid\n", output.Emoji(output.EmojiSuccess), *fileFlag)
+		}
+		return nil
+	}
+
+	// Register the command.
+	actionsCommands = append(actionsCommands, &command{
+		flagSet:   flagSet,
+		handler:   handler,
+		usageFunc: usageFunc,
+	})
+}
+
+// readActionOffline reads the action definition in path, or standard input if
+// path is "-", and validates it as far as possible without using the network
+// or Docker, after replacing its variables with the values in vars.
+// Validation errors are returned as an exitCodeError.
+func readActionOffline(path string, vars campaigns.Vars) (*campaigns.Action, error) {
+	var (
+		actionFile []byte
+		err        error
+	)
+	if path == "-" {
+		actionFile, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		actionFile, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	action, err := campaigns.ParseActionWithVars(path, actionFile, vars)
+	if err != nil {
+		return nil, &exitCodeError{error: err, exitCode: exitCodeValidation}
+	}
+	return &action, nil
+}
+
+// actionVarsFlags are the flags that set the variables of action
+// definitions, which they refer to with ${{ vars.NAME }}.
+type actionVarsFlags struct {
+	file      *string
+	overrides varsFlag
+}
+
+// varsFlag collects the NAME=VALUE pairs of repeated -var flags.
+type varsFlag struct{ campaigns.Vars }
+
+func (f varsFlag) String() string { return "" }
+
+// newActionVarsFlags adds the flags of an actionVarsFlags to flagSet.
+func newActionVarsFlags(flagSet *flag.FlagSet) *actionVarsFlags {
+	f := &actionVarsFlags{overrides: varsFlag{campaigns.Vars{}}}
+	f.file = flagSet.String("var-file", "", "A YAML or JSON file with the values of the variables the action definition refers to with ${{ vars.NAME }}. Nested objects define variables with dotted names, e.g. ${{ vars.team.name }}.")
+	flagSet.Var(f.overrides, "var", "Set the variable NAME of the action definition to VALUE, given as NAME=VALUE, overriding the value in -var-file. Can be repeated.")
+	return f
+}
+
+// vars returns the variables read from -var-file, overridden by -var.
+func (f *actionVarsFlags) vars() (campaigns.Vars, error) {
+	vars := campaigns.Vars{}
+	if *f.file != "" {
+		var err error
+		if vars, err = campaigns.ReadVarsFile(*f.file); err != nil {
+			return nil, err
+		}
+	}
+	for name, value := range f.overrides.Vars {
+		vars[name] = value
+	}
+	return vars, nil
+}
@@ -40,6 +40,14 @@ Examples:
   Get the curl command for a query (just add '-get-curl' in the flags section):
 
     	$ src api -get-curl -query='query { currentUser { username } }'
+
+  Print the GraphQL operation a command executes, as JSON, without executing it ('-explain' works with every command that sends requests):
+
+    	$ src campaigns list -explain
+
+  Validate query files against the schema of the instance (see 'src api lint -h'):
+
+    	$ src api lint queries/*.graphql
 `
 
 	flagSet := flag.NewFlagSet("api", flag.ExitOnError)
@@ -55,6 +63,10 @@ Examples:
 	)
 
 	handler := func(args []string) error {
+		if len(args) > 0 && args[0] == "lint" {
+			return runAPILint(args[1:])
+		}
+
 		err := flagSet.Parse(args)
 		if err != nil {
 			return err
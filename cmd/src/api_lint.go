@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/src-cli/internal/api"
+	"github.com/sourcegraph/src-cli/internal/graphql"
+)
+
+const apiLintUsage = `
+Validates GraphQL query files against the schema of the Sourcegraph instance, which is obtained through
+introspection, so that queries that would fail after an upgrade are found before they are run, e.g. in CI.
+Each problem is printed as FILE:LINE:COLUMN: MESSAGE.
+
+Documents are validated with the rules of the GraphQL specification, e.g. unknown types, fields and
+arguments, missing required arguments, values of the wrong type, and undefined or unused variables and
+fragments are reported.
+
+-self validates the queries src defines as package-level constants. Queries that are written inside the
+functions that send them, or assembled at runtime, are not validated.
+
+Examples:
+
+  Validate query files:
+
+    	$ src api lint queries/*.graphql
+
+  Validate the queries src itself sends:
+
+    	$ src api lint -self
+
+  Validate against a saved schema instead of the instance, e.g. the schema of the version to upgrade to:
+
+    	$ src api lint -save-schema schema.json
+    	$ src api lint -schema schema.json queries/*.graphql
+
+`
+
+// runAPILint runs 'src api lint' with the given arguments.
+func runAPILint(args []string) error {
+	flagSet := flag.NewFlagSet("lint", flag.ExitOnError)
+	flagSet.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'src api lint':\n")
+		flagSet.PrintDefaults()
+		fmt.Print(apiLintUsage)
+	}
+	var (
+		schemaFlag     = flagSet.String("schema", "", "Read the schema from this file, the JSON result of an introspection query, instead of the instance.")
+		saveSchemaFlag = flagSet.String("save-schema", "", "Write the schema of the instance to this file, e.g. to use it with -schema later.")
+		selfFlag       = flagSet.Bool("self", false, "Validate the queries src itself defines as package-level constants. Queries written inside functions are not validated.")
+		apiFlags       = api.NewFlags(flagSet)
+	)
+	flagSet.Parse(args)
+
+	if *schemaFlag != "" && *saveSchemaFlag != "" {
+		return &usageError{errors.New("-schema conflicts with -save-schema")}
+	}
+	if flagSet.NArg() == 0 && !*selfFlag && *saveSchemaFlag == "" {
+		return &usageError{errors.New("expected query files to validate, or -self")}
+	}
+
+	var data []byte
+	var err error
+	if *schemaFlag != "" {
+		data, err = ioutil.ReadFile(*schemaFlag)
+	} else {
+		data, err = fetchGraphQLSchema(context.Background(), cfg.apiClient(apiFlags, flagSet.Output()))
+	}
+	if err != nil || data == nil {
+		return err
+	}
+	if *saveSchemaFlag != "" {
+		if err := ioutil.WriteFile(*saveSchemaFlag, data, 0644); err != nil {
+			return err
+		}
+	}
+	schema, err := graphql.ParseSchema(data)
+	if err != nil {
+		return err
+	}
+
+	documents := map[string]string{}
+	var names []string
+	for _, path := range flagSet.Args() {
+		var content []byte
+		if path == "-" {
+			content, err = ioutil.ReadAll(os.Stdin)
+		} else {
+			content, err = ioutil.ReadFile(path)
+		}
+		if err != nil {
+			return err
+		}
+		documents[path] = string(content)
+		names = append(names, path)
+	}
+	if *selfFlag {
+		var self []string
+		for name, query := range selfLintQueries() {
+			documents["src:"+name] = query
+			self = append(self, "src:"+name)
+		}
+		sort.Strings(self)
+		names = append(names, self...)
+	}
+
+	problems := 0
+	for _, name := range names {
+		problems += lintGraphQLDocument(os.Stdout, name, documents[name], schema)
+	}
+	if problems > 0 {
+		return &exitCodeError{error: fmt.Errorf("%d problems found in %d documents", problems, len(names)), exitCode: exitCodeValidation}
+	}
+	return nil
+}
+
+// fetchGraphQLSchema returns the JSON result of the introspection query. It
+// returns nil if the request returned GraphQL errors, which have already been
+// printed.
+func fetchGraphQLSchema(ctx context.Context, client api.Client) ([]byte, error) {
+	var result json.RawMessage
+	if ok, err := client.NewQuery(graphql.IntrospectionQuery).Do(ctx, &result); err != nil || !ok {
+		return nil, errors.Wrap(err, "fetching the GraphQL schema")
+	}
+	return result, nil
+}
+
+// lintGraphQLDocument validates the document against the schema, writes the
+// problems found to w and returns their number.
+func lintGraphQLDocument(w io.Writer, name, document string, schema *graphql.Schema) int {
+	errs := graphql.Validate(schema, document)
+	for _, err := range errs {
+		fmt.Fprintf(w, "%s:%s\n", name, err)
+	}
+	return len(errs)
+}
+
+// selfLintQueries returns the queries of src that are defined as
+// package-level constants, with the fragments they are sent with, keyed by
+// the name of the constant. The queries most commands write inside the
+// functions that send them aren't included; TestSelfLintQueries checks that
+// no constant is missing.
+func selfLintQueries() map[string]string {
+	return map[string]string{
+		"addChangesetsQuery":             addChangesetsQuery,
+		"batchSearchGraphQLQuery":        batchSearchGraphQLQuery,
+		"codeHostConnectionQuery":        codeHostConnectionQuery,
+		"createChangesetsQuery":          createChangesetsQuery,
+		"createPatchSetMutation":         createPatchSetMutation + patchSetFragment(1),
+		"createcampaignMutation":         campaignFragment + createcampaignMutation,
+		"externalServicesListQuery":      externalServicesListQuery,
+		"externalServicesUpdateMutation": externalServicesUpdateMutation,
+		"getRepoIDQuery":                 getRepoIDQuery,
+		"openChangesetsQuery":            openChangesetsQuery,
+		"repoAuthorizedUsersQuery":       repoAuthorizedUsersQuery,
+		"repoTextSearchIndexQuery":       repoTextSearchIndexQuery,
+		"reposCloneStatusQuery":          reposCloneStatusQuery,
+		"resolveImportedPatchQuery":      resolveImportedPatchQuery,
+		"settingsSubjectCascadeQuery":    settingsSubjectCascadeQuery,
+		"sourcegraphVersionQuery":        sourcegraphVersionQuery,
+		"updateCampaignMutation":         campaignFragment + updateCampaignMutation,
+		"viewerSettingsQuery":            viewerSettingsQuery,
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	gotoken "go/token"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	gqlast "github.com/vektah/gqlparser/v2/ast"
+	gqlparser "github.com/vektah/gqlparser/v2/parser"
+)
+
+// TestSelfLintQueries checks that selfLintQueries contains every query
+// constant of the package, and that the query literals written inside
+// functions, which -self can't validate, at least parse. Queries assembled at
+// runtime are skipped.
+func TestSelfLintQueries(t *testing.T) {
+	paths, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	self := selfLintQueries()
+	fset := gotoken.NewFileSet()
+	for _, path := range paths {
+		if strings.HasSuffix(path, "_test.go") {
+			continue
+		}
+		file, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, decl := range file.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != gotoken.CONST {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				spec := spec.(*ast.ValueSpec)
+				for i, value := range spec.Values {
+					if _, ok := graphQLOperation(value); !ok {
+						continue
+					}
+					if name := spec.Names[i].Name; self[name] == "" {
+						t.Errorf("%s: query constant %s is missing from selfLintQueries", fset.Position(value.Pos()), name)
+					}
+				}
+			}
+		}
+
+		ast.Inspect(file, func(node ast.Node) bool {
+			switch node := node.(type) {
+			case *ast.BinaryExpr:
+				// Parts of queries that are concatenated at runtime.
+				return false
+			case *ast.CallExpr:
+				if sel, ok := node.Fun.(*ast.SelectorExpr); ok && (sel.Sel.Name == "Sprintf" || sel.Sel.Name == "WriteString") {
+					return false
+				}
+			}
+			expr, ok := node.(ast.Expr)
+			if !ok {
+				return true
+			}
+			if query, ok := graphQLOperation(expr); ok {
+				if _, err := gqlparser.ParseQuery(&gqlast.Source{Input: query}); err != nil {
+					t.Errorf("%s: query doesn't parse: %s", fset.Position(expr.Pos()), err)
+				}
+			}
+			return true
+		})
+	}
+}
+
+// graphQLOperation returns the value of the expression if it is a string
+// literal that starts with a query or mutation.
+func graphQLOperation(expr ast.Expr) (string, bool) {
+	lit, ok := expr.(*ast.BasicLit)
+	if !ok || lit.Kind != gotoken.STRING {
+		return "", false
+	}
+	value, err := strconv.Unquote(lit.Value)
+	if err != nil {
+		return "", false
+	}
+	for _, line := range strings.Split(value, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		return value, strings.HasPrefix(line, "query ") || strings.HasPrefix(line, "query(") || strings.HasPrefix(line, "mutation ") || strings.HasPrefix(line, "mutation(")
+	}
+	return "", false
+}
@@ -22,6 +22,9 @@ The commands are:
 	patchsets         manages patch sets
 	list              lists campaigns
 	add-changesets    adds changesets of a given repository to a campaign
+	progress          reports the progress of a campaign
+	publish           publishes the changesets of a draft campaign
+	archive           fetches the repository archives that actions are executed on
 
 Use "src campaigns [command] -h" for more information about a command.
 `
@@ -35,7 +38,7 @@ Use "src campaigns [command] -h" for more information about a command.
 	// Register the command.
 	commands = append(commands, &command{
 		flagSet: flagSet,
-		aliases: []string{"campaign"},
+		aliases: []string{"campaign", "batch"},
 		handler: handler,
 		usageFunc: func() {
 			fmt.Println(usage)
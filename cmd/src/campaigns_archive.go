@@ -0,0 +1,40 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+)
+
+var campaignArchiveCommands commander
+
+func init() {
+	usage := `'src campaigns archive' fetches the repository archives that actions are executed on.
+
+EXPERIMENTAL: Campaigns are experimental functionality on Sourcegraph and in the 'src' tool.
+
+Usage:
+
+	src campaigns archive command [command options]
+
+The commands are:
+
+	fetch  downloads the archive of a repository and extracts it into a directory
+
+Use "src campaigns archive [command] -h" for more information about a command.
+`
+
+	flagSet := flag.NewFlagSet("archive", flag.ExitOnError)
+	handler := func(args []string) error {
+		campaignArchiveCommands.run(flagSet, "src campaigns archive", usage, args)
+		return nil
+	}
+
+	// Register the command.
+	campaignsCommands = append(campaignsCommands, &command{
+		flagSet: flagSet,
+		handler: handler,
+		usageFunc: func() {
+			fmt.Println(usage)
+		},
+	})
+}
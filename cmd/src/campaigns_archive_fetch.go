@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"path"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/src-cli/internal/campaigns"
+)
+
+func init() {
+	usage := `
+Download the archive of a repository from the Sourcegraph instance and extract it into a directory. The directory contains the same files as the workspace that 'src actions exec' runs the steps of an action in, which is useful to develop steps with 'src actions test-step' or to load-test archive downloads.
+
+Usage:
+
+	src campaigns archive fetch [options] <repository>
+
+Examples:
+
+  Extract the default branch of github.com/sourcegraph/src-cli into ./src-cli:
+
+		$ src campaigns archive fetch github.com/sourcegraph/src-cli
+
+  Extract a specific revision into /tmp/src-cli-3.17:
+
+		$ src campaigns archive fetch -rev 3.17.0 -o /tmp/src-cli-3.17 github.com/sourcegraph/src-cli
+
+  Run the steps of an action on the extracted archive:
+
+		$ src campaigns archive fetch -o /tmp/src-cli github.com/sourcegraph/src-cli
+		$ src actions test-step -f action.yml -dir /tmp/src-cli
+
+`
+
+	flagSet := flag.NewFlagSet("fetch", flag.ExitOnError)
+	usageFunc := func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'src campaigns archive %s':\n", flagSet.Name())
+		flagSet.PrintDefaults()
+		fmt.Println(usage)
+	}
+	var (
+		revFlag          = flagSet.String("rev", "", "The revision to fetch, e.g. a branch, tag or commit. Defaults to the default branch.")
+		outFlag          = flagSet.String("o", "", "The directory to extract the archive into. It must be empty or not exist. Defaults to the last element of the repository name in the working directory.")
+		skipSymlinksFlag = flagSet.Bool("skip-symlinks", false, "Skip symbolic links contained in the archive instead of recreating them.")
+		timeoutFlag      = flagSet.Duration("timeout", defaultTimeout, "The maximum duration the download can take.")
+	)
+
+	handler := func(args []string) error {
+		if err := flagSet.Parse(args); err != nil {
+			return err
+		}
+		if flagSet.NArg() != 1 {
+			return &usageError{errors.New("expected exactly one repository name")}
+		}
+		repo := flagSet.Arg(0)
+		dest := archiveFetchDest(repo, *outFlag)
+
+		ctx, cancel := context.WithTimeout(context.Background(), *timeoutFlag)
+		defer cancel()
+
+		accessToken, err := cfg.accessToken()
+		if err != nil {
+			return err
+		}
+		if err := campaigns.FetchArchive(ctx, cfg.Endpoint, accessToken, cfg.ImpersonateUser, cfg.AdditionalHeaders, repo, *revFlag, dest, *skipSymlinksFlag); err != nil {
+			return err
+		}
+		fmt.Printf("Extracted the archive of %s into %s\n", repo, dest)
+		return nil
+	}
+
+	// Register the command.
+	campaignArchiveCommands = append(campaignArchiveCommands, &command{
+		flagSet:   flagSet,
+		handler:   handler,
+		usageFunc: usageFunc,
+	})
+}
+
+// archiveFetchDest returns the directory the archive of repo is extracted
+// into: out, or the last element of the repository name if out is empty.
+func archiveFetchDest(repo, out string) string {
+	if out != "" {
+		return out
+	}
+	return path.Base(repo)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestArchiveFetchDest(t *testing.T) {
+	for _, tc := range []struct {
+		repo, out, want string
+	}{
+		{repo: "github.com/sourcegraph/src-cli", want: "src-cli"},
+		{repo: "github.com/sourcegraph/src-cli", out: "/tmp/src-cli-3.17", want: "/tmp/src-cli-3.17"},
+		{repo: "src-cli", want: "src-cli"},
+	} {
+		if have := archiveFetchDest(tc.repo, tc.out); have != tc.want {
+			t.Errorf("archiveFetchDest(%q, %q) = %q, want %q", tc.repo, tc.out, have, tc.want)
+		}
+	}
+}
+
+func TestCampaignsArchiveFetch(t *testing.T) {
+	var cmd *command
+	for _, c := range campaignArchiveCommands {
+		if c.flagSet.Name() == "fetch" {
+			cmd = c
+		}
+	}
+	if cmd == nil {
+		t.Fatal("fetch command not found")
+	}
+	run := func(args ...string) error {
+		// The flags keep their values between runs of the handler.
+		cmd.flagSet.VisitAll(func(f *flag.Flag) { f.Value.Set(f.DefValue) })
+		return cmd.handler(args)
+	}
+
+	for _, args := range [][]string{nil, {"github.com/a", "github.com/b"}} {
+		if err := run(args...); err == nil {
+			t.Errorf("%q: expected usage error", args)
+		} else if _, ok := err.(*usageError); !ok {
+			t.Errorf("%q: unexpected error %v, want usage error", args, err)
+		}
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	fw, err := zw.Create("README.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write([]byte("# README"))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var requests []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path+" "+r.Header.Get("Authorization"))
+		w.Write(buf.Bytes())
+	}))
+	defer ts.Close()
+
+	defer func(old *config) { cfg = old }(cfg)
+	cfg = &config{Endpoint: ts.URL, AccessToken: "abc"}
+
+	dir, err := ioutil.TempDir("", "archive-fetch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dest := filepath.Join(dir, "src-cli")
+
+	if err := run("-rev", "3.17.0", "-o", dest, "github.com/sourcegraph/src-cli"); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"/github.com/sourcegraph/src-cli@3.17.0/-/raw token abc"}, requests); diff != "" {
+		t.Errorf("unexpected requests (-want +got):\n%s", diff)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dest, "README.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "# README" {
+		t.Errorf("unexpected README.md content %q", data)
+	}
+
+	if err := run("-o", dest, "github.com/sourcegraph/src-cli"); err == nil || !strings.Contains(err.Error(), "is not empty") {
+		t.Errorf("unexpected error %v for a non-empty directory", err)
+	}
+}
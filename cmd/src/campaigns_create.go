@@ -11,6 +11,7 @@ import (
 	"os/exec"
 	"regexp"
 	"strings"
+	"sync"
 
 	"github.com/Masterminds/semver"
 	"github.com/pkg/errors"
@@ -48,14 +49,15 @@ Examples:
 	var (
 		nameFlag        = flagSet.String("name", "", "Name of the campaign.")
 		descriptionFlag = flagSet.String("desc", "", "Description for the campaign in Markdown.")
-		namespaceFlag   = flagSet.String("namespace", "", "ID of the namespace under which to create the campaign. The namespace can be the GraphQL ID of a Sourcegraph user or organisation. If not specified, the ID of the authenticated user is queried and used. (Required)")
+		namespaceFlag   = flagSet.String("namespace", "", `The namespace under which to create the campaign: the name of a Sourcegraph user or organization, disambiguated with "user:" or "org:" if needed (e.g. "org:acme"), or its GraphQL ID. If not specified, the namespace of the authenticated user is used.`)
 		patchsetIDFlag  = flagSet.String("patchset", "", "ID of patch set the campaign should turn into changesets. If no patch set is specified, a campaign is created to which changesets can be added manually.")
 		branchFlag      = flagSet.String("branch", "", "Name of the branch that will be created in each repository on the code host. Required for Sourcegraph >= 3.13 when 'patchset' is specified.")
 
 		changesetsFlag = flagSet.Int("changesets", 1000, "Returns the first n changesets per campaign.")
 
-		formatFlag = flagSet.String("f", "{{friendlyCampaignCreatedMessage .}}", `Format for the output, using the syntax of Go package text/template. (e.g. "{{.ID}}: {{.Name}}") or "{{.|json}}")`)
-		apiFlags   = api.NewFlags(flagSet)
+		formatFlag       = flagSet.String("f", "{{friendlyCampaignCreatedMessage .}}", `Format for the output, using the syntax of Go package text/template. (e.g. "{{.ID}}: {{.Name}}") or "{{.|json}}")`)
+		templateFileFlag = flagSet.String("template-file", "", templateFileFlagUsage)
+		apiFlags         = api.NewFlags(flagSet)
 	)
 
 	handler := func(args []string) error {
@@ -109,24 +111,17 @@ Examples:
 			}
 		}
 
-		var namespace string
+		namespace, err := campaignNamespace(ctx, client, *namespaceFlag)
+		if err != nil {
+			return err
+		}
 		if *namespaceFlag != "" {
-			namespace = *namespaceFlag
-		} else {
-			var currentUserResult struct {
-				CurrentUser *User
-			}
-
-			if _, err := client.NewQuery(currentUserIDQuery).Do(ctx, &currentUserResult); err != nil {
+			if err := requireCampaignNamespace(ctx, client, namespace); err != nil {
 				return err
 			}
-			if currentUserResult.CurrentUser.ID == "" {
-				return errors.New("Failed to query authenticated user's ID")
-			}
-			namespace = currentUserResult.CurrentUser.ID
 		}
 
-		tmpl, err := parseTemplate(*formatFlag)
+		tmpl, err := parseTemplateOrFile(*formatFlag, *templateFileFlag)
 		if err != nil {
 			return err
 		}
@@ -139,18 +134,12 @@ Examples:
 			"branch":      *branchFlag,
 		}
 
-		var result struct {
-			CreateCampaign Campaign
-		}
-
-		if ok, err := client.NewRequest(campaignFragment+createcampaignMutation, map[string]interface{}{
-			"input":           input,
-			"changesetsFirst": api.NullInt(*changesetsFlag),
-		}).Do(ctx, &result); err != nil || !ok {
+		campaign, err := createCampaign(ctx, client, input, *changesetsFlag)
+		if err != nil || campaign == nil {
 			return err
 		}
 
-		return execTemplate(tmpl, result.CreateCampaign)
+		return execTemplate(tmpl, campaign)
 	}
 
 	// Register the command.
@@ -161,7 +150,23 @@ Examples:
 	})
 }
 
-const currentUserIDQuery = `query CurrentUser { currentUser { id } }`
+// createCampaign creates a campaign from the given CreateCampaignInput. It
+// returns nil if the request returned GraphQL errors, which have already been
+// printed.
+func createCampaign(ctx context.Context, client api.Client, input map[string]interface{}, numChangesets int) (*Campaign, error) {
+	var result struct {
+		CreateCampaign Campaign
+	}
+
+	if ok, err := client.NewRequest(campaignFragment+createcampaignMutation, map[string]interface{}{
+		"input":           input,
+		"changesetsFirst": api.NullInt(numChangesets),
+	}).Do(ctx, &result); err != nil || !ok {
+		return nil, err
+	}
+
+	return &result.CreateCampaign, nil
+}
 
 const createcampaignMutation = `mutation CreateCampaign($input: CreateCampaignInput!, $changesetsFirst: Int) {
   createCampaign(input: $input) {
@@ -278,14 +283,25 @@ const sourcegraphVersionQuery = `query SourcegraphVersion {
 }
 `
 
+// sourcegraphVersions caches the versions returned by getSourcegraphVersion,
+// keyed by client.
+var sourcegraphVersions sync.Map
+
 func getSourcegraphVersion(ctx context.Context, client api.Client) (string, error) {
+	if version, ok := sourcegraphVersions.Load(client); ok {
+		return version.(string), nil
+	}
+
 	var sourcegraphVersion struct {
 		Site struct {
 			ProductVersion string
 		}
 	}
 
-	_, err := client.NewQuery(sourcegraphVersionQuery).Do(ctx, &sourcegraphVersion)
+	ok, err := client.NewQuery(sourcegraphVersionQuery).Do(ctx, &sourcegraphVersion)
+	if ok && err == nil {
+		sourcegraphVersions.Store(client, sourcegraphVersion.Site.ProductVersion)
+	}
 	return sourcegraphVersion.Site.ProductVersion, err
 }
 
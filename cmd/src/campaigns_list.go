@@ -34,10 +34,11 @@ Examples:
 		fmt.Println(usage)
 	}
 	var (
-		firstFlag      = flagSet.Int("first", 1000, "Returns the first n campaigns.")
-		changesetsFlag = flagSet.Int("changesets", 1000, "Returns the first n changesets per campaign.")
-		formatFlag     = flagSet.String("f", "{{.ID}}: {{.Name}}", `Format for the output, using the syntax of Go package text/template. (e.g. "{{.ID}}: {{.Name}}") or "{{.|json}}")`)
-		apiFlags       = api.NewFlags(flagSet)
+		firstFlag        = flagSet.Int("first", 1000, "Returns the first n campaigns.")
+		changesetsFlag   = flagSet.Int("changesets", 1000, "Returns the first n changesets per campaign.")
+		formatFlag       = flagSet.String("f", "{{.ID}}: {{.Name}}", `Format for the output, using the syntax of Go package text/template. (e.g. "{{.ID}}: {{.Name}}") or "{{.|json}}")`)
+		templateFileFlag = flagSet.String("template-file", "", templateFileFlagUsage)
+		apiFlags         = api.NewFlags(flagSet)
 	)
 
 	handler := func(args []string) error {
@@ -46,7 +47,7 @@ Examples:
 			return err
 		}
 
-		tmpl, err := parseTemplate(*formatFlag)
+		tmpl, err := parseTemplateOrFile(*formatFlag, *templateFileFlag)
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/src-cli/internal/api"
+)
+
+// campaignNamespace returns the ID of the namespace given with -namespace,
+// which is either a GraphQL ID or the name of a user or organization,
+// optionally prefixed with "user:" or "org:". If namespace is empty, the ID of
+// the authenticated user is returned and a notice is printed.
+func campaignNamespace(ctx context.Context, client api.Client, namespace string) (string, error) {
+	if namespace == "" {
+		query := `
+query CurrentUser {
+	currentUser {
+		id
+		username
+	}
+}
+`
+		var result struct {
+			CurrentUser *struct{ ID, Username string }
+		}
+		if ok, err := client.NewQuery(query).Do(ctx, &result); err != nil || !ok {
+			return "", err
+		}
+		if result.CurrentUser == nil || result.CurrentUser.ID == "" {
+			return "", errors.New("unable to determine the authenticated user, use -namespace to specify the namespace (see https://github.com/sourcegraph/src-cli#authentication)")
+		}
+		fmt.Fprintf(os.Stderr, "Using the namespace of the authenticated user %s. Use -namespace to specify another one.\n", result.CurrentUser.Username)
+		return result.CurrentUser.ID, nil
+	}
+
+	if isNamespaceID(namespace) {
+		return namespace, nil
+	}
+
+	kind, name := parseNamespace(namespace)
+	query := `
+query Namespace($name: String!, $user: Boolean!, $org: Boolean!) {
+	user(username: $name) @include(if: $user) {
+		id
+	}
+	organization(name: $name) @include(if: $org) {
+		id
+	}
+}
+`
+	var result struct {
+		User         *struct{ ID string }
+		Organization *struct{ ID string }
+	}
+	if ok, err := client.NewRequest(query, map[string]interface{}{
+		"name": name,
+		"user": kind != "org",
+		"org":  kind != "user",
+	}).Do(ctx, &result); err != nil || !ok {
+		return "", errors.Wrapf(err, "resolving namespace %s", namespace)
+	}
+
+	switch {
+	case result.User != nil && result.Organization != nil:
+		return "", &usageError{fmt.Errorf("%q is the name of a user and of an organization, use -namespace user:%s or -namespace org:%s", name, name, name)}
+	case result.User != nil:
+		return result.User.ID, nil
+	case result.Organization != nil:
+		return result.Organization.ID, nil
+	}
+	switch kind {
+	case "user":
+		return "", fmt.Errorf("user %q not found", name)
+	case "org":
+		return "", fmt.Errorf("organization %q not found", name)
+	default:
+		return "", fmt.Errorf("no user or organization named %q found", name)
+	}
+}
+
+// parseNamespace splits a namespace given as "user:alice" or "org:acme" into
+// its kind and name. The kind of a namespace without prefix is empty.
+func parseNamespace(namespace string) (kind, name string) {
+	for _, k := range []string{"user", "org"} {
+		if strings.HasPrefix(namespace, k+":") {
+			return k, strings.TrimPrefix(namespace, k+":")
+		}
+	}
+	return "", namespace
+}
+
+// isNamespaceID returns whether namespace is the GraphQL ID of a user or
+// organization.
+func isNamespaceID(namespace string) bool {
+	data, err := base64.StdEncoding.DecodeString(namespace)
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(string(data), "User:") || strings.HasPrefix(string(data), "Org:")
+}
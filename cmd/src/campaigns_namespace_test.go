@@ -0,0 +1,31 @@
+package main
+
+import "testing"
+
+func TestParseNamespace(t *testing.T) {
+	for _, tc := range []struct {
+		namespace  string
+		kind, name string
+		id         bool
+	}{
+		{namespace: "alice", kind: "", name: "alice"},
+		{namespace: "user:alice", kind: "user", name: "alice"},
+		{namespace: "org:acme", kind: "org", name: "acme"},
+		{namespace: "organization:acme", kind: "", name: "organization:acme"},
+		{namespace: "VXNlcjox", id: true},
+		{namespace: "T3JnOjE=", id: true},
+		{namespace: "Q2FtcGFpZ246MQ==", kind: "", name: "Q2FtcGFpZ246MQ=="},
+	} {
+		t.Run(tc.namespace, func(t *testing.T) {
+			if have := isNamespaceID(tc.namespace); have != tc.id {
+				t.Fatalf("unexpected isNamespaceID: have %v; want %v", have, tc.id)
+			}
+			if tc.id {
+				return
+			}
+			if kind, name := parseNamespace(tc.namespace); kind != tc.kind || name != tc.name {
+				t.Errorf("unexpected namespace: have %q, %q; want %q, %q", kind, name, tc.kind, tc.name)
+			}
+		})
+	}
+}
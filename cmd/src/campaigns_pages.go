@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+
+	"github.com/sourcegraph/src-cli/internal/api"
+)
+
+// campaignsPageSize is the number of campaigns, changesets or patches that are
+// requested at once.
+const campaignsPageSize = 100
+
+// campaignSummary is a campaign as returned by listCampaigns.
+type campaignSummary struct {
+	ID, Name, Description, Branch, URL string
+	Namespace                          struct{ ID string }
+}
+
+// listCampaigns returns all campaigns the user can see, requested in pages.
+// It returns false if no request was made, e.g. with -get-curl.
+func listCampaigns(ctx context.Context, client api.Client) ([]campaignSummary, bool, error) {
+	query := `
+query Campaigns($first: Int!, $after: String) {
+	campaigns(first: $first, after: $after) {
+		nodes {
+			id
+			name
+			description
+			branch
+			url
+			namespace {
+				id
+			}
+		}
+		pageInfo {
+			endCursor
+			hasNextPage
+		}
+	}
+}
+`
+	var (
+		campaigns []campaignSummary
+		requested bool
+	)
+	err := fetchPages(func(after *string) (*pageInfo, error) {
+		var result struct {
+			Campaigns struct {
+				Nodes    []campaignSummary
+				PageInfo pageInfo
+			}
+		}
+		if ok, err := client.NewRequest(query, map[string]interface{}{
+			"first": campaignsPageSize,
+			"after": after,
+		}).Do(ctx, &result); err != nil || !ok {
+			return nil, err
+		}
+		requested = true
+		campaigns = append(campaigns, result.Campaigns.Nodes...)
+		return &result.Campaigns.PageInfo, nil
+	})
+	return campaigns, requested, err
+}
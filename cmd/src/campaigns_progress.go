@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/src-cli/internal/api"
+)
+
+func init() {
+	usage := `
+Report the progress of a campaign: how many of its changesets are open, merged or closed over time, and which share of them is completed (merged or closed).
+
+Usage:
+
+	src campaigns progress [options] <campaign name or ID>
+
+Examples:
+
+  Show the burndown of the campaign "update-go" since its creation:
+
+    	$ src campaigns progress update-go
+
+  Show the burndown since the 1st of May 2020:
+
+    	$ src campaigns progress -from 2020-05-01 update-go
+
+  Print the completion percentage of the campaign, e.g. to report it from a CI job:
+
+    	$ src campaigns progress -f json update-go | jq .completion
+
+`
+
+	flagSet := flag.NewFlagSet("progress", flag.ExitOnError)
+	usageFunc := func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'src campaigns %s':\n", flagSet.Name())
+		flagSet.PrintDefaults()
+		fmt.Println(usage)
+	}
+	var (
+		fromFlag   = flagSet.String("from", "", "Only report the progress since this date (YYYY-MM-DD). The default is the creation date of the campaign.")
+		formatFlag = flagSet.String("f", "text", `The output format: "text" or "json".`)
+		apiFlags   = api.NewFlags(flagSet)
+	)
+
+	handler := func(args []string) error {
+		if err := flagSet.Parse(args); err != nil {
+			return err
+		}
+		if flagSet.NArg() != 1 {
+			return &usageError{errors.New("expected exactly one campaign name or ID")}
+		}
+		if *formatFlag != "text" && *formatFlag != "json" {
+			return &usageError{fmt.Errorf("invalid output format %q", *formatFlag)}
+		}
+		var from *time.Time
+		if *fromFlag != "" {
+			t, err := time.Parse("2006-01-02", *fromFlag)
+			if err != nil {
+				return &usageError{errors.Wrap(err, "invalid -from date")}
+			}
+			from = &t
+		}
+
+		ctx := context.Background()
+		client := cfg.apiClient(apiFlags, flagSet.Output())
+
+		progress, err := fetchCampaignProgress(ctx, client, flagSet.Arg(0), from)
+		if err != nil {
+			return err
+		}
+
+		if *formatFlag == "json" {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(progress)
+		}
+		return progress.writeText(os.Stdout)
+	}
+
+	// Register the command.
+	campaignsCommands = append(campaignsCommands, &command{
+		flagSet:   flagSet,
+		handler:   handler,
+		usageFunc: usageFunc,
+	})
+}
+
+// changesetCounts are the numbers of changesets of a campaign in each state
+// at a given date.
+type changesetCounts struct {
+	Date                 time.Time `json:"date"`
+	Total                int       `json:"total"`
+	Merged               int       `json:"merged"`
+	Closed               int       `json:"closed"`
+	Open                 int       `json:"open"`
+	OpenApproved         int       `json:"openApproved"`
+	OpenChangesRequested int       `json:"openChangesRequested"`
+	OpenPending          int       `json:"openPending"`
+}
+
+// completion returns the percentage of changesets that are merged or closed.
+func (c changesetCounts) completion() float64 {
+	if c.Total == 0 {
+		return 0
+	}
+	return float64(c.Merged+c.Closed) / float64(c.Total) * 100
+}
+
+// campaignProgress is the progress of a campaign, as reported by 'src
+// campaigns progress'.
+type campaignProgress struct {
+	Campaign string `json:"campaign"`
+	// Completion is the percentage of changesets that are merged or closed
+	// at the latest date in Counts.
+	Completion float64           `json:"completion"`
+	Counts     []changesetCounts `json:"counts"`
+}
+
+func fetchCampaignProgress(ctx context.Context, client api.Client, name string, from *time.Time) (*campaignProgress, error) {
+	id, err := campaignIDByName(ctx, client, name)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+query CampaignProgress($id: ID!, $from: DateTime) {
+	node(id: $id) {
+		... on Campaign {
+			name
+			changesetCountsOverTime(from: $from) {
+				date
+				total
+				merged
+				closed
+				open
+				openApproved
+				openChangesRequested
+				openPending
+			}
+		}
+	}
+}
+`
+	vars := map[string]interface{}{"id": id, "from": nil}
+	if from != nil {
+		vars["from"] = from.Format(time.RFC3339)
+	}
+
+	var result struct {
+		Node *struct {
+			Name                    string
+			ChangesetCountsOverTime []changesetCounts
+		}
+	}
+	if ok, err := client.NewRequest(query, vars).Do(ctx, &result); err != nil || !ok {
+		return nil, err
+	}
+	if result.Node == nil {
+		return nil, fmt.Errorf("campaign %q not found", name)
+	}
+
+	progress := &campaignProgress{
+		Campaign: result.Node.Name,
+		Counts:   result.Node.ChangesetCountsOverTime,
+	}
+	if n := len(progress.Counts); n > 0 {
+		progress.Completion = progress.Counts[n-1].completion()
+	}
+	return progress, nil
+}
+
+// progressBarWidth is the width of the bars in the text output of 'src
+// campaigns progress'.
+const progressBarWidth = 30
+
+// writeText writes the progress as a table with one row per date, followed by
+// the completion percentage.
+func (p *campaignProgress) writeText(w io.Writer) error {
+	fmt.Fprintf(w, "Campaign %q\n\n", p.Campaign)
+	if len(p.Counts) == 0 {
+		_, err := fmt.Fprintln(w, "No changesets.")
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "DATE\tTOTAL\tOPEN\tMERGED\tCLOSED\tDONE\t")
+	for _, c := range p.Counts {
+		filled := 0
+		if c.Total > 0 {
+			filled = (c.Merged + c.Closed) * progressBarWidth / c.Total
+		}
+		bar := strings.Repeat("#", filled) + strings.Repeat(".", progressBarWidth-filled)
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%5.1f%%\t%s\n", c.Date.Format("2006-01-02"), c.Total, c.Open, c.Merged, c.Closed, c.completion(), bar)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	last := p.Counts[len(p.Counts)-1]
+	_, err := fmt.Fprintf(w, "\n%.1f%% completed: %d of %d changesets are merged or closed.\n", p.Completion, last.Merged+last.Closed, last.Total)
+	return err
+}
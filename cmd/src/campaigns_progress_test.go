@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCampaignProgressWriteText(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2020, 5, d, 0, 0, 0, 0, time.UTC) }
+
+	tests := map[string]struct {
+		counts []changesetCounts
+		want   string
+	}{
+		"no changesets": {
+			want: "Campaign \"update-go\"\n\nNo changesets.\n",
+		},
+		"burndown": {
+			counts: []changesetCounts{
+				{Date: day(1), Total: 4, Open: 4},
+				{Date: day(2), Total: 4, Open: 2, Merged: 1, Closed: 1},
+				{Date: day(3), Total: 4, Open: 1, Merged: 3},
+			},
+			want: `Campaign "update-go"
+
+DATE        TOTAL  OPEN  MERGED  CLOSED  DONE    
+2020-05-01  4      4     0       0         0.0%  ..............................
+2020-05-02  4      2     1       1        50.0%  ###############...............
+2020-05-03  4      1     3       0        75.0%  ######################........
+
+75.0% completed: 3 of 4 changesets are merged or closed.
+`,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			p := &campaignProgress{Campaign: "update-go", Counts: tc.counts}
+			if n := len(tc.counts); n > 0 {
+				p.Completion = tc.counts[n-1].completion()
+			}
+
+			var buf bytes.Buffer
+			if err := p.writeText(&buf); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, buf.String()); diff != "" {
+				t.Errorf("unexpected output (-want +have):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/src-cli/internal/api"
+)
+
+func init() {
+	usage := `
+Publish the changesets of a draft campaign, which creates them on their code hosts: all of them, those in repositories matching a pattern, or a number of them at a time with a pause in between, to publish a large campaign gradually.
+
+Without -repo and -batch-size, the whole campaign is published. Otherwise the matching changesets are published one by one and the campaign stays a draft.
+
+Usage:
+
+	src campaigns publish [options] <campaign name or ID>
+
+Examples:
+
+  Publish the campaign "update-go" and all of its changesets:
+
+    	$ src campaigns publish update-go
+
+  Only publish the changesets in the repositories of the organization "my-org" on GitHub:
+
+    	$ src campaigns publish -repo 'github.com/my-org/*' update-go
+
+  Publish 10 changesets every hour:
+
+    	$ src campaigns publish -batch-size 10 -interval 1h update-go
+
+  Publish 10 changesets now and the next 10 when running the command again:
+
+    	$ src campaigns publish -batch-size 10 -batches 1 update-go
+
+`
+
+	flagSet := flag.NewFlagSet("publish", flag.ExitOnError)
+	usageFunc := func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'src campaigns %s':\n", flagSet.Name())
+		flagSet.PrintDefaults()
+		fmt.Println(usage)
+	}
+	var (
+		repoFlag      = flagSet.String("repo", "", "Only publish the changesets in repositories whose name matches this pattern, using the syntax of path.Match, e.g. 'github.com/my-org/*'.")
+		batchSizeFlag = flagSet.Int("batch-size", 0, "Publish this many changesets at a time. 0 publishes all of them at once.")
+		intervalFlag  = flagSet.Duration("interval", 10*time.Minute, "The pause between publishing two batches of changesets.")
+		batchesFlag   = flagSet.Int("batches", 0, "Stop after publishing this many batches of changesets. 0 publishes all batches.")
+		yesFlag       = flagSet.Bool("yes", false, "Do not ask for confirmation.")
+		apiFlags      = api.NewFlags(flagSet)
+	)
+
+	handler := func(args []string) error {
+		if err := flagSet.Parse(args); err != nil {
+			return err
+		}
+		if flagSet.NArg() != 1 {
+			return &usageError{errors.New("expected exactly one campaign name or ID")}
+		}
+		if *repoFlag != "" {
+			if _, err := path.Match(*repoFlag, ""); err != nil {
+				return &usageError{errors.Wrap(err, "invalid -repo pattern")}
+			}
+		}
+		if *batchSizeFlag < 0 || *batchesFlag < 0 {
+			return &usageError{errors.New("-batch-size and -batches must not be negative")}
+		}
+		name := flagSet.Arg(0)
+
+		ctx := context.Background()
+		client := cfg.apiClient(apiFlags, flagSet.Output())
+
+		campaignID, err := campaignIDByName(ctx, client, name)
+		if err != nil {
+			return err
+		}
+
+		if *repoFlag == "" && *batchSizeFlag == 0 {
+			if !*yesFlag {
+				ok, err := askForConfirmation(fmt.Sprintf("Publish campaign %q and all of its changesets?", name))
+				if err != nil {
+					return err
+				}
+				if !ok {
+					return errors.New("aborted")
+				}
+			}
+			if err := publishCampaign(ctx, client, campaignID); err != nil {
+				return err
+			}
+			fmt.Printf("Published campaign %q. Its changesets are being created on their code hosts.\n", name)
+			return nil
+		}
+
+		patches, err := unpublishedPatches(ctx, client, campaignID)
+		if err != nil {
+			return err
+		}
+		patches = filterUnpublishedPatches(patches, *repoFlag)
+		if len(patches) == 0 {
+			fmt.Println("No unpublished changesets selected.")
+			return nil
+		}
+		batches := publishBatches(patches, *batchSizeFlag, *batchesFlag)
+
+		if !*yesFlag {
+			n := 0
+			for _, b := range batches {
+				n += len(b)
+			}
+			ok, err := askForConfirmation(fmt.Sprintf("Publish %d of the %d unpublished changesets of campaign %q in %d batches?", n, len(patches), name, len(batches)))
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return errors.New("aborted")
+			}
+		}
+
+		return publishPatchBatches(ctx, client, batches, *intervalFlag, os.Stdout, time.Sleep)
+	}
+
+	// Register the command.
+	campaignsCommands = append(campaignsCommands, &command{
+		flagSet:   flagSet,
+		handler:   handler,
+		usageFunc: usageFunc,
+	})
+}
+
+// unpublishedPatch is a patch of a draft campaign that has not been published
+// as a changeset yet.
+type unpublishedPatch struct {
+	ID                  string
+	PublicationEnqueued bool
+	Repository          struct {
+		Name string
+	}
+}
+
+// unpublishedPatches returns the patches of the campaign that are not
+// published yet, sorted by the names of their repositories.
+func unpublishedPatches(ctx context.Context, client api.Client, campaignID string) ([]unpublishedPatch, error) {
+	query := `
+query UnpublishedPatches($campaign: ID!, $first: Int!, $after: String) {
+	node(id: $campaign) {
+		... on Campaign {
+			patches(first: $first, after: $after) {
+				nodes {
+					... on Patch {
+						id
+						publicationEnqueued
+						repository {
+							name
+						}
+					}
+				}
+				pageInfo {
+					endCursor
+					hasNextPage
+				}
+			}
+		}
+	}
+}
+`
+	var patches []unpublishedPatch
+	err := fetchPages(func(after *string) (*pageInfo, error) {
+		var result struct {
+			Node *struct {
+				Patches struct {
+					Nodes    []unpublishedPatch
+					PageInfo pageInfo
+				}
+			}
+		}
+		if ok, err := client.NewRequest(query, map[string]interface{}{
+			"campaign": campaignID,
+			"first":    campaignsPageSize,
+			"after":    after,
+		}).Do(ctx, &result); err != nil || !ok {
+			return nil, err
+		}
+		if result.Node == nil {
+			return nil, fmt.Errorf("campaign %s not found", campaignID)
+		}
+		patches = append(patches, result.Node.Patches.Nodes...)
+		return &result.Node.Patches.PageInfo, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(patches, func(i, j int) bool {
+		return patches[i].Repository.Name < patches[j].Repository.Name
+	})
+	return patches, nil
+}
+
+// filterUnpublishedPatches returns the patches whose publication is not
+// enqueued yet and whose repository matches repoPattern, if it is set.
+func filterUnpublishedPatches(patches []unpublishedPatch, repoPattern string) []unpublishedPatch {
+	var filtered []unpublishedPatch
+	for _, p := range patches {
+		if p.PublicationEnqueued {
+			continue
+		}
+		if repoPattern != "" {
+			if ok, _ := path.Match(repoPattern, p.Repository.Name); !ok {
+				continue
+			}
+		}
+		filtered = append(filtered, p)
+	}
+	return filtered
+}
+
+// publishBatches splits the patches into batches of size patches, or a single
+// batch if size is 0, and returns at most max of them, or all if max is 0.
+func publishBatches(patches []unpublishedPatch, size, max int) [][]unpublishedPatch {
+	if size == 0 {
+		size = len(patches)
+	}
+	var batches [][]unpublishedPatch
+	for start := 0; start < len(patches); start += size {
+		if max > 0 && len(batches) == max {
+			break
+		}
+		end := start + size
+		if end > len(patches) {
+			end = len(patches)
+		}
+		batches = append(batches, patches[start:end])
+	}
+	return batches
+}
+
+// publishPatchBatches publishes the patches batch by batch, calling sleep with
+// interval between two batches. It stops at the first patch that can't be
+// published.
+func publishPatchBatches(ctx context.Context, client api.Client, batches [][]unpublishedPatch, interval time.Duration, out io.Writer, sleep func(time.Duration)) error {
+	for i, batch := range batches {
+		if i > 0 {
+			fmt.Fprintf(out, "Waiting %s before publishing the next batch...\n", interval)
+			sleep(interval)
+		}
+		for _, p := range batch {
+			if err := publishChangeset(ctx, client, p.ID); err != nil {
+				return errors.Wrapf(err, "publishing the changeset in %s", p.Repository.Name)
+			}
+			fmt.Fprintf(out, "Published the changeset in %s.\n", p.Repository.Name)
+		}
+	}
+	return nil
+}
+
+func publishCampaign(ctx context.Context, client api.Client, campaignID string) error {
+	query := `
+mutation PublishCampaign($campaign: ID!) {
+	publishCampaign(campaign: $campaign) {
+		id
+	}
+}
+`
+	var result struct {
+		PublishCampaign struct{ ID string }
+	}
+	_, err := client.NewRequest(query, map[string]interface{}{
+		"campaign": campaignID,
+	}).Do(ctx, &result)
+	return err
+}
+
+func publishChangeset(ctx context.Context, client api.Client, patchID string) error {
+	query := `
+mutation PublishChangeset($patch: ID!) {
+	publishChangeset(patch: $patch) {
+		alwaysNil
+	}
+}
+`
+	var result struct {
+		PublishChangeset struct{ AlwaysNil *string }
+	}
+	_, err := client.NewRequest(query, map[string]interface{}{
+		"patch": patchID,
+	}).Do(ctx, &result)
+	return err
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/sourcegraph/src-cli/internal/api"
+)
+
+func TestPublishBatches(t *testing.T) {
+	patch := func(repo string, enqueued bool) unpublishedPatch {
+		p := unpublishedPatch{ID: repo, PublicationEnqueued: enqueued}
+		p.Repository.Name = repo
+		return p
+	}
+	patches := []unpublishedPatch{
+		patch("github.com/a/1", false),
+		patch("github.com/a/2", true),
+		patch("github.com/a/3", false),
+		patch("github.com/a/4", false),
+		patch("github.com/b/1", false),
+	}
+
+	tests := map[string]struct {
+		repo      string
+		size, max int
+		want      [][]string
+	}{
+		"all": {
+			want: [][]string{{"github.com/a/1", "github.com/a/3", "github.com/a/4", "github.com/b/1"}},
+		},
+		"repo pattern": {
+			repo: "github.com/a/*",
+			want: [][]string{{"github.com/a/1", "github.com/a/3", "github.com/a/4"}},
+		},
+		"batches": {
+			size: 3,
+			want: [][]string{{"github.com/a/1", "github.com/a/3", "github.com/a/4"}, {"github.com/b/1"}},
+		},
+		"max batches": {
+			size: 2,
+			max:  1,
+			want: [][]string{{"github.com/a/1", "github.com/a/3"}},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var have [][]string
+			for _, batch := range publishBatches(filterUnpublishedPatches(patches, tc.repo), tc.size, tc.max) {
+				var ids []string
+				for _, p := range batch {
+					ids = append(ids, p.ID)
+				}
+				have = append(have, ids)
+			}
+			if diff := cmp.Diff(tc.want, have); diff != "" {
+				t.Errorf("unexpected batches (-want +have):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestUnpublishedPatches(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Variables struct {
+				Campaign string
+				After    *string
+			}
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatal(err)
+		}
+		switch {
+		case req.Variables.Campaign != "Q2FtcGFpZ246MQ==":
+			w.Write([]byte(`{"data": {"node": null}}`))
+		case req.Variables.After == nil:
+			w.Write([]byte(`{"data": {"node": {"patches": {"nodes": [{"id": "2", "repository": {"name": "github.com/b/1"}}], "pageInfo": {"endCursor": "1", "hasNextPage": true}}}}}`))
+		default:
+			w.Write([]byte(`{"data": {"node": {"patches": {"nodes": [{"id": "1", "publicationEnqueued": true, "repository": {"name": "github.com/a/1"}}], "pageInfo": {"hasNextPage": false}}}}}`))
+		}
+	}))
+	defer ts.Close()
+	client := api.NewClient(api.ClientOpts{Endpoint: ts.URL, Out: ioutil.Discard})
+
+	patches, err := unpublishedPatches(context.Background(), client, "Q2FtcGFpZ246MQ==")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, p := range patches {
+		ids = append(ids, p.ID)
+	}
+	if diff := cmp.Diff([]string{"1", "2"}, ids); diff != "" {
+		t.Errorf("unexpected patches (-want +have):\n%s", diff)
+	}
+
+	if _, err := unpublishedPatches(context.Background(), client, "Q2FtcGFpZ246Mg=="); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("unexpected error for missing campaign: %v", err)
+	}
+}
+
+func TestPublishPatchBatches(t *testing.T) {
+	patch := func(id string) unpublishedPatch {
+		p := unpublishedPatch{ID: id}
+		p.Repository.Name = "github.com/a/" + id
+		return p
+	}
+	batches := [][]unpublishedPatch{{patch("1"), patch("2")}, {patch("3"), patch("4")}, {patch("5")}}
+
+	for name, tc := range map[string]struct {
+		failing       string
+		wantPublished []string
+		wantSleeps    int
+		wantErr       string
+	}{
+		"all": {
+			wantPublished: []string{"1", "2", "3", "4", "5"},
+			wantSleeps:    2,
+		},
+		"failure": {
+			failing:       "3",
+			wantPublished: []string{"1", "2", "3"},
+			wantSleeps:    1,
+			wantErr:       "publishing the changeset in github.com/a/3",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var published []string
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var req struct {
+					Variables struct{ Patch string }
+				}
+				if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+					t.Fatal(err)
+				}
+				published = append(published, req.Variables.Patch)
+				if req.Variables.Patch == tc.failing {
+					w.Write([]byte(`{"errors": [{"message": "code host unavailable"}]}`))
+					return
+				}
+				w.Write([]byte(`{"data": {"publishChangeset": {"alwaysNil": null}}}`))
+			}))
+			defer ts.Close()
+			client := api.NewClient(api.ClientOpts{Endpoint: ts.URL, Out: ioutil.Discard})
+
+			var sleeps []time.Duration
+			var out bytes.Buffer
+			err := publishPatchBatches(context.Background(), client, batches, time.Hour, &out, func(d time.Duration) {
+				sleeps = append(sleeps, d)
+			})
+			if tc.wantErr == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)) {
+				t.Fatalf("unexpected error %v, want %q", err, tc.wantErr)
+			}
+			if diff := cmp.Diff(tc.wantPublished, published); diff != "" {
+				t.Errorf("unexpected published patches (-want +have):\n%s", diff)
+			}
+			if len(sleeps) != tc.wantSleeps {
+				t.Errorf("slept %d times, want %d", len(sleeps), tc.wantSleeps)
+			}
+			for _, d := range sleeps {
+				if d != time.Hour {
+					t.Errorf("unexpected sleep of %s", d)
+				}
+			}
+		})
+	}
+}
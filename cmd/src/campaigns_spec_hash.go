@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/src-cli/internal/api"
+	"github.com/sourcegraph/src-cli/internal/campaigns"
+)
+
+// campaignSpec is the input from which a campaign is created.
+type campaignSpec struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	Namespace   string                 `json:"namespace"`
+	Branch      string                 `json:"branch"`
+	Patches     []campaigns.PatchInput `json:"patches"`
+}
+
+// hash returns a hash of the content of the spec that doesn't depend on the
+// order of its patches.
+func (s campaignSpec) hash() string {
+	patches := make([]campaigns.PatchInput, len(s.Patches))
+	copy(patches, s.Patches)
+	sort.Slice(patches, func(i, j int) bool {
+		if patches[i].Repository != patches[j].Repository {
+			return patches[i].Repository < patches[j].Repository
+		}
+		return patches[i].BaseRef < patches[j].BaseRef
+	})
+	s.Patches = patches
+
+	data, _ := json.Marshal(s)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// specHashStore stores the hashes of the specs that campaigns were last
+// created or updated from by 'src campaigns patchsets create-from-patches
+// -apply', one file per campaign in Dir. The hashes are only an optimization:
+// without a stored hash, the campaign is updated with the same patches.
+type specHashStore struct {
+	Dir string
+}
+
+func (s specHashStore) path(endpoint, campaignID string) string {
+	sum := sha256.Sum256([]byte(endpoint + "\x00" + campaignID))
+	return filepath.Join(s.Dir, "campaign-specs", hex.EncodeToString(sum[:16]))
+}
+
+// get returns the hash stored for the campaign, or "" if there is none.
+func (s specHashStore) get(endpoint, campaignID string) string {
+	data, err := ioutil.ReadFile(s.path(endpoint, campaignID))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// set stores the hash for the campaign.
+func (s specHashStore) set(endpoint, campaignID, hash string) error {
+	path := s.path(endpoint, campaignID)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, []byte(hash+"\n"), 0600)
+}
+
+// findCampaign returns the campaign with the given name in the namespace, or
+// nil if there is none or no request was made, e.g. with -get-curl.
+func findCampaign(ctx context.Context, client api.Client, name, namespace string) (*campaignSummary, error) {
+	all, _, err := listCampaigns(ctx, client)
+	if err != nil {
+		return nil, errors.Wrap(err, "querying existing campaigns")
+	}
+	for _, c := range all {
+		if c.Name == name && c.Namespace.ID == namespace {
+			c := c
+			return &c, nil
+		}
+	}
+	return nil, nil
+}
+
+const updateCampaignMutation = `mutation UpdateCampaign($input: UpdateCampaignInput!, $changesetsFirst: Int) {
+  updateCampaign(input: $input) {
+	... campaign
+  }
+}
+`
+
+// updateCampaign updates the campaign with the given input, which includes
+// its ID. It returns nil if no request was made, e.g. with -get-curl.
+func updateCampaign(ctx context.Context, client api.Client, input map[string]interface{}, numChangesets int) (*Campaign, error) {
+	var result struct {
+		UpdateCampaign Campaign
+	}
+	if ok, err := client.NewRequest(campaignFragment+updateCampaignMutation, map[string]interface{}{
+		"input":           input,
+		"changesetsFirst": api.NullInt(numChangesets),
+	}).Do(ctx, &result); err != nil || !ok {
+		return nil, err
+	}
+	return &result.UpdateCampaign, nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/sourcegraph/src-cli/internal/api"
+
+	"github.com/sourcegraph/src-cli/internal/campaigns"
+)
+
+func TestCampaignSpecHash(t *testing.T) {
+	a := campaigns.PatchInput{Repository: "repo-a", BaseRef: "refs/heads/master", Patch: "diff a"}
+	b := campaigns.PatchInput{Repository: "repo-b", BaseRef: "refs/heads/master", Patch: "diff b"}
+	spec := campaignSpec{Name: "gofmt", Description: "Format Go code", Namespace: "VXNlcjox", Branch: "gofmt", Patches: []campaigns.PatchInput{a, b}}
+
+	reordered := spec
+	reordered.Patches = []campaigns.PatchInput{b, a}
+	if spec.hash() != reordered.hash() {
+		t.Error("hash depends on the order of patches")
+	}
+	if spec.Patches[0] != a {
+		t.Error("hash reordered the patches of the spec")
+	}
+
+	changed := spec
+	changed.Patches = []campaigns.PatchInput{a, {Repository: "repo-b", BaseRef: "refs/heads/master", Patch: "diff b2"}}
+	if spec.hash() == changed.hash() {
+		t.Error("hash doesn't depend on the content of patches")
+	}
+
+	otherBranch := spec
+	otherBranch.Branch = "gofmt-2"
+	if spec.hash() == otherBranch.hash() {
+		t.Error("hash doesn't depend on the branch")
+	}
+}
+
+func TestSpecHashStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spec-hash-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	store := specHashStore{Dir: dir}
+	if have := store.get("https://sourcegraph.example.com", "Q2FtcGFpZ246MQ=="); have != "" {
+		t.Errorf("unexpected hash in empty store: %q", have)
+	}
+	if err := store.set("https://sourcegraph.example.com", "Q2FtcGFpZ246MQ==", "abc"); err != nil {
+		t.Fatal(err)
+	}
+	if have := store.get("https://sourcegraph.example.com", "Q2FtcGFpZ246MQ=="); have != "abc" {
+		t.Errorf("unexpected hash: have %q; want %q", have, "abc")
+	}
+	if have := store.get("https://other.example.com", "Q2FtcGFpZ246MQ=="); have != "" {
+		t.Errorf("unexpected hash for other endpoint: %q", have)
+	}
+}
+
+func TestFindCampaign(t *testing.T) {
+	// The campaigns are returned in pages of one.
+	pages := []string{
+		`{"data": {"campaigns": {"nodes": [{"id": "Q2FtcGFpZ246MQ==", "name": "gofmt", "namespace": {"id": "VXNlcjox"}}], "pageInfo": {"endCursor": "1", "hasNextPage": true}}}}`,
+		`{"data": {"campaigns": {"nodes": [{"id": "Q2FtcGFpZ246Mg==", "name": "gofmt", "namespace": {"id": "T3JnOjE="}}], "pageInfo": {"endCursor": "2", "hasNextPage": true}}}}`,
+		`{"data": {"campaigns": {"nodes": [{"id": "Q2FtcGFpZ246Mw==", "name": "goimports", "namespace": {"id": "T3JnOjE="}}], "pageInfo": {"hasNextPage": false}}}}`,
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Variables struct{ After *string }
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatal(err)
+		}
+		page := 0
+		if req.Variables.After != nil {
+			page = map[string]int{"1": 1, "2": 2}[*req.Variables.After]
+		}
+		w.Write([]byte(pages[page]))
+	}))
+	defer ts.Close()
+	client := api.NewClient(api.ClientOpts{Endpoint: ts.URL, Out: ioutil.Discard})
+
+	for name, tc := range map[string]struct {
+		name, namespace string
+		wantID          string
+	}{
+		"first page":      {name: "gofmt", namespace: "VXNlcjox", wantID: "Q2FtcGFpZ246MQ=="},
+		"other page":      {name: "gofmt", namespace: "T3JnOjE=", wantID: "Q2FtcGFpZ246Mg=="},
+		"last page":       {name: "goimports", namespace: "T3JnOjE=", wantID: "Q2FtcGFpZ246Mw=="},
+		"other namespace": {name: "goimports", namespace: "VXNlcjox"},
+		"missing":         {name: "golint", namespace: "VXNlcjox"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c, err := findCampaign(context.Background(), client, tc.name, tc.namespace)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var haveID string
+			if c != nil {
+				haveID = c.ID
+			}
+			if diff := cmp.Diff(tc.wantID, haveID); diff != "" {
+				t.Errorf("unexpected campaign (-want +have):\n%s", diff)
+			}
+		})
+	}
+}
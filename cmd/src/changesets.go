@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/src-cli/internal/api"
+)
+
+var changesetsCommands commander
+
+func init() {
+	usage := `'src changesets' is a tool that manages the changesets of campaigns on a Sourcegraph instance.
+
+EXPERIMENTAL: Campaigns are experimental functionality on Sourcegraph and in the 'src' tool.
+
+Usage:
+
+	src changesets command [command options]
+
+The commands are:
+
+	list              lists the changesets of a campaign
+	retry             retries publishing or updating changesets that failed
+	merge             merges changesets on their code hosts
+	close             closes changesets on their code hosts
+
+All commands select the changesets of the campaign given with -campaign, optionally filtered by -state and -code-host.
+
+Use "src changesets [command] -h" for more information about a command.
+`
+
+	flagSet := flag.NewFlagSet("changesets", flag.ExitOnError)
+	handler := func(args []string) error {
+		changesetsCommands.run(flagSet, "src changesets", usage, args)
+		return nil
+	}
+
+	// Register the command.
+	commands = append(commands, &command{
+		flagSet: flagSet,
+		aliases: []string{"changeset"},
+		handler: handler,
+		usageFunc: func() {
+			fmt.Println(usage)
+		},
+	})
+}
+
+// changesetFilter selects the changesets of a campaign that 'src changesets'
+// commands operate on.
+type changesetFilter struct {
+	campaign *string
+	states   *string
+	codeHost *string
+}
+
+// newChangesetFilter adds the flags of a changesetFilter to flagSet. states are
+// the states selected if -state is not given.
+func newChangesetFilter(flagSet *flag.FlagSet, states string) *changesetFilter {
+	return &changesetFilter{
+		campaign: flagSet.String("campaign", "", "The name or ID of the campaign. (required)"),
+		states:   flagSet.String("state", states, "Only select changesets in one of these comma-separated states, e.g. OPEN,CLOSED."),
+		codeHost: flagSet.String("code-host", "", `Only select changesets on code hosts of this type, e.g. "github" or "bitbucketServer".`),
+	}
+}
+
+func (f *changesetFilter) validate() error {
+	if *f.campaign == "" {
+		return &usageError{errors.New("-campaign must be specified")}
+	}
+	return nil
+}
+
+// matches returns whether c is selected by the filter.
+func (f *changesetFilter) matches(c campaignChangeset) bool {
+	if *f.states != "" {
+		found := false
+		for _, state := range strings.Split(*f.states, ",") {
+			if strings.EqualFold(strings.TrimSpace(state), c.State) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return *f.codeHost == "" || strings.EqualFold(*f.codeHost, c.ExternalURL.ServiceType)
+}
+
+// campaignChangeset is a changeset of a campaign, as returned by
+// campaignChangesets.
+type campaignChangeset struct {
+	ID          string
+	State       string
+	ReviewState string
+	Repository  struct {
+		ID   string
+		Name string
+	}
+	ExternalURL struct {
+		URL         string
+		ServiceType string
+	}
+}
+
+// campaignChangesets returns the ID of the campaign selected by filter and
+// those of its changesets that are selected by it.
+func campaignChangesets(ctx context.Context, client api.Client, filter *changesetFilter) (string, []campaignChangeset, error) {
+	campaignID, err := campaignIDByName(ctx, client, *filter.campaign)
+	if err != nil {
+		return "", nil, err
+	}
+
+	query := `
+query CampaignChangesets($campaign: ID!, $first: Int!, $after: String) {
+	node(id: $campaign) {
+		... on Campaign {
+			changesets(first: $first, after: $after) {
+				nodes {
+					id
+					state
+					reviewState
+					repository {
+						id
+						name
+					}
+					externalURL {
+						url
+						serviceType
+					}
+				}
+				pageInfo {
+					endCursor
+					hasNextPage
+				}
+			}
+		}
+	}
+}
+`
+	var changesets []campaignChangeset
+	err = fetchPages(func(after *string) (*pageInfo, error) {
+		var result struct {
+			Node struct {
+				Changesets struct {
+					Nodes    []campaignChangeset
+					PageInfo pageInfo
+				}
+			}
+		}
+		if ok, err := client.NewRequest(query, map[string]interface{}{
+			"campaign": campaignID,
+			"first":    campaignsPageSize,
+			"after":    after,
+		}).Do(ctx, &result); err != nil || !ok {
+			return nil, err
+		}
+		for _, c := range result.Node.Changesets.Nodes {
+			if filter.matches(c) {
+				changesets = append(changesets, c)
+			}
+		}
+		return &result.Node.Changesets.PageInfo, nil
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return campaignID, changesets, nil
+}
+
+// campaignIDByName returns the ID of the campaign with the given name or ID.
+func campaignIDByName(ctx context.Context, client api.Client, name string) (string, error) {
+	campaigns, requested, err := listCampaigns(ctx, client)
+	if err != nil || !requested {
+		return "", err
+	}
+
+	var ids []string
+	for _, c := range campaigns {
+		if c.ID == name {
+			return c.ID, nil
+		}
+		if c.Name == name {
+			ids = append(ids, c.ID)
+		}
+	}
+	switch len(ids) {
+	case 0:
+		return "", fmt.Errorf("campaign %q not found", name)
+	case 1:
+		return ids[0], nil
+	default:
+		return "", fmt.Errorf("there are %d campaigns named %q, use the ID of the campaign instead: %s", len(ids), name, strings.Join(ids, ", "))
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/src-cli/internal/api"
+)
+
+// changesetBulkOperation is a 'src changesets' command that runs a bulk
+// operation on the selected changesets.
+type changesetBulkOperation struct {
+	name        string
+	description string
+	// states are the states of the selected changesets if -state is not
+	// given.
+	states string
+	// confirm is true if the operation changes changesets on their code
+	// hosts and requires confirmation.
+	confirm  bool
+	mutation string
+}
+
+var changesetBulkOperations = []changesetBulkOperation{
+	{
+		name:        "retry",
+		description: "Retry publishing or updating the changesets of a campaign that failed.",
+		states:      "FAILED",
+		mutation: `
+mutation ReenqueueChangesets($campaign: ID!, $changesets: [ID!]!) {
+	reenqueueChangesets(campaign: $campaign, changesets: $changesets) {
+		id
+		state
+	}
+}
+`,
+	},
+	{
+		name:        "merge",
+		description: "Merge the changesets of a campaign on their code hosts.",
+		states:      "OPEN",
+		confirm:     true,
+		mutation: `
+mutation MergeChangesets($campaign: ID!, $changesets: [ID!]!, $squash: Boolean!) {
+	mergeChangesets(campaign: $campaign, changesets: $changesets, squash: $squash) {
+		id
+		state
+	}
+}
+`,
+	},
+	{
+		name:        "close",
+		description: "Close the changesets of a campaign on their code hosts.",
+		states:      "OPEN",
+		confirm:     true,
+		mutation: `
+mutation CloseChangesets($campaign: ID!, $changesets: [ID!]!) {
+	closeChangesets(campaign: $campaign, changesets: $changesets) {
+		id
+		state
+	}
+}
+`,
+	},
+}
+
+func init() {
+	for _, op := range changesetBulkOperations {
+		registerChangesetBulkOperation(op)
+	}
+}
+
+func registerChangesetBulkOperation(op changesetBulkOperation) {
+	usage := fmt.Sprintf(`
+%s
+
+By default, the changesets in the state %s are selected. The operation runs in the background on the Sourcegraph instance.
+
+Examples:
+
+  %s the changesets of the campaign "update-go":
+
+    	$ src changesets %s -campaign update-go
+
+  Only those on GitHub:
+
+    	$ src changesets %s -campaign update-go -code-host github
+
+`, op.description, op.states, op.name, op.name, op.name)
+
+	flagSet := flag.NewFlagSet(op.name, flag.ExitOnError)
+	usageFunc := func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'src changesets %s':\n", flagSet.Name())
+		flagSet.PrintDefaults()
+		fmt.Println(usage)
+	}
+	var (
+		filter     = newChangesetFilter(flagSet, op.states)
+		yesFlag    *bool
+		squashFlag *bool
+		apiFlags   = api.NewFlags(flagSet)
+	)
+	if op.confirm {
+		yesFlag = flagSet.Bool("yes", false, "Do not ask for confirmation.")
+	}
+	if op.name == "merge" {
+		squashFlag = flagSet.Bool("squash", false, "Squash the commits of each changeset when merging it.")
+	}
+
+	handler := func(args []string) error {
+		if err := flagSet.Parse(args); err != nil {
+			return err
+		}
+		if err := filter.validate(); err != nil {
+			return err
+		}
+
+		ctx := context.Background()
+		client := cfg.apiClient(apiFlags, flagSet.Output())
+
+		campaignID, changesets, err := campaignChangesets(ctx, client, filter)
+		if err != nil {
+			return err
+		}
+		if len(changesets) == 0 {
+			fmt.Println("No changesets selected.")
+			return nil
+		}
+
+		if yesFlag != nil && !*yesFlag {
+			ok, err := askForConfirmation(fmt.Sprintf("%s %d changesets of campaign %q?", op.name, len(changesets), *filter.campaign))
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return errors.New("aborted")
+			}
+		}
+
+		ids := make([]string, len(changesets))
+		for i, c := range changesets {
+			ids[i] = c.ID
+		}
+		vars := map[string]interface{}{
+			"campaign":   campaignID,
+			"changesets": ids,
+		}
+		if squashFlag != nil {
+			vars["squash"] = *squashFlag
+		}
+
+		var result map[string]struct{ ID, State string }
+		if ok, err := client.NewRequest(op.mutation, vars).Do(ctx, &result); err != nil || !ok {
+			return err
+		}
+		for _, bulkOperation := range result {
+			fmt.Printf("Started bulk operation %s (%s) to %s %d changesets.\n", bulkOperation.ID, bulkOperation.State, op.name, len(changesets))
+		}
+		return nil
+	}
+
+	// Register the command.
+	changesetsCommands = append(changesetsCommands, &command{
+		flagSet:   flagSet,
+		handler:   handler,
+		usageFunc: usageFunc,
+	})
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/sourcegraph/src-cli/internal/api"
+)
+
+func init() {
+	usage := `
+Examples:
+
+  List the changesets of the campaign "update-go":
+
+    	$ src changesets list -campaign update-go
+
+  List the URLs of the open changesets of the campaign on GitHub:
+
+    	$ src changesets list -campaign update-go -state OPEN -code-host github -f '{{.ExternalURL.URL}}'
+
+`
+
+	flagSet := flag.NewFlagSet("list", flag.ExitOnError)
+	usageFunc := func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'src changesets %s':\n", flagSet.Name())
+		flagSet.PrintDefaults()
+		fmt.Println(usage)
+	}
+	var (
+		filter           = newChangesetFilter(flagSet, "")
+		formatFlag       = flagSet.String("f", "{{.ID}} {{.State}} {{.Repository.Name}} {{.ExternalURL.URL}}", `Format for the output, using the syntax of Go package text/template. (e.g. "{{.ExternalURL.URL}}" or "{{.|json}}")`)
+		templateFileFlag = flagSet.String("template-file", "", templateFileFlagUsage)
+		apiFlags         = api.NewFlags(flagSet)
+	)
+
+	handler := func(args []string) error {
+		if err := flagSet.Parse(args); err != nil {
+			return err
+		}
+		if err := filter.validate(); err != nil {
+			return err
+		}
+
+		tmpl, err := parseTemplateOrFile(*formatFlag, *templateFileFlag)
+		if err != nil {
+			return err
+		}
+
+		client := cfg.apiClient(apiFlags, flagSet.Output())
+		_, changesets, err := campaignChangesets(context.Background(), client, filter)
+		if err != nil {
+			return err
+		}
+
+		for _, c := range changesets {
+			if err := execTemplate(tmpl, c); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// Register the command.
+	changesetsCommands = append(changesetsCommands, &command{
+		flagSet:   flagSet,
+		handler:   handler,
+		usageFunc: usageFunc,
+	})
+}
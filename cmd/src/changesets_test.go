@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/sourcegraph/src-cli/internal/api"
+)
+
+func TestChangesetFilterMatches(t *testing.T) {
+	changeset := func(state, serviceType string) campaignChangeset {
+		var c campaignChangeset
+		c.State = state
+		c.ExternalURL.ServiceType = serviceType
+		return c
+	}
+
+	tests := map[string]struct {
+		args      []string
+		changeset campaignChangeset
+		want      bool
+	}{
+		"no filters": {
+			args:      []string{"-campaign", "c"},
+			changeset: changeset("OPEN", "github"),
+			want:      true,
+		},
+		"matching state": {
+			args:      []string{"-campaign", "c", "-state", "closed, open"},
+			changeset: changeset("OPEN", "github"),
+			want:      true,
+		},
+		"other state": {
+			args:      []string{"-campaign", "c", "-state", "MERGED"},
+			changeset: changeset("OPEN", "github"),
+			want:      false,
+		},
+		"matching code host": {
+			args:      []string{"-campaign", "c", "-code-host", "GitHub"},
+			changeset: changeset("OPEN", "github"),
+			want:      true,
+		},
+		"other code host": {
+			args:      []string{"-campaign", "c", "-state", "OPEN", "-code-host", "bitbucketServer"},
+			changeset: changeset("OPEN", "github"),
+			want:      false,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			flagSet := flag.NewFlagSet("test", flag.ContinueOnError)
+			filter := newChangesetFilter(flagSet, "")
+			if err := flagSet.Parse(tc.args); err != nil {
+				t.Fatal(err)
+			}
+			if have := filter.matches(tc.changeset); have != tc.want {
+				t.Errorf("unexpected result: have %v; want %v", have, tc.want)
+			}
+		})
+	}
+}
+
+func TestCampaignChangesetsPaginated(t *testing.T) {
+	// Both the campaigns and the changesets are returned in two pages.
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Query     string
+			Variables struct{ After *string }
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatal(err)
+		}
+		firstPage := req.Variables.After == nil
+		switch {
+		case strings.Contains(req.Query, "query Campaigns(") && firstPage:
+			w.Write([]byte(`{"data": {"campaigns": {"nodes": [{"id": "Q2FtcGFpZ246MQ==", "name": "other"}], "pageInfo": {"endCursor": "1", "hasNextPage": true}}}}`))
+		case strings.Contains(req.Query, "query Campaigns("):
+			w.Write([]byte(`{"data": {"campaigns": {"nodes": [{"id": "Q2FtcGFpZ246Mg==", "name": "gofmt"}], "pageInfo": {"hasNextPage": false}}}}`))
+		case firstPage:
+			w.Write([]byte(`{"data": {"node": {"changesets": {"nodes": [{"id": "a", "state": "OPEN"}, {"id": "b", "state": "MERGED"}], "pageInfo": {"endCursor": "1", "hasNextPage": true}}}}}`))
+		default:
+			w.Write([]byte(`{"data": {"node": {"changesets": {"nodes": [{"id": "c", "state": "OPEN"}], "pageInfo": {"hasNextPage": false}}}}}`))
+		}
+	}))
+	defer ts.Close()
+	client := api.NewClient(api.ClientOpts{Endpoint: ts.URL, Out: ioutil.Discard})
+
+	flagSet := flag.NewFlagSet("test", flag.ContinueOnError)
+	filter := newChangesetFilter(flagSet, "OPEN")
+	if err := flagSet.Parse([]string{"-campaign", "gofmt"}); err != nil {
+		t.Fatal(err)
+	}
+
+	campaignID, changesets, err := campaignChangesets(context.Background(), client, filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if campaignID != "Q2FtcGFpZ246Mg==" {
+		t.Errorf("unexpected campaign ID %q", campaignID)
+	}
+	var ids []string
+	for _, c := range changesets {
+		ids = append(ids, c.ID)
+	}
+	if diff := cmp.Diff([]string{"a", "c"}, ids); diff != "" {
+		t.Errorf("unexpected changesets (-want +have):\n%s", diff)
+	}
+}
@@ -1,12 +1,15 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"os"
 	"strings"
+
+	"github.com/sourcegraph/src-cli/internal/api"
 )
 
 // command is a subcommand handler and its flag set.
@@ -50,6 +53,9 @@ func (c commander) run(flagSet *flag.FlagSet, cmdName, usageText string, args []
 	if !flagSet.Parsed() {
 		_ = flagSet.Parse(args)
 	}
+	if flagSet == flag.CommandLine {
+		applyGlobalFlags()
+	}
 
 	// Print usage if the command is "help".
 	if flagSet.Arg(0) == "help" || flagSet.NArg() == 0 {
@@ -71,7 +77,7 @@ func (c commander) run(flagSet *flag.FlagSet, cmdName, usageText string, args []
 	}
 
 	// Find the subcommand to execute.
-	name := flagSet.Arg(0)
+	name := resolveRenamedCommand(cmdName, flagSet.Arg(0))
 	for _, cmd := range c {
 		if !cmd.matches(name) {
 			continue
@@ -79,38 +85,50 @@ func (c commander) run(flagSet *flag.FlagSet, cmdName, usageText string, args []
 
 		// Read global configuration now.
 		var err error
+		projectCfg, err = readProjectConfig()
+		if err != nil {
+			log.Fatal("reading project config: ", err)
+		}
 		cfg, err = readConfig()
 		if err != nil {
 			log.Fatal("reading config: ", err)
 		}
 
+		// Requests identify the command, e.g. "actions exec", in their
+		// User-Agent.
+		commandName := strings.TrimPrefix(cmdName+" "+cmd.flagSet.Name(), "src ")
+		api.UserAgent = api.FormatUserAgent(buildTag, commandName, *requestSource)
+
 		// Parse subcommand flags.
-		args := flagSet.Args()[1:]
+		args := rewriteRenamedFlags(cmdName+" "+cmd.flagSet.Name(), flagSet.Args()[1:])
 		if err := cmd.flagSet.Parse(args); err != nil {
 			panic(fmt.Sprintf("all registered commands should use flag.ExitOnError: error: %s", err))
 		}
+		// Flags that weren't given explicitly default to the values in the
+		// project configuration.
+		if err := projectCfg.applyFlagDefaults(commandName, cmd.flagSet); err != nil {
+			log.Fatal("applying project config: ", err)
+		}
 
 		// Execute the subcommand.
-		if err := cmd.handler(flagSet.Args()[1:]); err != nil {
-			if _, ok := err.(*usageError); ok {
-				log.Println(err)
+		if err := cmd.handler(args); err != nil {
+			commandErr = err
+			code := errorExitCode(err)
+			reportError(err, code)
+			if _, ok := err.(*usageError); ok && *errorFormat != "json" {
 				cmd.flagSet.Usage()
-				os.Exit(2)
 			}
-			if e, ok := err.(*exitCodeError); ok {
-				if e.error != nil {
-					log.Println(e.error)
-				}
-				os.Exit(e.exitCode)
-			}
-			log.Fatal(err)
+			exit(code)
 		}
-		os.Exit(0)
+		exit(0)
 	}
 	log.Printf("%s: unknown subcommand %q", cmdName, name)
 	log.Fatalf("Run '%s help' for usage.", cmdName)
 }
 
+// commandErr is the error returned by the executed subcommand, if any.
+var commandErr error
+
 // usageError is an error type that subcommands can return in order to signal
 // that a usage error has occurred.
 type usageError struct {
@@ -131,10 +149,123 @@ func (e *exitCodeError) Error() string {
 	return fmt.Sprintf("exit code: %d", e.exitCode)
 }
 
+// The exit codes below are used consistently across all commands, so that
+// wrappers can tell different kinds of failures apart.
 const (
-	graphqlErrorsExitCode = 2
+	// exitCodeFailure is used for all failures not covered below, including
+	// GraphQL errors other than those in graphqlErrorExitCodes.
+	exitCodeFailure = 1
+	// exitCodeUsage is used when flags or arguments are invalid. It used to
+	// be reserved for GraphQL errors, but was never returned for them.
+	exitCodeUsage = 2
+	// exitCodeValidation is used when input, such as an action definition,
+	// fails validation.
+	exitCodeValidation = 3
+	// exitCodePartialFailure is used when a command ran, but failed for some
+	// of its inputs, e.g. for some repositories.
+	exitCodePartialFailure = 4
+	// exitCodeAuth is used when the Sourcegraph instance rejected our
+	// credentials.
+	exitCodeAuth = 5
+	// exitCodeNetwork is used when the Sourcegraph instance could not be
+	// reached.
+	exitCodeNetwork = 6
+	// exitCodeNotFound is used when the GraphQL API reported that something
+	// doesn't exist.
+	exitCodeNotFound = 7
+	// exitCodeRateLimited is used when the GraphQL API rejected a request
+	// because of rate limiting.
+	exitCodeRateLimited = 8
+	// exitCodeLicense is used when a feature requires a license the
+	// Sourcegraph instance doesn't have.
+	exitCodeLicense = 9
 )
 
+var errorTypes = map[int]string{
+	exitCodeFailure:        "failure",
+	exitCodeUsage:          "usage",
+	exitCodeValidation:     "validation",
+	exitCodePartialFailure: "partial_failure",
+	exitCodeAuth:           "auth",
+	exitCodeNetwork:        "network",
+	exitCodeNotFound:       "not_found",
+	exitCodeRateLimited:    "rate_limited",
+	exitCodeLicense:        "license",
+}
+
+// graphqlErrorExitCodes maps the kinds of GraphQL errors to exit codes.
+var graphqlErrorExitCodes = map[api.GraphQLErrorKind]int{
+	api.GraphQLErrorUnauthorized:    exitCodeAuth,
+	api.GraphQLErrorNotFound:        exitCodeNotFound,
+	api.GraphQLErrorRateLimited:     exitCodeRateLimited,
+	api.GraphQLErrorLicenseRequired: exitCodeLicense,
+}
+
+// errorExitCode returns the exit code that should be used when a command
+// fails with err.
+func errorExitCode(err error) int {
+	switch e := err.(type) {
+	case *usageError:
+		return exitCodeUsage
+	case *exitCodeError:
+		return e.exitCode
+	}
+
+	var httpErr *api.HTTPError
+	if errors.As(err, &httpErr) && httpErr.Unauthorized() {
+		return exitCodeAuth
+	}
+	var netErr *api.NetworkError
+	if errors.As(err, &netErr) {
+		return exitCodeNetwork
+	}
+	var gqlErrs api.GraphQLErrors
+	if errors.As(err, &gqlErrs) {
+		if code, ok := graphqlErrorExitCodes[gqlErrs.Kind()]; ok {
+			return code
+		}
+	}
+	return exitCodeFailure
+}
+
+// reportError prints err to stderr, either as plain text or, if
+// -error-format=json was given, as a JSON object of the form:
+//
+//	{"error": {"type": "auth", "message": "...", "exitCode": 5}}
+func reportError(err error, code int) {
+	msg := err.Error()
+	if e, ok := err.(*exitCodeError); ok {
+		// The command has already reported the details itself.
+		msg = ""
+		if e.error != nil {
+			msg = e.error.Error()
+		}
+	}
+
+	if *errorFormat != "json" {
+		if msg != "" {
+			log.Println(msg)
+		}
+		return
+	}
+
+	typ, ok := errorTypes[code]
+	if !ok {
+		typ = errorTypes[exitCodeFailure]
+	}
+	var out struct {
+		Error struct {
+			Type     string `json:"type"`
+			Message  string `json:"message,omitempty"`
+			ExitCode int    `json:"exitCode"`
+		} `json:"error"`
+	}
+	out.Error.Type = typ
+	out.Error.Message = msg
+	out.Error.ExitCode = code
+	_ = json.NewEncoder(os.Stderr).Encode(out)
+}
+
 func didYouMeanOtherCommand(actual string, suggested []string) *command {
 	fullSuggestions := make([]string, len(suggested))
 	for i, s := range suggested {
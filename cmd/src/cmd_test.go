@@ -0,0 +1,37 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	pkgerrors "github.com/pkg/errors"
+	"github.com/sourcegraph/src-cli/internal/api"
+)
+
+func TestErrorExitCode(t *testing.T) {
+	testCases := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "generic", err: errors.New("boom"), want: exitCodeFailure},
+		{name: "usage", err: &usageError{errors.New("bad flag")}, want: exitCodeUsage},
+		{name: "explicit", err: &exitCodeError{exitCode: exitCodeValidation}, want: exitCodeValidation},
+		{name: "unauthorized", err: pkgerrors.Wrap(&api.HTTPError{StatusCode: 401}, "listing repositories"), want: exitCodeAuth},
+		{name: "server error", err: &api.HTTPError{StatusCode: 500}, want: exitCodeFailure},
+		{name: "network", err: fmt.Errorf("querying: %w", &api.NetworkError{Err: errors.New("connection refused")}), want: exitCodeNetwork},
+		{name: "graphql not found", err: pkgerrors.Wrap(api.GraphQLErrors{{Message: "campaign not found"}}, "getting campaign"), want: exitCodeNotFound},
+		{name: "graphql unauthorized code", err: api.GraphQLErrors{{Message: "denied", Extensions: map[string]interface{}{"code": "UNAUTHORIZED"}}}, want: exitCodeAuth},
+		{name: "graphql mixed kinds", err: api.GraphQLErrors{{Message: "rate limit exceeded"}, {Message: "must be site admin"}}, want: exitCodeFailure},
+		{name: "graphql other", err: api.GraphQLErrors{{Message: "syntax error"}}, want: exitCodeFailure},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			if have := errorExitCode(testCase.err); have != testCase.want {
+				t.Errorf("unexpected exit code: have %d; want %d", have, testCase.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/src-cli/internal/api"
+)
+
+var codeownersCommands commander
+
+func init() {
+	usage := `'src codeowners' is a tool that manages the code ownership data of repositories on a Sourcegraph instance.
+
+Ownership data is given in the format of CODEOWNERS files, which are used for a repository instead of the
+CODEOWNERS file in it, if any. It requires Sourcegraph 5.1 or later.
+
+Usage:
+
+	src codeowners command [command options]
+
+The commands are:
+
+	upload    uploads the ownership data of a repository
+	get       prints the ownership data of a repository
+	list      lists the repositories with uploaded ownership data
+	delete    deletes the ownership data of repositories
+
+Use "src codeowners [command] -h" for more information about a command.
+`
+
+	flagSet := flag.NewFlagSet("codeowners", flag.ExitOnError)
+	handler := func(args []string) error {
+		codeownersCommands.run(flagSet, "src codeowners", usage, args)
+		return nil
+	}
+
+	// Register the command.
+	commands = append(commands, &command{
+		flagSet: flagSet,
+		aliases: []string{"ownership"},
+		handler: handler,
+		usageFunc: func() {
+			fmt.Println(usage)
+		},
+	})
+}
+
+const codeownersFileFragment = `
+fragment CodeownersFileFields on CodeownersIngestedFile {
+	id
+	contents
+	repository {
+		name
+	}
+	createdAt
+	updatedAt
+}
+`
+
+// codeownersFile is the ownership data uploaded for a repository.
+type codeownersFile struct {
+	ID         string
+	Contents   string
+	Repository struct {
+		Name string
+	}
+	CreatedAt string
+	UpdatedAt string
+}
+
+// requireCodeownersSupport returns an error if the Sourcegraph instance
+// doesn't support uploading ownership data.
+func requireCodeownersSupport(ctx context.Context, client api.Client) error {
+	version, err := getSourcegraphVersion(ctx, client)
+	if err != nil {
+		return err
+	}
+	supported, err := sourcegraphVersionCheck(version, ">= 5.1.0", "2023-06-01")
+	if err != nil {
+		return err
+	}
+	if !supported {
+		return &exitCodeError{
+			error:    errors.Errorf("the Sourcegraph instance (version %s) doesn't support ownership data, it requires Sourcegraph 5.1 or later", version),
+			exitCode: exitCodeValidation,
+		}
+	}
+	return nil
+}
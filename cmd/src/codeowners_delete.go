@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/src-cli/internal/api"
+)
+
+func init() {
+	usage := `
+Examples:
+
+  Delete the ownership data uploaded for repositories, so that their CODEOWNERS files are used again:
+
+    	$ src codeowners delete github.com/my-org/my-repo github.com/my-org/my-repo2
+
+`
+
+	flagSet := flag.NewFlagSet("delete", flag.ExitOnError)
+	usageFunc := func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'src codeowners %s':\n", flagSet.Name())
+		flagSet.PrintDefaults()
+		fmt.Println(usage)
+	}
+	apiFlags := api.NewFlags(flagSet)
+
+	handler := func(args []string) error {
+		flagSet.Parse(args)
+
+		if flagSet.NArg() == 0 {
+			return &usageError{errors.New("expected at least one repository")}
+		}
+
+		ctx := context.Background()
+		client := cfg.apiClient(apiFlags, flagSet.Output())
+		if err := requireCodeownersSupport(ctx, client); err != nil {
+			return err
+		}
+
+		repos := make([]map[string]interface{}, flagSet.NArg())
+		for i, name := range flagSet.Args() {
+			repos[i] = map[string]interface{}{"repoName": name}
+		}
+		query := `mutation DeleteCodeowners($repos: [DeleteCodeownersFilesInput!]!) {
+	deleteCodeownersFiles(repositories: $repos) {
+		alwaysNil
+	}
+}`
+		var result struct{}
+		if ok, err := client.NewRequest(query, map[string]interface{}{
+			"repos": repos,
+		}).Do(ctx, &result); err != nil || !ok {
+			return err
+		}
+		for _, name := range flagSet.Args() {
+			fmt.Printf("Ownership data of %s deleted\n", name)
+		}
+		return nil
+	}
+
+	// Register the command.
+	codeownersCommands = append(codeownersCommands, &command{
+		flagSet:   flagSet,
+		handler:   handler,
+		usageFunc: usageFunc,
+	})
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/src-cli/internal/api"
+)
+
+func init() {
+	usage := `
+Examples:
+
+  Print the ownership data uploaded for a repository:
+
+    	$ src codeowners get -repo github.com/my-org/my-repo
+
+  Print when it was last updated:
+
+    	$ src codeowners get -repo github.com/my-org/my-repo -f '{{.UpdatedAt}}'
+
+`
+
+	flagSet := flag.NewFlagSet("get", flag.ExitOnError)
+	usageFunc := func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'src codeowners %s':\n", flagSet.Name())
+		flagSet.PrintDefaults()
+		fmt.Println(usage)
+	}
+	var (
+		repoFlag   = flagSet.String("repo", "", "The name of the repository. (required)")
+		formatFlag = flagSet.String("f", "{{.Contents}}", `Format for the output, using the syntax of Go package text/template. (e.g. "{{.UpdatedAt}}" or "{{.|json}}")`)
+		apiFlags   = api.NewFlags(flagSet)
+	)
+
+	handler := func(args []string) error {
+		flagSet.Parse(args)
+
+		if *repoFlag == "" {
+			return &usageError{errors.New("-repo must be given")}
+		}
+		tmpl, err := parseTemplate(*formatFlag)
+		if err != nil {
+			return err
+		}
+
+		ctx := context.Background()
+		client := cfg.apiClient(apiFlags, flagSet.Output())
+		if err := requireCodeownersSupport(ctx, client); err != nil {
+			return err
+		}
+
+		query := `query CodeownersFile($repo: String!) {
+	repository(name: $repo) {
+		ingestedCodeowners {
+			...CodeownersFileFields
+		}
+	}
+}
+` + codeownersFileFragment
+
+		var result struct {
+			Repository *struct {
+				IngestedCodeowners *codeownersFile
+			}
+		}
+		if ok, err := client.NewRequest(query, map[string]interface{}{
+			"repo": *repoFlag,
+		}).Do(ctx, &result); err != nil || !ok {
+			return err
+		}
+		if result.Repository == nil {
+			return &exitCodeError{error: errors.Errorf("repository %q not found", *repoFlag), exitCode: exitCodeNotFound}
+		}
+		if result.Repository.IngestedCodeowners == nil {
+			return &exitCodeError{error: errors.Errorf("no ownership data was uploaded for %s", *repoFlag), exitCode: exitCodeNotFound}
+		}
+		return execTemplate(tmpl, result.Repository.IngestedCodeowners)
+	}
+
+	// Register the command.
+	codeownersCommands = append(codeownersCommands, &command{
+		flagSet:   flagSet,
+		handler:   handler,
+		usageFunc: usageFunc,
+	})
+}
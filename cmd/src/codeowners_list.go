@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/sourcegraph/src-cli/internal/api"
+)
+
+func init() {
+	usage := `
+Examples:
+
+  List the repositories with uploaded ownership data:
+
+    	$ src codeowners list
+
+  List them with the date of the last update:
+
+    	$ src codeowners list -f '{{.Repository.Name}} {{.UpdatedAt}}'
+
+`
+
+	flagSet := flag.NewFlagSet("list", flag.ExitOnError)
+	usageFunc := func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'src codeowners %s':\n", flagSet.Name())
+		flagSet.PrintDefaults()
+		fmt.Println(usage)
+	}
+	var (
+		firstFlag  = flagSet.Int("first", 1000, "Returns the first n repositories.")
+		formatFlag = flagSet.String("f", "{{.Repository.Name}}", `Format for the output, using the syntax of Go package text/template. (e.g. "{{.Repository.Name}}: {{.UpdatedAt}}" or "{{.|json}}")`)
+		apiFlags   = api.NewFlags(flagSet)
+	)
+
+	handler := func(args []string) error {
+		flagSet.Parse(args)
+
+		tmpl, err := parseTemplate(*formatFlag)
+		if err != nil {
+			return err
+		}
+
+		ctx := context.Background()
+		client := cfg.apiClient(apiFlags, flagSet.Output())
+		if err := requireCodeownersSupport(ctx, client); err != nil {
+			return err
+		}
+
+		query := `query CodeownersFiles($first: Int!) {
+	codeownersIngestedFiles(first: $first) {
+		nodes {
+			...CodeownersFileFields
+		}
+	}
+}
+` + codeownersFileFragment
+
+		var result struct {
+			CodeownersIngestedFiles struct {
+				Nodes []codeownersFile
+			}
+		}
+		if ok, err := client.NewRequest(query, map[string]interface{}{
+			"first": *firstFlag,
+		}).Do(ctx, &result); err != nil || !ok {
+			return err
+		}
+		for _, file := range result.CodeownersIngestedFiles.Nodes {
+			if err := execTemplate(tmpl, file); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// Register the command.
+	codeownersCommands = append(codeownersCommands, &command{
+		flagSet:   flagSet,
+		handler:   handler,
+		usageFunc: usageFunc,
+	})
+}
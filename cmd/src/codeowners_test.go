@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sourcegraph/src-cli/internal/api"
+)
+
+func TestCodeownersArguments(t *testing.T) {
+	for name, tc := range map[string]struct {
+		command string
+		args    []string
+		wantErr string
+	}{
+		"upload without -repo": {
+			command: "upload",
+			args:    []string{"-file", "CODEOWNERS"},
+			wantErr: "-repo and -file must be given",
+		},
+		"upload without -file": {
+			command: "upload",
+			args:    []string{"-repo", "github.com/my-org/my-repo"},
+			wantErr: "-repo and -file must be given",
+		},
+		"get without -repo": {
+			command: "get",
+			wantErr: "-repo must be given",
+		},
+		"delete without repositories": {
+			command: "delete",
+			wantErr: "expected at least one repository",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var cmd *command
+			for _, c := range codeownersCommands {
+				if c.flagSet.Name() == tc.command {
+					cmd = c
+				}
+			}
+			if cmd == nil {
+				t.Fatalf("command %q not found", tc.command)
+			}
+			// The flags keep their values between runs of the handler.
+			cmd.flagSet.VisitAll(func(f *flag.Flag) { f.Value.Set(f.DefValue) })
+
+			err := cmd.handler(tc.args)
+			if _, ok := err.(*usageError); !ok || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("unexpected error %v, want usage error %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestUploadCodeowners(t *testing.T) {
+	var mutation string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Query     string
+			Variables struct {
+				Input struct{ RepoName, FileContents string }
+			}
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range []string{"addCodeownersFile", "updateCodeownersFile"} {
+			if strings.Contains(req.Query, m+"(") {
+				mutation = m
+			}
+		}
+		if req.Variables.Input.RepoName != "github.com/my-org/my-repo" || req.Variables.Input.FileContents != "* @alice\n" {
+			t.Errorf("unexpected input %+v", req.Variables.Input)
+		}
+		w.Write([]byte(`{"data": {"file": {"id": "Q29kZW93bmVyczox", "contents": "* @alice\n", "repository": {"name": "github.com/my-org/my-repo"}}}}`))
+	}))
+	defer ts.Close()
+	client := api.NewClient(api.ClientOpts{Endpoint: ts.URL, Out: ioutil.Discard})
+
+	for replace, want := range map[bool]string{false: "addCodeownersFile", true: "updateCodeownersFile"} {
+		mutation = ""
+		file, err := uploadCodeowners(context.Background(), client, "github.com/my-org/my-repo", []byte("* @alice\n"), replace)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mutation != want {
+			t.Errorf("replace=%v: unexpected mutation %q, want %q", replace, mutation, want)
+		}
+		if file == nil || file.ID != "Q29kZW93bmVyczox" || file.Repository.Name != "github.com/my-org/my-repo" {
+			t.Errorf("replace=%v: unexpected file %+v", replace, file)
+		}
+	}
+}
+
+func TestRequireCodeownersSupport(t *testing.T) {
+	for version, wantErr := range map[string]bool{
+		"5.1.0":                     false,
+		"5.0.3":                     true,
+		"0.0.0+dev":                 false,
+		"210000_2023-06-02_abcdef0": false,
+		"200000_2023-05-01_abcdef0": true,
+	} {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"data": {"site": {"productVersion": "` + version + `"}}}`))
+		}))
+		client := api.NewClient(api.ClientOpts{Endpoint: ts.URL, Out: ioutil.Discard})
+
+		err := requireCodeownersSupport(context.Background(), client)
+		ts.Close()
+		if !wantErr {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", version, err)
+			}
+			continue
+		}
+		if e, ok := err.(*exitCodeError); !ok || e.exitCode != exitCodeValidation {
+			t.Errorf("%s: unexpected error %v, want validation error", version, err)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/src-cli/internal/api"
+)
+
+func init() {
+	usage := `
+Examples:
+
+  Upload the ownership data of a repository from a file in the CODEOWNERS format:
+
+    	$ src codeowners upload -repo github.com/my-org/my-repo -file CODEOWNERS
+
+  Replace the ownership data uploaded before, reading it from standard input:
+
+    	$ generate-owners | src codeowners upload -repo github.com/my-org/my-repo -file - -replace
+
+`
+
+	flagSet := flag.NewFlagSet("upload", flag.ExitOnError)
+	usageFunc := func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'src codeowners %s':\n", flagSet.Name())
+		flagSet.PrintDefaults()
+		fmt.Println(usage)
+	}
+	var (
+		repoFlag    = flagSet.String("repo", "", "The name of the repository. (required)")
+		fileFlag    = flagSet.String("file", "", `The file with the ownership data in the CODEOWNERS format, or "-" for standard input. (required)`)
+		replaceFlag = flagSet.Bool("replace", false, "Replace the ownership data uploaded before. Without it, uploading fails if the repository already has ownership data.")
+		formatFlag  = flagSet.String("f", "Ownership data of {{.Repository.Name}} uploaded", `Format for the output, using the syntax of Go package text/template. (e.g. "{{.ID}}" or "{{.|json}}")`)
+		apiFlags    = api.NewFlags(flagSet)
+	)
+
+	handler := func(args []string) error {
+		flagSet.Parse(args)
+
+		if *repoFlag == "" || *fileFlag == "" {
+			return &usageError{errors.New("-repo and -file must be given")}
+		}
+		tmpl, err := parseTemplate(*formatFlag)
+		if err != nil {
+			return err
+		}
+
+		var contents []byte
+		if *fileFlag == "-" {
+			contents, err = ioutil.ReadAll(os.Stdin)
+		} else {
+			contents, err = ioutil.ReadFile(*fileFlag)
+		}
+		if err != nil {
+			return err
+		}
+
+		ctx := context.Background()
+		client := cfg.apiClient(apiFlags, flagSet.Output())
+		if err := requireCodeownersSupport(ctx, client); err != nil {
+			return err
+		}
+
+		file, err := uploadCodeowners(ctx, client, *repoFlag, contents, *replaceFlag)
+		if err != nil || file == nil {
+			return err
+		}
+		return execTemplate(tmpl, file)
+	}
+
+	// Register the command.
+	codeownersCommands = append(codeownersCommands, &command{
+		flagSet:   flagSet,
+		handler:   handler,
+		usageFunc: usageFunc,
+	})
+}
+
+// uploadCodeowners uploads contents as the ownership data of repo, replacing
+// the data uploaded before if replace is set. It returns nil if the request
+// wasn't made, e.g. with -get-curl.
+func uploadCodeowners(ctx context.Context, client api.Client, repo string, contents []byte, replace bool) (*codeownersFile, error) {
+	mutation := "addCodeownersFile"
+	if replace {
+		mutation = "updateCodeownersFile"
+	}
+	query := fmt.Sprintf(`mutation UploadCodeowners($input: CodeownersFileInput!) {
+	file: %s(input: $input) {
+		...CodeownersFileFields
+	}
+}
+`, mutation) + codeownersFileFragment
+
+	var result struct {
+		File codeownersFile
+	}
+	if ok, err := client.NewRequest(query, map[string]interface{}{
+		"input": map[string]interface{}{
+			"repoName":     repo,
+			"fileContents": string(contents),
+		},
+	}).Do(ctx, &result); err != nil || !ok {
+		return nil, err
+	}
+	return &result.File, nil
+}
@@ -4,9 +4,9 @@ import (
 	"fmt"
 	"os"
 	"regexp"
-	"strconv"
 
-	"github.com/mattn/go-isatty"
+	"github.com/fatih/color"
+	"github.com/sourcegraph/src-cli/internal/output"
 )
 
 // Returns the string for a foreground ANSI 8 bit color code.
@@ -53,22 +53,13 @@ var ansiRegexp = regexp.MustCompile("[\u001B\u009B][[\\]()#;?]*(?:(?:(?:[a-zA-Z\
 var isTest bool
 var colorDisabled bool
 
-func init() {
+// configureColors decides whether to color output written to stdout, based on
+// the -color flag and the environment (see output.ColorEnabled). It must be
+// called after the global flags have been parsed.
+func configureColors() {
 	if !isTest {
-		// We comply with the no-color.org spec here.
-		if os.Getenv("NO_COLOR") != "" {
-			colorDisabled = true
-		} else {
-			// If they specify COLOR=true or COLOR=false, we respect that.
-			if color := os.Getenv("COLOR"); color != "" {
-				colorEnabled, _ := strconv.ParseBool(color)
-				colorDisabled = !colorEnabled
-			} else {
-				// If our program is being piped into another one, then disable
-				// color. This is usually desired, and can be overridden with COLOR=true.
-				colorDisabled = !isatty.IsTerminal(os.Stdout.Fd())
-			}
-		}
+		colorDisabled = !output.ColorEnabled(os.Stdout)
+		color.NoColor = colorDisabled
 	}
 	if colorDisabled {
 		for color := range ansiColors {
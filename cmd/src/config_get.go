@@ -33,9 +33,10 @@ Examples:
 		fmt.Println(usage)
 	}
 	var (
-		subjectFlag = flagSet.String("subject", "", "The ID of the settings subject whose settings to get. (default: authenticated user)")
-		formatFlag  = flagSet.String("f", "{{.|jsonIndent}}", `Format for the output, using the syntax of Go package text/template. (e.g. "{{.|json}}")`)
-		apiFlags    = api.NewFlags(flagSet)
+		subjectFlag      = flagSet.String("subject", "", "The ID of the settings subject whose settings to get. (default: authenticated user)")
+		formatFlag       = flagSet.String("f", "{{.|jsonIndent}}", `Format for the output, using the syntax of Go package text/template. (e.g. "{{.|json}}")`)
+		templateFileFlag = flagSet.String("template-file", "", templateFileFlagUsage)
+		apiFlags         = api.NewFlags(flagSet)
 	)
 
 	handler := func(args []string) error {
@@ -44,7 +45,7 @@ Examples:
 			return err
 		}
 
-		tmpl, err := parseTemplate(*formatFlag)
+		tmpl, err := parseTemplateOrFile(*formatFlag, *templateFileFlag)
 		if err != nil {
 			return err
 		}
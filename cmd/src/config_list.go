@@ -29,9 +29,10 @@ Examples:
 		fmt.Println(usage)
 	}
 	var (
-		subjectFlag = flagSet.String("subject", "", "The ID of the settings subject whose settings to list. (default: authenticated user)")
-		formatFlag  = flagSet.String("f", "", `Format for the output, using the syntax of Go package text/template. (e.g. "{{.|json}}")`)
-		apiFlags    = api.NewFlags(flagSet)
+		subjectFlag      = flagSet.String("subject", "", "The ID of the settings subject whose settings to list. (default: authenticated user)")
+		formatFlag       = flagSet.String("f", "", `Format for the output, using the syntax of Go package text/template. (e.g. "{{.|json}}")`)
+		templateFileFlag = flagSet.String("template-file", "", templateFileFlagUsage)
+		apiFlags         = api.NewFlags(flagSet)
 	)
 
 	handler := func(args []string) error {
@@ -51,7 +52,7 @@ Examples:
 {{- else}} (empty){{- end}}
 {{end}}`
 		}
-		tmpl, err := parseTemplate(formatStr)
+		tmpl, err := parseTemplateOrFile(formatStr, *templateFileFlag)
 		if err != nil {
 			return err
 		}
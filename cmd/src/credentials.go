@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/src-cli/internal/api"
+)
+
+// credentialHelperPrefix is the prefix of the executables that are run as
+// credential helpers, so that the helper "vault" is run as src-credential-vault.
+const credentialHelperPrefix = "src-credential-"
+
+// credentialHelperToken obtains an access token for endpoint from the given
+// credential helper.
+//
+// Like git credential helpers, helper is the name of the helper, optionally
+// followed by arguments. Unless it is an absolute path, the executable
+// src-credential-<name> is looked up in the PATH. The helper is invoked with
+// the additional argument "get" and is given the endpoint on standard input
+// as "endpoint=<url>". It must print "token=<access token>" on standard
+// output; other lines are ignored.
+func credentialHelperToken(helper, endpoint string) (string, error) {
+	args := strings.Fields(helper)
+	if len(args) == 0 {
+		return "", errors.New("empty credential helper")
+	}
+	name := args[0]
+	if !filepath.IsAbs(name) {
+		name = credentialHelperPrefix + name
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(name, append(args[1:], "get")...)
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("endpoint=%s\n\n", endpoint))
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			err = errors.Errorf("%s: %s", err, msg)
+		}
+		return "", errors.Wrapf(err, "running credential helper %s", name)
+	}
+
+	scanner := bufio.NewScanner(&stdout)
+	for scanner.Scan() {
+		if token := strings.TrimPrefix(scanner.Text(), "token="); token != scanner.Text() && token != "" {
+			return token, nil
+		}
+	}
+	return "", errors.Errorf("credential helper %s did not return a token", name)
+}
+
+// errClient is an api.Client for configurations whose access token can't be
+// obtained. All its requests fail with err.
+type errClient struct {
+	err error
+}
+
+func (c errClient) NewQuery(query string) api.Request { return c }
+
+func (c errClient) NewRequest(query string, vars map[string]interface{}) api.Request { return c }
+
+func (c errClient) Do(ctx context.Context, result interface{}) (bool, error) { return false, c.err }
+
+func (c errClient) DoRaw(ctx context.Context, result interface{}) (bool, error) { return false, c.err }
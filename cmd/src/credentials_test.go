@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestCredentialHelperToken(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("credential helpers in this test are shell scripts")
+	}
+
+	dir, err := ioutil.TempDir("", "credential-helper-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	helpers := map[string]string{
+		// Echoes its arguments and the endpoint it was given as the token.
+		"echo":    "#!/bin/sh\nread line\necho 'username=ignored'\necho \"token=$*:${line#endpoint=}\"\n",
+		"fail":    "#!/bin/sh\necho 'vault is sealed' >&2\nexit 1\n",
+		"notoken": "#!/bin/sh\necho 'username=alice'\n",
+	}
+	for name, script := range helpers {
+		if err := ioutil.WriteFile(filepath.Join(dir, credentialHelperPrefix+name), []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	oldPath := os.Getenv("PATH")
+	t.Cleanup(func() { os.Setenv("PATH", oldPath) })
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+oldPath)
+
+	tests := map[string]struct {
+		helper  string
+		want    string
+		wantErr string
+	}{
+		"name":          {helper: "echo", want: "get:https://example.com"},
+		"arguments":     {helper: "echo --path secret/src", want: "--path secret/src get:https://example.com"},
+		"absolute path": {helper: filepath.Join(dir, credentialHelperPrefix+"echo"), want: "get:https://example.com"},
+		"failure":       {helper: "fail", wantErr: "vault is sealed"},
+		"no token":      {helper: "notoken", wantErr: "did not return a token"},
+		"not found":     {helper: "missing", wantErr: "src-credential-missing"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			have, err := credentialHelperToken(tc.helper, "https://example.com")
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("unexpected error: have %v; want %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if have != tc.want {
+				t.Errorf("unexpected token: have %q; want %q", have, tc.want)
+			}
+		})
+	}
+}
+
+func TestConfigAccessToken(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the credential helper in this test is a shell script")
+	}
+
+	dir, err := ioutil.TempDir("", "credential-helper-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	// The helper counts its invocations in a file.
+	count := filepath.Join(dir, "count")
+	helper := filepath.Join(dir, credentialHelperPrefix+"count")
+	script := "#!/bin/sh\necho x >> " + count + "\necho token=from-helper\n"
+	if err := ioutil.WriteFile(helper, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	invocations := func() int {
+		data, _ := ioutil.ReadFile(count)
+		return strings.Count(string(data), "x")
+	}
+
+	old := credentialHelperTokens
+	credentialHelperTokens = map[string]string{}
+	t.Cleanup(func() { credentialHelperTokens = old })
+
+	withToken := &config{Endpoint: "https://example.com", AccessToken: "set", CredentialHelper: helper}
+	if token, err := withToken.accessToken(); err != nil || token != "set" {
+		t.Errorf("unexpected token %q, %v", token, err)
+	}
+	if n := invocations(); n != 0 {
+		t.Errorf("the helper was run %d times although a token is set", n)
+	}
+
+	for i := 0; i < 2; i++ {
+		c := &config{Endpoint: "https://example.com", CredentialHelper: helper}
+		if token, err := c.accessToken(); err != nil || token != "from-helper" {
+			t.Errorf("unexpected token %q, %v", token, err)
+		}
+	}
+	if n := invocations(); n != 1 {
+		t.Errorf("the helper was run %d times, want once", n)
+	}
+
+	failing := &config{Endpoint: "https://example.com", CredentialHelper: "missing"}
+	client := failing.apiClient(nil, ioutil.Discard)
+	if _, err := client.NewQuery("query { currentUser { id } }").Do(context.Background(), nil); err == nil || !strings.Contains(err.Error(), "src-credential-missing") {
+		t.Errorf("unexpected error %v", err)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"log"
+	"strings"
+)
+
+// renamedCommands maps the previous names of renamed subcommands to their
+// current names, keyed by the parent command (e.g. "src campaigns"). Renamed
+// commands keep working, but print a deprecation warning.
+var renamedCommands = map[string]map[string]string{
+	"src campaigns": {
+		"plans": "patchsets",
+		"plan":  "patchsets",
+	},
+}
+
+// renamedFlags maps the previous names of renamed flags to their current
+// names, keyed by the full command (e.g. "src campaigns create"). Renamed flags
+// keep working, but print a deprecation warning.
+var renamedFlags = map[string]map[string]string{
+	"src campaigns create": {
+		"plan": "patchset",
+	},
+}
+
+// resolveRenamedCommand returns the current name of the subcommand name of
+// parent, printing a deprecation warning if it was renamed.
+func resolveRenamedCommand(parent, name string) string {
+	current, ok := renamedCommands[parent][name]
+	if !ok {
+		return name
+	}
+	log.Printf("warning: '%s %s' is deprecated, use '%s %s' instead.", parent, name, parent, current)
+	return current
+}
+
+// rewriteRenamedFlags replaces renamed flags of cmd in args with their
+// current names, printing a deprecation warning for each of them.
+func rewriteRenamedFlags(cmd string, args []string) []string {
+	renamed := renamedFlags[cmd]
+	if len(renamed) == 0 {
+		return args
+	}
+
+	rewritten := make([]string, len(args))
+	copy(rewritten, args)
+	for i, arg := range rewritten {
+		if arg == "--" {
+			break
+		}
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+
+		dashes := "-"
+		if strings.HasPrefix(arg, "--") {
+			dashes = "--"
+		}
+		name, value := strings.TrimPrefix(arg, dashes), ""
+		if j := strings.Index(name, "="); j >= 0 {
+			name, value = name[:j], name[j:]
+		}
+
+		if current, ok := renamed[name]; ok {
+			log.Printf("warning: the -%s flag of '%s' is deprecated, use -%s instead.", name, cmd, current)
+			rewritten[i] = dashes + current + value
+		}
+	}
+	return rewritten
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRewriteRenamedFlags(t *testing.T) {
+	discardLog(t)
+
+	tests := map[string]struct {
+		cmd  string
+		args []string
+		want []string
+	}{
+		"no renamed flags": {
+			cmd:  "src repos list",
+			args: []string{"-plan", "x"},
+			want: []string{"-plan", "x"},
+		},
+		"renamed flag": {
+			cmd:  "src campaigns create",
+			args: []string{"-name", "n", "-plan", "Q2FtcGFpZ25QbGFuOjM="},
+			want: []string{"-name", "n", "-patchset", "Q2FtcGFpZ25QbGFuOjM="},
+		},
+		"renamed flag with value": {
+			cmd:  "src campaigns create",
+			args: []string{"--plan=Q2FtcGFpZ25QbGFuOjM="},
+			want: []string{"--patchset=Q2FtcGFpZ25QbGFuOjM="},
+		},
+		"after terminator": {
+			cmd:  "src campaigns create",
+			args: []string{"-name", "n", "--", "-plan"},
+			want: []string{"-name", "n", "--", "-plan"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.want, rewriteRenamedFlags(tc.cmd, tc.args)); diff != "" {
+				t.Errorf("unexpected args (-want +have):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestResolveRenamedCommand(t *testing.T) {
+	discardLog(t)
+
+	if have, want := resolveRenamedCommand("src campaigns", "plans"), "patchsets"; have != want {
+		t.Errorf("have %q; want %q", have, want)
+	}
+	if have, want := resolveRenamedCommand("src campaigns", "list"), "list"; have != want {
+		t.Errorf("have %q; want %q", have, want)
+	}
+}
+
+// discardLog discards the deprecation warnings logged during the test.
+func discardLog(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+}
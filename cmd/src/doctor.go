@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/src-cli/internal/api"
+	"github.com/sourcegraph/src-cli/internal/output"
+)
+
+func init() {
+	usage := `
+Diagnose common problems with the environment src runs in: whether the Sourcegraph instance is reachable and through which proxy, whether the access token is valid, whether the clock is in sync with the instance, whether Docker and git are available (required by 'src actions exec') and whether there is enough free space for temporary files.
+
+For each problem, a possible fix is printed. If a check fails, 'src doctor' exits with exit code 1.
+
+Examples:
+
+  Run all checks:
+
+    	$ src doctor
+
+`
+
+	flagSet := flag.NewFlagSet("doctor", flag.ExitOnError)
+	usageFunc := func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'src %s':\n", flagSet.Name())
+		flagSet.PrintDefaults()
+		fmt.Println(usage)
+	}
+	var (
+		timeoutFlag = flagSet.Duration("timeout", 10*time.Second, "The timeout of each check that connects to the Sourcegraph instance or runs a command.")
+		apiFlags    = api.NewFlags(flagSet)
+	)
+
+	handler := func(args []string) error {
+		if err := flagSet.Parse(args); err != nil {
+			return err
+		}
+
+		d := &doctor{
+			client:  cfg.apiClient(apiFlags, flagSet.Output()),
+			timeout: *timeoutFlag,
+		}
+		checks := []struct {
+			name string
+			run  func(ctx context.Context) doctorResult
+		}{
+			{"Proxy", d.checkProxy},
+			{"Endpoint", d.checkEndpoint},
+			{"Clock", d.checkClock},
+			{"Access token", d.checkAccessToken},
+			{"Docker", d.checkDocker},
+			{"Git", d.checkGit},
+			{"Temporary files", d.checkTempSpace},
+		}
+
+		failed := 0
+		for _, check := range checks {
+			ctx, cancel := context.WithTimeout(context.Background(), d.timeout)
+			result := check.run(ctx)
+			cancel()
+
+			switch result.status {
+			case doctorOK:
+				color.New(color.FgGreen).Printf("%s  %s: %s\n", output.Emoji(output.EmojiSuccess), check.name, result.detail)
+			case doctorWarning:
+				color.New(color.FgYellow).Printf("%s  %s: %s\n", output.Emoji(output.EmojiAlert), check.name, result.detail)
+			case doctorFailure:
+				failed++
+				color.New(color.FgRed).Printf("%s  %s: %s\n", output.Emoji(output.EmojiFailure), check.name, result.detail)
+			}
+			if result.fix != "" {
+				fmt.Printf("   %s %s\n", output.Emoji(output.EmojiArrow), result.fix)
+			}
+		}
+
+		if failed > 0 {
+			return fmt.Errorf("%d of %d checks failed", failed, len(checks))
+		}
+		return nil
+	}
+
+	// Register the command.
+	commands = append(commands, &command{
+		flagSet:   flagSet,
+		handler:   handler,
+		usageFunc: usageFunc,
+	})
+}
+
+type doctorStatus int
+
+const (
+	doctorOK doctorStatus = iota
+	doctorWarning
+	doctorFailure
+)
+
+// doctorResult is the result of a check of 'src doctor', with a suggested fix
+// if it didn't pass.
+type doctorResult struct {
+	status doctorStatus
+	detail string
+	fix    string
+}
+
+// minTempSpace is the free space for temporary files below which 'src doctor'
+// warns. 'src actions exec' extracts repository archives there.
+const minTempSpace = 1 << 30
+
+// maxClockSkew is the difference between the local clock and that of the
+// instance above which 'src doctor' warns.
+const maxClockSkew = time.Minute
+
+// doctor runs the checks of 'src doctor'. Some checks use the results of
+// previous ones.
+type doctor struct {
+	client  api.Client
+	timeout time.Duration
+
+	// serverTime is the time of the instance, taken from the Date header of
+	// its response to the endpoint check, and when it was received.
+	serverTime, localTime time.Time
+}
+
+func (d *doctor) checkProxy(ctx context.Context) doctorResult {
+	req, err := http.NewRequest("GET", cfg.Endpoint, nil)
+	if err != nil {
+		return doctorResult{status: doctorFailure, detail: fmt.Sprintf("invalid endpoint %q: %s", cfg.Endpoint, err), fix: "Set SRC_ENDPOINT to the URL of your Sourcegraph instance, e.g. https://sourcegraph.example.com."}
+	}
+	return proxyResult(req, http.ProxyFromEnvironment)
+}
+
+// proxyResult describes which proxy is used for req.
+func proxyResult(req *http.Request, proxy func(*http.Request) (*url.URL, error)) doctorResult {
+	proxyURL, err := proxy(req)
+	if err != nil {
+		return doctorResult{status: doctorFailure, detail: fmt.Sprintf("invalid proxy configuration: %s", err), fix: "Fix the value of HTTPS_PROXY or HTTP_PROXY."}
+	}
+	if proxyURL == nil {
+		return doctorResult{status: doctorOK, detail: fmt.Sprintf("requests to %s don't use a proxy", req.URL.Host)}
+	}
+	// Don't print credentials that are part of the proxy URL.
+	proxyURL.User = nil
+	return doctorResult{
+		status: doctorOK,
+		detail: fmt.Sprintf("requests to %s use the proxy %s", req.URL.Host, proxyURL),
+		fix:    "If the instance is reachable without the proxy, add its host to NO_PROXY.",
+	}
+}
+
+func (d *doctor) checkEndpoint(ctx context.Context) doctorResult {
+	req, err := http.NewRequestWithContext(ctx, "GET", cfg.Endpoint+"/.api/src-cli/version", nil)
+	if err != nil {
+		return doctorResult{status: doctorFailure, detail: err.Error()}
+	}
+	api.SetUserAgent(req)
+	for k, v := range cfg.AdditionalHeaders {
+		req.Header.Set(k, v)
+	}
+	resp, err := api.HTTPClient.Do(req)
+	if err != nil {
+		return doctorResult{
+			status: doctorFailure,
+			detail: fmt.Sprintf("%s is not reachable: %s", cfg.Endpoint, err),
+			fix:    "Check that SRC_ENDPOINT is the URL of your Sourcegraph instance and that it is reachable from this machine, e.g. with curl. Check the proxy configuration if you need one.",
+		}
+	}
+	resp.Body.Close()
+
+	if date, err := http.ParseTime(resp.Header.Get("Date")); err == nil {
+		d.serverTime, d.localTime = date, time.Now()
+	}
+	if resp.StatusCode >= 500 {
+		return doctorResult{
+			status: doctorFailure,
+			detail: fmt.Sprintf("%s responded with %s", cfg.Endpoint, resp.Status),
+			fix:    "The instance or a proxy in front of it has a problem. Check its status with your site admin.",
+		}
+	}
+	return doctorResult{status: doctorOK, detail: fmt.Sprintf("%s is reachable", cfg.Endpoint)}
+}
+
+func (d *doctor) checkClock(ctx context.Context) doctorResult {
+	if d.serverTime.IsZero() {
+		return doctorResult{status: doctorWarning, detail: "skipped, the time of the instance is not known"}
+	}
+	return clockSkewResult(d.localTime, d.serverTime)
+}
+
+// clockSkewResult compares the local time to that of the instance. The Date
+// header has a precision of one second.
+func clockSkewResult(local, server time.Time) doctorResult {
+	skew := local.Sub(server).Round(time.Second)
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > maxClockSkew {
+		return doctorResult{
+			status: doctorWarning,
+			detail: fmt.Sprintf("the local clock differs from the instance's by %s", skew),
+			fix:    "Synchronize the clock of this machine, e.g. by enabling NTP. Timestamps and expiring credentials may be off otherwise.",
+		}
+	}
+	return doctorResult{status: doctorOK, detail: "the local clock is in sync with the instance"}
+}
+
+func (d *doctor) checkAccessToken(ctx context.Context) doctorResult {
+	token, err := cfg.accessToken()
+	if err != nil {
+		return doctorResult{status: doctorFailure, detail: err.Error()}
+	}
+	if token == "" {
+		return doctorResult{
+			status: doctorWarning,
+			detail: "no access token is configured, only public data is accessible",
+			fix:    fmt.Sprintf("Create an access token at %s/user/settings/tokens and set SRC_ACCESS_TOKEN to it.", cfg.Endpoint),
+		}
+	}
+
+	var result struct {
+		CurrentUser *struct {
+			Username  string
+			SiteAdmin bool
+		}
+	}
+	ok, err := d.client.NewQuery(`query DoctorCurrentUser { currentUser { username siteAdmin } }`).Do(ctx, &result)
+	if err != nil {
+		return doctorResult{status: doctorFailure, detail: fmt.Sprintf("validating the access token failed: %s", err)}
+	}
+	if !ok {
+		return doctorResult{status: doctorWarning, detail: "skipped"}
+	}
+	if result.CurrentUser == nil {
+		return doctorResult{
+			status: doctorFailure,
+			detail: "the access token is invalid or expired",
+			fix:    fmt.Sprintf("Create a new access token at %s/user/settings/tokens and set SRC_ACCESS_TOKEN to it.", cfg.Endpoint),
+		}
+	}
+	detail := fmt.Sprintf("the access token belongs to %s", result.CurrentUser.Username)
+	if result.CurrentUser.SiteAdmin {
+		detail += ", a site admin"
+	}
+	return doctorResult{status: doctorOK, detail: detail}
+}
+
+func (d *doctor) checkDocker(ctx context.Context) doctorResult {
+	if _, err := exec.LookPath("docker"); err != nil {
+		return doctorResult{
+			status: doctorWarning,
+			detail: "docker is not installed",
+			fix:    "Install Docker to run actions with docker steps: https://docs.docker.com/get-docker/",
+		}
+	}
+	out, err := exec.CommandContext(ctx, "docker", "version", "--format", "{{.Server.Version}}").CombinedOutput()
+	if err != nil {
+		return doctorResult{
+			status: doctorWarning,
+			detail: fmt.Sprintf("the Docker daemon is not reachable: %s", strings.TrimSpace(string(out))),
+			fix:    "Start the Docker daemon and check that your user may access it, e.g. with 'docker info'.",
+		}
+	}
+	return doctorResult{status: doctorOK, detail: fmt.Sprintf("Docker %s", strings.TrimSpace(string(out)))}
+}
+
+func (d *doctor) checkGit(ctx context.Context) doctorResult {
+	out, err := exec.CommandContext(ctx, "git", "version").Output()
+	if err != nil {
+		return doctorResult{
+			status: doctorWarning,
+			detail: "git is not installed",
+			fix:    "Install git to run 'src actions exec': https://git-scm.com/downloads",
+		}
+	}
+	return doctorResult{status: doctorOK, detail: strings.TrimSpace(string(out))}
+}
+
+func (d *doctor) checkTempSpace(ctx context.Context) doctorResult {
+	// 'src actions exec' uses /tmp on all platforms but Windows.
+	dir := "/tmp"
+	if _, err := os.Stat(dir); err != nil {
+		dir = os.TempDir()
+	}
+	free, err := freeDiskSpace(dir)
+	if err != nil {
+		return doctorResult{status: doctorWarning, detail: errors.Wrapf(err, "determining the free space in %s", dir).Error()}
+	}
+	detail := fmt.Sprintf("%d MiB free in %s", free/(1<<20), dir)
+	if free < minTempSpace {
+		return doctorResult{
+			status: doctorWarning,
+			detail: detail,
+			fix:    fmt.Sprintf("Free up space in %s. 'src actions exec' extracts repositories there.", dir),
+		}
+	}
+	return doctorResult{status: doctorOK, detail: detail}
+}
@@ -100,7 +100,11 @@ Copy an extension from Sourcegraph.com to your private registry.
 			return err
 		}
 
-		response, err := http.Get(extensionResult.ExtensionRegistry.Extension.Manifest.BundleURL)
+		req, err := http.NewRequestWithContext(ctx, "GET", extensionResult.ExtensionRegistry.Extension.Manifest.BundleURL, nil)
+		if err != nil {
+			return err
+		}
+		response, err := api.HTTPClient.Do(req)
 		if err != nil {
 			return err
 		}
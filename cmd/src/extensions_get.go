@@ -26,15 +26,16 @@ Examples:
 		fmt.Println(usage)
 	}
 	var (
-		extensionIDFlag = flagSet.String("extension-id", "", `Look up extension by extension ID. (e.g. "alice/myextension")`)
-		formatFlag      = flagSet.String("f", "{{.|json}}", `Format for the output, using the syntax of Go package text/template. (e.g. "{{.ExtensionID}}: {{.Manifest.Title}} ({{.RemoteURL}})" or "{{.|json}}")`)
-		apiFlags        = api.NewFlags(flagSet)
+		extensionIDFlag  = flagSet.String("extension-id", "", `Look up extension by extension ID. (e.g. "alice/myextension")`)
+		formatFlag       = flagSet.String("f", "{{.|json}}", `Format for the output, using the syntax of Go package text/template. (e.g. "{{.ExtensionID}}: {{.Manifest.Title}} ({{.RemoteURL}})" or "{{.|json}}")`)
+		templateFileFlag = flagSet.String("template-file", "", templateFileFlagUsage)
+		apiFlags         = api.NewFlags(flagSet)
 	)
 
 	handler := func(args []string) error {
 		flagSet.Parse(args)
 
-		tmpl, err := parseTemplate(*formatFlag)
+		tmpl, err := parseTemplateOrFile(*formatFlag, *templateFileFlag)
 		if err != nil {
 			return err
 		}
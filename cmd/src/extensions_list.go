@@ -33,16 +33,17 @@ Examples:
 		fmt.Println(usage)
 	}
 	var (
-		firstFlag  = flagSet.Int("first", 1000, "Returns the first n extensions from the list. (use -1 for unlimited)")
-		queryFlag  = flagSet.String("query", "", `Returns extensions whose extension IDs match the query. (e.g. "myextension")`)
-		formatFlag = flagSet.String("f", "{{.ExtensionID}}", `Format for the output, using the syntax of Go package text/template. (e.g. "{{.ExtensionID}}: {{.Manifest.Description}} ({{.RemoteURL}})" or "{{.|json}}")`)
-		apiFlags   = api.NewFlags(flagSet)
+		firstFlag        = flagSet.Int("first", 1000, "Returns the first n extensions from the list. (use -1 for unlimited)")
+		queryFlag        = flagSet.String("query", "", `Returns extensions whose extension IDs match the query. (e.g. "myextension")`)
+		formatFlag       = flagSet.String("f", "{{.ExtensionID}}", `Format for the output, using the syntax of Go package text/template. (e.g. "{{.ExtensionID}}: {{.Manifest.Description}} ({{.RemoteURL}})" or "{{.|json}}")`)
+		templateFileFlag = flagSet.String("template-file", "", templateFileFlagUsage)
+		apiFlags         = api.NewFlags(flagSet)
 	)
 
 	handler := func(args []string) error {
 		flagSet.Parse(args)
 
-		tmpl, err := parseTemplate(*formatFlag)
+		tmpl, err := parseTemplateOrFile(*formatFlag, *templateFileFlag)
 		if err != nil {
 			return err
 		}
@@ -29,9 +29,10 @@ Examples:
 		fmt.Println(usage)
 	}
 	var (
-		firstFlag  = flagSet.Int("first", -1, "Return only the first n external services. (use -1 for unlimited)")
-		formatFlag = flagSet.String("f", "", `Format for the output, using the syntax of Go package text/template. (e.g. "{{.|json}}")`)
-		apiFlags   = api.NewFlags(flagSet)
+		firstFlag        = flagSet.Int("first", -1, "Return only the first n external services. (use -1 for unlimited)")
+		formatFlag       = flagSet.String("f", "", `Format for the output, using the syntax of Go package text/template. (e.g. "{{.|json}}")`)
+		templateFileFlag = flagSet.String("template-file", "", templateFileFlagUsage)
+		apiFlags         = api.NewFlags(flagSet)
 	)
 
 	handler := func(args []string) error {
@@ -49,7 +50,7 @@ Examples:
 			// Set default here instead of in flagSet.String because it is very long and makes the usage message ugly.
 			formatStr = `{{range .Nodes}}ID: {{.id}} | {{padRight .kind 15 " "}} | {{.displayName}}{{"\n"}}{{end}}`
 		}
-		tmpl, err := parseTemplate(formatStr)
+		tmpl, err := parseTemplateOrFile(formatStr, *templateFileFlag)
 		if err != nil {
 			return err
 		}
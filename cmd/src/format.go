@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/url"
 	"os"
 	"strings"
@@ -13,11 +14,14 @@ import (
 
 	humanize "github.com/dustin/go-humanize"
 	"github.com/fatih/color"
+	"github.com/pkg/errors"
 	"github.com/sourcegraph/jsonx"
+	"github.com/sourcegraph/src-cli/internal/output"
 )
 
 func parseTemplate(text string) (*template.Template, error) {
 	tmpl := template.New("")
+	tmpl.Funcs(stringTemplateFuncs)
 	tmpl.Funcs(map[string]interface{}{
 		"join": strings.Join,
 		"json": func(v interface{}) (string, error) {
@@ -77,6 +81,7 @@ func parseTemplate(text string) (*template.Template, error) {
 		"color": func(name string) string {
 			return ansiColors[name]
 		},
+		"emoji": output.Emoji,
 		"humanizeRFC3339": func(date string) (string, error) {
 			t, err := time.Parse(time.RFC3339, date)
 			if err != nil {
@@ -99,11 +104,16 @@ func parseTemplate(text string) (*template.Template, error) {
 		"friendlyPatchSetCreatedMessage": func(patchSet PatchSet) string {
 			var buf bytes.Buffer
 			fmt.Fprintln(&buf)
-			fmt.Fprintln(&buf, color.HiGreenString("✔  Patch set saved."), "\n\nPreview and create a campaign on Sourcegraph using one of the following options:")
+			fmt.Fprintln(&buf, color.HiGreenString(output.Emoji(output.EmojiSuccess)+"  Patch set saved."))
+			if summaries := summarizePatches(patchSet); len(summaries) > 0 {
+				fmt.Fprintln(&buf)
+				writePatchSummaries(&buf, summaries)
+			}
+			fmt.Fprintln(&buf, "\nPreview and create a campaign on Sourcegraph using one of the following options:")
 			fmt.Fprintln(&buf)
-			fmt.Fprintln(&buf, " ", color.HiCyanString("▶ Web:"), patchSet.PreviewURL, color.HiBlackString("or"))
+			fmt.Fprintln(&buf, " ", color.HiCyanString(output.Emoji(output.EmojiArrow)+" Web:"), patchSet.PreviewURL, color.HiBlackString("or"))
 			cliCommand := fmt.Sprintf("src campaigns create -patchset=%s -branch=DESIRED-BRANCH-NAME", patchSet.ID)
-			fmt.Fprintln(&buf, " ", color.HiCyanString("▶ CLI:"), cliCommand)
+			fmt.Fprintln(&buf, " ", color.HiCyanString(output.Emoji(output.EmojiArrow)+" CLI:"), cliCommand)
 
 			// Hacky to do this in a formatting helper, but better than
 			// globally querying the version and only using it here for now.
@@ -120,12 +130,14 @@ func parseTemplate(text string) (*template.Template, error) {
 
 			if supportsUpdatingPatchSet {
 				fmt.Fprintln(&buf, "\nTo update an existing campaign using this patch set:")
-				fmt.Fprintln(&buf, "\n ", color.HiCyanString("▶ Web:"), strings.Replace(patchSet.PreviewURL, "/new", "/update", 1))
+				fmt.Fprintln(&buf, "\n ", color.HiCyanString(output.Emoji(output.EmojiArrow)+" Web:"), strings.Replace(patchSet.PreviewURL, "/new", "/update", 1))
 			}
 
 			return buf.String()
 		},
 
+		"patchSetSummary": summarizePatches,
+
 		// `src campaign create`
 		"friendlyCampaignCreatedMessage": func(campaign Campaign) string {
 			var buf bytes.Buffer
@@ -136,7 +148,7 @@ func parseTemplate(text string) (*template.Template, error) {
 				message = "Publish the campaign and all of its changesets or single changesets individually to create pull requests on code hosts:"
 			}
 
-			fmt.Fprintln(&buf, color.HiGreenString("✔  Campaign created."), message)
+			fmt.Fprintln(&buf, color.HiGreenString(output.Emoji(output.EmojiSuccess)+"  Campaign created."), message)
 			fmt.Fprintln(&buf)
 
 			u, err := resolveURL(cfg.Endpoint, campaign.URL)
@@ -145,7 +157,7 @@ func parseTemplate(text string) (*template.Template, error) {
 				return buf.String()
 			}
 
-			fmt.Fprintln(&buf, " ", color.HiCyanString("▶ Web:"), u)
+			fmt.Fprintln(&buf, " ", color.HiCyanString(output.Emoji(output.EmojiArrow)+" Web:"), u)
 
 			return buf.String()
 		},
@@ -163,6 +175,23 @@ func parseTemplate(text string) (*template.Template, error) {
 	return tmpl.Parse(text)
 }
 
+// templateFileFlagUsage is the usage text of the -template-file flag, which
+// every command that renders its output with a template should offer.
+const templateFileFlagUsage = "Path to a file containing a Go text/template to render the output with. Overrides -f, if both are given."
+
+// parseTemplateOrFile parses the template in the file at path or, if path is
+// empty, the given template text.
+func parseTemplateOrFile(text, path string) (*template.Template, error) {
+	if path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrap(err, "reading template file")
+		}
+		text = string(data)
+	}
+	return parseTemplate(text)
+}
+
 func execTemplate(tmpl *template.Template, data interface{}) error {
 	if err := tmpl.Execute(os.Stdout, data); err != nil {
 		return err
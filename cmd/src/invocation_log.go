@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sourcegraph/src-cli/internal/api"
+	"github.com/sourcegraph/src-cli/internal/campaigns"
+)
+
+const (
+	// invocationLogMaxSize is the size in bytes after which the invocation
+	// log is rotated.
+	invocationLogMaxSize = 10 * 1024 * 1024
+	// invocationLogBackups is the number of rotated logs that are kept.
+	invocationLogBackups = 3
+)
+
+// invocationLogEntry is a single line in the invocation log.
+type invocationLogEntry struct {
+	Time       time.Time           `json:"time"`
+	Version    string              `json:"version"`
+	Args       []string            `json:"args"`
+	Endpoint   string              `json:"endpoint,omitempty"`
+	DurationMs int64               `json:"durationMs"`
+	APICalls   []invocationAPICall `json:"apiCalls"`
+	ExitCode   int                 `json:"exitCode"`
+	Outcome    string              `json:"outcome"`
+	Error      string              `json:"error,omitempty"`
+}
+
+type invocationAPICall struct {
+	Operation  string `json:"operation,omitempty"`
+	DurationMs int64  `json:"durationMs"`
+	Error      string `json:"error,omitempty"`
+}
+
+func invocationLogEnabled() bool {
+	enabled, _ := strconv.ParseBool(os.Getenv("SRC_LOG_INVOCATIONS"))
+	return enabled
+}
+
+// startInvocationLog records the API calls made during this invocation and
+// appends an entry describing it to the invocation log when src exits.
+func startInvocationLog(args []string) {
+	start := time.Now()
+	entry := invocationLogEntry{
+		Time:     start.UTC(),
+		Version:  buildTag,
+		Args:     redactArgs(args),
+		APICalls: []invocationAPICall{},
+	}
+
+	var mu sync.Mutex
+	apiRequestObservers = append(apiRequestObservers, func(e api.RequestEvent) {
+		call := invocationAPICall{
+			Operation:  e.Operation,
+			DurationMs: e.Duration.Milliseconds(),
+		}
+		if e.Err != nil {
+			call.Error = e.Err.Error()
+		}
+
+		mu.Lock()
+		entry.APICalls = append(entry.APICalls, call)
+		mu.Unlock()
+	})
+
+	atExit(func(code int) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		entry.DurationMs = time.Since(start).Milliseconds()
+		entry.ExitCode = code
+		entry.Outcome = "success"
+		if code != 0 {
+			entry.Outcome = errorTypes[exitCodeFailure]
+			if typ, ok := errorTypes[code]; ok {
+				entry.Outcome = typ
+			}
+		}
+		if commandErr != nil {
+			entry.Error = commandErr.Error()
+		}
+		if cfg != nil {
+			entry.Endpoint = cfg.Endpoint
+		}
+
+		if err := writeInvocationLog(entry); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write invocation log: %s\n", err)
+		}
+	})
+}
+
+func writeInvocationLog(entry invocationLogEntry) error {
+	dir, err := campaigns.UserCacheDir()
+	if err != nil {
+		return err
+	}
+	dir = filepath.Join(dir, "logs")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	path := filepath.Join(dir, "invocations.log")
+	if err := rotateInvocationLog(path); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// rotateInvocationLog moves the log at path to path.1 (and path.1 to path.2
+// and so on) once it has grown larger than invocationLogMaxSize.
+func rotateInvocationLog(path string) error {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if info.Size() < invocationLogMaxSize {
+		return nil
+	}
+
+	for i := invocationLogBackups - 1; i > 0; i-- {
+		if err := os.Rename(fmt.Sprintf("%s.%d", path, i), fmt.Sprintf("%s.%d", path, i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.Rename(path, path+".1")
+}
+
+// secretFlagRegexp matches the names of flags whose values must not end up in
+// the invocation log.
+var secretFlagRegexp = regexp.MustCompile(`(?i)token|password|secret|key|auth|header`)
+
+// redactArgs returns a copy of args with the values of flags that look like
+// they contain secrets replaced.
+func redactArgs(args []string) []string {
+	redacted := make([]string, len(args))
+	copy(redacted, args)
+
+	for i := 0; i < len(redacted); i++ {
+		arg := redacted[i]
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		name := strings.TrimLeft(arg, "-")
+		if eq := strings.Index(name, "="); eq >= 0 {
+			if secretFlagRegexp.MatchString(name[:eq]) {
+				redacted[i] = arg[:len(arg)-len(name)] + name[:eq] + "=REDACTED"
+			}
+			continue
+		}
+		if secretFlagRegexp.MatchString(name) && i+1 < len(redacted) && !strings.HasPrefix(redacted[i+1], "-") {
+			redacted[i+1] = "REDACTED"
+			i++
+		}
+	}
+	return redacted
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRedactArgs(t *testing.T) {
+	testCases := []struct {
+		args []string
+		want []string
+	}{
+		{
+			args: []string{"repos", "list", "-first", "10"},
+			want: []string{"repos", "list", "-first", "10"},
+		},
+		{
+			args: []string{"lsif", "upload", "-github-token=abc", "-file", "dump.lsif"},
+			want: []string{"lsif", "upload", "-github-token=REDACTED", "-file", "dump.lsif"},
+		},
+		{
+			args: []string{"actions", "exec", "--provenance-key", "key.pem", "-f", "action.json"},
+			want: []string{"actions", "exec", "--provenance-key", "REDACTED", "-f", "action.json"},
+		},
+		{
+			args: []string{"lsif", "upload", "-github-token", "-json"},
+			want: []string{"lsif", "upload", "-github-token", "-json"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(strings.Join(testCase.args, " "), func(t *testing.T) {
+			if diff := cmp.Diff(testCase.want, redactArgs(testCase.args)); diff != "" {
+				t.Errorf("unexpected args: %s", diff)
+			}
+		})
+	}
+}
@@ -17,6 +17,9 @@ Usage:
 The commands are:
 
 	upload     uploads an LSIF dump file
+	list       lists the LSIF uploads or index jobs of a repository
+	retry      retries the failed index jobs of a repository
+	delete     deletes LSIF uploads, e.g. the stale uploads of a repository
 
 Use "src lsif [command] -h" for more information about a command.
 `
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/src-cli/internal/api"
+)
+
+func init() {
+	usage := `
+Delete LSIF uploads, either those given by their IDs or the stale uploads of a repository: those whose
+processing failed and those that were replaced by a newer upload of the same commit, root and indexer.
+Uploads of older commits are kept, as they still provide code intelligence for those commits.
+
+Examples:
+
+  Delete uploads by their IDs, as printed by 'src lsif list':
+
+    	$ src lsif delete TFNJRlVwbG9hZDoxMjM= TFNJRlVwbG9hZDoxMjQ=
+
+  Delete the stale uploads of a repository that are older than 30 days, without asking for confirmation:
+
+    	$ src lsif delete -repo=github.com/gorilla/mux -stale -older-than=720h -yes
+
+  Print the stale uploads that would be deleted:
+
+    	$ src lsif delete -repo=github.com/gorilla/mux -stale -dry-run
+
+`
+
+	flagSet := flag.NewFlagSet("delete", flag.ExitOnError)
+	usageFunc := func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'src lsif %s':\n", flagSet.Name())
+		flagSet.PrintDefaults()
+		fmt.Println(usage)
+	}
+	var (
+		repoFlag      = flagSet.String("repo", "", "The name of the repository whose stale uploads are deleted (e.g. github.com/gorilla/mux). Requires -stale.")
+		staleFlag     = flagSet.Bool("stale", false, "Delete the uploads of the repository whose processing failed or that were replaced by a newer upload of the same commit, root and indexer.")
+		olderThanFlag = flagSet.Duration("older-than", 0, "Only delete the stale uploads that were uploaded longer than this duration ago (e.g. 720h).")
+		dryRunFlag    = flagSet.Bool("dry-run", false, "Print the uploads that would be deleted instead of deleting them.")
+		yesFlag       = flagSet.Bool("yes", false, "Do not ask for confirmation.")
+		apiFlags      = api.NewFlags(flagSet)
+	)
+
+	handler := func(args []string) error {
+		flagSet.Parse(args)
+
+		if *staleFlag != (*repoFlag != "") {
+			return &usageError{errors.New("-repo and -stale must be given together")}
+		}
+		if *staleFlag == (flagSet.NArg() > 0) {
+			return &usageError{errors.New("expected either upload IDs or -repo and -stale")}
+		}
+		if *olderThanFlag < 0 {
+			return &usageError{errors.New("-older-than must not be negative")}
+		}
+
+		ctx := context.Background()
+		client := cfg.apiClient(apiFlags, flagSet.Output())
+
+		ids := flagSet.Args()
+		if *staleFlag {
+			_, uploads, err := fetchLSIFUploads(ctx, client, *repoFlag, "", nil, 0)
+			if err != nil {
+				return err
+			}
+			ids = nil
+			for _, upload := range staleLSIFUploads(uploads, *olderThanFlag, time.Now()) {
+				if *dryRunFlag {
+					fmt.Printf("Would delete upload %s (%s, %s, uploaded %s)\n", upload.ID, upload.State, upload.InputCommit, upload.UploadedAt.Format(time.RFC3339))
+				}
+				ids = append(ids, upload.ID)
+			}
+		} else if *dryRunFlag {
+			for _, id := range ids {
+				fmt.Printf("Would delete upload %s\n", id)
+			}
+		}
+		if len(ids) == 0 {
+			fmt.Println("No stale uploads.")
+			return nil
+		}
+		if *dryRunFlag {
+			return nil
+		}
+
+		if !*yesFlag {
+			ok, err := askForConfirmation(fmt.Sprintf("Delete %d LSIF uploads?", len(ids)))
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return errors.New("aborted")
+			}
+		}
+
+		query := `mutation DeleteLSIFUpload($id: ID!) {
+	deleteLSIFUpload(id: $id) {
+		alwaysNil
+	}
+}`
+		failed := 0
+		for _, id := range ids {
+			var result struct{}
+			if ok, err := client.NewRequest(query, map[string]interface{}{
+				"id": id,
+			}).Do(ctx, &result); err != nil {
+				fmt.Printf("Deleting upload %s failed: %s\n", id, err)
+				failed++
+				continue
+			} else if !ok {
+				return nil
+			}
+			fmt.Printf("Upload %s deleted\n", id)
+		}
+		if failed > 0 {
+			return &exitCodeError{error: fmt.Errorf("deleting %d of %d uploads failed", failed, len(ids)), exitCode: exitCodePartialFailure}
+		}
+		return nil
+	}
+
+	// Register the command.
+	lsifCommands = append(lsifCommands, &command{
+		flagSet:   flagSet,
+		handler:   handler,
+		usageFunc: usageFunc,
+	})
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/src-cli/internal/api"
+)
+
+// lsifUpload is an LSIF upload, i.e. a dump that was uploaded to the
+// instance and is processed into code intelligence data.
+type lsifUpload struct {
+	ID              string
+	State           string
+	InputCommit     string
+	InputRoot       string
+	InputIndexer    string
+	IsLatestForRepo bool
+	UploadedAt      time.Time
+	StartedAt       *time.Time
+	FinishedAt      *time.Time
+	Failure         *string
+	PlaceInQueue    *int
+}
+
+const lsifUploadFragment = `
+fragment LSIFUploadFields on LSIFUpload {
+	id
+	state
+	inputCommit
+	inputRoot
+	inputIndexer
+	isLatestForRepo
+	uploadedAt
+	startedAt
+	finishedAt
+	failure
+	placeInQueue
+}
+`
+
+// lsifIndex is an LSIF index job, i.e. the indexing of a commit of a
+// repository by the instance, which results in an upload.
+type lsifIndex struct {
+	ID           string
+	State        string
+	InputCommit  string
+	QueuedAt     time.Time
+	StartedAt    *time.Time
+	FinishedAt   *time.Time
+	Failure      *string
+	PlaceInQueue *int
+}
+
+const lsifIndexFragment = `
+fragment LSIFIndexFields on LSIFIndex {
+	id
+	state
+	inputCommit
+	queuedAt
+	startedAt
+	finishedAt
+	failure
+	placeInQueue
+}
+`
+
+// lsifJobsPageSize is the number of uploads or index jobs requested at once.
+const lsifJobsPageSize = 100
+
+// lsifRepositoryNotFound returns the error for a repository that doesn't
+// exist.
+func lsifRepositoryNotFound(repo string) error {
+	return &exitCodeError{error: errors.Errorf("repository %q not found", repo), exitCode: exitCodeNotFound}
+}
+
+// fetchLSIFUploads returns the ID of the repository and up to limit of its
+// uploads, all of them if limit is 0, newest first. The uploads are filtered
+// by state and, if latest isn't nil, by whether they are the latest for the
+// repository.
+func fetchLSIFUploads(ctx context.Context, client api.Client, repo, state string, latest *bool, limit int) (string, []lsifUpload, error) {
+	query := `query LSIFUploads($repo: String!, $first: Int!, $after: String, $state: LSIFUploadState, $latest: Boolean) {
+	repository(name: $repo) {
+		id
+		lsifUploads(first: $first, after: $after, state: $state, isLatestForRepo: $latest) {
+			nodes {
+				...LSIFUploadFields
+			}
+			pageInfo {
+				endCursor
+				hasNextPage
+			}
+		}
+	}
+}
+` + lsifUploadFragment
+
+	var (
+		repoID  string
+		uploads []lsifUpload
+		after   *string
+	)
+	for {
+		vars := map[string]interface{}{
+			"repo":   repo,
+			"first":  lsifJobsPageSize,
+			"after":  after,
+			"latest": latest,
+		}
+		if state != "" {
+			vars["state"] = state
+		}
+		var result struct {
+			Repository *struct {
+				ID          string
+				LSIFUploads struct {
+					Nodes    []lsifUpload
+					PageInfo pageInfo
+				}
+			}
+		}
+		if ok, err := client.NewRequest(query, vars).Do(ctx, &result); err != nil || !ok {
+			return "", nil, err
+		}
+		if result.Repository == nil {
+			return "", nil, lsifRepositoryNotFound(repo)
+		}
+		repoID = result.Repository.ID
+		uploads = append(uploads, result.Repository.LSIFUploads.Nodes...)
+		if limit > 0 && len(uploads) >= limit {
+			return repoID, uploads[:limit], nil
+		}
+		page := result.Repository.LSIFUploads.PageInfo
+		if !page.HasNextPage || page.EndCursor == nil {
+			return repoID, uploads, nil
+		}
+		after = page.EndCursor
+	}
+}
+
+// fetchLSIFIndexes returns the ID of the repository and up to limit of its
+// index jobs in the given state, all of them if limit is 0, newest first.
+func fetchLSIFIndexes(ctx context.Context, client api.Client, repo, state string, limit int) (string, []lsifIndex, error) {
+	query := `query LSIFIndexes($repo: String!, $first: Int!, $after: String, $state: LSIFIndexState) {
+	repository(name: $repo) {
+		id
+		lsifIndexes(first: $first, after: $after, state: $state) {
+			nodes {
+				...LSIFIndexFields
+			}
+			pageInfo {
+				endCursor
+				hasNextPage
+			}
+		}
+	}
+}
+` + lsifIndexFragment
+
+	var (
+		repoID  string
+		indexes []lsifIndex
+		after   *string
+	)
+	for {
+		vars := map[string]interface{}{
+			"repo":  repo,
+			"first": lsifJobsPageSize,
+			"after": after,
+		}
+		if state != "" {
+			vars["state"] = state
+		}
+		var result struct {
+			Repository *struct {
+				ID          string
+				LSIFIndexes struct {
+					Nodes    []lsifIndex
+					PageInfo pageInfo
+				}
+			}
+		}
+		if ok, err := client.NewRequest(query, vars).Do(ctx, &result); err != nil || !ok {
+			return "", nil, err
+		}
+		if result.Repository == nil {
+			return "", nil, lsifRepositoryNotFound(repo)
+		}
+		repoID = result.Repository.ID
+		indexes = append(indexes, result.Repository.LSIFIndexes.Nodes...)
+		if limit > 0 && len(indexes) >= limit {
+			return repoID, indexes[:limit], nil
+		}
+		page := result.Repository.LSIFIndexes.PageInfo
+		if !page.HasNextPage || page.EndCursor == nil {
+			return repoID, indexes, nil
+		}
+		after = page.EndCursor
+	}
+}
+
+// staleLSIFUploads returns the uploads that were uploaded more than olderThan
+// before now and that don't provide code intelligence: those whose processing
+// failed and those that were replaced by a newer completed upload of the same
+// commit, root and indexer. An upload that is not the latest for the
+// repository still provides code intelligence for its commit, so it isn't
+// stale just because newer commits were uploaded.
+func staleLSIFUploads(uploads []lsifUpload, olderThan time.Duration, now time.Time) []lsifUpload {
+	type key struct{ commit, root, indexer string }
+	newest := map[key]time.Time{}
+	for _, u := range uploads {
+		if u.State != "COMPLETED" {
+			continue
+		}
+		k := key{u.InputCommit, u.InputRoot, u.InputIndexer}
+		if t, ok := newest[k]; !ok || u.UploadedAt.After(t) {
+			newest[k] = u.UploadedAt
+		}
+	}
+
+	var stale []lsifUpload
+	for _, u := range uploads {
+		if now.Sub(u.UploadedAt) < olderThan {
+			continue
+		}
+		switch u.State {
+		case "ERRORED":
+		case "COMPLETED":
+			if !newest[key{u.InputCommit, u.InputRoot, u.InputIndexer}].After(u.UploadedAt) {
+				continue
+			}
+		default:
+			continue
+		}
+		stale = append(stale, u)
+	}
+	return stale
+}
+
+// failedLSIFIndexCommits returns the commits whose latest index job failed,
+// in the order of the jobs, which are expected to be newest first.
+func failedLSIFIndexCommits(indexes []lsifIndex) []string {
+	seen := map[string]bool{}
+	var commits []string
+	for _, index := range indexes {
+		if seen[index.InputCommit] {
+			continue
+		}
+		seen[index.InputCommit] = true
+		if index.State == "ERRORED" {
+			commits = append(commits, index.InputCommit)
+		}
+	}
+	return commits
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestStaleLSIFUploads(t *testing.T) {
+	now := time.Date(2020, 7, 1, 0, 0, 0, 0, time.UTC)
+	uploads := []lsifUpload{
+		{ID: "latest", State: "COMPLETED", InputCommit: "b", InputRoot: "", InputIndexer: "lsif-go", IsLatestForRepo: true, UploadedAt: now.Add(-48 * time.Hour)},
+		{ID: "older commit", State: "COMPLETED", InputCommit: "a", InputRoot: "", InputIndexer: "lsif-go", UploadedAt: now.Add(-72 * time.Hour)},
+		{ID: "other root", State: "COMPLETED", InputCommit: "b", InputRoot: "web/", InputIndexer: "lsif-tsc", UploadedAt: now.Add(-96 * time.Hour)},
+		{ID: "replaced", State: "COMPLETED", InputCommit: "b", InputRoot: "", InputIndexer: "lsif-go", UploadedAt: now.Add(-60 * time.Hour)},
+		{ID: "failed", State: "ERRORED", InputCommit: "c", UploadedAt: now.Add(-2 * time.Hour)},
+		{ID: "queued", State: "QUEUED", InputCommit: "c", UploadedAt: now.Add(-48 * time.Hour)},
+		{ID: "processing", State: "PROCESSING", InputCommit: "c", UploadedAt: now.Add(-48 * time.Hour)},
+	}
+
+	for name, tc := range map[string]struct {
+		olderThan time.Duration
+		want      []string
+	}{
+		"all":        {olderThan: 0, want: []string{"replaced", "failed"}},
+		"older than": {olderThan: 24 * time.Hour, want: []string{"replaced"}},
+		"none":       {olderThan: 72 * time.Hour, want: nil},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var have []string
+			for _, u := range staleLSIFUploads(uploads, tc.olderThan, now) {
+				have = append(have, u.ID)
+			}
+			if diff := cmp.Diff(tc.want, have); diff != "" {
+				t.Errorf("unexpected stale uploads (-want +have):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestFailedLSIFIndexCommits(t *testing.T) {
+	indexes := []lsifIndex{
+		{ID: "5", State: "ERRORED", InputCommit: "c"},
+		{ID: "4", State: "COMPLETED", InputCommit: "b"},
+		{ID: "3", State: "ERRORED", InputCommit: "b"},
+		{ID: "2", State: "ERRORED", InputCommit: "a"},
+		{ID: "1", State: "ERRORED", InputCommit: "c"},
+	}
+	want := []string{"c", "a"}
+	if diff := cmp.Diff(want, failedLSIFIndexCommits(indexes)); diff != "" {
+		t.Errorf("unexpected commits (-want +have):\n%s", diff)
+	}
+}
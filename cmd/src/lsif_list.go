@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/src-cli/internal/api"
+)
+
+func init() {
+	usage := `
+Examples:
+
+  List the LSIF uploads of a repository, newest first:
+
+    	$ src lsif list -repo=github.com/gorilla/mux
+
+  List the uploads whose processing failed, with the reason:
+
+    	$ src lsif list -repo=github.com/gorilla/mux -state=ERRORED -f '{{.ID}} {{.InputCommit}}: {{.Failure}}'
+
+  List the index jobs of a repository that are waiting to be processed:
+
+    	$ src lsif list -repo=github.com/gorilla/mux -indexes -state=QUEUED
+
+`
+
+	flagSet := flag.NewFlagSet("list", flag.ExitOnError)
+	usageFunc := func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'src lsif %s':\n", flagSet.Name())
+		flagSet.PrintDefaults()
+		fmt.Println(usage)
+	}
+	var (
+		repoFlag    = flagSet.String("repo", "", "The name of the repository (e.g. github.com/gorilla/mux). (required)")
+		indexesFlag = flagSet.Bool("indexes", false, "List the index jobs of the repository instead of its uploads.")
+		stateFlag   = flagSet.String("state", "", "Only list the uploads or index jobs in this state (e.g. QUEUED, PROCESSING, COMPLETED or ERRORED).")
+		firstFlag   = flagSet.Int("first", 100, "Returns the first n uploads or index jobs, 0 to return all of them.")
+		formatFlag  = flagSet.String("f", "{{.ID}} {{.State}} {{.InputCommit}}", `Format for the output, using the syntax of Go package text/template. (e.g. "{{.ID}} {{.State}} {{.InputRoot}}" or "{{.|json}}")`)
+		apiFlags    = api.NewFlags(flagSet)
+	)
+
+	handler := func(args []string) error {
+		flagSet.Parse(args)
+
+		if *repoFlag == "" {
+			return &usageError{errors.New("-repo is required")}
+		}
+		if *firstFlag < 0 {
+			return &usageError{errors.New("-first must not be negative")}
+		}
+
+		tmpl, err := parseTemplate(*formatFlag)
+		if err != nil {
+			return err
+		}
+
+		ctx := context.Background()
+		client := cfg.apiClient(apiFlags, flagSet.Output())
+
+		var jobs []interface{}
+		if *indexesFlag {
+			_, indexes, err := fetchLSIFIndexes(ctx, client, *repoFlag, *stateFlag, *firstFlag)
+			if err != nil {
+				return err
+			}
+			for _, index := range indexes {
+				jobs = append(jobs, index)
+			}
+		} else {
+			_, uploads, err := fetchLSIFUploads(ctx, client, *repoFlag, *stateFlag, nil, *firstFlag)
+			if err != nil {
+				return err
+			}
+			for _, upload := range uploads {
+				jobs = append(jobs, upload)
+			}
+		}
+		for _, job := range jobs {
+			if err := execTemplate(tmpl, job); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// Register the command.
+	lsifCommands = append(lsifCommands, &command{
+		flagSet:   flagSet,
+		handler:   handler,
+		usageFunc: usageFunc,
+	})
+}
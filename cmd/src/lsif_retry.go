@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/src-cli/internal/api"
+)
+
+func init() {
+	usage := `
+Retry the index jobs of a repository that failed, by queueing new index jobs for the commits whose latest
+index job failed.
+
+Examples:
+
+  Retry the failed index jobs of a repository:
+
+    	$ src lsif retry -repo=github.com/gorilla/mux
+
+  Print the commits that would be indexed again, without queueing index jobs:
+
+    	$ src lsif retry -repo=github.com/gorilla/mux -dry-run
+
+`
+
+	flagSet := flag.NewFlagSet("retry", flag.ExitOnError)
+	usageFunc := func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'src lsif %s':\n", flagSet.Name())
+		flagSet.PrintDefaults()
+		fmt.Println(usage)
+	}
+	var (
+		repoFlag   = flagSet.String("repo", "", "The name of the repository (e.g. github.com/gorilla/mux). (required)")
+		dryRunFlag = flagSet.Bool("dry-run", false, "Print the commits that would be indexed again instead of queueing index jobs.")
+		apiFlags   = api.NewFlags(flagSet)
+	)
+
+	handler := func(args []string) error {
+		flagSet.Parse(args)
+
+		if *repoFlag == "" {
+			return &usageError{errors.New("-repo is required")}
+		}
+
+		ctx := context.Background()
+		client := cfg.apiClient(apiFlags, flagSet.Output())
+
+		repoID, indexes, err := fetchLSIFIndexes(ctx, client, *repoFlag, "", 0)
+		if err != nil {
+			return err
+		}
+		commits := failedLSIFIndexCommits(indexes)
+		if len(commits) == 0 {
+			fmt.Println("No failed index jobs.")
+			return nil
+		}
+		if *dryRunFlag {
+			for _, commit := range commits {
+				fmt.Printf("Would queue an index job for %s@%s\n", *repoFlag, commit)
+			}
+			return nil
+		}
+
+		query := `mutation QueueAutoIndexJobs($repo: ID!, $rev: String) {
+	queueAutoIndexJobsForRepo(repository: $repo, rev: $rev) {
+		...LSIFIndexFields
+	}
+}
+` + lsifIndexFragment
+
+		failed := 0
+		for _, commit := range commits {
+			var result struct {
+				QueueAutoIndexJobsForRepo []lsifIndex
+			}
+			if ok, err := client.NewRequest(query, map[string]interface{}{
+				"repo": repoID,
+				"rev":  commit,
+			}).Do(ctx, &result); err != nil {
+				fmt.Printf("Queueing an index job for %s@%s failed: %s\n", *repoFlag, commit, err)
+				failed++
+				continue
+			} else if !ok {
+				return nil
+			}
+			for _, index := range result.QueueAutoIndexJobsForRepo {
+				fmt.Printf("Queued index job %s for %s@%s\n", index.ID, *repoFlag, index.InputCommit)
+			}
+		}
+		if failed > 0 {
+			return &exitCodeError{error: fmt.Errorf("queueing index jobs failed for %d of %d commits", failed, len(commits)), exitCode: exitCodePartialFailure}
+		}
+		return nil
+	}
+
+	// Register the command.
+	lsifCommands = append(lsifCommands, &command{
+		flagSet:   flagSet,
+		handler:   handler,
+		usageFunc: usageFunc,
+	})
+}
@@ -143,7 +143,7 @@ Examples:
 			return errors.New("max-payload-size must be positive")
 		}
 
-		if !*flags.json {
+		if !*flags.json && !*quiet {
 			fmt.Println(argsString)
 		}
 
@@ -155,9 +155,13 @@ Examples:
 			return &usageError{err}
 		}
 
+		accessToken, err := cfg.accessToken()
+		if err != nil {
+			return err
+		}
 		opts := codeintel.UploadIndexOpts{
 			Endpoint:             cfg.Endpoint,
-			AccessToken:          cfg.AccessToken,
+			AccessToken:          accessToken,
 			AdditionalHeaders:    cfg.AdditionalHeaders,
 			Repo:                 *flags.repo,
 			Commit:               *flags.commit,
@@ -177,7 +181,7 @@ Examples:
 		go func() {
 			defer wg.Done()
 
-			if *flags.json || *flags.noProgress {
+			if *flags.json || *flags.noProgress || *quiet {
 				return
 			}
 
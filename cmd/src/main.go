@@ -1,18 +1,23 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"flag"
 	"io"
 	"io/ioutil"
 	"log"
+	"net/http"
 	"os"
 	"os/user"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/sourcegraph/src-cli/internal/api"
+	"github.com/sourcegraph/src-cli/internal/output"
+	"github.com/sourcegraph/src-cli/internal/tracing"
 )
 
 const usageText = `src is a tool that provides access to Sourcegraph instances.
@@ -23,12 +28,38 @@ Usage:
 	src [options] command [command options]
 
 Environment variables
-	SRC_ACCESS_TOKEN  Sourcegraph access token
-	SRC_ENDPOINT      endpoint to use, if unset will default to "https://sourcegraph.com"
+	SRC_ACCESS_TOKEN             Sourcegraph access token
+	SRC_ENDPOINT                 endpoint to use, if unset will default to "https://sourcegraph.com"
+	SRC_CREDENTIAL_HELPER        credential helper that provides the access token if none is set, see below
+	SRC_LOG_INVOCATIONS          if true, every invocation of src is logged to sourcegraph-src/logs in the user cache directory
+	OTEL_EXPORTER_OTLP_ENDPOINT  if set, traces of API requests and action executions are exported to this OTLP/HTTP collector
 
 The options are:
 
 	-v                               print verbose output
+	-q, -quiet                       only print final results and errors, no progress
+	-no-emoji                        replace emoji in output with plain ASCII
+	-color=auto|always|never         whether to color output; auto respects NO_COLOR and disables color when not writing to a terminal
+	-error-format=text|json          print errors as plain text (default) or as JSON objects
+	-endpoint=URL                    the Sourcegraph instance to use, overriding SRC_ENDPOINT and the config file
+	-token=TOKEN                     the access token to use, overriding SRC_ACCESS_TOKEN and the config file
+	-token-file=PATH                 read the access token from a file, or from standard input if PATH is "-",
+	                                 which keeps it out of the shell history
+	-as-user=USERNAME                perform API requests as USERNAME, e.g. to verify which search results and
+	                                 repositories a user sees or to create campaigns in the name of a service
+	                                 account; requires a site admin access token with the site-admin:sudo scope
+	-request-source=NAME             tag the requests with NAME in their User-Agent, so that site admins can tell
+	                                 which automation they come from, e.g. -request-source=nightly-upgrades
+	-stats                           print the wall time, the number, duration and size of API requests and, for
+	                                 'src actions exec', the time spent in steps and git when the command exits
+	-compress-requests               gzip compress request bodies larger than 1 KiB, e.g. the diffs of patches,
+	                                 which only instances that support compressed requests accept
+	-http-dial-timeout=DURATION      give up connecting to a host after DURATION (default 30s)
+	-http-tls-timeout=DURATION       give up on the TLS handshake with a host after DURATION (default 10s)
+	-http-response-timeout=DURATION  give up waiting for the response headers after DURATION, 0 to wait
+	                                 indefinitely (default 10m)
+	-http-max-idle-conns-per-host=N  keep up to N idle connections per host for reuse, e.g. by concurrent
+	                                 archive downloads (default 100)
 
 The commands are:
 
@@ -39,25 +70,115 @@ The commands are:
 	orgs,org        manages organizations
 	config          manages global, org, and user settings
 	extsvc          manages external services
+	codeowners      manages the code ownership data of repositories
 	extensions,ext  manages extensions (experimental)
 	actions         runs actions to generate patch sets (experimental)
-	campaigns       manages campaigns (experimental)
+	campaigns,batch manages campaigns (experimental)
+	changesets      manages the changesets of campaigns (experimental)
 	lsif            manages LSIF data
 	serve-git       serves your local git repositories over HTTP for Sourcegraph to pull
+	validate        validates the configuration and state of a Sourcegraph instance
+	doctor          diagnoses common problems with the environment src runs in
 	version         display and compare the src-cli version against the recommended version for your instance
 
 Use "src [command] -h" for more information about a command.
 
+Project configuration
+
+	A .src.yaml file in the working directory or the home directory sets default values for the flags of
+	commands, e.g. to commit consistent settings next to action definitions. Flags given on the command line
+	take precedence, as do the values in the working directory over those in the home directory:
+
+		endpoint: https://sourcegraph.example.com
+		commands:
+		  actions exec:
+		    j: 4
+		    cache: .src-cache
+		  campaigns create:
+		    namespace: our-org
+
+	The endpoint is used unless SRC_ENDPOINT or -endpoint is set. It can only be set in the .src.yaml file
+	of the home directory, so that running src in a checked out repository never sends the access token to
+	an endpoint named by the repository.
+
+Credential helpers
+
+	Instead of setting the access token in SRC_ACCESS_TOKEN or the config file, it can be obtained from a
+	credential helper, e.g. one that reads it from a secret store. The helper is set with SRC_CREDENTIAL_HELPER
+	or "credentialHelper" in the config file, and is only used if no access token is set. It is run when a
+	command first needs the access token, not for commands that don't talk to the Sourcegraph instance.
+
+	The helper "NAME [ARGS...]" runs the executable src-credential-NAME in the PATH (or NAME, if it is an absolute
+	path) with the arguments ARGS and "get". The endpoint is written to its standard input as "endpoint=URL", and
+	it must print the access token as "token=TOKEN".
+
 `
 
 var (
-	verbose = flag.Bool("v", false, "print verbose output")
+	verbose       = flag.Bool("v", false, "print verbose output")
+	errorFormat   = flag.String("error-format", "text", "print errors as plain text or as JSON objects (text|json)")
+	quiet         = flag.Bool("q", false, "only print final results and errors, no progress")
+	noEmoji       = flag.Bool("no-emoji", false, "replace emoji in output with plain ASCII")
+	colorFlag     = flag.String("color", output.ColorAuto, "whether to color output (auto|always|never)")
+	endpoint      = flag.String("endpoint", "", "the Sourcegraph instance to use, overriding SRC_ENDPOINT")
+	token         = flag.String("token", "", "the access token to use, overriding SRC_ACCESS_TOKEN")
+	tokenFile     = flag.String("token-file", "", `read the access token from this file, or from standard input if "-"`)
+	asUser        = flag.String("as-user", "", "perform API requests as this user (requires a site admin token with the site-admin:sudo scope)")
+	requestSource = flag.String("request-source", "", "tag the requests with this name in their User-Agent")
+	statsFlag     = flag.Bool("stats", false, "print timings and API usage to standard error when the command exits")
+
+	compressRequests = flag.Bool("compress-requests", false, "gzip compress request bodies larger than 1 KiB, e.g. the diffs of patches (requires an instance that supports it)")
+
+	httpDialTimeout         = flag.Duration("http-dial-timeout", api.DefaultHTTPClientOpts.DialTimeout, "give up connecting to a host after this duration")
+	httpTLSTimeout          = flag.Duration("http-tls-timeout", api.DefaultHTTPClientOpts.TLSHandshakeTimeout, "give up on the TLS handshake with a host after this duration")
+	httpResponseTimeout     = flag.Duration("http-response-timeout", api.DefaultHTTPClientOpts.ResponseHeaderTimeout, "give up waiting for the response headers after this duration, 0 to wait indefinitely")
+	httpMaxIdleConnsPerHost = flag.Int("http-max-idle-conns-per-host", api.DefaultHTTPClientOpts.MaxIdleConnsPerHost, "keep up to this many idle connections per host for reuse")
 
 	// The following arguments are deprecated which is why they are no longer documented
 	configPath = flag.String("config", "", "")
-	endpoint   = flag.String("endpoint", "", "")
 )
 
+func init() {
+	flag.BoolVar(quiet, "quiet", false, "only print final results and errors, no progress")
+}
+
+// applyGlobalFlags validates the global flags and configures the packages that
+// depend on them. It is called once the global flags have been parsed.
+func applyGlobalFlags() {
+	if *errorFormat != "text" && *errorFormat != "json" {
+		log.Fatalf("invalid -error-format %q: must be text or json", *errorFormat)
+	}
+	if err := output.SetColorMode(*colorFlag); err != nil {
+		log.Fatal(err)
+	}
+	if err := api.ValidateRequestSource(*requestSource); err != nil {
+		log.Fatal(err)
+	}
+	if err := api.ValidateImpersonatedUser(*asUser); err != nil {
+		log.Fatalf("-as-user: %s", err)
+	}
+	if *httpDialTimeout <= 0 || *httpTLSTimeout <= 0 || *httpResponseTimeout < 0 {
+		log.Fatal("invalid HTTP timeouts: -http-dial-timeout and -http-tls-timeout must be positive, -http-response-timeout must not be negative")
+	}
+	if *httpMaxIdleConnsPerHost < 1 {
+		log.Fatalf("invalid -http-max-idle-conns-per-host %d: must be at least 1", *httpMaxIdleConnsPerHost)
+	}
+	api.ConfigureHTTPClient(api.HTTPClientOpts{
+		DialTimeout:           *httpDialTimeout,
+		TLSHandshakeTimeout:   *httpTLSTimeout,
+		ResponseHeaderTimeout: *httpResponseTimeout,
+		MaxIdleConnsPerHost:   *httpMaxIdleConnsPerHost,
+	})
+	output.NoEmoji = *noEmoji
+	configureColors()
+	if *quiet {
+		api.UnavailableOutput = ioutil.Discard
+	}
+	if *statsFlag {
+		startCommandStats()
+	}
+}
+
 // commands contains all registered subcommands.
 var commands commander
 
@@ -66,9 +187,44 @@ func main() {
 	log.SetFlags(0)
 	log.SetPrefix("")
 
+	tracing.Init(func() *http.Client { return api.HTTPClient })
+	if tracing.Enabled() {
+		atExit(func(int) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := tracing.Flush(ctx); err != nil {
+				log.Println("exporting traces:", err)
+			}
+		})
+	}
+
+	if invocationLogEnabled() {
+		startInvocationLog(os.Args[1:])
+	}
+
 	commands.run(flag.CommandLine, "src", usageText, os.Args[1:])
 }
 
+// atExitFuncs are run, in order, by exit.
+var atExitFuncs []func(code int)
+
+// atExit registers f to be run before the process exits through exit. f is
+// given the exit code.
+func atExit(f func(code int)) {
+	atExitFuncs = append(atExitFuncs, f)
+}
+
+// exit runs all functions registered with atExit and then exits with the
+// given code. Commands should use it instead of os.Exit.
+func exit(code int) {
+	funcs := atExitFuncs
+	atExitFuncs = nil
+	for _, f := range funcs {
+		f(code)
+	}
+	os.Exit(code)
+}
+
 var cfg *config
 
 // config represents the config format.
@@ -76,17 +232,68 @@ type config struct {
 	Endpoint          string            `json:"endpoint"`
 	AccessToken       string            `json:"accessToken"`
 	AdditionalHeaders map[string]string `json:"additionalHeaders"`
+	CredentialHelper  string            `json:"credentialHelper,omitempty"`
+
+	// ImpersonateUser is the user given with -as-user.
+	ImpersonateUser string `json:"-"`
 }
 
-// apiClient returns an api.Client built from the configuration.
+// apiRequestObservers are invoked after every request made by a client
+// returned from config.apiClient. Commands that want to collect information
+// about API usage should append to it before creating their client.
+var apiRequestObservers []func(api.RequestEvent)
+
+// accessToken returns the access token. If none is set, it is obtained from
+// the credential helper, if any, which is only run the first time a token is
+// needed.
+func (c *config) accessToken() (string, error) {
+	if c.AccessToken != "" || c.CredentialHelper == "" {
+		return c.AccessToken, nil
+	}
+	key := c.CredentialHelper + "\x00" + c.Endpoint
+	if t, ok := credentialHelperTokens[key]; ok {
+		c.AccessToken = t
+		return t, nil
+	}
+	t, err := credentialHelperToken(c.CredentialHelper, c.Endpoint)
+	if err != nil {
+		return "", err
+	}
+	credentialHelperTokens[key] = t
+	c.AccessToken = t
+	return t, nil
+}
+
+// credentialHelperTokens memoizes the tokens returned by credential helpers,
+// keyed by helper and endpoint, since the configuration is read again by
+// every nested command.
+var credentialHelperTokens = map[string]string{}
+
+// apiClient returns an api.Client built from the configuration. If the access
+// token can't be obtained, the requests of the client fail with the reason.
 func (c *config) apiClient(flags *api.Flags, out io.Writer) api.Client {
-	return api.NewClient(api.ClientOpts{
+	token, err := c.accessToken()
+	if err != nil {
+		return errClient{err: err}
+	}
+	opts := api.ClientOpts{
 		Endpoint:          c.Endpoint,
-		AccessToken:       c.AccessToken,
+		AccessToken:       token,
 		AdditionalHeaders: c.AdditionalHeaders,
+		ImpersonateUser:   c.ImpersonateUser,
+		CompressRequests:  compressRequests != nil && *compressRequests,
 		Flags:             flags,
 		Out:               out,
-	})
+	}
+	if len(apiRequestObservers) > 0 {
+		observers := apiRequestObservers
+		opts.Observe = func(e api.RequestEvent) {
+			for _, observe := range observers {
+				observe(e)
+			}
+		}
+	}
+	return api.NewClient(opts)
 }
 
 // readConfig reads the config file from the given path.
@@ -114,6 +321,11 @@ func readConfig() (*config, error) {
 		}
 	}
 
+	// The project configuration is more specific than the config file.
+	if projectCfg != nil && projectCfg.Endpoint != "" {
+		cfg.Endpoint = projectCfg.Endpoint
+	}
+
 	envToken := os.Getenv("SRC_ACCESS_TOKEN")
 	envEndpoint := os.Getenv("SRC_ENDPOINT")
 
@@ -141,14 +353,67 @@ func readConfig() (*config, error) {
 
 	cfg.AdditionalHeaders = parseAdditionalHeaders()
 
-	// Lastly, apply endpoint flag if set
+	// Lastly, apply endpoint and token flags if set
 	if endpoint != nil && *endpoint != "" {
 		cfg.Endpoint = *endpoint
 	}
+	if token != nil && *token != "" && tokenFile != nil && *tokenFile != "" {
+		return nil, errors.New("only one of -token and -token-file may be given")
+	}
+	if token != nil && *token != "" {
+		cfg.AccessToken = *token
+	}
+	if tokenFile != nil && *tokenFile != "" {
+		if cfg.AccessToken, err = readTokenFile(*tokenFile); err != nil {
+			return nil, err
+		}
+	}
 
 	cfg.Endpoint = strings.TrimSuffix(cfg.Endpoint, "/")
 
+	if helper := os.Getenv("SRC_CREDENTIAL_HELPER"); helper != "" {
+		cfg.CredentialHelper = helper
+	}
+
+	if asUser != nil && *asUser != "" {
+		if cfg.AccessToken == "" && cfg.CredentialHelper == "" {
+			return nil, errors.New("-as-user requires the access token of a site admin")
+		}
+		cfg.ImpersonateUser = *asUser
+	}
+
 	return &cfg, nil
 }
 
+// tokenFileTokens memoizes the tokens read by readTokenFile, keyed by path.
+// The configuration is read again by every nested command, but standard input
+// can only be read once.
+var tokenFileTokens = map[string]string{}
+
+// readTokenFile reads an access token from path, or from standard input if
+// path is "-".
+func readTokenFile(path string) (string, error) {
+	if t, ok := tokenFileTokens[path]; ok {
+		return t, nil
+	}
+	var (
+		data []byte
+		err  error
+	)
+	if path == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return "", errors.Wrap(err, "reading access token")
+	}
+	t := strings.TrimSpace(string(data))
+	if t == "" {
+		return "", errors.Errorf("no access token in %s", path)
+	}
+	tokenFileTokens[path] = t
+	return t, nil
+}
+
 var errConfigMerge = errors.New("when using a configuration file, zero or all environment variables must be set")
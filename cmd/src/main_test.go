@@ -18,6 +18,8 @@ func TestReadConfig(t *testing.T) {
 		envFooHeader string
 		envEndpoint  string
 		flagEndpoint string
+		flagToken    string
+		tokenFile    string
 		want         *config
 		wantErr      string
 	}{
@@ -127,6 +129,35 @@ func TestReadConfig(t *testing.T) {
 				AdditionalHeaders: map[string]string{},
 			},
 		},
+		{
+			name:      "token flag should override environment",
+			envToken:  "abc",
+			flagToken: "def",
+			want: &config{
+				Endpoint:          "https://sourcegraph.com",
+				AccessToken:       "def",
+				AdditionalHeaders: map[string]string{},
+			},
+		},
+		{
+			name:      "token file should override config",
+			tokenFile: "ghi\n",
+			fileContents: &config{
+				Endpoint:    "https://example.com/",
+				AccessToken: "deadbeef",
+			},
+			want: &config{
+				Endpoint:          "https://example.com",
+				AccessToken:       "ghi",
+				AdditionalHeaders: map[string]string{},
+			},
+		},
+		{
+			name:      "token flag and token file",
+			flagToken: "def",
+			tokenFile: "ghi\n",
+			wantErr:   "only one of -token and -token-file may be given",
+		},
 
 		{
 			name:         "additional header",
@@ -159,6 +190,25 @@ func TestReadConfig(t *testing.T) {
 				endpoint = &val
 				t.Cleanup(func() { endpoint = nil })
 			}
+			if test.flagToken != "" {
+				val := test.flagToken
+				token = &val
+				t.Cleanup(func() { token = nil })
+			}
+			if test.tokenFile != "" {
+				f, err := ioutil.TempFile("", "token")
+				if err != nil {
+					t.Fatal(err)
+				}
+				t.Cleanup(func() { os.Remove(f.Name()) })
+				if _, err := f.WriteString(test.tokenFile); err != nil {
+					t.Fatal(err)
+				}
+				f.Close()
+				val := f.Name()
+				tokenFile = &val
+				t.Cleanup(func() { tokenFile = nil })
+			}
 
 			if test.fileContents != nil {
 				oldConfigPath := *configPath
@@ -199,3 +249,31 @@ func TestReadConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestReadTokenFileStdin(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdin := os.Stdin
+	os.Stdin = r
+	defer func() {
+		os.Stdin = stdin
+		delete(tokenFileTokens, "-")
+	}()
+	if _, err := w.WriteString("tok\n"); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	// The configuration is read by every nested command.
+	for i := 0; i < 2; i++ {
+		token, err := readTokenFile("-")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "tok" {
+			t.Errorf("unexpected token %q", token)
+		}
+	}
+}
@@ -29,9 +29,10 @@ Examples:
 		fmt.Println(usage)
 	}
 	var (
-		nameFlag   = flagSet.String("name", "", `Look up organization by name. (e.g. "abc-org")`)
-		formatFlag = flagSet.String("f", "{{.|json}}", `Format for the output, using the syntax of Go package text/template. (e.g. "{{.ID}}: {{.Name}} ({{.DisplayName}})")`)
-		apiFlags   = api.NewFlags(flagSet)
+		nameFlag         = flagSet.String("name", "", `Look up organization by name. (e.g. "abc-org")`)
+		formatFlag       = flagSet.String("f", "{{.|json}}", `Format for the output, using the syntax of Go package text/template. (e.g. "{{.ID}}: {{.Name}} ({{.DisplayName}})")`)
+		templateFileFlag = flagSet.String("template-file", "", templateFileFlagUsage)
+		apiFlags         = api.NewFlags(flagSet)
 	)
 
 	handler := func(args []string) error {
@@ -39,7 +40,7 @@ Examples:
 
 		client := cfg.apiClient(apiFlags, flagSet.Output())
 
-		tmpl, err := parseTemplate(*formatFlag)
+		tmpl, err := parseTemplateOrFile(*formatFlag, *templateFileFlag)
 		if err != nil {
 			return err
 		}
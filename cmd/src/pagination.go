@@ -0,0 +1,23 @@
+package main
+
+// pageInfo is the information about the pages of a GraphQL connection that
+// supports cursor pagination.
+type pageInfo struct {
+	EndCursor   *string
+	HasNextPage bool
+}
+
+// fetchPages calls fetch with the cursor of each page of a connection,
+// starting with nil for the first page, until fetch returns the info of the
+// last page, nil or an error. fetch returns nil if no request was made, e.g.
+// with -get-curl.
+func fetchPages(fetch func(after *string) (*pageInfo, error)) error {
+	var after *string
+	for {
+		page, err := fetch(after)
+		if err != nil || page == nil || !page.HasNextPage || page.EndCursor == nil {
+			return err
+		}
+		after = page.EndCursor
+	}
+}
@@ -3,6 +3,9 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
 )
 
 var campaignPatchSetsCommands commander
@@ -51,6 +54,7 @@ fragment PatchSetFields on PatchSet {
                 id
             }
             ... on Patch {
+                id
                 repository {
                     id
                     name
@@ -135,6 +139,7 @@ type FileDiffs struct {
 }
 
 type Patch struct {
+	ID         string `json:"id"`
 	Repository struct {
 		ID   string `json:"id"`
 		Name string `json:"name"`
@@ -153,3 +158,46 @@ type PatchSet struct {
 	} `json:"patches"`
 	PreviewURL string `json:"previewURL"`
 }
+
+// patchSummary is the repository, ID and diff stat of a patch of a patch set,
+// so that what was uploaded for a repository can be referred to later.
+type patchSummary struct {
+	Repository string `json:"repository"`
+	PatchID    string `json:"patchID"`
+	DiffStat
+}
+
+// hiddenPatchRepository is shown instead of the name of a repository that the
+// user can't see.
+const hiddenPatchRepository = "(hidden)"
+
+// summarizePatches returns the summaries of the patches of the patch set,
+// ordered by repository.
+func summarizePatches(patchSet PatchSet) []patchSummary {
+	summaries := make([]patchSummary, 0, len(patchSet.Patches.Nodes))
+	for _, p := range patchSet.Patches.Nodes {
+		repo := p.Repository.Name
+		if repo == "" {
+			repo = hiddenPatchRepository
+		}
+		summaries = append(summaries, patchSummary{
+			Repository: repo,
+			PatchID:    p.ID,
+			DiffStat:   p.Diff.FileDiffs.DiffStat,
+		})
+	}
+	sort.SliceStable(summaries, func(i, j int) bool {
+		return summaries[i].Repository < summaries[j].Repository
+	})
+	return summaries
+}
+
+// writePatchSummaries writes the summaries as a table with one row per patch.
+func writePatchSummaries(w io.Writer, summaries []patchSummary) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "REPOSITORY\tPATCH ID\tADDED\tCHANGED\tDELETED")
+	for _, s := range summaries {
+		fmt.Fprintf(tw, "%s\t%s\t+%d\t~%d\t-%d\n", s.Repository, s.PatchID, s.Added, s.Changed, s.Deleted)
+	}
+	return tw.Flush()
+}
@@ -2,14 +2,13 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
 	"os"
 	"text/template"
 
-	"github.com/mattn/go-isatty"
+	humanize "github.com/dustin/go-humanize"
 	"github.com/pkg/errors"
 	"github.com/sourcegraph/src-cli/internal/api"
 	"github.com/sourcegraph/src-cli/internal/campaigns"
@@ -35,10 +34,50 @@ Examples:
 		$ src actions exec -f action.json > patches.json
 		$ src campaigns patchset create-from-patches < patches.json
 
+  Create a patch set from patches.json and print the ID and diff stat of the patch of each repository as JSON, e.g. to refer to them in later commands:
+
+		$ src campaigns patchset create-from-patches -f '{{patchSetSummary . | json}}' < patches.json
+
+  Create a patch set from patches.json and immediately create a campaign from it, without previewing it on Sourcegraph first:
+
+		$ src campaigns patchset create-from-patches -apply -yes -name="Format Go code" \
+		   -desc="This campaign runs gofmt over all Go repositories" -branch=run-go-fmt < patches.json
+
+  If a campaign with the same name already exists in the namespace, -apply updates it with a new patch set, description and branch instead of creating another one. A hash of the input is stored in the user cache directory, and if the campaign was last created or updated from the same patches, description and branch on this machine, it is left alone. This makes it safe to run the command repeatedly, e.g. in CI.
+
+  Create several patch sets in requests of at most 10 MiB each, if the Sourcegraph instance rejects a patch set as too large. A campaign can be created from each of them:
+
+		$ src campaigns patchset create-from-patches -split-size 10MiB < patches.json
+
+  Keep the patches produced by 'src actions exec' if creating the patch set fails, e.g. because the instance is unavailable, and retry later without executing the action again:
+
+		$ src actions exec -f action.json | src campaigns patchset create-from-patches -retry-file patches-retry.json
+		$ src campaigns patchset create-from-patches -retry-file patches-retry.json
+
+  Create a patch set from patches generated with other tools, in a directory with a .patch file per repository, e.g. patches/github.com/my-org/my-repo.patch:
+
+		$ src campaigns patchset create-from-patches -patch-dir patches
+
+  Create a patch set from the patch of the uncommitted changes in a local checkout:
+
+		$ (echo '# repository: github.com/my-org/my-repo'; git diff) | src campaigns patchset create-from-patches -diff
+
   Create a patch set by piping output of 'src actions exec' into 'src patchset create-from-patches':
 
 		$ src actions exec -f action.json | src patchset create-from-patches < patches.json
 
+Importing patches:
+
+  With -patch-dir or -diff, patches in the unified diff format, e.g. produced by 'git diff', are imported instead of JSON patches. The repository, branch and commit a patch is for can be given with lines preceding it, which tools like 'git apply' ignore:
+
+		# repository: github.com/my-org/my-repo
+		# base-ref: refs/heads/release
+		# base-revision: 0123456789abcdef0123456789abcdef01234567
+		diff --git a/README.md b/README.md
+		...
+
+  Only the repository is required, unless the patch is in a .patch file with the path of the repository relative to -patch-dir. Without a base ref, the patch is based on the default branch, and without a base revision on the current head of its base ref. The files written by 'src actions exec -patch-dir' are annotated and can be imported again.
+
 `
 
 	flagSet := flag.NewFlagSet("create-from-patches", flag.ExitOnError)
@@ -48,32 +87,155 @@ Examples:
 		fmt.Println(usage)
 	}
 	var (
-		patchesFlag = flagSet.Int("patches", 1000, "Returns the first n patches in the patch set.")
-		formatFlag  = flagSet.String("f", "{{friendlyPatchSetCreatedMessage .}}", `Format for the output, using the syntax of Go package text/template. (e.g. "{{.ID}}: {{len .Patches}} patches") or "{{.|json}}")`)
-		apiFlags    = api.NewFlags(flagSet)
+		patchesFlag      = flagSet.Int("patches", 1000, "Returns the first n patches in the patch set.")
+		formatFlag       = flagSet.String("f", "{{friendlyPatchSetCreatedMessage .}}", `Format for the output, using the syntax of Go package text/template. (e.g. "{{.ID}}: {{len .Patches}} patches") or "{{.|json}}")`)
+		templateFileFlag = flagSet.String("template-file", "", templateFileFlagUsage)
+
+		applyFlag       = flagSet.Bool("apply", false, "Immediately create a campaign from the patch set instead of printing a link to preview it first. Requires -yes, -name, -desc and -branch.")
+		yesFlag         = flagSet.Bool("yes", false, "Confirm that -apply should create a campaign, and with it changesets, without a preview.")
+		nameFlag        = flagSet.String("name", "", "Name of the campaign created with -apply.")
+		descriptionFlag = flagSet.String("desc", "", "Description in Markdown of the campaign created with -apply.")
+		namespaceFlag   = flagSet.String("namespace", "", `The namespace under which to create the campaign with -apply: the name of a user or organization, optionally prefixed with "user:" or "org:", or its GraphQL ID. If not specified, the namespace of the authenticated user is used.`)
+		branchFlag      = flagSet.String("branch", "", "Name of the branch that the campaign created with -apply creates in each repository.")
+
+		patchDirFlag = flagSet.String("patch-dir", "", "Read the patches from the .patch files in this directory instead of standard input. See 'Importing patches' below.")
+		diffFlag     = flagSet.Bool("diff", false, "Standard input contains patches in the unified diff format, each preceded by a '# repository: <name>' line, instead of JSON. See 'Importing patches' below.")
+
+		validateFirstFlag = flagSet.Bool("validate-first", false, "Before the patch set is created from more than one patch, create one from the first patch only, so that errors of the Sourcegraph instance, e.g. a license that doesn't include campaigns, are reported before all patches were uploaded. This leaves an additional patch set, which is not attached to any campaign, on the instance.")
+
+		splitSizeFlag = flagSet.String("split-size", "", fmt.Sprintf(`Split the patches into several patch sets, each created in a request of at most this size, e.g. "10MiB", if the Sourcegraph instance rejects a single patch set as too large. %s of each request are reserved for the GraphQL query, the rest for the JSON-encoded patches. Conflicts with -apply, since a campaign is created from a single patch set.`, humanize.IBytes(splitSizeHeadroom)))
+
+		retryFileFlag = flagSet.String("retry-file", "", "If the patch set or campaign can't be created, write the patches to this file. If the file exists, the patches are read from it instead of standard input, and it is removed once the patch set or campaign was created.")
+
+		apiFlags = api.NewFlags(flagSet)
 	)
 
 	handler := func(args []string) error {
 		flagSet.Parse(args)
 
-		tmpl, err := parseTemplate(*formatFlag)
+		tmpl, err := parseTemplateOrFile(*formatFlag, *templateFileFlag)
 		if err != nil {
 			return err
 		}
 
-		if isatty.IsTerminal(os.Stdin.Fd()) {
-			log.Println("# Waiting for JSON patches input on stdin...")
+		if *applyFlag {
+			if !*yesFlag {
+				return &usageError{errors.New("-apply creates a campaign and its changesets without a preview, pass -yes to confirm")}
+			}
+			if *nameFlag == "" || *descriptionFlag == "" || *branchFlag == "" {
+				return &usageError{errors.New("-apply requires -name, -desc and -branch")}
+			}
 		}
 
-		var patches []campaigns.PatchInput
-		if err := json.NewDecoder(os.Stdin).Decode(&patches); err != nil {
-			return errors.Wrap(err, "invalid JSON patches input")
+		if *patchDirFlag != "" && *diffFlag {
+			return &usageError{errors.New("-patch-dir conflicts with -diff")}
+		}
+
+		var splitSize int
+		if *splitSizeFlag != "" {
+			if *applyFlag {
+				return &usageError{errors.New("-split-size conflicts with -apply, a campaign is created from a single patch set")}
+			}
+			size, err := humanize.ParseBytes(*splitSizeFlag)
+			if err != nil || size == 0 {
+				return &usageError{errors.Errorf("invalid -split-size %q", *splitSizeFlag)}
+			}
+			if size <= splitSizeHeadroom {
+				return &usageError{errors.Errorf("-split-size %q must be larger than the %s reserved for the GraphQL query", *splitSizeFlag, humanize.IBytes(splitSizeHeadroom))}
+			}
+			splitSize = int(size)
 		}
 
 		ctx := context.Background()
 		client := cfg.apiClient(apiFlags, flagSet.Output())
 
-		return createPatchSetFromPatches(ctx, client, patches, tmpl, *patchesFlag)
+		patches, err := readPatchesOrImport(ctx, client, *retryFileFlag, *patchDirFlag, *diffFlag)
+		if err != nil || patches == nil {
+			return err
+		}
+
+		if *validateFirstFlag {
+			if err := validatePatchSetSample(ctx, client, patches); err != nil {
+				return finishPatchesRetry(*retryFileFlag, patches, true, err)
+			}
+		}
+
+		if splitSize > 0 {
+			return createSplitPatchSets(ctx, client, patches, splitSize, *retryFileFlag, tmpl, *patchesFlag)
+		}
+
+		if !*applyFlag {
+			patchSet, err := createPatchSet(ctx, client, patches, *patchesFlag)
+			if err := finishPatchesRetry(*retryFileFlag, patches, patchSet == nil, err); err != nil || patchSet == nil {
+				return err
+			}
+			return execTemplate(tmpl, patchSet)
+		}
+
+		// Check the namespace before creating the patch set, which can take
+		// a while.
+		namespace, err := campaignNamespace(ctx, client, *namespaceFlag)
+		if err != nil {
+			return err
+		}
+		if *namespaceFlag != "" {
+			if err := requireCampaignNamespace(ctx, client, namespace); err != nil {
+				return err
+			}
+		}
+
+		// Applying the patches again, e.g. in a CI job that runs on every
+		// commit, updates the campaign instead of creating another one.
+		existing, err := findCampaign(ctx, client, *nameFlag, namespace)
+		if err != nil {
+			return err
+		}
+		spec := campaignSpec{
+			Name:        *nameFlag,
+			Description: *descriptionFlag,
+			Namespace:   namespace,
+			Branch:      *branchFlag,
+			Patches:     patches,
+		}
+		hash := spec.hash()
+		hashes := specHashStore{}
+		if dir, err := campaigns.UserCacheDir(); err == nil {
+			hashes.Dir = dir
+		}
+		if existing != nil && hashes.Dir != "" && hashes.get(cfg.Endpoint, existing.ID) == hash {
+			fmt.Printf("Campaign %q was already created from the same patches, skipping: %s\n", existing.Name, cfg.Endpoint+existing.URL)
+			return finishPatchesRetry(*retryFileFlag, patches, false, nil)
+		}
+
+		patchSet, err := createPatchSet(ctx, client, patches, *patchesFlag)
+		if err != nil || patchSet == nil {
+			return finishPatchesRetry(*retryFileFlag, patches, true, err)
+		}
+
+		campaign, err := applyPatchSet(ctx, client, existing, map[string]interface{}{
+			"name":        *nameFlag,
+			"description": *descriptionFlag,
+			"namespace":   namespace,
+			"patchSet":    patchSet.ID,
+			"branch":      *branchFlag,
+		}, *patchesFlag)
+		if err != nil {
+			return finishPatchesRetry(*retryFileFlag, patches, true, err)
+		}
+		if err := finishPatchesRetry(*retryFileFlag, patches, false, nil); err != nil {
+			return err
+		}
+		if hashes.Dir != "" {
+			if err := hashes.set(cfg.Endpoint, campaign.ID, hash); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to store the hash of the patches of campaign %s: %s\n", campaign.ID, err)
+			}
+		}
+
+		if existing != nil {
+			fmt.Printf("Campaign %q updated: %s\n", campaign.Name, cfg.Endpoint+campaign.URL)
+			return nil
+		}
+		return execTemplate(template.Must(parseTemplate("{{friendlyCampaignCreatedMessage .}}")), campaign)
 	}
 
 	// Register the command.
@@ -84,6 +246,66 @@ Examples:
 	})
 }
 
+// createSplitPatchSets splits the patches with splitPatches and creates a patch
+// set from each group. If a patch set can't be created, the patches of it and
+// of the groups after it are written to the retry file, if there is one.
+func createSplitPatchSets(ctx context.Context, client api.Client, patches []campaigns.PatchInput, splitSize int, retryFile string, tmpl *template.Template, numChangesets int) error {
+	groups, err := splitPatches(ctx, client, patches, splitSize)
+	if err != nil {
+		return err
+	}
+	if len(groups) > 1 {
+		log.Printf("# Creating %d patch sets in requests of at most %s each.", len(groups), humanize.IBytes(uint64(splitSize)))
+	}
+	for i, group := range groups {
+		patchSet, err := requestPatchSet(ctx, client, group, numChangesets)
+		if err != nil || patchSet == nil {
+			err = patchSetTooLargeError(ctx, client, group, splitSize, err)
+			var remaining []campaigns.PatchInput
+			for _, g := range groups[i:] {
+				remaining = append(remaining, g...)
+			}
+			return finishPatchesRetry(retryFile, remaining, true, err)
+		}
+		if err := execTemplate(tmpl, patchSet); err != nil {
+			return err
+		}
+	}
+	return finishPatchesRetry(retryFile, patches, false, nil)
+}
+
+// applyPatchSet creates a campaign with input, which includes the patch set,
+// or updates existing with it if it is not nil. Unlike createCampaign and
+// updateCampaign, it returns an error if no campaign was returned, e.g. with
+// -get-curl, since the patch set is then not attached to any campaign.
+func applyPatchSet(ctx context.Context, client api.Client, existing *campaignSummary, input map[string]interface{}, numChangesets int) (*Campaign, error) {
+	var (
+		campaign *Campaign
+		err      error
+		action   = "creating campaign"
+	)
+	if existing != nil {
+		action = fmt.Sprintf("updating campaign %s", existing.ID)
+		update := map[string]interface{}{"id": existing.ID}
+		for k, v := range input {
+			// The namespace of a campaign can't be changed.
+			if k != "namespace" {
+				update[k] = v
+			}
+		}
+		campaign, err = updateCampaign(ctx, client, update, numChangesets)
+	} else {
+		campaign, err = createCampaign(ctx, client, input, numChangesets)
+	}
+	if err == nil && campaign == nil {
+		err = errors.New("no campaign was returned")
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "%s with patch set %s failed, the patch set is not attached to any campaign", action, input["patchSet"])
+	}
+	return campaign, nil
+}
+
 const createPatchSetMutation = `
 mutation CreatePatchSetFromPatches($patches: [PatchInput!]!) {
   createPatchSetFromPatches(patches: $patches) {
@@ -99,6 +321,69 @@ func createPatchSetFromPatches(
 	tmpl *template.Template,
 	numChangesets int,
 ) error {
+	patchSet, err := createPatchSet(ctx, client, patches, numChangesets)
+	if err != nil || patchSet == nil {
+		return err
+	}
+	return execTemplate(tmpl, patchSet)
+}
+
+// validatePatchSetSample creates a patch set from the first of the patches, if
+// there is more than one, to find out whether the Sourcegraph instance accepts
+// them before all of them are uploaded. It returns the reason given by the
+// instance if it doesn't.
+//
+// The GraphQL API has no way to validate patches without creating a patch
+// set, and none to delete one, so the patch set created from the sample stays
+// on the instance. It is never attached to a campaign, which is why the check
+// is opt-in.
+func validatePatchSetSample(ctx context.Context, client api.Client, patches []campaigns.PatchInput) error {
+	if len(patches) < 2 {
+		return nil
+	}
+	if _, err := createPatchSet(ctx, client, patches[:1], 0); err != nil {
+		return errors.Wrapf(err, "the Sourcegraph instance rejected the first of %d patches, no patch set was created", len(patches))
+	}
+	return nil
+}
+
+// samplePatch is the patch validatePatchSetCreation creates a patch set from.
+// It adds a file, so that it applies to any revision of a repository.
+const samplePatch = `diff --git .src-validation .src-validation
+new file mode 100644
+--- /dev/null
++++ .src-validation
+@@ -0,0 +1 @@
++Created by 'src actions exec -validate-first' to check that patch sets can be created.
+`
+
+// validatePatchSetCreation creates a patch set from samplePatch for repo, like
+// validatePatchSetSample does from the first of the patches, to find out
+// whether the Sourcegraph instance accepts patch sets before an action is
+// executed, which can take hours. It returns the reason given by the instance
+// if it doesn't. The patch set stays on the instance, so the check is opt-in.
+func validatePatchSetCreation(ctx context.Context, client api.Client, repo campaigns.ActionRepo) error {
+	sample := campaigns.PatchInput{Repository: repo.ID, BaseRevision: repo.Rev, BaseRef: repo.BaseRef, Patch: samplePatch}
+	if _, err := createPatchSet(ctx, client, []campaigns.PatchInput{sample}, 0); err != nil {
+		return errors.Wrapf(err, "the Sourcegraph instance rejected a sample patch for %s, the action was not executed", repo.Name)
+	}
+	return nil
+}
+
+// createPatchSet creates a patch set from the given patches. It returns nil if
+// the request returned GraphQL errors, which have already been printed. If
+// the patch set is too large, the error names the largest patches, see
+// patchSetTooLargeError.
+func createPatchSet(ctx context.Context, client api.Client, patches []campaigns.PatchInput, numChangesets int) (*PatchSet, error) {
+	patchSet, err := requestPatchSet(ctx, client, patches, numChangesets)
+	if err != nil {
+		return nil, patchSetTooLargeError(ctx, client, patches, 0, err)
+	}
+	return patchSet, nil
+}
+
+// requestPatchSet is createPatchSet without the conversion of errors.
+func requestPatchSet(ctx context.Context, client api.Client, patches []campaigns.PatchInput, numChangesets int) (*PatchSet, error) {
 	query := createPatchSetMutation + patchSetFragment(numChangesets)
 
 	var result struct {
@@ -107,11 +392,11 @@ func createPatchSetFromPatches(
 
 	version, err := getSourcegraphVersion(ctx, client)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	supportsBaseRef, err := sourcegraphVersionCheck(version, ">= 3.14.0", "2020-03-11")
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// If we're on Sourcegraph >=3.14 the GraphQL API is "fixed" and accepts
@@ -126,6 +411,7 @@ func createPatchSetFromPatches(
 				BaseRevision: p.BaseRef,
 				BaseRef:      "IGNORE-THIS",
 				Patch:        p.Patch,
+				PatchFile:    p.PatchFile,
 			}
 		}
 		patches = patchesWithoutBaseRef
@@ -134,8 +420,8 @@ func createPatchSetFromPatches(
 	if ok, err := client.NewRequest(query, map[string]interface{}{
 		"patches": patches,
 	}).Do(ctx, &result); err != nil || !ok {
-		return err
+		return nil, err
 	}
 
-	return execTemplate(tmpl, result.CreatePatchSetFromPatches)
+	return &result.CreatePatchSetFromPatches, nil
 }
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/sourcegraph/src-cli/internal/api"
+	"github.com/sourcegraph/src-cli/internal/campaigns"
+)
+
+func TestValidatePatchSetSample(t *testing.T) {
+	patches := []campaigns.PatchInput{
+		{Repository: "repo1", BaseRevision: "a", BaseRef: "refs/heads/master", Patch: "+a\n"},
+		{Repository: "repo2", BaseRevision: "b", BaseRef: "refs/heads/master", Patch: "+b\n"},
+	}
+
+	for name, tc := range map[string]struct {
+		patches     []campaigns.PatchInput
+		reject      bool
+		wantPatches [][]campaigns.PatchInput
+		wantErr     string
+	}{
+		"single patch": {
+			patches: patches[:1],
+		},
+		"accepted": {
+			patches:     patches,
+			wantPatches: [][]campaigns.PatchInput{patches[:1]},
+		},
+		"rejected": {
+			patches:     patches,
+			reject:      true,
+			wantPatches: [][]campaigns.PatchInput{patches[:1]},
+			wantErr:     "the Sourcegraph instance rejected the first of 2 patches",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var created [][]campaigns.PatchInput
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var req struct {
+					Query     string
+					Variables struct {
+						Patches []campaigns.PatchInput
+					}
+				}
+				if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+					t.Fatal(err)
+				}
+				if !strings.Contains(req.Query, "createPatchSetFromPatches") {
+					w.Write([]byte(`{"data": {"site": {"productVersion": "3.17.0"}}}`))
+					return
+				}
+				created = append(created, req.Variables.Patches)
+				if tc.reject {
+					w.Write([]byte(`{"errors": [{"message": "campaigns are not included in the license"}]}`))
+					return
+				}
+				w.Write([]byte(`{"data": {"createPatchSetFromPatches": {"id": "UGF0Y2hTZXQ6MQ=="}}}`))
+			}))
+			defer ts.Close()
+			client := api.NewClient(api.ClientOpts{Endpoint: ts.URL, Out: ioutil.Discard})
+
+			err := validatePatchSetSample(context.Background(), client, tc.patches)
+			if tc.wantErr == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)) {
+				t.Fatalf("unexpected error %v, want %q", err, tc.wantErr)
+			}
+			if diff := cmp.Diff(tc.wantPatches, created); diff != "" {
+				t.Errorf("unexpected patch sets created (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestValidatePatchSetCreation(t *testing.T) {
+	repo := campaigns.ActionRepo{ID: "UmVwbzox", Name: "github.com/a", Rev: "deadbeef", BaseRef: "refs/heads/master"}
+
+	for name, tc := range map[string]struct {
+		reject  bool
+		wantErr string
+	}{
+		"accepted": {},
+		"rejected": {
+			reject:  true,
+			wantErr: "the Sourcegraph instance rejected a sample patch for github.com/a, the action was not executed",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var created [][]campaigns.PatchInput
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var req struct {
+					Query     string
+					Variables struct {
+						Patches []campaigns.PatchInput
+					}
+				}
+				if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+					t.Fatal(err)
+				}
+				if !strings.Contains(req.Query, "createPatchSetFromPatches") {
+					w.Write([]byte(`{"data": {"site": {"productVersion": "3.17.0"}}}`))
+					return
+				}
+				created = append(created, req.Variables.Patches)
+				if tc.reject {
+					w.Write([]byte(`{"errors": [{"message": "campaigns are not included in the license"}]}`))
+					return
+				}
+				w.Write([]byte(`{"data": {"createPatchSetFromPatches": {"id": "UGF0Y2hTZXQ6MQ=="}}}`))
+			}))
+			defer ts.Close()
+			client := api.NewClient(api.ClientOpts{Endpoint: ts.URL, Out: ioutil.Discard})
+
+			err := validatePatchSetCreation(context.Background(), client, repo)
+			if tc.wantErr == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)) {
+				t.Fatalf("unexpected error %v, want %q", err, tc.wantErr)
+			}
+			want := [][]campaigns.PatchInput{{{Repository: "UmVwbzox", BaseRevision: "deadbeef", BaseRef: "refs/heads/master", Patch: samplePatch}}}
+			if diff := cmp.Diff(want, created); diff != "" {
+				t.Errorf("unexpected patch sets created (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestApplyPatchSet(t *testing.T) {
+	input := map[string]interface{}{
+		"name":      "gofmt",
+		"namespace": "VXNlcjox",
+		"patchSet":  "UGF0Y2hTZXQ6MQ==",
+		"branch":    "gofmt",
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Query     string
+			Variables struct{ Input map[string]interface{} }
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(req.Query, "updateCampaign(") {
+			if _, ok := req.Variables.Input["namespace"]; ok {
+				t.Error("namespace sent when updating a campaign")
+			}
+			w.Write([]byte(`{"data": {"updateCampaign": {"id": "` + req.Variables.Input["id"].(string) + `"}}}`))
+			return
+		}
+		w.Write([]byte(`{"data": {"createCampaign": {"id": "Q2FtcGFpZ246Mg=="}}}`))
+	}))
+	defer ts.Close()
+
+	getCurl := flag.NewFlagSet("test", flag.ContinueOnError)
+	getCurlFlags := api.NewFlags(getCurl)
+	if err := getCurl.Parse([]string{"-get-curl"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, tc := range map[string]struct {
+		existing *campaignSummary
+		flags    *api.Flags
+		wantID   string
+		wantErr  string
+	}{
+		"create": {
+			wantID: "Q2FtcGFpZ246Mg==",
+		},
+		"update": {
+			existing: &campaignSummary{ID: "Q2FtcGFpZ246MQ=="},
+			wantID:   "Q2FtcGFpZ246MQ==",
+		},
+		"no request": {
+			flags:   getCurlFlags,
+			wantErr: "creating campaign with patch set UGF0Y2hTZXQ6MQ== failed, the patch set is not attached to any campaign",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			client := api.NewClient(api.ClientOpts{Endpoint: ts.URL, Flags: tc.flags, Out: ioutil.Discard})
+			campaign, err := applyPatchSet(context.Background(), client, tc.existing, input, 0)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("unexpected error %v, want %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if campaign.ID != tc.wantID {
+				t.Errorf("unexpected campaign %q, want %q", campaign.ID, tc.wantID)
+			}
+		})
+	}
+}
+
+func TestCreateSplitPatchSetsTooLarge(t *testing.T) {
+	var created int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Query string
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatal(err)
+		}
+		switch {
+		case strings.Contains(req.Query, "createPatchSetFromPatches"):
+			created++
+			http.Error(w, "request entity too large", http.StatusRequestEntityTooLarge)
+		case strings.Contains(req.Query, "RepositoryNames"):
+			w.Write([]byte(`{"data": {"repo0": {"name": "github.com/a"}}}`))
+		default:
+			w.Write([]byte(`{"data": {"site": {"productVersion": "3.17.0"}}}`))
+		}
+	}))
+	defer ts.Close()
+	client := api.NewClient(api.ClientOpts{Endpoint: ts.URL, Out: ioutil.Discard})
+
+	patches := []campaigns.PatchInput{
+		{Repository: "a", Patch: strings.Repeat("+a\n", 200)},
+		{Repository: "b", Patch: strings.Repeat("+b\n", 200)},
+	}
+	err := createSplitPatchSets(context.Background(), client, patches, splitSizeHeadroom+1024, "", nil, 0)
+	if errorExitCode(err) != exitCodeValidation {
+		t.Errorf("unexpected exit code %d", errorExitCode(err))
+	}
+	for _, want := range []string{"rejected the patch set of 1 patches", "github.com/a (600 B)", "Lower -split-size"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("error %v does not contain %q", err, want)
+		}
+	}
+	if created != 1 {
+		t.Errorf("unexpected number of patch set creations after the first was rejected: %d", created)
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/src-cli/internal/api"
+	"github.com/sourcegraph/src-cli/internal/campaigns"
+)
+
+// The annotations that precede a patch in the unified diff format to tell
+// which repository and branch it is for. Tools like 'git apply' ignore them.
+const (
+	patchRepositoryAnnotation   = "# repository: "
+	patchBaseRefAnnotation      = "# base-ref: "
+	patchBaseRevisionAnnotation = "# base-revision: "
+)
+
+// importedPatch is a patch in the unified diff format produced by another
+// tool than 'src actions exec'. BaseRef and BaseRevision are optional.
+type importedPatch struct {
+	Repository   string
+	BaseRef      string
+	BaseRevision string
+	Patch        string
+}
+
+// patchAnnotations returns the annotations for a patch produced by 'src
+// actions exec', so that it can be imported again.
+func patchAnnotations(repoName string, p campaigns.PatchInput) string {
+	return patchRepositoryAnnotation + repoName + "\n" +
+		patchBaseRefAnnotation + p.BaseRef + "\n" +
+		patchBaseRevisionAnnotation + p.BaseRevision + "\n"
+}
+
+// parseAnnotatedPatches reads patches in the unified diff format, each of
+// which is preceded by a "# repository: <name>" line and optionally by
+// "# base-ref: <ref>" and "# base-revision: <commit>" lines. If repoName is
+// set, the patches may omit the repository annotation and are for that
+// repository.
+func parseAnnotatedPatches(r io.Reader, repoName string) ([]importedPatch, error) {
+	var (
+		patches []importedPatch
+		current *importedPatch
+		inPatch bool
+	)
+	next := func() *importedPatch {
+		patches = append(patches, importedPatch{Repository: repoName})
+		inPatch = false
+		return &patches[len(patches)-1]
+	}
+
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 100*1024*1024)
+	for line := 1; s.Scan(); line++ {
+		text := s.Text()
+		switch {
+		case strings.HasPrefix(text, patchRepositoryAnnotation):
+			if current == nil || inPatch || current.Repository != repoName {
+				current = next()
+			}
+			current.Repository = strings.TrimSpace(strings.TrimPrefix(text, patchRepositoryAnnotation))
+		case strings.HasPrefix(text, patchBaseRefAnnotation) && !inPatch && current != nil:
+			current.BaseRef = strings.TrimSpace(strings.TrimPrefix(text, patchBaseRefAnnotation))
+		case strings.HasPrefix(text, patchBaseRevisionAnnotation) && !inPatch && current != nil:
+			current.BaseRevision = strings.TrimSpace(strings.TrimPrefix(text, patchBaseRevisionAnnotation))
+		default:
+			if current == nil {
+				if strings.TrimSpace(text) == "" {
+					continue
+				}
+				if repoName == "" {
+					return nil, fmt.Errorf("line %d: patch without a preceding %q line", line, strings.TrimSpace(patchRepositoryAnnotation)+" <name>")
+				}
+				current = next()
+			}
+			if strings.HasPrefix(text, "diff ") || strings.HasPrefix(text, "--- ") {
+				inPatch = true
+			}
+			current.Patch += text + "\n"
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return patches, nil
+}
+
+// readPatchDir reads the patches in the .patch files in dir. Unless they are
+// annotated like for parseAnnotatedPatches, they are for the repository named
+// like the path of the file relative to dir without the extension, e.g.
+// github.com/my-org/my-repo.patch.
+func readPatchDir(dir string) ([]importedPatch, error) {
+	var patches []importedPatch
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || filepath.Ext(path) != ".patch" {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		filePatches, err := parseAnnotatedPatches(f, filepath.ToSlash(strings.TrimSuffix(rel, ".patch")))
+		if err != nil {
+			return errors.Wrap(err, path)
+		}
+		patches = append(patches, filePatches...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(patches) == 0 {
+		return nil, fmt.Errorf("no .patch files found in %s", dir)
+	}
+	return patches, nil
+}
+
+const resolveImportedPatchQuery = `query ResolveImportedPatch($name: String!, $rev: String!, $hasRev: Boolean!) {
+  repository(name: $name) {
+    id
+    defaultBranch {
+      name
+      target {
+        oid
+      }
+    }
+    revCommit: commit(rev: $rev) @include(if: $hasRev) {
+      oid
+    }
+  }
+}`
+
+// resolveImportedPatches looks up the repositories of the patches. Patches
+// without a base ref are based on the default branch of their repository,
+// those without a base revision on the current head of their base ref.
+func resolveImportedPatches(ctx context.Context, client api.Client, imported []importedPatch) ([]campaigns.PatchInput, error) {
+	patches := make([]campaigns.PatchInput, 0, len(imported))
+	for _, p := range imported {
+		var result struct {
+			Repository *struct {
+				ID            string
+				DefaultBranch *struct {
+					Name   string
+					Target struct{ OID string }
+				}
+				RevCommit *struct{ OID string }
+			}
+		}
+		if ok, err := client.NewRequest(resolveImportedPatchQuery, map[string]interface{}{
+			"name":   p.Repository,
+			"rev":    p.BaseRef,
+			"hasRev": p.BaseRef != "" && p.BaseRevision == "",
+		}).Do(ctx, &result); err != nil {
+			return nil, errors.Wrapf(err, "resolving repository %s", p.Repository)
+		} else if !ok {
+			return nil, nil
+		}
+
+		repo := result.Repository
+		if repo == nil {
+			return nil, fmt.Errorf("repository not found: %s", p.Repository)
+		}
+		patch := campaigns.PatchInput{
+			Repository:   repo.ID,
+			BaseRef:      p.BaseRef,
+			BaseRevision: p.BaseRevision,
+			Patch:        p.Patch,
+		}
+		if patch.BaseRef == "" {
+			if repo.DefaultBranch == nil {
+				return nil, fmt.Errorf("the default branch of repository %s could not be determined, annotate the patch with %q", p.Repository, strings.TrimSpace(patchBaseRefAnnotation)+" <ref>")
+			}
+			patch.BaseRef = repo.DefaultBranch.Name
+			if patch.BaseRevision == "" {
+				patch.BaseRevision = repo.DefaultBranch.Target.OID
+			}
+		} else if patch.BaseRevision == "" {
+			if repo.RevCommit == nil {
+				return nil, fmt.Errorf("revision %q not found in repository %s", p.BaseRef, p.Repository)
+			}
+			patch.BaseRevision = repo.RevCommit.OID
+		}
+		patch.BaseRef = revisionRef(patch.BaseRef)
+		patches = append(patches, patch)
+	}
+	return patches, nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseAnnotatedPatches(t *testing.T) {
+	const (
+		readme = "diff --git a/README.md b/README.md\n--- a/README.md\n+++ b/README.md\n@@ -1 +1 @@\n-old\n+new\n"
+		main   = "diff --git a/main.go b/main.go\n--- a/main.go\n+++ b/main.go\n@@ -1 +1 @@\n-package foo\n+package bar\n"
+	)
+
+	for _, tc := range []struct {
+		name     string
+		input    string
+		repoName string
+		want     []importedPatch
+		wantErr  bool
+	}{
+		{
+			name:  "annotated patches",
+			input: "# repository: github.com/a\n" + readme + "# repository: github.com/b\n# base-ref: refs/heads/release\n# base-revision: c1\n" + main,
+			want: []importedPatch{
+				{Repository: "github.com/a", Patch: readme},
+				{Repository: "github.com/b", BaseRef: "refs/heads/release", BaseRevision: "c1", Patch: main},
+			},
+		},
+		{
+			name:     "patch for the repository of the file",
+			input:    readme + main,
+			repoName: "github.com/a",
+			want:     []importedPatch{{Repository: "github.com/a", Patch: readme + main}},
+		},
+		{
+			name:     "annotation overrides the repository of the file",
+			input:    "# repository: github.com/b\n# base-ref: refs/heads/release\n" + readme,
+			repoName: "github.com/a",
+			want:     []importedPatch{{Repository: "github.com/b", BaseRef: "refs/heads/release", Patch: readme}},
+		},
+		{
+			name:    "missing repository",
+			input:   readme,
+			wantErr: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			have, err := parseAnnotatedPatches(strings.NewReader(tc.input), tc.repoName)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("unexpected nil error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, have); diff != "" {
+				t.Errorf("unexpected patches (-want +have):\n%s", diff)
+			}
+		})
+	}
+}
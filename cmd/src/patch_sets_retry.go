@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/mattn/go-isatty"
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/src-cli/internal/api"
+	"github.com/sourcegraph/src-cli/internal/campaigns"
+)
+
+// readPatchesInput reads the patches from retryFile, if it is set and exists,
+// and from standard input otherwise.
+func readPatchesInput(retryFile string) ([]campaigns.PatchInput, error) {
+	var in io.Reader = os.Stdin
+	if retryFile != "" {
+		f, err := os.Open(retryFile)
+		if err == nil {
+			defer f.Close()
+			log.Printf("# Retrying with the patches in %s", retryFile)
+			in = f
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	if in == os.Stdin && isatty.IsTerminal(os.Stdin.Fd()) {
+		log.Println("# Waiting for JSON patches input on stdin...")
+	}
+
+	var patches []campaigns.PatchInput
+	if err := json.NewDecoder(in).Decode(&patches); err != nil {
+		return nil, errors.Wrap(err, "invalid JSON patches input")
+	}
+	if err := validatePatches(patches); err != nil {
+		return nil, err
+	}
+	return patches, nil
+}
+
+// readPatchesOrImport reads the patches from retryFile, if it is set and
+// exists, and otherwise imports them from the .patch files in patchDir, if
+// set, or from standard input, which contains annotated patches if diff is set
+// and JSON patches otherwise. It returns nil if the repositories of imported
+// patches could not be resolved because of the -get-curl flag.
+func readPatchesOrImport(ctx context.Context, client api.Client, retryFile, patchDir string, diff bool) ([]campaigns.PatchInput, error) {
+	if patchDir == "" && !diff {
+		return readPatchesInput(retryFile)
+	}
+	if retryFile != "" {
+		if _, err := os.Stat(retryFile); err == nil {
+			return readPatchesInput(retryFile)
+		}
+	}
+
+	var (
+		imported []importedPatch
+		err      error
+	)
+	if patchDir != "" {
+		imported, err = readPatchDir(patchDir)
+	} else {
+		if isatty.IsTerminal(os.Stdin.Fd()) {
+			log.Println("# Waiting for annotated patches on stdin...")
+		}
+		imported, err = parseAnnotatedPatches(os.Stdin, "")
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid patches input")
+	}
+	patches, err := resolveImportedPatches(ctx, client, imported)
+	if err != nil || patches == nil {
+		return nil, err
+	}
+	if err := validatePatches(patches); err != nil {
+		return nil, err
+	}
+	return patches, nil
+}
+
+// validatePatches checks all patches before they are uploaded and reports
+// every invalid one, instead of failing on the first.
+func validatePatches(patches []campaigns.PatchInput) error {
+	var problems []string
+	for i, p := range patches {
+		var missing []string
+		if p.Repository == "" {
+			missing = append(missing, "repository")
+		}
+		if p.BaseRevision == "" {
+			missing = append(missing, "baseRevision")
+		}
+		if p.BaseRef == "" {
+			missing = append(missing, "baseRef")
+		}
+		if strings.TrimSpace(p.Patch) == "" {
+			missing = append(missing, "patch")
+		}
+		if len(missing) > 0 {
+			problems = append(problems, fmt.Sprintf("\t- patch %d (repository %q): missing %s", i+1, p.Repository, strings.Join(missing, ", ")))
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return &exitCodeError{
+		error:    fmt.Errorf("%d of %d patches are invalid:\n%s", len(problems), len(patches), strings.Join(problems, "\n")),
+		exitCode: exitCodeValidation,
+	}
+}
+
+// finishPatchesRetry keeps the patches in retryFile if err is non-nil or
+// failed is set, so that they can be retried without executing the action
+// again, and removes retryFile otherwise.
+func finishPatchesRetry(retryFile string, patches []campaigns.PatchInput, failed bool, err error) error {
+	if retryFile == "" {
+		return err
+	}
+	if err == nil && !failed {
+		if rerr := os.Remove(retryFile); rerr != nil && !os.IsNotExist(rerr) {
+			return rerr
+		}
+		return nil
+	}
+
+	if werr := writePatchesFile(retryFile, patches); werr != nil {
+		if err == nil {
+			return werr
+		}
+		return errors.Wrapf(err, "the patches could not be written to the retry file %s: %s", retryFile, werr)
+	}
+	log.Printf("# The %d patches were written to %s. Run the same command again to retry.", len(patches), retryFile)
+	return err
+}
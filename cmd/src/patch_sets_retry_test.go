@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/sourcegraph/src-cli/internal/campaigns"
+)
+
+func TestValidatePatches(t *testing.T) {
+	valid := campaigns.PatchInput{Repository: "UmVwbzox", BaseRevision: "f00b4r", BaseRef: "refs/heads/master", Patch: "diff --git a/a b/a"}
+
+	if err := validatePatches([]campaigns.PatchInput{valid}); err != nil {
+		t.Errorf("unexpected error for valid patch: %s", err)
+	}
+
+	err := validatePatches([]campaigns.PatchInput{
+		{Repository: "UmVwbzoy", BaseRevision: "f00b4r", BaseRef: "refs/heads/master"},
+		valid,
+		{BaseRevision: "f00b4r", Patch: "diff --git a/a b/a"},
+	})
+	if err == nil {
+		t.Fatal("no error for invalid patches")
+	}
+	want := `2 of 3 patches are invalid:
+	- patch 1 (repository "UmVwbzoy"): missing patch
+	- patch 3 (repository ""): missing repository, baseRef`
+	if !strings.HasPrefix(err.Error(), want) {
+		t.Errorf("unexpected error:\n%s", err)
+	}
+}
+
+func TestFinishPatchesRetry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "patches-retry-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	retryFile := filepath.Join(dir, "retry.json")
+
+	patches := []campaigns.PatchInput{{Repository: "UmVwbzox", BaseRevision: "f00b4r", BaseRef: "refs/heads/master", Patch: "diff --git a/a b/a"}}
+	uploadErr := errors.New("upload failed")
+
+	if err := finishPatchesRetry(retryFile, patches, true, uploadErr); err != uploadErr {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	have, err := readPatchesInput(retryFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(patches, have); diff != "" {
+		t.Errorf("unexpected patches in retry file (-want +have):\n%s", diff)
+	}
+
+	if err := finishPatchesRetry(retryFile, patches, false, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(retryFile); !os.IsNotExist(err) {
+		t.Errorf("retry file was not removed: %v", err)
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	humanize "github.com/dustin/go-humanize"
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/src-cli/internal/api"
+	"github.com/sourcegraph/src-cli/internal/campaigns"
+)
+
+// largestPatchesReported is the number of patches named by the error returned
+// when a patch set is too large for the Sourcegraph instance.
+const largestPatchesReported = 5
+
+// splitSizeHeadroom is the number of bytes of -split-size reserved for the
+// parts of a request other than the JSON-encoded patches, i.e. the GraphQL
+// query and the JSON object around the patches, which take up a few KiB.
+const splitSizeHeadroom = 16 << 10
+
+// patchSetTooLargeError returns an error naming the largest of the patches and
+// their sizes if err is the rejection of a patch set that exceeds the request
+// size limit of the Sourcegraph instance, or err otherwise. A patch set is
+// created in a single request, so the patches have to be split into several
+// patch sets with splitPatches, the largest left out, or the limit raised.
+// splitSize is the -split-size the patches were split with, or 0 if they
+// weren't.
+func patchSetTooLargeError(ctx context.Context, client api.Client, patches []campaigns.PatchInput, splitSize int, err error) error {
+	var httpErr *api.HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusRequestEntityTooLarge {
+		return err
+	}
+
+	largest := largestPatches(patches, largestPatchesReported)
+	ids := make([]string, len(largest))
+	for i, p := range largest {
+		ids[i] = p.Repository
+	}
+	// The patches only contain the IDs of the repositories; if their names
+	// can't be looked up, the IDs have to do.
+	names, _ := fetchRepoNamesByID(ctx, client, ids)
+
+	var total int
+	for _, p := range patches {
+		total += patchSize(p)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "the Sourcegraph instance rejected the patch set of %d patches (%s in total) as too large (%s).\n", len(patches), humanize.IBytes(uint64(total)), httpErr.Status)
+	if splitSize > 0 {
+		fmt.Fprintf(&b, "The patches were split into patch sets with -split-size %s, which is above the request size limit of the instance.\n", humanize.IBytes(uint64(splitSize)))
+	}
+	b.WriteString("The largest patches are:\n")
+	for _, p := range largest {
+		name := names[p.Repository]
+		if name == "" {
+			name = p.Repository
+		}
+		fmt.Fprintf(&b, "  %s (%s)\n", name, humanize.IBytes(uint64(patchSize(p))))
+	}
+	if splitSize > 0 {
+		b.WriteString("Lower -split-size, ")
+	} else {
+		b.WriteString("Split the patches into several patch sets with -split-size, ")
+	}
+	b.WriteString("leave out the largest patches, e.g. by excluding their repositories from the action, or ask the site admin to raise the request size limit of the instance.")
+	return &exitCodeError{error: errors.New(b.String()), exitCode: exitCodeValidation}
+}
+
+// splitPatches splits the patches into groups, keeping their order, so that a
+// patch set can be created from each group in a request of at most maxSize
+// bytes, which stays under the request size limit of the Sourcegraph instance.
+// The patches are sized as they are sent, JSON-encoded, and splitSizeHeadroom
+// bytes of each request are reserved for the rest of it. A single patch that
+// doesn't fit into a request can't be split, so an error naming its
+// repository and size is returned.
+func splitPatches(ctx context.Context, client api.Client, patches []campaigns.PatchInput, maxSize int) ([][]campaigns.PatchInput, error) {
+	var (
+		groups [][]campaigns.PatchInput
+		group  []campaigns.PatchInput
+		size   int
+	)
+	for _, p := range patches {
+		// Each patch is followed by a comma in the JSON array of patches.
+		encoded, err := encodedPatchSize(p)
+		if err != nil {
+			return nil, err
+		}
+		encoded++
+
+		if splitSizeHeadroom+encoded > maxSize {
+			name := p.Repository
+			if names, _ := fetchRepoNamesByID(ctx, client, []string{p.Repository}); names[p.Repository] != "" {
+				name = names[p.Repository]
+			}
+			return nil, &exitCodeError{
+				error:    fmt.Errorf("the patch of %s (%s encoded as JSON) doesn't fit into a request of the split size of %s, %s of which are reserved for the rest of the request, and can't be split", name, humanize.IBytes(uint64(encoded)), humanize.IBytes(uint64(maxSize)), humanize.IBytes(splitSizeHeadroom)),
+				exitCode: exitCodeValidation,
+			}
+		}
+		if len(group) > 0 && splitSizeHeadroom+size+encoded > maxSize {
+			groups = append(groups, group)
+			group, size = nil, 0
+		}
+		group = append(group, p)
+		size += encoded
+	}
+	if len(group) > 0 {
+		groups = append(groups, group)
+	}
+	return groups, nil
+}
+
+// largestPatches returns up to n of the patches, largest first.
+func largestPatches(patches []campaigns.PatchInput, n int) []campaigns.PatchInput {
+	sorted := make([]campaigns.PatchInput, len(patches))
+	copy(sorted, patches)
+	sort.SliceStable(sorted, func(i, j int) bool { return patchSize(sorted[i]) > patchSize(sorted[j]) })
+	if len(sorted) > n {
+		sorted = sorted[:n]
+	}
+	return sorted
+}
+
+// patchSize returns the size of the patch p in bytes, without reading patches
+// kept on disk. If their size can't be determined, they count as empty, since
+// reading them when the patch set is created fails anyway.
+func patchSize(p campaigns.PatchInput) int {
+	size, _ := p.PatchSize()
+	return int(size)
+}
+
+// encodedPatchSize returns the size of the patch p encoded as JSON, as it is
+// sent to the Sourcegraph instance. Patches kept on disk are read, one at a
+// time.
+func encodedPatchSize(p campaigns.PatchInput) (int, error) {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return 0, errors.Wrapf(err, "encoding the patch of %s", p.Repository)
+	}
+	return len(data), nil
+}
+
+// fetchRepoNamesByID returns the names of the repositories with the given
+// GraphQL IDs, keyed by ID. Repositories that don't exist are left out.
+func fetchRepoNamesByID(ctx context.Context, client api.Client, ids []string) (map[string]string, error) {
+	names := make(map[string]string, len(ids))
+	if len(ids) == 0 {
+		return names, nil
+	}
+
+	var query strings.Builder
+	query.WriteString("query RepositoryNames(")
+	vars := map[string]interface{}{}
+	for i, id := range ids {
+		if i > 0 {
+			query.WriteString(", ")
+		}
+		fmt.Fprintf(&query, "$id%d: ID!", i)
+		vars[fmt.Sprintf("id%d", i)] = id
+	}
+	query.WriteString(") {\n")
+	for i := range ids {
+		fmt.Fprintf(&query, "  repo%d: node(id: $id%d) { ... on Repository { name } }\n", i, i)
+	}
+	query.WriteString("}")
+
+	var result map[string]*struct {
+		Name string
+	}
+	if ok, err := client.NewRequest(query.String(), vars).Do(ctx, &result); err != nil || !ok {
+		return names, err
+	}
+	for i, id := range ids {
+		if r := result[fmt.Sprintf("repo%d", i)]; r != nil && r.Name != "" {
+			names[id] = r.Name
+		}
+	}
+	return names, nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/src-cli/internal/api"
+	"github.com/sourcegraph/src-cli/internal/campaigns"
+)
+
+func TestPatchSetTooLargeError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data": {"repo0": {"name": "github.com/sourcegraph/huge"}, "repo1": null}}`))
+	}))
+	defer ts.Close()
+	client := api.NewClient(api.ClientOpts{Endpoint: ts.URL, Out: ioutil.Discard})
+
+	patches := []campaigns.PatchInput{
+		{Repository: "small", Patch: "+a\n"},
+		{Repository: "huge", Patch: strings.Repeat("+a\n", 1000)},
+		{Repository: "deleted", Patch: strings.Repeat("+a\n", 10)},
+	}
+
+	other := errors.New("other")
+	if err := patchSetTooLargeError(context.Background(), client, patches, 0, other); err != other {
+		t.Errorf("unexpected error for other errors: %v", err)
+	}
+
+	tooLarge := errors.Wrap(&api.HTTPError{StatusCode: 413, Status: "413 Request Entity Too Large"}, "creating patch set")
+	err := patchSetTooLargeError(context.Background(), client, patches, 0, tooLarge)
+	if errorExitCode(err) != exitCodeValidation {
+		t.Errorf("unexpected exit code %d", errorExitCode(err))
+	}
+	msg := err.Error()
+	for _, want := range []string{"3 patches (3.0 KiB in total)", "github.com/sourcegraph/huge (2.9 KiB)\n  deleted (30 B)\n  small (3 B)"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("error does not contain %q:\n%s", want, msg)
+		}
+	}
+	if strings.Contains(msg, "Lower -split-size") {
+		t.Errorf("error of unsplit patches suggests lowering -split-size:\n%s", msg)
+	}
+
+	msg = patchSetTooLargeError(context.Background(), client, patches, 1<<20, tooLarge).Error()
+	for _, want := range []string{"split into patch sets with -split-size 1.0 MiB", "Lower -split-size, leave out the largest patches"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("error does not contain %q:\n%s", want, msg)
+		}
+	}
+}
+
+func TestSplitPatches(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data": {"repo0": {"name": "github.com/sourcegraph/huge"}}}`))
+	}))
+	defer ts.Close()
+	client := api.NewClient(api.ClientOpts{Endpoint: ts.URL, Out: ioutil.Discard})
+
+	// Every patch takes up the JSON around an empty patch of a repository
+	// with a one-letter name and a comma, in addition to its encoded patch.
+	empty, err := encodedPatchSize(campaigns.PatchInput{Repository: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	overhead := empty + 1
+	maxSize := splitSizeHeadroom + 2*overhead + 10
+
+	repos := func(groups [][]campaigns.PatchInput) [][]string {
+		var have [][]string
+		for _, group := range groups {
+			var repos []string
+			for _, p := range group {
+				repos = append(repos, p.Repository)
+			}
+			have = append(have, repos)
+		}
+		return have
+	}
+
+	for name, tc := range map[string]struct {
+		patches []campaigns.PatchInput
+		want    [][]string
+	}{
+		"patch sizes": {
+			patches: []campaigns.PatchInput{
+				{Repository: "a", Patch: strings.Repeat("x", 4)},
+				{Repository: "b", Patch: strings.Repeat("x", 5)},
+				{Repository: "c", Patch: strings.Repeat("x", 10)},
+				{Repository: "d", Patch: strings.Repeat("x", 1)},
+			},
+			want: [][]string{{"a", "b"}, {"c"}, {"d"}},
+		},
+		"escaped characters": {
+			// Quotes and newlines take up two bytes each when encoded.
+			patches: []campaigns.PatchInput{
+				{Repository: "a", Patch: strings.Repeat("x", 4)},
+				{Repository: "b", Patch: strings.Repeat("\"\n", 2)},
+				{Repository: "c", Patch: strings.Repeat("x", 2)},
+			},
+			want: [][]string{{"a"}, {"b", "c"}},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			groups, err := splitPatches(context.Background(), client, tc.patches, maxSize)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, repos(groups)); diff != "" {
+				t.Errorf("unexpected groups (-want +have):\n%s", diff)
+			}
+		})
+	}
+
+	_, err = splitPatches(context.Background(), client, []campaigns.PatchInput{{Repository: "huge", Patch: strings.Repeat("x", 2048)}}, splitSizeHeadroom+1024)
+	if errorExitCode(err) != exitCodeValidation {
+		t.Errorf("unexpected exit code %d", errorExitCode(err))
+	}
+	if want := "the patch of github.com/sourcegraph/huge (2.1 KiB encoded as JSON) doesn't fit into a request of the split size of 17 KiB, 16 KiB of which are reserved for the rest of the request, and can't be split"; err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("unexpected error %v, want %q", err, want)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSummarizePatches(t *testing.T) {
+	var patchSet PatchSet
+	if err := json.Unmarshal([]byte(`{
+		"id": "UGF0Y2hTZXQ6MQ==",
+		"patches": {"nodes": [
+			{"__typename": "Patch", "id": "UGF0Y2g6Mg==", "repository": {"name": "github.com/sourcegraph/src-cli"}, "diff": {"fileDiffs": {"diffStat": {"added": 3, "deleted": 1, "changed": 2}}}},
+			{"__typename": "HiddenPatch", "id": "UGF0Y2g6Mw=="},
+			{"__typename": "Patch", "id": "UGF0Y2g6MQ==", "repository": {"name": "github.com/sourcegraph/go-diff"}, "diff": {"fileDiffs": {"diffStat": {"added": 10, "deleted": 0, "changed": 0}}}}
+		]}
+	}`), &patchSet); err != nil {
+		t.Fatal(err)
+	}
+
+	summaries := summarizePatches(patchSet)
+	want := []patchSummary{
+		{Repository: "(hidden)", PatchID: "UGF0Y2g6Mw=="},
+		{Repository: "github.com/sourcegraph/go-diff", PatchID: "UGF0Y2g6MQ==", DiffStat: DiffStat{Added: 10}},
+		{Repository: "github.com/sourcegraph/src-cli", PatchID: "UGF0Y2g6Mg==", DiffStat: DiffStat{Added: 3, Deleted: 1, Changed: 2}},
+	}
+	if diff := cmp.Diff(want, summaries); diff != "" {
+		t.Errorf("unexpected summaries (-want +got):\n%s", diff)
+	}
+
+	b, err := json.Marshal(summaries[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"repository":"github.com/sourcegraph/src-cli","patchID":"UGF0Y2g6Mg==","added":3,"deleted":1,"changed":2}`; string(b) != want {
+		t.Errorf("unexpected JSON:\n got %s\nwant %s", b, want)
+	}
+
+	var buf bytes.Buffer
+	if err := writePatchSummaries(&buf, summaries); err != nil {
+		t.Fatal(err)
+	}
+	wantTable := `REPOSITORY                      PATCH ID      ADDED  CHANGED  DELETED
+(hidden)                        UGF0Y2g6Mw==  +0     ~0       -0
+github.com/sourcegraph/go-diff  UGF0Y2g6MQ==  +10    ~0       -0
+github.com/sourcegraph/src-cli  UGF0Y2g6Mg==  +3     ~2       -1
+`
+	if diff := cmp.Diff(wantTable, buf.String()); diff != "" {
+		t.Errorf("unexpected table (-want +got):\n%s", diff)
+	}
+}
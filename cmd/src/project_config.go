@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+)
+
+// projectConfigFile is the name of the file with the project configuration,
+// which is read from the home directory and the working directory.
+const projectConfigFile = ".src.yaml"
+
+// projectCfg is the project configuration read before a command is executed.
+var projectCfg *projectConfig
+
+// projectConfig contains default values for flags, so that teams can commit
+// the settings they use next to their action definitions, e.g.:
+//
+//	endpoint: https://sourcegraph.example.com
+//	commands:
+//	  actions exec:
+//	    j: 4
+//	    allow-unsupported: include
+//	  campaigns create:
+//	    namespace: our-org
+//
+// Flags that name executables, output paths or files with secrets can only be
+// set in the home directory, see untrustedFlags.
+type projectConfig struct {
+	// Endpoint is used unless SRC_ENDPOINT or -endpoint is set. It may only
+	// be set in the home directory: the access token would otherwise be sent
+	// to whatever endpoint a checked out repository names.
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// Commands maps commands, e.g. "actions exec", to the default values of
+	// their flags, keyed by flag name.
+	Commands map[string]map[string]interface{} `json:"commands,omitempty"`
+
+	// paths are the files the configuration was read from.
+	paths []string
+}
+
+// readProjectConfig reads the project configuration from the home directory
+// and the working directory. Values in the working directory take precedence.
+// It returns nil if neither contains a configuration file.
+func readProjectConfig() (*projectConfig, error) {
+	var (
+		dirs []string
+		home string
+	)
+	if u, err := user.Current(); err == nil {
+		home = u.HomeDir
+		dirs = append(dirs, home)
+	}
+	if wd, err := os.Getwd(); err == nil && (home == "" || filepath.Clean(wd) != filepath.Clean(home)) {
+		dirs = append(dirs, wd)
+	}
+
+	var merged *projectConfig
+	for _, dir := range dirs {
+		path := filepath.Join(dir, projectConfigFile)
+		data, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		c, err := parseProjectConfig(data)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid project configuration %s", path)
+		}
+		if dir != home {
+			if err := c.checkUntrusted(); err != nil {
+				return nil, errors.Wrapf(err, "invalid project configuration %s", path)
+			}
+		}
+		c.paths = []string{path}
+		merged = merged.merge(c)
+	}
+	return merged, nil
+}
+
+func parseProjectConfig(data []byte) (*projectConfig, error) {
+	data, err := yaml.YAMLToJSONStrict(data)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(strings.NewReader(string(data)))
+	dec.DisallowUnknownFields()
+	dec.UseNumber()
+	var c projectConfig
+	if err := dec.Decode(&c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// untrustedFlags are the flags that can't be set by the configuration in the
+// working directory, keyed by name, with the reason. A checked out repository
+// could otherwise make src run executables of its choice, overwrite files
+// outside of it, hand local secrets to the steps of its actions or print the
+// access token.
+var untrustedFlags = map[string]string{
+	"pre-task-hook":  "names an executable",
+	"post-step-hook": "names an executable",
+	"post-task-hook": "names an executable",
+
+	"o":               "names an output path",
+	"cache":           "names an output path",
+	"patch-dir":       "names an output path",
+	"artifacts-dir":   "names an output path",
+	"provenance-file": "names an output path",
+	"metrics-file":    "names an output path",
+	"retry-file":      "names an output path",
+	"save-schema":     "names an output path",
+	"record":          "names an output path",
+
+	"secrets-file":   "names a file with secrets",
+	"provenance-key": "names a file with secrets",
+
+	"get-curl": "prints the access token",
+}
+
+// checkUntrusted returns an error if the configuration, which was read from
+// the working directory, sets values that must not come from a repository.
+func (c *projectConfig) checkUntrusted() error {
+	if c.Endpoint != "" {
+		return errors.New("the endpoint can only be set in the configuration in the home directory, or with SRC_ENDPOINT or -endpoint")
+	}
+
+	commands := make([]string, 0, len(c.Commands))
+	for command := range c.Commands {
+		commands = append(commands, command)
+	}
+	sort.Strings(commands)
+	for _, command := range commands {
+		names := make([]string, 0, len(c.Commands[command]))
+		for name := range c.Commands[command] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if reason, ok := untrustedFlags[name]; ok {
+				return fmt.Errorf("-%s of %q %s, so it can only be set in the configuration in the home directory or on the command line", name, "src "+command, reason)
+			}
+		}
+	}
+	return nil
+}
+
+// merge returns the configuration with the values in o taking precedence
+// over those in c. c may be nil.
+func (c *projectConfig) merge(o *projectConfig) *projectConfig {
+	if c == nil {
+		return o
+	}
+	merged := &projectConfig{
+		Endpoint: c.Endpoint,
+		Commands: map[string]map[string]interface{}{},
+		paths:    append(append([]string{}, c.paths...), o.paths...),
+	}
+	if o.Endpoint != "" {
+		merged.Endpoint = o.Endpoint
+	}
+	for _, cc := range []*projectConfig{c, o} {
+		for command, flags := range cc.Commands {
+			if merged.Commands[command] == nil {
+				merged.Commands[command] = map[string]interface{}{}
+			}
+			for name, value := range flags {
+				merged.Commands[command][name] = value
+			}
+		}
+	}
+	return merged
+}
+
+// applyFlagDefaults sets the flags of command, e.g. "actions exec", that were
+// not given explicitly to the values in the configuration. c may be nil.
+func (c *projectConfig) applyFlagDefaults(command string, flagSet *flag.FlagSet) error {
+	if c == nil || len(c.Commands[command]) == 0 {
+		return nil
+	}
+
+	explicit := map[string]bool{}
+	flagSet.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	flags := c.Commands[command]
+	names := make([]string, 0, len(flags))
+	for name := range flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if flagSet.Lookup(name) == nil {
+			return fmt.Errorf("%s: %q has no flag -%s", strings.Join(c.paths, ", "), "src "+command, name)
+		}
+		if explicit[name] {
+			continue
+		}
+		value, err := projectConfigFlagValue(flags[name])
+		if err != nil {
+			return errors.Wrapf(err, "%s: invalid value for -%s of %q", strings.Join(c.paths, ", "), name, "src "+command)
+		}
+		if err := flagSet.Set(name, value); err != nil {
+			return errors.Wrapf(err, "%s: invalid value for -%s of %q", strings.Join(c.paths, ", "), name, "src "+command)
+		}
+	}
+	return nil
+}
+
+// projectConfigFlagValue returns the flag value for a scalar YAML value.
+func projectConfigFlagValue(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return fmt.Sprint(v), nil
+	}
+	return "", errors.New("must be a string, number or boolean")
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestProjectConfigApplyFlagDefaults(t *testing.T) {
+	home, err := parseProjectConfig([]byte(`
+endpoint: https://sourcegraph.example.com
+commands:
+  actions exec:
+    j: 8
+    cache: ~/.cache/src
+    keep-logs: true
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	project, err := parseProjectConfig([]byte(`
+commands:
+  actions exec:
+    keep-logs: false
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := home.merge(project)
+	if c.Endpoint != "https://sourcegraph.example.com" {
+		t.Errorf("unexpected endpoint: %q", c.Endpoint)
+	}
+
+	flagSet := flag.NewFlagSet("exec", flag.ContinueOnError)
+	var (
+		j        = flagSet.Int("j", 4, "")
+		cache    = flagSet.String("cache", "", "")
+		keepLogs = flagSet.Bool("keep-logs", false, "")
+	)
+	if err := flagSet.Parse([]string{"-j", "2"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.applyFlagDefaults("actions exec", flagSet); err != nil {
+		t.Fatal(err)
+	}
+	have := []interface{}{*j, *cache, *keepLogs}
+	if diff := cmp.Diff([]interface{}{2, "~/.cache/src", false}, have); diff != "" {
+		t.Errorf("unexpected flag values (-want +have):\n%s", diff)
+	}
+
+	unknown, err := parseProjectConfig([]byte("commands:\n  actions exec:\n    parallelism: 4\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := unknown.applyFlagDefaults("actions exec", flagSet); err == nil || !strings.Contains(err.Error(), "has no flag -parallelism") {
+		t.Errorf("unexpected error for unknown flag: %v", err)
+	}
+
+	if err := home.checkUntrusted(); err == nil {
+		t.Error("no error for endpoint in untrusted configuration")
+	}
+	if err := project.checkUntrusted(); err != nil {
+		t.Errorf("unexpected error for untrusted configuration: %v", err)
+	}
+	for _, name := range []string{"pre-task-hook", "post-step-hook", "post-task-hook", "o", "cache", "patch-dir", "artifacts-dir", "provenance-file", "metrics-file", "retry-file", "save-schema", "record", "secrets-file", "provenance-key", "get-curl"} {
+		untrusted, err := parseProjectConfig([]byte("commands:\n  actions exec:\n    " + name + ": x\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := untrusted.checkUntrusted(); err == nil || !strings.Contains(err.Error(), "-"+name+" of") {
+			t.Errorf("unexpected error for -%s in untrusted configuration: %v", name, err)
+		}
+	}
+
+	if _, err := parseProjectConfig([]byte("endpoints: https://sourcegraph.example.com\n")); err == nil {
+		t.Error("no error for unknown field")
+	}
+}
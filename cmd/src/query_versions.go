@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/sourcegraph/src-cli/internal/api"
+)
+
+// sinceVersionRegexp matches the comments that mark fields in GraphQL queries
+// that only exist since a Sourcegraph version, e.g. "# since 3.17.0". The
+// release date of the version can be given to support insiders builds, e.g.
+// "# since 3.17.0 2020-06-01".
+var sinceVersionRegexp = regexp.MustCompile(`#\s*since\s+(\S+)(?:\s+(\d{4}-\d{2}-\d{2}))?\s*$`)
+
+// queryForVersion returns query without the fields marked with a "# since"
+// comment that the given Sourcegraph version doesn't support. If a marked
+// line opens a selection set, the whole selection set is removed.
+//
+// Queries with marked fields are valid as they are, so they can be sent
+// unchanged to instances whose version is unknown.
+func queryForVersion(query, version string) (string, error) {
+	lines := strings.Split(query, "\n")
+	kept := make([]string, 0, len(lines))
+	for i := 0; i < len(lines); i++ {
+		m := sinceVersionRegexp.FindStringSubmatch(lines[i])
+		if m == nil {
+			kept = append(kept, lines[i])
+			continue
+		}
+
+		ok, err := sourcegraphVersionCheck(version, ">= "+m[1], m[2])
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			kept = append(kept, lines[i])
+			continue
+		}
+
+		// Skip the lines up to the end of the selection set opened on
+		// the marked line, if any.
+		depth := braceDepth(lines[i])
+		for depth > 0 && i+1 < len(lines) {
+			i++
+			depth += braceDepth(lines[i])
+		}
+	}
+	return strings.Join(kept, "\n"), nil
+}
+
+// braceDepth returns by how much line changes the nesting depth of selection
+// sets, ignoring comments.
+func braceDepth(line string) int {
+	if i := strings.Index(line, "#"); i >= 0 {
+		line = line[:i]
+	}
+	return strings.Count(line, "{") - strings.Count(line, "}")
+}
+
+// versionedQuery returns query for the version of the Sourcegraph instance
+// that client talks to. See queryForVersion.
+func versionedQuery(ctx context.Context, client api.Client, query string) (string, error) {
+	version, err := getSourcegraphVersion(ctx, client)
+	if err != nil {
+		return "", err
+	}
+	return queryForVersion(query, version)
+}
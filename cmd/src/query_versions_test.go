@@ -0,0 +1,125 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/vektah/gqlparser/v2"
+	gqlast "github.com/vektah/gqlparser/v2/ast"
+)
+
+func TestQueryForVersion(t *testing.T) {
+	query := `query Changesets {
+	changesets {
+		state
+		reviewState # since 3.14.0
+		head { # since 3.15.0 2020-04-01
+			target {
+				oid
+			}
+		}
+		url
+	}
+}`
+
+	for name, tc := range map[string]struct {
+		version string
+		want    string
+	}{
+		"supports all fields": {
+			version: "3.15.1",
+			want:    query,
+		},
+		"dev": {
+			version: "0.0.0+dev",
+			want:    query,
+		},
+		"supports some fields": {
+			version: "3.14.2",
+			want: `query Changesets {
+	changesets {
+		state
+		reviewState # since 3.14.0
+		url
+	}
+}`,
+		},
+		"old insiders build": {
+			version: "54959_2020-01-29_9258595",
+			want: `query Changesets {
+	changesets {
+		state
+		reviewState # since 3.14.0
+		url
+	}
+}`,
+		},
+		"supports no fields": {
+			version: "3.13.0",
+			want: `query Changesets {
+	changesets {
+		state
+		url
+	}
+}`,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			have, err := queryForVersion(query, tc.version)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, have); diff != "" {
+				t.Errorf("unexpected query (-want +have):\n%s", diff)
+			}
+		})
+	}
+}
+
+// TestVersionedQueriesAgainstOldSchemas validates the queries with "# since"
+// markers, as they are sent to older instances, against excerpts of the
+// schemas of those versions in testdata/schemas, so that fields that are
+// missing a marker are found.
+func TestVersionedQueriesAgainstOldSchemas(t *testing.T) {
+	paths, err := filepath.Glob("testdata/schemas/*.graphql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("no schemas found")
+	}
+
+	for _, path := range paths {
+		sdl, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		schema, gqlErr := gqlparser.LoadSchema(&gqlast.Source{Name: path, Input: string(sdl)})
+		if gqlErr != nil {
+			t.Fatal(gqlErr)
+		}
+		version := strings.TrimSuffix(filepath.Base(path), ".graphql") + ".0"
+
+		checked := 0
+
+		for name, query := range selfLintQueries() {
+			if !strings.Contains(query, "# since") {
+				continue
+			}
+			checked++
+			versioned, err := queryForVersion(query, version)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, errs := gqlparser.LoadQuery(schema, versioned); errs != nil {
+				t.Errorf("%s is invalid for Sourcegraph %s: %s", name, version, errs)
+			}
+		}
+		if checked == 0 {
+			t.Error("no queries with \"# since\" markers found")
+		}
+	}
+}
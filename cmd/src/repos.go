@@ -22,6 +22,8 @@ The commands are:
 	enable     enables repositories
 	disable    disables repositories
 	delete 	   deletes repositories
+	add        adds repositories to the explicit list of an external service
+	remove     removes repositories from the explicit list of an external service
 
 Use "src repos [command] -h" for more information about a command.
 `
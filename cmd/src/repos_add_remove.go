@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/jsonx"
+	"github.com/sourcegraph/src-cli/internal/api"
+)
+
+func init() {
+	initReposAddRemove("add", true, `
+Examples:
+
+  Add repositories to the explicit list of repositories of an external service:
+
+    	$ src repos add -extsvc 'My GitHub connection' my-org/repo my-org/repo2
+
+  The repositories are named as in the configuration of the external service, e.g. "owner/name" for GitHub,
+  "group/name" for GitLab, "PROJECT/name" for Bitbucket Server and the path relative to the URL for other
+  Git hosts. Only external services with an explicit list of repositories are supported: GitHub and Bitbucket
+  Server ("repos"), GitLab ("projects") and other Git hosts ("repos").
+
+`)
+
+	initReposAddRemove("remove", false, `
+Examples:
+
+  Remove repositories from the explicit list of repositories of an external service:
+
+    	$ src repos remove -extsvc 'My GitHub connection' my-org/repo my-org/repo2
+
+  Unlike 'src repos delete', this changes the configuration of the external service, so that the repositories
+  aren't synced again. See 'src repos add -h' for how the repositories are named.
+
+`)
+}
+
+func initReposAddRemove(cmdName string, add bool, usage string) {
+	flagSet := flag.NewFlagSet(cmdName, flag.ExitOnError)
+	usageFunc := func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'src repos %s':\n", flagSet.Name())
+		flagSet.PrintDefaults()
+		fmt.Println(usage)
+	}
+	var (
+		extsvcFlag   = flagSet.String("extsvc", "", "The exact name of the external service whose repositories to edit.")
+		extsvcIDFlag = flagSet.String("extsvc-id", "", "The ID of the external service whose repositories to edit, instead of -extsvc.")
+		apiFlags     = api.NewFlags(flagSet)
+	)
+
+	handler := func(args []string) error {
+		flagSet.Parse(args)
+
+		if (*extsvcFlag == "") == (*extsvcIDFlag == "") {
+			return &usageError{errors.New("exactly one of -extsvc and -extsvc-id must be given")}
+		}
+		if flagSet.NArg() == 0 {
+			return &usageError{errors.New("expected at least one repository")}
+		}
+
+		ctx := context.Background()
+		client := cfg.apiClient(apiFlags, flagSet.Output())
+
+		svc, changed, err := editExternalServiceRepos(ctx, client, *extsvcIDFlag, *extsvcFlag, flagSet.Args(), add)
+		if err != nil || svc == nil {
+			return err
+		}
+		verb := "added to"
+		if !add {
+			verb = "removed from"
+		}
+		if len(changed) == 0 {
+			fmt.Printf("No repositories %s external service %q, it is unchanged\n", verb, svc.DisplayName)
+			return nil
+		}
+		for _, name := range changed {
+			fmt.Printf("repository %s external service %q: %s\n", verb, svc.DisplayName, name)
+		}
+		return nil
+	}
+
+	// Register the command.
+	reposCommands = append(reposCommands, &command{
+		flagSet:   flagSet,
+		handler:   handler,
+		usageFunc: usageFunc,
+	})
+}
+
+// editExternalServiceReposAttempts is the number of times the configuration
+// of an external service is read and updated again if it was changed by
+// someone else in the meantime.
+const editExternalServiceReposAttempts = 3
+
+// editExternalServiceRepos adds or removes the repositories to or from the
+// explicit list of repositories in the configuration of the external service
+// with the given ID or name, and returns the service and the names of the
+// repositories that were added or removed. It returns a nil service if a
+// request wasn't made, e.g. with -get-curl.
+//
+// The API has no way to update the configuration conditionally, so it is read
+// again right before it is updated. This makes it unlikely, but not
+// impossible, to overwrite a change made in between.
+func editExternalServiceRepos(ctx context.Context, client api.Client, id, name string, repos []string, add bool) (*externalService, []string, error) {
+	for attempt := 0; attempt < editExternalServiceReposAttempts; attempt++ {
+		svc, err := lookupExternalService(ctx, client, id, name)
+		if err != nil || svc == nil {
+			return nil, nil, err
+		}
+		config, changed, err := editExplicitRepos(svc.Kind, svc.Config, repos, add)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "external service %q", svc.DisplayName)
+		}
+		if len(changed) == 0 {
+			return svc, nil, nil
+		}
+
+		current, err := lookupExternalService(ctx, client, svc.ID, "")
+		if err != nil || current == nil {
+			return nil, nil, err
+		}
+		if current.Config != svc.Config {
+			continue
+		}
+
+		var result struct{}
+		if ok, err := client.NewRequest(externalServicesUpdateMutation, map[string]interface{}{
+			"input": map[string]interface{}{"id": svc.ID, "config": config},
+		}).Do(ctx, &result); err != nil || !ok {
+			return nil, nil, err
+		}
+		return svc, changed, nil
+	}
+	return nil, nil, fmt.Errorf("the configuration of the external service kept changing, gave up after %d attempts", editExternalServiceReposAttempts)
+}
+
+// explicitRepoLists maps the kinds of external services that support an
+// explicit list of repositories to the property of the list, and whether its
+// entries are objects with a "name" rather than names.
+var explicitRepoLists = map[string]struct {
+	property string
+	objects  bool
+}{
+	"GITHUB":          {property: "repos"},
+	"BITBUCKETSERVER": {property: "repos"},
+	"OTHER":           {property: "repos"},
+	"GITLAB":          {property: "projects", objects: true},
+}
+
+// editExplicitRepos adds or removes the repositories to or from the explicit
+// list of repositories in the JSONC configuration of an external service of
+// the given kind. It returns the new configuration and the names of the
+// repositories that were added or removed, ignoring those that already were
+// or weren't listed. Comments outside of the list are kept.
+func editExplicitRepos(kind, config string, repos []string, add bool) (string, []string, error) {
+	list, ok := explicitRepoLists[strings.ToUpper(kind)]
+	if !ok {
+		return "", nil, fmt.Errorf("external services of kind %s don't support an explicit list of repositories", kind)
+	}
+
+	var root map[string]interface{}
+	if err := jsonxUnmarshal(config, &root); err != nil {
+		return "", nil, err
+	}
+	var entries []interface{}
+	if existing, ok := root[list.property]; ok {
+		if entries, ok = existing.([]interface{}); !ok {
+			return "", nil, fmt.Errorf("the configuration is invalid (%s is not an array)", list.property)
+		}
+	}
+
+	entryName := func(entry interface{}) string {
+		if !list.objects {
+			name, _ := entry.(string)
+			return name
+		}
+		obj, _ := entry.(map[string]interface{})
+		name, _ := obj["name"].(string)
+		return name
+	}
+
+	var changed []string
+	if add {
+		listed := map[string]bool{}
+		for _, entry := range entries {
+			listed[entryName(entry)] = true
+		}
+		for _, repo := range repos {
+			if repo = strings.TrimSpace(repo); repo == "" || listed[repo] {
+				continue
+			}
+			listed[repo] = true
+			changed = append(changed, repo)
+			if list.objects {
+				entries = append(entries, map[string]interface{}{"name": repo})
+			} else {
+				entries = append(entries, repo)
+			}
+		}
+	} else {
+		remove := map[string]bool{}
+		for _, repo := range repos {
+			remove[strings.TrimSpace(repo)] = true
+		}
+		kept := []interface{}{}
+		for _, entry := range entries {
+			if name := entryName(entry); remove[name] {
+				changed = append(changed, name)
+				continue
+			}
+			kept = append(kept, entry)
+		}
+		entries = kept
+	}
+	if len(changed) == 0 {
+		return config, nil, nil
+	}
+
+	edits, _, err := jsonx.ComputePropertyEdit(
+		config,
+		jsonx.PropertyPath(list.property),
+		entries,
+		nil,
+		jsonx.FormatOptions{InsertSpaces: true, TabSize: 2},
+	)
+	if err != nil {
+		return "", nil, err
+	}
+	updated, err := jsonx.ApplyEdits(config, edits...)
+	if err != nil {
+		return "", nil, err
+	}
+	return updated, changed, nil
+}
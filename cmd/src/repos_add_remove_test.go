@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"io/ioutil"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/sourcegraph/src-cli/internal/api"
+)
+
+func TestEditExplicitRepos(t *testing.T) {
+	for name, tc := range map[string]struct {
+		kind, config string
+		repos        []string
+		add          bool
+		wantChanged  []string
+		wantErr      bool
+	}{
+		"add to GitHub": {
+			kind:        "GITHUB",
+			config:      `{"token": "t", "repos": ["a/b"]}`,
+			repos:       []string{"a/b", "c/d", "c/d"},
+			add:         true,
+			wantChanged: []string{"c/d"},
+		},
+		"add without list": {
+			kind:        "OTHER",
+			config:      `{"url": "https://git.example.com"}`,
+			repos:       []string{"my/repo"},
+			add:         true,
+			wantChanged: []string{"my/repo"},
+		},
+		"remove from GitLab": {
+			kind:        "gitlab",
+			config:      `{"projects": [{"name": "g/a"}, {"id": 42}, {"name": "g/b"}]}`,
+			repos:       []string{"g/a", "g/c"},
+			wantChanged: []string{"g/a"},
+		},
+		"unchanged": {
+			kind:   "GITHUB",
+			config: `{"repos": ["a/b"]}`,
+			repos:  []string{"c/d"},
+		},
+		"unsupported kind": {
+			kind:    "GITOLITE",
+			config:  `{}`,
+			repos:   []string{"a"},
+			add:     true,
+			wantErr: true,
+		},
+		"invalid list": {
+			kind:    "GITHUB",
+			config:  `{"repos": "a/b"}`,
+			repos:   []string{"a"},
+			add:     true,
+			wantErr: true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			have, changed, err := editExplicitRepos(tc.kind, tc.config, tc.repos, tc.add)
+			if tc.wantErr != (err != nil) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.wantChanged, changed); diff != "" {
+				t.Errorf("unexpected changed repositories (-want +have):\n%s", diff)
+			}
+			if len(changed) == 0 && have != tc.config && !tc.wantErr {
+				t.Errorf("config changed although no repository was:\n%s", have)
+			}
+		})
+	}
+}
+
+func TestEditExternalServiceReposGetCurl(t *testing.T) {
+	flagSet := flag.NewFlagSet("add", flag.ContinueOnError)
+	apiFlags := api.NewFlags(flagSet)
+	if err := flagSet.Parse([]string{"-get-curl"}); err != nil {
+		t.Fatal(err)
+	}
+	client := api.NewClient(api.ClientOpts{Endpoint: "https://sourcegraph.example.com", Flags: apiFlags, Out: ioutil.Discard})
+
+	svc, changed, err := editExternalServiceRepos(context.Background(), client, "", "x", []string{"foo"}, true)
+	if err != nil || svc != nil || changed != nil {
+		t.Errorf("unexpected result: %v, %v, %v", svc, changed, err)
+	}
+}
@@ -49,6 +49,7 @@ Examples:
 		descendingFlag       = flagSet.Bool("descending", false, "Whether or not results should be in descending order.")
 		namesWithoutHostFlag = flagSet.Bool("names-without-host", false, "Whether or not repository names should be printed without the hostname (or other first path component). If set, -f is ignored.")
 		formatFlag           = flagSet.String("f", "{{.Name}}", `Format for the output, using the syntax of Go package text/template. (e.g. "{{.ID}}: {{.Name}}") or "{{.|json}}")`)
+		templateFileFlag     = flagSet.String("template-file", "", templateFileFlagUsage)
 		apiFlags             = api.NewFlags(flagSet)
 	)
 
@@ -57,7 +58,7 @@ Examples:
 
 		client := cfg.apiClient(apiFlags, flagSet.Output())
 
-		tmpl, err := parseTemplate(*formatFlag)
+		tmpl, err := parseTemplateOrFile(*formatFlag, *templateFileFlag)
 		if err != nil {
 			return err
 		}
@@ -17,6 +17,7 @@ import (
 
 	isatty "github.com/mattn/go-isatty"
 	"github.com/sourcegraph/src-cli/internal/api"
+	"github.com/sourcegraph/src-cli/internal/output"
 	"jaytaylor.com/html2text"
 )
 
@@ -34,6 +35,28 @@ Examples:
 
     	$ src search -json 'repogroup:sample error'
 
+  Perform a search and show 3 lines of context around each matched line:
+
+    	$ src search -context 3 'repogroup:sample error'
+
+  Perform a search and mark matches with [[ and ]], e.g. when the output is not colored:
+
+    	$ src search -highlight 'repogroup:sample error' | grep '\[\['
+
+  Run the queries in queries.txt, one per line, 8 at a time and report their result counts and durations as CSV,
+  e.g. to track search quality and performance across upgrades:
+
+    	$ src search -queries-file queries.txt -j 8 -report-format csv > report.csv
+
+  Run named queries, from a YAML file with a list of objects with a name and a query:
+
+    	$ cat queries.yaml
+    	- name: errors in Go
+    	  query: lang:go error
+    	- name: TODOs
+    	  query: TODO count:1000
+    	$ src search -queries-file queries.yaml
+
 Other tips:
 
   Make 'type:diff' searches have colored diffs by installing https://colordiff.org
@@ -50,10 +73,17 @@ Other tips:
 
 	flagSet := flag.NewFlagSet("search", flag.ExitOnError)
 	var (
-		jsonFlag        = flagSet.Bool("json", false, "Whether or not to output results as JSON")
-		explainJSONFlag = flagSet.Bool("explain-json", false, "Explain the JSON output schema and exit.")
-		apiFlags        = api.NewFlags(flagSet)
-		lessFlag        = flagSet.Bool("less", true, "Pipe output to 'less -R' (only if stdout is terminal, and not json flag)")
+		jsonFlag         = flagSet.Bool("json", false, "Whether or not to output results as JSON")
+		templateFileFlag = flagSet.String("template-file", "", templateFileFlagUsage+" The template is given the same data that -json prints; see -explain-json.")
+		explainJSONFlag  = flagSet.Bool("explain-json", false, "Explain the JSON output schema and exit.")
+		apiFlags         = api.NewFlags(flagSet)
+		lessFlag         = flagSet.Bool("less", true, "Pipe output to 'less -R' (only if stdout is terminal, and not json flag)")
+		contextFlag      = flagSet.Int("context", 0, "Number of lines of context to show around each matched line.")
+		highlightFlag    = flagSet.Bool("highlight", false, "Mark matches with "+searchHighlightStart+" and "+searchHighlightEnd+". With -json, each line match gets a highlightedPreview.")
+
+		queriesFileFlag  = flagSet.String("queries-file", "", "Run the queries in this file instead of a single query and print a report of their result counts and durations. The file contains one query per line, or, if it is a .yaml or .json file, a list of objects with a name and a query.")
+		parallelismFlag  = flagSet.Int("j", 4, "The number of queries of -queries-file to run in parallel.")
+		reportFormatFlag = flagSet.String("report-format", "json", `The format of the report of -queries-file: "json" or "csv".`)
 	)
 
 	handler := func(args []string) error {
@@ -64,6 +94,32 @@ Other tips:
 			return nil
 		}
 
+		if *queriesFileFlag != "" {
+			if flagSet.NArg() != 0 {
+				return &usageError{errors.New("-queries-file conflicts with a query argument")}
+			}
+			if *reportFormatFlag != "json" && *reportFormatFlag != "csv" {
+				return &usageError{fmt.Errorf("invalid -report-format %q: must be json or csv", *reportFormatFlag)}
+			}
+			if *parallelismFlag < 1 {
+				return &usageError{errors.New("-j must be at least 1")}
+			}
+			queries, err := readBatchSearchQueries(*queriesFileFlag)
+			if err != nil {
+				return &exitCodeError{error: err, exitCode: exitCodeValidation}
+			}
+
+			client := cfg.apiClient(apiFlags, flagSet.Output())
+			results := runBatchSearch(context.Background(), client, queries, *parallelismFlag)
+			if err := writeBatchSearchReport(os.Stdout, *reportFormatFlag, results); err != nil {
+				return err
+			}
+			if failed := batchSearchFailures(results); failed > 0 {
+				return &exitCodeError{error: fmt.Errorf("%d of %d queries failed", failed, len(results)), exitCode: exitCodePartialFailure}
+			}
+			return nil
+		}
+
 		if flagSet.NArg() != 1 {
 			return &usageError{errors.New("expected exactly one argument: the search query")}
 		}
@@ -76,10 +132,13 @@ Other tips:
 				return err
 			}
 
-			srcCmd := exec.Command(cmdPath, append([]string{"search"}, args...)...)
-
-			// Because we do not want the default "no color when piping" behavior to take place.
-			srcCmd.Env = envSetDefault(os.Environ(), "COLOR", "t")
+			// Because we do not want the default "no color when piping"
+			// behavior to take place, we pass on the color mode we decided on.
+			colorMode := output.ColorAlways
+			if colorDisabled {
+				colorMode = output.ColorNever
+			}
+			srcCmd := exec.Command(cmdPath, append([]string{"-color=" + colorMode, "search"}, args...)...)
 
 			srcStderr, err := srcCmd.StderrPipe()
 			if err != nil {
@@ -236,10 +295,15 @@ Other tips:
 			return err
 		}
 
+		if *contextFlag > 0 || *highlightFlag {
+			addSearchContext(result.Search.Results.Results, *contextFlag, *highlightFlag)
+		}
+
 		improved := searchResultsImproved{
 			SourcegraphEndpoint: cfg.Endpoint,
 			Query:               queryString,
 			Site:                result.Site,
+			HighlightMarkers:    *highlightFlag,
 			searchResults:       result.Search.Results,
 		}
 
@@ -253,7 +317,7 @@ Other tips:
 			return nil
 		}
 
-		tmpl, err := parseTemplate(searchResultsTemplate)
+		tmpl, err := parseTemplateOrFile(searchResultsTemplate, *templateFileFlag)
 		if err != nil {
 			return err
 		}
@@ -289,21 +353,94 @@ type searchResultsImproved struct {
 	SourcegraphEndpoint string
 	Query               string
 	Site                struct{ BuildVersion string }
+	HighlightMarkers    bool `json:"-"`
 	searchResults
 }
 
-func envSetDefault(env []string, key, value string) []string {
-	set := false
-	for _, kv := range env {
-		if strings.HasPrefix(kv, key+"=") {
-			set = true
-			break
+// The markers put around matches when highlight markers are enabled.
+const (
+	searchHighlightStart = "[["
+	searchHighlightEnd   = "]]"
+)
+
+// addSearchContext adds the lines surrounding each line match of the file
+// matches in results as "contextBefore" and "contextAfter", taken from the
+// file content. No line is listed twice: a context line between two close line
+// matches belongs to the first one. If markers is true, the preview of each
+// line match with highlight markers around the matches is added as
+// "highlightedPreview".
+func addSearchContext(results []map[string]interface{}, contextLines int, markers bool) {
+	for _, r := range results {
+		if r["__typename"] != "FileMatch" {
+			continue
 		}
+
+		var lines []string
+		if file, ok := r["file"].(map[string]interface{}); ok {
+			if content, ok := file["content"].(string); ok {
+				lines = strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+			}
+		}
+
+		lineMatches, _ := r["lineMatches"].([]interface{})
+		shown := -1 // the last line shown so far
+		for i, lm := range lineMatches {
+			m := lm.(map[string]interface{})
+			if markers {
+				highlighted := applyHighlights(m["preview"].(string), convertMatchToHighlights(m, true), searchHighlightStart, searchHighlightEnd)
+				m["highlightedPreview"] = strings.TrimSuffix(highlighted, "\n")
+			}
+			if contextLines <= 0 || lines == nil {
+				continue
+			}
+
+			line := int(m["lineNumber"].(float64))
+			next := len(lines)
+			if i+1 < len(lineMatches) {
+				next = int(lineMatches[i+1].(map[string]interface{})["lineNumber"].(float64))
+			}
+
+			from := line - contextLines
+			if from <= shown {
+				from = shown + 1
+			}
+			to := line + contextLines + 1
+			if to > next {
+				to = next
+			}
+			m["contextBefore"] = searchContextLines(lines, from, line)
+			m["contextAfter"] = searchContextLines(lines, line+1, to)
+			if shown = to - 1; shown < line {
+				shown = line
+			}
+		}
+	}
+}
+
+// searchContextLines returns the lines [from, to) in the same shape as line
+// matches, with 0-indexed line numbers.
+func searchContextLines(lines []string, from, to int) []interface{} {
+	if from < 0 {
+		from = 0
+	}
+	if to > len(lines) {
+		to = len(lines)
 	}
-	if !set {
-		env = append(env, key+"="+value)
+	context := []interface{}{}
+	for n := from; n < to; n++ {
+		context = append(context, map[string]interface{}{
+			"lineNumber": float64(n),
+			"preview":    lines[n],
+		})
 	}
-	return env
+	return context
+}
+
+// searchContext returns the context lines stored under key in a line match,
+// if any.
+func searchContext(match map[string]interface{}, key string) []interface{} {
+	context, _ := match[key].([]interface{})
+	return context
 }
 
 func searchHighlightPreview(preview interface{}, start, end string) string {
@@ -420,10 +557,8 @@ type highlight struct {
 // relative to the whole file, and can add lines of context around the
 // highlighted range. It makes no assumptions about the preview field in
 // LineMatches (the preview field is not used).
-func applyHighlightsForFile(fileContent string, highlights []highlight) string {
+func applyHighlightsForFile(fileContent string, highlights []highlight, start, end string) string {
 	var result []rune
-	start := ansiColors["search-match"]
-	end := ansiColors["nc"]
 	lines := strings.Split(fileContent, "\n")
 	for _, highlight := range highlights {
 		line := lines[highlight.line]
@@ -489,21 +624,29 @@ var searchTemplateFuncs = map[string]interface{}{
 		if prevIndex < 0 {
 			return true
 		}
-		prevLineNumber := lineMatches[prevIndex].(map[string]interface{})["lineNumber"]
-		lineNumber := lineMatches[index].(map[string]interface{})["lineNumber"]
-		return prevLineNumber.(float64) == lineNumber.(float64)-1
+		// Take context lines into account, so that consecutive lines are
+		// not separated.
+		prev := lineMatches[prevIndex].(map[string]interface{})
+		cur := lineMatches[index].(map[string]interface{})
+		prevLineNumber := prev["lineNumber"].(float64) + float64(len(searchContext(prev, "contextAfter")))
+		lineNumber := cur["lineNumber"].(float64) - float64(len(searchContext(cur, "contextBefore")))
+		return prevLineNumber == lineNumber-1
 	},
-	"searchHighlightMatch": func(content, query, match interface{}) string {
+	"searchHighlightMatch": func(content, query, match interface{}, markers ...bool) string {
 		m := match.(map[string]interface{})
 		q := query.(string)
+		start, end := ansiColors["search-match"], ansiColors["nc"]
+		if len(markers) > 0 && markers[0] {
+			start, end = start+searchHighlightStart, searchHighlightEnd+end
+		}
 		var highlights []highlight
 		if strings.Contains(q, "patterntype:structural") {
 			highlights = convertMatchToHighlights(m, false)
-			return applyHighlightsForFile(content.(string), highlights)
+			return applyHighlightsForFile(content.(string), highlights, start, end)
 		} else {
 			preview := m["preview"].(string)
 			highlights = convertMatchToHighlights(m, true)
-			return applyHighlights(preview, highlights, ansiColors["search-match"], ansiColors["nc"])
+			return applyHighlights(preview, highlights, start, end)
 		}
 	},
 	"searchHighlightPreview": func(preview interface{}) string {
@@ -551,7 +694,7 @@ var searchTemplateFuncs = map[string]interface{}{
 const searchResultsTemplate = `{{- /* ignore this line for template formatting sake */ -}}
 
 {{- /* The first results line */ -}}
-	{{- color "logo" -}}✱{{- color "nc" -}}
+	{{- color "logo" -}}{{emoji "✱"}}{{- color "nc" -}}
 	{{- " " -}}
 	{{- if eq .ResultCount 0 -}}
 		{{- color "warning" -}}
@@ -588,7 +731,7 @@ const searchResultsTemplate = `{{- /* ignore this line for template formatting s
 
 			{{- /* Repository and file name */ -}}
 			{{- color "search-repository"}}{{.repository.name}}{{color "nc" -}}
-			{{- " › " -}}
+			{{- " " -}}{{- emoji "›" -}}{{- " " -}}
 			{{- color "search-filename"}}{{.file.name}}{{color "nc" -}}
 			{{- color "success"}}{{" ("}}{{len .lineMatches}}{{" matches)"}}{{color "nc" -}}
 			{{- "\n" -}}
@@ -601,8 +744,16 @@ const searchResultsTemplate = `{{- /* ignore this line for template formatting s
 				{{- if not (searchSequentialLineNumber $lineMatches $index) -}}
 					{{- color "search-border"}}{{"  ------------------------------------------------------------------------------\n"}}{{color "nc"}}
 				{{- end -}}
+				{{- range $match.contextBefore -}}
+					{{- "  "}}{{color "search-line-numbers"}}{{pad (addFloat .lineNumber 1) 6 " "}}{{color "nc" -}}
+					{{- color "search-border"}}{{" |  "}}{{color "nc"}}{{.preview}}{{"\n"}}
+				{{- end -}}
 				{{- "  "}}{{color "search-line-numbers"}}{{pad (addFloat $match.lineNumber 1) 6 " "}}{{color "nc" -}}
-				{{- color "search-border"}}{{" |  "}}{{color "nc"}}{{searchHighlightMatch $content $.Query $match}}
+				{{- color "search-border"}}{{" |  "}}{{color "nc"}}{{searchHighlightMatch $content $.Query $match $.HighlightMarkers}}
+				{{- range $match.contextAfter -}}
+					{{- "  "}}{{color "search-line-numbers"}}{{pad (addFloat .lineNumber 1) 6 " "}}{{color "nc" -}}
+					{{- color "search-border"}}{{" |  "}}{{color "nc"}}{{.preview}}{{"\n"}}
+				{{- end -}}
 			{{- end -}}
 		{{- end -}}
 
@@ -634,7 +785,7 @@ const searchResultsTemplate = `{{- /* ignore this line for template formatting s
 
 			{{- /* Repository > author name "commit subject" (time ago) */ -}}
 			{{- color "search-repository"}}{{.commit.repository.name}}{{color "nc" -}}
-			{{- " › " -}}
+			{{- " " -}}{{- emoji "›" -}}{{- " " -}}
 			{{- color "search-commit-author"}}{{.commit.author.person.displayName}}{{color "nc" -}}
 			{{- " " -}}
 			{{- color "search-commit-subject"}}"{{.commit.subject}}"{{color "nc" -}}
@@ -690,6 +841,14 @@ At a high-level there are three result types:
 All three of these result types have different fields available. They can be
 differentiated by using the '__typename' field.
 
+With '-context N', each line match of a 'FileMatch' has the fields
+'contextBefore' and 'contextAfter': lists of up to N lines, each with a
+'lineNumber' and a 'preview'. Lines are never listed twice, so the context of
+line matches that are close to each other can be shorter than N lines.
+
+With '-highlight', each line match of a 'FileMatch' has a 'highlightedPreview'
+field: the 'preview' with [[ and ]] around the matches.
+
 The link below shows the GraphQL query that this program internally
 executes when querying for search results. On this page, you can hover over
 any field in the GraphQL panel on the left to get documentation about the field
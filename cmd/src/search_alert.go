@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"strings"
 	"text/template"
 
@@ -41,6 +42,23 @@ func (alert *searchResultsAlert) Render() (string, error) {
 	return b.String(), nil
 }
 
+// searchPartialResults returns why the results of a search are incomplete, if
+// they are: because the result limit was hit, or because some repositories
+// were still cloning or timed out.
+func searchPartialResults(limitHit bool, cloning, timedout []string) []string {
+	var reasons []string
+	if limitHit {
+		reasons = append(reasons, "the result limit was hit")
+	}
+	if len(cloning) > 0 {
+		reasons = append(reasons, fmt.Sprintf("%d repositories are still cloning: %s", len(cloning), strings.Join(cloning, ", ")))
+	}
+	if len(timedout) > 0 {
+		reasons = append(reasons, fmt.Sprintf("the search timed out in %d repositories: %s", len(timedout), strings.Join(timedout, ", ")))
+	}
+	return reasons
+}
+
 // searchResultsAlertFragment provides a GraphQL fragment that can be used to
 // hydrate a searchResultsAlert instance.
 const searchResultsAlertFragment = `
@@ -58,7 +76,7 @@ const searchResultsAlertFragment = `
 
 const searchResultsAlertTemplateContent = `
 	{{- if gt (len .Title) 0 -}}
-		{{- color "search-alert-title"}}❗{{.Title}}{{color "nc"}}{{"\n"}}
+		{{- color "search-alert-title"}}{{emoji "❗"}}{{.Title}}{{color "nc"}}{{"\n"}}
 	{{- end -}}
 
 	{{- if gt (len .Description) 0 -}}
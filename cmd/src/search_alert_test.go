@@ -116,3 +116,36 @@ func subColorCodes(in string) string {
 		return esc
 	})
 }
+
+func TestSearchPartialResults(t *testing.T) {
+	tests := map[string]struct {
+		limitHit          bool
+		cloning, timedout []string
+		want              []string
+	}{
+		"complete": {
+			want: nil,
+		},
+		"limit hit": {
+			limitHit: true,
+			want:     []string{"the result limit was hit"},
+		},
+		"cloning and timed out": {
+			cloning:  []string{"github.com/a/a"},
+			timedout: []string{"github.com/b/b", "github.com/c/c"},
+			want: []string{
+				"1 repositories are still cloning: github.com/a/a",
+				"the search timed out in 2 repositories: github.com/b/b, github.com/c/c",
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			have := searchPartialResults(tc.limitHit, tc.cloning, tc.timedout)
+			if diff := cmp.Diff(tc.want, have); diff != "" {
+				t.Errorf("unexpected reasons (-want +have):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/neelance/parallel"
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/src-cli/internal/api"
+)
+
+// batchSearchQuery is a query run by 'src search -queries-file'.
+type batchSearchQuery struct {
+	Name  string `json:"name"`
+	Query string `json:"query"`
+}
+
+// readBatchSearchQueries reads the queries of a -queries-file. A .yaml, .yml
+// or .json file contains a list of objects with a name and a query, any other
+// file one query per line. In the latter, empty lines and lines starting with
+// # are ignored, and each query is named after itself.
+func readBatchSearchQueries(path string) ([]batchSearchQuery, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var queries []batchSearchQuery
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml", ".json":
+		if err := yaml.Unmarshal(data, &queries); err != nil {
+			return nil, errors.Wrapf(err, "parsing %s", path)
+		}
+		for i, q := range queries {
+			if strings.TrimSpace(q.Query) == "" {
+				return nil, fmt.Errorf("%s: query %d has no query", path, i+1)
+			}
+			if q.Name == "" {
+				queries[i].Name = q.Query
+			}
+		}
+	default:
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			queries = append(queries, batchSearchQuery{Name: line, Query: line})
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, errors.Wrapf(err, "reading %s", path)
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, q := range queries {
+		if seen[q.Name] {
+			return nil, fmt.Errorf("%s: the name %q is used by more than one query", path, q.Name)
+		}
+		seen[q.Name] = true
+	}
+	if len(queries) == 0 {
+		return nil, fmt.Errorf("%s contains no queries", path)
+	}
+	return queries, nil
+}
+
+// batchSearchResult is the entry of a query in the report of 'src search
+// -queries-file'.
+type batchSearchResult struct {
+	Name        string `json:"name"`
+	Query       string `json:"query"`
+	ResultCount int    `json:"resultCount"`
+	LimitHit    bool   `json:"limitHit"`
+	// Timedout is the number of repositories the search timed out in.
+	Timedout int `json:"timedout"`
+	// ElapsedMilliseconds is the duration of the search reported by the
+	// instance, DurationMilliseconds the duration of the request.
+	ElapsedMilliseconds  int    `json:"elapsedMilliseconds"`
+	DurationMilliseconds int64  `json:"durationMilliseconds"`
+	Error                string `json:"error,omitempty"`
+}
+
+const batchSearchGraphQLQuery = `query BatchSearch($query: String!) {
+  search(query: $query) {
+    results {
+      resultCount
+      limitHit
+      timedout {
+        name
+      }
+      elapsedMilliseconds
+    }
+  }
+}`
+
+// runBatchSearch runs the queries, at most parallelism at a time, and returns
+// their results in the same order. Failed queries are reported in the results,
+// not as an error.
+func runBatchSearch(ctx context.Context, client api.Client, queries []batchSearchQuery, parallelism int) []batchSearchResult {
+	results := make([]batchSearchResult, len(queries))
+	run := parallel.NewRun(parallelism)
+	for i, q := range queries {
+		run.Acquire()
+		go func(i int, q batchSearchQuery) {
+			defer run.Release()
+
+			var result struct {
+				Search struct {
+					Results struct {
+						ResultCount         int
+						LimitHit            bool
+						Timedout            []struct{ Name string }
+						ElapsedMilliseconds int
+					}
+				}
+			}
+			start := time.Now()
+			ok, err := client.NewRequest(batchSearchGraphQLQuery, map[string]interface{}{
+				"query": api.NullString(q.Query),
+			}).Do(ctx, &result)
+			r := batchSearchResult{
+				Name:                 q.Name,
+				Query:                q.Query,
+				DurationMilliseconds: time.Since(start).Milliseconds(),
+			}
+			switch {
+			case err != nil:
+				r.Error = err.Error()
+			case !ok:
+				r.Error = "no results"
+			default:
+				res := result.Search.Results
+				r.ResultCount = res.ResultCount
+				r.LimitHit = res.LimitHit
+				r.Timedout = len(res.Timedout)
+				r.ElapsedMilliseconds = res.ElapsedMilliseconds
+			}
+			results[i] = r
+		}(i, q)
+	}
+	// Failures are recorded in the results, not with run.Error.
+	_ = run.Wait()
+	return results
+}
+
+// batchSearchFailures returns the number of failed queries.
+func batchSearchFailures(results []batchSearchResult) int {
+	failed := 0
+	for _, r := range results {
+		if r.Error != "" {
+			failed++
+		}
+	}
+	return failed
+}
+
+// writeBatchSearchReport writes the results as a JSON array or as CSV with a
+// header row.
+func writeBatchSearchReport(w io.Writer, format string, results []batchSearchResult) error {
+	switch format {
+	case "json":
+		data, err := marshalIndent(results)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"name", "query", "resultCount", "limitHit", "timedout", "elapsedMilliseconds", "durationMilliseconds", "error"})
+		for _, r := range results {
+			cw.Write([]string{
+				r.Name,
+				r.Query,
+				strconv.Itoa(r.ResultCount),
+				strconv.FormatBool(r.LimitHit),
+				strconv.Itoa(r.Timedout),
+				strconv.Itoa(r.ElapsedMilliseconds),
+				strconv.FormatInt(r.DurationMilliseconds, 10),
+				r.Error,
+			})
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+	return fmt.Errorf("invalid report format %q: must be json or csv", format)
+}
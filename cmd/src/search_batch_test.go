@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestReadBatchSearchQueries(t *testing.T) {
+	dir, err := ioutil.TempDir("", "search-batch-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	for name, tc := range map[string]struct {
+		file    string
+		content string
+		want    []batchSearchQuery
+		wantErr bool
+	}{
+		"lines": {
+			file:    "queries.txt",
+			content: "# Quality\nlang:go error\n\n  TODO count:1000  \n",
+			want: []batchSearchQuery{
+				{Name: "lang:go error", Query: "lang:go error"},
+				{Name: "TODO count:1000", Query: "TODO count:1000"},
+			},
+		},
+		"yaml": {
+			file:    "queries.yaml",
+			content: "- name: errors\n  query: lang:go error\n- query: TODO\n",
+			want: []batchSearchQuery{
+				{Name: "errors", Query: "lang:go error"},
+				{Name: "TODO", Query: "TODO"},
+			},
+		},
+		"json": {
+			file:    "queries.json",
+			content: `[{"name": "errors", "query": "lang:go error"}]`,
+			want:    []batchSearchQuery{{Name: "errors", Query: "lang:go error"}},
+		},
+		"empty":           {file: "empty.txt", content: "# nothing\n", wantErr: true},
+		"missing query":   {file: "missing.yaml", content: "- name: errors\n", wantErr: true},
+		"duplicate names": {file: "duplicates.txt", content: "a\na\n", wantErr: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, tc.file)
+			if err := ioutil.WriteFile(path, []byte(tc.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			have, err := readBatchSearchQueries(path)
+			if tc.wantErr != (err != nil) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, have); diff != "" {
+				t.Errorf("unexpected queries (-want +have):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestWriteBatchSearchReportCSV(t *testing.T) {
+	var buf bytes.Buffer
+	err := writeBatchSearchReport(&buf, "csv", []batchSearchResult{
+		{Name: "errors", Query: `lang:go "error"`, ResultCount: 30, LimitHit: true, ElapsedMilliseconds: 120, DurationMilliseconds: 150},
+		{Name: "broken", Query: "(", DurationMilliseconds: 10, Error: "invalid query"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `name,query,resultCount,limitHit,timedout,elapsedMilliseconds,durationMilliseconds,error
+errors,"lang:go ""error""",30,true,0,120,150,
+broken,(,0,false,0,0,10,invalid query
+`
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("unexpected report (-want +have):\n%s", diff)
+	}
+}
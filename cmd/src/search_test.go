@@ -10,6 +10,8 @@ import (
 	"regexp"
 	"strings"
 	"testing"
+
+	"github.com/google/go-cmp/cmp"
 )
 
 var _ = func() bool {
@@ -131,3 +133,97 @@ func TestBuildVersionHasNewSearchInterface(t *testing.T) {
 		t.Errorf("Build version is after the new generic search interface was merged. Expected true, but got false.")
 	}
 }
+
+func TestAddSearchContext(t *testing.T) {
+	// Both line matches match "foo" at offset 2.
+	lineMatch := func(line int, preview string) map[string]interface{} {
+		return map[string]interface{}{
+			"lineNumber":       float64(line),
+			"preview":          preview,
+			"offsetAndLengths": []interface{}{[]interface{}{float64(2), float64(3)}},
+		}
+	}
+	contextLine := func(line int, preview string) interface{} {
+		return map[string]interface{}{"lineNumber": float64(line), "preview": preview}
+	}
+
+	content := "a\nb\nc foo\nd\ne\nf foo\ng\n"
+	tests := map[string]struct {
+		contextLines int
+		markers      bool
+		want         []interface{}
+	}{
+		"context": {
+			contextLines: 1,
+			want: []interface{}{
+				map[string]interface{}{
+					"lineNumber":       float64(2),
+					"preview":          "c foo",
+					"offsetAndLengths": []interface{}{[]interface{}{float64(2), float64(3)}},
+					"contextBefore":    []interface{}{contextLine(1, "b")},
+					"contextAfter":     []interface{}{contextLine(3, "d")},
+				},
+				map[string]interface{}{
+					"lineNumber":       float64(5),
+					"preview":          "f foo",
+					"offsetAndLengths": []interface{}{[]interface{}{float64(2), float64(3)}},
+					"contextBefore":    []interface{}{contextLine(4, "e")},
+					"contextAfter":     []interface{}{contextLine(6, "g")},
+				},
+			},
+		},
+		"overlapping context": {
+			contextLines: 3,
+			want: []interface{}{
+				map[string]interface{}{
+					"lineNumber":       float64(2),
+					"preview":          "c foo",
+					"offsetAndLengths": []interface{}{[]interface{}{float64(2), float64(3)}},
+					"contextBefore":    []interface{}{contextLine(0, "a"), contextLine(1, "b")},
+					"contextAfter":     []interface{}{contextLine(3, "d"), contextLine(4, "e")},
+				},
+				map[string]interface{}{
+					"lineNumber":       float64(5),
+					"preview":          "f foo",
+					"offsetAndLengths": []interface{}{[]interface{}{float64(2), float64(3)}},
+					"contextBefore":    []interface{}{},
+					"contextAfter":     []interface{}{contextLine(6, "g")},
+				},
+			},
+		},
+		"markers": {
+			markers: true,
+			want: []interface{}{
+				map[string]interface{}{
+					"lineNumber":         float64(2),
+					"preview":            "c foo",
+					"offsetAndLengths":   []interface{}{[]interface{}{float64(2), float64(3)}},
+					"highlightedPreview": "c [[foo]]",
+				},
+				map[string]interface{}{
+					"lineNumber":         float64(5),
+					"preview":            "f foo",
+					"offsetAndLengths":   []interface{}{[]interface{}{float64(2), float64(3)}},
+					"highlightedPreview": "f [[foo]]",
+				},
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			results := []map[string]interface{}{{
+				"__typename": "FileMatch",
+				"file":       map[string]interface{}{"content": content},
+				"lineMatches": []interface{}{
+					lineMatch(2, "c foo"),
+					lineMatch(5, "f foo"),
+				},
+			}}
+			addSearchContext(results, tc.contextLines, tc.markers)
+			if diff := cmp.Diff(tc.want, results[0]["lineMatches"]); diff != "" {
+				t.Errorf("unexpected line matches (-want +have):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	humanize "github.com/dustin/go-humanize"
+	"github.com/sourcegraph/src-cli/internal/api"
+	"github.com/sourcegraph/src-cli/internal/campaigns"
+)
+
+// commandStats collects the timings and API usage of a command for the global
+// -stats flag.
+type commandStats struct {
+	start time.Time
+
+	mu            sync.Mutex
+	apiRequests   int
+	apiErrors     int
+	apiDuration   time.Duration
+	requestBytes  int64
+	responseBytes int64
+	metrics       []*campaigns.Metrics
+}
+
+// stats is set if -stats is given.
+var stats *commandStats
+
+// startCommandStats records the API requests made by the command and prints
+// the statistics to standard error when src exits.
+func startCommandStats() {
+	stats = &commandStats{start: time.Now()}
+	apiRequestObservers = append(apiRequestObservers, stats.observeAPIRequest)
+	atExit(func(int) {
+		stats.writeTo(os.Stderr, time.Since(stats.start))
+	})
+}
+
+func (s *commandStats) observeAPIRequest(e api.RequestEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.apiRequests++
+	if e.Err != nil {
+		s.apiErrors++
+	}
+	s.apiDuration += e.Duration
+	s.requestBytes += e.RequestBytes
+	s.responseBytes += e.ResponseBytes
+}
+
+// metricsForExecution returns the metrics an action execution should collect
+// for the statistics: metrics, if it is set, or new ones. It returns nil if
+// -stats is not given.
+func (s *commandStats) metricsForExecution(metrics *campaigns.Metrics) *campaigns.Metrics {
+	if s == nil {
+		return metrics
+	}
+	if metrics == nil {
+		metrics = campaigns.NewMetrics()
+	}
+	s.mu.Lock()
+	s.metrics = append(s.metrics, metrics)
+	s.mu.Unlock()
+	return metrics
+}
+
+// writeTo writes the statistics as a table. Time spent in steps and git is
+// summed over all repositories and can exceed the wall time when they are
+// executed in parallel.
+func (s *commandStats) writeTo(w io.Writer, wall time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw)
+	fmt.Fprintf(tw, "Wall time:\t%s\n", wall.Round(time.Millisecond))
+	fmt.Fprintf(tw, "API requests:\t%d (%d failed)\n", s.apiRequests, s.apiErrors)
+	fmt.Fprintf(tw, "API time:\t%s\n", s.apiDuration.Round(time.Millisecond))
+	fmt.Fprintf(tw, "API bytes sent:\t%s\n", humanize.IBytes(uint64(s.requestBytes)))
+	fmt.Fprintf(tw, "API bytes received:\t%s\n", humanize.IBytes(uint64(s.responseBytes)))
+
+	if len(s.metrics) > 0 {
+		steps := map[string]time.Duration{}
+		var git time.Duration
+		var archiveBytes int64
+		for _, m := range s.metrics {
+			summary := m.Summary()
+			for t, d := range summary.StepDurations {
+				steps[t] += d
+			}
+			git += summary.GitDuration
+			archiveBytes += summary.ArchiveBytes
+		}
+		types := make([]string, 0, len(steps))
+		for t := range steps {
+			types = append(types, t)
+		}
+		sort.Strings(types)
+		for _, t := range types {
+			fmt.Fprintf(tw, "Time in %s steps:\t%s\n", t, steps[t].Round(time.Millisecond))
+		}
+		fmt.Fprintf(tw, "Time in git:\t%s\n", git.Round(time.Millisecond))
+		fmt.Fprintf(tw, "Archive bytes downloaded:\t%s\n", humanize.IBytes(uint64(archiveBytes)))
+	}
+	tw.Flush()
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sourcegraph/src-cli/internal/api"
+	"github.com/sourcegraph/src-cli/internal/campaigns"
+)
+
+func TestCommandStats(t *testing.T) {
+	var noStats *commandStats
+	if m := noStats.metricsForExecution(nil); m != nil {
+		t.Errorf("unexpected metrics without -stats: %v", m)
+	}
+
+	s := &commandStats{}
+	s.observeAPIRequest(api.RequestEvent{Duration: 200 * time.Millisecond, RequestBytes: 1024, ResponseBytes: 4096})
+	s.observeAPIRequest(api.RequestEvent{Duration: 300 * time.Millisecond, RequestBytes: 1024, Err: errors.New("boom")})
+
+	metrics := s.metricsForExecution(nil)
+	metrics.ObserveStep("docker", 3*time.Second)
+	metrics.ObserveStep("docker", 2*time.Second)
+	metrics.ObserveStep("command", time.Second)
+	metrics.ObserveGit(1500 * time.Millisecond)
+	metrics.AddArchiveBytes(2 * 1024 * 1024)
+	if other := campaigns.NewMetrics(); s.metricsForExecution(other) != other {
+		t.Error("metricsForExecution didn't return the given metrics")
+	}
+
+	var buf bytes.Buffer
+	s.writeTo(&buf, 4*time.Second)
+	want := `
+Wall time:                 4s
+API requests:              2 (1 failed)
+API time:                  500ms
+API bytes sent:            2.0 KiB
+API bytes received:        4.0 KiB
+Time in command steps:     1s
+Time in docker steps:      5s
+Time in git:               1.5s
+Archive bytes downloaded:  2.0 MiB
+`
+	if have := buf.String(); have != want {
+		t.Errorf("unexpected output:\nhave:\n%s\nwant:\n%s", have, want)
+	}
+}
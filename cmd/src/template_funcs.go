@@ -0,0 +1,91 @@
+package main
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"github.com/Masterminds/semver"
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+)
+
+// stringTemplateFuncs are the template functions for working with strings and
+// structured data in output templates. They aren't available in action
+// definitions, which only support the ${{ vars.NAME }} placeholders of
+// campaigns.ExpandVars. Like the standard functions, they take
+// the value they operate on as the last argument, so that they can be used in
+// pipelines, e.g. {{.Name | trimPrefix "github.com/" | upper}}.
+var stringTemplateFuncs = map[string]interface{}{
+	"trim":       strings.TrimSpace,
+	"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+	"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+	"lower":      strings.ToLower,
+	"upper":      strings.ToUpper,
+	"replace":    func(old, new, s string) string { return strings.Replace(s, old, new, -1) },
+	"split":      func(sep, s string) []string { return strings.Split(s, sep) },
+	"contains":   func(substr, s string) bool { return strings.Contains(s, substr) },
+	"hasPrefix":  func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+	"hasSuffix":  func(suffix, s string) bool { return strings.HasSuffix(s, suffix) },
+
+	"regexMatch": func(pattern, s string) (bool, error) {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return false, err
+		}
+		return re.MatchString(s), nil
+	},
+	"regexFind": func(pattern, s string) (string, error) {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return "", err
+		}
+		return re.FindString(s), nil
+	},
+	"regexReplace": func(pattern, repl, s string) (string, error) {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return "", err
+		}
+		return re.ReplaceAllString(s, repl), nil
+	},
+
+	"semverCompare": func(constraint, version string) (bool, error) {
+		c, err := semver.NewConstraint(constraint)
+		if err != nil {
+			return false, errors.Wrapf(err, "invalid semver constraint %q", constraint)
+		}
+		v, err := semver.NewVersion(version)
+		if err != nil {
+			return false, errors.Wrapf(err, "invalid semver version %q", version)
+		}
+		return c.Check(v), nil
+	},
+
+	"fromJSON": func(s string) (interface{}, error) {
+		var v interface{}
+		err := json.Unmarshal([]byte(s), &v)
+		return v, err
+	},
+	"fromYAML": func(s string) (interface{}, error) {
+		data, err := yaml.YAMLToJSON([]byte(s))
+		if err != nil {
+			return nil, err
+		}
+		var v interface{}
+		err = json.Unmarshal(data, &v)
+		return v, err
+	},
+
+	"sha1sum": func(s string) string {
+		sum := sha1.Sum([]byte(s))
+		return hex.EncodeToString(sum[:])
+	},
+	"sha256sum": func(s string) string {
+		sum := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(sum[:])
+	},
+}
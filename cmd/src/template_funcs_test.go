@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestStringTemplateFuncs(t *testing.T) {
+	tests := map[string]struct {
+		template string
+		data     interface{}
+		want     string
+		wantErr  bool
+	}{
+		"trim pipeline": {
+			template: `{{.Name | trimPrefix "github.com/" | upper}}`,
+			data:     map[string]string{"Name": "github.com/sourcegraph/src-cli"},
+			want:     "SOURCEGRAPH/SRC-CLI",
+		},
+		"split": {
+			template: `{{index (split "/" .) 1}}`,
+			data:     "github.com/sourcegraph/src-cli",
+			want:     "sourcegraph",
+		},
+		"regexMatch": {
+			template: `{{if regexMatch "^github\\.com/" .}}yes{{else}}no{{end}}`,
+			data:     "gitlab.com/foo",
+			want:     "no",
+		},
+		"regexReplace": {
+			template: `{{regexReplace "^github\\.com/([^/]+)/.*" "$1" .}}`,
+			data:     "github.com/sourcegraph/src-cli",
+			want:     "sourcegraph",
+		},
+		"invalid regex": {
+			template: `{{regexMatch "(" .}}`,
+			data:     "x",
+			wantErr:  true,
+		},
+		"semverCompare": {
+			template: `{{semverCompare ">= 3.15" "3.16.1"}} {{semverCompare ">= 3.15" "3.14.0"}}`,
+			want:     "true false",
+		},
+		"fromJSON": {
+			template: `{{(fromJSON .).name}}`,
+			data:     `{"name": "src-cli"}`,
+			want:     "src-cli",
+		},
+		"fromYAML": {
+			template: `{{index (fromYAML .).tags 1}}`,
+			data:     "tags:\n- a\n- b\n",
+			want:     "b",
+		},
+		"sha256sum": {
+			template: `{{sha256sum "abc"}}`,
+			want:     "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			tmpl, err := parseTemplate(tc.template)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			err = tmpl.Execute(&buf, tc.data)
+			if tc.wantErr != (err != nil) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if have := buf.String(); !tc.wantErr && have != tc.want {
+				t.Errorf("unexpected output: have %q; want %q", have, tc.want)
+			}
+		})
+	}
+}
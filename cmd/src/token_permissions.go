@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/src-cli/internal/api"
+)
+
+// tokenUser is the user the access token belongs to.
+type tokenUser struct {
+	ID            string
+	Username      string
+	SiteAdmin     bool
+	Organizations struct {
+		Nodes []struct{ ID, Name string }
+	}
+}
+
+// canUseNamespace returns whether the user can create campaigns in the
+// namespace with the given ID.
+func (u *tokenUser) canUseNamespace(namespace string) bool {
+	if u.SiteAdmin || u.ID == namespace {
+		return true
+	}
+	for _, org := range u.Organizations.Nodes {
+		if org.ID == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// currentTokenUser returns the user the access token belongs to. operation
+// describes what the user is needed for, e.g. "creating a campaign", and is
+// included in the error if there is no user. It returns nil without an error
+// if the request wasn't executed, e.g. with -get-curl.
+func currentTokenUser(ctx context.Context, client api.Client, operation string) (*tokenUser, error) {
+	query := `
+query TokenUser {
+	currentUser {
+		id
+		username
+		siteAdmin
+		organizations {
+			nodes {
+				id
+				name
+			}
+		}
+	}
+}
+`
+	var result struct {
+		CurrentUser *tokenUser
+	}
+	ok, err := client.NewQuery(query).Do(ctx, &result)
+	if err != nil || !ok {
+		return nil, errors.Wrap(err, "querying the user of the access token")
+	}
+	if result.CurrentUser == nil {
+		return nil, fmt.Errorf("%s requires an access token, but none was given or it is invalid (see https://github.com/sourcegraph/src-cli#authentication)", operation)
+	}
+	return result.CurrentUser, nil
+}
+
+// requireSiteAdmin returns an error if the user of the access token is not a
+// site admin. operation describes what requires it, e.g. "reading the site
+// configuration".
+func requireSiteAdmin(ctx context.Context, client api.Client, operation string) error {
+	user, err := currentTokenUser(ctx, client, operation)
+	if err != nil || user == nil {
+		return err
+	}
+	if !user.SiteAdmin {
+		return fmt.Errorf("token user %s is not a site admin: %s requires site admin permissions", user.Username, operation)
+	}
+	return nil
+}
+
+// requireCampaignNamespace returns an error if the user of the access token
+// can't create campaigns in the namespace with the given ID, i.e. if they are
+// neither a site admin, nor the namespace's user, nor a member of the
+// namespace's organization.
+func requireCampaignNamespace(ctx context.Context, client api.Client, namespace string) error {
+	user, err := currentTokenUser(ctx, client, "creating a campaign")
+	if err != nil || user == nil {
+		return err
+	}
+	if user.canUseNamespace(namespace) {
+		return nil
+	}
+
+	query := `
+query Namespace($id: ID!) {
+	node(id: $id) {
+		__typename
+		... on User {
+			username
+		}
+		... on Org {
+			name
+		}
+	}
+}
+`
+	var result struct {
+		Node *struct {
+			Typename string `json:"__typename"`
+			Username string
+			Name     string
+		}
+	}
+	if ok, err := client.NewRequest(query, map[string]interface{}{"id": namespace}).Do(ctx, &result); err != nil || !ok {
+		return errors.Wrapf(err, "querying namespace %s", namespace)
+	}
+	switch {
+	case result.Node == nil:
+		return fmt.Errorf("namespace %s not found", namespace)
+	case result.Node.Typename == "Org":
+		return fmt.Errorf("token user %s is neither a site admin nor a member of the organization %s: creating a campaign in the namespace of %s requires one of them", user.Username, result.Node.Name, result.Node.Name)
+	case result.Node.Typename == "User":
+		return fmt.Errorf("token user %s is not a site admin: creating a campaign in the namespace of the user %s requires site admin permissions", user.Username, result.Node.Username)
+	default:
+		return fmt.Errorf("%s is the ID of a %s, not of a user or organization", namespace, result.Node.Typename)
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import "testing"
+
+func TestTokenUserCanUseNamespace(t *testing.T) {
+	user := &tokenUser{ID: "user-alice", Username: "alice"}
+	user.Organizations.Nodes = []struct{ ID, Name string }{{ID: "org-acme", Name: "acme"}}
+	admin := &tokenUser{ID: "user-admin", Username: "admin", SiteAdmin: true}
+
+	tests := map[string]struct {
+		user      *tokenUser
+		namespace string
+		want      bool
+	}{
+		"own namespace":        {user: user, namespace: "user-alice", want: true},
+		"member of org":        {user: user, namespace: "org-acme", want: true},
+		"other org":            {user: user, namespace: "org-other", want: false},
+		"other user":           {user: user, namespace: "user-bob", want: false},
+		"site admin other org": {user: admin, namespace: "org-other", want: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if have := tc.user.canUseNamespace(tc.namespace); have != tc.want {
+				t.Errorf("unexpected result: have %v; want %v", have, tc.want)
+			}
+		})
+	}
+}
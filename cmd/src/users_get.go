@@ -25,9 +25,10 @@ Examples:
 		fmt.Println(usage)
 	}
 	var (
-		usernameFlag = flagSet.String("username", "", `Look up user by username. (e.g. "alice")`)
-		formatFlag   = flagSet.String("f", "{{.|json}}", `Format for the output, using the syntax of Go package text/template. (e.g. "{{.ID}}: {{.Username}} ({{.DisplayName}})")`)
-		apiFlags     = api.NewFlags(flagSet)
+		usernameFlag     = flagSet.String("username", "", `Look up user by username. (e.g. "alice")`)
+		formatFlag       = flagSet.String("f", "{{.|json}}", `Format for the output, using the syntax of Go package text/template. (e.g. "{{.ID}}: {{.Username}} ({{.DisplayName}})")`)
+		templateFileFlag = flagSet.String("template-file", "", templateFileFlagUsage)
+		apiFlags         = api.NewFlags(flagSet)
 	)
 
 	handler := func(args []string) error {
@@ -35,7 +36,7 @@ Examples:
 
 		client := cfg.apiClient(apiFlags, flagSet.Output())
 
-		tmpl, err := parseTemplate(*formatFlag)
+		tmpl, err := parseTemplateOrFile(*formatFlag, *templateFileFlag)
 		if err != nil {
 			return err
 		}
@@ -37,11 +37,12 @@ Examples:
 		fmt.Println(usage)
 	}
 	var (
-		firstFlag  = flagSet.Int("first", 1000, "Returns the first n users from the list. (use -1 for unlimited)")
-		queryFlag  = flagSet.String("query", "", `Returns users whose names match the query. (e.g. "alice")`)
-		tagFlag    = flagSet.String("tag", "", `Returns users with the given tag.`)
-		formatFlag = flagSet.String("f", "{{.Username}}", `Format for the output, using the syntax of Go package text/template. (e.g. "{{.ID}}: {{.Username}} ({{.DisplayName}})" or "{{.|json}}")`)
-		apiFlags   = api.NewFlags(flagSet)
+		firstFlag        = flagSet.Int("first", 1000, "Returns the first n users from the list. (use -1 for unlimited)")
+		queryFlag        = flagSet.String("query", "", `Returns users whose names match the query. (e.g. "alice")`)
+		tagFlag          = flagSet.String("tag", "", `Returns users with the given tag.`)
+		formatFlag       = flagSet.String("f", "{{.Username}}", `Format for the output, using the syntax of Go package text/template. (e.g. "{{.ID}}: {{.Username}} ({{.DisplayName}})" or "{{.|json}}")`)
+		templateFileFlag = flagSet.String("template-file", "", templateFileFlagUsage)
+		apiFlags         = api.NewFlags(flagSet)
 	)
 
 	handler := func(args []string) error {
@@ -50,7 +51,7 @@ Examples:
 		ctx := context.Background()
 		client := cfg.apiClient(apiFlags, flagSet.Output())
 
-		tmpl, err := parseTemplate(*formatFlag)
+		tmpl, err := parseTemplateOrFile(*formatFlag, *templateFileFlag)
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/src-cli/internal/api"
+	"github.com/sourcegraph/src-cli/internal/output"
+)
+
+func init() {
+	usage := `
+Validate the configuration and state of a Sourcegraph instance by running the checks in a validation spec. This is useful to catch configuration drift, e.g. by running 'src validate' in a scheduled job.
+
+Usage:
+
+	src validate [options] <spec file>
+
+The spec file is a YAML or JSON file with a list of checks. Each check has a "type", the other properties depend on the type. If any check fails, 'src validate' exits with exit code 3.
+
+With -timeout, the checks that are still running when the timeout is exceeded fail and the remaining ones are not run, so that an instance that doesn't respond can't make 'src validate' hang.
+
+Check types:
+
+	assertSettings    asserts values in the site configuration ("settings": "site") or the global settings ("settings": "global").
+	                  Each assertion is a path of keys, optionally followed by "==" or "!=" and a JSON value. An assertion with only a path checks that the path exists.
+	repoPermissions   checks that the user "username" can access the repository "repository" once its permissions have been synced.
+	                  Set "access" to false to check that the user can NOT access the repository. The check fails if the user
+	                  doesn't exist.
+	sendTestEmail     sends a test email to the address "to" using the SMTP configuration of the instance. If "imap" is set, the IMAP inbox
+	                  is polled until the email arrives (properties: "server" (host:port, TLS), "username", "password" (environment
+	                  variables are expanded), "mailbox" (default INBOX) and "timeout" (default 2m)). Otherwise, if "confirm" is true,
+	                  you are asked whether the email arrived.
+	repoIndexed       waits until the default branch of "repository" is indexed for search, checking every "interval" (default 5s)
+	                  for up to "timeout" (default 5m).
+	reposCloned       waits until the repositories in "repositories", names or patterns like "github.com/my-org/*", are cloned and
+	                  there are at least "minCount" of them, and at least one, printing the progress. Without "repositories", all
+	                  repositories are checked. "query" restricts the repositories that are listed, like 'src repos list -query'. "interval" and
+	                  "timeout" are like for repoIndexed.
+	codeHostConnection
+	                  checks that the code host of "kind" (GITHUB, GITLAB or BITBUCKETSERVER) at "url" can be reached and accepts
+	                  "token" (environment variables are expanded), before an external service is created with them. "url" defaults
+	                  to github.com or gitlab.com. The code host is called from the Sourcegraph instance on Sourcegraph 5.1 or
+	                  later, and from the machine 'src validate' runs on otherwise, which is printed.
+
+Examples:
+
+  Validate an instance with the checks in validate.yaml:
+
+    	$ src validate validate.yaml
+
+  A validation spec that asserts that search indexing is enabled and that a global setting is set:
+
+    	checks:
+    	  - type: assertSettings
+    	    settings: site
+    	    assertions:
+    	      - search.index.enabled == true
+    	      - externalURL != ""
+    	  - type: assertSettings
+    	    settings: global
+    	    assertions:
+    	      - search.defaultPatternType
+
+  A validation spec that checks repository permissions after configuring an authorization provider:
+
+    	checks:
+    	  - type: repoPermissions
+    	    username: alice
+    	    repository: github.com/our-org/private-repo
+    	  - type: repoPermissions
+    	    username: bob
+    	    repository: github.com/our-org/private-repo
+    	    access: false
+
+  A validation spec that checks that emails sent by the instance arrive:
+
+    	checks:
+    	  - type: sendTestEmail
+    	    to: sourcegraph-test@example.com
+    	    imap:
+    	      server: imap.example.com:993
+    	      username: sourcegraph-test@example.com
+    	      password: $IMAP_PASSWORD
+
+  A validation spec that checks that all repositories of a newly added external service were cloned:
+
+    	checks:
+    	  - type: reposCloned
+    	    query: github.com/my-org/
+    	    repositories:
+    	      - github.com/my-org/*
+    	      - github.com/my-org/monorepo
+    	    minCount: 250
+    	    timeout: 30m
+
+  A validation spec that checks a GitHub Enterprise token before adding it to an external service:
+
+    	checks:
+    	  - type: codeHostConnection
+    	    kind: GITHUB
+    	    url: https://github.example.com
+    	    token: $GITHUB_TOKEN
+
+`
+
+	flagSet := flag.NewFlagSet("validate", flag.ExitOnError)
+	usageFunc := func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'src %s':\n", flagSet.Name())
+		flagSet.PrintDefaults()
+		fmt.Println(usage)
+	}
+	var (
+		timeoutFlag = flagSet.Duration("timeout", 0, "The maximum time all checks may take, e.g. 10m. 0 means no timeout.")
+		apiFlags    = api.NewFlags(flagSet)
+	)
+
+	handler := func(args []string) error {
+		if err := flagSet.Parse(args); err != nil {
+			return err
+		}
+		if flagSet.NArg() != 1 {
+			return &usageError{errors.New("expected exactly one validation spec file")}
+		}
+
+		spec, err := readValidationSpec(flagSet.Arg(0))
+		if err != nil {
+			return &exitCodeError{error: err, exitCode: exitCodeValidation}
+		}
+
+		ctx := context.Background()
+		if *timeoutFlag > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, *timeoutFlag)
+			defer cancel()
+		}
+		client := cfg.apiClient(apiFlags, flagSet.Output())
+
+		for _, check := range spec.Checks {
+			if validationCheckRequiresSiteAdmin(check) {
+				if err := requireSiteAdmin(ctx, client, fmt.Sprintf("the %s check", check.Type)); err != nil {
+					return err
+				}
+				break
+			}
+		}
+
+		return runValidationChecks(ctx, client, spec.Checks, *timeoutFlag)
+	}
+
+	// Register the command.
+	commands = append(commands, &command{
+		flagSet:   flagSet,
+		handler:   handler,
+		usageFunc: usageFunc,
+	})
+}
+
+// runValidationChecks runs the checks and reports their results. Once ctx is
+// done, the remaining checks are not run. timeout is the timeout of ctx, if
+// any, which is included in the report.
+func runValidationChecks(ctx context.Context, client api.Client, checks []validationCheck, timeout time.Duration) error {
+	failed, notRun := 0, 0
+	for i, check := range checks {
+		desc := fmt.Sprintf("[%d] %s", i+1, check.Type)
+		if ctx.Err() != nil {
+			notRun++
+			color.New(color.FgYellow).Printf("%s  %s: not run, the timeout of %s was exceeded\n", output.Emoji(output.EmojiAlert), desc, timeout)
+			continue
+		}
+		if err := runValidationCheck(ctx, client, check); err != nil {
+			failed++
+			if ctx.Err() == context.DeadlineExceeded {
+				err = fmt.Errorf("the timeout of %s was exceeded: %s", timeout, err)
+			}
+			color.New(color.FgRed).Printf("%s  %s: %s\n", output.Emoji(output.EmojiFailure), desc, err)
+			continue
+		}
+		color.New(color.FgGreen).Printf("%s  %s\n", output.Emoji(output.EmojiSuccess), desc)
+	}
+
+	if failed > 0 || notRun > 0 {
+		msg := fmt.Sprintf("%d of %d checks failed", failed, len(checks))
+		if notRun > 0 {
+			msg += fmt.Sprintf(", %d were not run", notRun)
+		}
+		return &exitCodeError{error: errors.New(msg), exitCode: exitCodeValidation}
+	}
+	return nil
+}
+
+// validationSpec is the content of a validation spec file.
+type validationSpec struct {
+	Checks []validationCheck `json:"checks"`
+}
+
+// validationCheck is a single check in a validation spec. Which fields are
+// used depends on the type of the check.
+type validationCheck struct {
+	Type string `json:"type"`
+
+	// assertSettings
+	Settings   string   `json:"settings,omitempty"`
+	Assertions []string `json:"assertions,omitempty"`
+
+	// repoPermissions
+	Username   string `json:"username,omitempty"`
+	Repository string `json:"repository,omitempty"`
+	Access     *bool  `json:"access,omitempty"`
+
+	// sendTestEmail
+	To      string          `json:"to,omitempty"`
+	Confirm bool            `json:"confirm,omitempty"`
+	IMAP    *validationIMAP `json:"imap,omitempty"`
+
+	// reposCloned
+	Repositories []string `json:"repositories,omitempty"`
+	Query        string   `json:"query,omitempty"`
+	MinCount     int      `json:"minCount,omitempty"`
+
+	// codeHostConnection
+	Kind  string `json:"kind,omitempty"`
+	URL   string `json:"url,omitempty"`
+	Token string `json:"token,omitempty"`
+
+	// Checks that wait for a condition, e.g. repoIndexed.
+	Timeout  string `json:"timeout,omitempty"`
+	Interval string `json:"interval,omitempty"`
+}
+
+// validationCheckFunc runs a check and returns an error describing why it
+// failed, if it did.
+type validationCheckFunc func(ctx context.Context, client api.Client, check validationCheck) error
+
+// validationChecks contains the check types, keyed by the name used in
+// validation specs.
+var validationChecks = map[string]validationCheckFunc{}
+
+// errNoResult is returned by checks whose request returned no result, e.g.
+// because of GraphQL errors, which have already been printed, or -get-curl, so
+// that they fail instead of passing without having checked anything.
+var errNoResult = errors.New("the request returned no result")
+
+func readValidationSpec(path string) (*validationSpec, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err = yaml.YAMLToJSONStrict(data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to parse validation spec %s", path)
+	}
+
+	var spec validationSpec
+	dec := json.NewDecoder(strings.NewReader(string(data)))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&spec); err != nil {
+		return nil, errors.Wrapf(err, "invalid validation spec %s", path)
+	}
+
+	for i, check := range spec.Checks {
+		if _, ok := validationChecks[check.Type]; !ok {
+			return nil, fmt.Errorf("invalid validation spec %s: check %d has unknown type %q (valid types: %s)", path, i+1, check.Type, strings.Join(validationCheckTypes(), ", "))
+		}
+	}
+	return &spec, nil
+}
+
+func runValidationCheck(ctx context.Context, client api.Client, check validationCheck) error {
+	return validationChecks[check.Type](ctx, client, check)
+}
+
+// waitForValidation calls cond every "interval" (default 5s) until it returns
+// true, or fails once "timeout" (default 5m) has passed. cond returns a
+// description of the current state, which is included in the error.
+func waitForValidation(ctx context.Context, check validationCheck, cond func() (bool, string, error)) error {
+	timeout, interval := 5*time.Minute, 5*time.Second
+	var err error
+	if check.Timeout != "" {
+		if timeout, err = time.ParseDuration(check.Timeout); err != nil {
+			return errors.Wrap(err, `invalid "timeout"`)
+		}
+	}
+	if check.Interval != "" {
+		if interval, err = time.ParseDuration(check.Interval); err != nil {
+			return errors.Wrap(err, `invalid "interval"`)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	for {
+		ok, state, err := cond()
+		if err != nil || ok {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%s after waiting for %s", state, timeout)
+		case <-time.After(interval):
+		}
+	}
+}
+
+// validationCheckRequiresSiteAdmin returns whether the check queries data
+// that only site admins can access.
+func validationCheckRequiresSiteAdmin(check validationCheck) bool {
+	switch check.Type {
+	case "assertSettings":
+		return check.Settings == "site"
+	case "repoPermissions", "sendTestEmail":
+		return true
+	}
+	return false
+}
+
+func validationCheckTypes() []string {
+	types := make([]string, 0, len(validationChecks))
+	for t := range validationChecks {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
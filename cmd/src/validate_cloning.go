@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/src-cli/internal/api"
+)
+
+func init() {
+	validationChecks["reposCloned"] = validateReposCloned
+}
+
+const reposCloneStatusQuery = `
+query RepositoriesCloneStatus($query: String, $after: String) {
+	repositories(first: 1000, query: $query, after: $after) {
+		nodes {
+			name
+			mirrorInfo {
+				cloned
+			}
+		}
+		pageInfo {
+			hasNextPage
+			endCursor
+		}
+	}
+}
+`
+
+// cloneStatus is the clone status of a repository, as returned by
+// fetchCloneStatus.
+type cloneStatus struct {
+	Name       string
+	MirrorInfo struct{ Cloned bool }
+}
+
+// validateReposCloned waits until the repositories matching "repositories",
+// a list of names or patterns in the syntax of path.Match, are cloned and
+// there are at least "minCount" of them. This checks that a new external
+// service synced all of its repositories, not just a single one.
+func validateReposCloned(ctx context.Context, client api.Client, check validationCheck) error {
+	for _, pattern := range check.Repositories {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return errors.Wrapf(err, `invalid pattern %q in "repositories"`, pattern)
+		}
+	}
+	if check.MinCount < 0 {
+		return errors.New(`"minCount" must not be negative`)
+	}
+
+	lastState := ""
+	return waitForValidation(ctx, check, func() (bool, string, error) {
+		repos, err := fetchCloneStatus(ctx, client, check.Query)
+		if err != nil {
+			return false, "", err
+		}
+		ok, state := reposClonedState(repos, check.Repositories, check.MinCount)
+		if state != lastState {
+			fmt.Printf("    %s\n", state)
+			lastState = state
+		}
+		return ok, state, nil
+	})
+}
+
+// fetchCloneStatus returns the clone status of all repositories whose names
+// match query, or of all repositories if query is empty.
+func fetchCloneStatus(ctx context.Context, client api.Client, query string) ([]cloneStatus, error) {
+	var (
+		repos []cloneStatus
+		after *string
+	)
+	for {
+		var result struct {
+			Repositories struct {
+				Nodes    []cloneStatus
+				PageInfo struct {
+					HasNextPage bool
+					EndCursor   *string
+				}
+			}
+		}
+		if ok, err := client.NewRequest(reposCloneStatusQuery, map[string]interface{}{
+			"query": query,
+			"after": after,
+		}).Do(ctx, &result); err != nil {
+			return nil, errors.Wrap(err, "fetching clone status of repositories")
+		} else if !ok {
+			return nil, errors.Wrap(errNoResult, "fetching clone status of repositories")
+		}
+		repos = append(repos, result.Repositories.Nodes...)
+		if !result.Repositories.PageInfo.HasNextPage || result.Repositories.PageInfo.EndCursor == nil {
+			return repos, nil
+		}
+		after = result.Repositories.PageInfo.EndCursor
+	}
+}
+
+// reposClonedState returns whether the repositories matching patterns (all
+// repositories if there are none) are cloned, every pattern without
+// wildcards names an existing repository and at least minCount repositories,
+// and at least one, match, and a description of their clone progress.
+func reposClonedState(repos []cloneStatus, patterns []string, minCount int) (bool, string) {
+	found := map[string]bool{}
+	matched, cloned := 0, 0
+	for _, repo := range repos {
+		if len(patterns) > 0 && !matchesAnyPattern(patterns, repo.Name) {
+			continue
+		}
+		found[repo.Name] = true
+		matched++
+		if repo.MirrorInfo.Cloned {
+			cloned++
+		}
+	}
+
+	var missing []string
+	for _, pattern := range patterns {
+		if !strings.ContainsAny(pattern, `*?[\`) && !found[pattern] {
+			missing = append(missing, pattern)
+		}
+	}
+
+	state := fmt.Sprintf("cloned %d/%d repositories", cloned, matched)
+	if minCount > 0 {
+		state += fmt.Sprintf(" (at least %d required)", minCount)
+	}
+	if len(missing) > 0 {
+		state += fmt.Sprintf(", not found: %s", strings.Join(missing, ", "))
+	}
+	if matched == 0 && len(missing) == 0 {
+		state += ", no repositories found"
+	}
+	return cloned == matched && matched > 0 && matched >= minCount && len(missing) == 0, state
+}
+
+func matchesAnyPattern(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"io/ioutil"
+	"testing"
+
+	"github.com/sourcegraph/src-cli/internal/api"
+)
+
+func TestReposClonedState(t *testing.T) {
+	repo := func(name string, cloned bool) cloneStatus {
+		r := cloneStatus{Name: name}
+		r.MirrorInfo.Cloned = cloned
+		return r
+	}
+	repos := []cloneStatus{
+		repo("github.com/my-org/a", true),
+		repo("github.com/my-org/b", false),
+		repo("github.com/my-org/c", true),
+		repo("gitlab.com/other/d", true),
+	}
+
+	tests := map[string]struct {
+		patterns  []string
+		minCount  int
+		wantOK    bool
+		wantState string
+	}{
+		"all repositories": {
+			wantState: "cloned 3/4 repositories",
+		},
+		"cloned names": {
+			patterns:  []string{"github.com/my-org/a", "github.com/my-org/c"},
+			wantOK:    true,
+			wantState: "cloned 2/2 repositories",
+		},
+		"pattern with uncloned repository": {
+			patterns:  []string{"github.com/my-org/*"},
+			wantState: "cloned 2/3 repositories",
+		},
+		"too few repositories": {
+			patterns:  []string{"gitlab.com/*/*"},
+			minCount:  2,
+			wantState: "cloned 1/1 repositories (at least 2 required)",
+		},
+		"enough repositories": {
+			patterns:  []string{"gitlab.com/*/*"},
+			minCount:  1,
+			wantOK:    true,
+			wantState: "cloned 1/1 repositories (at least 1 required)",
+		},
+		"no repositories": {
+			patterns:  []string{"bitbucket.org/*/*"},
+			wantState: "cloned 0/0 repositories, no repositories found",
+		},
+		"missing repository": {
+			patterns:  []string{"github.com/my-org/a", "github.com/my-org/z"},
+			wantState: "cloned 1/1 repositories, not found: github.com/my-org/z",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			ok, state := reposClonedState(repos, tc.patterns, tc.minCount)
+			if ok != tc.wantOK || state != tc.wantState {
+				t.Errorf("unexpected result: have %v, %q; want %v, %q", ok, state, tc.wantOK, tc.wantState)
+			}
+		})
+	}
+}
+
+func TestFetchCloneStatusNoResult(t *testing.T) {
+	flagSet := flag.NewFlagSet("test", flag.ContinueOnError)
+	apiFlags := api.NewFlags(flagSet)
+	if err := flagSet.Parse([]string{"-get-curl"}); err != nil {
+		t.Fatal(err)
+	}
+	client := api.NewClient(api.ClientOpts{Endpoint: "https://sourcegraph.example.com", Flags: apiFlags, Out: ioutil.Discard})
+
+	if _, err := fetchCloneStatus(context.Background(), client, ""); err == nil {
+		t.Error("no error when the request returned no result")
+	}
+}
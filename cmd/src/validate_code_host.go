@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/src-cli/internal/api"
+)
+
+func init() {
+	validationChecks["codeHostConnection"] = validateCodeHostConnection
+}
+
+// codeHostConnection describes how to check the connection to a code host of
+// a kind of external service: the API endpoint that requires authentication
+// and how to pass the token to it.
+type codeHostConnection struct {
+	defaultURL string
+	// endpoint returns the URL of the endpoint for the code host at base.
+	endpoint  func(base *url.URL) string
+	authorize func(req *http.Request, token string)
+}
+
+// codeHostConnections are the kinds of external services whose connection
+// can be checked, keyed by the kind as used by 'src extsvc'.
+var codeHostConnections = map[string]codeHostConnection{
+	"GITHUB": {
+		defaultURL: "https://github.com",
+		endpoint: func(base *url.URL) string {
+			if base.Hostname() == "github.com" {
+				return "https://api.github.com/user"
+			}
+			return base.String() + "/api/v3/user"
+		},
+		authorize: func(req *http.Request, token string) { req.Header.Set("Authorization", "token "+token) },
+	},
+	"GITLAB": {
+		defaultURL: "https://gitlab.com",
+		endpoint:   func(base *url.URL) string { return base.String() + "/api/v4/user" },
+		authorize:  func(req *http.Request, token string) { req.Header.Set("Private-Token", token) },
+	},
+	"BITBUCKETSERVER": {
+		endpoint:  func(base *url.URL) string { return base.String() + "/rest/api/1.0/repos?limit=1" },
+		authorize: func(req *http.Request, token string) { req.Header.Set("Authorization", "Bearer "+token) },
+	},
+}
+
+// validateCodeHostConnection checks that the code host at "url" can be
+// reached and accepts "token", before an external service is created with
+// them. Sourcegraph 5.1 and later make the request to the code host
+// themselves. Older instances can't, so the request is made from the machine
+// src runs on instead, which is printed.
+func validateCodeHostConnection(ctx context.Context, client api.Client, check validationCheck) error {
+	conn, ok := codeHostConnections[strings.ToUpper(check.Kind)]
+	if !ok {
+		kinds := make([]string, 0, len(codeHostConnections))
+		for k := range codeHostConnections {
+			kinds = append(kinds, k)
+		}
+		sort.Strings(kinds)
+		return fmt.Errorf(`invalid "kind" %q, must be one of %s`, check.Kind, strings.Join(kinds, ", "))
+	}
+	rawURL := check.URL
+	if rawURL == "" {
+		rawURL = conn.defaultURL
+	}
+	if rawURL == "" {
+		return fmt.Errorf(`"url" is required for %s`, strings.ToUpper(check.Kind))
+	}
+	base, err := url.Parse(strings.TrimSuffix(rawURL, "/"))
+	if err != nil || base.Scheme == "" || base.Host == "" {
+		return fmt.Errorf(`invalid "url" %q`, rawURL)
+	}
+	token := os.ExpandEnv(check.Token)
+	if token == "" {
+		return errors.New(`"token" is required`)
+	}
+
+	version, err := getSourcegraphVersion(ctx, client)
+	if err != nil {
+		return err
+	}
+	fromInstance, err := sourcegraphVersionCheck(version, ">= 5.1.0", "2023-06-01")
+	if err != nil {
+		return err
+	}
+	if fromInstance {
+		return checkCodeHostConnectionFromInstance(ctx, client, strings.ToUpper(check.Kind), base, token)
+	}
+	fmt.Printf("    The Sourcegraph instance can't check code host connections, connecting to %s from this machine instead.\n", base.Host)
+	return checkCodeHostConnectionLocally(ctx, conn, base, token)
+}
+
+const codeHostConnectionQuery = `query CodeHostConnection($kind: ExternalServiceKind!, $url: String!, $token: String!) {
+  externalServiceNamespaces(kind: $kind, url: $url, token: $token) {
+    totalCount
+  }
+}`
+
+// checkCodeHostConnectionFromInstance has the Sourcegraph instance list the
+// namespaces that the token can access on the code host, which fails with the
+// error of the code host if the instance can't connect to it.
+func checkCodeHostConnectionFromInstance(ctx context.Context, client api.Client, kind string, base *url.URL, token string) error {
+	var result struct {
+		ExternalServiceNamespaces struct {
+			TotalCount int
+		}
+	}
+	if _, err := client.NewRequest(codeHostConnectionQuery, map[string]interface{}{
+		"kind":  kind,
+		"url":   base.String(),
+		"token": token,
+	}).Do(ctx, &result); err != nil {
+		return errors.Wrapf(err, "the Sourcegraph instance could not connect to %s", base.Host)
+	}
+	return nil
+}
+
+// checkCodeHostConnectionLocally makes a request that requires
+// authentication to the code host at base from the machine src runs on.
+func checkCodeHostConnectionLocally(ctx context.Context, conn codeHostConnection, base *url.URL, token string) error {
+	endpoint := conn.endpoint(base)
+	req, err := http.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		return err
+	}
+	conn.authorize(req, token)
+	resp, err := api.HTTPClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrapf(err, "connecting to %s", base.Host)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	return fmt.Errorf("%s rejected the request to %s with status %d: %s", base.Host, endpoint, resp.StatusCode, codeHostErrorMessage(body))
+}
+
+// codeHostErrorMessage returns the error message in the body of an error
+// response of a code host API, or the body itself if it has none.
+func codeHostErrorMessage(body []byte) string {
+	var result struct {
+		Message string
+		Error   string
+		Errors  []struct{ Message string }
+	}
+	if err := json.Unmarshal(body, &result); err == nil {
+		switch {
+		case result.Message != "":
+			return result.Message
+		case result.Error != "":
+			return result.Error
+		case len(result.Errors) > 0 && result.Errors[0].Message != "":
+			return result.Errors[0].Message
+		}
+	}
+	msg := strings.TrimSpace(string(body))
+	if len(msg) > 200 {
+		msg = msg[:200] + "..."
+	}
+	return msg
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sourcegraph/src-cli/internal/api"
+)
+
+func TestValidateCodeHostConnection(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/v3/user" && r.Header.Get("Authorization") == "token good":
+			w.Write([]byte(`{"login": "alice"}`))
+		case r.URL.Path == "/api/v3/user":
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"message": "Bad credentials"}`))
+		case r.URL.Path == "/rest/api/1.0/repos":
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"errors": [{"message": "Authentication failed. Please check your credentials and try again."}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	// sourcegraph answers the GraphQL requests of the check. It connects to
+	// the code host itself if its version is 5.1 or later.
+	sourcegraph := func(version string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var req struct {
+				Query     string
+				Variables map[string]string
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Fatal(err)
+			}
+			switch {
+			case strings.Contains(req.Query, "productVersion"):
+				w.Write([]byte(`{"data": {"site": {"productVersion": "` + version + `"}}}`))
+			case req.Variables["token"] == "good" && req.Variables["url"] == ts.URL:
+				w.Write([]byte(`{"data": {"externalServiceNamespaces": {"totalCount": 1}}}`))
+			default:
+				w.Write([]byte(`{"errors": [{"message": "Bad credentials"}]}`))
+			}
+		}))
+	}
+
+	tests := map[string]struct {
+		version string
+		check   validationCheck
+		wantErr string
+	}{
+		"valid token": {
+			check: validationCheck{Kind: "github", URL: ts.URL, Token: "good"},
+		},
+		"invalid token": {
+			check:   validationCheck{Kind: "GITHUB", URL: ts.URL + "/", Token: "bad"},
+			wantErr: "status 401: Bad credentials",
+		},
+		"bitbucket server error": {
+			check:   validationCheck{Kind: "BITBUCKETSERVER", URL: ts.URL, Token: "bad"},
+			wantErr: "status 401: Authentication failed.",
+		},
+		"valid token from instance": {
+			version: "5.1.0",
+			check:   validationCheck{Kind: "BITBUCKETSERVER", URL: ts.URL + "/", Token: "good"},
+		},
+		"invalid token from instance": {
+			version: "5.1.0",
+			check:   validationCheck{Kind: "GITHUB", URL: ts.URL, Token: "bad"},
+			wantErr: "the Sourcegraph instance could not connect to " + strings.TrimPrefix(ts.URL, "http://") + ": GraphQL error: Bad credentials",
+		},
+		"missing url": {
+			check:   validationCheck{Kind: "BITBUCKETSERVER", Token: "bad"},
+			wantErr: `"url" is required`,
+		},
+		"missing token": {
+			check:   validationCheck{Kind: "GITHUB", URL: ts.URL},
+			wantErr: `"token" is required`,
+		},
+		"unknown kind": {
+			check:   validationCheck{Kind: "GITOLITE", URL: ts.URL, Token: "good"},
+			wantErr: `invalid "kind"`,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			version := tc.version
+			if version == "" {
+				version = "3.17.0"
+			}
+			sg := sourcegraph(version)
+			defer sg.Close()
+			client := api.NewClient(api.ClientOpts{Endpoint: sg.URL, Out: ioutil.Discard})
+
+			err := validateCodeHostConnection(context.Background(), client, tc.check)
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("unexpected error: have %v; want it to contain %q", err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/src-cli/internal/api"
+)
+
+func init() {
+	validationChecks["sendTestEmail"] = validateSendTestEmail
+}
+
+// validationIMAP is the IMAP inbox that a sendTestEmail check polls for the
+// test email.
+type validationIMAP struct {
+	// Server is the host:port of an IMAP server that accepts TLS
+	// connections, usually on port 993.
+	Server   string `json:"server"`
+	Username string `json:"username"`
+	// Password may refer to environment variables, e.g. "$IMAP_PASSWORD".
+	Password string `json:"password"`
+	Mailbox  string `json:"mailbox,omitempty"`
+	// Timeout is how long to wait for the email, e.g. "5m". The default is
+	// two minutes.
+	Timeout string `json:"timeout,omitempty"`
+}
+
+// testEmailSentPrefix is the prefix of the result of the sendTestEmail
+// mutation if the email was sent.
+const testEmailSentPrefix = "Sent test email"
+
+// imapPollInterval is the interval in which the IMAP inbox is checked for the
+// test email.
+var imapPollInterval = 5 * time.Second
+
+// validateSendTestEmail makes the instance send a test email. If an IMAP inbox
+// is given, it checks that the email arrives there. Otherwise, if confirm is
+// set, the user is asked whether it arrived.
+func validateSendTestEmail(ctx context.Context, client api.Client, check validationCheck) error {
+	if check.To == "" {
+		return errors.New(`"to" is required`)
+	}
+
+	var (
+		inbox   *imapConn
+		known   map[string]bool
+		timeout = 2 * time.Minute
+	)
+	if check.IMAP != nil {
+		if check.IMAP.Timeout != "" {
+			var err error
+			if timeout, err = time.ParseDuration(check.IMAP.Timeout); err != nil {
+				return errors.Wrap(err, `invalid "imap.timeout"`)
+			}
+		}
+
+		dialer := &net.Dialer{Timeout: 30 * time.Second}
+		deadline, hasDeadline := ctx.Deadline()
+		if hasDeadline {
+			dialer.Deadline = deadline
+		}
+		conn, err := tls.DialWithDialer(dialer, "tcp", check.IMAP.Server, nil)
+		if err != nil {
+			return errors.Wrapf(err, "connecting to IMAP server %s", check.IMAP.Server)
+		}
+		defer conn.Close()
+		if hasDeadline {
+			// Reads from a server that doesn't respond fail once the
+			// deadline of the context is exceeded.
+			if err := conn.SetDeadline(deadline); err != nil {
+				return err
+			}
+		}
+
+		inbox, err = openIMAPInbox(conn, *check.IMAP)
+		if err != nil {
+			return err
+		}
+		// Emails that are already in the inbox don't count.
+		if known, err = inbox.searchTo(check.To); err != nil {
+			return err
+		}
+	}
+
+	query := `
+mutation SendTestEmail($to: String!) {
+	sendTestEmail(to: $to)
+}
+`
+	var result struct{ SendTestEmail string }
+	if ok, err := client.NewRequest(query, map[string]interface{}{"to": check.To}).Do(ctx, &result); err != nil {
+		return errors.Wrap(err, "sending test email")
+	} else if !ok {
+		return errors.Wrap(errNoResult, "sending test email")
+	}
+	// Sourcegraph reports failures to send the email in the result of the
+	// mutation, e.g. "Failed to send test email: ...", not as errors.
+	if !strings.HasPrefix(result.SendTestEmail, testEmailSentPrefix) {
+		return fmt.Errorf("sending test email to %s failed: %s", check.To, result.SendTestEmail)
+	}
+
+	switch {
+	case inbox != nil:
+		return waitForTestEmail(ctx, inbox, check.To, known, timeout)
+
+	case check.Confirm:
+		ok, err := askForConfirmation(fmt.Sprintf("A test email was sent to %s. Did it arrive?", check.To))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("the test email to %s did not arrive", check.To)
+		}
+	}
+	return nil
+}
+
+// waitForTestEmail polls inbox until it contains an email to the given address
+// whose UID is not in known.
+func waitForTestEmail(ctx context.Context, inbox *imapConn, to string, known map[string]bool, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		uids, err := inbox.searchTo(to)
+		if err != nil {
+			return err
+		}
+		for uid := range uids {
+			if !known[uid] {
+				return nil
+			}
+		}
+		if time.Now().Add(imapPollInterval).After(deadline) {
+			return fmt.Errorf("the test email to %s did not arrive within %s", to, timeout)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(imapPollInterval):
+		}
+	}
+}
+
+// imapConn is a minimal IMAP client that supports what's needed to look for
+// the test email in a mailbox.
+type imapConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	tag  int
+}
+
+// openIMAPInbox reads the greeting of the IMAP server on conn, logs in and
+// selects the mailbox.
+func openIMAPInbox(conn net.Conn, opts validationIMAP) (*imapConn, error) {
+	c := &imapConn{conn: conn, r: bufio.NewReader(conn)}
+	greeting, err := c.readLine()
+	if err != nil {
+		return nil, errors.Wrap(err, "reading IMAP greeting")
+	}
+	if !strings.HasPrefix(greeting, "* OK") {
+		return nil, fmt.Errorf("unexpected IMAP greeting: %s", greeting)
+	}
+
+	password := os.ExpandEnv(opts.Password)
+	if _, err := c.command("LOGIN %s %s", imapQuote(opts.Username), imapQuote(password)); err != nil {
+		return nil, errors.Wrap(err, "logging in to IMAP server")
+	}
+	mailbox := opts.Mailbox
+	if mailbox == "" {
+		mailbox = "INBOX"
+	}
+	if _, err := c.command("SELECT %s", imapQuote(mailbox)); err != nil {
+		return nil, errors.Wrapf(err, "selecting IMAP mailbox %s", mailbox)
+	}
+	return c, nil
+}
+
+// searchTo returns the UIDs of the emails in the selected mailbox that were
+// sent to the given address.
+func (c *imapConn) searchTo(to string) (map[string]bool, error) {
+	lines, err := c.command("UID SEARCH TO %s", imapQuote(to))
+	if err != nil {
+		return nil, errors.Wrap(err, "searching IMAP mailbox")
+	}
+	uids := map[string]bool{}
+	for _, line := range lines {
+		if fields := strings.Fields(line); len(fields) >= 2 && fields[0] == "*" && strings.EqualFold(fields[1], "SEARCH") {
+			for _, uid := range fields[2:] {
+				uids[uid] = true
+			}
+		}
+	}
+	return uids, nil
+}
+
+// command sends a command and returns the untagged responses to it. It
+// returns an error if the command doesn't complete with OK.
+func (c *imapConn) command(format string, args ...interface{}) ([]string, error) {
+	c.tag++
+	tag := fmt.Sprintf("a%d", c.tag)
+	if _, err := fmt.Fprintf(c.conn, "%s %s\r\n", tag, fmt.Sprintf(format, args...)); err != nil {
+		return nil, err
+	}
+
+	var untagged []string
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(line, tag+" ") {
+			untagged = append(untagged, line)
+			continue
+		}
+		status := strings.TrimPrefix(line, tag+" ")
+		if !strings.HasPrefix(status, "OK") {
+			return nil, fmt.Errorf("IMAP server responded: %s", status)
+		}
+		return untagged, nil
+	}
+}
+
+func (c *imapConn) readLine() (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// imapQuote returns s as an IMAP quoted string.
+func imapQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/src-cli/internal/api"
+)
+
+// serveIMAP runs a fake IMAP server on conn. The nth search returns the UIDs
+// in searches[n], or those of the last search.
+func serveIMAP(conn net.Conn, searches [][]string) *[]string {
+	var commands []string
+	go func() {
+		defer conn.Close()
+		fmt.Fprint(conn, "* OK IMAP4rev1 ready\r\n")
+		r := bufio.NewReader(conn)
+		n := 0
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			fields := strings.SplitN(strings.TrimSpace(line), " ", 2)
+			tag, cmd := fields[0], fields[1]
+			commands = append(commands, cmd)
+			switch {
+			case strings.HasPrefix(cmd, "LOGIN") && !strings.Contains(cmd, `"secret"`):
+				fmt.Fprintf(conn, "%s NO [AUTHENTICATIONFAILED] Invalid credentials\r\n", tag)
+				continue
+			case strings.HasPrefix(cmd, "SELECT"):
+				fmt.Fprint(conn, "* 3 EXISTS\r\n")
+			case strings.HasPrefix(cmd, "UID SEARCH"):
+				uids := searches[len(searches)-1]
+				if n < len(searches) {
+					uids = searches[n]
+				}
+				n++
+				fmt.Fprintf(conn, "* SEARCH %s\r\n", strings.Join(uids, " "))
+			}
+			fmt.Fprintf(conn, "%s OK done\r\n", tag)
+		}
+	}()
+	return &commands
+}
+
+func TestWaitForTestEmail(t *testing.T) {
+	old := imapPollInterval
+	t.Cleanup(func() { imapPollInterval = old })
+	imapPollInterval = time.Millisecond
+
+	opts := validationIMAP{Username: "alice", Password: "secret"}
+
+	t.Run("email arrives", func(t *testing.T) {
+		client, server := net.Pipe()
+		commands := serveIMAP(server, [][]string{{"1"}, {"1"}, {"1", "4"}})
+
+		inbox, err := openIMAPInbox(client, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		known, err := inbox.searchTo("alice@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := waitForTestEmail(context.Background(), inbox, "alice@example.com", known, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+		client.Close()
+
+		want := []string{
+			`LOGIN "alice" "secret"`,
+			`SELECT "INBOX"`,
+			`UID SEARCH TO "alice@example.com"`,
+			`UID SEARCH TO "alice@example.com"`,
+			`UID SEARCH TO "alice@example.com"`,
+		}
+		if diff := cmp.Diff(want, *commands); diff != "" {
+			t.Errorf("unexpected commands (-want +have):\n%s", diff)
+		}
+	})
+
+	t.Run("email does not arrive", func(t *testing.T) {
+		client, server := net.Pipe()
+		serveIMAP(server, [][]string{{}})
+		defer client.Close()
+
+		inbox, err := openIMAPInbox(client, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = waitForTestEmail(context.Background(), inbox, "alice@example.com", map[string]bool{}, 10*time.Millisecond)
+		if err == nil || !strings.Contains(err.Error(), "did not arrive") {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("invalid credentials", func(t *testing.T) {
+		client, server := net.Pipe()
+		serveIMAP(server, [][]string{{}})
+		defer client.Close()
+
+		_, err := openIMAPInbox(client, validationIMAP{Username: "alice", Password: "wrong"})
+		if err == nil || !strings.Contains(err.Error(), "AUTHENTICATIONFAILED") {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestValidateSendTestEmail(t *testing.T) {
+	for name, tc := range map[string]struct {
+		result  string
+		wantErr string
+	}{
+		"sent": {
+			result: `Sent test email to "alice@example.com" successfully! Please check it was received.`,
+		},
+		"failed": {
+			result:  "Failed to send test email: dial tcp: lookup smtp.example.com: no such host",
+			wantErr: "sending test email to alice@example.com failed: Failed to send test email: dial tcp: lookup smtp.example.com: no such host",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				data, _ := json.Marshal(tc.result)
+				w.Write([]byte(`{"data": {"sendTestEmail": ` + string(data) + `}}`))
+			}))
+			defer ts.Close()
+			client := api.NewClient(api.ClientOpts{Endpoint: ts.URL, Out: ioutil.Discard})
+
+			err := validateSendTestEmail(context.Background(), client, validationCheck{To: "alice@example.com"})
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %s", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tc.wantErr {
+				t.Errorf("unexpected error: have %v; want %q", err, tc.wantErr)
+			}
+		})
+	}
+
+	t.Run("no result", func(t *testing.T) {
+		flagSet := flag.NewFlagSet("test", flag.ContinueOnError)
+		apiFlags := api.NewFlags(flagSet)
+		if err := flagSet.Parse([]string{"-get-curl"}); err != nil {
+			t.Fatal(err)
+		}
+		client := api.NewClient(api.ClientOpts{Endpoint: "https://sourcegraph.example.com", Flags: apiFlags, Out: ioutil.Discard})
+
+		if err := validateSendTestEmail(context.Background(), client, validationCheck{To: "alice@example.com"}); errors.Cause(err) != errNoResult {
+			t.Errorf("unexpected error: have %v; want %v", err, errNoResult)
+		}
+	})
+}
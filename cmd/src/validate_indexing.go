@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/src-cli/internal/api"
+)
+
+func init() {
+	validationChecks["repoIndexed"] = validateRepoIndexed
+}
+
+const repoTextSearchIndexQuery = `
+query RepositoryTextSearchIndex($name: String!) {
+	repository(name: $name) {
+		mirrorInfo {
+			cloned
+		}
+		defaultBranch {
+			name
+		}
+		textSearchIndex {
+			refs {
+				ref {
+					name
+				}
+				indexed
+			}
+		}
+	}
+}
+`
+
+// validateRepoIndexed waits until the default branch of a repository is
+// indexed for search. Searches right after a repository was cloned are slow
+// or incomplete until then.
+func validateRepoIndexed(ctx context.Context, client api.Client, check validationCheck) error {
+	if check.Repository == "" {
+		return errors.New(`"repository" is required`)
+	}
+
+	return waitForValidation(ctx, check, func() (bool, string, error) {
+		var result struct {
+			Repository *struct {
+				MirrorInfo      struct{ Cloned bool }
+				DefaultBranch   *struct{ Name string }
+				TextSearchIndex *struct {
+					Refs []struct {
+						Ref     struct{ Name string }
+						Indexed bool
+					}
+				}
+			}
+		}
+		if ok, err := client.NewRequest(repoTextSearchIndexQuery, map[string]interface{}{
+			"name": check.Repository,
+		}).Do(ctx, &result); err != nil || !ok {
+			return false, "", errors.Wrapf(err, "fetching search index status of %s", check.Repository)
+		}
+
+		repo := result.Repository
+		switch {
+		case repo == nil:
+			return false, fmt.Sprintf("repository %s not found", check.Repository), nil
+		case !repo.MirrorInfo.Cloned:
+			return false, fmt.Sprintf("%s is not cloned", check.Repository), nil
+		case repo.DefaultBranch == nil:
+			return false, fmt.Sprintf("%s has no default branch", check.Repository), nil
+		case repo.TextSearchIndex == nil:
+			return false, "", errors.New("indexed search is disabled")
+		}
+		for _, ref := range repo.TextSearchIndex.Refs {
+			if ref.Ref.Name == repo.DefaultBranch.Name && ref.Indexed {
+				return true, "", nil
+			}
+		}
+		return false, fmt.Sprintf("%s of %s is not indexed", repo.DefaultBranch.Name, check.Repository), nil
+	})
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/src-cli/internal/api"
+)
+
+func init() {
+	validationChecks["repoPermissions"] = validateRepoPermissions
+}
+
+const repoAuthorizedUsersQuery = `
+query RepositoryAuthorizedUsers($name: String!, $username: String!, $after: String) {
+	user(username: $username) {
+		id
+	}
+	repository(name: $name) {
+		permissionsInfo {
+			syncedAt
+		}
+		authorizedUsers(first: 1000, after: $after) {
+			nodes {
+				username
+			}
+			pageInfo {
+				endCursor
+				hasNextPage
+			}
+		}
+	}
+}
+`
+
+// validateRepoPermissions checks whether a user can access a repository,
+// according to the permissions synced from the code host. It fails if the
+// user doesn't exist, so that a misspelled username can't pass a check that
+// the user has no access.
+func validateRepoPermissions(ctx context.Context, client api.Client, check validationCheck) error {
+	if check.Username == "" || check.Repository == "" {
+		return errors.New(`"username" and "repository" are required`)
+	}
+	wantAccess := check.Access == nil || *check.Access
+
+	var (
+		after      *string
+		hasAccess  bool
+		syncedOnce bool
+	)
+	for {
+		var result struct {
+			User       *struct{ ID string }
+			Repository *struct {
+				PermissionsInfo *struct{ SyncedAt string }
+				AuthorizedUsers struct {
+					Nodes    []struct{ Username string }
+					PageInfo struct {
+						EndCursor   *string
+						HasNextPage bool
+					}
+				}
+			}
+		}
+		if ok, err := client.NewRequest(repoAuthorizedUsersQuery, map[string]interface{}{
+			"name":     check.Repository,
+			"username": check.Username,
+			"after":    after,
+		}).Do(ctx, &result); err != nil {
+			return errors.Wrapf(err, "fetching authorized users of %s", check.Repository)
+		} else if !ok {
+			return errors.Wrapf(errNoResult, "fetching authorized users of %s", check.Repository)
+		}
+
+		if result.User == nil {
+			return fmt.Errorf("user %s not found", check.Username)
+		}
+
+		repo := result.Repository
+		if repo == nil {
+			return fmt.Errorf("repository %s not found", check.Repository)
+		}
+		if !syncedOnce {
+			if repo.PermissionsInfo == nil || repo.PermissionsInfo.SyncedAt == "" {
+				return fmt.Errorf("permissions of %s have not been synced yet", check.Repository)
+			}
+			syncedOnce = true
+		}
+
+		for _, u := range repo.AuthorizedUsers.Nodes {
+			if u.Username == check.Username {
+				hasAccess = true
+				break
+			}
+		}
+		if hasAccess || !repo.AuthorizedUsers.PageInfo.HasNextPage {
+			break
+		}
+		after = repo.AuthorizedUsers.PageInfo.EndCursor
+	}
+
+	switch {
+	case wantAccess && !hasAccess:
+		return fmt.Errorf("%s can not access %s", check.Username, check.Repository)
+	case !wantAccess && hasAccess:
+		return fmt.Errorf("%s can access %s", check.Username, check.Repository)
+	}
+	return nil
+}
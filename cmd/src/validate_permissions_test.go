@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sourcegraph/src-cli/internal/api"
+)
+
+func TestValidateRepoPermissions(t *testing.T) {
+	pages := map[string]string{
+		"":  `{"nodes": [{"username": "alice"}], "pageInfo": {"endCursor": "1", "hasNextPage": true}}`,
+		"1": `{"nodes": [{"username": "bob"}], "pageInfo": {"endCursor": null, "hasNextPage": false}}`,
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Variables struct {
+				Name, Username string
+				After          *string
+			}
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatal(err)
+		}
+		user := "null"
+		if req.Variables.Username == "alice" || req.Variables.Username == "bob" || req.Variables.Username == "carol" {
+			user = `{"id": "VXNlcjox"}`
+		}
+		repo := "null"
+		switch req.Variables.Name {
+		case "github.com/our-org/private-repo":
+			after := ""
+			if req.Variables.After != nil {
+				after = *req.Variables.After
+			}
+			repo = `{"permissionsInfo": {"syncedAt": "2020-07-01T00:00:00Z"}, "authorizedUsers": ` + pages[after] + `}`
+		case "github.com/our-org/unsynced":
+			repo = `{"permissionsInfo": null, "authorizedUsers": {"nodes": [], "pageInfo": {"hasNextPage": false}}}`
+		}
+		w.Write([]byte(`{"data": {"user": ` + user + `, "repository": ` + repo + `}}`))
+	}))
+	defer ts.Close()
+	client := api.NewClient(api.ClientOpts{Endpoint: ts.URL, Out: ioutil.Discard})
+
+	no := false
+	for name, tc := range map[string]struct {
+		check   validationCheck
+		wantErr string
+	}{
+		"access": {
+			check: validationCheck{Username: "alice", Repository: "github.com/our-org/private-repo"},
+		},
+		"access on the second page": {
+			check: validationCheck{Username: "bob", Repository: "github.com/our-org/private-repo"},
+		},
+		"no access": {
+			check:   validationCheck{Username: "carol", Repository: "github.com/our-org/private-repo"},
+			wantErr: "carol can not access github.com/our-org/private-repo",
+		},
+		"no access expected": {
+			check: validationCheck{Username: "carol", Repository: "github.com/our-org/private-repo", Access: &no},
+		},
+		"unexpected access": {
+			check:   validationCheck{Username: "bob", Repository: "github.com/our-org/private-repo", Access: &no},
+			wantErr: "bob can access github.com/our-org/private-repo",
+		},
+		"misspelled user": {
+			check:   validationCheck{Username: "alcie", Repository: "github.com/our-org/private-repo", Access: &no},
+			wantErr: "user alcie not found",
+		},
+		"missing repository": {
+			check:   validationCheck{Username: "alice", Repository: "github.com/our-org/missing"},
+			wantErr: "repository github.com/our-org/missing not found",
+		},
+		"permissions not synced": {
+			check:   validationCheck{Username: "alice", Repository: "github.com/our-org/unsynced"},
+			wantErr: "permissions of github.com/our-org/unsynced have not been synced yet",
+		},
+		"missing username": {
+			check:   validationCheck{Repository: "github.com/our-org/private-repo"},
+			wantErr: `"username" and "repository" are required`,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			err := validateRepoPermissions(context.Background(), client, tc.check)
+			if (err == nil) != (tc.wantErr == "") || err != nil && err.Error() != tc.wantErr {
+				t.Errorf("unexpected error %v, want %q", err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/src-cli/internal/api"
+)
+
+func init() {
+	validationChecks["assertSettings"] = validateSettings
+}
+
+// validateSettings fetches the site configuration or the global settings and
+// evaluates the assertions of the check against them.
+func validateSettings(ctx context.Context, client api.Client, check validationCheck) error {
+	var contents string
+	switch check.Settings {
+	case "site":
+		var result struct {
+			Site struct {
+				Configuration struct{ EffectiveContents string }
+			}
+		}
+		if ok, err := client.NewQuery(`query SiteConfiguration { site { configuration { effectiveContents } } }`).Do(ctx, &result); err != nil {
+			return errors.Wrap(err, "fetching site configuration")
+		} else if !ok {
+			return errors.Wrap(errNoResult, "fetching site configuration")
+		}
+		contents = result.Site.Configuration.EffectiveContents
+
+	case "global":
+		var result struct {
+			Site struct {
+				LatestSettings *struct{ Contents string }
+			}
+		}
+		if ok, err := client.NewQuery(`query GlobalSettings { site { latestSettings { contents } } }`).Do(ctx, &result); err != nil {
+			return errors.Wrap(err, "fetching global settings")
+		} else if !ok {
+			return errors.Wrap(errNoResult, "fetching global settings")
+		}
+		if result.Site.LatestSettings != nil {
+			contents = result.Site.LatestSettings.Contents
+		}
+
+	default:
+		return fmt.Errorf(`invalid settings %q, must be "site" or "global"`, check.Settings)
+	}
+
+	var settings interface{}
+	if err := jsonxUnmarshal(contents, &settings); err != nil {
+		return errors.Wrapf(err, "parsing %s settings", check.Settings)
+	}
+
+	var failed []string
+	for _, assertion := range check.Assertions {
+		if err := evalSettingsAssertion(settings, assertion); err != nil {
+			failed = append(failed, err.Error())
+		}
+	}
+	if len(failed) > 0 {
+		return errors.New(strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// evalSettingsAssertion evaluates an assertion of the form "PATH", "PATH ==
+// VALUE" or "PATH != VALUE" against settings. VALUE is parsed as JSON and, if
+// that fails, used as a string.
+func evalSettingsAssertion(settings interface{}, assertion string) error {
+	path, op, want := assertion, "", interface{}(nil)
+	for _, o := range []string{"==", "!="} {
+		if i := strings.Index(assertion, o); i >= 0 {
+			path, op = strings.TrimSpace(assertion[:i]), o
+			raw := strings.TrimSpace(assertion[i+len(o):])
+			if err := json.Unmarshal([]byte(raw), &want); err != nil {
+				want = raw
+			}
+			break
+		}
+	}
+	path = strings.TrimSpace(path)
+
+	have, ok := lookupSettingsPath(settings, path)
+	switch op {
+	case "":
+		if !ok {
+			return fmt.Errorf("%s is not set", path)
+		}
+	case "==":
+		if !ok {
+			return fmt.Errorf("%s is not set, want %s", path, formatSettingsValue(want))
+		}
+		if !reflect.DeepEqual(have, want) {
+			return fmt.Errorf("%s is %s, want %s", path, formatSettingsValue(have), formatSettingsValue(want))
+		}
+	case "!=":
+		if ok && reflect.DeepEqual(have, want) {
+			return fmt.Errorf("%s is %s", path, formatSettingsValue(have))
+		}
+	}
+	return nil
+}
+
+// lookupSettingsPath returns the value at the dot-separated path in settings.
+// Since settings keys often contain dots themselves (e.g.
+// "search.index.enabled"), the longest key matching a prefix of the remaining
+// path is used at each level. Array elements are referred to by their index.
+// A leading "$." is ignored.
+func lookupSettingsPath(settings interface{}, path string) (interface{}, bool) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if path == "" {
+		return settings, true
+	}
+	parts := strings.Split(path, ".")
+
+	v := settings
+	for i := 0; i < len(parts); {
+		switch node := v.(type) {
+		case map[string]interface{}:
+			found := false
+			for j := len(parts); j > i; j-- {
+				if child, ok := node[strings.Join(parts[i:j], ".")]; ok {
+					v, i, found = child, j, true
+					break
+				}
+			}
+			if !found {
+				return nil, false
+			}
+		case []interface{}:
+			idx, err := strconv.Atoi(parts[i])
+			if err != nil || idx < 0 || idx >= len(node) {
+				return nil, false
+			}
+			v, i = node[idx], i+1
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+func formatSettingsValue(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
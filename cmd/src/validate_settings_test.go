@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"io/ioutil"
+	"testing"
+
+	"github.com/sourcegraph/src-cli/internal/api"
+)
+
+func TestEvalSettingsAssertion(t *testing.T) {
+	var settings interface{}
+	if err := jsonxUnmarshal(`{
+		"search.index.enabled": true,
+		"externalURL": "https://sourcegraph.example.com",
+		"experimentalFeatures": {"structuralSearch": "enabled"},
+		"auth.providers": [{"type": "builtin", "allowSignup": false}],
+		"maxReposToSearch": 100
+	}`, &settings); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		assertion string
+		wantErr   string
+	}{
+		{assertion: "search.index.enabled == true"},
+		{assertion: "$.search.index.enabled==true"},
+		{assertion: "search.index.enabled == false", wantErr: "search.index.enabled is true, want false"},
+		{assertion: `externalURL != ""`},
+		{assertion: `externalURL == https://sourcegraph.example.com`},
+		{assertion: "experimentalFeatures.structuralSearch == \"enabled\""},
+		{assertion: "auth.providers.0.type == \"builtin\""},
+		{assertion: "auth.providers.1.type", wantErr: "auth.providers.1.type is not set"},
+		{assertion: "maxReposToSearch == 100"},
+		{assertion: "maxReposToSearch != 100", wantErr: "maxReposToSearch is 100"},
+		{assertion: "disableAutoGitUpdates != true"},
+		{assertion: "disableAutoGitUpdates == true", wantErr: "disableAutoGitUpdates is not set, want true"},
+		{assertion: "externalURL"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.assertion, func(t *testing.T) {
+			err := evalSettingsAssertion(settings, tc.assertion)
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %s", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tc.wantErr {
+				t.Errorf("unexpected error: have %v; want %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateSettingsNoResult(t *testing.T) {
+	flagSet := flag.NewFlagSet("test", flag.ContinueOnError)
+	apiFlags := api.NewFlags(flagSet)
+	if err := flagSet.Parse([]string{"-get-curl"}); err != nil {
+		t.Fatal(err)
+	}
+	client := api.NewClient(api.ClientOpts{Endpoint: "https://sourcegraph.example.com", Flags: apiFlags, Out: ioutil.Discard})
+
+	for _, settings := range []string{"site", "global"} {
+		check := validationCheck{Settings: settings, Assertions: []string{"externalURL"}}
+		if err := validateSettings(context.Background(), client, check); err == nil {
+			t.Errorf("no error for %s settings when the request returned no result", settings)
+		}
+	}
+}
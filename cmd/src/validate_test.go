@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sourcegraph/src-cli/internal/api"
+)
+
+func TestWaitForValidation(t *testing.T) {
+	check := validationCheck{Interval: "1ms", Timeout: "50ms"}
+
+	t.Run("condition met", func(t *testing.T) {
+		calls := 0
+		err := waitForValidation(context.Background(), check, func() (bool, string, error) {
+			calls++
+			return calls == 3, "not yet", nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if calls != 3 {
+			t.Errorf("unexpected number of calls: %d", calls)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		err := waitForValidation(context.Background(), check, func() (bool, string, error) {
+			return false, "not yet", nil
+		})
+		if err == nil || !strings.HasPrefix(err.Error(), "not yet after waiting for 50ms") {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		want := errors.New("boom")
+		err := waitForValidation(context.Background(), check, func() (bool, string, error) {
+			return false, "", want
+		})
+		if err != want {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("invalid interval", func(t *testing.T) {
+		err := waitForValidation(context.Background(), validationCheck{Interval: "often"}, func() (bool, string, error) {
+			return true, "", nil
+		})
+		if err == nil {
+			t.Error("unexpected nil error")
+		}
+	})
+}
+
+func TestRunValidationChecksTimeout(t *testing.T) {
+	validationChecks["testWait"] = func(ctx context.Context, client api.Client, check validationCheck) error {
+		if check.Timeout == "" {
+			return nil
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	t.Cleanup(func() { delete(validationChecks, "testWait") })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	checks := []validationCheck{
+		{Type: "testWait"},
+		{Type: "testWait", Timeout: "forever"},
+		{Type: "testWait"},
+		{Type: "testWait"},
+	}
+	err := runValidationChecks(ctx, nil, checks, 10*time.Millisecond)
+	if err == nil || !strings.HasPrefix(err.Error(), "1 of 4 checks failed, 2 were not run") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+
+	"github.com/sourcegraph/src-cli/internal/api"
 )
 
 // buildTag is the git tag at the time of build and is used to
@@ -63,11 +65,12 @@ func getRecommendedVersion() (string, error) {
 	if err != nil {
 		return "", err
 	}
+	api.SetUserAgent(req)
 	for k, v := range cfg.AdditionalHeaders {
 		req.Header.Set(k, v)
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := api.HTTPClient.Do(req)
 	if err != nil {
 		return "", err
 	}
@@ -7,14 +7,15 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"net/http"
 	"os"
+	"regexp"
+	"time"
 
-	"github.com/hashicorp/go-multierror"
 	"github.com/kballard/go-shellquote"
 	"github.com/mattn/go-isatty"
 	"github.com/pkg/errors"
+	"github.com/sourcegraph/src-cli/internal/tracing"
 )
 
 // Client instances provide methods to create API requests.
@@ -33,7 +34,7 @@ type Request interface {
 	// transmitted and the response is unmarshalled into result.
 	//
 	// If no data was available to be unmarshalled — for example, due to the
-	// -get-curl flag being set — then ok will return false.
+	// -get-curl or -explain flag being set — then ok will return false.
 	Do(ctx context.Context, result interface{}) (ok bool, err error)
 
 	// DoRaw has the same behaviour as Do, with one exception: the result will
@@ -46,6 +47,10 @@ type Request interface {
 // client is the internal concrete type implementing Client.
 type client struct {
 	opts ClientOpts
+
+	// requestCompressionUnsupported is set to 1, atomically, once the
+	// instance rejected a compressed request body as unsupported.
+	requestCompressionUnsupported int32
 }
 
 // request is the internal concrete type implementing Request.
@@ -61,6 +66,19 @@ type ClientOpts struct {
 	AccessToken       string
 	AdditionalHeaders map[string]string
 
+	// ImpersonateUser is the username of the user the requests are performed
+	// as, if not empty. AccessToken must be the token of a site admin with
+	// the site-admin:sudo scope.
+	ImpersonateUser string
+
+	// CompressRequests enables the gzip compression of large request bodies.
+	// Not all instances support it, so it must be enabled explicitly.
+	CompressRequests bool
+
+	// UserAgent is sent as the User-Agent header. If empty, the value of the
+	// package variable UserAgent is used.
+	UserAgent string
+
 	// Flags are the standard API client flags provided by NewFlags. If nil,
 	// default values will be used.
 	Flags *Flags
@@ -68,6 +86,24 @@ type ClientOpts struct {
 	// Out is the writer that will be used when outputting diagnostics, such as
 	// curl commands when -get-curl is enabled.
 	Out io.Writer
+
+	// Observe, if set, is invoked after each request to the GraphQL API has
+	// completed, whether it succeeded or not.
+	Observe func(RequestEvent)
+}
+
+// RequestEvent describes a single request made to the GraphQL API.
+type RequestEvent struct {
+	Query string
+	// Operation is the name of the GraphQL operation, or empty if the query
+	// is anonymous.
+	Operation string
+	Duration  time.Duration
+	Err       error
+	// RequestBytes and ResponseBytes are the sizes of the bodies of the
+	// request and the response, if it was received.
+	RequestBytes  int64
+	ResponseBytes int64
 }
 
 // NewClient creates a new API client.
@@ -86,8 +122,12 @@ func NewClient(opts ClientOpts) Client {
 			Endpoint:          opts.Endpoint,
 			AccessToken:       opts.AccessToken,
 			AdditionalHeaders: opts.AdditionalHeaders,
+			ImpersonateUser:   opts.ImpersonateUser,
+			CompressRequests:  opts.CompressRequests,
+			UserAgent:         opts.UserAgent,
 			Flags:             flags,
 			Out:               opts.Out,
+			Observe:           opts.Observe,
 		},
 	}
 }
@@ -108,7 +148,7 @@ func (c *client) url() string {
 	return c.opts.Endpoint + "/.api/graphql"
 }
 
-func (r *request) do(ctx context.Context, result interface{}) (bool, error) {
+func (r *request) do(ctx context.Context, result interface{}) (ok bool, err error) {
 	if *r.client.opts.Flags.getCurl {
 		curl, err := r.curlCmd()
 		if err != nil {
@@ -117,67 +157,164 @@ func (r *request) do(ctx context.Context, result interface{}) (bool, error) {
 		r.client.opts.Out.Write([]byte(curl + "\n"))
 		return false, nil
 	}
+	if *r.client.opts.Flags.explain {
+		return false, r.explain()
+	}
 
-	// Create the JSON object.
-	reqBody, err := json.Marshal(map[string]interface{}{
-		"query":     r.query,
-		"variables": r.vars,
-	})
-	if err != nil {
-		return false, err
+	span, ctx := tracing.StartSpan(ctx, "GraphQL request")
+	span.SetAttribute("graphql.operation.name", operationName(r.query))
+	defer func() { span.Finish(err) }()
+
+	var reqBytes, respBytes int64
+	if observe := r.client.opts.Observe; observe != nil {
+		start := time.Now()
+		defer func() {
+			observe(RequestEvent{
+				Query:         r.query,
+				Operation:     operationName(r.query),
+				Duration:      time.Since(start),
+				Err:           err,
+				RequestBytes:  reqBytes,
+				ResponseBytes: respBytes,
+			})
+		}()
 	}
 
-	// Create the HTTP request.
-	req, err := http.NewRequestWithContext(ctx, "POST", r.client.url(), bytes.NewBuffer(reqBody))
+	reqBody, err := r.marshal()
 	if err != nil {
 		return false, err
 	}
-	if r.client.opts.AccessToken != "" {
-		req.Header.Set("Authorization", "token "+r.client.opts.AccessToken)
+	reqBytes = int64(len(reqBody))
+
+	if dir := *r.client.opts.Flags.replay; dir != "" {
+		statusCode, body, err := replayInteraction(dir, r.query, r.vars)
+		if err != nil {
+			return false, err
+		}
+		return r.decodeResponse(statusCode, fmt.Sprintf("%d %s", statusCode, http.StatusText(statusCode)), body, result)
 	}
-	if *r.client.opts.Flags.trace {
-		req.Header.Set("X-Sourcegraph-Should-Trace", "true")
+
+	// Create and perform the HTTP request. Large bodies are compressed if
+	// enabled. If the instance rejects the compressed body as unsupported,
+	// the request wasn't processed and is retried uncompressed.
+	sendBody, compress := reqBody, r.client.shouldCompressRequest(len(reqBody))
+	if compress {
+		if sendBody, err = gzipBody(reqBody); err != nil {
+			return false, errors.Wrap(err, "compressing request")
+		}
+		reqBytes = int64(len(sendBody))
 	}
-	for k, v := range r.client.opts.AdditionalHeaders {
-		req.Header.Set(k, v)
+	resp, err := r.send(ctx, sendBody, compress)
+	if err == nil && compress && r.client.rejectsCompressedRequest(resp) {
+		resp.Body.Close()
+		reqBytes = int64(len(reqBody))
+		resp, err = r.send(ctx, reqBody, false)
 	}
-
-	// Perform the request.
-	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return false, err
+		return false, &NetworkError{Err: err}
 	}
 	defer resp.Body.Close()
 
+	span.SetAttribute("http.status_code", resp.StatusCode)
+
 	// Check trace header before we potentially early exit
 	if *r.client.opts.Flags.trace {
 		r.client.opts.Out.Write([]byte(fmt.Sprintf("x-trace: %s\n", resp.Header.Get("x-trace"))))
 	}
 
-	// Our request may have failed before reaching the GraphQL endpoint, so
-	// confirm the status code. You can test this easily with e.g. an invalid
-	// endpoint like -endpoint=https://google.com
-	if resp.StatusCode != http.StatusOK {
-		if resp.StatusCode == http.StatusUnauthorized && isatty.IsCygwinTerminal(os.Stdout.Fd()) {
-			fmt.Println("You may need to specify or update your access token to use this endpoint.")
-			fmt.Println("See https://github.com/sourcegraph/src-cli#authentication")
-			fmt.Println("")
+	if resp.StatusCode == http.StatusUnauthorized && isatty.IsCygwinTerminal(os.Stdout.Fd()) {
+		fmt.Println("You may need to specify or update your access token to use this endpoint.")
+		fmt.Println("See https://github.com/sourcegraph/src-cli#authentication")
+		fmt.Println("")
+	}
+
+	body, received, err := readResponseBody(resp)
+	respBytes = received
+	if err != nil {
+		return false, err
+	}
+	if dir := *r.client.opts.Flags.record; dir != "" {
+		if err := recordInteraction(dir, r.query, r.vars, resp.StatusCode, body); err != nil {
+			return false, errors.Wrap(err, "recording response")
 		}
-		body, err := ioutil.ReadAll(resp.Body)
+	}
+	return r.decodeResponse(resp.StatusCode, resp.Status, body, result)
+}
+
+// marshal returns the JSON body of the request.
+func (r *request) marshal() ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"query":     r.query,
+		"variables": r.vars,
+	})
+}
+
+// send performs the HTTP request with the given body, which is gzip
+// compressed if compressed is true, waiting for the instance to be available.
+// Only queries are retried if it isn't, not mutations.
+func (r *request) send(ctx context.Context, body []byte, compressed bool) (*http.Response, error) {
+	return DoWhenAvailable(ctx, !isMutation(r.query), func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", r.client.url(), bytes.NewReader(body))
 		if err != nil {
-			return false, err
+			return nil, err
+		}
+		if r.client.opts.UserAgent != "" {
+			req.Header.Set("User-Agent", r.client.opts.UserAgent)
+		} else {
+			SetUserAgent(req)
+		}
+		if r.client.opts.AccessToken != "" {
+			req.Header.Set("Authorization", Authorization(r.client.opts.AccessToken, r.client.opts.ImpersonateUser))
 		}
-		return false, fmt.Errorf("error: %s\n\n%s", resp.Status, body)
+		if *r.client.opts.Flags.trace {
+			req.Header.Set("X-Sourcegraph-Should-Trace", "true")
+		}
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+		if compressed {
+			req.Header.Set("Content-Encoding", "gzip")
+		}
+		for k, v := range r.client.opts.AdditionalHeaders {
+			req.Header.Set(k, v)
+		}
+		return req, nil
+	})
+}
+
+// decodeResponse unmarshals the body of a response into result, or returns an
+// HTTPError if the status code isn't 200.
+func (r *request) decodeResponse(statusCode int, status string, body []byte, result interface{}) (bool, error) {
+	// Our request may have failed before reaching the GraphQL endpoint, so
+	// confirm the status code. You can test this easily with e.g. an invalid
+	// endpoint like -endpoint=https://google.com
+	if statusCode != http.StatusOK {
+		return false, &HTTPError{StatusCode: statusCode, Status: status, Body: body}
 	}
 
-	// Decode the response.
-	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+	if err := json.Unmarshal(body, result); err != nil {
 		return false, err
 	}
-
 	return true, nil
 }
 
+var operationNameRegexp = regexp.MustCompile(`^\s*(?:query|mutation|subscription)\s+(\w+)`)
+
+var mutationRegexp = regexp.MustCompile(`^(?:\s|,|#[^\n]*(?:\n|$))*mutation\b`)
+
+// isMutation reports whether query is a mutation, which must not be sent
+// again if it may have been processed already.
+func isMutation(query string) bool {
+	return mutationRegexp.MatchString(query)
+}
+
+// operationName returns the name of the GraphQL operation in query, or an
+// empty string if the operation is anonymous.
+func operationName(query string) string {
+	if m := operationNameRegexp.FindStringSubmatch(query); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
 func (r *request) Do(ctx context.Context, result interface{}) (bool, error) {
 	raw := rawResult{Data: result}
 	ok, err := r.do(ctx, &raw)
@@ -189,11 +326,11 @@ func (r *request) Do(ctx context.Context, result interface{}) (bool, error) {
 
 	// Handle the case of unpacking errors.
 	if raw.Errors != nil {
-		var errs *multierror.Error
-		for _, err := range raw.Errors {
-			errs = multierror.Append(errs, &graphqlError{err})
+		errs := make(GraphQLErrors, len(raw.Errors))
+		for i, err := range raw.Errors {
+			errs[i] = newGraphQLError(err)
 		}
-		return false, errors.Wrap(errs, "GraphQL errors")
+		return false, errs
 	}
 	return true, nil
 }
@@ -208,17 +345,14 @@ type rawResult struct {
 }
 
 func (r *request) curlCmd() (string, error) {
-	data, err := json.Marshal(map[string]interface{}{
-		"query":     r.query,
-		"variables": r.vars,
-	})
+	data, err := r.marshal()
 	if err != nil {
 		return "", err
 	}
 
 	s := "curl \\\n"
 	if r.client.opts.AccessToken != "" {
-		s += fmt.Sprintf("   %s \\\n", shellquote.Join("-H", "Authorization: token "+r.client.opts.AccessToken))
+		s += fmt.Sprintf("   %s \\\n", shellquote.Join("-H", "Authorization: "+Authorization(r.client.opts.AccessToken, r.client.opts.ImpersonateUser)))
 	}
 	for k, v := range r.client.opts.AdditionalHeaders {
 		s += fmt.Sprintf("   %s \\\n", shellquote.Join("-H", k+": "+v))
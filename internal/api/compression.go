@@ -0,0 +1,93 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+// compressRequestThreshold is the size of request bodies from which they are
+// gzip compressed, if ClientOpts.CompressRequests is set. Smaller bodies, i.e. most queries, don't benefit, whereas
+// the diffs in patches and changeset specs compress extremely well.
+const compressRequestThreshold = 1024
+
+// acceptEncoding is sent as the Accept-Encoding header of all requests.
+// Setting it explicitly disables the transparent decompression of
+// net/http, so that readResponseBody can count the bytes received.
+const acceptEncoding = "gzip, deflate"
+
+// gzipBody returns the gzip compressed body.
+func gzipBody(body []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(body); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// shouldCompressRequest reports whether a request body of the given size is
+// to be compressed.
+func (c *client) shouldCompressRequest(size int) bool {
+	return c.opts.CompressRequests && size >= compressRequestThreshold && atomic.LoadInt32(&c.requestCompressionUnsupported) == 0
+}
+
+// rejectsCompressedRequest reports whether the response to a compressed
+// request is 415 Unsupported Media Type, i.e. the instance didn't process the
+// request because it doesn't support compressed request bodies. If it is,
+// compression is disabled for later requests of the client. Other errors,
+// including 400 Bad Request, may come from a request that was processed and
+// are never retried, as the request may be a mutation.
+func (c *client) rejectsCompressedRequest(resp *http.Response) bool {
+	if resp.StatusCode != http.StatusUnsupportedMediaType {
+		return false
+	}
+	atomic.StoreInt32(&c.requestCompressionUnsupported, 1)
+	return true
+}
+
+// readResponseBody reads the decompressed body of resp, according to its
+// Content-Encoding, and returns it along with the number of bytes received.
+func readResponseBody(resp *http.Response) (body []byte, received int64, err error) {
+	counter := &countingReader{r: resp.Body}
+	var r io.Reader = counter
+	switch resp.Header.Get("Content-Encoding") {
+	case "gzip":
+		gr, err := gzip.NewReader(counter)
+		if err != nil {
+			return nil, counter.n, errors.Wrap(err, "decompressing response")
+		}
+		defer gr.Close()
+		r = gr
+	case "deflate":
+		zr, err := zlib.NewReader(counter)
+		if err != nil {
+			return nil, counter.n, errors.Wrap(err, "decompressing response")
+		}
+		defer zr.Close()
+		r = zr
+	}
+	body, err = ioutil.ReadAll(r)
+	return body, counter.n, err
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
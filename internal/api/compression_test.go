@@ -0,0 +1,122 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestClientCompression(t *testing.T) {
+	diff := strings.Repeat("+a line of a diff\n", 1000)
+
+	for name, tc := range map[string]struct {
+		query            string
+		vars             map[string]interface{}
+		disabled         bool
+		rejectCompressed int
+		wantEncodings    []string
+		wantErr          bool
+	}{
+		"small request": {
+			query:         `query { site { id } }`,
+			wantEncodings: []string{"", ""},
+		},
+		"large request": {
+			query:         `mutation CreatePatchSet($diff: String!) { createPatchSet(diff: $diff) { id } }`,
+			vars:          map[string]interface{}{"diff": diff},
+			wantEncodings: []string{"gzip", "gzip"},
+		},
+		"compression disabled": {
+			query:         `mutation CreatePatchSet($diff: String!) { createPatchSet(diff: $diff) { id } }`,
+			vars:          map[string]interface{}{"diff": diff},
+			disabled:      true,
+			wantEncodings: []string{"", ""},
+		},
+		"compression unsupported": {
+			query:            `mutation CreatePatchSet($diff: String!) { createPatchSet(diff: $diff) { id } }`,
+			vars:             map[string]interface{}{"diff": diff},
+			rejectCompressed: http.StatusUnsupportedMediaType,
+			// The first request is retried uncompressed, the second request
+			// isn't compressed anymore.
+			wantEncodings: []string{"gzip", "", ""},
+		},
+		"bad request": {
+			query:            `mutation CreatePatchSet($diff: String!) { createPatchSet(diff: $diff) { id } }`,
+			vars:             map[string]interface{}{"diff": diff},
+			rejectCompressed: http.StatusBadRequest,
+			// The request may have been processed, so it isn't retried.
+			wantEncodings: []string{"gzip"},
+			wantErr:       true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var encodings []string
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				encoding := r.Header.Get("Content-Encoding")
+				encodings = append(encodings, encoding)
+				if encoding == "gzip" && tc.rejectCompressed != 0 {
+					http.Error(w, "unsupported Content-Encoding", tc.rejectCompressed)
+					return
+				}
+
+				var body io.Reader = r.Body
+				if encoding == "gzip" {
+					gr, err := gzip.NewReader(r.Body)
+					if err != nil {
+						t.Errorf("invalid gzip body: %v", err)
+						return
+					}
+					body = gr
+				}
+				var req struct {
+					Variables map[string]interface{} `json:"variables"`
+				}
+				if err := json.NewDecoder(body).Decode(&req); err != nil {
+					t.Errorf("invalid request body: %v", err)
+				}
+				if diff := cmp.Diff(tc.vars, req.Variables); diff != "" {
+					t.Errorf("unexpected variables (-want +have):\n%s", diff)
+				}
+
+				if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+					w.Write([]byte(`{"data": {"id": "x"}}`))
+					return
+				}
+				w.Header().Set("Content-Encoding", "gzip")
+				gw := gzip.NewWriter(w)
+				gw.Write([]byte(`{"data": {"id": "x"}}`))
+				gw.Close()
+			}))
+			defer ts.Close()
+
+			client := NewClient(ClientOpts{Endpoint: ts.URL, CompressRequests: !tc.disabled, Out: &bytes.Buffer{}})
+			for i := 0; i < 2; i++ {
+				var result struct{ ID string }
+				_, err := client.NewRequest(tc.query, tc.vars).Do(context.Background(), &result)
+				if tc.wantErr {
+					if err == nil {
+						t.Error("no error")
+					}
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if result.ID != "x" {
+					t.Errorf("unexpected result %+v", result)
+				}
+			}
+			if diff := cmp.Diff(tc.wantEncodings, encodings); diff != "" {
+				t.Errorf("unexpected request encodings (-want +have):\n%s", diff)
+			}
+		})
+	}
+}
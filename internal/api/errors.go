@@ -1,11 +1,167 @@
 package api
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
 
-// graphqlError wraps a raw JSON error returned from a GraphQL endpoint.
-type graphqlError struct{ v interface{} }
+// GraphQLErrorKind classifies GraphQL errors that commands handle
+// differently, e.g. with distinct exit codes.
+type GraphQLErrorKind string
 
-func (g *graphqlError) Error() string {
-	j, _ := json.MarshalIndent(g.v, "", "  ")
-	return string(j)
+const (
+	GraphQLErrorUnknown         GraphQLErrorKind = ""
+	GraphQLErrorUnauthorized    GraphQLErrorKind = "unauthorized"
+	GraphQLErrorNotFound        GraphQLErrorKind = "not_found"
+	GraphQLErrorRateLimited     GraphQLErrorKind = "rate_limited"
+	GraphQLErrorLicenseRequired GraphQLErrorKind = "license_required"
+)
+
+// graphqlErrorKinds maps the codes in the extensions of GraphQL errors, in
+// lower case, to their kind. Older instances don't set codes, so the
+// messages are matched against graphqlErrorMessages as well.
+var graphqlErrorKinds = map[string]GraphQLErrorKind{
+	"unauthorized":        GraphQLErrorUnauthorized,
+	"unauthenticated":     GraphQLErrorUnauthorized,
+	"forbidden":           GraphQLErrorUnauthorized,
+	"errnotauthenticated": GraphQLErrorUnauthorized,
+	"not_found":           GraphQLErrorNotFound,
+	"notfound":            GraphQLErrorNotFound,
+	"errnotfound":         GraphQLErrorNotFound,
+	"rate_limited":        GraphQLErrorRateLimited,
+	"ratelimited":         GraphQLErrorRateLimited,
+	"license_required":    GraphQLErrorLicenseRequired,
+	"errcampaignslicense": GraphQLErrorLicenseRequired,
+}
+
+var graphqlErrorMessages = []struct {
+	kind GraphQLErrorKind
+	re   *regexp.Regexp
+}{
+	{GraphQLErrorUnauthorized, regexp.MustCompile(`(?i)must be (?:authenticated|site admin)|not authenticated|permission denied|unauthorized`)},
+	{GraphQLErrorNotFound, regexp.MustCompile(`(?i)\bnot found\b`)},
+	{GraphQLErrorRateLimited, regexp.MustCompile(`(?i)rate limit`)},
+	{GraphQLErrorLicenseRequired, regexp.MustCompile(`(?i)\blicen[cs]e\b`)},
+}
+
+// graphqlErrorHints are appended to the messages of errors of a kind.
+var graphqlErrorHints = map[GraphQLErrorKind]string{
+	GraphQLErrorUnauthorized:    "Check that the access token is valid and that its user has the required permissions.",
+	GraphQLErrorRateLimited:     "Wait a moment before trying again.",
+	GraphQLErrorLicenseRequired: "This feature requires a Sourcegraph license that includes it.",
+}
+
+// GraphQLError is a single error returned from a GraphQL endpoint.
+type GraphQLError struct {
+	Message    string                 `json:"message"`
+	Path       []interface{}          `json:"path,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+// newGraphQLError decodes a raw JSON error. Errors that don't have the
+// expected shape keep their JSON representation as message.
+func newGraphQLError(v interface{}) *GraphQLError {
+	data, _ := json.Marshal(v)
+	var e GraphQLError
+	if err := json.Unmarshal(data, &e); err != nil || e.Message == "" {
+		indented, _ := json.MarshalIndent(v, "", "  ")
+		return &GraphQLError{Message: string(indented)}
+	}
+	return &e
+}
+
+// Code returns the code in the extensions of the error, if any.
+func (e *GraphQLError) Code() string {
+	code, _ := e.Extensions["code"].(string)
+	return code
+}
+
+// Kind classifies the error by its code or, if it has none, its message.
+func (e *GraphQLError) Kind() GraphQLErrorKind {
+	if code := e.Code(); code != "" {
+		if kind, ok := graphqlErrorKinds[strings.ToLower(code)]; ok {
+			return kind
+		}
+	}
+	for _, m := range graphqlErrorMessages {
+		if m.re.MatchString(e.Message) {
+			return m.kind
+		}
+	}
+	return GraphQLErrorUnknown
+}
+
+func (e *GraphQLError) Error() string {
+	msg := e.Message
+	if len(e.Path) > 0 {
+		path := make([]string, len(e.Path))
+		for i, p := range e.Path {
+			path[i] = fmt.Sprint(p)
+		}
+		msg += fmt.Sprintf(" (at %s)", strings.Join(path, "."))
+	}
+	if hint, ok := graphqlErrorHints[e.Kind()]; ok {
+		msg += ". " + hint
+	}
+	return msg
 }
+
+// GraphQLErrors are the errors returned from a GraphQL endpoint for a
+// request.
+type GraphQLErrors []*GraphQLError
+
+func (es GraphQLErrors) Error() string {
+	if len(es) == 1 {
+		return "GraphQL error: " + es[0].Error()
+	}
+	msgs := make([]string, len(es))
+	for i, e := range es {
+		msgs[i] = "\t- " + e.Error()
+	}
+	return fmt.Sprintf("%d GraphQL errors:\n%s", len(es), strings.Join(msgs, "\n"))
+}
+
+// Kind returns the kind of the errors, if all of them have the same kind.
+func (es GraphQLErrors) Kind() GraphQLErrorKind {
+	if len(es) == 0 {
+		return GraphQLErrorUnknown
+	}
+	kind := es[0].Kind()
+	for _, e := range es[1:] {
+		if e.Kind() != kind {
+			return GraphQLErrorUnknown
+		}
+	}
+	return kind
+}
+
+// HTTPError is returned when the Sourcegraph instance responds with a status
+// other than 200 OK, which means the request never reached the GraphQL
+// endpoint.
+type HTTPError struct {
+	StatusCode int
+	Status     string
+	Body       []byte
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("error: %s\n\n%s", e.Status, e.Body)
+}
+
+// Unauthorized returns true if the request was rejected because of missing
+// or invalid credentials.
+func (e *HTTPError) Unauthorized() bool {
+	return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+}
+
+// NetworkError is returned when the Sourcegraph instance could not be
+// reached at all.
+type NetworkError struct {
+	Err error
+}
+
+func (e *NetworkError) Error() string { return e.Err.Error() }
+func (e *NetworkError) Unwrap() error { return e.Err }
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestGraphQLErrors(t *testing.T) {
+	tests := map[string]struct {
+		raw      string
+		wantMsg  string
+		wantKind GraphQLErrorKind
+	}{
+		"message and path": {
+			raw:     `[{"message": "syntax error", "path": ["campaign", "changesets", 0]}]`,
+			wantMsg: "GraphQL error: syntax error (at campaign.changesets.0)",
+		},
+		"code": {
+			raw:      `[{"message": "you are not allowed to do this", "extensions": {"code": "UNAUTHORIZED"}}]`,
+			wantMsg:  "GraphQL error: you are not allowed to do this. Check that the access token is valid and that its user has the required permissions.",
+			wantKind: GraphQLErrorUnauthorized,
+		},
+		"message without code": {
+			raw:      `[{"message": "campaigns are not available without a license"}]`,
+			wantMsg:  "GraphQL error: campaigns are not available without a license. This feature requires a Sourcegraph license that includes it.",
+			wantKind: GraphQLErrorLicenseRequired,
+		},
+		"multiple errors": {
+			raw:      `[{"message": "repository not found"}, {"message": "user not found"}]`,
+			wantMsg:  "2 GraphQL errors:\n\t- repository not found\n\t- user not found",
+			wantKind: GraphQLErrorNotFound,
+		},
+		"unexpected shape": {
+			raw:     `["boom"]`,
+			wantMsg: `GraphQL error: "boom"`,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var raw []interface{}
+			if err := json.Unmarshal([]byte(tc.raw), &raw); err != nil {
+				t.Fatal(err)
+			}
+			errs := make(GraphQLErrors, len(raw))
+			for i, v := range raw {
+				errs[i] = newGraphQLError(v)
+			}
+
+			if have := errs.Error(); have != tc.wantMsg {
+				t.Errorf("unexpected message:\nhave %q\nwant %q", have, tc.wantMsg)
+			}
+			if have := errs.Kind(); have != tc.wantKind {
+				t.Errorf("unexpected kind: have %q; want %q", have, tc.wantKind)
+			}
+		})
+	}
+}
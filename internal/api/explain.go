@@ -0,0 +1,53 @@
+package api
+
+import (
+	"encoding/json"
+	"regexp"
+)
+
+// OperationExplanation describes a GraphQL operation without its selection
+// set, as printed by -explain.
+type OperationExplanation struct {
+	Name      string                `json:"name"`
+	Type      string                `json:"type"`
+	Variables []VariableDescription `json:"variables"`
+}
+
+// VariableDescription is a variable declared by a GraphQL operation.
+type VariableDescription struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+var (
+	// operationDefinitionRegexp matches the definition of an operation,
+	// which may be preceded by fragments.
+	operationDefinitionRegexp = regexp.MustCompile(`(?m)^\s*(query|mutation|subscription)\b\s*(\w*)\s*(?:\(([^)]*)\))?`)
+	variableDefinitionRegexp  = regexp.MustCompile(`\$(\w+)\s*:\s*([\w\[\]!]+)`)
+)
+
+// explainOperation returns the name, type and declared variables of the
+// operation in query. A query without an operation definition is an
+// anonymous query.
+func explainOperation(query string) OperationExplanation {
+	e := OperationExplanation{Type: "query", Variables: []VariableDescription{}}
+	m := operationDefinitionRegexp.FindStringSubmatch(query)
+	if m == nil {
+		return e
+	}
+	e.Type, e.Name = m[1], m[2]
+	for _, v := range variableDefinitionRegexp.FindAllStringSubmatch(m[3], -1) {
+		e.Variables = append(e.Variables, VariableDescription{Name: v[1], Type: v[2]})
+	}
+	return e
+}
+
+// explain writes the explanation of the request as a line of JSON.
+func (r *request) explain() error {
+	data, err := json.Marshal(explainOperation(r.query))
+	if err != nil {
+		return err
+	}
+	_, err = r.client.opts.Out.Write(append(data, '\n'))
+	return err
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestExplainOperation(t *testing.T) {
+	tests := map[string]struct {
+		query string
+		want  OperationExplanation
+	}{
+		"anonymous": {
+			query: `{ currentUser { username } }`,
+			want:  OperationExplanation{Type: "query", Variables: []VariableDescription{}},
+		},
+		"named without variables": {
+			query: `query CurrentUser { currentUser { username } }`,
+			want:  OperationExplanation{Name: "CurrentUser", Type: "query", Variables: []VariableDescription{}},
+		},
+		"mutation with variables": {
+			query: `
+mutation CloseChangesets($campaign: ID!, $changesets: [ID!]!, $squash: Boolean = false) {
+	closeChangesets(campaign: $campaign, changesets: $changesets) { id }
+}`,
+			want: OperationExplanation{
+				Name: "CloseChangesets",
+				Type: "mutation",
+				Variables: []VariableDescription{
+					{Name: "campaign", Type: "ID!"},
+					{Name: "changesets", Type: "[ID!]!"},
+					{Name: "squash", Type: "Boolean"},
+				},
+			},
+		},
+		"preceded by fragment": {
+			query: `
+fragment campaign on Campaign { id }
+
+query Campaigns(
+	$first: Int
+) {
+	campaigns(first: $first) { nodes { ...campaign } }
+}`,
+			want: OperationExplanation{
+				Name:      "Campaigns",
+				Type:      "query",
+				Variables: []VariableDescription{{Name: "first", Type: "Int"}},
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.want, explainOperation(tc.query)); diff != "" {
+				t.Errorf("unexpected explanation (-want +have):\n%s", diff)
+			}
+		})
+	}
+}
@@ -6,7 +6,10 @@ import "flag"
 // that issue API requests.
 type Flags struct {
 	getCurl *bool
+	explain *bool
 	trace   *bool
+	record  *string
+	replay  *string
 }
 
 // NewFlags instantiates a new Flags structure and attaches flags to the given
@@ -14,14 +17,21 @@ type Flags struct {
 func NewFlags(flagSet *flag.FlagSet) *Flags {
 	return &Flags{
 		getCurl: flagSet.Bool("get-curl", false, "Print the curl command for executing this query and exit (WARNING: includes printing your access token!)"),
+		explain: flagSet.Bool("explain", false, "Print the name, type and variable types of the GraphQL operation as JSON instead of executing it and exit, e.g. to audit the operations a command uses."),
 		trace:   flagSet.Bool("trace", false, "Log the trace ID for requests. See https://docs.sourcegraph.com/admin/observability/tracing"),
+		record:  flagSet.String("record", "", "Record the GraphQL requests and their responses as files in the given directory, e.g. for a bug report. Access tokens are not recorded, but query variables and responses are."),
+		replay:  flagSet.String("replay", "", "Replay the responses recorded with -record in the given directory instead of sending requests."),
 	}
 }
 
 func defaultFlags() *Flags {
 	d := false
+	s := ""
 	return &Flags{
 		getCurl: &d,
+		explain: &d,
 		trace:   &d,
+		record:  &s,
+		replay:  &s,
 	}
 }
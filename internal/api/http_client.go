@@ -0,0 +1,71 @@
+package api
+
+import (
+	"net"
+	"net/http"
+	"time"
+)
+
+// HTTPClientOpts configures the HTTP client that is shared by all requests to
+// the Sourcegraph instance and code hosts, see ConfigureHTTPClient.
+type HTTPClientOpts struct {
+	// DialTimeout limits how long establishing a connection may take.
+	DialTimeout time.Duration
+	// TLSHandshakeTimeout limits how long the TLS handshake may take.
+	TLSHandshakeTimeout time.Duration
+	// ResponseHeaderTimeout limits how long to wait for the headers of a
+	// response once the request was sent. 0 means no limit.
+	ResponseHeaderTimeout time.Duration
+	// MaxIdleConnsPerHost is the number of idle connections kept per host to
+	// be reused by later requests.
+	MaxIdleConnsPerHost int
+}
+
+// DefaultHTTPClientOpts are the options of HTTPClient unless
+// ConfigureHTTPClient is called. Responses to GraphQL requests, e.g. of
+// searches, can take minutes, so the response header timeout is generous.
+var DefaultHTTPClientOpts = HTTPClientOpts{
+	DialTimeout:           30 * time.Second,
+	TLSHandshakeTimeout:   10 * time.Second,
+	ResponseHeaderTimeout: 10 * time.Minute,
+	MaxIdleConnsPerHost:   100,
+}
+
+// HTTPClient is the client used for all requests to the Sourcegraph instance
+// and code hosts. Unlike http.DefaultClient, it keeps enough idle connections
+// for hundreds of concurrent requests to the same host, e.g. archive
+// downloads, to reuse connections instead of exhausting ephemeral ports, and
+// it gives up on connections that hang.
+var HTTPClient = NewHTTPClient(DefaultHTTPClientOpts)
+
+// ConfigureHTTPClient replaces HTTPClient with a client with the given
+// options. It must be called before any request is made.
+func ConfigureHTTPClient(opts HTTPClientOpts) {
+	HTTPClient = NewHTTPClient(opts)
+}
+
+// NewHTTPClient returns an HTTP client with the given options that, like
+// http.DefaultClient, uses the proxy from the environment and HTTP/2 if the
+// server supports it.
+func NewHTTPClient(opts HTTPClientOpts) *http.Client {
+	maxIdleConns := 100
+	if opts.MaxIdleConnsPerHost > maxIdleConns {
+		maxIdleConns = opts.MaxIdleConnsPerHost
+	}
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   opts.DialTimeout,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			ForceAttemptHTTP2:     true,
+			MaxIdleConns:          maxIdleConns,
+			MaxIdleConnsPerHost:   opts.MaxIdleConnsPerHost,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   opts.TLSHandshakeTimeout,
+			ResponseHeaderTimeout: opts.ResponseHeaderTimeout,
+			ExpectContinueTimeout: time.Second,
+		},
+	}
+}
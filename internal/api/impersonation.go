@@ -0,0 +1,30 @@
+package api
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// usernameRegexp matches the usernames Sourcegraph allows.
+var usernameRegexp = regexp.MustCompile(`^[a-zA-Z0-9](?:[a-zA-Z0-9.-]*[a-zA-Z0-9])?$`)
+
+// ValidateImpersonatedUser returns an error if username can't be the user
+// impersonated by ClientOpts.ImpersonateUser.
+func ValidateImpersonatedUser(username string) error {
+	if username != "" && !usernameRegexp.MatchString(username) {
+		return fmt.Errorf("invalid username %q: may only contain letters, digits, . and -, and must start and end with a letter or digit", username)
+	}
+	return nil
+}
+
+// Authorization returns the Authorization header for the access token. If
+// user isn't empty, the header asks Sourcegraph to perform the request as
+// that user, which requires a site admin token with the site-admin:sudo
+// scope. Requests that aren't sent through a Client, e.g. archive downloads,
+// use it too, so that they are performed as the same user.
+func Authorization(accessToken, user string) string {
+	if user == "" {
+		return "token " + accessToken
+	}
+	return fmt.Sprintf(`token-sudo user=%q,token=%q`, user, accessToken)
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestValidateImpersonatedUser(t *testing.T) {
+	for username, valid := range map[string]bool{
+		"":             true,
+		"alice":        true,
+		"service-bot":  true,
+		"first.last1":  true,
+		"-leading":     false,
+		"trailing.":    false,
+		`quote"`:       false,
+		"two words":    false,
+		"comma,token=": false,
+	} {
+		if err := ValidateImpersonatedUser(username); (err == nil) != valid {
+			t.Errorf("ValidateImpersonatedUser(%q) = %v, want valid %v", username, err, valid)
+		}
+	}
+}
+
+func TestClientImpersonation(t *testing.T) {
+	var have string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		have = r.Header.Get("Authorization")
+		w.Write([]byte(`{"data": {}}`))
+	}))
+	defer ts.Close()
+
+	for _, tc := range []struct {
+		name string
+		opts ClientOpts
+		want string
+	}{
+		{name: "no token", want: ""},
+		{name: "token", opts: ClientOpts{AccessToken: "abc"}, want: "token abc"},
+		{name: "impersonation", opts: ClientOpts{AccessToken: "abc", ImpersonateUser: "alice"}, want: `token-sudo user="alice",token="abc"`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.opts.Endpoint = ts.URL
+			tc.opts.Out = &bytes.Buffer{}
+			if _, err := NewClient(tc.opts).NewQuery(`query { currentUser { username } }`).Do(context.Background(), &struct{}{}); err != nil {
+				t.Fatal(err)
+			}
+			if have != tc.want {
+				t.Errorf("unexpected Authorization %q, want %q", have, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// interaction is a GraphQL request and its response, as stored by -record and
+// read by -replay. The access token and other headers are not stored.
+type interaction struct {
+	Query      string                 `json:"query"`
+	Variables  map[string]interface{} `json:"variables,omitempty"`
+	StatusCode int                    `json:"statusCode"`
+	// Response is the response body. It is stored as JSON if the status code
+	// is 200 and as a JSON string otherwise.
+	Response json.RawMessage `json:"response"`
+}
+
+// interactionCounter counts how often each request was recorded or replayed,
+// keyed by interaction path without the counter, so that repeated identical
+// requests (e.g. when polling) are stored in and read from separate files in
+// the same order.
+type interactionCounter struct {
+	sync.Mutex
+	m map[string]int
+}
+
+func (c *interactionCounter) next(base string) int {
+	c.Lock()
+	defer c.Unlock()
+	if c.m == nil {
+		c.m = map[string]int{}
+	}
+	n := c.m[base]
+	c.m[base] = n + 1
+	return n
+}
+
+var recordedInteractions, replayedInteractions interactionCounter
+
+// interactionPath returns the path of the file in dir that the next
+// interaction for the given request is stored in, according to counter. Files
+// are named after the operation, a hash of the query and variables and a
+// counter.
+func interactionPath(counter *interactionCounter, dir, query string, vars map[string]interface{}) (string, error) {
+	// Marshaling sorts map keys, so the hash doesn't depend on their order.
+	data, err := json.Marshal(map[string]interface{}{"query": query, "variables": vars})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+
+	name := operationName(query)
+	if name == "" {
+		name = "anonymous"
+	}
+	base := filepath.Join(dir, fmt.Sprintf("%s-%s", name, hex.EncodeToString(sum[:6])))
+	return fmt.Sprintf("%s-%d.json", base, counter.next(base)), nil
+}
+
+// recordInteraction stores a request and the response to it in dir.
+func recordInteraction(dir, query string, vars map[string]interface{}, statusCode int, body []byte) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	path, err := interactionPath(&recordedInteractions, dir, query, vars)
+	if err != nil {
+		return err
+	}
+
+	response := json.RawMessage(body)
+	if statusCode != http.StatusOK || !json.Valid(body) {
+		if response, err = json.Marshal(string(body)); err != nil {
+			return err
+		}
+	}
+	data, err := json.MarshalIndent(interaction{
+		Query:      query,
+		Variables:  vars,
+		StatusCode: statusCode,
+		Response:   response,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// replayInteraction returns the status code and body of the response recorded
+// in dir for the request.
+func replayInteraction(dir, query string, vars map[string]interface{}) (int, []byte, error) {
+	path, err := interactionPath(&replayedInteractions, dir, query, vars)
+	if err != nil {
+		return 0, nil, err
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return 0, nil, errors.Errorf("no recorded response for this request in %s (expected %s)", dir, filepath.Base(path))
+	} else if err != nil {
+		return 0, nil, err
+	}
+
+	var i interaction
+	if err := json.Unmarshal(data, &i); err != nil {
+		return 0, nil, errors.Wrapf(err, "reading recorded response %s", path)
+	}
+	if i.StatusCode == http.StatusOK {
+		return i.StatusCode, i.Response, nil
+	}
+	var body string
+	if err := json.Unmarshal(i.Response, &body); err != nil {
+		return 0, nil, errors.Wrapf(err, "reading recorded response %s", path)
+	}
+	return i.StatusCode, []byte(body), nil
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "api-recording-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	// Every request gets a different response, like when polling. Requests
+	// with the ID "forbidden" fail.
+	calls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		body, _ := ioutil.ReadAll(r.Body)
+		if bytes.Contains(body, []byte(`"id":"forbidden"`)) {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte("Forbidden.\n"))
+			return
+		}
+		if calls == 1 {
+			w.Write([]byte(`{"data": {"site": {"state": "CLONING"}}}`))
+			return
+		}
+		w.Write([]byte(`{"data": {"site": {"state": "CLONED"}}}`))
+	}))
+	defer ts.Close()
+
+	newClient := func(args ...string) Client {
+		flagSet := flag.NewFlagSet("test", flag.ContinueOnError)
+		flags := NewFlags(flagSet)
+		if err := flagSet.Parse(args); err != nil {
+			t.Fatal(err)
+		}
+		return NewClient(ClientOpts{Endpoint: ts.URL, Flags: flags, Out: &bytes.Buffer{}})
+	}
+
+	type result struct{ Site struct{ State string } }
+	query := `query SiteState($id: ID!) { site { state } }`
+	vars := map[string]interface{}{"id": "1"}
+	run := func(client Client) (states []string, err error) {
+		for i := 0; i < 2; i++ {
+			var r result
+			if _, err := client.NewRequest(query, vars).Do(context.Background(), &r); err != nil {
+				return states, err
+			}
+			states = append(states, r.Site.State)
+		}
+		_, err = client.NewRequest(query, map[string]interface{}{"id": "forbidden"}).Do(context.Background(), &result{})
+		return states, err
+	}
+
+	want := []string{"CLONING", "CLONED"}
+	recorded, recordErr := run(newClient("-record", dir))
+	if diff := cmp.Diff(want, recorded); diff != "" {
+		t.Fatalf("unexpected recorded states (-want +have):\n%s", diff)
+	}
+
+	ts.Close()
+	replayed, replayErr := run(newClient("-replay", dir))
+	if diff := cmp.Diff(want, replayed); diff != "" {
+		t.Errorf("unexpected replayed states (-want +have):\n%s", diff)
+	}
+	if recordErr == nil || replayErr == nil || recordErr.Error() != replayErr.Error() {
+		t.Errorf("unexpected errors: recorded %v; replayed %v", recordErr, replayErr)
+	}
+
+	// Requests that weren't recorded fail.
+	if _, err := newClient("-replay", dir).NewQuery(`query Other { site { id } }`).Do(context.Background(), &result{}); err == nil {
+		t.Error("expected error for request that wasn't recorded")
+	}
+}
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mattn/go-isatty"
+)
+
+// MaxUnavailableWait is the maximum time DoWhenAvailable waits for a
+// Sourcegraph instance to become available again before giving up.
+var MaxUnavailableWait = 10 * time.Minute
+
+// UnavailableOutput is where DoWhenAvailable prints a countdown while it waits
+// for a Sourcegraph instance to become available again.
+var UnavailableOutput io.Writer = os.Stderr
+
+// unavailable tracks until when requests are paused, so that concurrent
+// requests wait together instead of each one hitting the instance.
+var unavailable struct {
+	sync.Mutex
+	until time.Time
+}
+
+// DoWhenAvailable sends the request returned by newRequest. If the Sourcegraph
+// instance responds with a status that indicates that it is temporarily
+// unavailable, e.g. because it is restarting or in maintenance, all requests
+// made through DoWhenAvailable are paused with a visible countdown and the
+// request is retried if it is idempotent. Once MaxUnavailableWait has passed,
+// the last response is returned as is.
+//
+// A request that isn't idempotent, e.g. a GraphQL mutation, is never retried:
+// a proxy may answer with one of these statuses after the instance already
+// processed the request. It only waits for a pause started by other requests.
+//
+// newRequest is called for every attempt, since request bodies can only be
+// read once.
+func DoWhenAvailable(ctx context.Context, idempotent bool, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	start := time.Now()
+	for attempt := 0; ; attempt++ {
+		if err := waitUntilAvailable(ctx); err != nil {
+			return nil, err
+		}
+
+		req, err := newRequest()
+		if err != nil {
+			return nil, err
+		}
+		resp, err := HTTPClient.Do(req.WithContext(ctx))
+		if err != nil || !idempotent || !isUnavailableStatus(resp.StatusCode) {
+			return resp, err
+		}
+
+		delay := retryDelay(resp, attempt)
+		if time.Since(start)+delay > MaxUnavailableWait {
+			return resp, nil
+		}
+		resp.Body.Close()
+
+		if err := pauseRequests(ctx, resp.Status, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func isUnavailableStatus(code int) bool {
+	return code == http.StatusBadGateway || code == http.StatusServiceUnavailable || code == http.StatusGatewayTimeout
+}
+
+// retryDelay returns how long to wait before retrying, honoring the
+// Retry-After header if the instance sent one and backing off exponentially
+// otherwise.
+func retryDelay(resp *http.Response, attempt int) time.Duration {
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	delay := 5 * time.Second
+	for i := 0; i < attempt && delay < time.Minute; i++ {
+		delay *= 2
+	}
+	if delay > time.Minute {
+		delay = time.Minute
+	}
+	return delay
+}
+
+func waitUntilAvailable(ctx context.Context) error {
+	unavailable.Lock()
+	wait := time.Until(unavailable.until)
+	unavailable.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+	select {
+	case <-time.After(wait):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// pauseRequests pauses all requests for the given duration and prints a
+// countdown. If requests are already paused, it returns immediately and the
+// caller waits in waitUntilAvailable instead.
+func pauseRequests(ctx context.Context, status string, d time.Duration) error {
+	unavailable.Lock()
+	if time.Now().Before(unavailable.until) {
+		unavailable.Unlock()
+		return nil
+	}
+	until := time.Now().Add(d)
+	unavailable.until = until
+	unavailable.Unlock()
+
+	msg := fmt.Sprintf("Sourcegraph instance is unavailable (%s), retrying in", status)
+	f, ok := UnavailableOutput.(*os.File)
+	if !ok || !(isatty.IsTerminal(f.Fd()) || isatty.IsCygwinTerminal(f.Fd())) {
+		fmt.Fprintf(UnavailableOutput, "%s %s...\n", msg, d.Round(time.Second))
+		return waitUntilAvailable(ctx)
+	}
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		remaining := time.Until(until).Round(time.Second)
+		if remaining <= 0 {
+			fmt.Fprint(UnavailableOutput, "\r\033[K")
+			return nil
+		}
+		fmt.Fprintf(UnavailableOutput, "\r\033[K%s %s...", msg, remaining)
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			fmt.Fprintln(UnavailableOutput)
+			return ctx.Err()
+		}
+	}
+}
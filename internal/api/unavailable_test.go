@@ -0,0 +1,89 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDoWhenAvailable(t *testing.T) {
+	output := UnavailableOutput
+	UnavailableOutput = ioutil.Discard
+	defer func() { UnavailableOutput = output }()
+
+	for name, tc := range map[string]struct {
+		idempotent   bool
+		maxWait      time.Duration
+		wantStatus   int
+		wantAttempts int
+	}{
+		"idempotent": {
+			idempotent:   true,
+			maxWait:      time.Minute,
+			wantStatus:   http.StatusOK,
+			wantAttempts: 2,
+		},
+		"not idempotent": {
+			idempotent:   false,
+			maxWait:      time.Minute,
+			wantStatus:   http.StatusServiceUnavailable,
+			wantAttempts: 1,
+		},
+		"waited too long": {
+			idempotent:   true,
+			maxWait:      0,
+			wantStatus:   http.StatusServiceUnavailable,
+			wantAttempts: 1,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			maxWait := MaxUnavailableWait
+			MaxUnavailableWait = tc.maxWait
+			defer func() { MaxUnavailableWait = maxWait }()
+
+			attempts := 0
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				attempts++
+				if attempts == 1 {
+					w.Header().Set("Retry-After", "1")
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				w.Write([]byte("ok"))
+			}))
+			defer ts.Close()
+
+			resp, err := DoWhenAvailable(context.Background(), tc.idempotent, func() (*http.Request, error) {
+				return http.NewRequest("POST", ts.URL, bytes.NewReader([]byte("body")))
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tc.wantStatus {
+				t.Errorf("unexpected status %d, want %d", resp.StatusCode, tc.wantStatus)
+			}
+			if attempts != tc.wantAttempts {
+				t.Errorf("unexpected number of attempts %d, want %d", attempts, tc.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestIsMutation(t *testing.T) {
+	for query, want := range map[string]bool{
+		`query Site { site { id } }`:                        false,
+		`{ currentUser { id } }`:                            false,
+		`mutation CreatePatchSet { createPatchSet { id } }`: true,
+		"\n  # Creates a campaign.\n  mutation { x }":       true,
+		`mutations`: false,
+	} {
+		if have := isMutation(query); have != want {
+			t.Errorf("isMutation(%q) = %v, want %v", query, have, want)
+		}
+	}
+}
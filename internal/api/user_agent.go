@@ -0,0 +1,50 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// UserAgent is the User-Agent header sent with requests to Sourcegraph by
+// clients whose ClientOpts.UserAgent is empty and by SetUserAgent. Tools that
+// embed src should set it to identify themselves.
+var UserAgent = "src-cli"
+
+var requestSourceRegexp = regexp.MustCompile(`^[\w.:/@-]+$`)
+
+// ValidateRequestSource returns an error if source can't be used as the
+// request source in a User-Agent.
+func ValidateRequestSource(source string) error {
+	if source != "" && !requestSourceRegexp.MatchString(source) {
+		return fmt.Errorf("invalid request source %q: may only contain letters, digits and . _ : / @ -", source)
+	}
+	return nil
+}
+
+// FormatUserAgent returns a User-Agent that identifies the src version and
+// the command, e.g. "actions exec", and the request source, if they're not
+// empty, so that site admins can attribute the requests to an automation:
+//
+//	src-cli/3.17.0 (actions exec; source=nightly-upgrades)
+func FormatUserAgent(version, command, source string) string {
+	ua := "src-cli/" + version
+	var comments []string
+	if command != "" {
+		comments = append(comments, command)
+	}
+	if source != "" {
+		comments = append(comments, "source="+source)
+	}
+	if len(comments) > 0 {
+		ua += " (" + strings.Join(comments, "; ") + ")"
+	}
+	return ua
+}
+
+// SetUserAgent sets the User-Agent header of a request to Sourcegraph that is
+// not made through a Client, e.g. to download a repository archive.
+func SetUserAgent(req *http.Request) {
+	req.Header.Set("User-Agent", UserAgent)
+}
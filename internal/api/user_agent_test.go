@@ -0,0 +1,76 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFormatUserAgent(t *testing.T) {
+	for _, tc := range []struct {
+		version, command, source string
+		want                     string
+	}{
+		{version: "3.17.0", want: "src-cli/3.17.0"},
+		{version: "3.17.0", command: "actions exec", want: "src-cli/3.17.0 (actions exec)"},
+		{version: "dev", command: "api", source: "nightly-upgrades", want: "src-cli/dev (api; source=nightly-upgrades)"},
+		{version: "dev", source: "ci", want: "src-cli/dev (source=ci)"},
+	} {
+		if have := FormatUserAgent(tc.version, tc.command, tc.source); have != tc.want {
+			t.Errorf("FormatUserAgent(%q, %q, %q) = %q, want %q", tc.version, tc.command, tc.source, have, tc.want)
+		}
+	}
+}
+
+func TestValidateRequestSource(t *testing.T) {
+	for source, valid := range map[string]bool{
+		"":                         true,
+		"nightly-upgrades":         true,
+		"github.com/org/repo@v1.2": true,
+		"jenkins:job_42":           true,
+		"two words":                false,
+		"semi;colon":               false,
+		"close)":                   false,
+		"line\nbreak":              false,
+	} {
+		if err := ValidateRequestSource(source); (err == nil) != valid {
+			t.Errorf("ValidateRequestSource(%q) = %v, want valid %v", source, err, valid)
+		}
+	}
+}
+
+func TestClientUserAgent(t *testing.T) {
+	var have string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		have = r.Header.Get("User-Agent")
+		w.Write([]byte(`{"data": {}}`))
+	}))
+	defer ts.Close()
+
+	old := UserAgent
+	UserAgent = "src-cli/dev (api)"
+	t.Cleanup(func() { UserAgent = old })
+
+	for _, tc := range []struct {
+		name string
+		opts ClientOpts
+		want string
+	}{
+		{name: "default", want: "src-cli/dev (api)"},
+		{name: "overridden", opts: ClientOpts{UserAgent: "my-tool/1.0"}, want: "my-tool/1.0"},
+		{name: "additional header", opts: ClientOpts{AdditionalHeaders: map[string]string{"User-Agent": "header"}}, want: "header"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.opts.Endpoint = ts.URL
+			tc.opts.Out = &bytes.Buffer{}
+			if _, err := NewClient(tc.opts).NewQuery(`query { site { id } }`).Do(context.Background(), &struct{}{}); err != nil {
+				t.Fatal(err)
+			}
+			if have != tc.want {
+				t.Errorf("unexpected User-Agent %q, want %q", have, tc.want)
+			}
+		})
+	}
+}
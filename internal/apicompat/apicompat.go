@@ -0,0 +1,199 @@
+// Package apicompat tests that the public Go packages of src stay compatible.
+//
+// The public packages mostly re-export identifiers of internal packages as
+// aliases, so changing an internal type can silently change the public API.
+// Check describes the exported identifiers of a package, including the
+// fields and methods of the types they refer to, and compares the
+// description to the one recorded in the package's testdata/api.txt.
+package apicompat
+
+import (
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var update = flag.Bool("update-api", false, "update the recorded APIs in testdata/api.txt")
+
+// Check fails t if the API of the package in the current directory differs
+// from the one recorded in testdata/api.txt. idents maps every exported
+// identifier of the package to a nil pointer of its type for types, or to
+// its value for functions and constants.
+//
+// Removed or changed lines are incompatible changes. Added lines are
+// compatible but must be recorded with 'go test -update-api'.
+func Check(t testing.TB, idents map[string]interface{}) {
+	t.Helper()
+
+	names, err := exportedNames(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		if _, ok := idents[name]; !ok {
+			t.Errorf("exported identifier %s is missing in the identifiers given to apicompat.Check", name)
+		}
+	}
+
+	have := Describe(idents)
+	path := filepath.Join("testdata", "api.txt")
+	if *update {
+		if err := ioutil.WriteFile(path, []byte(strings.Join(have, "\n")+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if diff := cmp.Diff(want, have); diff != "" {
+		t.Errorf("the API differs from %s (-recorded +current). Removed or changed lines break programs using the package and must wait for a major release; record added lines with 'go test -update-api':\n%s", path, diff)
+	}
+}
+
+// Describe returns a sorted description of idents, see Check.
+func Describe(idents map[string]interface{}) []string {
+	var lines []string
+	for name, v := range idents {
+		t := reflect.TypeOf(v)
+		switch {
+		case t.Kind() == reflect.Ptr && reflect.ValueOf(v).IsNil():
+			lines = append(lines, describeType(name, t.Elem())...)
+		case t.Kind() == reflect.Func:
+			lines = append(lines, fmt.Sprintf("func %s %s", name, funcString(t, 0)))
+		default:
+			lines = append(lines, fmt.Sprintf("const %s %s = %#v", name, t, v))
+		}
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+func describeType(name string, t reflect.Type) []string {
+	lines := []string{fmt.Sprintf("type %s %s", name, underlyingString(t))}
+	if t.Kind() == reflect.Struct {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			line := fmt.Sprintf("field %s.%s %s", name, f.Name, f.Type)
+			if f.Tag != "" {
+				line += " " + string(f.Tag)
+			}
+			lines = append(lines, line)
+		}
+	}
+
+	methods, skip := t, 0
+	if t.Kind() != reflect.Interface {
+		methods, skip = reflect.PtrTo(t), 1
+	}
+	for i := 0; i < methods.NumMethod(); i++ {
+		m := methods.Method(i)
+		lines = append(lines, fmt.Sprintf("method %s.%s %s", name, m.Name, funcString(m.Type, skip)))
+	}
+	return lines
+}
+
+func underlyingString(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Struct:
+		return "struct"
+	case reflect.Interface:
+		return "interface"
+	case reflect.Map:
+		return fmt.Sprintf("map[%s]%s", t.Key(), t.Elem())
+	case reflect.Slice:
+		return fmt.Sprintf("[]%s", t.Elem())
+	case reflect.Ptr:
+		return fmt.Sprintf("*%s", t.Elem())
+	case reflect.Func:
+		return funcString(t, 0)
+	default:
+		return t.Kind().String()
+	}
+}
+
+// funcString formats the signature of the function type t, leaving out the
+// first skip parameters, e.g. the receiver of methods.
+func funcString(t reflect.Type, skip int) string {
+	var in, out []string
+	for i := skip; i < t.NumIn(); i++ {
+		if t.IsVariadic() && i == t.NumIn()-1 {
+			in = append(in, "..."+t.In(i).Elem().String())
+			continue
+		}
+		in = append(in, t.In(i).String())
+	}
+	for i := 0; i < t.NumOut(); i++ {
+		out = append(out, t.Out(i).String())
+	}
+	s := "func(" + strings.Join(in, ", ") + ")"
+	switch len(out) {
+	case 0:
+	case 1:
+		s += " " + out[0]
+	default:
+		s += " (" + strings.Join(out, ", ") + ")"
+	}
+	return s
+}
+
+// exportedNames returns the exported top-level identifiers declared in the
+// non-test Go files in dir.
+func exportedNames(dir string) ([]string, error) {
+	pkgs, err := parser.ParseDir(token.NewFileSet(), dir, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for name, pkg := range pkgs {
+		if strings.HasSuffix(name, "_test") {
+			continue
+		}
+		for path, file := range pkg.Files {
+			if strings.HasSuffix(path, "_test.go") {
+				continue
+			}
+			for _, decl := range file.Decls {
+				switch decl := decl.(type) {
+				case *ast.FuncDecl:
+					if decl.Recv == nil && decl.Name.IsExported() {
+						names = append(names, decl.Name.Name)
+					}
+				case *ast.GenDecl:
+					for _, spec := range decl.Specs {
+						switch spec := spec.(type) {
+						case *ast.TypeSpec:
+							if spec.Name.IsExported() {
+								names = append(names, spec.Name.Name)
+							}
+						case *ast.ValueSpec:
+							for _, n := range spec.Names {
+								if n.IsExported() {
+									names = append(names, n.Name)
+								}
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -3,10 +3,17 @@ package campaigns
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"regexp"
 	"strings"
 
+	"github.com/ghodss/yaml"
 	"github.com/hashicorp/go-multierror"
 	"github.com/pkg/errors"
 	"github.com/sourcegraph/jsonx"
@@ -15,16 +22,38 @@ import (
 )
 
 type Action struct {
-	ScopeQuery string        `json:"scopeQuery,omitempty"`
-	Steps      []*ActionStep `json:"steps"`
+	ScopeQuery       string              `json:"scopeQuery,omitempty"`
+	Steps            []*ActionStep       `json:"steps"`
+	Matrix           map[string][]string `json:"matrix,omitempty"`
+	AllowUnsupported string              `json:"allowUnsupported,omitempty"` // "skip", "error" or "include"
+
+	// RequireFileMatches skips the repositories in which the scopeQuery
+	// matched no files, e.g. those matched by their name only.
+	RequireFileMatches bool `json:"requireFileMatches,omitempty"`
 }
 
 type ActionStep struct {
 	Type      string   `json:"type"`            // "command"
 	Image     string   `json:"image,omitempty"` // Docker image
+	Build     string   `json:"build,omitempty"` // Docker build context
 	CacheDirs []string `json:"cacheDirs,omitempty"`
 	Args      []string `json:"args,omitempty"`
 
+	// Artifacts are glob patterns of files produced by the step that are
+	// copied out of the workspace, see copyArtifacts.
+	Artifacts []string `json:"artifacts,omitempty"`
+
+	// The following options harden the container of a "docker" step.
+	Network     string   `json:"network,omitempty"`
+	ReadOnly    bool     `json:"readOnly,omitempty"`
+	CapDrop     []string `json:"capDrop,omitempty"`
+	SecurityOpt []string `json:"securityOpt,omitempty"`
+	User        string   `json:"user,omitempty"`
+
+	// Platform is the platform of the image of a "docker" step, e.g.
+	// "linux/amd64". If empty, the platform of the Docker daemon is used.
+	Platform string `json:"platform,omitempty"`
+
 	// ImageContentDigest is an internal field that should not be set by users.
 	ImageContentDigest string
 }
@@ -34,13 +63,84 @@ type PatchInput struct {
 	BaseRevision string `json:"baseRevision"`
 	BaseRef      string `json:"baseRef"`
 	Patch        string `json:"patch"`
+
+	// PatchFile, if set, is the path of the file that contains the patch
+	// instead of Patch. Executors with a PatchDir keep the patches on disk
+	// until they are written out or sent to Sourcegraph, so that large
+	// patches of many repositories don't have to fit into memory at once.
+	PatchFile string `json:"-"`
+}
+
+// MarshalJSON encodes p like a PatchInput without a PatchFile, reading the
+// patch from PatchFile if it is set.
+func (p PatchInput) MarshalJSON() ([]byte, error) {
+	p, err := p.loadPatch()
+	if err != nil {
+		return nil, err
+	}
+	type patchInput PatchInput
+	return json.Marshal(patchInput(p))
+}
+
+// WritePatch writes the patch to w, streaming it from PatchFile if it is set.
+func (p PatchInput) WritePatch(w io.Writer) error {
+	if p.PatchFile == "" {
+		_, err := io.WriteString(w, p.Patch)
+		return err
+	}
+	f, err := os.Open(p.PatchFile)
+	if err != nil {
+		return errors.Wrap(err, "opening patch file")
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// PatchSize returns the size of the patch in bytes without reading it.
+func (p PatchInput) PatchSize() (int64, error) {
+	if p.PatchFile == "" {
+		return int64(len(p.Patch)), nil
+	}
+	fi, err := os.Stat(p.PatchFile)
+	if err != nil {
+		return 0, errors.Wrap(err, "reading size of patch file")
+	}
+	return fi.Size(), nil
+}
+
+// loadPatch returns p with the patch read from PatchFile into Patch.
+func (p PatchInput) loadPatch() (PatchInput, error) {
+	if p.PatchFile == "" {
+		return p, nil
+	}
+	data, err := ioutil.ReadFile(p.PatchFile)
+	if err != nil {
+		return p, errors.Wrap(err, "reading patch file")
+	}
+	p.Patch, p.PatchFile = string(data), ""
+	return p, nil
 }
 
 type ActionRepo struct {
-	ID      string
-	Name    string
+	ID   string
+	Name string
+	// Rev is the commit BaseRef pointed to when the repositories were
+	// resolved at the start of the execution. It is used to fetch the
+	// archive, as part of the cache key and as the BaseRevision of the
+	// resulting patch, so that pushes to BaseRef during the execution don't
+	// lead to inconsistent patches.
 	Rev     string
 	BaseRef string
+	// ExternalServiceType is the type of the code host of the repository,
+	// e.g. "github" or "perforce". It doesn't change the result of the
+	// execution and is therefore not part of the cache key.
+	ExternalServiceType string `json:"-"`
+	// SearchResultPaths are the paths of the files in the repository that
+	// the scopeQuery matched, separated by newlines, or empty if it matched
+	// the repository itself. They're a string so that ActionRepo stays
+	// comparable, see SearchResultPathList.
+	SearchResultPaths string `json:",omitempty"`
 }
 
 func ValidateActionDefinition(def []byte) error {
@@ -72,6 +172,105 @@ func ValidateActionDefinition(def []byte) error {
 	return errs.ErrorOrNil()
 }
 
+// ParseAction parses the YAML or JSON action definition def, which was read
+// from path, resolves the definitions it extends and validates the result.
+// path is only used to resolve relative paths in "extends" and may be empty
+// if def doesn't extend other definitions.
+func ParseAction(path string, def []byte) (Action, error) {
+	return ParseActionWithVars(path, def, nil)
+}
+
+// ParseActionWithVars is like ParseAction, but also replaces the variable
+// placeholders in the definition with the values in vars, see ExpandVars.
+func ParseActionWithVars(path string, def []byte, vars Vars) (Action, error) {
+	def, err := yaml.YAMLToJSONStrict(def)
+	if err != nil {
+		return Action{}, errors.Wrap(err, "unable to parse action file")
+	}
+
+	def, sources, err := ComposeActionDefinition(path, def)
+	if err != nil {
+		return Action{}, errors.Wrap(err, "resolving extends")
+	}
+
+	if def, err = ExpandVars(def, vars); err != nil {
+		return Action{}, err
+	}
+
+	var action Action
+	err = ValidateActionDefinition(def)
+	if err == nil {
+		var normalized []byte
+		if normalized, err = jsonxToJSON(string(def)); err == nil {
+			err = json.Unmarshal(normalized, &action)
+		}
+		if err != nil {
+			err = errors.Wrap(err, "invalid JSON action file")
+		} else {
+			err = ValidateAction(action)
+		}
+	}
+	if err != nil && len(sources) > 1 {
+		err = errors.Wrapf(err, "action definition composed from %s", strings.Join(sources, ", "))
+	}
+	return action, err
+}
+
+// dockerImageRegexp matches Docker image references, such as
+// "alpine:3", "golang@sha256:..." or "registry.example.com:5000/team/tool:v1".
+var dockerImageRegexp = regexp.MustCompile(`^(?:[a-zA-Z0-9.-]+(?::[0-9]+)?/)?[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*)*(?::\w[\w.-]{0,127})?(?:@sha256:[a-f0-9]{64})?$`)
+
+// ValidateAction checks the parts of an action that the schema can't check,
+// without using the network or Docker: that the matrix placeholders refer to
+// keys in the matrix, that images are valid image references without secrets
+// and that build contexts contain a Dockerfile.
+func ValidateAction(action Action) error {
+	errs := &multierror.Error{ErrorFormat: formatValidationErrs}
+	// The same problem can show up in every matrix entry, but is only
+	// reported once.
+	seen := map[string]bool{}
+	add := func(err error) {
+		if !seen[err.Error()] {
+			seen[err.Error()] = true
+			errs = multierror.Append(errs, err)
+		}
+	}
+
+	for _, entry := range action.MatrixEntries() {
+		a, err := action.WithMatrix(entry)
+		if err != nil {
+			add(err)
+			continue
+		}
+
+		for i, step := range a.Steps {
+			if secretPlaceholderRegexp.MatchString(step.Image) {
+				add(fmt.Errorf("steps.%d: secrets can only be used in args, not in the image", i))
+			}
+			for _, pattern := range step.Artifacts {
+				if err := validateArtifactPattern(pattern); err != nil {
+					add(fmt.Errorf("steps.%d: artifacts: %s", i, err))
+				}
+			}
+			if step.Type != "docker" {
+				continue
+			}
+			if step.Image != "" && !dockerImageRegexp.MatchString(step.Image) {
+				add(fmt.Errorf("steps.%d: %q is not a valid Docker image reference", i, step.Image))
+			}
+			if step.Platform != "" && !dockerPlatformRegexp.MatchString(step.Platform) {
+				add(fmt.Errorf("steps.%d: %q is not a valid Docker platform, e.g. linux/amd64", i, step.Platform))
+			}
+			if step.Build != "" {
+				if _, err := os.Stat(filepath.Join(step.Build, "Dockerfile")); err != nil {
+					add(fmt.Errorf("steps.%d: build context %s does not contain a Dockerfile", i, step.Build))
+				}
+			}
+		}
+	}
+	return errs.ErrorOrNil()
+}
+
 func formatValidationErrs(es []error) string {
 	points := make([]string, len(es))
 	for i, err := range es {
@@ -86,11 +285,24 @@ func formatValidationErrs(es []error) string {
 func PrepareAction(ctx context.Context, action Action, logger *ActionLogger) error {
 	// Build any Docker images.
 	for _, step := range action.Steps {
+		if step.Type == "docker" && step.Build != "" {
+			id, err := buildDockerImage(ctx, step.Build, step.Image, step.Platform, logger)
+			if err != nil {
+				return errors.Wrapf(err, "Failed to build Docker image from %s", step.Build)
+			}
+			// The ID of the built image is derived from its content, so
+			// changes to the build context invalidate cached results.
+			step.ImageContentDigest = id
+			if step.Image == "" {
+				step.Image = id
+			}
+			continue
+		}
 		if step.Type == "docker" {
 			// Set digests for Docker images so we don't cache action runs in 2 different images with
 			// the same tag.
 			var err error
-			step.ImageContentDigest, err = getDockerImageContentDigest(ctx, step.Image, logger)
+			step.ImageContentDigest, err = getDockerImageContentDigest(ctx, step.Image, step.Platform, logger)
 			if err != nil {
 				return errors.Wrap(err, "Failed to get Docker image content digest")
 			}
@@ -100,6 +312,36 @@ func PrepareAction(ctx context.Context, action Action, logger *ActionLogger) err
 	return nil
 }
 
+// buildDockerImage builds the Docker image in the build context dir, for
+// platform if it's not empty, tags it with tag if it's not empty and returns
+// the ID of the image.
+func buildDockerImage(ctx context.Context, dir, tag, platform string, logger *ActionLogger) (string, error) {
+	logger.Infof("Building Docker image from %s...\n", dir)
+
+	args := []string{"build", "--quiet"}
+	if tag != "" {
+		args = append(args, "--tag", tag)
+	}
+	if platform != "" {
+		args = append(args, "--platform", platform)
+	}
+	args = append(args, "--", dir)
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "docker", args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("error building docker image: %s", bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	id := string(bytes.TrimSpace(out))
+	if id == "" {
+		return "", fmt.Errorf("unexpected empty docker image ID for image built from %s", dir)
+	}
+	return id, nil
+}
+
 // getDockerImageContentDigest gets the content digest for the image. Note that this
 // is different from the "distribution digest" (which is what you can use to specify
 // an image to `docker run`, as in `my/image@sha256:xxx`). We need to use the
@@ -107,43 +349,82 @@ func PrepareAction(ctx context.Context, action Action, logger *ActionLogger) err
 // have been pulled from or pushed to a registry. See
 // https://windsock.io/explaining-docker-image-ids/ under "A Final Twist" for a good
 // explanation.
-func getDockerImageContentDigest(ctx context.Context, image string, logger *ActionLogger) (string, error) {
+//
+// The image is pulled for the given platform or, if it's empty, for the
+// platform of the Docker daemon. A local image for another platform is
+// replaced if the image is available for the wanted one.
+func getDockerImageContentDigest(ctx context.Context, image, platform string, logger *ActionLogger) (string, error) {
+	want := normalizePlatform(platform)
+	if platform == "" {
+		want = dockerHostPlatform(ctx)
+	}
+
 	// TODO!(sqs): is image id the right thing to use here? it is NOT the
 	// digest. but the digest is not calculated for all images (unless they are
 	// pulled/pushed from/to a registry), see
 	// https://github.com/moby/moby/issues/32016.
-	out, err := exec.CommandContext(ctx, "docker", "image", "inspect", "--format", "{{.Id}}", "--", image).CombinedOutput()
+	_, have, err := inspectDockerImage(ctx, image)
 	if err != nil {
-		if !strings.Contains(string(out), "No such image") {
-			return "", fmt.Errorf("error inspecting docker image %q: %s", image, bytes.TrimSpace(out))
+		if e, ok := err.(*dockerInspectError); !ok || !e.notFound() {
+			return "", fmt.Errorf("error inspecting docker image %q: %s", image, err)
 		}
-		logger.Infof("Pulling Docker image %q...\n", image)
-		pullCmd := exec.CommandContext(ctx, "docker", "image", "pull", image)
-		prefix := fmt.Sprintf("docker image pull %s", image)
-		pullCmd.Stdout = logger.InfoPipe(prefix)
-		pullCmd.Stderr = logger.ErrorPipe(prefix)
-
-		err = pullCmd.Start()
-		if err != nil {
-			return "", fmt.Errorf("error pulling docker image %q: %s", image, err)
+		// Without --platform, Docker pulls the image for its own platform.
+		if err := pullDockerImage(ctx, image, platform, logger); err != nil {
+			return "", err
 		}
-		err = pullCmd.Wait()
-		if err != nil {
-			return "", fmt.Errorf("error pulling docker image %q: %s", image, err)
+	} else if have != "" && have != want {
+		// E.g. an amd64 image pulled before Docker ran natively on arm64.
+		// Images that only exist locally or only for one platform can't be
+		// pulled for the wanted platform, in which case the local one is
+		// used.
+		if err := pullDockerImage(ctx, image, want, logger); err != nil {
+			logger.Warnf("Pulling Docker image %q for %s failed, using the local image for %s: %s\n", image, want, have, err)
 		}
 	}
-	out, err = exec.CommandContext(ctx, "docker", "image", "inspect", "--format", "{{.Id}}", "--", image).CombinedOutput()
+
 	// This time, the image MUST be present, so the issue must be something else.
+	id, have, err := inspectDockerImage(ctx, image)
 	if err != nil {
-		return "", fmt.Errorf("error inspecting docker image %q: %s", image, bytes.TrimSpace(out))
+		return "", fmt.Errorf("error inspecting docker image %q: %s", image, err)
 	}
-	id := string(bytes.TrimSpace(out))
 	if id == "" {
 		return "", fmt.Errorf("unexpected empty docker image content ID for %q", image)
 	}
+	if have != "" && have != want {
+		logger.ImageEmulated(image, have, want)
+	}
 	return id, nil
 }
 
+// pullDockerImage pulls the image, for the given platform if it's not empty.
+func pullDockerImage(ctx context.Context, image, platform string, logger *ActionLogger) error {
+	args := []string{"image", "pull"}
+	if platform != "" {
+		logger.Infof("Pulling Docker image %q for %s...\n", image, platform)
+		args = append(args, "--platform", platform)
+	} else {
+		logger.Infof("Pulling Docker image %q...\n", image)
+	}
+	args = append(args, image)
+	pullCmd := exec.CommandContext(ctx, "docker", args...)
+	prefix := fmt.Sprintf("docker image pull %s", image)
+	stdout, stderr := logger.InfoPipe(prefix), logger.ErrorPipe(prefix)
+	pullCmd.Stdout = stdout
+	pullCmd.Stderr = stderr
+
+	err := pullCmd.Start()
+	if err != nil {
+		return fmt.Errorf("error pulling docker image %q: %s", image, err)
+	}
+	err = pullCmd.Wait()
+	stdout.Close()
+	stderr.Close()
+	if err != nil {
+		return fmt.Errorf("error pulling docker image %q: %s", image, err)
+	}
+	return nil
+}
+
 // jsonxToJSON converts jsonx to plain JSON.
 func jsonxToJSON(text string) ([]byte, error) {
 	data, errs := jsonx.Parse(text, jsonx.ParseOptions{Comments: true, TrailingCommas: true})
@@ -0,0 +1,189 @@
+package campaigns
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestValidateAction(t *testing.T) {
+	buildDir, err := ioutil.TempDir("", "validate-action-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(buildDir) })
+	if err := ioutil.WriteFile(filepath.Join(buildDir, "Dockerfile"), []byte("FROM alpine:3\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		action  Action
+		wantErr []string
+	}{
+		"valid": {
+			action: Action{
+				Matrix: map[string][]string{"go": {"1.13", "1.14"}},
+				Steps: []*ActionStep{
+					{Type: "docker", Image: "golang:${{ matrix.go }}"},
+					{Type: "docker", Image: "registry.example.com:5000/team/tool@sha256:" + strings.Repeat("a", 64)},
+					{Type: "docker", Build: buildDir, Platform: "linux/amd64"},
+					{Type: "docker", Image: "arm32v7/alpine:3", Platform: "linux/arm/v7"},
+					{Type: "command", Args: []string{"echo", "${{ matrix.go }}"}},
+				},
+			},
+		},
+		"undefined matrix key": {
+			action: Action{
+				Matrix: map[string][]string{"go": {"1.13", "1.14"}},
+				Steps:  []*ActionStep{{Type: "docker", Image: "golang:${{ matrix.version }}"}},
+			},
+			wantErr: []string{`refers to "version"`},
+		},
+		"invalid images": {
+			action: Action{
+				Matrix: map[string][]string{"tag": {"3", "not a tag"}},
+				Steps: []*ActionStep{
+					{Type: "docker", Image: "Alpine:3"},
+					{Type: "docker", Image: "alpine:${{ matrix.tag }}"},
+				},
+			},
+			wantErr: []string{`steps.0: "Alpine:3"`, `steps.1: "alpine:not a tag"`},
+		},
+		"missing Dockerfile": {
+			action: Action{
+				Steps: []*ActionStep{{Type: "docker", Build: filepath.Join(buildDir, "missing")}},
+			},
+			wantErr: []string{"does not contain a Dockerfile"},
+		},
+		"invalid platform": {
+			action: Action{
+				Steps: []*ActionStep{{Type: "docker", Image: "alpine:3", Platform: "arm64"}},
+			},
+			wantErr: []string{`steps.0: "arm64" is not a valid Docker platform`},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := ValidateAction(tc.action)
+			if len(tc.wantErr) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			for _, want := range tc.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q does not contain %q", err, want)
+				}
+			}
+			// Problems that show up in every matrix entry are reported once.
+			if n := strings.Count(err.Error(), "\n- "); n != len(tc.wantErr) {
+				t.Errorf("unexpected number of errors: have %d; want %d", n, len(tc.wantErr))
+			}
+		})
+	}
+}
+
+func TestParseAction(t *testing.T) {
+	tests := map[string]struct {
+		def     string
+		want    Action
+		wantErr string
+	}{
+		"yaml": {
+			def: "scopeQuery: repohasfile:go.mod\nsteps:\n  - type: command\n    args: [gofmt, -w, .]\n",
+			want: Action{
+				ScopeQuery: "repohasfile:go.mod",
+				Steps:      []*ActionStep{{Type: "command", Args: []string{"gofmt", "-w", "."}}},
+			},
+		},
+		"json": {
+			def: `{"scopeQuery": "repo:a", "steps": [{"type": "docker", "image": "alpine:3"}]}`,
+			want: Action{
+				ScopeQuery: "repo:a",
+				Steps:      []*ActionStep{{Type: "docker", Image: "alpine:3"}},
+			},
+		},
+		"invalid syntax": {
+			def:     "scopeQuery: [",
+			wantErr: "unable to parse action file",
+		},
+		"schema violation": {
+			def:     `{"scopeQuery": "repo:a"}`,
+			wantErr: "steps",
+		},
+		"invalid image": {
+			def:     `{"scopeQuery": "repo:a", "steps": [{"type": "docker", "image": "Alpine:3"}]}`,
+			wantErr: `"Alpine:3"`,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			action, err := ParseAction("", []byte(tc.def))
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("unexpected error %v, want %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, action); diff != "" {
+				t.Errorf("unexpected action (-want +have):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestPatchInputPatchFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "patch-input-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	const patch = "diff --git README.md README.md\n+# Hello, world\n"
+	path := filepath.Join(dir, "patch")
+	if err := ioutil.WriteFile(path, []byte(patch), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	inMemory := PatchInput{Repository: "UmVwbzox", BaseRevision: "deadbeef", BaseRef: "refs/heads/master", Patch: patch}
+	onDisk := PatchInput{Repository: "UmVwbzox", BaseRevision: "deadbeef", BaseRef: "refs/heads/master", PatchFile: path}
+
+	want, err := json.Marshal(inMemory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	have, err := json.Marshal(onDisk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(string(want), string(have)); diff != "" {
+		t.Errorf("unexpected JSON (-want +have):\n%s", diff)
+	}
+
+	var b strings.Builder
+	if err := onDisk.WritePatch(&b); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != patch {
+		t.Errorf("unexpected patch %q", b.String())
+	}
+
+	if size, err := onDisk.PatchSize(); err != nil {
+		t.Fatal(err)
+	} else if size != int64(len(patch)) {
+		t.Errorf("unexpected size %d, want %d", size, len(patch))
+	}
+}
@@ -0,0 +1,45 @@
+package campaigns
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/src-cli/internal/api"
+)
+
+// FetchArchive downloads the archive of the repository at rev, or at HEAD if
+// rev is empty, and extracts it into dest, like the executor does to create
+// the workspace of a repository. dest is created if it doesn't exist and must
+// be empty otherwise. If impersonateUser isn't empty, the archive is
+// downloaded as that user, like with api.ClientOpts.ImpersonateUser.
+func FetchArchive(ctx context.Context, endpoint, accessToken, impersonateUser string, additionalHeaders map[string]string, repoName, rev, dest string, skipSymlinks bool) error {
+	if rev == "" {
+		rev = "HEAD"
+	}
+
+	if entries, err := ioutil.ReadDir(dest); err == nil && len(entries) > 0 {
+		return errors.Errorf("%s is not empty", dest)
+	} else if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return err
+	}
+
+	var authorization string
+	if accessToken != "" {
+		authorization = api.Authorization(accessToken, impersonateUser)
+	}
+	f, err := fetchRepositoryArchive(ctx, endpoint, authorization, additionalHeaders, repoName, rev, nil, nil)
+	if err != nil {
+		return errors.Wrap(err, "Fetching ZIP archive failed")
+	}
+	defer os.Remove(f.Name())
+
+	if err := unzip(f.Name(), dest, skipSymlinks); err != nil {
+		return errors.Wrap(err, "Unzipping the ZIP archive failed")
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package campaigns
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFetchArchiveAuthorization(t *testing.T) {
+	zip, err := ioutil.ReadFile(writeTestZip(t, []zipEntry{{name: "README.md", mode: 0644, content: "# README"}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, tc := range map[string]struct {
+		accessToken, impersonateUser string
+		want                         string
+	}{
+		"no token":      {},
+		"token":         {accessToken: "abc", want: "token abc"},
+		"impersonation": {accessToken: "abc", impersonateUser: "alice", want: `token-sudo user="alice",token="abc"`},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var have string
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				have = r.Header.Get("Authorization")
+				w.Write(zip)
+			}))
+			defer ts.Close()
+
+			dir, err := ioutil.TempDir("", "fetch-archive")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			if err := FetchArchive(context.Background(), ts.URL, tc.accessToken, tc.impersonateUser, nil, "github.com/a", "", filepath.Join(dir, "a"), false); err != nil {
+				t.Fatal(err)
+			}
+			if have != tc.want {
+				t.Errorf("unexpected Authorization header %q, want %q", have, tc.want)
+			}
+		})
+	}
+}
+
+func TestFetchArchive(t *testing.T) {
+	zip, err := ioutil.ReadFile(writeTestZip(t, []zipEntry{
+		{name: "README.md", mode: 0644, content: "# README"},
+		{name: "cmd/run.sh", mode: 0755, content: "#!/bin/sh"},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var requests []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path+" "+r.Header.Get("X-Forwarded-User"))
+		if strings.Contains(r.URL.Path, "missing") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(zip)
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "fetch-archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	headers := map[string]string{"X-Forwarded-User": "alice"}
+
+	for name, tc := range map[string]struct {
+		repo, rev   string
+		wantRequest string
+		wantErr     string
+	}{
+		"default revision": {
+			repo:        "github.com/a",
+			wantRequest: "/github.com/a@HEAD/-/raw alice",
+		},
+		"revision": {
+			repo:        "github.com/b",
+			rev:         "v1.0.0",
+			wantRequest: "/github.com/b@v1.0.0/-/raw alice",
+		},
+		"not found": {
+			repo:        "github.com/missing",
+			wantRequest: "/github.com/missing@HEAD/-/raw alice",
+			wantErr:     "HTTP 404",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			requests = nil
+			dest := filepath.Join(dir, name)
+			err := FetchArchive(context.Background(), ts.URL, "", "", headers, tc.repo, tc.rev, dest, false)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Errorf("unexpected error %v, want %q", err, tc.wantErr)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if len(requests) != 1 || requests[0] != tc.wantRequest {
+				t.Errorf("unexpected requests %q, want %q", requests, tc.wantRequest)
+			}
+			if tc.wantErr != "" {
+				return
+			}
+
+			data, err := ioutil.ReadFile(filepath.Join(dest, "README.md"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != "# README" {
+				t.Errorf("unexpected README.md content %q", data)
+			}
+			info, err := os.Stat(filepath.Join(dest, "cmd/run.sh"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Mode().Perm() != 0755 {
+				t.Errorf("unexpected mode %v of cmd/run.sh", info.Mode())
+			}
+		})
+	}
+
+	t.Run("not empty", func(t *testing.T) {
+		requests = nil
+		dest := filepath.Join(dir, "default revision")
+		err := FetchArchive(context.Background(), ts.URL, "", "", nil, "github.com/a", "", dest, false)
+		if err == nil || !strings.Contains(err.Error(), "is not empty") {
+			t.Errorf("unexpected error %v for a non-empty directory", err)
+		}
+		if len(requests) != 0 {
+			t.Errorf("unexpected requests %q", requests)
+		}
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		dest := filepath.Join(dir, "empty")
+		if err := os.Mkdir(dest, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := FetchArchive(context.Background(), ts.URL, "", "", nil, "github.com/a", "", dest, false); err != nil {
+			t.Error(err)
+		}
+	})
+}
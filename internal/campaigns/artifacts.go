@@ -0,0 +1,104 @@
+package campaigns
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// validateArtifactPattern checks that pattern, an entry of the "artifacts" of
+// a step, is a valid glob pattern relative to the repository root.
+func validateArtifactPattern(pattern string) error {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("invalid pattern %q", pattern)
+	}
+	if clean := path.Clean(pattern); path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+		return fmt.Errorf("pattern %q must be relative to the repository root", pattern)
+	}
+	return nil
+}
+
+// matchArtifacts returns the slash-separated paths, relative to the workspace
+// dir, of the files that match the glob patterns. Matching directories are
+// included recursively. Symlinks are skipped, since they can point outside of
+// the workspace.
+func matchArtifacts(dir string, patterns []string) ([]string, error) {
+	seen := map[string]bool{}
+	var files []string
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(filepath.Join(dir, filepath.FromSlash(pattern)))
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid artifacts pattern %q", pattern)
+		}
+		for _, match := range matches {
+			err := filepath.Walk(match, func(p string, info os.FileInfo, err error) error {
+				if err != nil || !info.Mode().IsRegular() {
+					return err
+				}
+				rel, err := filepath.Rel(dir, p)
+				if err != nil {
+					return err
+				}
+				if rel = filepath.ToSlash(rel); !seen[rel] {
+					seen[rel] = true
+					files = append(files, rel)
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, errors.Wrap(err, "matching artifacts")
+			}
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// copyArtifacts copies the given files, as returned by matchArtifacts, from
+// the workspace dir into destDir, keeping their paths relative to dir.
+func copyArtifacts(dir, destDir string, files []string) error {
+	for _, file := range files {
+		src := filepath.Join(dir, filepath.FromSlash(file))
+		info, err := os.Stat(src)
+		if err != nil {
+			return errors.Wrap(err, "copying artifacts")
+		}
+		dest := filepath.Join(destDir, filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return errors.Wrap(err, "copying artifacts")
+		}
+		if err := copyFile(src, dest, info.Mode().Perm()); err != nil {
+			return errors.Wrap(err, "copying artifacts")
+		}
+	}
+	return nil
+}
+
+// removeUntrackedArtifacts removes the artifacts, as returned by
+// matchArtifacts, that are not part of the commit of the repository in the
+// workspace dir, i.e. that were produced by the steps.
+func removeUntrackedArtifacts(dir string, artifacts []string, runGitCmd func(args ...string) ([]byte, error)) error {
+	args := append([]string{"ls-tree", "-r", "-z", "--name-only", "HEAD", "--"}, artifacts...)
+	out, err := runGitCmd(args...)
+	if err != nil {
+		return errors.Wrap(err, "listing artifacts in the repository failed")
+	}
+	tracked := map[string]bool{}
+	for _, name := range strings.Split(string(out), "\x00") {
+		tracked[name] = true
+	}
+	for _, file := range artifacts {
+		if tracked[file] {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, filepath.FromSlash(file))); err != nil && !os.IsNotExist(err) {
+			return errors.Wrap(err, "removing artifact from the workspace")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package campaigns
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestArtifacts(t *testing.T) {
+	setGitIdentity(t)
+
+	dir, err := ioutil.TempDir("", "artifacts-test-workspace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	artifactsDir, err := ioutil.TempDir("", "artifacts-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(artifactsDir) })
+
+	for name, content := range map[string]string{"README.md": "# Hello\n", "build.log": "old\n"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	steps := []*ActionStep{
+		{
+			Type:      "command",
+			Args:      []string{"sh", "-c", "mkdir -p reports/unit && echo ok > reports/unit/a.xml && echo new > build.log && echo '# Hello, world' > README.md"},
+			Artifacts: []string{"reports", "*.log"},
+		},
+		{
+			// The artifacts of the first step are still available.
+			Type:      "command",
+			Args:      []string{"sh", "-c", "cat reports/unit/a.xml > summary.txt"},
+			Artifacts: []string{"summary.txt", "missing/*"},
+		},
+	}
+	diffFile, err := runSteps(context.Background(), dir, runOpts{
+		prefix:       "artifacts-test",
+		repoName:     "github.com/sourcegraph/src-cli",
+		rev:          "deadbeef",
+		steps:        steps,
+		artifactsDir: artifactsDir,
+		logger:       NewActionLogger(false, false, true),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(diffFile)
+	diff, err := readDiffFile(diffFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Artifacts produced by the steps are left out of the diff, changes to
+	// files of the repository are not.
+	for _, want := range []string{"+# Hello, world", "+new"} {
+		if !strings.Contains(string(diff), want) {
+			t.Errorf("diff does not contain %q:\n%s", want, diff)
+		}
+	}
+	for _, unwanted := range []string{"a.xml", "summary.txt"} {
+		if strings.Contains(string(diff), unwanted) {
+			t.Errorf("diff contains %q:\n%s", unwanted, diff)
+		}
+	}
+
+	got := map[string]string{}
+	err = filepath.Walk(artifactsDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(artifactsDir, path)
+		got[filepath.ToSlash(rel)] = string(data)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"step-1/build.log":          "new\n",
+		"step-1/reports/unit/a.xml": "ok\n",
+		"step-2/summary.txt":        "ok\n",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected artifacts (-want +got):\n%s", diff)
+	}
+}
+
+func TestValidateArtifactPattern(t *testing.T) {
+	for pattern, wantErr := range map[string]bool{
+		"reports/*.xml": false,
+		"*.log":         false,
+		"./out":         false,
+		"[":             true,
+		"/etc/passwd":   true,
+		"../secrets":    true,
+		"a/../../b":     true,
+	} {
+		if err := validateArtifactPattern(pattern); (err != nil) != wantErr {
+			t.Errorf("validateArtifactPattern(%q) = %v, want error: %t", pattern, err, wantErr)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package campaigns
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+// AuditRecord describes everything an action execution did in a single
+// repository, so that automated changes can be reviewed in environments that
+// require it.
+type AuditRecord struct {
+	// RunID is the ID of the execution, see ExecutorOpts.RunID.
+	RunID      string      `json:"runID,omitempty"`
+	Repository string      `json:"repository"`
+	Revision   string      `json:"revision"`
+	Steps      []AuditStep `json:"steps"`
+}
+
+// AuditStep describes a single step of an action execution.
+type AuditStep struct {
+	Type        string `json:"type"`
+	Image       string `json:"image,omitempty"`
+	ImageDigest string `json:"imageDigest,omitempty"`
+
+	// Command is the exact command that was run, e.g. the full `docker run`
+	// invocation for docker steps.
+	Command []string `json:"command"`
+
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+	Error      string    `json:"error,omitempty"`
+
+	// ChangedFiles are the files added (A), modified (M) or deleted (D) by
+	// the step, e.g. "M README.md".
+	ChangedFiles []string `json:"changedFiles"`
+}
+
+// WriteFile writes the audit record as JSON to path.
+func (r *AuditRecord) WriteFile(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0600)
+}
+
+// changedFiles returns the entries of `git status --porcelain` output that
+// describe changes in the working tree compared to the index. Since the index
+// is updated after every step, these are the changes made by the last step.
+func changedFiles(porcelain []byte) []string {
+	files := []string{}
+	for _, line := range strings.Split(string(porcelain), "\n") {
+		if len(line) < 4 {
+			continue
+		}
+		// The second column is the status of the working tree compared to
+		// the index, "??" marks files that are not in the index yet.
+		switch status := line[1]; status {
+		case ' ':
+		case '?':
+			files = append(files, "A "+line[3:])
+		default:
+			files = append(files, string(status)+" "+line[3:])
+		}
+	}
+	return files
+}
@@ -0,0 +1,35 @@
+package campaigns
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestChangedFiles(t *testing.T) {
+	tests := map[string]struct {
+		porcelain string
+		want      []string
+	}{
+		"no changes": {
+			porcelain: "",
+			want:      []string{},
+		},
+		"changes of previous steps are ignored": {
+			porcelain: "M  README.md\nA  docs/new.md\n",
+			want:      []string{},
+		},
+		"changes of the last step": {
+			porcelain: "MM README.md\n M main.go\n D old.go\n?? docs/new.md\n",
+			want:      []string{"M README.md", "M main.go", "D old.go", "A docs/new.md"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.want, changedFiles([]byte(tc.porcelain))); diff != "" {
+				t.Errorf("unexpected changed files (-want +have):\n%s", diff)
+			}
+		})
+	}
+}
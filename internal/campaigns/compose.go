@@ -0,0 +1,216 @@
+package campaigns
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+)
+
+// ComposeActionDefinition resolves the "extends" property of the JSON action
+// definition def, which was read from path ("-" for standard input). It
+// returns the composed definition and the paths of all files it is composed
+// of, starting with path.
+//
+// "extends" is a path, or a list of paths, to other action definitions,
+// relative to the directory of the extending file. These are composed
+// recursively and merged in order, followed by def itself:
+//
+//   - "steps" are concatenated, so steps of extended definitions run first.
+//   - Every other property is overridden by later definitions.
+//
+// A file that is extended several times, e.g. by two definitions that extend
+// the same shared file, is only included the first time, so that its steps
+// don't run twice.
+//
+// The "build" paths of steps are relative to the file the step is defined in
+// and are made absolute, so that they keep referring to the same directory
+// after composition.
+//
+// If def uses neither "extends" nor "build", it is returned unchanged.
+func ComposeActionDefinition(path string, def []byte) ([]byte, []string, error) {
+	normalized, err := jsonxToJSON(string(def))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal(normalized, &doc); err != nil {
+		return nil, nil, errors.Wrap(err, "invalid JSON action file")
+	}
+	dir := "."
+	if path != "-" {
+		dir = filepath.Dir(path)
+	}
+
+	if _, ok := doc["extends"]; !ok {
+		changed, err := resolveBuildPaths(dir, doc)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, path)
+		}
+		if !changed {
+			return def, []string{path}, nil
+		}
+		data, err := json.Marshal(doc)
+		if err != nil {
+			return nil, nil, err
+		}
+		return data, []string{path}, nil
+	}
+	composer := &actionComposer{visiting: map[string]bool{}, included: map[string]bool{}}
+	if path != "-" {
+		if abs, err := filepath.Abs(path); err == nil {
+			composer.visiting[abs] = true
+		}
+	}
+	composer.stack = []string{path}
+	composed, err := composer.compose(dir, path, doc)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data, err := json.Marshal(composed)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, composer.sources, nil
+}
+
+type actionComposer struct {
+	// visiting and stack contain the files currently being composed, to
+	// detect cycles.
+	visiting map[string]bool
+	stack    []string
+	// included contains the absolute paths of the files that have already
+	// been composed, so that files extended several times are only included
+	// once.
+	included map[string]bool
+	sources  []string
+}
+
+func (c *actionComposer) compose(dir, path string, doc map[string]interface{}) (map[string]interface{}, error) {
+	c.sources = append(c.sources, path)
+
+	var extends []string
+	switch v := doc["extends"].(type) {
+	case nil:
+	case string:
+		extends = []string{v}
+	case []interface{}:
+		for _, e := range v {
+			s, ok := e.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s: extends must be a path or a list of paths", path)
+			}
+			extends = append(extends, s)
+		}
+	default:
+		return nil, fmt.Errorf("%s: extends must be a path or a list of paths", path)
+	}
+
+	if _, err := resolveBuildPaths(dir, doc); err != nil {
+		return nil, errors.Wrap(err, path)
+	}
+
+	composed := map[string]interface{}{}
+	for _, e := range extends {
+		basePath := e
+		if !filepath.IsAbs(basePath) {
+			basePath = filepath.Join(dir, basePath)
+		}
+		base, err := c.load(basePath)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s: extends %s", path, e)
+		}
+		if base != nil {
+			mergeActionDefinitions(composed, base)
+		}
+	}
+	mergeActionDefinitions(composed, doc)
+	delete(composed, "extends")
+
+	return composed, nil
+}
+
+// load reads and composes the action definition at path. It returns nil if
+// the file has already been included.
+func (c *actionComposer) load(path string) (map[string]interface{}, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	if c.visiting[abs] {
+		return nil, fmt.Errorf("cycle detected: %s", strings.Join(append(c.stack, path), " -> "))
+	}
+	if c.included[abs] {
+		return nil, nil
+	}
+	c.included[abs] = true
+	c.visiting[abs] = true
+	c.stack = append(c.stack, path)
+	defer func() {
+		delete(c.visiting, abs)
+		c.stack = c.stack[:len(c.stack)-1]
+	}()
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err = yaml.YAMLToJSONStrict(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to parse action file")
+	}
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, errors.Wrap(err, "invalid JSON action file")
+	}
+	return c.compose(filepath.Dir(path), path, doc)
+}
+
+// resolveBuildPaths makes the relative "build" paths of the steps in doc
+// absolute, resolving them against dir. It returns whether any path was
+// changed.
+func resolveBuildPaths(dir string, doc map[string]interface{}) (bool, error) {
+	steps, _ := doc["steps"].([]interface{})
+
+	changed := false
+	for _, s := range steps {
+		step, ok := s.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		build, ok := step["build"].(string)
+		if !ok || build == "" || filepath.IsAbs(build) {
+			continue
+		}
+		abs, err := filepath.Abs(filepath.Join(dir, build))
+		if err != nil {
+			return false, err
+		}
+		step["build"] = abs
+		changed = true
+	}
+	return changed, nil
+}
+
+// mergeActionDefinitions merges src into dst, appending steps and overriding
+// all other properties.
+func mergeActionDefinitions(dst, src map[string]interface{}) {
+	for k, v := range src {
+		if k == "steps" {
+			if existing, ok := dst[k].([]interface{}); ok {
+				if steps, ok := v.([]interface{}); ok {
+					dst[k] = append(existing, steps...)
+					continue
+				}
+			}
+		}
+		dst[k] = v
+	}
+}
@@ -0,0 +1,164 @@
+package campaigns
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestComposeActionDefinition(t *testing.T) {
+	dir, err := ioutil.TempDir("", "compose-action")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"shared/setup.yaml": `
+scopeQuery: repo:shared
+steps:
+  - type: command
+    args: ["setup"]
+`,
+		"shared/lint.json": `{
+  "extends": "setup.yaml",
+  "steps": [{"type": "command", "args": ["lint"]}]
+}`,
+		"shared/image.json": `{
+  "steps": [{"type": "docker", "build": "./image"}]
+}`,
+		"shared/test.json": `{
+  "extends": "setup.yaml",
+  "steps": [{"type": "command", "args": ["test"]}]
+}`,
+		"cycle-a.json": `{"extends": "cycle-b.json"}`,
+		"cycle-b.json": `{"extends": "cycle-a.json"}`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("no extends", func(t *testing.T) {
+		def := []byte(`{"scopeQuery": "repo:a", "steps": []}`)
+		have, sources, err := ComposeActionDefinition("action.json", def)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(have) != string(def) {
+			t.Errorf("definition was changed: %s", have)
+		}
+		if diff := cmp.Diff([]string{"action.json"}, sources); diff != "" {
+			t.Errorf("unexpected sources: %s", diff)
+		}
+	})
+
+	t.Run("extends", func(t *testing.T) {
+		path := filepath.Join(dir, "action.json")
+		def := []byte(`{"extends": ["shared/lint.json"], "scopeQuery": "repo:go-", "steps": [{"type": "command", "args": ["gofmt"]}]}`)
+		have, sources, err := ComposeActionDefinition(path, def)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var action Action
+		if err := json.Unmarshal(have, &action); err != nil {
+			t.Fatal(err)
+		}
+		want := Action{
+			ScopeQuery: "repo:go-",
+			Steps: []*ActionStep{
+				{Type: "command", Args: []string{"setup"}},
+				{Type: "command", Args: []string{"lint"}},
+				{Type: "command", Args: []string{"gofmt"}},
+			},
+		}
+		if diff := cmp.Diff(want, action); diff != "" {
+			t.Errorf("unexpected action: %s", diff)
+		}
+
+		wantSources := []string{path, filepath.Join(dir, "shared/lint.json"), filepath.Join(dir, "shared/setup.yaml")}
+		if diff := cmp.Diff(wantSources, sources); diff != "" {
+			t.Errorf("unexpected sources: %s", diff)
+		}
+		if err := ValidateActionDefinition(have); err != nil {
+			t.Errorf("composed definition is invalid: %s", err)
+		}
+	})
+
+	t.Run("diamond", func(t *testing.T) {
+		path := filepath.Join(dir, "action.json")
+		def := []byte(`{"extends": ["shared/lint.json", "shared/test.json", "shared/setup.yaml"], "steps": [{"type": "command", "args": ["gofmt"]}]}`)
+		have, sources, err := ComposeActionDefinition(path, def)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var action Action
+		if err := json.Unmarshal(have, &action); err != nil {
+			t.Fatal(err)
+		}
+		want := Action{
+			ScopeQuery: "repo:shared",
+			Steps: []*ActionStep{
+				{Type: "command", Args: []string{"setup"}},
+				{Type: "command", Args: []string{"lint"}},
+				{Type: "command", Args: []string{"test"}},
+				{Type: "command", Args: []string{"gofmt"}},
+			},
+		}
+		if diff := cmp.Diff(want, action); diff != "" {
+			t.Errorf("unexpected action: %s", diff)
+		}
+
+		wantSources := []string{path, filepath.Join(dir, "shared/lint.json"), filepath.Join(dir, "shared/setup.yaml"), filepath.Join(dir, "shared/test.json")}
+		if diff := cmp.Diff(wantSources, sources); diff != "" {
+			t.Errorf("unexpected sources: %s", diff)
+		}
+	})
+
+	t.Run("build paths", func(t *testing.T) {
+		path := filepath.Join(dir, "action.json")
+		def := []byte(`{"extends": "shared/image.json", "scopeQuery": "repo:go-", "steps": [{"type": "docker", "build": "tools", "image": "tools:latest"}]}`)
+		have, _, err := ComposeActionDefinition(path, def)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var action Action
+		if err := json.Unmarshal(have, &action); err != nil {
+			t.Fatal(err)
+		}
+		want := Action{
+			ScopeQuery: "repo:go-",
+			Steps: []*ActionStep{
+				{Type: "docker", Build: filepath.Join(dir, "shared/image")},
+				{Type: "docker", Build: filepath.Join(dir, "tools"), Image: "tools:latest"},
+			},
+		}
+		if diff := cmp.Diff(want, action); diff != "" {
+			t.Errorf("unexpected action: %s", diff)
+		}
+		if err := ValidateActionDefinition(have); err != nil {
+			t.Errorf("composed definition is invalid: %s", err)
+		}
+	})
+
+	t.Run("cycle", func(t *testing.T) {
+		path := filepath.Join(dir, "cycle-a.json")
+		_, _, err := ComposeActionDefinition(path, []byte(files["cycle-a.json"]))
+		if err == nil || !strings.Contains(err.Error(), "cycle detected") {
+			t.Errorf("expected cycle error, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,89 @@
+package campaigns
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// DownloadLimiter limits the combined rate at which repository archives are
+// downloaded, so that executing an action doesn't saturate the network. It can
+// be shared by executors. A nil *DownloadLimiter doesn't limit the rate.
+type DownloadLimiter struct {
+	bytesPerSecond int64
+
+	mu sync.Mutex
+	// next is when the bytes read so far are read at the limited rate.
+	next time.Time
+}
+
+// NewDownloadLimiter returns a limiter for the given rate, or nil if
+// bytesPerSecond isn't positive.
+func NewDownloadLimiter(bytesPerSecond int64) *DownloadLimiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	return &DownloadLimiter{bytesPerSecond: bytesPerSecond}
+}
+
+// reader returns a reader that reads from r at the limited rate.
+func (l *DownloadLimiter) reader(ctx context.Context, r io.Reader) io.Reader {
+	if l == nil {
+		return r
+	}
+	return &limitedReader{ctx: ctx, r: r, l: l}
+}
+
+// chunkSize is the maximum number of bytes read at once, so that reading is
+// spread evenly over each second.
+func (l *DownloadLimiter) chunkSize() int {
+	size := l.bytesPerSecond / 10
+	if size < 1024 {
+		size = 1024
+	}
+	if size > 32*1024 {
+		size = 32 * 1024
+	}
+	return int(size)
+}
+
+// wait blocks until n more bytes have been read at the limited rate.
+func (l *DownloadLimiter) wait(ctx context.Context, n int) error {
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(time.Duration(float64(n) / float64(l.bytesPerSecond) * float64(time.Second)))
+	delay := l.next.Sub(now)
+	l.mu.Unlock()
+
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+type limitedReader struct {
+	ctx context.Context
+	r   io.Reader
+	l   *DownloadLimiter
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	if size := r.l.chunkSize(); len(p) > size {
+		p = p[:size]
+	}
+	n, err := r.r.Read(p)
+	if n > 0 {
+		if werr := r.l.wait(r.ctx, n); werr != nil && err == nil {
+			err = werr
+		}
+	}
+	return n, err
+}
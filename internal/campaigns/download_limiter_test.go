@@ -0,0 +1,54 @@
+package campaigns
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestDownloadLimiter(t *testing.T) {
+	t.Run("nil", func(t *testing.T) {
+		var l *DownloadLimiter
+		r := bytes.NewReader(nil)
+		if have := l.reader(context.Background(), r); have != io.Reader(r) {
+			t.Error("nil limiter wrapped the reader")
+		}
+	})
+
+	t.Run("limited", func(t *testing.T) {
+		// Two readers share the limit of 100 KB/s, so reading 20 KB takes
+		// at least 200ms.
+		l := NewDownloadLimiter(100 * 1000)
+		start := time.Now()
+		done := make(chan error, 2)
+		for i := 0; i < 2; i++ {
+			go func() {
+				n, err := io.Copy(ioutil.Discard, l.reader(context.Background(), bytes.NewReader(make([]byte, 10*1000))))
+				if err == nil && n != 10*1000 {
+					err = io.ErrShortWrite
+				}
+				done <- err
+			}()
+		}
+		for i := 0; i < 2; i++ {
+			if err := <-done; err != nil {
+				t.Fatal(err)
+			}
+		}
+		if took := time.Since(start); took < 190*time.Millisecond {
+			t.Errorf("reading took %s, want at least 200ms", took)
+		}
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		l := NewDownloadLimiter(1000)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := io.Copy(ioutil.Discard, l.reader(ctx, bytes.NewReader(make([]byte, 10*1000)))); err != context.Canceled {
+			t.Errorf("have error %v, want %v", err, context.Canceled)
+		}
+	})
+}
@@ -1,6 +1,8 @@
 package campaigns
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"crypto/sha256"
 	"encoding/base64"
@@ -8,6 +10,9 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -23,6 +28,29 @@ func UserCacheDir() (string, error) {
 type ExecutionCacheKey struct {
 	Repo ActionRepo
 	Runs []*ActionStep
+
+	// Hooks can change the result, so executions with different hooks are
+	// cached separately. Only their paths are part of the key.
+	Hooks *Hooks `json:",omitempty"`
+
+	// SingleContainer is part of the key since the files a step leaves
+	// outside of the workspace are only seen by the following steps if they
+	// run in the same container, see ExecutorOpts.SingleContainer.
+	SingleContainer bool `json:",omitempty"`
+
+	// GitLFS and Submodules are part of the key since workspaces that are
+	// cloned with them contain files that archives don't, see
+	// ExecutorOpts.GitLFS.
+	GitLFS     bool `json:",omitempty"`
+	Submodules bool `json:",omitempty"`
+}
+
+// NewExecutionCacheKey returns the key the result of executing action in repo
+// with hooks, and in a single container if singleContainer is true, is cached
+// under. Commands that look up cached results without executing the action
+// must use it to find the results of the executor.
+func NewExecutionCacheKey(repo ActionRepo, action Action, hooks *Hooks, singleContainer bool) ExecutionCacheKey {
+	return ExecutionCacheKey{Repo: repo, Runs: action.Steps, Hooks: hooks, SingleContainer: singleContainer}
 }
 
 type ExecutionCache interface {
@@ -31,54 +59,140 @@ type ExecutionCache interface {
 	Clear(ctx context.Context, key ExecutionCacheKey) error
 }
 
+// TimedExecutionCache is an ExecutionCache that also stores how long the
+// executions whose results it caches took, so that the time saved by cache
+// hits can be estimated. The executor uses these methods if available.
+type TimedExecutionCache interface {
+	ExecutionCache
+
+	// GetTimed is like Get, but also returns the duration of the execution
+	// that produced the result, or 0 if it's unknown.
+	GetTimed(ctx context.Context, key ExecutionCacheKey) (result PatchInput, took time.Duration, ok bool, err error)
+
+	// SetTimed is like Set, but also stores the duration of the execution.
+	SetTimed(ctx context.Context, key ExecutionCacheKey, result PatchInput, took time.Duration) error
+}
+
+// diskCacheEntry is the content of a cache file. The fields of the result
+// are inlined, so that entries written before the duration was added can
+// still be read. They are spelled out instead of embedding PatchInput, whose
+// MarshalJSON method would otherwise leave out Took.
+type diskCacheEntry struct {
+	Repository   string        `json:"repository"`
+	BaseRevision string        `json:"baseRevision"`
+	BaseRef      string        `json:"baseRef"`
+	Patch        string        `json:"patch"`
+	Took         time.Duration `json:"took,omitempty"`
+}
+
+// ExecutionDiskCache stores execution results as gzip-compressed JSON files in
+// Dir. If MaxSize is greater than zero, the least recently used entries are
+// removed whenever the total size of the entries exceeds MaxSize bytes.
 type ExecutionDiskCache struct {
-	Dir string
+	Dir     string
+	MaxSize int64
 }
 
-func (c ExecutionDiskCache) cacheFilePath(key ExecutionCacheKey) (string, error) {
+const (
+	cacheFileExt = ".json.gz"
+	// legacyCacheFileExt is the extension of the uncompressed entries written
+	// by earlier versions, which are still read.
+	legacyCacheFileExt = ".json"
+)
+
+// Hash returns the string that identifies the cache entry for the key.
+func (key ExecutionCacheKey) Hash() (string, error) {
 	keyJSON, err := json.Marshal(key)
 	if err != nil {
 		return "", errors.Wrap(err, "Failed to marshal JSON when generating action cache key")
 	}
 
 	b := sha256.Sum256(keyJSON)
-	keyString := base64.RawURLEncoding.EncodeToString(b[:16])
+	return base64.RawURLEncoding.EncodeToString(b[:16]), nil
+}
 
-	return filepath.Join(c.Dir, keyString+".json"), nil
+func (c ExecutionDiskCache) cacheFilePath(key ExecutionCacheKey) (string, error) {
+	keyString, err := key.Hash()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(c.Dir, keyString+cacheFileExt), nil
 }
 
 func (c ExecutionDiskCache) Get(ctx context.Context, key ExecutionCacheKey) (PatchInput, bool, error) {
+	result, _, ok, err := c.GetTimed(ctx, key)
+	return result, ok, err
+}
+
+func (c ExecutionDiskCache) GetTimed(ctx context.Context, key ExecutionCacheKey) (PatchInput, time.Duration, bool, error) {
 	path, err := c.cacheFilePath(key)
 	if err != nil {
-		return PatchInput{}, false, err
+		return PatchInput{}, 0, false, err
 	}
 
-	data, err := ioutil.ReadFile(path)
+	data, err := readCacheFile(path)
+	if os.IsNotExist(err) {
+		path = strings.TrimSuffix(path, cacheFileExt) + legacyCacheFileExt
+		data, err = ioutil.ReadFile(path)
+	}
 	if err != nil {
 		if os.IsNotExist(err) {
 			err = nil // treat as not-found
 		}
-		return PatchInput{}, false, err
+		return PatchInput{}, 0, false, err
 	}
 
-	var result PatchInput
-	if err := json.Unmarshal(data, &result); err != nil {
+	var entry diskCacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
 		// Delete the invalid data to avoid causing an error for next time.
 		if err := os.Remove(path); err != nil {
-			return PatchInput{}, false, errors.Wrap(err, "while deleting cache file with invalid JSON")
+			return PatchInput{}, 0, false, errors.Wrap(err, "while deleting cache file with invalid JSON")
 		}
-		return PatchInput{}, false, errors.Wrapf(err, "reading cache file %s", path)
+		return PatchInput{}, 0, false, errors.Wrapf(err, "reading cache file %s", path)
 	}
 
-	return result, true, nil
+	// The modification time is used to determine the least recently used
+	// entries.
+	now := time.Now()
+	if err := os.Chtimes(path, now, now); err != nil {
+		return PatchInput{}, 0, false, err
+	}
+
+	result := PatchInput{
+		Repository:   entry.Repository,
+		BaseRevision: entry.BaseRevision,
+		BaseRef:      entry.BaseRef,
+		Patch:        entry.Patch,
+	}
+	return result, entry.Took, true, nil
 }
 
-func (c ExecutionDiskCache) Set(ctx context.Context, key ExecutionCacheKey, result PatchInput) error {
-	data, err := json.Marshal(result)
+// readCacheFile reads and decompresses the cache file at path. Invalid
+// compressed data is returned as no data, so that it's handled like invalid JSON.
+func readCacheFile(path string) ([]byte, error) {
+	f, err := os.Open(path)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer f.Close()
+
+	r, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, nil
+	}
+	defer r.Close()
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, nil
+	}
+	return data, nil
+}
+
+func (c ExecutionDiskCache) Set(ctx context.Context, key ExecutionCacheKey, result PatchInput) error {
+	return c.SetTimed(ctx, key, result, 0)
+}
 
+func (c ExecutionDiskCache) SetTimed(ctx context.Context, key ExecutionCacheKey, result PatchInput, took time.Duration) error {
 	path, err := c.cacheFilePath(key)
 	if err != nil {
 		return err
@@ -88,7 +202,79 @@ func (c ExecutionDiskCache) Set(ctx context.Context, key ExecutionCacheKey, resu
 		return err
 	}
 
-	return ioutil.WriteFile(path, data, 0600)
+	result, err = result.loadPatch()
+	if err != nil {
+		return err
+	}
+	entry := diskCacheEntry{
+		Repository:   result.Repository,
+		BaseRevision: result.BaseRevision,
+		BaseRef:      result.BaseRef,
+		Patch:        result.Patch,
+		Took:         took,
+	}
+
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(w).Encode(entry); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0600); err != nil {
+		return err
+	}
+	// An entry written by an earlier version is superseded.
+	if err := os.Remove(strings.TrimSuffix(path, cacheFileExt) + legacyCacheFileExt); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return c.evict(path)
+}
+
+// evict removes the least recently used entries until the total size of the
+// entries is at most MaxSize. The entry at keep, which was just written, is
+// never removed.
+func (c ExecutionDiskCache) evict(keep string) error {
+	if c.MaxSize <= 0 {
+		return nil
+	}
+
+	infos, err := ioutil.ReadDir(c.Dir)
+	if err != nil {
+		return err
+	}
+
+	var (
+		entries []os.FileInfo
+		size    int64
+	)
+	for _, info := range infos {
+		if info.IsDir() || !(strings.HasSuffix(info.Name(), cacheFileExt) || strings.HasSuffix(info.Name(), legacyCacheFileExt)) {
+			continue
+		}
+		entries = append(entries, info)
+		size += info.Size()
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ModTime().Before(entries[j].ModTime()) })
+	for _, info := range entries {
+		if size <= c.MaxSize {
+			break
+		}
+		path := filepath.Join(c.Dir, info.Name())
+		if path == keep {
+			continue
+		}
+		// Another process may have removed the entry in the meantime.
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		size -= info.Size()
+	}
+	return nil
 }
 
 func (c ExecutionDiskCache) Clear(ctx context.Context, key ExecutionCacheKey) error {
@@ -97,11 +283,12 @@ func (c ExecutionDiskCache) Clear(ctx context.Context, key ExecutionCacheKey) er
 		return err
 	}
 
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		return nil
+	for _, p := range []string{path, strings.TrimSuffix(path, cacheFileExt) + legacyCacheFileExt} {
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			return err
+		}
 	}
-
-	return os.Remove(path)
+	return nil
 }
 
 // ExecutionNoOpCache is an implementation of actionExecutionCache that does not store or
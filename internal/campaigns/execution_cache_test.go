@@ -0,0 +1,146 @@
+package campaigns
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestExecutionDiskCache(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "execution-cache-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	key := func(repo string) ExecutionCacheKey {
+		return ExecutionCacheKey{Repo: ActionRepo{Name: repo}, Runs: []*ActionStep{{Type: "docker", Image: "alpine:3"}}}
+	}
+	patch := func(repo string) PatchInput {
+		return PatchInput{Repository: repo, Patch: strings.Repeat("+ hello world\n", 1000)}
+	}
+
+	t.Run("compressed", func(t *testing.T) {
+		cache := ExecutionDiskCache{Dir: dir}
+		if err := cache.Set(ctx, key("a"), patch("a")); err != nil {
+			t.Fatal(err)
+		}
+		have, ok, err := cache.Get(ctx, key("a"))
+		if err != nil || !ok {
+			t.Fatalf("unexpected result: ok %v, err %v", ok, err)
+		}
+		if diff := cmp.Diff(patch("a"), have); diff != "" {
+			t.Errorf("unexpected patch (-want +have):\n%s", diff)
+		}
+
+		path, _ := cache.cacheFilePath(key("a"))
+		if info, err := os.Stat(path); err != nil {
+			t.Fatal(err)
+		} else if info.Size() >= int64(len(patch("a").Patch)) {
+			t.Errorf("cache entry is not compressed: %d bytes", info.Size())
+		}
+	})
+
+	t.Run("legacy entries", func(t *testing.T) {
+		cache := ExecutionDiskCache{Dir: dir}
+		path, _ := cache.cacheFilePath(key("legacy"))
+		legacyPath := strings.TrimSuffix(path, cacheFileExt) + legacyCacheFileExt
+		data, _ := json.Marshal(patch("legacy"))
+		if err := ioutil.WriteFile(legacyPath, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		have, ok, err := cache.Get(ctx, key("legacy"))
+		if err != nil || !ok {
+			t.Fatalf("unexpected result: ok %v, err %v", ok, err)
+		}
+		if diff := cmp.Diff(patch("legacy"), have); diff != "" {
+			t.Errorf("unexpected patch (-want +have):\n%s", diff)
+		}
+
+		if err := cache.Clear(ctx, key("legacy")); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(legacyPath); !os.IsNotExist(err) {
+			t.Errorf("legacy entry was not cleared: %v", err)
+		}
+	})
+
+	t.Run("timed", func(t *testing.T) {
+		cache := ExecutionDiskCache{Dir: dir}
+		if err := cache.SetTimed(ctx, key("timed"), patch("timed"), 90*time.Second); err != nil {
+			t.Fatal(err)
+		}
+		have, took, ok, err := cache.GetTimed(ctx, key("timed"))
+		if err != nil || !ok {
+			t.Fatalf("unexpected result: ok %v, err %v", ok, err)
+		}
+		if diff := cmp.Diff(patch("timed"), have); diff != "" {
+			t.Errorf("unexpected patch (-want +have):\n%s", diff)
+		}
+		if took != 90*time.Second {
+			t.Errorf("unexpected duration %s", took)
+		}
+
+		// Entries without a duration, e.g. written by Set or earlier
+		// versions, have an unknown duration.
+		if _, took, ok, err := cache.GetTimed(ctx, key("a")); err != nil || !ok || took != 0 {
+			t.Errorf("unexpected result: duration %s, ok %v, err %v", took, ok, err)
+		}
+	})
+
+	t.Run("eviction", func(t *testing.T) {
+		evictDir := filepath.Join(dir, "evict")
+		cache := ExecutionDiskCache{Dir: evictDir}
+		for _, repo := range []string{"a", "b", "c"} {
+			if err := cache.Set(ctx, key(repo), patch(repo)); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// Pretend the entries were written minutes ago, in order, and that
+		// "b" was used since.
+		for i, repo := range []string{"a", "b", "c"} {
+			path, _ := cache.cacheFilePath(key(repo))
+			mtime := time.Now().Add(time.Duration(i-10) * time.Minute)
+			if err := os.Chtimes(path, mtime, mtime); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, _, err := cache.Get(ctx, key("b")); err != nil {
+			t.Fatal(err)
+		}
+
+		// With room for two entries, writing "d" evicts "a" and "c", the
+		// least recently used entries.
+		path, _ := cache.cacheFilePath(key("a"))
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cache.MaxSize = 2*info.Size() + info.Size()/2
+		if err := cache.Set(ctx, key("d"), patch("d")); err != nil {
+			t.Fatal(err)
+		}
+
+		var have []string
+		for _, repo := range []string{"a", "b", "c", "d"} {
+			if _, ok, err := cache.Get(ctx, key(repo)); err != nil {
+				t.Fatal(err)
+			} else if ok {
+				have = append(have, repo)
+			}
+		}
+		if diff := cmp.Diff([]string{"b", "d"}, have); diff != "" {
+			t.Errorf("unexpected cached entries (-want +have):\n%s", diff)
+		}
+	})
+}
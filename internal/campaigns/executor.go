@@ -3,17 +3,25 @@ package campaigns
 import (
 	"context"
 	"fmt"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/neelance/parallel"
 	"github.com/pkg/errors"
+	"github.com/sourcegraph/src-cli/internal/api"
+	"github.com/sourcegraph/src-cli/internal/tracing"
 )
 
 type ActionRepoStatus struct {
 	Cached bool
+	// CachedDuration is how long the execution that produced the cached
+	// result took, or 0 if it's unknown.
+	CachedDuration time.Duration
 
 	LogFile    string
 	EnqueuedAt time.Time
@@ -22,18 +30,98 @@ type ActionRepoStatus struct {
 
 	Patch PatchInput
 	Err   error
+
+	// Cancelled is set if the execution in the repository was cancelled or
+	// not started because it failed in another repository, see
+	// ExecutorOpts.FailFast.
+	Cancelled bool
 }
 
 type ExecutorOpts struct {
 	Endpoint          string
 	AccessToken       string
 	AdditionalHeaders map[string]string
+	// ImpersonateUser is the user the repository archives are downloaded as,
+	// like with api.ClientOpts.ImpersonateUser.
+	ImpersonateUser string
 
 	KeepLogs bool
 	Timeout  time.Duration
 
+	// RunID is the ID of the execution, see NewRunID. It is recorded in the
+	// audit records.
+	RunID string
+
+	// DownloadParallelism is the number of repository archives that are
+	// downloaded concurrently, independently of the number of repositories in
+	// which steps are executed concurrently. Defaults to the latter.
+	DownloadParallelism int
+	// DownloadLimiter, if set, limits the rate at which repository archives
+	// are downloaded.
+	DownloadLimiter *DownloadLimiter
+
+	// Audit causes an AuditRecord to be written next to the log file of each
+	// repository, which is kept even if KeepLogs is not set.
+	Audit bool
+
+	// SkipSymlinks causes symbolic links in repository archives to be
+	// skipped instead of recreated in the workspace.
+	SkipSymlinks bool
+
+	// GitLFS and Submodules cause the workspaces to be created by cloning the
+	// repositories at their revision from CloneURL, instead of from archives,
+	// which contain neither Git LFS objects nor the contents of submodules.
+	// GitLFS fetches the LFS objects and Submodules initializes the
+	// submodules of the clone. CloneURL returns the URL to clone a repository
+	// from and defaults to "https://" followed by its name and ".git".
+	GitLFS     bool
+	Submodules bool
+	CloneURL   func(repo ActionRepo) (string, error)
+
+	// MaxDiffSize is the maximum size in bytes of the diff produced in a
+	// single repository. 0 means no limit.
+	MaxDiffSize int64
+
+	// PatchDir, if set, is the directory in which the patches are kept until
+	// they are used, instead of memory. The patches returned by AllPatches
+	// then refer to files in PatchDir, see PatchInput.PatchFile. The caller
+	// is responsible for removing the directory.
+	PatchDir string
+
+	// SingleContainer causes the docker steps in each repository to be
+	// executed in a single container, so that changes they make outside
+	// of the workspace persist between them. See ValidateSingleContainer.
+	SingleContainer bool
+
+	// ArtifactsDir, if set, is the directory into which the files matching
+	// the "artifacts" of the steps are copied, under the name of the
+	// repository and the number of the step, e.g.
+	// github.com/my-org/my-repo/step-1/report.xml. Artifacts are only copied
+	// when the steps are executed, not for cached results.
+	ArtifactsDir string
+
+	// Secrets contains the values of the secrets the steps refer to. See
+	// CheckSecrets.
+	Secrets Secrets
+
+	// Hooks, if set, are run before and after the steps in each repository.
+	Hooks *Hooks
+
+	// StallTimeout is the duration after which a step that produces no
+	// output is considered stalled. OnStall is the mode for handling stalled
+	// steps, e.g. OnStallWarn. A StallTimeout of 0 disables the detection.
+	StallTimeout time.Duration
+	OnStall      string
+
+	// FailFast causes the first failed execution to cancel the executions in
+	// progress, including their containers, and to stop starting new ones.
+	FailFast bool
+
 	ClearCache bool
 	Cache      ExecutionCache
+
+	// Metrics, if set, collects counters and timings about the execution.
+	Metrics *Metrics
 }
 
 type Executor struct {
@@ -43,24 +131,49 @@ type Executor struct {
 	reposMu sync.Mutex
 	repos   map[ActionRepo]ActionRepoStatus
 
-	par           *parallel.Run
+	// par limits the number of repositories that are in flight, i.e. waiting
+	// for or in one of the two stages below, and collects their errors.
+	par *parallel.Run
+	// downloads limits the number of concurrent archive downloads.
+	downloads *parallel.Run
+	// executions limits the number of repositories in which steps are run
+	// concurrently.
+	executions *parallel.Run
+
 	doneEnqueuing chan struct{}
 
+	// cancel cancels the context of the executions. stopped is set once the
+	// execution failed in a repository and FailFast is set.
+	cancel  context.CancelFunc
+	stopped bool
+
 	logger *ActionLogger
 }
 
+// errCancelled is the error of executions that were cancelled because the
+// execution failed in another repository, see ExecutorOpts.FailFast.
+var errCancelled = errors.New("Cancelled because the execution failed in another repository.")
+
 func NewExecutor(action Action, parallelism int, logger *ActionLogger, opt ExecutorOpts) *Executor {
 	if opt.Cache == nil {
 		opt.Cache = ExecutionNoOpCache{}
 	}
+	if opt.DownloadParallelism <= 0 {
+		opt.DownloadParallelism = parallelism
+	}
 
 	return &Executor{
 		action: action,
 		opt:    opt,
 		repos:  map[ActionRepo]ActionRepoStatus{},
-		par:    parallel.NewRun(parallelism),
 		logger: logger,
 
+		// Allow each download slot to fetch one archive ahead of the
+		// executions, so that archives don't pile up on disk.
+		par:        parallel.NewRun(parallelism + opt.DownloadParallelism),
+		downloads:  parallel.NewRun(opt.DownloadParallelism),
+		executions: parallel.NewRun(parallelism),
+
 		doneEnqueuing: make(chan struct{}),
 	}
 }
@@ -93,6 +206,7 @@ func (x *Executor) updateRepoStatus(repo ActionRepo, status ActionRepoStatus) {
 	if status.Err == nil {
 		status.Err = prev.Err
 	}
+	status.Cancelled = status.Cancelled || prev.Cancelled
 
 	x.repos[repo] = status
 }
@@ -109,7 +223,34 @@ func (x *Executor) AllPatches() []PatchInput {
 	return patches
 }
 
+// Stats returns statistics about the effectiveness of the cache for the
+// repositories that are done.
+func (x *Executor) Stats() ExecutionStats {
+	x.reposMu.Lock()
+	defer x.reposMu.Unlock()
+
+	var stats ExecutionStats
+	for repo, status := range x.repos {
+		switch {
+		case status.Cached:
+			stats.CacheHits++
+			if status.CachedDuration > 0 {
+				stats.TimeSaved += status.CachedDuration
+			} else {
+				stats.UnknownSaved++
+			}
+		case !status.FinishedAt.IsZero():
+			stats.Executions++
+			stats.Slowest = append(stats.Slowest, RepoDuration{Repo: repo.Name, Duration: status.FinishedAt.Sub(status.StartedAt)})
+		}
+	}
+	stats.Slowest = slowestRepos(stats.Slowest)
+	return stats
+}
+
 func (x *Executor) Start(ctx context.Context) {
+	ctx, x.cancel = context.WithCancel(ctx)
+
 	x.reposMu.Lock()
 	allRepos := make([]ActionRepo, 0, len(x.repos))
 	for repo := range x.repos {
@@ -119,11 +260,23 @@ func (x *Executor) Start(ctx context.Context) {
 
 	for _, repo := range allRepos {
 		x.par.Acquire()
+		if x.isStopped() {
+			x.par.Release()
+			x.updateRepoStatus(repo, ActionRepoStatus{Cancelled: true})
+			continue
+		}
 		go func(repo ActionRepo) {
 			defer x.par.Release()
 			err := x.do(ctx, repo)
-			if err != nil {
-				x.par.Error(err)
+			if err == nil || err == errCancelled {
+				return
+			}
+			// Errors returned before the execution started, e.g. by the
+			// cache, aren't recorded in the status yet.
+			x.updateRepoStatus(repo, ActionRepoStatus{Err: err})
+			x.par.Error(err)
+			if x.opt.FailFast {
+				x.stop()
 			}
 		}(repo)
 	}
@@ -133,25 +286,87 @@ func (x *Executor) Start(ctx context.Context) {
 
 func (x *Executor) Wait() error {
 	<-x.doneEnqueuing
-	return x.par.Wait()
+	err := x.par.Wait()
+	x.cancel()
+	return err
+}
+
+// stop cancels the executions in progress and prevents new ones from being
+// started.
+func (x *Executor) stop() {
+	x.reposMu.Lock()
+	x.stopped = true
+	x.reposMu.Unlock()
+	x.cancel()
+}
+
+func (x *Executor) isStopped() bool {
+	x.reposMu.Lock()
+	defer x.reposMu.Unlock()
+	return x.stopped
+}
+
+// Cancelled returns the repositories in which the execution was cancelled or
+// not started because it failed in another repository, sorted by name. See
+// ExecutorOpts.FailFast.
+func (x *Executor) Cancelled() []ActionRepo {
+	x.reposMu.Lock()
+	defer x.reposMu.Unlock()
+
+	var repos []ActionRepo
+	for repo, status := range x.repos {
+		if status.Cancelled {
+			repos = append(repos, repo)
+		}
+	}
+	sort.Slice(repos, func(i, j int) bool { return repos[i].Name < repos[j].Name })
+	return repos
+}
+
+// Failed returns the repositories in which the execution failed, sorted by
+// name. Repositories in which it was cancelled are not included.
+func (x *Executor) Failed() []ActionRepo {
+	x.reposMu.Lock()
+	defer x.reposMu.Unlock()
+
+	var repos []ActionRepo
+	for repo, status := range x.repos {
+		if status.Err != nil && !status.Cancelled {
+			repos = append(repos, repo)
+		}
+	}
+	sort.Slice(repos, func(i, j int) bool { return repos[i].Name < repos[j].Name })
+	return repos
 }
 
 func (x *Executor) do(ctx context.Context, repo ActionRepo) (err error) {
+	span, ctx := tracing.StartSpan(ctx, "Execute action")
+	span.SetAttribute("repository", repo.Name)
+	span.SetAttribute("revision", repo.Rev)
+	defer func() { span.Finish(err) }()
+
 	// Check if cached.
-	cacheKey := ExecutionCacheKey{Repo: repo, Runs: x.action.Steps}
+	cacheKey := NewExecutionCacheKey(repo, x.action, x.opt.Hooks, x.opt.SingleContainer)
+	cacheKey.GitLFS, cacheKey.Submodules = x.opt.GitLFS, x.opt.Submodules
 	if x.opt.ClearCache {
 		if err := x.opt.Cache.Clear(ctx, cacheKey); err != nil {
 			return errors.Wrapf(err, "clearing cache for %s", repo.Name)
 		}
 	} else {
-		if result, ok, err := x.opt.Cache.Get(ctx, cacheKey); err != nil {
+		if result, took, ok, err := x.cacheGet(ctx, cacheKey); err != nil {
 			return errors.Wrapf(err, "checking cache for %s", repo.Name)
 		} else if ok {
-			status := ActionRepoStatus{Cached: true, Patch: result}
+			span.SetAttribute("cached", true)
+			x.opt.Metrics.CacheHit()
+			if result, err = x.storePatch(result); err != nil {
+				return errors.Wrapf(err, "storing cached patch for %s", repo.Name)
+			}
+			status := ActionRepoStatus{Cached: true, CachedDuration: took, Patch: result}
 			x.updateRepoStatus(repo, status)
 			x.logger.RepoCacheHit(repo, len(x.action.Steps), status.Patch != PatchInput{})
 			return nil
 		}
+		x.opt.Metrics.CacheMiss()
 	}
 
 	prefix := "action-" + strings.Replace(strings.Replace(repo.Name, "/", "-", -1), "github.com-", "", -1)
@@ -161,35 +376,52 @@ func (x *Executor) do(ctx context.Context, repo ActionRepo) (err error) {
 		return errors.Wrapf(err, "failed to setup logging for repo %s", repo.Name)
 	}
 
+	startedAt := time.Now()
 	x.updateRepoStatus(repo, ActionRepoStatus{
 		LogFile:   logFileName,
-		StartedAt: time.Now(),
+		StartedAt: startedAt,
 	})
 
-	runCtx, cancel := context.WithTimeout(ctx, x.opt.Timeout)
-	defer cancel()
+	x.logger.RepoStarted(repo.Name, repo.Rev, x.action.Steps)
 
-	patch, err := runAction(runCtx, x.opt.Endpoint, x.opt.AccessToken, x.opt.AdditionalHeaders, prefix, repo.Name, repo.Rev, x.action.Steps, x.logger)
+	var zipFile, patchFile string
+	// Repositories that are cloned aren't downloaded as archives, but cloned
+	// once there is an execution slot.
+	if !x.cloning() {
+		if zipFile, err = x.fetchArchive(ctx, repo); err == nil {
+			defer os.Remove(zipFile)
+		}
+	}
+	if err == nil {
+		patchFile, err = x.execute(ctx, repo, prefix, zipFile)
+	}
 	status := ActionRepoStatus{
 		FinishedAt: time.Now(),
 	}
-	if len(patch) > 0 {
+	if patchFile != "" {
 		status.Patch = PatchInput{
 			Repository:   repo.ID,
 			BaseRevision: repo.Rev,
 			BaseRef:      repo.BaseRef,
-			Patch:        string(patch),
+			PatchFile:    patchFile,
+		}
+		if x.opt.PatchDir == "" {
+			// Without a PatchDir, the patches are kept in memory.
+			status.Patch, err = status.Patch.loadPatch()
+			os.Remove(patchFile)
 		}
 	}
+	if err != nil && x.isStopped() {
+		err = errCancelled
+		status.Cancelled = true
+	}
 	if err != nil {
-		if reachedTimeout(runCtx, err) {
-			err = &errTimeoutReached{timeout: x.opt.Timeout}
-		}
 		status.Err = err
 	}
+	x.opt.Metrics.TaskFinished(err)
 
 	x.updateRepoStatus(repo, status)
-	lerr := x.logger.RepoFinished(repo.Name, len(patch) > 0, err)
+	lerr := x.logger.RepoFinished(repo.Name, status.Patch != PatchInput{}, err)
 	if lerr != nil {
 		return lerr
 	}
@@ -198,7 +430,7 @@ func (x *Executor) do(ctx context.Context, repo ActionRepo) (err error) {
 	if err == nil {
 		// We don't use runCtx here because we want to write to the cache even
 		// if we've now reached the timeout
-		if err := x.opt.Cache.Set(ctx, cacheKey, status.Patch); err != nil {
+		if err := x.cacheSet(ctx, cacheKey, status.Patch, status.FinishedAt.Sub(startedAt)); err != nil {
 			return errors.Wrapf(err, "caching result for %s", repo.Name)
 		}
 	}
@@ -206,10 +438,195 @@ func (x *Executor) do(ctx context.Context, repo ActionRepo) (err error) {
 	return err
 }
 
-type errTimeoutReached struct{ timeout time.Duration }
+// cloning returns whether the workspaces are created by cloning the
+// repositories instead of from archives.
+func (x *Executor) cloning() bool {
+	return x.opt.GitLFS || x.opt.Submodules
+}
+
+// cloneURL returns the URL to clone repo from, see ExecutorOpts.CloneURL.
+func (x *Executor) cloneURL(repo ActionRepo) (string, error) {
+	if x.opt.CloneURL == nil {
+		return "https://" + repo.Name + ".git", nil
+	}
+	url, err := x.opt.CloneURL(repo)
+	return url, errors.Wrapf(err, "determining the clone URL of %s", repo.Name)
+}
+
+// storePatch writes the patch of a cached result to a file in PatchDir, if
+// set, so that cached patches aren't kept in memory either.
+func (x *Executor) storePatch(result PatchInput) (PatchInput, error) {
+	if x.opt.PatchDir == "" || result.Patch == "" {
+		return result, nil
+	}
+	path, err := writeDiffFile(x.opt.PatchDir, "action-cached", result.Patch)
+	if err != nil {
+		return result, err
+	}
+	result.Patch, result.PatchFile = "", path
+	return result, nil
+}
+
+// cacheGet looks up the cached result for key, along with the duration of
+// the execution that produced it if the cache records it.
+func (x *Executor) cacheGet(ctx context.Context, key ExecutionCacheKey) (PatchInput, time.Duration, bool, error) {
+	if cache, ok := x.opt.Cache.(TimedExecutionCache); ok {
+		return cache.GetTimed(ctx, key)
+	}
+	result, ok, err := x.opt.Cache.Get(ctx, key)
+	return result, 0, ok, err
+}
+
+// cacheSet caches the result for key, along with the duration of the
+// execution if the cache records it.
+func (x *Executor) cacheSet(ctx context.Context, key ExecutionCacheKey, result PatchInput, took time.Duration) error {
+	if cache, ok := x.opt.Cache.(TimedExecutionCache); ok {
+		return cache.SetTimed(ctx, key, result, took)
+	}
+	return x.opt.Cache.Set(ctx, key, result)
+}
+
+// fetchArchive downloads the archive of the repository once a download slot
+// is free and returns the path of the downloaded file.
+func (x *Executor) fetchArchive(ctx context.Context, repo ActionRepo) (string, error) {
+	x.downloads.Acquire()
+	defer x.downloads.Release()
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	fetchCtx, cancel := context.WithTimeout(ctx, x.opt.Timeout)
+	defer cancel()
+
+	span, spanCtx := tracing.StartSpan(fetchCtx, "Fetch archive")
+	span.SetAttribute("repository", repo.Name)
+	var authorization string
+	if x.opt.AccessToken != "" {
+		authorization = api.Authorization(x.opt.AccessToken, x.opt.ImpersonateUser)
+	}
+	zipFile, err := fetchRepositoryArchive(spanCtx, x.opt.Endpoint, authorization, x.opt.AdditionalHeaders, repo.Name, repo.Rev, x.opt.DownloadLimiter, x.opt.Metrics)
+	span.Finish(err)
+	if err != nil {
+		if reachedTimeout(fetchCtx, err) {
+			err = x.timeoutError(repo, "the archive was still being downloaded.")
+		}
+		return "", errors.Wrap(err, "Fetching ZIP archive failed")
+	}
+	return zipFile.Name(), nil
+}
+
+// execute runs the action's steps on the downloaded archive once an
+// execution slot is free and returns the path of the file in PatchDir that
+// contains the resulting diff, or an empty path if there is none.
+func (x *Executor) execute(ctx context.Context, repo ActionRepo, prefix, zipFile string) (string, error) {
+	x.executions.Acquire()
+	defer x.executions.Release()
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, x.opt.Timeout)
+	defer cancel()
+
+	var audit *AuditRecord
+	if x.opt.Audit {
+		audit = &AuditRecord{RunID: x.opt.RunID, Repository: repo.Name, Revision: repo.Rev, Steps: []AuditStep{}}
+	}
+
+	var artifactsDir string
+	if x.opt.ArtifactsDir != "" {
+		artifactsDir = filepath.Join(x.opt.ArtifactsDir, filepath.FromSlash(repo.Name))
+	}
+
+	var cloneURL string
+	if x.cloning() {
+		var err error
+		if cloneURL, err = x.cloneURL(repo); err != nil {
+			return "", err
+		}
+	}
+
+	timings := newStepTimings(x.action.Steps)
+	opts := runOpts{
+		prefix:            prefix,
+		repoName:          repo.Name,
+		rev:               repo.Rev,
+		searchResultPaths: repo.SearchResultPathList(),
+		steps:             x.action.Steps,
+		diffDir:           x.opt.PatchDir,
+		maxDiffSize:       x.opt.MaxDiffSize,
+		skipSymlinks:      x.opt.SkipSymlinks,
+		cloneURL:          cloneURL,
+		gitLFS:            x.opt.GitLFS,
+		submodules:        x.opt.Submodules,
+		singleContainer:   x.opt.SingleContainer,
+		watchdog:          newStepWatchdog(x.opt.StallTimeout, x.opt.OnStall),
+		hooks:             x.opt.Hooks,
+		artifactsDir:      artifactsDir,
+		secrets:           x.opt.Secrets,
+		audit:             audit,
+		timings:           timings,
+		logger:            x.logger,
+		metrics:           x.opt.Metrics,
+	}
+	patch, err := runAction(runCtx, zipFile, opts)
+	if _, stalled := errors.Cause(err).(*errStepStalled); stalled && x.opt.OnStall == OnStallRestart && runCtx.Err() == nil {
+		x.logger.RepoWarning(repo.Name, "%s Restarting execution.\n", err)
+		if audit != nil {
+			audit.Steps = []AuditStep{}
+		}
+		if artifactsDir != "" {
+			os.RemoveAll(artifactsDir)
+		}
+		timings.reset()
+		// Restart only once, so that steps that always stall don't occupy
+		// the execution slot until the timeout is reached.
+		patch, err = runAction(runCtx, zipFile, opts)
+	}
+	if err != nil && reachedTimeout(runCtx, err) {
+		err = x.timeoutError(repo, timings.describe())
+	}
+
+	if audit != nil {
+		if logFile, ok := x.logger.RepoLogFile(repo.Name); ok {
+			path := logFile + ".audit.json"
+			if werr := audit.WriteFile(path); werr != nil {
+				os.Remove(patch)
+				return "", errors.Wrapf(werr, "writing audit record for %s", repo.Name)
+			}
+			x.logger.RepoAuditWritten(repo.Name, path)
+		}
+	}
+
+	return patch, err
+}
+
+// errTimeoutReached is returned if the execution in a repository took longer
+// than the timeout. It tells where the time went, so that the timeout or the
+// slow step can be adjusted.
+type errTimeoutReached struct {
+	timeout time.Duration
+	repo    string
+	// progress describes how far the execution got, e.g. which step was
+	// running and how long the completed ones took.
+	progress string
+	// logFile is the log of the execution in the repository, if it's
+	// written to a file.
+	logFile string
+}
 
 func (e *errTimeoutReached) Error() string {
-	return fmt.Sprintf("Timeout reached. Execution took longer than %s.", e.timeout)
+	msg := fmt.Sprintf("Timeout reached in %s. Execution took longer than %s: %s", e.repo, e.timeout, e.progress)
+	if e.logFile != "" {
+		msg += fmt.Sprintf(" See the log in %s.", e.logFile)
+	}
+	return msg
+}
+
+// timeoutError returns the errTimeoutReached for the execution in repo.
+func (x *Executor) timeoutError(repo ActionRepo, progress string) error {
+	logFile, _ := x.logger.RepoLogFile(repo.Name)
+	return &errTimeoutReached{timeout: x.opt.Timeout, repo: repo.Name, progress: progress, logFile: logFile}
 }
 
 func reachedTimeout(cmdCtx context.Context, err error) bool {
@@ -0,0 +1,66 @@
+package campaigns
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/neelance/parallel"
+)
+
+func TestExecutorFailFast(t *testing.T) {
+	setGitIdentity(t)
+
+	failing, err := ioutil.ReadFile(writeTestZip(t, []zipEntry{{name: "FAIL", mode: 0644}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	passing, err := ioutil.ReadFile(writeTestZip(t, []zipEntry{{name: "README.md", mode: 0644, content: "# README"}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/failing") {
+			w.Write(failing)
+			return
+		}
+		w.Write(passing)
+	}))
+	defer ts.Close()
+
+	// The step fails immediately in the failing repository and would take
+	// long in the others.
+	action := Action{Steps: []*ActionStep{{Type: "command", Args: []string{"sh", "-c", "test ! -f FAIL && exec sleep 30"}}}}
+	executor := NewExecutor(action, 3, NewActionLogger(false, false, true), ExecutorOpts{
+		Endpoint: ts.URL,
+		Timeout:  time.Minute,
+		FailFast: true,
+	})
+	for _, name := range []string{"github.com/failing", "github.com/slow-1", "github.com/slow-2"} {
+		executor.EnqueueRepo(ActionRepo{ID: name, Name: name, Rev: "HEAD"})
+	}
+
+	start := time.Now()
+	go executor.Start(context.Background())
+	err = executor.Wait()
+	// Only the failure is reported, not the cancelled executions.
+	if errs, ok := err.(parallel.Errors); !ok || len(errs) != 1 || !strings.Contains(errs[0].Error(), "exit status 1") {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if took := time.Since(start); took > 20*time.Second {
+		t.Errorf("the executions in progress were not cancelled, took %s", took)
+	}
+
+	var cancelled []string
+	for _, repo := range executor.Cancelled() {
+		cancelled = append(cancelled, repo.Name)
+	}
+	if diff := cmp.Diff([]string{"github.com/slow-1", "github.com/slow-2"}, cancelled); diff != "" {
+		t.Errorf("unexpected cancelled repositories (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,113 @@
+package campaigns
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// dependencyUpgradeEcosystem generates the action that upgrades a dependency
+// in one package ecosystem.
+type dependencyUpgradeEcosystem struct {
+	// packageRegexp matches valid package names. Names and versions are
+	// validated because they are used in shell commands.
+	packageRegexp *regexp.Regexp
+	// scopeQuery is the format of the scopeQuery, with the package name as
+	// a regular expression as argument.
+	scopeQuery string
+	// image is the pinned image the upgrade is run in.
+	image string
+	// command is the format of the shell command that upgrades the
+	// dependency, with the package name, the version and the package name as
+	// a regular expression as arguments.
+	command string
+}
+
+var dependencyUpgradeEcosystems = map[string]dependencyUpgradeEcosystem{
+	"npm": {
+		packageRegexp: regexp.MustCompile(`^(?:@[a-z0-9-~][a-z0-9-._~]*/)?[a-z0-9-~][a-z0-9-._~]*$`),
+		scopeQuery:    `file:(^|/)package\.json$ %s`,
+		image:         "node:14.4.0-alpine3.12",
+		command:       `find . -name package.json -not -path '*/node_modules/*' | while read f; do if grep -q '"%[3]s"' "$f"; then (cd "$(dirname "$f")" && npm install --package-lock-only --ignore-scripts --no-audit %[1]s@%[2]s); fi; done`,
+	},
+	"go": {
+		packageRegexp: regexp.MustCompile(`^[a-zA-Z0-9.~_-]+(?:/[a-zA-Z0-9.~_-]+)*$`),
+		scopeQuery:    `file:(^|/)go\.mod$ %s`,
+		image:         "golang:1.14.4",
+		command:       `find . -name go.mod | while read f; do if grep -q '%[3]s ' "$f"; then (cd "$(dirname "$f")" && go get -d %[1]s@%[2]s && go mod tidy); fi; done`,
+	},
+	"pip": {
+		packageRegexp: regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`),
+		scopeQuery:    `file:(^|/)requirements[^/]*\.txt$ %s`,
+		image:         "alpine:3.12.0",
+		command:       `find . -name 'requirements*.txt' | xargs -r sed -i -E '` + pipRequirementExpr + `'`,
+	},
+}
+
+// pipRequirementExpr is the sed expression that pins the version of a package
+// in a requirements file, with the same arguments as the command. The name
+// must be followed by extras, a version specifier, a marker, a comment or the
+// end of the line, so that packages whose names share a prefix with it, e.g.
+// requests-oauthlib, are left alone.
+const pipRequirementExpr = `s/^(%[3]s)(\[[^]]*\])?[[:space:]]*([=<>~!]=?[[:space:]]*[^;#[:space:]]*)?([[:space:]]*([;#]|$))/\1\2==%[2]s\4/I`
+
+var dependencyVersionRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9.+_~^-]*$`)
+
+// DependencyUpgradeEcosystems returns the names of the ecosystems supported by
+// GenerateDependencyUpgrade.
+func DependencyUpgradeEcosystems() []string {
+	names := make([]string, 0, len(dependencyUpgradeEcosystems))
+	for name := range dependencyUpgradeEcosystems {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GenerateDependencyUpgrade returns an action that upgrades the given package
+// to version in all repositories that depend on it in the ecosystem.
+func GenerateDependencyUpgrade(ecosystem, pkg, version string) (*Action, error) {
+	e, ok := dependencyUpgradeEcosystems[ecosystem]
+	if !ok {
+		return nil, fmt.Errorf("unsupported ecosystem %q (supported: %s)", ecosystem, strings.Join(DependencyUpgradeEcosystems(), ", "))
+	}
+	if !e.packageRegexp.MatchString(pkg) {
+		return nil, fmt.Errorf("%q is not a valid %s package name", pkg, ecosystem)
+	}
+	if !dependencyVersionRegexp.MatchString(version) {
+		return nil, fmt.Errorf("%q is not a valid version", version)
+	}
+
+	pattern := regexp.QuoteMeta(pkg)
+	return &Action{
+		ScopeQuery: fmt.Sprintf(e.scopeQuery, pattern),
+		Steps: []*ActionStep{{
+			Type:  "docker",
+			Image: e.image,
+			Args:  []string{"sh", "-c", fmt.Sprintf(e.command, pkg, version, pattern)},
+		}},
+	}, nil
+}
+
+// MarshalActionDefinition returns the action definition of action as indented
+// JSON, without the internal fields that users must not set.
+func MarshalActionDefinition(action *Action) ([]byte, error) {
+	data, err := json.Marshal(action)
+	if err != nil {
+		return nil, err
+	}
+	var def map[string]interface{}
+	if err := json.Unmarshal(data, &def); err != nil {
+		return nil, err
+	}
+	if steps, ok := def["steps"].([]interface{}); ok {
+		for _, step := range steps {
+			if step, ok := step.(map[string]interface{}); ok {
+				delete(step, "ImageContentDigest")
+			}
+		}
+	}
+	return json.MarshalIndent(def, "", "  ")
+}
@@ -0,0 +1,118 @@
+package campaigns
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestGenerateDependencyUpgrade(t *testing.T) {
+	tests := map[string]struct {
+		ecosystem, pkg, version string
+		wantScopeQuery          string
+		wantCommand             []string
+		wantErr                 string
+	}{
+		"npm": {
+			ecosystem: "npm", pkg: "lodash.merge", version: "4.6.2",
+			wantScopeQuery: `file:(^|/)package\.json$ lodash\.merge`,
+			wantCommand:    []string{`grep -q '"lodash\.merge"'`, "npm install --package-lock-only --ignore-scripts --no-audit lodash.merge@4.6.2"},
+		},
+		"scoped npm package": {
+			ecosystem: "npm", pkg: "@babel/core", version: "7.10.2",
+			wantScopeQuery: `file:(^|/)package\.json$ @babel/core`,
+			wantCommand:    []string{"@babel/core@7.10.2"},
+		},
+		"go": {
+			ecosystem: "go", pkg: "golang.org/x/text", version: "v0.3.3",
+			wantScopeQuery: `file:(^|/)go\.mod$ golang\.org/x/text`,
+			wantCommand:    []string{"go get -d golang.org/x/text@v0.3.3 && go mod tidy"},
+		},
+		"pip": {
+			ecosystem: "pip", pkg: "requests", version: "2.24.0",
+			wantScopeQuery: `file:(^|/)requirements[^/]*\.txt$ requests`,
+			wantCommand:    []string{`s/^(requests)`, `/\1\2==2.24.0\4/I`},
+		},
+		"unknown ecosystem": {
+			ecosystem: "cargo", pkg: "serde", version: "1.0.0",
+			wantErr: `unsupported ecosystem "cargo"`,
+		},
+		"invalid package": {
+			ecosystem: "npm", pkg: "lodash; rm -rf /", version: "4.17.21",
+			wantErr: "not a valid npm package name",
+		},
+		"invalid version": {
+			ecosystem: "npm", pkg: "lodash", version: "$(reboot)",
+			wantErr: "not a valid version",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			action, err := GenerateDependencyUpgrade(tc.ecosystem, tc.pkg, tc.version)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("unexpected error: have %v; want %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if action.ScopeQuery != tc.wantScopeQuery {
+				t.Errorf("unexpected scopeQuery: have %q; want %q", action.ScopeQuery, tc.wantScopeQuery)
+			}
+			command := action.Steps[0].Args[2]
+			for _, want := range tc.wantCommand {
+				if !strings.Contains(command, want) {
+					t.Errorf("command %q does not contain %q", command, want)
+				}
+			}
+
+			data, err := MarshalActionDefinition(action)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := ValidateActionDefinition(data); err != nil {
+				t.Errorf("generated action definition is invalid: %s", err)
+			}
+			if findings := LintAction(*action); len(findings) != 0 {
+				t.Errorf("unexpected lint findings: %+v", findings)
+			}
+		})
+	}
+}
+
+func TestPipRequirementExpr(t *testing.T) {
+	if _, err := exec.LookPath("sed"); err != nil {
+		t.Skip("sed not found")
+	}
+
+	requirements := `requests==2.20.0
+requests-oauthlib==1.3.0
+Requests >= 2.0 ; python_version >= "3.6"
+requests[security]~=2.21  # pinned for CVE
+requestsx
+requests
+`
+	want := `requests==2.24.0
+requests-oauthlib==1.3.0
+Requests==2.24.0 ; python_version >= "3.6"
+requests[security]==2.24.0  # pinned for CVE
+requestsx
+requests==2.24.0
+`
+	expr := fmt.Sprintf(pipRequirementExpr, "requests", "2.24.0", regexp.QuoteMeta("requests"))
+	cmd := exec.Command("sed", "-E", expr)
+	cmd.Stdin = strings.NewReader(requirements)
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != want {
+		t.Errorf("unexpected requirements:\n%s\nwant:\n%s", out, want)
+	}
+}
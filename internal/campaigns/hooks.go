@@ -0,0 +1,139 @@
+package campaigns
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// The points of the execution in a repository at which hooks are run.
+const (
+	// HookPreTask is run before the first step, once the workspace has been
+	// created. It can skip the repository.
+	HookPreTask = "pre-task"
+	// HookPostStep is run after every step. It can inspect and change the
+	// files in the workspace.
+	HookPostStep = "post-step"
+	// HookPostTask is run after the last step with the resulting diff. It
+	// can replace the diff.
+	HookPostTask = "post-task"
+)
+
+// Hooks are the paths of executables that are run at points of the execution
+// in each repository, so that organizations can enforce policies, e.g. that
+// CODEOWNERS files are never changed, or send notifications. Empty paths are
+// not run.
+//
+// A hook is given a HookInput as JSON on its standard input. If it exits with
+// a non-zero status, the execution in the repository fails with its standard
+// error as the reason. Otherwise it can print a HookOutput as JSON on its
+// standard output to change how the execution continues.
+type Hooks struct {
+	PreTask  string `json:"preTask,omitempty"`
+	PostStep string `json:"postStep,omitempty"`
+	PostTask string `json:"postTask,omitempty"`
+}
+
+// HookInput describes the execution in a repository to a hook.
+type HookInput struct {
+	// Hook is one of HookPreTask, HookPostStep or HookPostTask.
+	Hook       string `json:"hook"`
+	Repository string `json:"repository"`
+	Revision   string `json:"revision"`
+
+	// Workspace is the directory with the files of the repository the steps
+	// are run on.
+	Workspace string `json:"workspace"`
+
+	// SearchResultPaths are the paths of the files in the repository that
+	// the scopeQuery matched, if any.
+	SearchResultPaths []string `json:"searchResultPaths,omitempty"`
+
+	// Step is the index of the step that finished and StepType its type, for
+	// post-step hooks.
+	Step     *int   `json:"step,omitempty"`
+	StepType string `json:"stepType,omitempty"`
+
+	// Diff is the diff produced by the steps, for post-task hooks.
+	Diff *string `json:"diff,omitempty"`
+}
+
+// HookOutput is the optional response of a hook.
+type HookOutput struct {
+	// Skip, for pre-task hooks, skips the repository without failing the
+	// execution. Reason is logged.
+	Skip   bool   `json:"skip,omitempty"`
+	Reason string `json:"reason,omitempty"`
+
+	// Diff, for post-task hooks, replaces the diff produced by the steps. An
+	// empty diff produces no patch.
+	Diff *string `json:"diff,omitempty"`
+}
+
+type errHookVetoed struct {
+	hook, path, reason string
+}
+
+func (e *errHookVetoed) Error() string {
+	return fmt.Sprintf("The %s hook %s vetoed the execution: %s", e.hook, e.path, e.reason)
+}
+
+// path returns the path of the executable for hook, or an empty string if
+// none is set. h may be nil.
+func (h *Hooks) path(hook string) string {
+	if h == nil {
+		return ""
+	}
+	switch hook {
+	case HookPreTask:
+		return h.PreTask
+	case HookPostStep:
+		return h.PostStep
+	case HookPostTask:
+		return h.PostTask
+	}
+	return ""
+}
+
+// run runs the executable for in.Hook, if any, and returns its output.
+func (h *Hooks) run(ctx context.Context, in HookInput) (HookOutput, error) {
+	path := h.path(in.Hook)
+	if path == "" {
+		return HookOutput{}, nil
+	}
+
+	input, err := json.Marshal(in)
+	if err != nil {
+		return HookOutput{}, err
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, path)
+	cmd.Dir = in.Workspace
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if _, ok := err.(*exec.ExitError); !ok || ctx.Err() != nil {
+			return HookOutput{}, errors.Wrapf(err, "running %s hook %s", in.Hook, path)
+		}
+		reason := strings.TrimSpace(stderr.String())
+		if reason == "" {
+			reason = err.Error()
+		}
+		return HookOutput{}, &errHookVetoed{hook: in.Hook, path: path, reason: reason}
+	}
+
+	var out HookOutput
+	if len(bytes.TrimSpace(stdout.Bytes())) == 0 {
+		return out, nil
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &out); err != nil {
+		return HookOutput{}, errors.Wrapf(err, "invalid output of %s hook %s", in.Hook, path)
+	}
+	return out, nil
+}
@@ -0,0 +1,123 @@
+package campaigns
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHooks(t *testing.T) {
+	setGitIdentity(t)
+
+	hookDir, err := ioutil.TempDir("", "hooks-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(hookDir) })
+	hook := func(name, script string) string {
+		path := filepath.Join(hookDir, name)
+		if err := ioutil.WriteFile(path, []byte("#!/bin/sh\n"+script+"\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	var (
+		skip            = hook("skip", `grep -q '"hook":"pre-task"' && echo '{"skip": true, "reason": "archived"}'`)
+		veto            = hook("veto", `echo 'not allowed' >&2; exit 1`)
+		touch           = hook("touch", `grep -q '"step":0,"stepType":"command"' && touch HOOKED`)
+		banCodeowners   = hook("ban-codeowners", `if grep -q 'CODEOWNERS'; then echo 'CODEOWNERS must not be changed' >&2; exit 1; fi`)
+		dropDiff        = hook("drop-diff", `echo '{"diff": ""}'`)
+		invalidResponse = hook("invalid", `echo 'not JSON'`)
+	)
+
+	tests := map[string]struct {
+		hooks    *Hooks
+		steps    string
+		wantDiff []string
+		wantErr  string
+	}{
+		"no hooks": {
+			wantDiff: []string{"+# Hello, world"},
+		},
+		"pre-task skip": {
+			hooks: &Hooks{PreTask: skip},
+		},
+		"pre-task veto": {
+			hooks:   &Hooks{PreTask: veto},
+			wantErr: "The pre-task hook " + veto + " vetoed the execution: not allowed",
+		},
+		"post-step changes workspace": {
+			hooks:    &Hooks{PostStep: touch},
+			wantDiff: []string{"+# Hello, world", "HOOKED"},
+		},
+		"post-task accepts diff": {
+			hooks:    &Hooks{PostTask: banCodeowners},
+			wantDiff: []string{"+# Hello, world"},
+		},
+		"post-task vetoes diff": {
+			hooks:   &Hooks{PostTask: banCodeowners},
+			steps:   "echo '* @everyone' > CODEOWNERS",
+			wantErr: "CODEOWNERS must not be changed",
+		},
+		"post-task replaces diff": {
+			hooks: &Hooks{PostTask: dropDiff},
+		},
+		"invalid output": {
+			hooks:   &Hooks{PostTask: invalidResponse},
+			wantErr: "invalid output of post-task hook",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "hooks-test-workspace")
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { os.RemoveAll(dir) })
+			if err := ioutil.WriteFile(filepath.Join(dir, "README.md"), []byte("# Hello\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			script := tc.steps
+			if script == "" {
+				script = "echo '# Hello, world' > README.md"
+			}
+			steps := []*ActionStep{{Type: "command", Args: []string{"sh", "-c", script}}}
+			diffFile, err := runSteps(context.Background(), dir, runOpts{
+				prefix:   "hooks-test",
+				repoName: "github.com/sourcegraph/src-cli",
+				rev:      "deadbeef",
+				steps:    steps,
+				hooks:    tc.hooks,
+				logger:   NewActionLogger(false, false, true),
+			})
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("unexpected error %v, want %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(diffFile)
+			diff, err := readDiffFile(diffFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(tc.wantDiff) == 0 && len(diff) > 0 {
+				t.Errorf("unexpected diff:\n%s", diff)
+			}
+			for _, want := range tc.wantDiff {
+				if !strings.Contains(string(diff), want) {
+					t.Errorf("diff does not contain %q:\n%s", want, diff)
+				}
+			}
+		})
+	}
+}
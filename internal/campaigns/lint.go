@@ -0,0 +1,143 @@
+package campaigns
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The severities of lint findings. Only warnings make 'src actions lint' fail.
+const (
+	LintWarning = "warning"
+	LintInfo    = "info"
+)
+
+// LintFinding is a suspicious pattern in an action definition that is valid
+// but likely not what its author intended.
+type LintFinding struct {
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"`
+	// Path is the location of the finding in the action definition, e.g.
+	// "steps.1.image".
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+var (
+	lintCountRegexp = regexp.MustCompile(`(?:^|\s)count:(\d+)`)
+
+	// lintSecretRegexps match values that look like credentials.
+	lintSecretRegexps = []*regexp.Regexp{
+		regexp.MustCompile(`\b(?:ghp|gho|ghs)_[A-Za-z0-9]{36}\b`),
+		regexp.MustCompile(`\bsgp_[a-f0-9]{40}\b`),
+		regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`),
+		regexp.MustCompile(`\bAKIA[0-9A-Z]{16}\b`),
+		regexp.MustCompile(`(?i)\b\w*(?:token|password|passwd|secret|api_?key)\w*=[^\s$]\S*`),
+		regexp.MustCompile(`://[^/\s:@]+:[^/\s@$]+@`),
+	}
+
+	// lintShellOperators are arguments that only have a meaning in a shell.
+	lintShellOperators = map[string]bool{"|": true, "||": true, "&&": true, ";": true, ">": true, ">>": true, "<": true, "2>&1": true}
+	lintShellRegexp    = regexp.MustCompile(`^\$\w+|^\$\{\w+\}|\*\.\w+$`)
+	lintShells         = map[string]bool{"sh": true, "bash": true, "zsh": true, "ash": true, "dash": true}
+)
+
+// minLintCount is the count: in a scopeQuery below which LintAction warns that
+// it limits the matched repositories.
+const minLintCount = 10000
+
+// LintAction returns the findings for the suspicious patterns in action:
+//
+//   - images that are not pinned to a tag other than "latest" or a digest
+//   - a count: in the scopeQuery that likely limits the matched repositories
+//   - matrix keys that no step refers to, so all entries produce the same patches
+//   - arguments and images that look like hard-coded credentials
+//   - arguments that only work in a shell, in steps that don't run one
+//   - "command" steps, which depend on the machine they run on
+func LintAction(action Action) []LintFinding {
+	var findings []LintFinding
+	add := func(rule, severity, path, format string, args ...interface{}) {
+		findings = append(findings, LintFinding{Rule: rule, Severity: severity, Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if m := lintCountRegexp.FindStringSubmatch(action.ScopeQuery); m != nil {
+		if n, err := strconv.Atoi(m[1]); err == nil && n < minLintCount {
+			add("scope-count", LintWarning, "scopeQuery", "count:%d limits the search to %d results, so the action may not run in all matching repositories. Remove it to match all repositories.", n, n)
+		}
+	}
+
+	used := map[string]bool{}
+	for i, step := range action.Steps {
+		path := fmt.Sprintf("steps.%d", i)
+		step.mapStrings(func(s string) string {
+			for _, m := range matrixPlaceholderRegexp.FindAllStringSubmatch(s, -1) {
+				used[m[1]] = true
+			}
+			return s
+		})
+
+		if step.Type == "command" {
+			add("host-command", LintInfo, path, `"command" steps run on the machine executing the action, so their results depend on its tools and their versions. Consider a "docker" step.`)
+		}
+		if step.Type == "docker" && step.Build == "" && step.Image != "" && !imagePinned(step.Image) {
+			add("unpinned-image", LintWarning, path+".image", "%q is not pinned to a version, so the results can change when the image is updated. Use a specific tag or a digest.", step.Image)
+		}
+
+		if step.Image != "" && looksLikeSecret(step.Image) {
+			add("hardcoded-secret", LintWarning, path+".image", "the image looks like it contains credentials. Don't store credentials in action definitions.")
+		}
+		for j, arg := range step.Args {
+			if looksLikeSecret(arg) {
+				add("hardcoded-secret", LintWarning, fmt.Sprintf("%s.args.%d", path, j), "the argument looks like a credential. Don't store credentials in action definitions.")
+			}
+		}
+
+		if len(step.Args) > 0 && !lintShells[lastPathElement(step.Args[0])] {
+			for j, arg := range step.Args {
+				if lintShellOperators[arg] || lintShellRegexp.MatchString(arg) {
+					add("needs-shell", LintWarning, fmt.Sprintf("%s.args.%d", path, j), "%q only has a meaning in a shell, but the step doesn't run one. Use e.g. [\"sh\", \"-c\", \"...\"] as args.", arg)
+					break
+				}
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(action.Matrix))
+	for key := range action.Matrix {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if !used[key] {
+			add("unused-matrix-key", LintWarning, "matrix."+key, "no step refers to ${{ matrix.%s }}, so the steps run with the same arguments for each of its values.", key)
+		}
+	}
+
+	return findings
+}
+
+// imagePinned returns whether image refers to a digest or a tag other than
+// "latest".
+func imagePinned(image string) bool {
+	if strings.Contains(image, "@sha256:") {
+		return true
+	}
+	name := lastPathElement(image)
+	i := strings.LastIndex(name, ":")
+	return i >= 0 && name[i+1:] != "latest"
+}
+
+func looksLikeSecret(s string) bool {
+	for _, r := range lintSecretRegexps {
+		if r.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+func lastPathElement(s string) string {
+	return s[strings.LastIndex(s, "/")+1:]
+}
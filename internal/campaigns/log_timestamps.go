@@ -0,0 +1,79 @@
+package campaigns
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// The formats of the timestamps of the lines in the log files of
+// repositories, see ActionLogger.SetLogTimestamps.
+const (
+	// LogTimestampsAbsolute prefixes lines with the time in RFC 3339
+	// format with nanoseconds.
+	LogTimestampsAbsolute = "absolute"
+	// LogTimestampsRelative prefixes lines with the time since the
+	// execution in the repository started, e.g. "+1m2.345s", which makes it
+	// easy to see how long steps take.
+	LogTimestampsRelative = "relative"
+	// LogTimestampsNone doesn't timestamp lines.
+	LogTimestampsNone = "none"
+)
+
+// timestampWriter prefixes each line written to w with a timestamp in the
+// given format. Lines written in several calls are only prefixed once.
+type timestampWriter struct {
+	w      io.Writer
+	format string
+	start  time.Time
+	now    func() time.Time
+
+	mu      sync.Mutex
+	midLine bool
+}
+
+// newTimestampWriter returns a writer that timestamps the lines written to w,
+// relative to start for LogTimestampsRelative, or w itself for
+// LogTimestampsNone.
+func newTimestampWriter(w io.Writer, format string, start time.Time) io.Writer {
+	if format == LogTimestampsNone {
+		return w
+	}
+	return &timestampWriter{w: w, format: format, start: start, now: time.Now}
+}
+
+func (t *timestampWriter) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var buf bytes.Buffer
+	for rest := p; len(rest) > 0; {
+		if !t.midLine {
+			buf.WriteString(t.timestamp())
+			buf.WriteByte(' ')
+		}
+		i := bytes.IndexByte(rest, '\n')
+		if i < 0 {
+			buf.Write(rest)
+			t.midLine = true
+			break
+		}
+		buf.Write(rest[:i+1])
+		rest = rest[i+1:]
+		t.midLine = false
+	}
+	if _, err := t.w.Write(buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (t *timestampWriter) timestamp() string {
+	now := t.now()
+	if t.format == LogTimestampsRelative {
+		return fmt.Sprintf("%12s", "+"+now.Sub(t.start).Round(time.Millisecond).String())
+	}
+	return now.Format(time.RFC3339Nano)
+}
@@ -0,0 +1,63 @@
+package campaigns
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTimestampWriter(t *testing.T) {
+	start := time.Date(2020, 7, 1, 12, 0, 0, 0, time.UTC)
+	writes := []string{"Starting action\n", "[STDOUT] partial ", "line\nsecond line\n", "third", "\n"}
+
+	for _, tc := range []struct {
+		format string
+		want   string
+	}{
+		{
+			format: LogTimestampsAbsolute,
+			want: "2020-07-01T12:00:01Z Starting action\n" +
+				"2020-07-01T12:00:02Z [STDOUT] partial line\n" +
+				"2020-07-01T12:00:03Z second line\n" +
+				"2020-07-01T12:00:04Z third\n",
+		},
+		{
+			format: LogTimestampsRelative,
+			want: "         +1s Starting action\n" +
+				"         +2s [STDOUT] partial line\n" +
+				"         +3s second line\n" +
+				"         +4s third\n",
+		},
+		{
+			format: LogTimestampsNone,
+			want:   "Starting action\n[STDOUT] partial line\nsecond line\nthird\n",
+		},
+	} {
+		t.Run(tc.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := newTimestampWriter(&buf, tc.format, start)
+			calls := 0
+			if tw, ok := w.(*timestampWriter); ok {
+				tw.now = func() time.Time {
+					calls++
+					return start.Add(time.Duration(calls) * time.Second)
+				}
+			}
+			for _, s := range writes {
+				if n, err := io.WriteString(w, s); err != nil || n != len(s) {
+					t.Fatalf("unexpected write result: n %d, err %v", n, err)
+				}
+			}
+			if diff := cmp.Diff(tc.want, buf.String()); diff != "" {
+				t.Errorf("unexpected log (-want +have):\n%s", diff)
+			}
+		})
+	}
+
+	if err := NewActionLogger(false, false, true).SetLogTimestamps("iso"); err == nil {
+		t.Error("expected error for invalid format")
+	}
+}
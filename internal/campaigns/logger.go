@@ -6,16 +6,17 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"path"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	humanize "github.com/dustin/go-humanize"
 	"github.com/fatih/color"
-	"github.com/mattn/go-isatty"
 	"github.com/neelance/parallel"
 	"github.com/pkg/errors"
-	"github.com/segmentio/textio"
+	"github.com/sourcegraph/src-cli/internal/output"
 )
 
 var (
@@ -28,8 +29,12 @@ var (
 )
 
 type ActionLogger struct {
-	verbose  bool
-	keepLogs bool
+	verbose    bool
+	keepLogs   bool
+	quiet      bool
+	timestamps string
+	follow     string
+	runID      string
 
 	progress *progress
 	out      io.WriteCloser
@@ -39,27 +44,85 @@ type ActionLogger struct {
 	logWriters map[string]io.Writer
 }
 
-func NewActionLogger(verbose, keepLogs bool) *ActionLogger {
-	useColor := isatty.IsTerminal(os.Stderr.Fd()) || isatty.IsCygwinTerminal(os.Stderr.Fd())
-	if useColor {
+// NewActionLogger returns a logger that reports the progress of an action
+// execution on stderr. If quiet is set, only the final result is printed.
+func NewActionLogger(verbose, keepLogs, quiet bool) *ActionLogger {
+	if output.ColorEnabled(os.Stderr) {
 		color.NoColor = false
 	}
 
 	progress := new(progress)
 
+	var w io.Writer = output.Stderr
+	if quiet {
+		verbose = false
+		w = ioutil.Discard
+	}
+
 	return &ActionLogger{
-		verbose:  verbose,
-		keepLogs: keepLogs,
-		progress: progress,
+		verbose:    verbose,
+		keepLogs:   keepLogs,
+		quiet:      quiet,
+		timestamps: LogTimestampsAbsolute,
+		progress:   progress,
 		out: &progressWriter{
 			p: progress,
-			w: os.Stderr,
+			w: w,
 		},
 		logFiles:   map[string]*os.File{},
 		logWriters: map[string]io.Writer{},
 	}
 }
 
+// SetLogTimestamps sets how the lines in the log files of repositories are
+// timestamped: one of LogTimestampsAbsolute, which is the default,
+// LogTimestampsRelative or LogTimestampsNone. It must be called before the
+// first repository is added.
+func (a *ActionLogger) SetLogTimestamps(format string) error {
+	switch format {
+	case LogTimestampsAbsolute, LogTimestampsRelative, LogTimestampsNone:
+		a.timestamps = format
+		return nil
+	}
+	return fmt.Errorf("invalid log timestamp format %q, must be one of %s, %s or %s", format, LogTimestampsAbsolute, LogTimestampsRelative, LogTimestampsNone)
+}
+
+// SetFollowLogs limits the step output printed to the console to the
+// repositories whose name matches the glob pattern, e.g.
+// "github.com/my-org/*", as in path.Match. The output of these repositories is
+// printed even if the logger is quiet. By default, the output of all
+// repositories is printed unless the logger is quiet. It must be called before
+// the first step is run.
+func (a *ActionLogger) SetFollowLogs(pattern string) error {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("invalid repository pattern %q: %s", pattern, err)
+	}
+	a.follow = pattern
+	return nil
+}
+
+// SetRunID sets the ID of the execution, see NewRunID, which is included in
+// the names of the log files of repositories. It must be called before the
+// first repository is added.
+func (a *ActionLogger) SetRunID(id string) {
+	a.runID = id
+}
+
+// consoleOutput returns where the step output of the repository is printed,
+// or nil if it isn't.
+func (a *ActionLogger) consoleOutput(repoName string) io.Writer {
+	if a.follow == "" {
+		return a.out
+	}
+	if ok, _ := path.Match(a.follow, repoName); !ok {
+		return nil
+	}
+	if a.quiet {
+		return output.Stderr
+	}
+	return a.out
+}
+
 func (a *ActionLogger) Start(totalSteps int) {
 	a.progress.SetTotalSteps(int64(totalSteps))
 }
@@ -81,9 +144,9 @@ func (a *ActionLogger) ActionFailed(err error, patches []PatchInput) {
 	fmt.Fprintln(os.Stderr)
 	if perr, ok := err.(parallel.Errors); ok {
 		if len(patches) > 0 {
-			yellow.Fprintf(os.Stderr, "✗  Action produced %d patches but failed with %d errors:\n\n", len(patches), len(perr))
+			yellow.Fprintf(os.Stderr, "%s  Action produced %d patches but failed with %d errors:\n\n", output.Emoji(output.EmojiFailure), len(patches), len(perr))
 		} else {
-			yellow.Fprintf(os.Stderr, "✗  Action failed with %d errors:\n", len(perr))
+			yellow.Fprintf(os.Stderr, "%s  Action failed with %d errors:\n", output.Emoji(output.EmojiFailure), len(perr))
 		}
 		for _, e := range perr {
 			fmt.Fprintf(os.Stderr, "\t- %s\n", e)
@@ -91,20 +154,52 @@ func (a *ActionLogger) ActionFailed(err error, patches []PatchInput) {
 		fmt.Println()
 	} else if err != nil {
 		if len(patches) > 0 {
-			yellow.Fprintf(os.Stderr, "✗  Action produced %d patches but failed with error: %s\n\n", len(patches), err)
+			yellow.Fprintf(os.Stderr, "%s  Action produced %d patches but failed with error: %s\n\n", output.Emoji(output.EmojiFailure), len(patches), err)
 		} else {
-			yellow.Fprintf(os.Stderr, "✗  Action failed with error: %s\n\n", err)
+			yellow.Fprintf(os.Stderr, "%s  Action failed with error: %s\n\n", output.Emoji(output.EmojiFailure), err)
 		}
 	} else {
-		grey.Fprintf(os.Stderr, "✗  Action did not produce any patches.\n\n")
+		grey.Fprintf(os.Stderr, "%s  Action did not produce any patches.\n\n", output.Emoji(output.EmojiFailure))
 	}
 }
 
 func (a *ActionLogger) ActionSuccess(patches []PatchInput) {
 	a.out.Close()
 	fmt.Fprintln(os.Stderr)
-	format := "✔  Action produced %d patches."
-	hiGreen.Fprintf(os.Stderr, format, len(patches))
+	format := "%s  Action produced %d patches."
+	hiGreen.Fprintf(os.Stderr, format, output.Emoji(output.EmojiSuccess), len(patches))
+}
+
+// ExecutionStats prints how effective the cache was, unless the logger is
+// quiet. It must be called before ActionSuccess or ActionFailed.
+func (a *ActionLogger) ExecutionStats(stats ExecutionStats) {
+	if stats.CacheHits+stats.Executions == 0 {
+		return
+	}
+	saved := stats.TimeSaved.Round(time.Second).String()
+	if stats.UnknownSaved > 0 {
+		saved += fmt.Sprintf(", unknown for %d results cached by an earlier version", stats.UnknownSaved)
+	}
+	a.log("", grey, "\nCache: %d hits, %d executions, estimated time saved: %s\n", stats.CacheHits, stats.Executions, saved)
+	if len(stats.Slowest) == 0 {
+		return
+	}
+	a.log("", grey, "Slowest repositories:\n")
+	for _, r := range stats.Slowest {
+		a.log("", grey, "  %8s  %s\n", r.Duration.Round(time.Second), r.Repo)
+	}
+}
+
+// ExecutionCancelled reports the repositories in which the execution was
+// cancelled or not started because it failed in another repository.
+func (a *ActionLogger) ExecutionCancelled(repos []ActionRepo) {
+	if len(repos) == 0 {
+		return
+	}
+	a.log("", yellow, "\nCancelled the execution in %d repositories after it failed in another repository:\n", len(repos))
+	for _, repo := range repos {
+		a.log("", yellow, "  %s\n", repo.Name)
+	}
 }
 
 func (a *ActionLogger) RepoCacheHit(repo ActionRepo, stepCount int, patchProduced bool) {
@@ -119,13 +214,16 @@ func (a *ActionLogger) RepoCacheHit(repo ActionRepo, stepCount int, patchProduce
 
 func (a *ActionLogger) AddRepo(repo ActionRepo) (string, error) {
 	prefix := "action-" + strings.Replace(strings.Replace(repo.Name, "/", "-", -1), "github.com-", "", -1)
+	if a.runID != "" {
+		prefix += "-" + a.runID
+	}
 
 	logFile, err := ioutil.TempFile(tempDirPrefix, prefix+"-log")
 	if err != nil {
 		return "", err
 	}
 
-	logWriter := io.Writer(logFile)
+	logWriter := newTimestampWriter(logFile, a.timestamps, time.Now())
 
 	a.mu.Lock()
 	defer a.mu.Unlock()
@@ -142,30 +240,63 @@ func (a *ActionLogger) RepoWriter(repoName string) (io.Writer, bool) {
 	return w, ok
 }
 
-func (a *ActionLogger) InfoPipe(prefix string) io.Writer {
-	stdoutPrefix := fmt.Sprintf("%s -> [STDOUT]: ", yellow.Sprint(prefix))
-	stderr := textio.NewPrefixWriter(os.Stderr, stdoutPrefix)
-	return io.Writer(stderr)
+// RepoLogFile returns the path of the log file of the given repository.
+func (a *ActionLogger) RepoLogFile(repoName string) (string, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	f, ok := a.logFiles[repoName]
+	if !ok {
+		return "", false
+	}
+	return f.Name(), true
 }
 
-func (a *ActionLogger) ErrorPipe(prefix string) io.Writer {
-	stderrPrefix := fmt.Sprintf("%s -> [STDERR]: ", yellow.Sprint(prefix))
-	stderr := textio.NewPrefixWriter(os.Stderr, stderrPrefix)
-	return io.Writer(stderr)
+// InfoPipe returns a writer that prints the standard output of a command
+// with the given prefix. It must be closed to print a final partial line.
+func (a *ActionLogger) InfoPipe(prefix string) io.WriteCloser {
+	return newPrefixWriter(a.out, fmt.Sprintf("%s -> [STDOUT]: ", yellow.Sprint(prefix)))
 }
 
-func (a *ActionLogger) RepoStdoutStderr(repoName string) (io.Writer, io.Writer, bool) {
+// ErrorPipe is like InfoPipe, for the standard error of a command.
+func (a *ActionLogger) ErrorPipe(prefix string) io.WriteCloser {
+	return newPrefixWriter(a.out, fmt.Sprintf("%s -> [STDERR]: ", yellow.Sprint(prefix)))
+}
+
+// RepoStdoutStderr returns the writers for the standard output and error of
+// a step in the repository, which write to the log file of the repository
+// and print the output with a prefix, unless it isn't followed (see
+// SetFollowLogs). They must be closed when the step is done to print a final
+// partial line.
+func (a *ActionLogger) RepoStdoutStderr(repoName string) (io.WriteCloser, io.WriteCloser, bool) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 	w, ok := a.logWriters[repoName]
 
-	stderrPrefix := fmt.Sprintf("%s -> [STDERR]: ", yellow.Sprint(repoName))
-	stderr := textio.NewPrefixWriter(a.out, stderrPrefix)
+	console := a.consoleOutput(repoName)
+	if console == nil {
+		return teeWriteCloser{Writer: w}, teeWriteCloser{Writer: w}, ok
+	}
+
+	stderr := newPrefixWriter(console, fmt.Sprintf("%s -> [STDERR]: ", yellow.Sprint(repoName)))
+	stdout := newPrefixWriter(console, fmt.Sprintf("%s -> [STDOUT]: ", yellow.Sprint(repoName)))
+
+	return teeWriteCloser{Writer: io.MultiWriter(stdout, w), console: stdout},
+		teeWriteCloser{Writer: io.MultiWriter(stderr, w), console: stderr},
+		ok
+}
 
-	stdoutPrefix := fmt.Sprintf("%s -> [STDOUT]: ", yellow.Sprint(repoName))
-	stdout := textio.NewPrefixWriter(a.out, stdoutPrefix)
+// teeWriteCloser writes to the console through a prefixWriter, if any, and to
+// a log file. Closing it flushes the prefixWriter.
+type teeWriteCloser struct {
+	io.Writer
+	console *prefixWriter
+}
 
-	return io.MultiWriter(stdout, w), io.MultiWriter(stderr, w), ok
+func (t teeWriteCloser) Close() error {
+	if t.console == nil {
+		return nil
+	}
+	return t.console.Close()
 }
 
 func (a *ActionLogger) RepoFinished(repoName string, patchProduced bool, actionErr error) error {
@@ -209,6 +340,27 @@ func (a *ActionLogger) RepoStarted(repoName, rev string, steps []*ActionStep) {
 	a.write(repoName, yellow, "Starting action @ %s (%d steps)\n", rev, len(steps))
 }
 
+func (a *ActionLogger) RepoWarning(repoName, format string, args ...interface{}) {
+	a.write(repoName, yellow, "WARNING: "+format, args...)
+}
+
+// RepoSkippedByHook reports that a pre-task hook skipped the repository.
+func (a *ActionLogger) RepoSkippedByHook(repoName, reason string) {
+	if reason == "" {
+		reason = "no reason given"
+	}
+	a.write(repoName, yellow, "Skipped by the pre-task hook: %s\n", reason)
+}
+
+// RepoDiffReplacedByHook reports that a post-task hook replaced the diff.
+func (a *ActionLogger) RepoDiffReplacedByHook(repoName string) {
+	a.write(repoName, grey, "The diff was replaced by the post-task hook.\n")
+}
+
+func (a *ActionLogger) RepoAuditWritten(repoName, path string) {
+	a.write(repoName, grey, "Audit record written to %s\n", path)
+}
+
 func (a *ActionLogger) CommandStepStarted(repoName string, step int, args []string) {
 	a.write(repoName, yellow, "%s command %v\n", boldBlack.Sprintf("[Step %d]", step), args)
 }
@@ -239,7 +391,48 @@ func (a *ActionLogger) DockerStepDone(repoName string, step int, elapsed time.Du
 	a.write(repoName, yellow, "%s Done. (%s)\n", boldBlack.Sprintf("[Step %d]", step), elapsed)
 }
 
-func (a *ActionLogger) RepoMatches(repoCount int, skipped, unsupported []string) {
+// StepStalled reports that a step produced no output for the given duration.
+// runner describes the process or container running the step.
+func (a *ActionLogger) StepStalled(repoName string, step int, since time.Duration, runner string, killed bool) {
+	action := "Is it hanging?"
+	if killed {
+		action = "Killing it."
+	}
+	a.write(repoName, yellow, "%s WARNING: no output for %s (%s). %s\n", boldBlack.Sprintf("[Step %d]", step), since.Round(time.Second), runner, action)
+}
+
+// ImageEmulated warns that a Docker image isn't available for the platform
+// the steps should run on, so that they run emulated, which is slow and can
+// fail, e.g. with amd64 images on Apple Silicon.
+func (a *ActionLogger) ImageEmulated(image, imagePlatform, platform string) {
+	a.write("", yellow, "WARNING: Docker image %q is for %s, not %s: its steps run emulated, which is slow and can fail. Use an image for %s or set the platform of the steps.\n\n", image, imagePlatform, platform, platform)
+}
+
+// RepoSizes reports the total size of the repositories the action is executed
+// in, if the size of at least one is known, and the repositories that were
+// skipped because they are too large.
+func (a *ActionLogger) RepoSizes(total uint64, known, unknown int, skipped []string) {
+	if len(skipped) > 0 {
+		msg := fmt.Sprintf("%d repositories were skipped because they are larger than -max-repo-size:\n", len(skipped))
+		for _, repo := range skipped {
+			msg += color.HiYellowString("- %s\n", repo)
+		}
+		a.write("", yellow, "%s\n", msg)
+	}
+	if known == 0 {
+		return
+	}
+	msg := fmt.Sprintf("The repositories are %s in total on Sourcegraph, including their history. The archives downloaded to execute the action are smaller.", humanize.IBytes(total))
+	if unknown > 0 {
+		msg += fmt.Sprintf(" The size of %d repositories is unknown.", unknown)
+	}
+	a.write("", grey, "%s\n\n", msg)
+}
+
+// RepoMatches reports the number of repositories matched by the scopeQuery,
+// the repositories that were skipped and those on unsupported code hosts,
+// which were either included or filtered out.
+func (a *ActionLogger) RepoMatches(repoCount int, skipped, unsupported []string, unsupportedIncluded bool) {
 	for _, r := range skipped {
 		a.Infof("Skipping repository %s because we couldn't determine default branch.\n", r)
 	}
@@ -255,13 +448,13 @@ func (a *ActionLogger) RepoMatches(repoCount int, skipped, unsupported []string)
 		matchesStr = fmt.Sprintf("%s%d repositories match the scopeQuery.", warnStr, repoCount)
 	}
 	if unsupportedCount > 0 {
-		matchesStr += fmt.Sprintf("\n\n%d repositories were filtered out because they are on a codehost not supported by campaigns. (use -include-unsupported to generate patches for them anyway):\n", unsupportedCount)
-		for i, repo := range unsupported {
+		if unsupportedIncluded {
+			matchesStr += fmt.Sprintf("\n\n%d repositories are on a codehost not supported by campaigns. Patches are generated for them, but changesets can't be published and have to be imported once they are created:\n", unsupportedCount)
+		} else {
+			matchesStr += fmt.Sprintf("\n\n%d repositories were filtered out because they are on a codehost not supported by campaigns. (use -allow-unsupported include to generate patches for them anyway):\n", unsupportedCount)
+		}
+		for _, repo := range unsupported {
 			matchesStr += color.HiYellowString("- %s\n", repo)
-			if i == 10 {
-				matchesStr += fmt.Sprintf("and %d more.\n", unsupportedCount-10)
-				break
-			}
 		}
 	}
 	color := yellow
@@ -284,7 +477,7 @@ func (a *ActionLogger) log(repoName string, c *color.Color, format string, args
 	if len(repoName) > 0 {
 		format = fmt.Sprintf("%s -> %s", c.Sprint(repoName), format)
 	}
-	fmt.Fprintf(a.out, c.Sprintf(format, args...))
+	fmt.Fprint(a.out, c.Sprintf(format, args...))
 }
 
 type progress struct {
@@ -327,6 +520,10 @@ func (p *progress) IncPatchCount() {
 	atomic.AddInt64(&p.patchCount, 1)
 }
 
+// progressWriter writes to w and redraws a progress bar below the output
+// after every complete line. The output, the clearing of the previous bar
+// and the new bar are written to w in a single call, so that concurrent
+// writers to w, e.g. output.Stderr, don't end up in the middle of the bar.
 type progressWriter struct {
 	p *progress
 
@@ -344,23 +541,18 @@ func (w *progressWriter) Write(data []byte) (int, error) {
 	if w.closed {
 		return 0, fmt.Errorf("writer closed")
 	}
-	w.clear()
-
-	if w.p.TotalSteps() == 0 {
-		// Don't display bar until we know number of steps
-		w.shouldClear = false
-		return w.w.Write(data)
-	}
-
-	if !bytes.HasSuffix(data, []byte("\n")) && !bytes.HasSuffix(data, []byte("\n\x1b[0m")) {
+	var buf bytes.Buffer
+	w.clear(&buf)
+	prefix := buf.Len()
+	buf.Write(data)
+
+	if w.p.TotalSteps() == 0 || (!bytes.HasSuffix(data, []byte("\n")) && !bytes.HasSuffix(data, []byte("\n\x1b[0m"))) {
+		// Don't display bar until we know number of steps, or in the
+		// middle of a line.
 		w.shouldClear = false
-		return w.w.Write(data)
+		return w.writeFrame(buf.Bytes(), prefix, len(data))
 	}
 
-	n, err := w.w.Write(data)
-	if err != nil {
-		return n, err
-	}
 	total := w.p.TotalSteps()
 	done := w.p.StepsComplete()
 	var pctDone float64
@@ -375,27 +567,50 @@ func (w *progressWriter) Write(data []byte) (int, error) {
 	}
 	bar += strings.Repeat(" ", maxLength-len(bar))
 	progressText := fmt.Sprintf("[%s] Steps: %d/%d (%s, %s)", bar, w.p.StepsComplete(), w.p.TotalSteps(), boldRed.Sprintf("%d failed", w.p.TotalStepsFailed()), hiGreen.Sprintf("%d patches", w.p.PatchCount()))
-	fmt.Fprint(w.w, progressText)
-	w.shouldClear = true
-	w.progressLogLength = len(progressText)
+	buf.WriteString(progressText)
+	n, err := w.writeFrame(buf.Bytes(), prefix, len(data))
+	if err == nil {
+		w.shouldClear = true
+		w.progressLogLength = len(progressText)
+	}
 	return n, err
 }
 
+// writeFrame writes frame, in which data of length n starts at offset, and
+// returns how much of data was written.
+func (w *progressWriter) writeFrame(frame []byte, offset, n int) (int, error) {
+	written, err := w.w.Write(frame)
+	written -= offset
+	if written < 0 {
+		written = 0
+	} else if written > n {
+		written = n
+	}
+	return written, err
+}
+
 // Close clears the progress bar and disallows further writing
 func (w *progressWriter) Close() error {
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
-	w.clear()
+	var buf bytes.Buffer
+	w.clear(&buf)
 	w.closed = true
-	return nil
+	if buf.Len() == 0 {
+		return nil
+	}
+	_, err := w.w.Write(buf.Bytes())
+	return err
 }
 
-func (w *progressWriter) clear() {
+// clear writes what clears the progress bar, if it is displayed, to buf.
+func (w *progressWriter) clear(buf *bytes.Buffer) {
 	if !w.shouldClear {
 		return
 	}
-	fmt.Fprint(w.w, "\r")
-	fmt.Fprint(w.w, strings.Repeat(" ", w.progressLogLength))
-	fmt.Fprint(w.w, "\r")
+	buf.WriteString("\r")
+	buf.WriteString(strings.Repeat(" ", w.progressLogLength))
+	buf.WriteString("\r")
+	w.shouldClear = false
 }
@@ -0,0 +1,115 @@
+package campaigns
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestActionLoggerFollowLogs(t *testing.T) {
+	repos := []string{"github.com/my-org/a", "github.com/my-org/b", "github.com/other/c"}
+
+	for _, tc := range []struct {
+		name   string
+		follow string
+		want   []string
+	}{
+		{name: "all by default", follow: "", want: repos},
+		{name: "single repository", follow: "github.com/my-org/b", want: []string{"github.com/my-org/b"}},
+		{name: "glob", follow: "github.com/my-org/*", want: []string{"github.com/my-org/a", "github.com/my-org/b"}},
+		{name: "no match", follow: "github.com/none/*", want: nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var console bytes.Buffer
+			logs := map[string]*bytes.Buffer{}
+			a := &ActionLogger{
+				out:        &progressWriter{p: new(progress), w: &console},
+				logWriters: map[string]io.Writer{},
+			}
+			for _, repo := range repos {
+				logs[repo] = new(bytes.Buffer)
+				a.logWriters[repo] = logs[repo]
+			}
+			if tc.follow != "" {
+				if err := a.SetFollowLogs(tc.follow); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			for _, repo := range repos {
+				stdout, stderr, ok := a.RepoStdoutStderr(repo)
+				if !ok {
+					t.Fatalf("no writers for %s", repo)
+				}
+				io.WriteString(stdout, "out\n")
+				io.WriteString(stderr, "err")
+				if err := stdout.Close(); err != nil {
+					t.Fatal(err)
+				}
+				if err := stderr.Close(); err != nil {
+					t.Fatal(err)
+				}
+
+				if have, want := logs[repo].String(), "out\nerr"; have != want {
+					t.Errorf("log of %s: have %q, want %q", repo, have, want)
+				}
+			}
+
+			var want string
+			for _, repo := range tc.want {
+				want += fmt.Sprintf("%s -> [STDOUT]: out\n%s -> [STDERR]: err\n", yellow.Sprint(repo), yellow.Sprint(repo))
+			}
+			if diff := cmp.Diff(want, console.String()); diff != "" {
+				t.Errorf("unexpected console output (-want +have):\n%s", diff)
+			}
+		})
+	}
+
+	t.Run("invalid pattern", func(t *testing.T) {
+		if err := new(ActionLogger).SetFollowLogs("github.com/["); err == nil {
+			t.Error("unexpected nil error")
+		}
+	})
+}
+
+func TestProgressWriterConcurrentWrites(t *testing.T) {
+	// progressWriter serializes the writes to rec, which doesn't need to be
+	// safe for concurrent use.
+	var rec recordingWriter
+	p := new(progress)
+	p.SetTotalSteps(10)
+	w := &progressWriter{p: p, w: &rec}
+
+	const writers, lines = 8, 50
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < lines; j++ {
+				fmt.Fprintf(w, "writer %d line %d\n", i, j)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every write but the final clearing of the bar is a complete frame:
+	// the clearing of the previous bar, a line and the new bar.
+	frame := regexp.MustCompile(`^(?:\r +\r)?writer \d+ line \d+\n\[[=> ]{50}\] Steps: 0/10 \(.*\)$`)
+	if len(rec.writes) != writers*lines+1 {
+		t.Fatalf("unexpected number of writes: have %d, want %d", len(rec.writes), writers*lines+1)
+	}
+	for _, write := range rec.writes[:writers*lines] {
+		if !frame.MatchString(write) {
+			t.Fatalf("unexpected write: %q", write)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package campaigns
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// MatrixEntry is a single combination of the values in an action's matrix,
+// mapping each matrix key to one of its values.
+type MatrixEntry map[string]string
+
+// String returns the entry as a sorted, comma-separated list of key=value
+// pairs. The empty entry is returned as an empty string.
+func (e MatrixEntry) String() string {
+	keys := make([]string, 0, len(e))
+	for k := range e {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + "=" + e[k]
+	}
+	return strings.Join(pairs, ",")
+}
+
+// MatrixEntries returns all combinations of the values in the action's
+// matrix. If the action has no matrix, a single empty entry is returned, so
+// that callers can always iterate over the entries.
+func (a Action) MatrixEntries() []MatrixEntry {
+	keys := make([]string, 0, len(a.Matrix))
+	for k := range a.Matrix {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	entries := []MatrixEntry{{}}
+	for _, k := range keys {
+		var expanded []MatrixEntry
+		for _, entry := range entries {
+			for _, v := range a.Matrix[k] {
+				e := MatrixEntry{k: v}
+				for ek, ev := range entry {
+					e[ek] = ev
+				}
+				expanded = append(expanded, e)
+			}
+		}
+		entries = expanded
+	}
+	return entries
+}
+
+var matrixPlaceholderRegexp = regexp.MustCompile(`\$\{\{\s*matrix\.(\w+)\s*\}\}`)
+
+// WithMatrix returns a copy of the action in which all ${{ matrix.KEY }}
+// placeholders in the string fields of its steps, e.g. their images, build
+// contexts, arguments and cache directories, are replaced with the values in
+// entry. It returns an error if a placeholder refers to a key that is not in
+// the matrix.
+func (a Action) WithMatrix(entry MatrixEntry) (Action, error) {
+	var err error
+	replace := func(s string) string {
+		return matrixPlaceholderRegexp.ReplaceAllStringFunc(s, func(m string) string {
+			key := matrixPlaceholderRegexp.FindStringSubmatch(m)[1]
+			v, ok := entry[key]
+			if !ok && err == nil {
+				err = fmt.Errorf("%s refers to %q, which is not defined in the matrix", m, key)
+			}
+			return v
+		})
+	}
+
+	expanded := a
+	expanded.Steps = nil
+	for _, step := range a.Steps {
+		s := step.mapStrings(replace)
+		expanded.Steps = append(expanded.Steps, &s)
+	}
+	return expanded, err
+}
+
+// mapStrings returns a copy of the step in which f was applied to every string
+// field that is set by users, i.e. all but ImageContentDigest.
+func (s ActionStep) mapStrings(f func(string) string) ActionStep {
+	mapAll := func(ss []string) []string {
+		if ss == nil {
+			return nil
+		}
+		mapped := make([]string, len(ss))
+		for i, s := range ss {
+			mapped[i] = f(s)
+		}
+		return mapped
+	}
+
+	s.Type = f(s.Type)
+	s.Image = f(s.Image)
+	s.Build = f(s.Build)
+	s.CacheDirs = mapAll(s.CacheDirs)
+	s.Args = mapAll(s.Args)
+	s.Artifacts = mapAll(s.Artifacts)
+	s.Network = f(s.Network)
+	s.CapDrop = mapAll(s.CapDrop)
+	s.SecurityOpt = mapAll(s.SecurityOpt)
+	s.User = f(s.User)
+	s.Platform = f(s.Platform)
+	return s
+}
@@ -0,0 +1,96 @@
+package campaigns
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMatrixEntries(t *testing.T) {
+	action := Action{Matrix: map[string][]string{
+		"go": {"1.13", "1.14"},
+		"os": {"linux"},
+	}}
+
+	want := []MatrixEntry{
+		{"go": "1.13", "os": "linux"},
+		{"go": "1.14", "os": "linux"},
+	}
+	if diff := cmp.Diff(want, action.MatrixEntries()); diff != "" {
+		t.Errorf("unexpected entries: %s", diff)
+	}
+
+	if diff := cmp.Diff([]MatrixEntry{{}}, Action{}.MatrixEntries()); diff != "" {
+		t.Errorf("unexpected entries without matrix: %s", diff)
+	}
+}
+
+func TestWithMatrix(t *testing.T) {
+	action := Action{
+		Matrix: map[string][]string{"go": {"1.14"}},
+		Steps: []*ActionStep{
+			{Type: "docker", Image: "golang:${{ matrix.go }}", Args: []string{"echo", "${{matrix.go}}"}},
+		},
+	}
+
+	have, err := action.WithMatrix(MatrixEntry{"go": "1.14"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*ActionStep{{Type: "docker", Image: "golang:1.14", Args: []string{"echo", "1.14"}}}
+	if diff := cmp.Diff(want, have.Steps); diff != "" {
+		t.Errorf("unexpected steps: %s", diff)
+	}
+	if action.Steps[0].Image != "golang:${{ matrix.go }}" {
+		t.Errorf("original action was modified")
+	}
+
+	action.Steps[0].Args = []string{"${{ matrix.os }}"}
+	if _, err := action.WithMatrix(MatrixEntry{"go": "1.14"}); err == nil {
+		t.Errorf("expected error for undefined matrix key")
+	}
+
+	action.RequireFileMatches = true
+	action.Steps[0].Args = nil
+	if have, _ := action.WithMatrix(MatrixEntry{"go": "1.14"}); !have.RequireFileMatches {
+		t.Errorf("requireFileMatches was not copied")
+	}
+}
+
+func TestWithMatrixFields(t *testing.T) {
+	const placeholder = "${{ matrix.go }}"
+	entry := MatrixEntry{"go": "1.14"}
+
+	for name, tc := range map[string]struct {
+		step ActionStep
+		want ActionStep
+	}{
+		"type":        {step: ActionStep{Type: placeholder}, want: ActionStep{Type: "1.14"}},
+		"image":       {step: ActionStep{Image: "golang:" + placeholder}, want: ActionStep{Image: "golang:1.14"}},
+		"build":       {step: ActionStep{Build: "./go" + placeholder}, want: ActionStep{Build: "./go1.14"}},
+		"cacheDirs":   {step: ActionStep{CacheDirs: []string{"/go/" + placeholder}}, want: ActionStep{CacheDirs: []string{"/go/1.14"}}},
+		"args":        {step: ActionStep{Args: []string{"echo", placeholder}}, want: ActionStep{Args: []string{"echo", "1.14"}}},
+		"artifacts":   {step: ActionStep{Artifacts: []string{"out-" + placeholder + "/*"}}, want: ActionStep{Artifacts: []string{"out-1.14/*"}}},
+		"network":     {step: ActionStep{Network: "net-" + placeholder}, want: ActionStep{Network: "net-1.14"}},
+		"capDrop":     {step: ActionStep{CapDrop: []string{placeholder}}, want: ActionStep{CapDrop: []string{"1.14"}}},
+		"securityOpt": {step: ActionStep{SecurityOpt: []string{"label=" + placeholder}}, want: ActionStep{SecurityOpt: []string{"label=1.14"}}},
+		"user":        {step: ActionStep{User: "go" + placeholder}, want: ActionStep{User: "go1.14"}},
+		"platform":    {step: ActionStep{Platform: "linux/" + placeholder}, want: ActionStep{Platform: "linux/1.14"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			step := tc.step
+			action := Action{Matrix: map[string][]string{"go": {"1.14"}}, Steps: []*ActionStep{&step}}
+
+			have, err := action.WithMatrix(entry)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff([]*ActionStep{&tc.want}, have.Steps); diff != "" {
+				t.Errorf("unexpected steps: %s", diff)
+			}
+			if diff := cmp.Diff(tc.step, step); diff != "" {
+				t.Errorf("original step was modified: %s", diff)
+			}
+		})
+	}
+}
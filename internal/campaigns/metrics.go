@@ -0,0 +1,219 @@
+package campaigns
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Metrics collects counters and timings over the course of an action
+// execution. They can be written out in the Prometheus text exposition format
+// once the execution is done, so that they can be picked up by e.g. the node
+// exporter's textfile collector.
+//
+// A nil *Metrics is valid and discards everything it is given.
+type Metrics struct {
+	tasksSucceeded int64
+	tasksFailed    int64
+	cacheHits      int64
+	cacheMisses    int64
+	archiveBytes   int64
+
+	mu        sync.Mutex
+	steps     map[string]*durationSummary
+	git       durationSummary
+	apiCalls  durationSummary
+	apiErrors int64
+}
+
+type durationSummary struct {
+	count int64
+	sum   time.Duration
+}
+
+func (s *durationSummary) observe(d time.Duration) {
+	s.count++
+	s.sum += d
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{steps: map[string]*durationSummary{}}
+}
+
+func (m *Metrics) TaskFinished(err error) {
+	if m == nil {
+		return
+	}
+	if err != nil {
+		atomic.AddInt64(&m.tasksFailed, 1)
+	} else {
+		atomic.AddInt64(&m.tasksSucceeded, 1)
+	}
+}
+
+func (m *Metrics) CacheHit() {
+	if m == nil {
+		return
+	}
+	atomic.AddInt64(&m.cacheHits, 1)
+}
+
+func (m *Metrics) CacheMiss() {
+	if m == nil {
+		return
+	}
+	atomic.AddInt64(&m.cacheMisses, 1)
+}
+
+func (m *Metrics) AddArchiveBytes(n int64) {
+	if m == nil {
+		return
+	}
+	atomic.AddInt64(&m.archiveBytes, n)
+}
+
+// ObserveStep records the duration of a single step of the given type
+// ("command" or "docker").
+func (m *Metrics) ObserveStep(stepType string, d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.steps[stepType]
+	if !ok {
+		s = &durationSummary{}
+		m.steps[stepType] = s
+	}
+	s.observe(d)
+}
+
+// ObserveGit records the duration of a git command run to prepare the
+// workspace of a repository or to compute its diff.
+func (m *Metrics) ObserveGit(d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.git.observe(d)
+}
+
+// ObserveAPIRequest records the latency of a single request to the Sourcegraph
+// API.
+func (m *Metrics) ObserveAPIRequest(d time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.apiCalls.observe(d)
+	if err != nil {
+		m.apiErrors++
+	}
+}
+
+// WriteTo writes the metrics in the Prometheus text exposition format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+
+	tasksSucceeded := atomic.LoadInt64(&m.tasksSucceeded)
+	tasksFailed := atomic.LoadInt64(&m.tasksFailed)
+	cacheHits := atomic.LoadInt64(&m.cacheHits)
+	cacheMisses := atomic.LoadInt64(&m.cacheMisses)
+
+	writeHeader(&b, "src_actions_tasks_total", "counter", "Number of repositories the action was executed in, excluding cache hits.")
+	fmt.Fprintf(&b, "src_actions_tasks_total{result=\"success\"} %d\n", tasksSucceeded)
+	fmt.Fprintf(&b, "src_actions_tasks_total{result=\"failure\"} %d\n", tasksFailed)
+
+	writeHeader(&b, "src_actions_cache_hits_total", "counter", "Number of repositories for which a cached result was used.")
+	fmt.Fprintf(&b, "src_actions_cache_hits_total %d\n", cacheHits)
+
+	writeHeader(&b, "src_actions_cache_misses_total", "counter", "Number of repositories for which no cached result was found.")
+	fmt.Fprintf(&b, "src_actions_cache_misses_total %d\n", cacheMisses)
+
+	writeHeader(&b, "src_actions_cache_hit_ratio", "gauge", "Ratio of cache hits to cache lookups.")
+	var ratio float64
+	if lookups := cacheHits + cacheMisses; lookups > 0 {
+		ratio = float64(cacheHits) / float64(lookups)
+	}
+	fmt.Fprintf(&b, "src_actions_cache_hit_ratio %g\n", ratio)
+
+	writeHeader(&b, "src_actions_archive_download_bytes_total", "counter", "Number of bytes downloaded when fetching repository archives.")
+	fmt.Fprintf(&b, "src_actions_archive_download_bytes_total %d\n", atomic.LoadInt64(&m.archiveBytes))
+
+	m.mu.Lock()
+	stepTypes := make([]string, 0, len(m.steps))
+	for t := range m.steps {
+		stepTypes = append(stepTypes, t)
+	}
+	sort.Strings(stepTypes)
+
+	writeHeader(&b, "src_actions_step_duration_seconds", "summary", "Time spent executing action steps.")
+	for _, t := range stepTypes {
+		s := m.steps[t]
+		fmt.Fprintf(&b, "src_actions_step_duration_seconds_sum{type=%q} %g\n", t, s.sum.Seconds())
+		fmt.Fprintf(&b, "src_actions_step_duration_seconds_count{type=%q} %d\n", t, s.count)
+	}
+
+	writeHeader(&b, "src_actions_git_duration_seconds", "summary", "Time spent running git commands in the workspaces of repositories.")
+	fmt.Fprintf(&b, "src_actions_git_duration_seconds_sum %g\n", m.git.sum.Seconds())
+	fmt.Fprintf(&b, "src_actions_git_duration_seconds_count %d\n", m.git.count)
+
+	writeHeader(&b, "src_api_request_duration_seconds", "summary", "Latency of requests to the Sourcegraph API.")
+	fmt.Fprintf(&b, "src_api_request_duration_seconds_sum %g\n", m.apiCalls.sum.Seconds())
+	fmt.Fprintf(&b, "src_api_request_duration_seconds_count %d\n", m.apiCalls.count)
+
+	writeHeader(&b, "src_api_request_errors_total", "counter", "Number of requests to the Sourcegraph API that failed.")
+	fmt.Fprintf(&b, "src_api_request_errors_total %d\n", m.apiErrors)
+	m.mu.Unlock()
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// MetricsSummary are the totals of the metrics, see Metrics.Summary.
+type MetricsSummary struct {
+	// StepDurations is the total time spent executing steps, by step type.
+	StepDurations map[string]time.Duration
+	GitDuration   time.Duration
+	ArchiveBytes  int64
+}
+
+// Summary returns the totals of the metrics collected so far.
+func (m *Metrics) Summary() MetricsSummary {
+	s := MetricsSummary{
+		StepDurations: map[string]time.Duration{},
+		ArchiveBytes:  atomic.LoadInt64(&m.archiveBytes),
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for t, d := range m.steps {
+		s.StepDurations[t] = d.sum
+	}
+	s.GitDuration = m.git.sum
+	return s
+}
+
+// WriteFile writes the metrics to the file at the given path, replacing any
+// previous content.
+func (m *Metrics) WriteFile(path string) error {
+	var b strings.Builder
+	if _, err := m.WriteTo(&b); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, []byte(b.String()), 0644)
+}
+
+func writeHeader(b *strings.Builder, name, kind, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(b, "# TYPE %s %s\n", name, kind)
+}
@@ -0,0 +1,87 @@
+package campaigns
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMetricsWriteTo(t *testing.T) {
+	m := NewMetrics()
+	m.TaskFinished(nil)
+	m.TaskFinished(nil)
+	m.TaskFinished(errors.New("failed"))
+	m.CacheHit()
+	m.CacheMiss()
+	m.CacheMiss()
+	m.CacheMiss()
+	m.AddArchiveBytes(1024)
+	m.AddArchiveBytes(512)
+	m.ObserveStep("docker", 2*time.Second)
+	m.ObserveStep("docker", 500*time.Millisecond)
+	m.ObserveStep("command", 250*time.Millisecond)
+	m.ObserveGit(100 * time.Millisecond)
+	m.ObserveAPIRequest(50*time.Millisecond, nil)
+	m.ObserveAPIRequest(150*time.Millisecond, errors.New("unavailable"))
+
+	var buf bytes.Buffer
+	n, err := m.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("WriteTo returned %d, but wrote %d bytes", n, buf.Len())
+	}
+
+	want := `# HELP src_actions_tasks_total Number of repositories the action was executed in, excluding cache hits.
+# TYPE src_actions_tasks_total counter
+src_actions_tasks_total{result="success"} 2
+src_actions_tasks_total{result="failure"} 1
+# HELP src_actions_cache_hits_total Number of repositories for which a cached result was used.
+# TYPE src_actions_cache_hits_total counter
+src_actions_cache_hits_total 1
+# HELP src_actions_cache_misses_total Number of repositories for which no cached result was found.
+# TYPE src_actions_cache_misses_total counter
+src_actions_cache_misses_total 3
+# HELP src_actions_cache_hit_ratio Ratio of cache hits to cache lookups.
+# TYPE src_actions_cache_hit_ratio gauge
+src_actions_cache_hit_ratio 0.25
+# HELP src_actions_archive_download_bytes_total Number of bytes downloaded when fetching repository archives.
+# TYPE src_actions_archive_download_bytes_total counter
+src_actions_archive_download_bytes_total 1536
+# HELP src_actions_step_duration_seconds Time spent executing action steps.
+# TYPE src_actions_step_duration_seconds summary
+src_actions_step_duration_seconds_sum{type="command"} 0.25
+src_actions_step_duration_seconds_count{type="command"} 1
+src_actions_step_duration_seconds_sum{type="docker"} 2.5
+src_actions_step_duration_seconds_count{type="docker"} 2
+# HELP src_actions_git_duration_seconds Time spent running git commands in the workspaces of repositories.
+# TYPE src_actions_git_duration_seconds summary
+src_actions_git_duration_seconds_sum 0.1
+src_actions_git_duration_seconds_count 1
+# HELP src_api_request_duration_seconds Latency of requests to the Sourcegraph API.
+# TYPE src_api_request_duration_seconds summary
+src_api_request_duration_seconds_sum 0.2
+src_api_request_duration_seconds_count 2
+# HELP src_api_request_errors_total Number of requests to the Sourcegraph API that failed.
+# TYPE src_api_request_errors_total counter
+src_api_request_errors_total 1
+`
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("unexpected metrics (-want +got):\n%s", diff)
+	}
+}
+
+func TestMetricsWriteToEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	if _, err := NewMetrics().WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	// Without lookups, the ratio must be a valid number rather than NaN.
+	if !bytes.Contains(buf.Bytes(), []byte("\nsrc_actions_cache_hit_ratio 0\n")) {
+		t.Errorf("unexpected cache hit ratio in:\n%s", buf.String())
+	}
+}
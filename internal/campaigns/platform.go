@@ -0,0 +1,87 @@
+package campaigns
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// dockerPlatformRegexp matches Docker platforms, e.g. "linux/arm64" or
+// "linux/arm/v7".
+var dockerPlatformRegexp = regexp.MustCompile(`^[a-z0-9_]+/[a-z0-9_]+(?:/[a-z0-9_]+)?$`)
+
+// architectureAliases maps the names some tools use for architectures to
+// those Docker uses.
+var architectureAliases = map[string]string{
+	"x86_64":  "amd64",
+	"aarch64": "arm64",
+}
+
+// normalizePlatform returns the OS and architecture of a Docker platform,
+// without the variant, using Docker's name for the architecture, so that
+// platforms can be compared.
+func normalizePlatform(platform string) string {
+	parts := strings.SplitN(strings.ToLower(platform), "/", 3)
+	if len(parts) < 2 {
+		return platform
+	}
+	if alias, ok := architectureAliases[parts[1]]; ok {
+		parts[1] = alias
+	}
+	return parts[0] + "/" + parts[1]
+}
+
+var (
+	hostPlatformOnce sync.Once
+	hostPlatform     string
+)
+
+// dockerHostPlatform returns the platform of the Docker daemon, which is the
+// platform containers run on natively. With Docker Desktop, it's the platform
+// of the VM, e.g. "linux/arm64" on Apple Silicon. If the daemon can't tell,
+// Linux on the architecture of src is assumed.
+func dockerHostPlatform(ctx context.Context) string {
+	hostPlatformOnce.Do(func() {
+		hostPlatform = "linux/" + runtime.GOARCH
+		out, err := exec.CommandContext(ctx, "docker", "version", "--format", "{{.Server.Os}}/{{.Server.Arch}}").Output()
+		if p := string(bytes.TrimSpace(out)); err == nil && dockerPlatformRegexp.MatchString(p) {
+			hostPlatform = normalizePlatform(p)
+		}
+	})
+	return hostPlatform
+}
+
+// inspectDockerImage returns the ID and the platform of a local image. The
+// output of `docker image inspect` is returned as an error if the image
+// can't be inspected.
+func inspectDockerImage(ctx context.Context, image string) (id, platform string, err error) {
+	out, err := exec.CommandContext(ctx, "docker", "image", "inspect", "--format", "{{.Id}} {{.Os}}/{{.Architecture}}", "--", image).CombinedOutput()
+	if err != nil {
+		return "", "", &dockerInspectError{output: string(bytes.TrimSpace(out))}
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) > 0 {
+		id = fields[0]
+	}
+	if len(fields) > 1 {
+		platform = normalizePlatform(fields[1])
+	}
+	return id, platform, nil
+}
+
+// dockerInspectError is returned by inspectDockerImage if the image can't be
+// inspected.
+type dockerInspectError struct {
+	output string
+}
+
+func (e *dockerInspectError) Error() string { return e.output }
+
+// notFound reports whether the image doesn't exist locally.
+func (e *dockerInspectError) notFound() bool {
+	return strings.Contains(e.output, "No such image")
+}
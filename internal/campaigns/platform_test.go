@@ -0,0 +1,18 @@
+package campaigns
+
+import "testing"
+
+func TestNormalizePlatform(t *testing.T) {
+	for platform, want := range map[string]string{
+		"linux/amd64":    "linux/amd64",
+		"linux/arm64/v8": "linux/arm64",
+		"linux/aarch64":  "linux/arm64",
+		"Linux/x86_64":   "linux/amd64",
+		"linux/arm/v7":   "linux/arm",
+		"linux":          "linux",
+	} {
+		if have := normalizePlatform(platform); have != want {
+			t.Errorf("normalizePlatform(%q) = %q, want %q", platform, have, want)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package campaigns
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// prefixWriter writes each line written to it to w, prefixed with prefix.
+// Partial lines are buffered until a later write completes them or the
+// writer is closed, so that lines written in several calls, e.g. by a step
+// that flushes its output in chunks, are neither split nor prefixed twice.
+// Each line is written to w in a single call. It is safe for concurrent use.
+type prefixWriter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	prefix []byte
+	buf    []byte
+}
+
+func newPrefixWriter(w io.Writer, prefix string) *prefixWriter {
+	return &prefixWriter{w: w, prefix: []byte(prefix)}
+}
+
+// Write writes the complete lines in p to the underlying writer and buffers
+// the rest. If writing a line fails, the returned count excludes that line
+// and the following ones.
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	written := 0
+	for len(b) > 0 {
+		i := bytes.IndexByte(b, '\n')
+		if i < 0 {
+			p.buf = append(p.buf, b...)
+			written += len(b)
+			break
+		}
+		if err := p.writeLine(b[:i+1]); err != nil {
+			return written, err
+		}
+		written += i + 1
+		b = b[i+1:]
+	}
+	return written, nil
+}
+
+// Close writes the buffered partial line, if any, terminated by a newline.
+func (p *prefixWriter) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.buf) == 0 {
+		return nil
+	}
+	return p.writeLine([]byte{'\n'})
+}
+
+// writeLine writes the prefix, the buffered partial line and rest, which
+// must end with a newline, to the underlying writer.
+func (p *prefixWriter) writeLine(rest []byte) error {
+	line := make([]byte, 0, len(p.prefix)+len(p.buf)+len(rest))
+	line = append(line, p.prefix...)
+	line = append(line, p.buf...)
+	line = append(line, rest...)
+	p.buf = p.buf[:0]
+	_, err := p.w.Write(line)
+	return err
+}
@@ -0,0 +1,92 @@
+package campaigns
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPrefixWriter(t *testing.T) {
+	tests := map[string]struct {
+		writes []string
+		want   []string
+	}{
+		"single lines": {
+			writes: []string{"a\n", "b\n"},
+			want:   []string{"> a\n", "> b\n"},
+		},
+		"several lines in one write": {
+			writes: []string{"a\nb\nc\n"},
+			want:   []string{"> a\n", "> b\n", "> c\n"},
+		},
+		"line split across writes": {
+			writes: []string{"hel", "lo wo", "rld\nnext", " line\n"},
+			want:   []string{"> hello world\n", "> next line\n"},
+		},
+		"empty lines": {
+			writes: []string{"\n\n", ""},
+			want:   []string{"> \n", "> \n"},
+		},
+		"partial line flushed on close": {
+			writes: []string{"done\n", "no newline"},
+			want:   []string{"> done\n", "> no newline\n"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			out := &recordingWriter{}
+			w := newPrefixWriter(out, "> ")
+			for _, s := range tc.writes {
+				if n, err := io.WriteString(w, s); err != nil || n != len(s) {
+					t.Fatalf("unexpected write result: n %d, err %v", n, err)
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			// Closing again doesn't write anything.
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, out.writes); diff != "" {
+				t.Errorf("unexpected writes (-want +have):\n%s", diff)
+			}
+		})
+	}
+
+	t.Run("write errors", func(t *testing.T) {
+		errFull := errors.New("disk full")
+		out := &recordingWriter{failAfter: 1, err: errFull}
+		w := newPrefixWriter(out, "> ")
+
+		n, err := io.WriteString(w, "a\nb\nc\n")
+		if err != errFull || n != 2 {
+			t.Errorf("unexpected write result: n %d, err %v", n, err)
+		}
+		if _, err := io.WriteString(w, "partial"); err != nil {
+			t.Fatalf("buffering a partial line failed: %v", err)
+		}
+		if err := w.Close(); err != errFull {
+			t.Errorf("unexpected close error %v", err)
+		}
+	})
+}
+
+// recordingWriter records every write. After failAfter writes, it fails with
+// err, if set.
+type recordingWriter struct {
+	writes    []string
+	failAfter int
+	err       error
+}
+
+func (w *recordingWriter) Write(p []byte) (int, error) {
+	if w.err != nil && len(w.writes) >= w.failAfter {
+		return 0, w.err
+	}
+	w.writes = append(w.writes, string(p))
+	return len(p), nil
+}
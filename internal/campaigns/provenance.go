@@ -0,0 +1,137 @@
+package campaigns
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Provenance describes how a set of patches was produced. It is written next
+// to the patches so that automated code changes can be audited later on.
+type Provenance struct {
+	CLIVersion string            `json:"cliVersion"`
+	RunID      string            `json:"runID,omitempty"`
+	ActionHash string            `json:"actionHash"`
+	Host       ProvenanceHost    `json:"host"`
+	Images     []ProvenanceImage `json:"images,omitempty"`
+	Patches    []ProvenancePatch `json:"patches"`
+	CreatedAt  time.Time         `json:"createdAt"`
+}
+
+type ProvenanceHost struct {
+	Hostname string `json:"hostname"`
+	OS       string `json:"os"`
+	Arch     string `json:"arch"`
+}
+
+type ProvenanceImage struct {
+	Image  string `json:"image"`
+	Digest string `json:"digest"`
+}
+
+type ProvenancePatch struct {
+	Repository   string `json:"repository"`
+	BaseRevision string `json:"baseRevision"`
+	PatchHash    string `json:"patchHash"`
+}
+
+// NewProvenance builds the provenance for the given patches, which were
+// produced by running action as defined in actionFile, after composing it
+// with any action definitions it extends. PrepareAction must
+// have been called on the action so image digests are known. Patches kept in
+// files are hashed without reading them into memory.
+func NewProvenance(cliVersion string, actionFile []byte, action Action, patches []PatchInput) (*Provenance, error) {
+	hostname, _ := os.Hostname()
+
+	p := &Provenance{
+		CLIVersion: cliVersion,
+		ActionHash: sha256Hex(actionFile),
+		Host: ProvenanceHost{
+			Hostname: hostname,
+			OS:       runtime.GOOS,
+			Arch:     runtime.GOARCH,
+		},
+		Patches:   make([]ProvenancePatch, 0, len(patches)),
+		CreatedAt: time.Now().UTC(),
+	}
+
+	for _, step := range action.Steps {
+		if step.Type == "docker" {
+			p.Images = append(p.Images, ProvenanceImage{Image: step.Image, Digest: step.ImageContentDigest})
+		}
+	}
+
+	for _, patch := range patches {
+		h := sha256.New()
+		if err := patch.WritePatch(h); err != nil {
+			return nil, errors.Wrapf(err, "hashing patch for %s", patch.Repository)
+		}
+		p.Patches = append(p.Patches, ProvenancePatch{
+			Repository:   patch.Repository,
+			BaseRevision: patch.BaseRevision,
+			PatchHash:    hex.EncodeToString(h.Sum(nil)),
+		})
+	}
+
+	return p, nil
+}
+
+// WriteFile writes the provenance as JSON to path. If key is non-nil, a
+// base64-encoded ed25519 signature over the exact bytes written is stored in
+// a file next to it with a ".sig" suffix.
+func (p *Provenance) WriteFile(path string, key ed25519.PrivateKey) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		return err
+	}
+
+	if key == nil {
+		return nil
+	}
+	sig := ed25519.Sign(key, data)
+	return ioutil.WriteFile(path+".sig", []byte(base64.StdEncoding.EncodeToString(sig)+"\n"), 0644)
+}
+
+// ReadSigningKey reads a PEM-encoded PKCS #8 ed25519 private key, as created
+// by e.g. `openssl genpkey -algorithm ed25519`.
+func ReadSigningKey(path string) (ed25519.PrivateKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.Errorf("%s does not contain a PEM-encoded key", path)
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing key in %s", path)
+	}
+
+	edKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.Errorf("%s does not contain an ed25519 private key", path)
+	}
+	return edKey, nil
+}
+
+func sha256Hex(data []byte) string {
+	b := sha256.Sum256(data)
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,184 @@
+package campaigns
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestNewProvenance(t *testing.T) {
+	action := Action{Steps: []*ActionStep{
+		{Type: "docker", Image: "golang:1.14", ImageContentDigest: "sha256:abc"},
+		{Type: "command", Args: []string{"gofmt", "-w", "."}},
+		{Type: "docker", Image: "alpine:3", ImageContentDigest: "sha256:def"},
+	}}
+	patchFile, err := ioutil.TempFile("", "provenance-patch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(patchFile.Name())
+	if _, err := patchFile.WriteString("diff b"); err != nil {
+		t.Fatal(err)
+	}
+	patchFile.Close()
+
+	patches := []PatchInput{
+		{Repository: "UmVwbzox", BaseRevision: "deadbeef", Patch: "diff a"},
+		// Patches kept on disk are hashed like those in memory.
+		{Repository: "UmVwbzoy", BaseRevision: "cafebabe", PatchFile: patchFile.Name()},
+	}
+	p, err := NewProvenance("3.17.0", []byte("steps: []"), action, patches)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &Provenance{
+		CLIVersion: "3.17.0",
+		ActionHash: "557a607701752acc545cdabbc5ff51f641ebb7d078ef33d2760bc1e408f7a888",
+		Host:       ProvenanceHost{OS: runtime.GOOS, Arch: runtime.GOARCH},
+		Images: []ProvenanceImage{
+			{Image: "golang:1.14", Digest: "sha256:abc"},
+			{Image: "alpine:3", Digest: "sha256:def"},
+		},
+		Patches: []ProvenancePatch{
+			{Repository: "UmVwbzox", BaseRevision: "deadbeef", PatchHash: sha256Hex([]byte("diff a"))},
+			{Repository: "UmVwbzoy", BaseRevision: "cafebabe", PatchHash: sha256Hex([]byte("diff b"))},
+		},
+	}
+	if diff := cmp.Diff(want, p, cmpopts.IgnoreFields(Provenance{}, "CreatedAt"), cmpopts.IgnoreFields(ProvenanceHost{}, "Hostname")); diff != "" {
+		t.Errorf("unexpected provenance (-want +got):\n%s", diff)
+	}
+	if p.CreatedAt.IsZero() || p.CreatedAt.Location().String() != "UTC" {
+		t.Errorf("unexpected creation time %v", p.CreatedAt)
+	}
+}
+
+func TestProvenanceWriteFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "provenance")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p, err := NewProvenance("3.17.0", []byte("steps: []"), Action{}, []PatchInput{{Repository: "UmVwbzox", Patch: "diff"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("unsigned", func(t *testing.T) {
+		path := filepath.Join(dir, "unsigned.json")
+		if err := p.WriteFile(path, nil); err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var have Provenance
+		if err := json.Unmarshal(data, &have); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(*p, have); diff != "" {
+			t.Errorf("unexpected provenance (-want +got):\n%s", diff)
+		}
+		if _, err := os.Stat(path + ".sig"); !os.IsNotExist(err) {
+			t.Errorf("expected no signature file, got %v", err)
+		}
+	})
+
+	t.Run("signed", func(t *testing.T) {
+		public, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, "signed.json")
+		if err := p.WriteFile(path, private); err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		encoded, err := ioutil.ReadFile(path + ".sig")
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig, err := base64.StdEncoding.DecodeString(strings.TrimSuffix(string(encoded), "\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ed25519.Verify(public, data, sig) {
+			t.Error("the signature doesn't match the written provenance")
+		}
+		if ed25519.Verify(public, append(data, '\n'), sig) {
+			t.Error("the signature matches modified content")
+		}
+	})
+}
+
+func TestReadSigningKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "signing-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeKey := func(name string, key interface{}) string {
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	have, err := ReadSigningKey(writeKey("ed25519.pem", edKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(have, edKey) {
+		t.Error("read key differs from the written one")
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notPEM := filepath.Join(dir, "key.txt")
+	if err := ioutil.WriteFile(notPEM, []byte("not a key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for path, wantErr := range map[string]string{
+		writeKey("ecdsa.pem", ecKey):      "does not contain an ed25519 private key",
+		notPEM:                            "does not contain a PEM-encoded key",
+		filepath.Join(dir, "missing.pem"): "no such file",
+	} {
+		if _, err := ReadSigningKey(path); err == nil || !strings.Contains(err.Error(), wantErr) {
+			t.Errorf("%s: unexpected error %v, want %q", filepath.Base(path), err, wantErr)
+		}
+	}
+}
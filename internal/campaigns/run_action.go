@@ -2,6 +2,7 @@ package campaigns
 
 import (
 	"archive/zip"
+	"bytes"
 	"context"
 	"crypto/sha256"
 	"encoding/base64"
@@ -18,25 +19,111 @@ import (
 	"time"
 
 	"github.com/pkg/errors"
-	"golang.org/x/net/context/ctxhttp"
+	"github.com/sourcegraph/src-cli/internal/api"
+	"github.com/sourcegraph/src-cli/internal/tracing"
 )
 
-func runAction(ctx context.Context, endpoint, accessToken string, additionalHeaders map[string]string, prefix, repoName, rev string, steps []*ActionStep, logger *ActionLogger) ([]byte, error) {
-	logger.RepoStarted(repoName, rev, steps)
+// runOpts are the options of running the steps of an action in the workspace
+// of a repository, see runAction and runSteps.
+type runOpts struct {
+	// prefix is the prefix of the names of temporary files and containers.
+	prefix   string
+	repoName string
+	rev      string
+	// searchResultPaths are the paths of the files matched by the
+	// scopeQuery, if any. They are made available to the steps in the file
+	// named by searchResultPathsEnv.
+	searchResultPaths []string
+	steps             []*ActionStep
+
+	// diffDir is the directory the file containing the diff is written to.
+	// Defaults to the default directory for temporary files.
+	diffDir string
+	// maxDiffSize is the maximum size of the diff in bytes. 0 means no limit.
+	maxDiffSize  int64
+	skipSymlinks bool
+	// cloneURL, if set, is the URL the repository is cloned from instead of
+	// using the downloaded archive, see cloneToTempDir. gitLFS and
+	// submodules are the features the clone is made for.
+	cloneURL   string
+	gitLFS     bool
+	submodules bool
+	// singleContainer causes all docker steps to be executed in a single
+	// container, see startTaskContainer.
+	singleContainer bool
+
+	// watchdog, if non-nil, detects steps that stall.
+	watchdog *stepWatchdog
+	// hooks, which may be nil, are run before and after the steps.
+	hooks *Hooks
+	// artifactsDir, if set, is the directory the artifacts of the steps are
+	// copied into.
+	artifactsDir string
+	// secrets contains the values of the secrets the steps refer to.
+	secrets Secrets
+
+	// audit, if non-nil, records the commands run and the files changed by
+	// each step.
+	audit *AuditRecord
+	// timings, if non-nil, records the running and completed steps.
+	timings *stepTimings
+	logger  *ActionLogger
+	metrics *Metrics
+}
 
-	zipFile, err := fetchRepositoryArchive(ctx, endpoint, accessToken, additionalHeaders, repoName, rev)
-	if err != nil {
-		return nil, errors.Wrap(err, "Fetching ZIP archive failed")
+// runAction runs the steps of an action on the repository contained in the
+// previously downloaded zipFile, or on a clone of it if opts.cloneURL is set,
+// and returns the path of the file containing the resulting diff, see
+// runSteps.
+func runAction(ctx context.Context, zipFile string, opts runOpts) (string, error) {
+	var (
+		volumeDir string
+		err       error
+	)
+	if opts.cloneURL != "" {
+		volumeDir, err = cloneToTempDir(ctx, opts.cloneURL, opts.rev, opts.prefix, opts.gitLFS, opts.submodules)
+		if err != nil {
+			return "", errors.Wrap(err, "Cloning the repository failed")
+		}
+	} else {
+		volumeDir, err = unzipToTempDir(ctx, zipFile, opts.prefix, opts.skipSymlinks)
+		if err != nil {
+			return "", errors.Wrap(err, "Unzipping the ZIP archive failed")
+		}
 	}
-	defer os.Remove(zipFile.Name())
+	defer os.RemoveAll(volumeDir)
 
-	volumeDir, err := unzipToTempDir(ctx, zipFile.Name(), prefix)
-	if err != nil {
-		return nil, errors.Wrap(err, "Unzipping the ZIP archive failed")
+	return runSteps(ctx, volumeDir, opts)
+}
+
+// runSteps runs the steps of an action in the workspace volumeDir, which
+// contains the files of the repository, and returns the path of the file in
+// opts.diffDir containing the resulting diff. The path is empty if the steps
+// changed nothing. The caller is responsible for removing the file.
+func runSteps(ctx context.Context, volumeDir string, opts runOpts) (string, error) {
+	for _, warning := range workspaceWarnings(volumeDir, opts.gitLFS, opts.submodules) {
+		opts.logger.RepoWarning(opts.repoName, "%s\n", warning)
+	}
+
+	hookInput := HookInput{Repository: opts.repoName, Revision: opts.rev, Workspace: volumeDir, SearchResultPaths: opts.searchResultPaths}
+	runHook := func(hook string, modify func(in *HookInput)) (HookOutput, error) {
+		in := hookInput
+		in.Hook = hook
+		if modify != nil {
+			modify(&in)
+		}
+		return opts.hooks.run(ctx, in)
+	}
+
+	if out, err := runHook(HookPreTask, nil); err != nil {
+		return "", err
+	} else if out.Skip {
+		opts.logger.RepoSkippedByHook(opts.repoName, out.Reason)
+		return "", nil
 	}
-	defer os.RemoveAll(volumeDir)
 
 	runGitCmd := func(args ...string) ([]byte, error) {
+		defer func(start time.Time) { opts.metrics.ObserveGit(time.Since(start)) }(time.Now())
 		cmd := exec.CommandContext(ctx, "git", args...)
 		cmd.Dir = volumeDir
 		out, err := cmd.CombinedOutput()
@@ -47,122 +134,506 @@ func runAction(ctx context.Context, endpoint, accessToken string, additionalHead
 	}
 
 	if _, err := runGitCmd("init"); err != nil {
-		return nil, errors.Wrap(err, "git init failed")
+		return "", errors.Wrap(err, "git init failed")
 	}
 	// --force because we want previously "gitignored" files in the repository
 	if _, err := runGitCmd("add", "--force", "--all"); err != nil {
-		return nil, errors.Wrap(err, "git add failed")
+		return "", errors.Wrap(err, "git add failed")
 	}
 	if _, err := runGitCmd("commit", "--quiet", "--all", "-m", "src-action-exec"); err != nil {
-		return nil, errors.Wrap(err, "git commit failed")
+		return "", errors.Wrap(err, "git commit failed")
+	}
+
+	var (
+		container *taskContainer
+		pathsFile string
+		err       error
+	)
+	if len(opts.searchResultPaths) > 0 {
+		if pathsFile, err = writeSearchResultPaths(opts.prefix, opts.searchResultPaths); err != nil {
+			return "", err
+		}
+		defer os.Remove(pathsFile)
+	}
+	if opts.singleContainer {
+		for _, step := range opts.steps {
+			if step.Type != "docker" {
+				continue
+			}
+			if container, err = startTaskContainer(ctx, volumeDir, opts.prefix, opts.repoName, opts.rev, pathsFile, step); err != nil {
+				return "", err
+			}
+			defer container.remove()
+			break
+		}
+	}
+
+	// artifacts are the files matched by the artifacts of the steps. Those
+	// that are not part of the repository are removed from the workspace
+	// after the last step, so that they don't end up in the diff.
+	var artifacts []string
+	for i, step := range opts.steps {
+		var auditStep *AuditStep
+		if opts.audit != nil {
+			opts.audit.Steps = append(opts.audit.Steps, AuditStep{
+				Type:        step.Type,
+				Image:       step.Image,
+				ImageDigest: step.ImageContentDigest,
+			})
+			auditStep = &opts.audit.Steps[len(opts.audit.Steps)-1]
+		}
+		opts.timings.stepStarted(i)
+		if err := runStep(ctx, volumeDir, opts.prefix, opts.repoName, opts.rev, pathsFile, i, step, container, opts.watchdog, opts.secrets, auditStep, opts.logger, opts.metrics); err != nil {
+			return "", err
+		}
+		opts.timings.stepDone()
+
+		stepIndex := i
+		if _, err := runHook(HookPostStep, func(in *HookInput) { in.Step, in.StepType = &stepIndex, step.Type }); err != nil {
+			return "", err
+		}
+		if len(step.Artifacts) > 0 {
+			files, err := matchArtifacts(volumeDir, step.Artifacts)
+			if err != nil {
+				return "", err
+			}
+			if opts.artifactsDir != "" {
+				if err := copyArtifacts(volumeDir, filepath.Join(opts.artifactsDir, fmt.Sprintf("step-%d", i+1)), files); err != nil {
+					return "", err
+				}
+			}
+			artifacts = append(artifacts, files...)
+		}
+		if opts.audit == nil {
+			continue
+		}
+
+		// Record the files changed by this step and add them to the index,
+		// so that the next step's changes can be told apart.
+		status, err := runGitCmd("status", "--porcelain", "--untracked-files=all")
+		if err != nil {
+			return "", errors.Wrap(err, "git status failed")
+		}
+		auditStep.ChangedFiles = changedFiles(status)
+		if _, err := runGitCmd("add", "--all"); err != nil {
+			return "", errors.Wrap(err, "git add failed")
+		}
+	}
+
+	if len(artifacts) > 0 {
+		if err := removeUntrackedArtifacts(volumeDir, artifacts, runGitCmd); err != nil {
+			return "", err
+		}
+	}
+
+	if _, err := runGitCmd("add", "--all"); err != nil {
+		return "", errors.Wrap(err, "git add failed")
+	}
+
+	// As of Sourcegraph 3.14 we only support unified diff format.
+	// That means we need to strip away the `a/` and `/b` prefixes with `--no-prefix`.
+	// See: https://github.com/sourcegraph/sourcegraph/blob/82d5e7e1562fef6be5c0b17f18631040fd330835/enterprise/internal/campaigns/service.go#L324-L329
+	//
+	// Also, we need to add --binary so binary file changes are inlined in the patch.
+	//
+	diffStart := time.Now()
+	diffFile, err := diffToFile(ctx, volumeDir, opts.diffDir, opts.prefix, opts.maxDiffSize, "diff", "--cached", "--no-prefix", "--binary")
+	opts.metrics.ObserveGit(time.Since(diffStart))
+	if err != nil {
+		return "", errors.Wrap(err, "git diff failed")
+	}
+
+	// The diff is only read into memory if a post-task hook is given it.
+	if opts.hooks.path(HookPostTask) == "" {
+		return diffFile, nil
+	}
+	diff, err := readDiffFile(diffFile)
+	if err != nil {
+		os.Remove(diffFile)
+		return "", err
+	}
+	out, err := runHook(HookPostTask, func(in *HookInput) { in.Diff = &diff })
+	if err != nil {
+		os.Remove(diffFile)
+		return "", err
+	}
+	if out.Diff == nil {
+		return diffFile, nil
+	}
+	os.Remove(diffFile)
+	if opts.maxDiffSize > 0 && int64(len(*out.Diff)) > opts.maxDiffSize {
+		return "", &errDiffTooLarge{limit: opts.maxDiffSize}
 	}
+	opts.logger.RepoDiffReplacedByHook(opts.repoName)
+	return writeDiffFile(opts.diffDir, opts.prefix, *out.Diff)
+}
+
+// workspaceWarnings returns warnings about repository features that are not
+// available in the workspace. Archives contain neither Git LFS objects nor the
+// contents of submodules, which otherwise makes steps that build or test the
+// code fail in confusing ways. Unless gitLFS or submodules is set, in which
+// case the workspace is a clone that contains them, the missing features are
+// warned about.
+func workspaceWarnings(dir string, gitLFS, submodules bool) []string {
+	var warnings []string
+
+	if attrs, err := ioutil.ReadFile(filepath.Join(dir, ".gitattributes")); err == nil && bytes.Contains(attrs, []byte("filter=lfs")) && !gitLFS {
+		warnings = append(warnings, "Repository uses Git LFS. LFS objects are not fetched, so the workspace contains LFS pointer files instead. Use -git-lfs to fetch them.")
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".gitmodules")); err == nil && !submodules {
+		warnings = append(warnings, "Repository uses Git submodules. Submodules are not initialized, so their directories in the workspace are empty. Use -submodules to initialize them.")
+	}
+
+	return warnings
+}
+
+// diffToFile runs the given git diff command in dir, writes its output to a
+// new file in diffDir and returns the path of the file, or an empty path if
+// the diff is empty. The diff is never read into memory. If it exceeds
+// maxSize bytes, the command is aborted and an errDiffTooLarge is returned. A
+// maxSize of 0 means no limit.
+func diffToFile(ctx context.Context, dir, diffDir, prefix string, maxSize int64, args ...string) (_ string, err error) {
+	if diffDir == "" {
+		diffDir = tempDirPrefix
+	}
+	f, err := ioutil.TempFile(diffDir, prefix+"-diff")
+	if err != nil {
+		return "", errors.Wrap(err, "Creating a diff file failed")
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(f.Name())
+		}
+	}()
+
+	var stderr bytes.Buffer
+	out := &limitedWriter{w: f, limit: maxSize}
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Stdout = out
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if out.exceeded {
+			return "", &errDiffTooLarge{limit: maxSize}
+		}
+		return "", errors.Wrapf(err, "'git %s' failed: %s", strings.Join(args, " "), stderr.Bytes())
+	}
+
+	if out.n == 0 {
+		os.Remove(f.Name())
+		return "", nil
+	}
+	return f.Name(), nil
+}
+
+// writeDiffFile writes diff to a new file in diffDir and returns its path, or
+// an empty path if diff is empty.
+func writeDiffFile(diffDir, prefix, diff string) (_ string, err error) {
+	if diff == "" {
+		return "", nil
+	}
+	if diffDir == "" {
+		diffDir = tempDirPrefix
+	}
+	f, err := ioutil.TempFile(diffDir, prefix+"-diff")
+	if err != nil {
+		return "", errors.Wrap(err, "Creating a diff file failed")
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(f.Name())
+		}
+	}()
+
+	if _, err := io.WriteString(f, diff); err != nil {
+		return "", errors.Wrap(err, "Writing the diff file failed")
+	}
+	return f.Name(), nil
+}
+
+// readDiffFile returns the content of the diff file at path, which is empty
+// if path is.
+func readDiffFile(path string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", errors.Wrap(err, "Reading the diff file failed")
+	}
+	return string(data), nil
+}
+
+// limitedWriter writes to w until more than limit bytes have been written, at
+// which point it fails all further writes. A limit of 0 means no limit.
+type limitedWriter struct {
+	w        io.Writer
+	limit    int64
+	n        int64
+	exceeded bool
+}
 
-	for i, step := range steps {
-		switch step.Type {
-		case "command":
-			logger.CommandStepStarted(repoName, i, step.Args)
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	if l.limit > 0 && l.n+int64(len(p)) > l.limit {
+		l.exceeded = true
+		return 0, errors.New("write limit exceeded")
+	}
+	n, err := l.w.Write(p)
+	l.n += int64(n)
+	return n, err
+}
 
-			cmd := exec.CommandContext(ctx, step.Args[0], step.Args[1:]...)
-			cmd.Dir = volumeDir
+type errDiffTooLarge struct{ limit int64 }
 
-			if stdout, stderr, ok := logger.RepoStdoutStderr(repoName); ok {
-				cmd.Stdout = stdout
-				cmd.Stderr = stderr
+func (e *errDiffTooLarge) Error() string {
+	return fmt.Sprintf("The diff produced by the action is larger than the maximum of %d MiB. Reduce the changes made in this repository or raise the limit with -max-diff-size.", e.limit/(1024*1024))
+}
+
+// runStep runs a single step of an action in the given volume directory. If
+// container is non-nil, docker steps are executed in it instead of a new
+// container. If watchdog is non-nil, it reports or kills the step when it
+// stalls. The secrets the step refers to are passed to it as environment
+// variables and redacted in its output. If audit is non-nil, the command that
+// is run is recorded in it.
+func runStep(ctx context.Context, volumeDir, prefix, repoName, rev, pathsFile string, i int, step *ActionStep, container *taskContainer, watchdog *stepWatchdog, secrets Secrets, audit *AuditStep, logger *ActionLogger, metrics *Metrics) (err error) {
+	span, ctx := tracing.StartSpan(ctx, "Run step")
+	span.SetAttribute("repository", repoName)
+	span.SetAttribute("step", i)
+	span.SetAttribute("type", step.Type)
+	defer func() { span.Finish(err) }()
+
+	if audit != nil {
+		audit.StartedAt = time.Now()
+		defer func() {
+			audit.FinishedAt = time.Now()
+			if err != nil {
+				audit.Error = err.Error()
 			}
+		}()
+	}
 
-			if err := cmd.Run(); err != nil {
-				logger.CommandStepErrored(repoName, i, err)
-				return nil, errors.Wrap(err, "run command")
+	// stepCtx is canceled when the watchdog kills the step. Cleaning up
+	// after the step uses ctx, so that it isn't affected.
+	stepCtx, kill := context.WithCancel(ctx)
+	defer kill()
+
+	resolved, secretNames := secrets.resolve(step)
+	var env []string
+	if len(secretNames) > 0 {
+		env = append(os.Environ(), secrets.env(secretNames)...)
+	}
+
+	switch step.Type {
+	case "command":
+		logger.CommandStepStarted(repoName, i, step.Args)
+
+		cmd := exec.CommandContext(stepCtx, resolved.Args[0], resolved.Args[1:]...)
+		cmd.Dir = volumeDir
+		if pathsFile != "" {
+			if env == nil {
+				env = os.Environ()
 			}
-			logger.CommandStepDone(repoName, i)
+			env = append(env, searchResultPathsEnv+"="+pathsFile)
+		}
+		cmd.Env = env
+		if audit != nil {
+			audit.Command = secrets.redact(cmd.Args)
+		}
 
-		case "docker":
-			logger.DockerStepStarted(repoName, i, step.Image)
+		closeOutput := connectStepOutput(cmd, repoName, logger, secrets)
 
+		t0 := time.Now()
+		err := watchdog.run(cmd, i, func(since time.Duration) {
+			logger.StepStalled(repoName, i, since, fmt.Sprintf("process %d", cmd.Process.Pid), watchdog.kill)
+		}, kill)
+		if cerr := closeOutput(); err == nil {
+			err = cerr
+		}
+		metrics.ObserveStep(step.Type, time.Since(t0))
+		if err != nil {
+			logger.CommandStepErrored(repoName, i, err)
+			return errors.Wrap(err, "run command")
+		}
+		logger.CommandStepDone(repoName, i)
+
+	case "docker":
+		logger.DockerStepStarted(repoName, i, step.Image)
+
+		var (
+			cmd         *exec.Cmd
+			containerID func() string
+		)
+		if container != nil {
+			cmd = container.command(stepCtx, resolved, secretNames)
+			containerID = func() string { return container.id }
+		} else {
 			cidFile, err := ioutil.TempFile(tempDirPrefix, prefix+"-container-id")
 			if err != nil {
-				return nil, errors.Wrap(err, "Creating a CID file failed")
+				return errors.Wrap(err, "Creating a CID file failed")
 			}
 			_ = os.Remove(cidFile.Name()) // docker exits if this file exists upon `docker run` starting
-			defer func() {
-				cid, err := ioutil.ReadFile(cidFile.Name())
-				_ = os.Remove(cidFile.Name())
-				if err == nil {
-					ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
-					defer cancel()
-					_ = exec.CommandContext(ctx, "docker", "rm", "-f", "--", string(cid)).Run()
-				}
-			}()
-
-			const workDir = "/work"
-			cmd := exec.CommandContext(ctx, "docker", "run",
-				"--rm",
-				"--cidfile", cidFile.Name(),
-				"--workdir", workDir,
-				"--mount", fmt.Sprintf("type=bind,source=%s,target=%s", volumeDir, workDir),
-			)
-			for _, cacheDir := range step.CacheDirs {
-				// persistentCacheDir returns a host directory that persists across runs of this
-				// action for this repository. It is useful for (e.g.) yarn and npm caches.
-				persistentCacheDir := func(containerDir string) (string, error) {
-					baseCacheDir, err := UserCacheDir()
-					if err != nil {
-						return "", err
-					}
-					b := sha256.Sum256([]byte(fmt.Sprintf("%s:%s:%s", step.Image, repoName, rev)))
-					return filepath.Join(baseCacheDir, "action-exec-cache-dir",
-						base64.RawURLEncoding.EncodeToString(b[:16]),
-						strings.TrimPrefix(cacheDir, string(os.PathSeparator))), nil
-				}
+			// The container is removed even if ctx is cancelled, e.g.
+			// because the execution failed in another repository.
+			defer removeContainer(context.Background(), cidFile.Name())
 
-				hostDir, err := persistentCacheDir(cacheDir)
-				if err != nil {
-					return nil, err
-				}
-				if err := os.MkdirAll(hostDir, 0700); err != nil {
-					return nil, err
-				}
-				cmd.Args = append(cmd.Args, "--mount", fmt.Sprintf("type=bind,source=%s,target=%s", hostDir, cacheDir))
+			containerArgs, err := dockerContainerArgs(volumeDir, repoName, rev, pathsFile, step)
+			if err != nil {
+				return err
+			}
+			cmd = exec.CommandContext(stepCtx, "docker", "run", "--rm", "--cidfile", cidFile.Name())
+			cmd.Args = append(cmd.Args, containerArgs...)
+			for _, name := range secretNames {
+				// Without a value, docker takes it from its own environment.
+				cmd.Args = append(cmd.Args, "--env", name)
 			}
 			cmd.Args = append(cmd.Args, "--", step.Image)
-			cmd.Args = append(cmd.Args, step.Args...)
-			cmd.Dir = volumeDir
+			cmd.Args = append(cmd.Args, resolved.Args...)
+			containerID = func() string {
+				// Docker writes the file once the container was created.
+				cid, _ := ioutil.ReadFile(cidFile.Name())
+				return string(cid)
+			}
+		}
+		cmd.Dir = volumeDir
+		cmd.Env = env
+		if audit != nil {
+			audit.Command = secrets.redact(cmd.Args)
+		}
 
-			if stdout, stderr, ok := logger.RepoStdoutStderr(repoName); ok {
-				cmd.Stdout = stdout
-				cmd.Stderr = stderr
+		closeOutput := connectStepOutput(cmd, repoName, logger, secrets)
+
+		t0 := time.Now()
+		err = watchdog.run(cmd, i, func(since time.Duration) {
+			runner := "container not created yet"
+			if id := containerID(); id != "" {
+				runner = "container " + id
 			}
+			logger.StepStalled(repoName, i, since, runner, watchdog.kill)
+		}, kill)
+		if cerr := closeOutput(); err == nil {
+			err = cerr
+		}
+		elapsed := time.Since(t0).Round(time.Millisecond)
+		metrics.ObserveStep(step.Type, elapsed)
+		if err != nil {
+			logger.DockerStepErrored(repoName, i, err, elapsed)
+			return errors.Wrapf(err, "Running Docker container for image %q failed", step.Image)
+		}
+		logger.DockerStepDone(repoName, i, elapsed)
 
-			t0 := time.Now()
-			err = cmd.Run()
-			elapsed := time.Since(t0).Round(time.Millisecond)
+	default:
+		return fmt.Errorf("unrecognized run type %q", step.Type)
+	}
+
+	return nil
+}
+
+// connectStepOutput connects the standard output and error of cmd to the log
+// of the repository, with the values of secrets redacted. The returned
+// function must be called once cmd is done, to print final partial lines.
+func connectStepOutput(cmd *exec.Cmd, repoName string, logger *ActionLogger, secrets Secrets) (closeOutput func() error) {
+	stdout, stderr, ok := logger.RepoStdoutStderr(repoName)
+	if !ok {
+		return func() error { return nil }
+	}
+	stdout, stderr = secrets.redactWriter(stdout), secrets.redactWriter(stderr)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	return func() error {
+		err := stdout.Close()
+		if serr := stderr.Close(); err == nil {
+			err = serr
+		}
+		return err
+	}
+}
+
+// dockerWorkDir is the directory the workspace is mounted at in containers.
+const dockerWorkDir = "/work"
+
+// dockerContainerArgs returns the `docker run` arguments that mount the
+// workspace and the cache directories of the step and apply its hardening
+// options.
+func dockerContainerArgs(volumeDir, repoName, rev, pathsFile string, step *ActionStep) ([]string, error) {
+	args := []string{
+		"--workdir", dockerWorkDir,
+		"--mount", fmt.Sprintf("type=bind,source=%s,target=%s", volumeDir, dockerWorkDir),
+	}
+	if step.Platform != "" {
+		args = append(args, "--platform", step.Platform)
+	}
+	if pathsFile != "" {
+		args = append(args,
+			"--mount", fmt.Sprintf("type=bind,source=%s,target=%s,readonly", pathsFile, searchResultPathsContainerFile),
+			"--env", searchResultPathsEnv+"="+searchResultPathsContainerFile,
+		)
+	}
+	for _, cacheDir := range step.CacheDirs {
+		// persistentCacheDir returns a host directory that persists across runs of this
+		// action for this repository. It is useful for (e.g.) yarn and npm caches.
+		persistentCacheDir := func(containerDir string) (string, error) {
+			baseCacheDir, err := UserCacheDir()
 			if err != nil {
-				logger.DockerStepErrored(repoName, i, err, elapsed)
-				return nil, errors.Wrapf(err, "Running Docker container for image %q failed", step.Image)
+				return "", err
 			}
-			logger.DockerStepDone(repoName, i, elapsed)
+			b := sha256.Sum256([]byte(fmt.Sprintf("%s:%s:%s", step.Image, repoName, rev)))
+			return filepath.Join(baseCacheDir, "action-exec-cache-dir",
+				base64.RawURLEncoding.EncodeToString(b[:16]),
+				strings.TrimPrefix(cacheDir, string(os.PathSeparator))), nil
+		}
 
-		default:
-			return nil, fmt.Errorf("unrecognized run type %q", step.Type)
+		hostDir, err := persistentCacheDir(cacheDir)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(hostDir, 0700); err != nil {
+			return nil, err
 		}
+		args = append(args, "--mount", fmt.Sprintf("type=bind,source=%s,target=%s", hostDir, cacheDir))
 	}
+	return append(args, hardeningArgs(step)...), nil
+}
 
-	if _, err := runGitCmd("add", "--all"); err != nil {
-		return nil, errors.Wrap(err, "git add failed")
+// removeContainer force-removes the container whose ID was written to
+// cidFile, if any, and removes the file.
+func removeContainer(ctx context.Context, cidFile string) {
+	cid, err := ioutil.ReadFile(cidFile)
+	_ = os.Remove(cidFile)
+	if err == nil {
+		ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+		defer cancel()
+		_ = exec.CommandContext(ctx, "docker", "rm", "-f", "--", string(cid)).Run()
 	}
+}
 
-	// As of Sourcegraph 3.14 we only support unified diff format.
-	// That means we need to strip away the `a/` and `/b` prefixes with `--no-prefix`.
-	// See: https://github.com/sourcegraph/sourcegraph/blob/82d5e7e1562fef6be5c0b17f18631040fd330835/enterprise/internal/campaigns/service.go#L324-L329
-	//
-	// Also, we need to add --binary so binary file changes are inlined in the patch.
-	//
-	diffOut, err := runGitCmd("diff", "--cached", "--no-prefix", "--binary")
-	if err != nil {
-		return nil, errors.Wrap(err, "git diff failed")
+// hardeningArgs returns the `docker run` arguments for the hardening options of
+// the given step.
+func hardeningArgs(step *ActionStep) []string {
+	var args []string
+	// "default" means Docker's default network, which is used if --network
+	// isn't given.
+	if step.Network != "" && step.Network != "default" {
+		args = append(args, "--network", step.Network)
 	}
-
-	return diffOut, err
+	if step.ReadOnly {
+		args = append(args, "--read-only", "--tmpfs", "/tmp")
+	}
+	for _, c := range step.CapDrop {
+		args = append(args, "--cap-drop", c)
+	}
+	for _, o := range step.SecurityOpt {
+		args = append(args, "--security-opt", o)
+	}
+	if step.User != "" {
+		args = append(args, "--user", step.User)
+	}
+	return args
 }
 
 // We use an explicit prefix for our temp directories, because otherwise Go
@@ -171,32 +642,110 @@ func runAction(ctx context.Context, endpoint, accessToken string, additionalHead
 // folders, but it does have `/tmp` in there.
 const tempDirPrefix = "/tmp"
 
-func unzipToTempDir(ctx context.Context, zipFile, prefix string) (string, error) {
+func unzipToTempDir(ctx context.Context, zipFile, prefix string, skipSymlinks bool) (string, error) {
 	volumeDir, err := ioutil.TempDir(tempDirPrefix, prefix)
 	if err != nil {
 		return "", err
 	}
-	return volumeDir, unzip(zipFile, volumeDir)
+	return volumeDir, unzip(zipFile, volumeDir, skipSymlinks)
 }
 
-func fetchRepositoryArchive(ctx context.Context, endpoint, accessToken string, additionalHeaders map[string]string, repoName, rev string) (*os.File, error) {
-	zipURL, err := repositoryZipArchiveURL(endpoint, repoName, rev, "")
+// cloneToTempDir creates a workspace by cloning the commit rev of the
+// repository at url into a new temporary directory, since archives contain
+// neither Git LFS objects nor the contents of submodules. If gitLFS is set,
+// the LFS objects are fetched, and if submodules is set, the submodules are
+// initialized recursively. Credentials are taken from the Git configuration.
+func cloneToTempDir(ctx context.Context, url, rev, prefix string, gitLFS, submodules bool) (_ string, err error) {
+	volumeDir, err := ioutil.TempDir(tempDirPrefix, prefix)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
+	defer func() {
+		if err != nil {
+			os.RemoveAll(volumeDir)
+		}
+	}()
 
-	req, err := http.NewRequest("GET", zipURL.String(), nil)
-	if err != nil {
-		return nil, err
+	cmds := [][]string{
+		{"init", "--quiet"},
+		{"remote", "add", "origin", url},
+		{"fetch", "--quiet", "--depth=1", "origin", rev},
+		{"checkout", "--quiet", "FETCH_HEAD"},
 	}
-	req.Header.Set("Accept", "application/zip")
-	if accessToken != "" {
-		req.Header.Set("Authorization", "token "+accessToken)
+	if gitLFS {
+		cmds = append(cmds, []string{"lfs", "pull", "origin"})
 	}
-	for k, v := range additionalHeaders {
-		req.Header.Set(k, v)
+	if submodules {
+		cmds = append(cmds, []string{"submodule", "--quiet", "update", "--init", "--recursive", "--depth=1"})
+	}
+	for _, args := range cmds {
+		cmd := exec.CommandContext(ctx, "git", args...)
+		cmd.Dir = volumeDir
+		// LFS objects are only fetched by 'git lfs pull', if at all, and
+		// missing credentials fail the clone instead of prompting for them.
+		cmd.Env = append(os.Environ(), "GIT_LFS_SKIP_SMUDGE=1", "GIT_TERMINAL_PROMPT=0")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return "", errors.Wrapf(err, "'git %s' failed: %s", strings.Join(args, " "), out)
+		}
 	}
-	resp, err := ctxhttp.Do(ctx, nil, req)
+	return volumeDir, nil
+}
+
+// archiveAttempts is how often an archive is downloaded before a corrupt
+// archive fails the execution.
+const archiveAttempts = 3
+
+// errCorruptArchive is returned for archives that were truncated or corrupted
+// while they were downloaded.
+type errCorruptArchive struct {
+	reason string
+}
+
+func (e *errCorruptArchive) Error() string {
+	return "corrupt archive: " + e.reason
+}
+
+// fetchRepositoryArchive downloads the archive of the repository at rev into
+// a temporary file, sending the Authorization header authorization if it
+// isn't empty, see api.Authorization. Archives that are truncated or corrupted while they are
+// downloaded are downloaded again.
+func fetchRepositoryArchive(ctx context.Context, endpoint, authorization string, additionalHeaders map[string]string, repoName, rev string, limiter *DownloadLimiter, metrics *Metrics) (*os.File, error) {
+	var err error
+	for attempt := 1; attempt <= archiveAttempts; attempt++ {
+		var f *os.File
+		f, err = downloadRepositoryArchive(ctx, endpoint, authorization, additionalHeaders, repoName, rev, limiter, metrics)
+		if _, corrupt := err.(*errCorruptArchive); !corrupt || ctx.Err() != nil {
+			return f, err
+		}
+	}
+	return nil, errors.Wrapf(err, "the archive of %s was corrupt in %d attempts to download it", repoName, archiveAttempts)
+}
+
+// downloadRepositoryArchive downloads the archive of the repository once. It
+// checks that the archive has the size given in the Content-Length header and
+// the SHA-256 checksum given in the Digest header, if any, and that it is a
+// valid ZIP archive, and returns an *errCorruptArchive if not.
+func downloadRepositoryArchive(ctx context.Context, endpoint, authorization string, additionalHeaders map[string]string, repoName, rev string, limiter *DownloadLimiter, metrics *Metrics) (_ *os.File, err error) {
+	zipURL, err := repositoryZipArchiveURL(endpoint, repoName, rev, "")
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := api.DoWhenAvailable(ctx, true, func() (*http.Request, error) {
+		req, err := http.NewRequest("GET", zipURL.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "application/zip")
+		api.SetUserAgent(req)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		for k, v := range additionalHeaders {
+			req.Header.Set(k, v)
+		}
+		return req, nil
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -210,14 +759,52 @@ func fetchRepositoryArchive(ctx context.Context, endpoint, accessToken string, a
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close()
+	defer func() {
+		f.Close()
+		if err != nil {
+			os.Remove(f.Name())
+		}
+	}()
 
-	if _, err := io.Copy(f, resp.Body); err != nil {
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, hash), limiter.reader(ctx, resp.Body))
+	metrics.AddArchiveBytes(n)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		// The connection was most likely interrupted.
+		return nil, &errCorruptArchive{reason: fmt.Sprintf("download interrupted after %d bytes: %s", n, err)}
+	}
+	if resp.ContentLength >= 0 && n != resp.ContentLength {
+		return nil, &errCorruptArchive{reason: fmt.Sprintf("received %d of %d bytes", n, resp.ContentLength)}
+	}
+	if want, ok := sha256Digest(resp.Header); ok && want != base64.StdEncoding.EncodeToString(hash.Sum(nil)) {
+		return nil, &errCorruptArchive{reason: "SHA-256 checksum mismatch"}
+	}
+	if err := f.Close(); err != nil {
 		return nil, err
 	}
+	r, err := zip.OpenReader(f.Name())
+	if err != nil {
+		return nil, &errCorruptArchive{reason: err.Error()}
+	}
+	r.Close()
 	return f, nil
 }
 
+// sha256Digest returns the base64-encoded SHA-256 checksum in the Digest
+// header (RFC 3230), if any.
+func sha256Digest(h http.Header) (string, bool) {
+	for _, digest := range strings.Split(h.Get("Digest"), ",") {
+		parts := strings.SplitN(strings.TrimSpace(digest), "=", 2)
+		if len(parts) == 2 && strings.EqualFold(parts[0], "sha-256") {
+			return parts[1], true
+		}
+	}
+	return "", false
+}
+
 func repositoryZipArchiveURL(endpoint, repoName, rev, token string) (*url.URL, error) {
 	u, err := url.Parse(endpoint)
 	if err != nil {
@@ -230,14 +817,23 @@ func repositoryZipArchiveURL(endpoint, repoName, rev, token string) (*url.URL, e
 	return u, nil
 }
 
-func unzip(zipFile, dest string) error {
+// unzip extracts zipFile into dest, preserving the permission bits of files
+// and recreating symbolic links, unless skipSymlinks is set. Entries and link
+// targets that would end up outside of dest are rejected.
+func unzip(zipFile, dest string, skipSymlinks bool) error {
 	r, err := zip.OpenReader(zipFile)
 	if err != nil {
 		return err
 	}
 	defer r.Close()
 
-	outputBase := filepath.Clean(dest) + string(os.PathSeparator)
+	dest = filepath.Clean(dest)
+	outputBase := dest + string(os.PathSeparator)
+
+	// symlinks are the links created so far, which are checked again once
+	// all entries were extracted, because links they point through may only
+	// have been created after them.
+	var symlinks []string
 
 	for _, f := range r.File {
 		fpath := filepath.Join(dest, f.Name)
@@ -246,6 +842,11 @@ func unzip(zipFile, dest string) error {
 		if !strings.HasPrefix(fpath, outputBase) {
 			return fmt.Errorf("%s: illegal file path", fpath)
 		}
+		// Links created by earlier entries could redirect the entry to
+		// outside of dest, so nothing is written through them.
+		if err := checkNoSymlinkInPath(dest, fpath); err != nil {
+			return err
+		}
 
 		if f.FileInfo().IsDir() {
 			if err := os.MkdirAll(fpath, os.ModePerm); err != nil {
@@ -258,7 +859,18 @@ func unzip(zipFile, dest string) error {
 			return err
 		}
 
-		outFile, err := os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode())
+		if f.Mode()&os.ModeSymlink != 0 {
+			if skipSymlinks {
+				continue
+			}
+			if err := unzipSymlink(f, fpath, dest); err != nil {
+				return err
+			}
+			symlinks = append(symlinks, fpath)
+			continue
+		}
+
+		outFile, err := os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode().Perm())
 		if err != nil {
 			return err
 		}
@@ -280,7 +892,112 @@ func unzip(zipFile, dest string) error {
 			return errors.Wrap(err, "closing output file failed")
 		}
 
+		// The mode passed to OpenFile is subject to the umask, which would
+		// e.g. drop the executable bit of scripts.
+		if err := os.Chmod(fpath, f.Mode().Perm()); err != nil {
+			return errors.Wrapf(err, "setting permissions of %q failed", f.Name)
+		}
+	}
+
+	for _, link := range symlinks {
+		target, err := os.Readlink(link)
+		if err != nil {
+			return err
+		}
+		if _, err := resolveSymlinkTarget(dest, filepath.Dir(link), target, 0); err != nil {
+			return errors.Wrapf(err, "%s: illegal symlink target %q", link, target)
+		}
 	}
 
 	return nil
 }
+
+// checkNoSymlinkInPath returns an error if fpath, or one of its parent
+// directories below dest, is an existing symbolic link.
+func checkNoSymlinkInPath(dest, fpath string) error {
+	rel, err := filepath.Rel(dest, fpath)
+	if err != nil {
+		return err
+	}
+	p := dest
+	for _, part := range strings.Split(rel, string(os.PathSeparator)) {
+		p = filepath.Join(p, part)
+		info, err := os.Lstat(p)
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("%s: illegal file path through symlink %s", fpath, p)
+		}
+	}
+	return nil
+}
+
+// maxSymlinkDepth is the number of links resolveSymlinkTarget follows before
+// it gives up, like the limit of the kernel.
+const maxSymlinkDepth = 40
+
+// resolveSymlinkTarget resolves the relative link target against dir one
+// path element at a time, following the links that exist in dest, and
+// returns an error if the path leaves dest at any point. Unlike a purely
+// lexical check, this catches targets such as "p/.." where p is itself a
+// link to ".".
+func resolveSymlinkTarget(dest, dir, target string, depth int) (string, error) {
+	if depth > maxSymlinkDepth {
+		return "", errors.New("too many levels of symbolic links")
+	}
+	if filepath.IsAbs(target) {
+		return "", errors.New("absolute symlink target")
+	}
+
+	cur := dir
+	for _, part := range strings.Split(filepath.ToSlash(target), "/") {
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			cur = filepath.Dir(cur)
+		default:
+			next := filepath.Join(cur, part)
+			info, err := os.Lstat(next)
+			if err == nil && info.Mode()&os.ModeSymlink != 0 {
+				link, err := os.Readlink(next)
+				if err != nil {
+					return "", err
+				}
+				if next, err = resolveSymlinkTarget(dest, cur, link, depth+1); err != nil {
+					return "", err
+				}
+			}
+			cur = next
+		}
+		if cur != dest && !strings.HasPrefix(cur, dest+string(os.PathSeparator)) {
+			return "", errors.New("symlink target is outside of the destination")
+		}
+	}
+	return cur, nil
+}
+
+// unzipSymlink creates the symbolic link stored in f at fpath. The target
+// must be relative and must resolve to a path inside of dest, following the
+// links that were already extracted.
+func unzipSymlink(f *zip.File, fpath, dest string) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	target, err := ioutil.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		return errors.Wrapf(err, "reading symlink %q failed", f.Name)
+	}
+
+	// Same check as for ZipSlip above, but for the resolved link target.
+	if _, err := resolveSymlinkTarget(dest, filepath.Dir(fpath), string(target), 0); err != nil {
+		return errors.Wrapf(err, "%s: illegal symlink target %q", fpath, target)
+	}
+
+	return os.Symlink(string(target), fpath)
+}
@@ -0,0 +1,553 @@
+package campaigns
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+type zipEntry struct {
+	name    string
+	mode    os.FileMode
+	content string
+}
+
+func writeTestZip(t *testing.T, entries []zipEntry) string {
+	t.Helper()
+
+	f, err := ioutil.TempFile("", "unzip-test-*.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Remove(f.Name()) })
+	defer f.Close()
+
+	w := zip.NewWriter(f)
+	for _, e := range entries {
+		h := &zip.FileHeader{Name: e.name, Method: zip.Deflate}
+		h.SetMode(e.mode)
+		fw, err := w.CreateHeader(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fw.Write([]byte(e.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return f.Name()
+}
+
+func TestUnzip(t *testing.T) {
+	tests := map[string]struct {
+		entries      []zipEntry
+		skipSymlinks bool
+
+		// want maps paths to their mode and, for symlinks, their target.
+		want    map[string]string
+		wantErr string
+	}{
+		"file modes": {
+			entries: []zipEntry{
+				{name: "README.md", mode: 0644, content: "# Hello"},
+				{name: "scripts/", mode: os.ModeDir | 0755},
+				{name: "scripts/build.sh", mode: 0755, content: "#!/bin/sh"},
+			},
+			want: map[string]string{
+				"README.md":        "-rw-r--r--",
+				"scripts":          "dir",
+				"scripts/build.sh": "-rwxr-xr-x",
+			},
+		},
+		"symlinks": {
+			entries: []zipEntry{
+				{name: "docs/index.md", mode: 0644, content: "# Docs"},
+				{name: "README.md", mode: os.ModeSymlink | 0777, content: "docs/index.md"},
+				{name: "docs/self", mode: os.ModeSymlink | 0777, content: "."},
+			},
+			want: map[string]string{
+				"docs":          "dir",
+				"docs/index.md": "-rw-r--r--",
+				"docs/self":     "Lrwxrwxrwx -> .",
+				"README.md":     "Lrwxrwxrwx -> docs/index.md",
+			},
+		},
+		"skipped symlinks": {
+			entries: []zipEntry{
+				{name: "docs/index.md", mode: 0644, content: "# Docs"},
+				{name: "README.md", mode: os.ModeSymlink | 0777, content: "docs/index.md"},
+			},
+			skipSymlinks: true,
+			want: map[string]string{
+				"docs":          "dir",
+				"docs/index.md": "-rw-r--r--",
+			},
+		},
+		"symlink outside of destination": {
+			entries: []zipEntry{
+				{name: "docs/passwd", mode: os.ModeSymlink | 0777, content: "../../etc/passwd"},
+			},
+			wantErr: "illegal symlink target",
+		},
+		"absolute symlink": {
+			entries: []zipEntry{
+				{name: "passwd", mode: os.ModeSymlink | 0777, content: "/etc/passwd"},
+			},
+			wantErr: "illegal symlink target",
+		},
+		"chained symlinks outside of destination": {
+			entries: []zipEntry{
+				{name: "p", mode: os.ModeSymlink | 0777, content: "."},
+				{name: "s", mode: os.ModeSymlink | 0777, content: "p/.."},
+				{name: "s/evil", mode: 0644, content: "evil"},
+			},
+			wantErr: "illegal symlink target",
+		},
+		"symlink retargeted by a later symlink": {
+			entries: []zipEntry{
+				{name: "s", mode: os.ModeSymlink | 0777, content: "p/.."},
+				{name: "p", mode: os.ModeSymlink | 0777, content: "."},
+			},
+			wantErr: "illegal symlink target",
+		},
+		"file written through symlink": {
+			entries: []zipEntry{
+				{name: "docs/index.md", mode: 0644, content: "# Docs"},
+				{name: "link", mode: os.ModeSymlink | 0777, content: "docs"},
+				{name: "link/evil", mode: 0644, content: "evil"},
+			},
+			wantErr: "illegal file path through symlink",
+		},
+		"file outside of destination": {
+			entries: []zipEntry{
+				{name: "../evil.sh", mode: 0755, content: "#!/bin/sh"},
+			},
+			wantErr: "illegal file path",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			dest, err := ioutil.TempDir("", "unzip-test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { os.RemoveAll(dest) })
+
+			err = unzip(writeTestZip(t, tc.entries), dest, tc.skipSymlinks)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("unexpected error: have %v; want %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			have := map[string]string{}
+			err = filepath.Walk(dest, func(path string, info os.FileInfo, err error) error {
+				if err != nil || path == dest {
+					return err
+				}
+				rel, _ := filepath.Rel(dest, path)
+				// Directories are created subject to the umask.
+				desc := info.Mode().String()
+				if info.IsDir() {
+					desc = "dir"
+				} else if info.Mode()&os.ModeSymlink != 0 {
+					target, err := os.Readlink(path)
+					if err != nil {
+						return err
+					}
+					desc += " -> " + target
+				}
+				have[filepath.ToSlash(rel)] = desc
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := cmp.Diff(tc.want, have); diff != "" {
+				t.Errorf("unexpected files (-want +have):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestWorkspaceWarnings(t *testing.T) {
+	tests := map[string]struct {
+		files              map[string]string
+		gitLFS, submodules bool
+		want               int
+	}{
+		"plain repository": {
+			files: map[string]string{".gitattributes": "*.go text eol=lf\n"},
+			want:  0,
+		},
+		"lfs": {
+			files: map[string]string{".gitattributes": "*.png filter=lfs diff=lfs merge=lfs -text\n"},
+			want:  1,
+		},
+		"lfs and submodules": {
+			files: map[string]string{
+				".gitattributes": "*.png filter=lfs diff=lfs merge=lfs -text\n",
+				".gitmodules":    "[submodule \"vendor/lib\"]\n",
+			},
+			want: 2,
+		},
+		"lfs and submodules in a clone with submodules": {
+			files: map[string]string{
+				".gitattributes": "*.png filter=lfs diff=lfs merge=lfs -text\n",
+				".gitmodules":    "[submodule \"vendor/lib\"]\n",
+			},
+			submodules: true,
+			want:       1,
+		},
+		"lfs in a clone with lfs": {
+			files:  map[string]string{".gitattributes": "*.png filter=lfs diff=lfs merge=lfs -text\n"},
+			gitLFS: true,
+			want:   0,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "workspace-warnings-test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { os.RemoveAll(dir) })
+
+			for name, content := range tc.files {
+				if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if have := workspaceWarnings(dir, tc.gitLFS, tc.submodules); len(have) != tc.want {
+				t.Errorf("unexpected warnings: have %q; want %d warnings", have, tc.want)
+			}
+		})
+	}
+}
+
+func TestCloneToTempDir(t *testing.T) {
+	// Submodules are cloned from local paths in this test, which Git only
+	// allows if asked to.
+	for k, v := range map[string]string{"GIT_CONFIG_COUNT": "1", "GIT_CONFIG_KEY_0": "protocol.file.allow", "GIT_CONFIG_VALUE_0": "always"} {
+		old, ok := os.LookupEnv(k)
+		os.Setenv(k, v)
+		if ok {
+			defer os.Setenv(k, old)
+		} else {
+			defer os.Unsetenv(k)
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "clone-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	git := func(dir string, args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s: %s: %s", strings.Join(args, " "), err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+
+	lib, repo := filepath.Join(dir, "lib"), filepath.Join(dir, "repo")
+	for _, d := range []string{lib, repo} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+		git(d, "init", "--quiet")
+	}
+	if err := ioutil.WriteFile(filepath.Join(lib, "lib.go"), []byte("package lib\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	git(lib, "add", "lib.go")
+	git(lib, "commit", "--quiet", "-m", "lib")
+	if err := ioutil.WriteFile(filepath.Join(repo, "README.md"), []byte("# v1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	git(repo, "add", "README.md")
+	git(repo, "submodule", "--quiet", "add", lib, "vendor/lib")
+	git(repo, "commit", "--quiet", "-m", "v1")
+	rev := git(repo, "rev-parse", "HEAD")
+	if err := ioutil.WriteFile(filepath.Join(repo, "README.md"), []byte("# v2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	git(repo, "commit", "--quiet", "--all", "-m", "v2")
+
+	for name, tc := range map[string]struct {
+		submodules bool
+		wantLib    bool
+	}{
+		"without submodules": {},
+		"with submodules":    {submodules: true, wantLib: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			volumeDir, err := cloneToTempDir(context.Background(), repo, rev, "clone-test", false, tc.submodules)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(volumeDir)
+
+			// The workspace contains the given revision, not the latest one.
+			if readme, err := ioutil.ReadFile(filepath.Join(volumeDir, "README.md")); err != nil || string(readme) != "# v1\n" {
+				t.Errorf("unexpected README.md %q (%v)", readme, err)
+			}
+			_, err = os.Stat(filepath.Join(volumeDir, "vendor", "lib", "lib.go"))
+			if haveLib := err == nil; haveLib != tc.wantLib {
+				t.Errorf("unexpected submodule contents: have %v; want %v", haveLib, tc.wantLib)
+			}
+		})
+	}
+
+	if _, err := cloneToTempDir(context.Background(), filepath.Join(dir, "missing"), rev, "clone-test", false, false); err == nil {
+		t.Error("no error cloning a missing repository")
+	}
+}
+
+func TestHardeningArgs(t *testing.T) {
+	tests := map[string]struct {
+		step *ActionStep
+		want []string
+	}{
+		"no options": {
+			step: &ActionStep{Type: "docker", Image: "alpine:3"},
+			want: nil,
+		},
+		"default network": {
+			step: &ActionStep{Type: "docker", Image: "alpine:3", Network: "default"},
+			want: nil,
+		},
+		"host network": {
+			step: &ActionStep{Type: "docker", Image: "alpine:3", Network: "host"},
+			want: []string{"--network", "host"},
+		},
+		"all options": {
+			step: &ActionStep{
+				Type:        "docker",
+				Image:       "alpine:3",
+				Network:     "none",
+				ReadOnly:    true,
+				CapDrop:     []string{"ALL"},
+				SecurityOpt: []string{"no-new-privileges"},
+				User:        "1000:1000",
+			},
+			want: []string{
+				"--network", "none",
+				"--read-only", "--tmpfs", "/tmp",
+				"--cap-drop", "ALL",
+				"--security-opt", "no-new-privileges",
+				"--user", "1000:1000",
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.want, hardeningArgs(tc.step)); diff != "" {
+				t.Errorf("unexpected args (-want +have):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestValidateSingleContainer(t *testing.T) {
+	tests := map[string]struct {
+		steps   []*ActionStep
+		wantErr string
+	}{
+		"same image": {
+			steps: []*ActionStep{
+				{Type: "docker", Image: "golang:1.14", ImageContentDigest: "sha256:go", Args: []string{"go", "get", "golang.org/x/tools/cmd/goimports"}},
+				{Type: "command", Args: []string{"ls"}},
+				{Type: "docker", Image: "golang:1.14", ImageContentDigest: "sha256:go", Args: []string{"goimports", "-w", "."}},
+			},
+		},
+		"different images": {
+			steps: []*ActionStep{
+				{Type: "docker", Image: "golang:1.14", ImageContentDigest: "sha256:go"},
+				{Type: "docker", Image: "alpine:3", ImageContentDigest: "sha256:alpine"},
+			},
+			wantErr: "step 2 uses the image",
+		},
+		"same tag of different images": {
+			steps: []*ActionStep{
+				{Type: "docker", Image: "golang:1.14", Platform: "linux/amd64", ImageContentDigest: "sha256:amd64"},
+				{Type: "docker", Image: "golang:1.14", Platform: "linux/amd64", ImageContentDigest: "sha256:arm64"},
+			},
+			wantErr: "step 2 uses the image",
+		},
+		"different built images": {
+			steps: []*ActionStep{
+				{Type: "docker", Build: "./a", Image: "sha256:a", ImageContentDigest: "sha256:a"},
+				{Type: "docker", Build: "./b", Image: "sha256:b", ImageContentDigest: "sha256:b"},
+			},
+			wantErr: `step 2 uses the image "sha256:b (built from ./b)"`,
+		},
+		"same built image": {
+			steps: []*ActionStep{
+				{Type: "docker", Build: "./a", Image: "sha256:a", ImageContentDigest: "sha256:a"},
+				{Type: "docker", Build: "./a", Image: "sha256:a", ImageContentDigest: "sha256:a"},
+			},
+		},
+		"not built yet": {
+			steps: []*ActionStep{
+				{Type: "docker", Build: "./a"},
+				{Type: "docker", Build: "./b"},
+			},
+			wantErr: "the image of step 1 has not been built or pulled yet",
+		},
+		"different options": {
+			steps: []*ActionStep{
+				{Type: "docker", Image: "golang:1.14", ImageContentDigest: "sha256:go", Network: "none"},
+				{Type: "docker", Image: "golang:1.14", ImageContentDigest: "sha256:go"},
+			},
+			wantErr: "step 2 has a different platform, cacheDirs or hardening options",
+		},
+		"different platforms": {
+			steps: []*ActionStep{
+				{Type: "docker", Image: "golang:1.14", ImageContentDigest: "sha256:go", Platform: "linux/amd64"},
+				{Type: "docker", Image: "golang:1.14", ImageContentDigest: "sha256:go"},
+			},
+			wantErr: "step 2 has a different platform",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := ValidateSingleContainer(Action{Steps: tc.steps})
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("unexpected error: have %v; want %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestTaskContainerCommand(t *testing.T) {
+	c := &taskContainer{id: "abc", entrypoint: []string{"comby"}, cmd: []string{"-h"}}
+
+	tests := map[string]struct {
+		step *ActionStep
+		env  []string
+		want []string
+	}{
+		"default command": {
+			step: &ActionStep{Type: "docker", Image: "comby/comby"},
+			want: []string{"docker", "exec", "--workdir", "/work", "--", "abc", "comby", "-h"},
+		},
+		"args": {
+			step: &ActionStep{Type: "docker", Image: "comby/comby", User: "1000", Args: []string{"-in-place", "a", "b"}},
+			want: []string{"docker", "exec", "--workdir", "/work", "--user", "1000", "--", "abc", "comby", "-in-place", "a", "b"},
+		},
+		"secrets": {
+			step: &ActionStep{Type: "docker", Image: "comby/comby", Args: []string{"sh", "-c", "echo ${TOKEN}"}},
+			env:  []string{"TOKEN"},
+			want: []string{"docker", "exec", "--workdir", "/work", "--env", "TOKEN", "--", "abc", "comby", "sh", "-c", "echo ${TOKEN}"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			cmd := c.command(context.Background(), tc.step, tc.env)
+			if diff := cmp.Diff(tc.want, cmd.Args); diff != "" {
+				t.Errorf("unexpected args (-want +have):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestFetchRepositoryArchive(t *testing.T) {
+	valid, err := ioutil.ReadFile(writeTestZip(t, []zipEntry{{name: "README.md", mode: 0644, content: "# README"}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checksum := sha256.Sum256(valid)
+	digest := "SHA-256=" + base64.StdEncoding.EncodeToString(checksum[:])
+
+	type response struct {
+		body   []byte
+		digest string
+	}
+	for _, tc := range []struct {
+		name      string
+		responses []response
+		wantErr   bool
+	}{
+		{name: "valid", responses: []response{{body: valid, digest: digest}}},
+		{name: "not a zip archive", responses: []response{{body: []byte("oops")}, {body: valid}}},
+		{name: "truncated", responses: []response{{body: valid[:len(valid)/2]}, {body: valid}}},
+		{name: "checksum mismatch", responses: []response{{body: valid, digest: "SHA-256=AAAA"}, {body: valid, digest: digest}}},
+		{name: "always corrupt", responses: []response{{body: []byte("oops")}, {body: []byte("oops")}, {body: []byte("oops")}}, wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			requests := 0
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if requests >= len(tc.responses) {
+					t.Errorf("unexpected request %d", requests+1)
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				resp := tc.responses[requests]
+				requests++
+				if resp.digest != "" {
+					w.Header().Set("Digest", resp.digest)
+				}
+				w.Write(resp.body)
+			}))
+			defer ts.Close()
+
+			f, err := fetchRepositoryArchive(context.Background(), ts.URL, "", nil, "github.com/a", "HEAD", nil, nil)
+			if tc.wantErr {
+				if err == nil {
+					os.Remove(f.Name())
+					t.Fatal("unexpected nil error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(f.Name())
+
+			if have, err := ioutil.ReadFile(f.Name()); err != nil {
+				t.Fatal(err)
+			} else if !bytes.Equal(have, valid) {
+				t.Error("unexpected archive contents")
+			}
+			if requests != len(tc.responses) {
+				t.Errorf("have %d requests, want %d", requests, len(tc.responses))
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package campaigns
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// taskContainer is a long-lived container in which all docker steps of an
+// action are executed in one repository, with `docker exec`. Tools the steps
+// install and other changes they make outside of the workspace persist
+// between steps, and containers only have to be started once.
+type taskContainer struct {
+	cidFile string
+	id      string
+
+	// entrypoint and cmd are those of the image. Like with `docker run`,
+	// the args of a step replace cmd.
+	entrypoint []string
+	cmd        []string
+}
+
+// taskContainerKeepAlive is the command that keeps a task container running
+// until it is removed. Images used with SingleContainer need to contain sh.
+var taskContainerKeepAlive = []string{"sh", "-c", "trap 'exit 0' TERM; while :; do sleep 1; done"}
+
+// startTaskContainer starts a container for the docker steps of an action in
+// one repository, with the image, platform, cache directories and hardening
+// options of step. All docker steps must share them, see
+// ValidateSingleContainer.
+func startTaskContainer(ctx context.Context, volumeDir, prefix, repoName, rev, pathsFile string, step *ActionStep) (*taskContainer, error) {
+	entrypoint, cmd, err := imageCommand(ctx, step.Image)
+	if err != nil {
+		return nil, err
+	}
+
+	cidFile, err := ioutil.TempFile(tempDirPrefix, prefix+"-container-id")
+	if err != nil {
+		return nil, errors.Wrap(err, "Creating a CID file failed")
+	}
+	_ = os.Remove(cidFile.Name()) // docker exits if this file exists upon `docker run` starting
+	c := &taskContainer{cidFile: cidFile.Name(), entrypoint: entrypoint, cmd: cmd}
+
+	containerArgs, err := dockerContainerArgs(volumeDir, repoName, rev, pathsFile, step)
+	if err != nil {
+		return nil, err
+	}
+	args := append([]string{"run", "--detach", "--rm", "--cidfile", c.cidFile}, containerArgs...)
+	args = append(args, "--entrypoint", taskContainerKeepAlive[0], "--", step.Image)
+	args = append(args, taskContainerKeepAlive[1:]...)
+
+	out, err := exec.CommandContext(ctx, "docker", args...).CombinedOutput()
+	if err != nil {
+		c.remove()
+		return nil, errors.Wrapf(err, "Starting Docker container for image %q failed: %s", step.Image, out)
+	}
+	c.id = strings.TrimSpace(string(out))
+	return c, nil
+}
+
+// command returns the command that executes step in the container. env are
+// the names of environment variables that are passed on to the container from
+// the environment of the command.
+func (c *taskContainer) command(ctx context.Context, step *ActionStep, env []string) *exec.Cmd {
+	cmd := c.cmd
+	if len(step.Args) > 0 {
+		cmd = step.Args
+	}
+	args := []string{"exec", "--workdir", dockerWorkDir}
+	if step.User != "" {
+		args = append(args, "--user", step.User)
+	}
+	for _, name := range env {
+		args = append(args, "--env", name)
+	}
+	args = append(args, "--", c.id)
+	args = append(args, c.entrypoint...)
+	args = append(args, cmd...)
+	return exec.CommandContext(ctx, "docker", args...)
+}
+
+// remove force-removes the container.
+func (c *taskContainer) remove() {
+	removeContainer(context.Background(), c.cidFile)
+}
+
+// imageCommand returns the entrypoint and default command of a local image.
+func imageCommand(ctx context.Context, image string) (entrypoint, cmd []string, err error) {
+	var stdout, stderr bytes.Buffer
+	inspect := exec.CommandContext(ctx, "docker", "image", "inspect", "--format", "{{json .Config}}", "--", image)
+	inspect.Stdout = &stdout
+	inspect.Stderr = &stderr
+	if err := inspect.Run(); err != nil {
+		return nil, nil, errors.Wrapf(err, "inspecting Docker image %q failed: %s", image, stderr.String())
+	}
+
+	var config struct {
+		Entrypoint []string
+		Cmd        []string
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &config); err != nil {
+		return nil, nil, errors.Wrapf(err, "parsing configuration of Docker image %q", image)
+	}
+	return config.Entrypoint, config.Cmd, nil
+}
+
+// ValidateSingleContainer returns an error if the docker steps of the action
+// can't be executed in a single container, because they differ in their
+// image, platform, cache directories or hardening options. It must be called
+// after PrepareAction, which builds the images of steps with a build context
+// and looks up the digests of the images, so that steps are compared by the
+// content of their images rather than by their names.
+func ValidateSingleContainer(action Action) error {
+	var first *ActionStep
+	for i, step := range action.Steps {
+		if step.Type != "docker" {
+			continue
+		}
+		if step.ImageContentDigest == "" {
+			return fmt.Errorf("the image of step %d has not been built or pulled yet", i+1)
+		}
+		if first == nil {
+			first = step
+			continue
+		}
+		if step.ImageContentDigest != first.ImageContentDigest {
+			return fmt.Errorf("step %d uses the image %q, but the first docker step uses %q: all docker steps must use the same image to be executed in a single container", i+1, stepImageName(step), stepImageName(first))
+		}
+		if !reflect.DeepEqual(containerOptions(step), containerOptions(first)) {
+			return fmt.Errorf("step %d has a different platform, cacheDirs or hardening options than the first docker step: all docker steps must have the same ones to be executed in a single container", i+1)
+		}
+	}
+	return nil
+}
+
+// stepImageName returns the name of the image of step for error messages,
+// which is its build context if it is built.
+func stepImageName(step *ActionStep) string {
+	if step.Build != "" {
+		return step.Image + " (built from " + step.Build + ")"
+	}
+	return step.Image
+}
+
+// containerOptions returns the options of step that apply to the container it
+// runs in.
+func containerOptions(step *ActionStep) ActionStep {
+	return ActionStep{
+		Platform:    step.Platform,
+		CacheDirs:   step.CacheDirs,
+		Network:     step.Network,
+		ReadOnly:    step.ReadOnly,
+		CapDrop:     step.CapDrop,
+		SecurityOpt: step.SecurityOpt,
+		User:        step.User,
+	}
+}
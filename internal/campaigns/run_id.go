@@ -0,0 +1,21 @@
+package campaigns
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+// RunIDHeader is the HTTP header that carries the run ID in the requests of an
+// execution, so that they can be found in the logs of the Sourcegraph
+// instance.
+const RunIDHeader = "X-Src-Run-ID"
+
+// NewRunID returns a new ID for an execution of an action. It starts with the
+// time in UTC, so that IDs sort in the order of the executions, followed by
+// random characters that make it unique, e.g. 20200612T154502-9f86d081.
+func NewRunID() string {
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	return time.Now().UTC().Format("20060102T150405") + "-" + hex.EncodeToString(b)
+}
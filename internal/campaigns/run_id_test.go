@@ -0,0 +1,21 @@
+package campaigns
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestNewRunID(t *testing.T) {
+	format := regexp.MustCompile(`^\d{8}T\d{6}-[0-9a-f]{8}$`)
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		id := NewRunID()
+		if !format.MatchString(id) {
+			t.Fatalf("run ID %q does not match %s", id, format)
+		}
+		if seen[id] {
+			t.Fatalf("duplicate run ID %q", id)
+		}
+		seen[id] = true
+	}
+}
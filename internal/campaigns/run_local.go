@@ -0,0 +1,133 @@
+package campaigns
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// localRev is used as the revision of local directories in logs and as part
+// of the cache directory keys of docker steps.
+const localRev = "local"
+
+// RunActionLocally runs the steps of action on a copy of the files in dir,
+// without fetching anything from a Sourcegraph instance, and returns the
+// resulting diff. dir itself is not modified. The .git directory is not
+// copied, so uncommitted changes in dir are part of the workspace, just like
+// the files of a repository archive. PrepareAction must have been called on
+// the action.
+func RunActionLocally(ctx context.Context, dir string, action Action, secrets Secrets, skipSymlinks, singleContainer bool, logger *ActionLogger) ([]byte, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	name := filepath.Base(dir)
+	const prefix = "action-local"
+
+	volumeDir, err := ioutil.TempDir(tempDirPrefix, prefix)
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(volumeDir)
+
+	if err := copyWorkspace(dir, volumeDir, skipSymlinks); err != nil {
+		return nil, errors.Wrapf(err, "copying %s failed", dir)
+	}
+
+	if _, err := logger.AddRepo(ActionRepo{Name: name, Rev: localRev}); err != nil {
+		return nil, errors.Wrap(err, "creating the log file failed")
+	}
+	logger.RepoStarted(name, localRev, action.Steps)
+	diffFile, err := runSteps(ctx, volumeDir, runOpts{
+		prefix:          prefix,
+		repoName:        name,
+		rev:             localRev,
+		steps:           action.Steps,
+		singleContainer: singleContainer,
+		secrets:         secrets,
+		logger:          logger,
+	})
+	var diff []byte
+	if diffFile != "" {
+		defer os.Remove(diffFile)
+		if diff, err = ioutil.ReadFile(diffFile); err != nil {
+			err = errors.Wrap(err, "Reading the diff file failed")
+		}
+	}
+	if ferr := logger.RepoFinished(name, len(diff) > 0, err); ferr != nil && err == nil {
+		err = ferr
+	}
+	return diff, err
+}
+
+// copyWorkspace copies the files in src, except for the .git directory, to
+// dest, preserving the permission bits of files. Symbolic links are copied
+// as they are, unless skipSymlinks is set, in which case they are left out.
+func copyWorkspace(src, dest string, skipSymlinks bool) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		if rel == ".git" {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			// .git is a file in worktrees and submodules.
+			return nil
+		}
+		target := filepath.Join(dest, rel)
+
+		switch {
+		case info.IsDir():
+			return os.MkdirAll(target, os.ModePerm)
+
+		case info.Mode()&os.ModeSymlink != 0:
+			if skipSymlinks {
+				return nil
+			}
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+
+		case info.Mode().IsRegular():
+			return copyFile(path, target, info.Mode().Perm())
+		}
+		// Sockets, devices and the like can't be part of a repository.
+		return nil
+	})
+}
+
+func copyFile(src, dest string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	// Like in unzip, the mode passed to OpenFile is subject to the umask.
+	return os.Chmod(dest, perm)
+}
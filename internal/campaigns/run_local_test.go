@@ -0,0 +1,73 @@
+package campaigns
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// setGitIdentity sets the identity git uses to commit the workspace before
+// the steps are run for the duration of the test.
+func setGitIdentity(t *testing.T) {
+	for k, v := range map[string]string{
+		"GIT_AUTHOR_NAME":     "src",
+		"GIT_AUTHOR_EMAIL":    "src@example.com",
+		"GIT_COMMITTER_NAME":  "src",
+		"GIT_COMMITTER_EMAIL": "src@example.com",
+	} {
+		old, ok := os.LookupEnv(k)
+		os.Setenv(k, v)
+		k := k
+		t.Cleanup(func() {
+			if ok {
+				os.Setenv(k, old)
+			} else {
+				os.Unsetenv(k)
+			}
+		})
+	}
+}
+
+func TestRunActionLocally(t *testing.T) {
+	setGitIdentity(t)
+
+	dir, err := ioutil.TempDir("", "run-local-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	files := map[string]string{
+		"README.md":       "# Hello\n",
+		".git/src-marker": "not copied\n",
+		"src/main.go":     "package main\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	action := Action{Steps: []*ActionStep{{
+		Type: "command",
+		Args: []string{"sh", "-c", "test ! -e .git/src-marker && echo '# Hello, world' > README.md"},
+	}}}
+	diff, err := RunActionLocally(context.Background(), dir, action, nil, false, false, NewActionLogger(false, false, true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(diff), "--- README.md\n+++ README.md\n") || !strings.Contains(string(diff), "+# Hello, world\n") {
+		t.Errorf("unexpected diff:\n%s", diff)
+	}
+	if content, err := ioutil.ReadFile(filepath.Join(dir, "README.md")); err != nil || string(content) != files["README.md"] {
+		t.Errorf("directory was modified: README.md contains %q (err: %v)", content, err)
+	}
+}
@@ -0,0 +1,51 @@
+package campaigns
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// searchResultPathsEnv is the environment variable that contains the path of
+// the file that lists the files matched by the scopeQuery in the repository,
+// one per line, relative to the root of the repository. It is only set if
+// the scopeQuery matched files.
+const searchResultPathsEnv = "SRC_SEARCH_RESULT_PATHS_FILE"
+
+// searchResultPathsContainerFile is where the file is mounted in the
+// containers of docker steps.
+const searchResultPathsContainerFile = "/src/search-result-paths"
+
+// SearchResultPathList returns the paths of the files in the repository
+// matched by the scopeQuery.
+func (r ActionRepo) SearchResultPathList() []string {
+	if r.SearchResultPaths == "" {
+		return nil
+	}
+	return strings.Split(r.SearchResultPaths, "\n")
+}
+
+// writeSearchResultPaths writes the paths to a temporary file outside of the
+// workspace, so that it doesn't end up in the diff, and returns its path. The
+// file is readable by everyone, since it's mounted read-only into containers
+// whose steps may not run as the owner of the file.
+func writeSearchResultPaths(prefix string, paths []string) (string, error) {
+	f, err := ioutil.TempFile(tempDirPrefix, prefix+"-search-result-paths")
+	if err != nil {
+		return "", errors.Wrap(err, "Creating the search result paths file failed")
+	}
+	_, err = f.WriteString(strings.Join(paths, "\n") + "\n")
+	if err == nil {
+		err = f.Chmod(0644)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", errors.Wrap(err, "Writing the search result paths file failed")
+	}
+	return f.Name(), nil
+}
@@ -0,0 +1,35 @@
+package campaigns
+
+import (
+	"io/ioutil"
+	"os"
+	"runtime"
+	"testing"
+)
+
+func TestWriteSearchResultPaths(t *testing.T) {
+	path, err := writeSearchResultPaths("test", []string{"README.md", "cmd/main.go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(path)
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "README.md\ncmd/main.go\n"; string(data) != want {
+		t.Errorf("unexpected content %q, want %q", data, want)
+	}
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0644 {
+		t.Errorf("unexpected permissions %v, want %v", perm, os.FileMode(0644))
+	}
+}
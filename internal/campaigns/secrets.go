@@ -0,0 +1,190 @@
+package campaigns
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+)
+
+var secretPlaceholderRegexp = regexp.MustCompile(`\$\{\{\s*secrets\.(\w+)\s*\}\}`)
+
+// Secrets maps the names of secrets to their values. Steps refer to them with
+// ${{ secrets.NAME }} in their arguments. Unlike matrix placeholders, secrets
+// are only resolved right before a step is run, so that their values are
+// neither part of the cache key nor of logs and audit records. Their values
+// are passed to steps as environment variables, never on the command line.
+type Secrets map[string]string
+
+// ReadSecretsFile reads secrets from a YAML or JSON file containing an object
+// that maps the names of secrets to their values.
+func ReadSecretsFile(path string) (Secrets, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err = yaml.YAMLToJSONStrict(data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to parse secrets file %s", path)
+	}
+	var secrets Secrets
+	if err := json.Unmarshal(data, &secrets); err != nil {
+		return nil, errors.Wrapf(err, "invalid secrets file %s: expected an object with string values", path)
+	}
+	return secrets, nil
+}
+
+// SecretNames returns the sorted names of the secrets the steps of the action
+// refer to.
+func (a Action) SecretNames() []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, step := range a.Steps {
+		for _, arg := range step.Args {
+			for _, m := range secretPlaceholderRegexp.FindAllStringSubmatch(arg, -1) {
+				if !seen[m[1]] {
+					seen[m[1]] = true
+					names = append(names, m[1])
+				}
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CheckSecrets returns an error listing the secrets the action refers to that
+// are missing in secrets.
+func CheckSecrets(action Action, secrets Secrets) error {
+	var missing []string
+	for _, name := range action.SecretNames() {
+		if _, ok := secrets[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return fmt.Errorf("the action refers to secrets that are not defined: %s", strings.Join(missing, ", "))
+}
+
+// resolve returns a copy of step in which the secret placeholders in its
+// arguments are replaced with references to environment variables named like
+// the secrets, e.g. ${NPM_TOKEN}, and the names of the secrets the step
+// refers to. The step must be run with the environment returned by env for
+// these names, and the references must be expanded by a shell, e.g. sh -c.
+// This keeps the values out of command lines, which other users of the
+// machine can read, e.g. with ps.
+func (s Secrets) resolve(step *ActionStep) (*ActionStep, []string) {
+	if len(s) == 0 {
+		return step, nil
+	}
+	seen := map[string]bool{}
+	var names []string
+	resolved := *step
+	resolved.Args = make([]string, len(step.Args))
+	for i, arg := range step.Args {
+		resolved.Args[i] = secretPlaceholderRegexp.ReplaceAllStringFunc(arg, func(m string) string {
+			name := secretPlaceholderRegexp.FindStringSubmatch(m)[1]
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+			return "${" + name + "}"
+		})
+	}
+	sort.Strings(names)
+	return &resolved, names
+}
+
+// env returns the environment variables, NAME=value, of the named secrets.
+func (s Secrets) env(names []string) []string {
+	env := make([]string, len(names))
+	for i, name := range names {
+		env[i] = name + "=" + s[name]
+	}
+	return env
+}
+
+// redact returns a copy of args in which the values of all secrets are
+// replaced with "***".
+func (s Secrets) redact(args []string) []string {
+	r := s.replacer()
+	if r == nil {
+		return args
+	}
+	redacted := make([]string, len(args))
+	for i, arg := range args {
+		redacted[i] = r.Replace(arg)
+	}
+	return redacted
+}
+
+// replacer returns a replacer of the values of all secrets with "***", or nil
+// if there are no secrets.
+func (s Secrets) replacer() *strings.Replacer {
+	values := make([]string, 0, len(s))
+	for _, v := range s {
+		if v != "" {
+			values = append(values, v)
+		}
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	// Longer values first, in case one secret contains another.
+	sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+	oldnew := make([]string, 0, 2*len(values))
+	for _, v := range values {
+		oldnew = append(oldnew, v, "***")
+	}
+	return strings.NewReplacer(oldnew...)
+}
+
+// redactWriter returns a writer that writes to w with the values of all
+// secrets replaced with "***". Output is redacted line by line, so that values
+// split across writes are redacted too.
+func (s Secrets) redactWriter(w io.WriteCloser) io.WriteCloser {
+	r := s.replacer()
+	if r == nil {
+		return w
+	}
+	return &redactingWriter{w: w, r: r}
+}
+
+type redactingWriter struct {
+	w   io.WriteCloser
+	r   *strings.Replacer
+	buf []byte
+}
+
+func (w *redactingWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	if i := bytes.LastIndexByte(w.buf, '\n'); i >= 0 {
+		if _, err := io.WriteString(w.w, w.r.Replace(string(w.buf[:i+1]))); err != nil {
+			return 0, err
+		}
+		w.buf = append(w.buf[:0], w.buf[i+1:]...)
+	}
+	return len(p), nil
+}
+
+// Close writes the final partial line and closes the underlying writer.
+func (w *redactingWriter) Close() error {
+	var err error
+	if len(w.buf) > 0 {
+		_, err = io.WriteString(w.w, w.r.Replace(string(w.buf)))
+		w.buf = nil
+	}
+	if cerr := w.w.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
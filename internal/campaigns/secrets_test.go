@@ -0,0 +1,69 @@
+package campaigns
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSecrets(t *testing.T) {
+	action := Action{Steps: []*ActionStep{
+		{Type: "docker", Image: "node:14", Args: []string{"sh", "-c", "npm config set //registry.npmjs.org/:_authToken=${{ secrets.NPM_TOKEN }}"}},
+		{Type: "command", Args: []string{"sh", "-c", "curl -u ${{secrets.USER}}:${{ secrets.PASSWORD }} https://example.com"}},
+	}}
+
+	if diff := cmp.Diff([]string{"NPM_TOKEN", "PASSWORD", "USER"}, action.SecretNames()); diff != "" {
+		t.Errorf("unexpected secret names (-want +have):\n%s", diff)
+	}
+
+	err := CheckSecrets(action, Secrets{"NPM_TOKEN": "abc"})
+	if err == nil || !strings.HasSuffix(err.Error(), ": PASSWORD, USER") {
+		t.Errorf("unexpected error for missing secrets: %v", err)
+	}
+
+	secrets := Secrets{"NPM_TOKEN": "abc", "USER": "alice", "PASSWORD": "s3cr3t"}
+	if err := CheckSecrets(action, secrets); err != nil {
+		t.Fatal(err)
+	}
+
+	resolved, names := secrets.resolve(action.Steps[1])
+	want := []string{"sh", "-c", "curl -u ${USER}:${PASSWORD} https://example.com"}
+	if diff := cmp.Diff(want, resolved.Args); diff != "" {
+		t.Errorf("unexpected resolved args (-want +have):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"PASSWORD=s3cr3t", "USER=alice"}, secrets.env(names)); diff != "" {
+		t.Errorf("unexpected environment (-want +have):\n%s", diff)
+	}
+	if action.Steps[1].Args[2] != "curl -u ${{secrets.USER}}:${{ secrets.PASSWORD }} https://example.com" {
+		t.Errorf("resolving modified the step: %q", action.Steps[1].Args)
+	}
+
+	redacted := secrets.redact([]string{"curl", "-u", "alice:s3cr3t"})
+	if diff := cmp.Diff([]string{"curl", "-u", "***:***"}, redacted); diff != "" {
+		t.Errorf("unexpected redacted args (-want +have):\n%s", diff)
+	}
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+func TestSecretsRedactWriter(t *testing.T) {
+	secrets := Secrets{"TOKEN": "s3cr3t"}
+	var buf bytes.Buffer
+	w := secrets.redactWriter(nopWriteCloser{&buf})
+	for _, p := range []string{"token: s3c", "r3t\nagain s3cr3t", " and s3cr"} {
+		if _, err := io.WriteString(w, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if want := "token: ***\nagain *** and s3cr"; buf.String() != want {
+		t.Errorf("unexpected output: have %q; want %q", buf.String(), want)
+	}
+}
@@ -0,0 +1,62 @@
+package campaigns
+
+import (
+	"sort"
+	"time"
+)
+
+// maxSlowestRepos is the number of the slowest repositories in ExecutionStats.
+const maxSlowestRepos = 5
+
+// ExecutionStats describes how effective the cache was in an execution, to
+// guide decisions about parallelism and caching.
+type ExecutionStats struct {
+	// CacheHits is the number of repositories whose result was cached and
+	// Executions the number of those in which the steps were executed.
+	CacheHits  int
+	Executions int
+
+	// TimeSaved is the estimated time saved by cache hits: the total
+	// duration of the executions that produced the cached results.
+	// UnknownSaved is the number of cache hits for which the duration is
+	// unknown, because they were cached by an earlier version.
+	TimeSaved    time.Duration
+	UnknownSaved int
+
+	// Slowest are the repositories in which the execution took the longest,
+	// slowest first.
+	Slowest []RepoDuration
+}
+
+// RepoDuration is the duration of the execution in a repository.
+type RepoDuration struct {
+	Repo     string
+	Duration time.Duration
+}
+
+// Add returns the combined statistics of s and o, e.g. of the executors for
+// each matrix entry.
+func (s ExecutionStats) Add(o ExecutionStats) ExecutionStats {
+	return ExecutionStats{
+		CacheHits:    s.CacheHits + o.CacheHits,
+		Executions:   s.Executions + o.Executions,
+		TimeSaved:    s.TimeSaved + o.TimeSaved,
+		UnknownSaved: s.UnknownSaved + o.UnknownSaved,
+		Slowest:      slowestRepos(append(append([]RepoDuration{}, s.Slowest...), o.Slowest...)),
+	}
+}
+
+// slowestRepos returns the maxSlowestRepos slowest of the given durations,
+// slowest first.
+func slowestRepos(durations []RepoDuration) []RepoDuration {
+	sort.SliceStable(durations, func(i, j int) bool {
+		if durations[i].Duration != durations[j].Duration {
+			return durations[i].Duration > durations[j].Duration
+		}
+		return durations[i].Repo < durations[j].Repo
+	})
+	if len(durations) > maxSlowestRepos {
+		durations = durations[:maxSlowestRepos]
+	}
+	return durations
+}
@@ -0,0 +1,66 @@
+package campaigns
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestExecutorStats(t *testing.T) {
+	start := time.Now()
+	repos := map[ActionRepo]ActionRepoStatus{
+		{Name: "cached-timed"}:  {Cached: true, CachedDuration: time.Minute},
+		{Name: "cached-legacy"}: {Cached: true},
+		{Name: "running"}:       {StartedAt: start},
+		{Name: "failed"}:        {StartedAt: start, FinishedAt: start.Add(7 * time.Second), Err: &errStepStalled{step: 0, timeout: time.Minute}},
+		{Name: "a"}:             {StartedAt: start, FinishedAt: start.Add(1 * time.Second)},
+		{Name: "b"}:             {StartedAt: start, FinishedAt: start.Add(2 * time.Second)},
+		{Name: "c"}:             {StartedAt: start, FinishedAt: start.Add(3 * time.Second)},
+		{Name: "d"}:             {StartedAt: start, FinishedAt: start.Add(4 * time.Second)},
+		{Name: "e"}:             {StartedAt: start, FinishedAt: start.Add(4 * time.Second)},
+	}
+	x := &Executor{repos: repos}
+
+	want := ExecutionStats{
+		CacheHits:    2,
+		Executions:   6,
+		TimeSaved:    time.Minute,
+		UnknownSaved: 1,
+		Slowest: []RepoDuration{
+			{Repo: "failed", Duration: 7 * time.Second},
+			{Repo: "d", Duration: 4 * time.Second},
+			{Repo: "e", Duration: 4 * time.Second},
+			{Repo: "c", Duration: 3 * time.Second},
+			{Repo: "b", Duration: 2 * time.Second},
+		},
+	}
+	have := x.Stats()
+	if diff := cmp.Diff(want, have); diff != "" {
+		t.Errorf("unexpected stats (-want +have):\n%s", diff)
+	}
+
+	// Combining the stats of several executors keeps the slowest overall.
+	other := ExecutionStats{
+		CacheHits:  1,
+		Executions: 1,
+		TimeSaved:  time.Second,
+		Slowest:    []RepoDuration{{Repo: "slowest", Duration: time.Hour}},
+	}
+	want = ExecutionStats{
+		CacheHits:    3,
+		Executions:   7,
+		TimeSaved:    time.Minute + time.Second,
+		UnknownSaved: 1,
+		Slowest: []RepoDuration{
+			{Repo: "slowest", Duration: time.Hour},
+			{Repo: "failed", Duration: 7 * time.Second},
+			{Repo: "d", Duration: 4 * time.Second},
+			{Repo: "e", Duration: 4 * time.Second},
+			{Repo: "c", Duration: 3 * time.Second},
+		},
+	}
+	if diff := cmp.Diff(want, have.Add(other)); diff != "" {
+		t.Errorf("unexpected combined stats (-want +have):\n%s", diff)
+	}
+}
@@ -0,0 +1,79 @@
+package campaigns
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// stepTimings records which step of an execution in a repository is running
+// and how long the completed steps took, so that a timeout can be explained.
+// A nil *stepTimings records nothing.
+type stepTimings struct {
+	steps []*ActionStep
+	// current is the index of the running step, or -1.
+	current int
+	started time.Time
+	// completed are the durations of the completed steps, in order.
+	completed []time.Duration
+	now       func() time.Time
+}
+
+func newStepTimings(steps []*ActionStep) *stepTimings {
+	return &stepTimings{steps: steps, current: -1, now: time.Now}
+}
+
+// reset forgets the recorded steps, e.g. when the execution is restarted.
+func (t *stepTimings) reset() {
+	if t != nil {
+		t.current, t.completed = -1, nil
+	}
+}
+
+func (t *stepTimings) stepStarted(i int) {
+	if t != nil {
+		t.current, t.started = i, t.now()
+	}
+}
+
+func (t *stepTimings) stepDone() {
+	if t != nil && t.current >= 0 {
+		t.completed = append(t.completed, t.now().Sub(t.started))
+		t.current = -1
+	}
+}
+
+// describe returns where the execution is, e.g. "step 2 (docker alpine:3)
+// was running for 45s", followed by the durations of the completed steps.
+func (t *stepTimings) describe() string {
+	var where string
+	switch {
+	case t.current >= 0:
+		where = fmt.Sprintf("step %d (%s) was running for %s", t.current+1, describeStep(t.steps[t.current]), t.now().Sub(t.started).Round(time.Millisecond))
+	case len(t.completed) == 0:
+		where = "no step had started yet"
+	default:
+		where = fmt.Sprintf("all %d steps had completed", len(t.completed))
+	}
+	if len(t.completed) == 0 {
+		return where + "."
+	}
+	durations := make([]string, len(t.completed))
+	for i, d := range t.completed {
+		durations[i] = fmt.Sprintf("step %d took %s", i+1, d.Round(time.Millisecond))
+	}
+	return fmt.Sprintf("%s; %s.", where, strings.Join(durations, ", "))
+}
+
+// describeStep returns the type of the step with its image or command.
+func describeStep(step *ActionStep) string {
+	switch {
+	case step.Type == "docker" && step.Build != "":
+		return "docker built from " + step.Build
+	case step.Type == "docker" && step.Image != "":
+		return "docker " + step.Image
+	case step.Type == "command" && len(step.Args) > 0:
+		return "command " + step.Args[0]
+	}
+	return step.Type
+}
@@ -0,0 +1,71 @@
+package campaigns
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStepTimingsDescribe(t *testing.T) {
+	steps := []*ActionStep{
+		{Type: "command", Args: []string{"go", "mod", "tidy"}},
+		{Type: "docker", Image: "alpine:3"},
+	}
+
+	tests := map[string]struct {
+		record func(t *stepTimings, advance func(time.Duration))
+		want   string
+	}{
+		"not started": {
+			record: func(t *stepTimings, advance func(time.Duration)) {},
+			want:   "no step had started yet.",
+		},
+		"first step running": {
+			record: func(t *stepTimings, advance func(time.Duration)) {
+				t.stepStarted(0)
+				advance(90 * time.Second)
+			},
+			want: "step 1 (command go) was running for 1m30s.",
+		},
+		"second step running": {
+			record: func(t *stepTimings, advance func(time.Duration)) {
+				t.stepStarted(0)
+				advance(5 * time.Second)
+				t.stepDone()
+				t.stepStarted(1)
+				advance(45 * time.Second)
+			},
+			want: "step 2 (docker alpine:3) was running for 45s; step 1 took 5s.",
+		},
+		"all done": {
+			record: func(t *stepTimings, advance func(time.Duration)) {
+				for i := range steps {
+					t.stepStarted(i)
+					advance(time.Second)
+					t.stepDone()
+				}
+			},
+			want: "all 2 steps had completed; step 1 took 1s, step 2 took 1s.",
+		},
+		"reset": {
+			record: func(t *stepTimings, advance func(time.Duration)) {
+				t.stepStarted(0)
+				advance(time.Second)
+				t.stepDone()
+				t.reset()
+			},
+			want: "no step had started yet.",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			now := time.Date(2020, 7, 1, 0, 0, 0, 0, time.UTC)
+			timings := newStepTimings(steps)
+			timings.now = func() time.Time { return now }
+			tc.record(timings, func(d time.Duration) { now = now.Add(d) })
+			if have := timings.describe(); have != tc.want {
+				t.Errorf("unexpected description:\nhave %q\nwant %q", have, tc.want)
+			}
+		})
+	}
+}
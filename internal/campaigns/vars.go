@@ -0,0 +1,128 @@
+package campaigns
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+)
+
+var varPlaceholderRegexp = regexp.MustCompile(`\$\{\{\s*vars\.([\w.-]+)\s*\}\}`)
+
+// Vars maps the names of variables to their values. Action definitions refer
+// to them with ${{ vars.NAME }} in any string, e.g. to use the same
+// definition with another scopeQuery per team. Unlike secrets, variables are
+// replaced when the definition is parsed.
+type Vars map[string]string
+
+// ReadVarsFile reads variables from a YAML or JSON file containing an object.
+// The values of nested objects are named by joining the keys with dots, e.g.
+// "team.name" for {"team": {"name": "x"}}. Numbers and booleans are
+// converted to strings.
+func ReadVarsFile(path string) (Vars, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err = yaml.YAMLToJSONStrict(data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to parse variables file %s", path)
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, errors.Wrapf(err, "invalid variables file %s: expected an object", path)
+	}
+	vars := Vars{}
+	if err := vars.add("", doc); err != nil {
+		return nil, errors.Wrapf(err, "invalid variables file %s", path)
+	}
+	return vars, nil
+}
+
+func (v Vars) add(prefix string, doc map[string]interface{}) error {
+	for k, value := range doc {
+		name := prefix + k
+		switch value := value.(type) {
+		case map[string]interface{}:
+			if err := v.add(name+".", value); err != nil {
+				return err
+			}
+		case string:
+			v[name] = value
+		case float64, bool:
+			v[name] = fmt.Sprint(value)
+		default:
+			return fmt.Errorf("the value of %q must be a string, number, boolean or object", name)
+		}
+	}
+	return nil
+}
+
+// Set sets the variable given as "NAME=VALUE", like the -var flag of 'src
+// actions' commands.
+func (v Vars) Set(nameValue string) error {
+	i := strings.Index(nameValue, "=")
+	if i <= 0 {
+		return fmt.Errorf("invalid variable %q, expected NAME=VALUE", nameValue)
+	}
+	v[nameValue[:i]] = nameValue[i+1:]
+	return nil
+}
+
+// ExpandVars replaces the ${{ vars.NAME }} placeholders in the strings of the
+// JSON action definition def with the values in vars. It returns an error
+// listing the variables the definition refers to that are not defined.
+func ExpandVars(def []byte, vars Vars) ([]byte, error) {
+	if !varPlaceholderRegexp.Match(def) {
+		return def, nil
+	}
+	normalized, err := jsonxToJSON(string(def))
+	if err != nil {
+		return nil, err
+	}
+	var doc interface{}
+	if err := json.Unmarshal(normalized, &doc); err != nil {
+		return nil, errors.Wrap(err, "invalid JSON action file")
+	}
+
+	missing := map[string]bool{}
+	var expand func(v interface{}) interface{}
+	expand = func(v interface{}) interface{} {
+		switch v := v.(type) {
+		case string:
+			return varPlaceholderRegexp.ReplaceAllStringFunc(v, func(m string) string {
+				name := varPlaceholderRegexp.FindStringSubmatch(m)[1]
+				value, ok := vars[name]
+				if !ok {
+					missing[name] = true
+				}
+				return value
+			})
+		case []interface{}:
+			for i := range v {
+				v[i] = expand(v[i])
+			}
+		case map[string]interface{}:
+			for k := range v {
+				v[k] = expand(v[k])
+			}
+		}
+		return v
+	}
+	doc = expand(doc)
+
+	if len(missing) > 0 {
+		names := make([]string, 0, len(missing))
+		for name := range missing {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("the action refers to variables that are not defined: %s", strings.Join(names, ", "))
+	}
+	return json.Marshal(doc)
+}
@@ -0,0 +1,81 @@
+package campaigns
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestReadVarsFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vars")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "values.yml")
+	data := "org: my-org\nretries: 3\ndryRun: false\nteam:\n  name: frontend\n  lead: alice\n"
+	if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	vars, err := ReadVarsFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Vars{"org": "my-org", "retries": "3", "dryRun": "false", "team.name": "frontend", "team.lead": "alice"}
+	if diff := cmp.Diff(want, vars); diff != "" {
+		t.Errorf("unexpected variables (-want +have):\n%s", diff)
+	}
+
+	if err := vars.Set("org=other=org"); err != nil {
+		t.Fatal(err)
+	}
+	if vars["org"] != "other=org" {
+		t.Errorf("unexpected value after Set: %q", vars["org"])
+	}
+	if err := vars.Set("=x"); err == nil {
+		t.Error("expected an error for a variable without a name")
+	}
+}
+
+func TestExpandVars(t *testing.T) {
+	def := `{
+  "scopeQuery": "repo:^github.com/${{ vars.org }}/ lang:go",
+  "steps": [{"type": "docker", "image": "golang:${{vars.go.version}}", "args": ["sh", "-c", "echo ${{ matrix.x }} ${{ secrets.TOKEN }}"]}]
+}`
+	expanded, err := ExpandVars([]byte(def), Vars{"org": "my-org", "go.version": "1.14"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var have map[string]interface{}
+	if err := json.Unmarshal(expanded, &have); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"scopeQuery": "repo:^github.com/my-org/ lang:go",
+		"steps": []interface{}{map[string]interface{}{
+			"type":  "docker",
+			"image": "golang:1.14",
+			"args":  []interface{}{"sh", "-c", "echo ${{ matrix.x }} ${{ secrets.TOKEN }}"},
+		}},
+	}
+	if diff := cmp.Diff(want, have); diff != "" {
+		t.Errorf("unexpected definition (-want +have):\n%s", diff)
+	}
+
+	_, err = ExpandVars([]byte(def), Vars{"org": "my-org"})
+	if err == nil || !strings.HasSuffix(err.Error(), ": go.version") {
+		t.Errorf("unexpected error for missing variables: %v", err)
+	}
+
+	unchanged := `{"scopeQuery": "repo:a"}`
+	if have, err := ExpandVars([]byte(unchanged), nil); err != nil || string(have) != unchanged {
+		t.Errorf("definition without variables was changed: %s, %v", have, err)
+	}
+}
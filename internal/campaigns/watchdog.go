@@ -0,0 +1,136 @@
+package campaigns
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// The modes for handling steps that stall, i.e. produce no output for longer
+// than ExecutorOpts.StallTimeout.
+const (
+	// OnStallWarn logs a warning for every StallTimeout that passes without
+	// output.
+	OnStallWarn = "warn"
+	// OnStallKill kills the step, which fails the execution in the
+	// repository.
+	OnStallKill = "kill"
+	// OnStallRestart kills the step and executes all steps in the repository
+	// again, once.
+	OnStallRestart = "restart"
+)
+
+// stepWatchdog detects steps that produce no output on stdout or stderr for
+// longer than timeout. Those are likely to hang, in which case they would
+// otherwise occupy an execution slot until the timeout of the execution.
+type stepWatchdog struct {
+	timeout time.Duration
+	kill    bool
+}
+
+// newStepWatchdog returns the watchdog for the given options, or nil if
+// stalled steps aren't detected.
+func newStepWatchdog(timeout time.Duration, onStall string) *stepWatchdog {
+	if timeout <= 0 {
+		return nil
+	}
+	return &stepWatchdog{timeout: timeout, kill: onStall == OnStallKill || onStall == OnStallRestart}
+}
+
+type errStepStalled struct {
+	step    int
+	timeout time.Duration
+}
+
+func (e *errStepStalled) Error() string {
+	return fmt.Sprintf("Step %d produced no output for %s and was killed.", e.step, e.timeout)
+}
+
+// run starts cmd and waits for it to finish. Each time it produces no output
+// for w.timeout, stalled is called with the duration since the last output.
+// If w.kill is set, kill is called after the first time instead and an
+// errStepStalled is returned. If w is nil, cmd is simply run.
+func (w *stepWatchdog) run(cmd *exec.Cmd, step int, stalled func(since time.Duration), kill func()) error {
+	if w == nil {
+		return cmd.Run()
+	}
+
+	hb := &heartbeat{last: time.Now()}
+	cmd.Stdout = hb.writer(cmd.Stdout)
+	cmd.Stderr = hb.writer(cmd.Stderr)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	killed := make(chan bool, 1)
+	go func() {
+		warned := time.Time{}
+		for {
+			next := hb.lastBeat()
+			if warned.After(next) {
+				next = warned
+			}
+			select {
+			case <-done:
+				killed <- false
+				return
+			case <-time.After(time.Until(next.Add(w.timeout))):
+			}
+
+			since := time.Since(hb.lastBeat())
+			if since < w.timeout || time.Since(warned) < w.timeout {
+				continue
+			}
+			stalled(since)
+			if w.kill {
+				kill()
+				killed <- true
+				return
+			}
+			warned = time.Now()
+		}
+	}()
+
+	err := cmd.Wait()
+	close(done)
+	if <-killed {
+		return &errStepStalled{step: step, timeout: w.timeout}
+	}
+	return err
+}
+
+// heartbeat records when output was last written through one of its
+// writers.
+type heartbeat struct {
+	mu   sync.Mutex
+	last time.Time
+}
+
+func (h *heartbeat) lastBeat() time.Time {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.last
+}
+
+func (h *heartbeat) writer(w io.Writer) io.Writer {
+	if w == nil {
+		w = ioutil.Discard
+	}
+	return heartbeatWriter{h: h, w: w}
+}
+
+type heartbeatWriter struct {
+	h *heartbeat
+	w io.Writer
+}
+
+func (hw heartbeatWriter) Write(p []byte) (int, error) {
+	hw.h.mu.Lock()
+	hw.h.last = time.Now()
+	hw.h.mu.Unlock()
+	return hw.w.Write(p)
+}
@@ -0,0 +1,54 @@
+package campaigns
+
+import (
+	"context"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestStepWatchdog(t *testing.T) {
+	tests := map[string]struct {
+		script      string
+		kill        bool
+		wantStalled bool
+		wantKilled  bool
+	}{
+		"regular output": {
+			script: "for i in 1 2 3 4 5 6; do echo $i; sleep 0.05; done",
+		},
+		"stalled": {
+			script:      "echo start; sleep 0.5; echo done",
+			wantStalled: true,
+		},
+		"stalled and killed": {
+			script:      "echo start; sleep 5",
+			kill:        true,
+			wantStalled: true,
+			wantKilled:  true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx, kill := context.WithCancel(context.Background())
+			defer kill()
+
+			w := &stepWatchdog{timeout: 200 * time.Millisecond, kill: tc.kill}
+			cmd := exec.CommandContext(ctx, "sh", "-c", tc.script)
+			stalled := false
+			err := w.run(cmd, 0, func(time.Duration) { stalled = true }, kill)
+
+			if stalled != tc.wantStalled {
+				t.Errorf("unexpected stalled: have %t; want %t", stalled, tc.wantStalled)
+			}
+			_, killed := err.(*errStepStalled)
+			if killed != tc.wantKilled {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if !tc.wantKilled && err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,266 @@
+package graphql
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// IntrospectionQuery is the query that returns the parts of the schema of a
+// GraphQL API that Validate needs. Its result, or the JSON of the whole
+// response, is parsed by ParseSchema.
+const IntrospectionQuery = `query IntrospectionQuery {
+  __schema {
+    queryType { name }
+    mutationType { name }
+    subscriptionType { name }
+    types {
+      kind
+      name
+      fields(includeDeprecated: true) {
+        name
+        args { ...InputValue }
+        type { ...TypeRef }
+      }
+      inputFields { ...InputValue }
+      interfaces { name }
+      enumValues(includeDeprecated: true) { name }
+      possibleTypes { name }
+    }
+    directives {
+      name
+      locations
+      args { ...InputValue }
+    }
+  }
+}
+
+fragment InputValue on __InputValue {
+  name
+  type { ...TypeRef }
+  defaultValue
+}
+
+fragment TypeRef on __Type {
+  kind
+  name
+  ofType {
+    kind
+    name
+    ofType {
+      kind
+      name
+      ofType {
+        kind
+        name
+        ofType {
+          kind
+          name
+          ofType {
+            kind
+            name
+            ofType {
+              kind
+              name
+            }
+          }
+        }
+      }
+    }
+  }
+}`
+
+// Schema is the schema of a GraphQL API that documents are validated
+// against.
+type Schema struct {
+	schema *ast.Schema
+}
+
+// ParseSchema parses the result of IntrospectionQuery, either the JSON of
+// the whole response or of its data.
+func ParseSchema(data []byte) (*Schema, error) {
+	var response struct {
+		Data struct {
+			Schema *introspectionSchema `json:"__schema"`
+		} `json:"data"`
+		Schema *introspectionSchema `json:"__schema"`
+	}
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, errors.Wrap(err, "parsing GraphQL schema")
+	}
+	s := response.Schema
+	if s == nil {
+		s = response.Data.Schema
+	}
+	if s == nil {
+		return nil, errors.New("parsing GraphQL schema: no __schema in introspection result")
+	}
+	schema, gqlErr := gqlparser.LoadSchema(&ast.Source{Name: "schema", Input: s.sdl()})
+	if gqlErr != nil {
+		return nil, errors.Wrap(gqlErr, "parsing GraphQL schema")
+	}
+	return &Schema{schema: schema}, nil
+}
+
+type introspectionSchema struct {
+	QueryType        *introspectionName
+	MutationType     *introspectionName
+	SubscriptionType *introspectionName
+	Types            []struct {
+		Kind   string
+		Name   string
+		Fields []struct {
+			Name string
+			Args []introspectionInputValue
+			Type *introspectionTypeRef
+		}
+		InputFields   []introspectionInputValue
+		Interfaces    []introspectionName
+		EnumValues    []introspectionName
+		PossibleTypes []introspectionName
+	}
+	Directives []struct {
+		Name      string
+		Locations []string
+		Args      []introspectionInputValue
+	}
+}
+
+type introspectionName struct {
+	Name string
+}
+
+type introspectionInputValue struct {
+	Name         string
+	Type         *introspectionTypeRef
+	DefaultValue *string
+}
+
+type introspectionTypeRef struct {
+	Kind   string
+	Name   string
+	OfType *introspectionTypeRef
+}
+
+func (r *introspectionTypeRef) String() string {
+	switch r.Kind {
+	case "NON_NULL":
+		return r.OfType.String() + "!"
+	case "LIST":
+		return "[" + r.OfType.String() + "]"
+	}
+	return r.Name
+}
+
+// builtins are the types and directives gqlparser defines itself, which a
+// schema can't define again.
+var builtins = map[string]bool{
+	"Boolean": true, "Float": true, "ID": true, "Int": true, "String": true,
+	"deprecated": true, "include": true, "skip": true, "specifiedBy": true,
+}
+
+// executableLocations are the locations of directives in schemas saved
+// before IntrospectionQuery asked for them.
+var executableLocations = []string{"QUERY", "MUTATION", "SUBSCRIPTION", "FIELD", "FRAGMENT_DEFINITION", "FRAGMENT_SPREAD", "INLINE_FRAGMENT"}
+
+// sdl returns the schema in the schema definition language, so that
+// gqlparser can load it.
+func (s *introspectionSchema) sdl() string {
+	var b strings.Builder
+	b.WriteString("schema {\n")
+	for _, root := range []struct {
+		operation string
+		typ       *introspectionName
+	}{
+		{"query", s.QueryType},
+		{"mutation", s.MutationType},
+		{"subscription", s.SubscriptionType},
+	} {
+		if root.typ != nil {
+			fmt.Fprintf(&b, "  %s: %s\n", root.operation, root.typ.Name)
+		}
+	}
+	b.WriteString("}\n")
+
+	for _, t := range s.Types {
+		if builtins[t.Name] || strings.HasPrefix(t.Name, "__") {
+			continue
+		}
+		switch t.Kind {
+		case "SCALAR":
+			fmt.Fprintf(&b, "scalar %s\n", t.Name)
+		case "OBJECT", "INTERFACE":
+			keyword := "type"
+			if t.Kind == "INTERFACE" {
+				keyword = "interface"
+			}
+			fmt.Fprintf(&b, "%s %s", keyword, t.Name)
+			for i, iface := range t.Interfaces {
+				if i == 0 {
+					b.WriteString(" implements ")
+				} else {
+					b.WriteString(" & ")
+				}
+				b.WriteString(iface.Name)
+			}
+			b.WriteString(" {\n")
+			for _, f := range t.Fields {
+				fmt.Fprintf(&b, "  %s%s: %s\n", f.Name, arguments(f.Args), f.Type)
+			}
+			b.WriteString("}\n")
+		case "UNION":
+			names := make([]string, 0, len(t.PossibleTypes))
+			for _, p := range t.PossibleTypes {
+				names = append(names, p.Name)
+			}
+			fmt.Fprintf(&b, "union %s = %s\n", t.Name, strings.Join(names, " | "))
+		case "ENUM":
+			fmt.Fprintf(&b, "enum %s {\n", t.Name)
+			for _, v := range t.EnumValues {
+				fmt.Fprintf(&b, "  %s\n", v.Name)
+			}
+			b.WriteString("}\n")
+		case "INPUT_OBJECT":
+			fmt.Fprintf(&b, "input %s {\n", t.Name)
+			for _, f := range t.InputFields {
+				fmt.Fprintf(&b, "  %s\n", inputValue(f))
+			}
+			b.WriteString("}\n")
+		}
+	}
+
+	for _, d := range s.Directives {
+		if builtins[d.Name] {
+			continue
+		}
+		locations := d.Locations
+		if len(locations) == 0 {
+			locations = executableLocations
+		}
+		fmt.Fprintf(&b, "directive @%s%s on %s\n", d.Name, arguments(d.Args), strings.Join(locations, " | "))
+	}
+	return b.String()
+}
+
+func arguments(args []introspectionInputValue) string {
+	if len(args) == 0 {
+		return ""
+	}
+	values := make([]string, 0, len(args))
+	for _, a := range args {
+		values = append(values, inputValue(a))
+	}
+	return "(" + strings.Join(values, ", ") + ")"
+}
+
+func inputValue(v introspectionInputValue) string {
+	s := v.Name + ": " + v.Type.String()
+	if v.DefaultValue != nil {
+		s += " = " + *v.DefaultValue
+	}
+	return s
+}
@@ -0,0 +1,66 @@
+package graphql
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestIntrospectionSchemaSDL(t *testing.T) {
+	var s introspectionSchema
+	if err := json.Unmarshal([]byte(`{
+  "queryType": {"name": "Query"},
+  "mutationType": null,
+  "subscriptionType": null,
+  "types": [
+    {"kind": "SCALAR", "name": "String"},
+    {"kind": "SCALAR", "name": "DateTime"},
+    {"kind": "OBJECT", "name": "__Type", "fields": [{"name": "name", "args": [], "type": {"kind": "SCALAR", "name": "String"}}]},
+    {"kind": "OBJECT", "name": "Query", "fields": [
+      {"name": "nodes", "args": [
+        {"name": "first", "type": {"kind": "SCALAR", "name": "Int"}, "defaultValue": "10"},
+        {"name": "ids", "type": {"kind": "NON_NULL", "ofType": {"kind": "LIST", "ofType": {"kind": "NON_NULL", "ofType": {"kind": "SCALAR", "name": "ID"}}}}}
+      ], "type": {"kind": "LIST", "ofType": {"kind": "INTERFACE", "name": "Node"}}}
+    ], "interfaces": []},
+    {"kind": "INTERFACE", "name": "Node", "fields": [{"name": "id", "args": [], "type": {"kind": "NON_NULL", "ofType": {"kind": "SCALAR", "name": "ID"}}}]},
+    {"kind": "OBJECT", "name": "User", "fields": [{"name": "id", "args": [], "type": {"kind": "NON_NULL", "ofType": {"kind": "SCALAR", "name": "ID"}}}], "interfaces": [{"name": "Node"}]},
+    {"kind": "UNION", "name": "Result", "possibleTypes": [{"name": "User"}, {"name": "Query"}]},
+    {"kind": "ENUM", "name": "State", "enumValues": [{"name": "OPEN"}, {"name": "CLOSED"}]},
+    {"kind": "INPUT_OBJECT", "name": "Filter", "inputFields": [{"name": "state", "type": {"kind": "ENUM", "name": "State"}, "defaultValue": "OPEN"}]}
+  ],
+  "directives": [
+    {"name": "include", "locations": ["FIELD"], "args": [{"name": "if", "type": {"kind": "NON_NULL", "ofType": {"kind": "SCALAR", "name": "Boolean"}}}]},
+    {"name": "cached", "args": []}
+  ]
+}`), &s); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `schema {
+  query: Query
+}
+scalar DateTime
+type Query {
+  nodes(first: Int = 10, ids: [ID!]!): [Node]
+}
+interface Node {
+  id: ID!
+}
+type User implements Node {
+  id: ID!
+}
+union Result = User | Query
+enum State {
+  OPEN
+  CLOSED
+}
+input Filter {
+  state: State = OPEN
+}
+directive @cached on QUERY | MUTATION | SUBSCRIPTION | FIELD | FRAGMENT_DEFINITION | FRAGMENT_SPREAD | INLINE_FRAGMENT
+`
+	if diff := cmp.Diff(want, s.sdl()); diff != "" {
+		t.Errorf("unexpected SDL (-want +have):\n%s", diff)
+	}
+}
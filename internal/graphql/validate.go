@@ -0,0 +1,48 @@
+package graphql
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"github.com/vektah/gqlparser/v2/parser"
+	"github.com/vektah/gqlparser/v2/validator"
+)
+
+// ValidationError is a problem of a document found by Validate.
+type ValidationError struct {
+	Line, Column int
+	Message      string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Message)
+}
+
+// Validate parses the document and validates it against the schema. It
+// returns the problems found, ordered by their position; a syntax error is
+// the only problem returned for a document that can't be parsed.
+func Validate(schema *Schema, document string) []*ValidationError {
+	doc, err := parser.ParseQuery(&ast.Source{Name: "document", Input: document})
+	if err != nil {
+		return []*ValidationError{validationError(err)}
+	}
+	var errs []*ValidationError
+	for _, err := range validator.Validate(schema.schema, doc) {
+		errs = append(errs, validationError(err))
+	}
+	sort.SliceStable(errs, func(i, j int) bool {
+		a, b := errs[i], errs[j]
+		return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+	})
+	return errs
+}
+
+func validationError(err *gqlerror.Error) *ValidationError {
+	e := &ValidationError{Message: err.Message}
+	if len(err.Locations) > 0 {
+		e.Line, e.Column = err.Locations[0].Line, err.Locations[0].Column
+	}
+	return e
+}
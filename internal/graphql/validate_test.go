@@ -0,0 +1,170 @@
+package graphql
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// testSchema is the result of IntrospectionQuery for a small schema.
+const testSchema = `{"data": {"__schema": {
+  "queryType": {"name": "Query"},
+  "mutationType": {"name": "Mutation"},
+  "subscriptionType": null,
+  "types": [
+    {"kind": "SCALAR", "name": "String"},
+    {"kind": "SCALAR", "name": "ID"},
+    {"kind": "SCALAR", "name": "Int"},
+    {"kind": "SCALAR", "name": "Boolean"},
+    {"kind": "OBJECT", "name": "Query", "fields": [
+      {"name": "repository", "args": [{"name": "name", "type": {"kind": "NON_NULL", "ofType": {"kind": "SCALAR", "name": "String"}}}], "type": {"kind": "OBJECT", "name": "Repository"}},
+      {"name": "search", "args": [
+        {"name": "query", "type": {"kind": "NON_NULL", "ofType": {"kind": "SCALAR", "name": "String"}}},
+        {"name": "version", "type": {"kind": "ENUM", "name": "SearchVersion"}, "defaultValue": "V1"}
+      ], "type": {"kind": "LIST", "ofType": {"kind": "UNION", "name": "SearchResult"}}}
+    ]},
+    {"kind": "OBJECT", "name": "Mutation", "fields": [
+      {"name": "createCampaign", "args": [{"name": "input", "type": {"kind": "NON_NULL", "ofType": {"kind": "INPUT_OBJECT", "name": "CreateCampaignInput"}}}], "type": {"kind": "OBJECT", "name": "Campaign"}}
+    ]},
+    {"kind": "OBJECT", "name": "Repository", "fields": [
+      {"name": "id", "args": [], "type": {"kind": "NON_NULL", "ofType": {"kind": "SCALAR", "name": "ID"}}},
+      {"name": "name", "args": [], "type": {"kind": "NON_NULL", "ofType": {"kind": "SCALAR", "name": "String"}}}
+    ]},
+    {"kind": "OBJECT", "name": "Campaign", "fields": [
+      {"name": "id", "args": [], "type": {"kind": "NON_NULL", "ofType": {"kind": "SCALAR", "name": "ID"}}}
+    ]},
+    {"kind": "OBJECT", "name": "FileMatch", "fields": [
+      {"name": "path", "args": [], "type": {"kind": "NON_NULL", "ofType": {"kind": "SCALAR", "name": "String"}}}
+    ]},
+    {"kind": "UNION", "name": "SearchResult", "possibleTypes": [{"name": "Repository"}, {"name": "FileMatch"}]},
+    {"kind": "ENUM", "name": "SearchVersion", "enumValues": [{"name": "V1"}, {"name": "V2"}]},
+    {"kind": "INPUT_OBJECT", "name": "CreateCampaignInput", "inputFields": [
+      {"name": "name", "type": {"kind": "NON_NULL", "ofType": {"kind": "SCALAR", "name": "String"}}},
+      {"name": "draft", "type": {"kind": "SCALAR", "name": "Boolean"}}
+    ]}
+  ],
+  "directives": [
+    {"name": "include", "args": [{"name": "if", "type": {"kind": "NON_NULL", "ofType": {"kind": "SCALAR", "name": "Boolean"}}}]}
+  ]
+}}}`
+
+func TestValidate(t *testing.T) {
+	schema, err := ParseSchema([]byte(testSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, tc := range map[string]struct {
+		document string
+		want     []string
+	}{
+		"valid": {
+			document: `
+# Comments, commas and block strings are fine.
+query Search($query: String!, $withName: Boolean = true) {
+  search(query: $query, version: V2) {
+    __typename
+    ... on Repository { id, name @include(if: $withName) }
+    ...FileMatchFields
+  }
+  repository(name: """github.com/"sourcegraph"/src-cli""") { id }
+}
+fragment FileMatchFields on FileMatch { path }
+mutation CreateCampaign { createCampaign(input: {name: "a", draft: false}) { id } }`,
+		},
+		"unknown field": {
+			document: `{ repository(name: "a") { id description } }`,
+			want:     []string{`1:30: Cannot query field "description" on type "Repository".`},
+		},
+		"union field": {
+			document: `{ search(query: "a") { path } }`,
+			want:     []string{`1:24: Cannot query field "path" on type "SearchResult". Did you mean to use an inline fragment on "FileMatch"?`},
+		},
+		"arguments": {
+			document: `{ repository(nam: "a") { id } search(query: "a", version: V3) { __typename } }`,
+			want: []string{
+				`1:3: Unknown argument "nam" on field "repository" of type "Query". Did you mean "name"?`,
+				`1:3: Field "repository" argument "name" of type "String!" is required but not provided.`,
+				`1:59: Expected type SearchVersion, found V3. Did you mean the enum value V1 or V2?`,
+			},
+		},
+		"input object": {
+			document: `mutation { createCampaign(input: {draft: "yes", branch: "b"}) { id } }`,
+			want: []string{
+				`1:34: Field CreateCampaignInput.name of required type String! was not provided.`,
+				`1:43: Expected type Boolean, found "yes".`,
+				`1:49: Field "branch" is not defined by type CreateCampaignInput.`,
+			},
+		},
+		"subfields": {
+			document: `{ repository(name: "a") { id { value } } search(query: "a") }`,
+			want: []string{
+				`1:27: Field "id" must not have a selection since type "ID" has no subfields.`,
+				`1:32: Cannot query field "value" on type "ID".`,
+				`1:42: Field "search" of type "[SearchResult]" must have a selection of subfields. Did you mean "search { ... }"?`,
+			},
+		},
+		"variables": {
+			document: `query Q($unused: Int, $name: Strin) { repository(name: $name) { id } search(query: $query) { __typename } }`,
+			want: []string{
+				`1:1: Variable "$query" is not defined by operation "Q".`,
+				`1:1: Unknown type "Strin".`,
+				`1:9: Variable "$unused" is never used in operation "Q".`,
+				`1:56: Variable "$name" of type "Strin" used in position expecting type "String!".`,
+			},
+		},
+		"fragments": {
+			document: `{ repository(name: "a") { ...Missing } } fragment Unused on Repository { id } fragment Bad on Nope { id }`,
+			want: []string{
+				`1:30: Unknown fragment "Missing".`,
+				`1:42: Fragment "Unused" is never used.`,
+				`1:79: Unknown type "Nope".`,
+				`1:79: Fragment "Bad" is never used.`,
+			},
+		},
+		"directives": {
+			document: `{ repository(name: "a") { id @cached name @include(if: true, else: false) } }`,
+			want: []string{
+				`1:31: Unknown directive "cached".`,
+				`1:44: Unknown argument "else" on directive "@include".`,
+			},
+		},
+		"introspection": {
+			document: `{ __schema { types { name } } __type(name: "Repository") { name } }`,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var have []string
+			for _, err := range Validate(schema, tc.document) {
+				have = append(have, err.Error())
+			}
+			if diff := cmp.Diff(tc.want, have); diff != "" {
+				t.Errorf("unexpected problems (-want +have):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestValidateSyntaxErrors(t *testing.T) {
+	schema, err := ParseSchema([]byte(testSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for document, want := range map[string]string{
+		`{ repository(name: "a) { id } }`:  `1:32: Unexpected <Invalid>`,
+		"{\n  repository {\n    id\n}":     `4:2: Expected Name, found <EOF>`,
+		"{\n  repository {}\n}":            `2:15: expected at least one definition, found }`,
+		`query Q($a: ) { id }`:             `1:13: Expected Name, found )`,
+		`{ a(b: 1.) }`:                     `1:10: Unexpected <Invalid>`,
+		`fragment on on Repository { id }`: `1:10: Unexpected Name "on"`,
+	} {
+		var have []string
+		for _, err := range Validate(schema, document) {
+			have = append(have, err.Error())
+		}
+		if diff := cmp.Diff([]string{want}, have); diff != "" {
+			t.Errorf("unexpected problems of %q (-want +have):\n%s", document, diff)
+		}
+	}
+}
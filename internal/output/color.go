@@ -0,0 +1,55 @@
+package output
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/mattn/go-isatty"
+)
+
+// The values accepted by the global -color flag.
+const (
+	ColorAuto   = "auto"
+	ColorAlways = "always"
+	ColorNever  = "never"
+)
+
+var colorMode = ColorAuto
+
+// SetColorMode sets the mode used by ColorEnabled. It returns an error if
+// mode is not one of ColorAuto, ColorAlways or ColorNever.
+func SetColorMode(mode string) error {
+	switch mode {
+	case ColorAuto, ColorAlways, ColorNever:
+		colorMode = mode
+		return nil
+	}
+	return fmt.Errorf("invalid color mode %q: must be one of %s, %s or %s", mode, ColorAuto, ColorAlways, ColorNever)
+}
+
+// ColorEnabled reports whether output written to f should be colored.
+//
+// In auto mode, we comply with the no-color.org spec and also respect
+// COLOR=true or COLOR=false. Otherwise, colors are only used if f is a
+// terminal that is not a dumb terminal.
+func ColorEnabled(f *os.File) bool {
+	switch colorMode {
+	case ColorAlways:
+		return true
+	case ColorNever:
+		return false
+	}
+
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	if color := os.Getenv("COLOR"); color != "" {
+		enabled, _ := strconv.ParseBool(color)
+		return enabled
+	}
+	if os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	return isatty.IsTerminal(f.Fd()) || isatty.IsCygwinTerminal(f.Fd())
+}
@@ -0,0 +1,36 @@
+// Package output contains helpers shared by all commands that render output
+// meant to be read by humans.
+package output
+
+// NoEmoji disables emoji in output rendered through Emoji. It is set by the
+// global -no-emoji flag.
+var NoEmoji bool
+
+// The emoji and symbols used in src output. All of them have a plain ASCII
+// replacement that is used when NoEmoji is set.
+const (
+	EmojiSuccess    = "✔"
+	EmojiFailure    = "✗"
+	EmojiArrow      = "▶"
+	EmojiLogo       = "✱"
+	EmojiAlert      = "❗"
+	EmojiBreadcrumb = "›"
+)
+
+var emojiFallbacks = map[string]string{
+	EmojiSuccess:    "OK",
+	EmojiFailure:    "X",
+	EmojiArrow:      ">",
+	EmojiLogo:       "*",
+	EmojiAlert:      "!",
+	EmojiBreadcrumb: ">",
+}
+
+// Emoji returns e, or its ASCII replacement if NoEmoji is set. Unknown emoji
+// are dropped when NoEmoji is set.
+func Emoji(e string) string {
+	if !NoEmoji {
+		return e
+	}
+	return emojiFallbacks[e]
+}
@@ -0,0 +1,31 @@
+package output
+
+import (
+	"io"
+	"os"
+	"sync"
+)
+
+// LockedWriter serializes the writes of concurrent goroutines to a writer,
+// so that each write reaches it in one piece. Writers that output lines,
+// such as the progress output of 'src actions exec', should write each line
+// in a single call for it not to be interleaved with the output of others.
+type LockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewLockedWriter returns a LockedWriter that writes to w.
+func NewLockedWriter(w io.Writer) *LockedWriter {
+	return &LockedWriter{w: w}
+}
+
+func (l *LockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
+
+// Stderr is standard error, shared by all code that writes to it from
+// concurrent goroutines.
+var Stderr = NewLockedWriter(os.Stderr)
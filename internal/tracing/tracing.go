@@ -0,0 +1,394 @@
+// Package tracing provides a minimal span recorder that exports to an
+// OpenTelemetry collector using the OTLP/HTTP JSON protocol.
+//
+// Tracing is configured through the standard OpenTelemetry environment
+// variables: if neither OTEL_EXPORTER_OTLP_ENDPOINT nor
+// OTEL_EXPORTER_OTLP_TRACES_ENDPOINT is set, all operations are no-ops.
+//
+// Finished spans are exported in the background in batches of up to
+// OTEL_BSP_MAX_EXPORT_BATCH_SIZE spans, or every OTEL_BSP_SCHEDULE_DELAY
+// milliseconds, whichever comes first. Flush exports the remaining spans.
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tracer collects finished spans and exports them in batches.
+type Tracer struct {
+	serviceName string
+	endpoint    string
+	headers     map[string]string
+	client      func() *http.Client
+
+	// batchSize is the number of finished spans that triggers an export. If
+	// it is zero, spans are only exported periodically and by Flush.
+	batchSize int
+
+	mu        sync.Mutex
+	spans     []*Span
+	exportErr error
+	exports   sync.WaitGroup
+}
+
+var global *Tracer
+
+const (
+	// defaultBatchSize and defaultScheduleDelay are the defaults of
+	// OTEL_BSP_MAX_EXPORT_BATCH_SIZE and OTEL_BSP_SCHEDULE_DELAY.
+	defaultBatchSize     = 512
+	defaultScheduleDelay = 5 * time.Second
+
+	// exportTimeout limits each background export.
+	exportTimeout = 10 * time.Second
+)
+
+// Init configures the global tracer from the environment. It must be called
+// before any spans are started; spans started without a configured tracer
+// are discarded.
+//
+// client returns the HTTP client used to export spans. It is called for every
+// export, so that the client may be configured after Init, e.g. from flags.
+func Init(client func() *http.Client) {
+	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if endpoint == "" {
+		if base := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); base != "" {
+			endpoint = strings.TrimSuffix(base, "/") + "/v1/traces"
+		}
+	}
+	if endpoint == "" {
+		return
+	}
+
+	serviceName := os.Getenv("OTEL_SERVICE_NAME")
+	if serviceName == "" {
+		serviceName = "src-cli"
+	}
+
+	batchSize := defaultBatchSize
+	if n, err := strconv.Atoi(os.Getenv("OTEL_BSP_MAX_EXPORT_BATCH_SIZE")); err == nil && n > 0 {
+		batchSize = n
+	}
+	scheduleDelay := defaultScheduleDelay
+	if ms, err := strconv.Atoi(os.Getenv("OTEL_BSP_SCHEDULE_DELAY")); err == nil && ms > 0 {
+		scheduleDelay = time.Duration(ms) * time.Millisecond
+	}
+
+	global = &Tracer{
+		serviceName: serviceName,
+		endpoint:    endpoint,
+		headers:     parseHeaders(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS")),
+		client:      client,
+		batchSize:   batchSize,
+	}
+	go global.exportPeriodically(scheduleDelay)
+}
+
+// Enabled returns true if a tracer has been configured.
+func Enabled() bool { return global != nil }
+
+// Flush exports all spans finished so far to the configured collector and
+// waits for background exports to finish. It returns the first error of any
+// export since the previous call.
+func Flush(ctx context.Context) error {
+	if global == nil {
+		return nil
+	}
+	return global.flush(ctx)
+}
+
+// Span is a single timed operation. A nil *Span is valid and ignores all
+// method calls, which is what StartSpan returns when tracing is disabled.
+type Span struct {
+	tracer   *Tracer
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte
+	name     string
+	start    time.Time
+	end      time.Time
+	attrs    map[string]interface{}
+	err      error
+}
+
+type spanKey struct{}
+
+// StartSpan starts a span with the given name. If ctx already carries a span,
+// the new span becomes its child. The returned context carries the new span.
+func StartSpan(ctx context.Context, name string) (*Span, context.Context) {
+	if global == nil {
+		return nil, ctx
+	}
+
+	s := &Span{
+		tracer: global,
+		name:   name,
+		start:  time.Now(),
+		attrs:  map[string]interface{}{},
+	}
+	if parent, ok := ctx.Value(spanKey{}).(*Span); ok && parent != nil {
+		s.traceID = parent.traceID
+		s.parentID = parent.spanID
+	} else {
+		_, _ = rand.Read(s.traceID[:])
+	}
+	_, _ = rand.Read(s.spanID[:])
+
+	return s, context.WithValue(ctx, spanKey{}, s)
+}
+
+// SetAttribute attaches a key/value pair to the span. Values should be
+// strings, bools, or integers.
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.attrs[key] = value
+}
+
+// Finish ends the span, marking it as failed if err is non-nil.
+func (s *Span) Finish(err error) {
+	if s == nil {
+		return
+	}
+	s.end = time.Now()
+	s.err = err
+
+	t := s.tracer
+	t.mu.Lock()
+	t.spans = append(t.spans, s)
+	var batch []*Span
+	if t.batchSize > 0 && len(t.spans) >= t.batchSize {
+		batch = t.takeSpans()
+	}
+	t.mu.Unlock()
+
+	t.exportInBackground(batch)
+}
+
+// takeSpans returns the finished spans that haven't been exported yet. t.mu
+// must be held.
+func (t *Tracer) takeSpans() []*Span {
+	spans := t.spans
+	t.spans = nil
+	return spans
+}
+
+func (t *Tracer) exportPeriodically(delay time.Duration) {
+	ticker := time.NewTicker(delay)
+	defer ticker.Stop()
+	for range ticker.C {
+		t.mu.Lock()
+		batch := t.takeSpans()
+		t.mu.Unlock()
+
+		t.exportInBackground(batch)
+	}
+}
+
+// exportInBackground exports spans without blocking. Errors are returned by
+// the next flush.
+func (t *Tracer) exportInBackground(spans []*Span) {
+	if len(spans) == 0 {
+		return
+	}
+	t.exports.Add(1)
+	go func() {
+		defer t.exports.Done()
+
+		ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+		defer cancel()
+		if err := t.export(ctx, spans); err != nil {
+			t.mu.Lock()
+			if t.exportErr == nil {
+				t.exportErr = err
+			}
+			t.mu.Unlock()
+		}
+	}()
+}
+
+func (t *Tracer) flush(ctx context.Context) error {
+	t.mu.Lock()
+	spans := t.takeSpans()
+	t.mu.Unlock()
+
+	err := t.export(ctx, spans)
+
+	done := make(chan struct{})
+	go func() {
+		t.exports.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		if err == nil {
+			err = ctx.Err()
+		}
+	}
+
+	t.mu.Lock()
+	if err == nil {
+		err = t.exportErr
+	}
+	t.exportErr = nil
+	t.mu.Unlock()
+	return err
+}
+
+func (t *Tracer) export(ctx context.Context, spans []*Span) error {
+	if len(spans) == 0 {
+		return nil
+	}
+
+	body, err := json.Marshal(t.payload(spans))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", t.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := t.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("exporting spans failed: %s\n\n%s", resp.Status, body)
+	}
+	return nil
+}
+
+func (t *Tracer) httpClient() *http.Client {
+	if t.client == nil {
+		return http.DefaultClient
+	}
+	return t.client()
+}
+
+// The types below mirror the subset of the OTLP JSON encoding that we need.
+// See https://github.com/open-telemetry/opentelemetry-proto for the full
+// definitions.
+
+type otlpAttribute struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+const (
+	otlpSpanKindInternal = 1
+
+	otlpStatusOK    = 1
+	otlpStatusError = 2
+)
+
+func (t *Tracer) payload(spans []*Span) interface{} {
+	var zeroID [8]byte
+
+	converted := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		o := otlpSpan{
+			TraceID:           hex.EncodeToString(s.traceID[:]),
+			SpanID:            hex.EncodeToString(s.spanID[:]),
+			Name:              s.name,
+			Kind:              otlpSpanKindInternal,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+			Status:            otlpStatus{Code: otlpStatusOK},
+		}
+		if s.parentID != zeroID {
+			o.ParentSpanID = hex.EncodeToString(s.parentID[:])
+		}
+		for k, v := range s.attrs {
+			o.Attributes = append(o.Attributes, attribute(k, v))
+		}
+		if s.err != nil {
+			o.Status = otlpStatus{Code: otlpStatusError, Message: s.err.Error()}
+		}
+		converted = append(converted, o)
+	}
+
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": []otlpAttribute{attribute("service.name", t.serviceName)},
+				},
+				"scopeSpans": []interface{}{
+					map[string]interface{}{
+						"scope": map[string]interface{}{"name": "github.com/sourcegraph/src-cli"},
+						"spans": converted,
+					},
+				},
+			},
+		},
+	}
+}
+
+func attribute(key string, value interface{}) otlpAttribute {
+	var v map[string]interface{}
+	switch value := value.(type) {
+	case bool:
+		v = map[string]interface{}{"boolValue": value}
+	case int:
+		v = map[string]interface{}{"intValue": strconv.Itoa(value)}
+	case int64:
+		v = map[string]interface{}{"intValue": strconv.FormatInt(value, 10)}
+	default:
+		v = map[string]interface{}{"stringValue": fmt.Sprint(value)}
+	}
+	return otlpAttribute{Key: key, Value: v}
+}
+
+// parseHeaders parses the comma-separated key=value list format used by
+// OTEL_EXPORTER_OTLP_HEADERS.
+func parseHeaders(s string) map[string]string {
+	headers := map[string]string{}
+	for _, pair := range strings.Split(s, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			continue
+		}
+		headers[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	return headers
+}
@@ -0,0 +1,189 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFlush(t *testing.T) {
+	var (
+		gotPath   string
+		gotHeader string
+		got       struct {
+			ResourceSpans []struct {
+				ScopeSpans []struct {
+					Spans []otlpSpan
+				}
+			}
+		}
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotHeader = r.Header.Get("X-Api-Key")
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer ts.Close()
+
+	old := global
+	t.Cleanup(func() { global = old })
+	global = &Tracer{
+		serviceName: "src-cli",
+		endpoint:    ts.URL + "/v1/traces",
+		headers:     parseHeaders("X-Api-Key=secret"),
+	}
+
+	parent, ctx := StartSpan(context.Background(), "parent")
+	child, _ := StartSpan(ctx, "child")
+	child.SetAttribute("repository", "github.com/sourcegraph/src-cli")
+	child.Finish(errors.New("boom"))
+	parent.Finish(nil)
+
+	if err := Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if gotPath != "/v1/traces" {
+		t.Errorf("unexpected path: %q", gotPath)
+	}
+	if gotHeader != "secret" {
+		t.Errorf("unexpected header value: %q", gotHeader)
+	}
+
+	spans := got.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("unexpected number of spans: %d", len(spans))
+	}
+	c, p := spans[0], spans[1]
+	if c.TraceID != p.TraceID {
+		t.Errorf("child and parent have different trace IDs: %q and %q", c.TraceID, p.TraceID)
+	}
+	if c.ParentSpanID != p.SpanID {
+		t.Errorf("unexpected parent span ID: have %q; want %q", c.ParentSpanID, p.SpanID)
+	}
+	if p.ParentSpanID != "" {
+		t.Errorf("unexpected parent span ID for root span: %q", p.ParentSpanID)
+	}
+	if diff := cmp.Diff(otlpStatus{Code: otlpStatusError, Message: "boom"}, c.Status); diff != "" {
+		t.Errorf("unexpected status: %s", diff)
+	}
+	if diff := cmp.Diff([]otlpAttribute{{Key: "repository", Value: map[string]interface{}{"stringValue": "github.com/sourcegraph/src-cli"}}}, c.Attributes); diff != "" {
+		t.Errorf("unexpected attributes: %s", diff)
+	}
+}
+
+func TestExportBatches(t *testing.T) {
+	exported := make(chan int, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var got struct {
+			ResourceSpans []struct {
+				ScopeSpans []struct {
+					Spans []otlpSpan
+				}
+			}
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+		exported <- len(got.ResourceSpans[0].ScopeSpans[0].Spans)
+	}))
+	defer ts.Close()
+
+	waitForExport := func(t *testing.T) int {
+		t.Helper()
+		select {
+		case n := <-exported:
+			return n
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for spans to be exported")
+			return 0
+		}
+	}
+
+	old := global
+	t.Cleanup(func() { global = old })
+
+	t.Run("batch size", func(t *testing.T) {
+		global = &Tracer{endpoint: ts.URL, batchSize: 2}
+
+		for _, name := range []string{"a", "b", "c"} {
+			span, _ := StartSpan(context.Background(), name)
+			span.Finish(nil)
+		}
+		if n := waitForExport(t); n != 2 {
+			t.Errorf("unexpected number of spans in batch: %d", n)
+		}
+
+		if err := Flush(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if n := waitForExport(t); n != 1 {
+			t.Errorf("unexpected number of spans flushed: %d", n)
+		}
+	})
+
+	t.Run("schedule delay", func(t *testing.T) {
+		global = &Tracer{endpoint: ts.URL}
+		go global.exportPeriodically(10 * time.Millisecond)
+
+		span, _ := StartSpan(context.Background(), "a")
+		span.Finish(nil)
+		if n := waitForExport(t); n != 1 {
+			t.Errorf("unexpected number of spans in batch: %d", n)
+		}
+
+		if err := Flush(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case n := <-exported:
+			t.Errorf("unexpected export of %d spans after all spans were exported", n)
+		default:
+		}
+	})
+
+	t.Run("background errors", func(t *testing.T) {
+		failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "collector unavailable", http.StatusServiceUnavailable)
+		}))
+		defer failing.Close()
+		global = &Tracer{endpoint: failing.URL, batchSize: 1}
+
+		span, _ := StartSpan(context.Background(), "a")
+		span.Finish(nil)
+		if err := Flush(context.Background()); err == nil {
+			t.Error("unexpected nil error")
+		}
+		if err := Flush(context.Background()); err != nil {
+			t.Errorf("unexpected error reported twice: %s", err)
+		}
+	})
+}
+
+func TestDisabled(t *testing.T) {
+	old := global
+	t.Cleanup(func() { global = old })
+	global = nil
+
+	span, ctx := StartSpan(context.Background(), "noop")
+	if span != nil {
+		t.Errorf("unexpected non-nil span")
+	}
+	// None of these should panic.
+	span.SetAttribute("foo", "bar")
+	span.Finish(nil)
+	if ctx == nil {
+		t.Errorf("unexpected nil context")
+	}
+	if err := Flush(context.Background()); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
@@ -21,11 +21,40 @@ const ActionSchemaJSON = `{
       "type": "string",
       "minLength": 1
     },
+    "extends": {
+      "description": "Path, or list of paths, of action definitions to extend, relative to this file. Their steps are executed before the steps of this action definition. All other properties are overridden by this action definition.",
+      "oneOf": [
+        { "type": "string", "minLength": 1 },
+        { "type": "array", "items": { "type": "string", "minLength": 1 } }
+      ]
+    },
     "scopeQuery": {
       "description": "A Sourcegraph search query to generate a list of repositories over which to run the action. Use 'src actions scope-query' to see which repositories are matched by the query.",
       "type": "string",
       "minLength": 1
     },
+    "allowUnsupported": {
+      "description": "What to do with repositories matched by the scopeQuery that are on code hosts not supported by campaigns: \"skip\" them, fail with an \"error\", or \"include\" them to generate patches that can only be imported as changesets. Can be overridden with 'src actions exec -allow-unsupported'.",
+      "type": "string",
+      "enum": ["skip", "error", "include"],
+      "default": "skip"
+    },
+    "requireFileMatches": {
+      "description": "Skip the repositories in which the scopeQuery matched no files, e.g. those matched by their name only. The paths of the matched files are listed in the file named by the SRC_SEARCH_RESULT_PATHS_FILE environment variable of the steps, one per line.",
+      "type": "boolean",
+      "default": false
+    },
+    "matrix": {
+      "description": "Runs the steps once for every combination of the given values in each repository. Use ${{ matrix.KEY }} in the string fields of steps, e.g. \"image\", \"args\" and \"cacheDirs\", to refer to the value of KEY.",
+      "type": "object",
+      "additionalProperties": {
+        "type": "array",
+        "minItems": 1,
+        "items": {
+          "type": "string"
+        }
+      }
+    },
     "steps": {
       "description": "A list of action steps to execute in each repository.",
       "type": "array",
@@ -36,12 +65,12 @@ const ActionSchemaJSON = `{
         "additionalProperties": false,
         "properties": {
           "type": {
-            "description": "Can be either \"command\", which executes the step in the native environment (OS) of the machine where 'src actions exec' is executed, or \"docker\" which runs a container with the repository contents mounted in at ` + "`" + `/work` + "`" + `. Note that local images (not from a Docker registry) must be built manually prior to executing.",
+            "description": "Can be either \"command\", which executes the step in the native environment (OS) of the machine where 'src actions exec' is executed, or \"docker\" which runs a container with the repository contents mounted in at ` + "`" + `/work` + "`" + `. Note that local images (not from a Docker registry) must be built manually prior to executing, or be built from a Dockerfile with \"build\".",
             "type": "string",
             "enum": ["command", "docker"]
           },
           "args": {
-            "description": "The command and its argument to execute if \"type\" is \"command\", or a list of arguments to be passed to the Docker container if \"type\" is \"docker\".",
+            "description": "The command and its argument to execute if \"type\" is \"command\", or a list of arguments to be passed to the Docker container if \"type\" is \"docker\". Use ${{ secrets.NAME }} to refer to the value of the secret NAME, which is passed with 'src actions exec -secrets-file'. It is replaced with ${NAME}, a reference to an environment variable that must be expanded by a shell, e.g. in args of [\"sh\", \"-c\", \"...\"].",
             "type": "array",
             "minItems": 1,
             "items": {
@@ -49,7 +78,12 @@ const ActionSchemaJSON = `{
             }
           },
           "image": {
-            "description": "The Docker image handle for running the container executing this step. Just like when running ` + "`" + `docker run` + "`" + `, ` + "`" + `args` + "`" + ` here override the default ` + "`" + `CMD` + "`" + ` to be executed.",
+            "description": "The Docker image handle for running the container executing this step. Just like when running ` + "`" + `docker run` + "`" + `, ` + "`" + `args` + "`" + ` here override the default ` + "`" + `CMD` + "`" + ` to be executed. Required unless \"build\" is given.",
+            "type": "string",
+            "minLength": 1
+          },
+          "build": {
+            "description": "Path to a directory with a Dockerfile, relative to the action definition, from which the image of a \"docker\" step is built before the action is executed. If \"image\" is also given, the built image is tagged with it.",
             "type": "string",
             "minLength": 1
           },
@@ -59,6 +93,49 @@ const ActionSchemaJSON = `{
             "items": {
               "type": "string"
             }
+          },
+          "artifacts": {
+            "description": "Glob patterns, relative to the repository root, of files produced by the step, e.g. test reports or logs, to copy out of the workspace into the artifacts directory of the execution. Matching files that are not part of the repository are left out of the resulting patch.",
+            "type": "array",
+            "items": {
+              "type": "string",
+              "minLength": 1
+            }
+          },
+          "network": {
+            "description": "The network of the \"docker\" step container: \"none\" runs the container without network access, which makes the step hermetic, \"host\" uses the network of the host and \"default\" uses Docker's default bridge network.",
+            "type": "string",
+            "enum": ["none", "host", "default"]
+          },
+          "readOnly": {
+            "description": "Run the \"docker\" step container with a read-only root filesystem. The repository in ` + "`" + `/work` + "`" + ` and a temporary ` + "`" + `/tmp` + "`" + ` stay writable.",
+            "type": "boolean"
+          },
+          "capDrop": {
+            "description": "Linux capabilities to drop in the \"docker\" step container, e.g. [\"ALL\"].",
+            "type": "array",
+            "items": {
+              "type": "string",
+              "minLength": 1
+            }
+          },
+          "securityOpt": {
+            "description": "Security options for the \"docker\" step container, e.g. [\"no-new-privileges\", \"seccomp=/path/to/profile.json\"]. Passed to ` + "`" + `docker run --security-opt` + "`" + `.",
+            "type": "array",
+            "items": {
+              "type": "string",
+              "minLength": 1
+            }
+          },
+          "user": {
+            "description": "The user (and optionally group) to run the \"docker\" step container as, in the format of ` + "`" + `docker run --user` + "`" + `, e.g. \"1000:1000\".",
+            "type": "string",
+            "minLength": 1
+          },
+          "platform": {
+            "description": "The platform of the image of the \"docker\" step, e.g. \"linux/amd64\" for an image that is only available for amd64. Passed to ` + "`" + `docker run --platform` + "`" + `. Defaults to the platform of the Docker daemon, e.g. \"linux/arm64\" on Apple Silicon.",
+            "type": "string",
+            "pattern": "^[a-z0-9_]+/[a-z0-9_]+(/[a-z0-9_]+)?$"
           }
         },
         "oneOf": [
@@ -66,14 +143,15 @@ const ActionSchemaJSON = `{
             "required": ["args"],
             "properties": {
               "type": { "const": "command" },
-              "image": { "type": "null" }
+              "image": { "type": "null" },
+              "build": { "type": "null" }
             }
           },
           {
-            "required": ["image"],
             "properties": {
               "type": { "const": "docker" }
-            }
+            },
+            "anyOf": [{ "required": ["image"] }, { "required": ["build"] }]
           }
         ]
       }